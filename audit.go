@@ -0,0 +1,329 @@
+package delayed_job
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the max count of the records which are returned by '/audit'.
+const max_audit_limit = 1000
+
+// auditTable is the table which records the actions of the console and the
+// api, such as retry, delete, settings changes and test sends.
+func (self *dbBackend) auditTable() string {
+	return self.table + "_audit"
+}
+
+func (self *dbBackend) auditTableScripts() []string {
+	switch self.dbType {
+	case MSSQL:
+		return []string{`if object_id('dbo.` + self.auditTable() + `', 'U') is not null
+				BEGIN
+							 DROP TABLE ` + self.auditTable() + `;
+				END`,
+			`CREATE TABLE dbo.` + self.auditTable() + ` (
+						  actor             varchar(200),
+						  remote_addr       varchar(100),
+						  action            varchar(50) NOT NULL,
+						  target            varchar(2000),
+						  before_value      text,
+						  after_value       text,
+						  created_at        DATETIME2 NOT NULL
+						);`}
+	case POSTGRESQL:
+		return []string{`DROP TABLE IF EXISTS ` + self.auditTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.auditTable() + ` (
+				  actor             varchar(200),
+				  remote_addr       varchar(100),
+				  action            varchar(50) NOT NULL,
+				  target            varchar(2000),
+				  before_value      text,
+				  after_value       text,
+				  created_at        timestamp with time zone NOT NULL
+				);`}
+	case ORACLE:
+		return []string{`BEGIN EXECUTE IMMEDIATE 'DROP TABLE ` + self.auditTable() + `';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE TABLE ` + self.auditTable() + ` (
+					  actor             varchar2(200 BYTE),
+					  remote_addr       varchar2(100 BYTE),
+					  action            varchar2(50 BYTE) NOT NULL,
+					  target            VARCHAR2(2000 BYTE),
+					  before_value      clob,
+					  after_value       clob,
+					  created_at        DATE
+					)`}
+	default:
+		return []string{`DROP TABLE IF EXISTS ` + self.auditTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.auditTable() + ` (
+					  actor             varchar(200),
+					  remote_addr       varchar(100),
+					  action            varchar(50) NOT NULL,
+					  target            VARCHAR(2000),
+					  before_value      text,
+					  after_value       text,
+					  created_at        DATETIME NOT NULL
+					);`}
+	}
+}
+
+// auditValue marshals the value of the audit record, the sensitive fields are
+// redacted.
+func auditValue(value interface{}) sql.NullString {
+	if nil == value {
+		return sql.NullString{}
+	}
+	bs, e := json.Marshal(redactValue(value))
+	if nil != e {
+		return sql.NullString{Valid: true, String: strconv.Quote(e.Error())}
+	}
+	return sql.NullString{Valid: true, String: string(bs)}
+}
+
+// auditActor returns the authenticated user of the request, or the remote
+// address if the authentication is disabled.
+func auditActor(r *http.Request) string {
+	if user := authUser(r); 0 != len(user) {
+		return user
+	}
+	return r.RemoteAddr
+}
+
+// audit records the action which is applied by the request, target is the
+// job ids, the queue or the settings keys. A failure is logged only, the
+// action itself has been done.
+func (self *dbBackend) audit(r *http.Request, action, target string, before, after interface{}) {
+	self.auditAs(auditActor(r), r.RemoteAddr, action, target, before, after)
+}
+
+// auditAs records the action which is applied by the actor, it is used by
+// the actions which aren't from the console, such as the command line.
+func (self *dbBackend) auditAs(actor, remote_addr, action, target string, before, after interface{}) {
+	if len(target) > 2000 {
+		target = target[:1990] + "..."
+	}
+
+	now := self.db_time_now()
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := self.db.Exec("INSERT INTO "+self.auditTable()+"(actor, remote_addr, action, target, before_value, after_value, created_at) VALUES ("+
+		args.add(actor)+", "+args.add(remote_addr)+", "+args.add(action)+", "+args.add(target)+", "+
+		args.add(auditValue(before))+", "+args.add(auditValue(after))+", "+self.nowSQL(args, now)+")", args.values...)
+	if nil != e {
+		self.log().Warn("save audit record failed", "action", action, "target", target,
+			"error", i18nString(self.dbType, self.drv, e))
+	}
+}
+
+type auditQuery struct {
+	action string
+	actor  string
+	target string
+	since  time.Time
+	until  time.Time
+	limit  int
+}
+
+func parseAuditQuery(r *http.Request) (*auditQuery, error) {
+	values := r.URL.Query()
+	query := &auditQuery{action: values.Get("action"),
+		actor:  values.Get("actor"),
+		target: values.Get("target"),
+		limit:  100}
+
+	for _, item := range []struct {
+		name  string
+		value *time.Time
+	}{{name: "since", value: &query.since},
+		{name: "until", value: &query.until}} {
+		s := values.Get(item.name)
+		if 0 == len(s) {
+			continue
+		}
+		t, e := time.Parse(time.RFC3339, s)
+		if nil != e {
+			return nil, errors.New("'" + item.name + "' is not a RFC3339 time, " + e.Error())
+		}
+		*item.value = t
+	}
+
+	if s := values.Get("limit"); 0 != len(s) {
+		limit, e := strconv.Atoi(s)
+		if nil != e || limit <= 0 {
+			return nil, errors.New("'limit' must be a positive number, actual value is '" + s + "'")
+		}
+		if limit > max_audit_limit {
+			limit = max_audit_limit
+		}
+		query.limit = limit
+	}
+	return query, nil
+}
+
+// auditRecords returns the audit records matching the query, the latest
+// record is first.
+func (self *dbBackend) auditRecords(query *auditQuery) ([]map[string]interface{}, error) {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	var conditions []string
+	if 0 != len(query.action) {
+		conditions = append(conditions, "action = "+args.add(query.action))
+	}
+	if 0 != len(query.actor) {
+		conditions = append(conditions, "actor = "+args.add(query.actor))
+	}
+	if 0 != len(query.target) {
+		conditions = append(conditions, "target LIKE "+args.add("%"+query.target+"%"))
+	}
+	if !query.since.IsZero() {
+		conditions = append(conditions, "created_at >= "+args.add(query.since))
+	}
+	if !query.until.IsZero() {
+		conditions = append(conditions, "created_at < "+args.add(query.until))
+	}
+	where := ""
+	if 0 != len(conditions) {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, e := self.db.Query(limitSQL(self.dbType, "SELECT actor, remote_addr, action, target, before_value, after_value, created_at FROM "+
+		self.auditTable()+where+" ORDER BY created_at DESC", query.limit), args.values...)
+	if nil != e {
+		return nil, errors.New("query audit records failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for len(results) < query.limit && rows.Next() {
+		var actor, remote_addr, target, before, after sql.NullString
+		var action string
+		var created_at NullTime
+		e = rows.Scan(&actor, &remote_addr, &action, &target, &before, &after, &created_at)
+		if nil != e {
+			return nil, errors.New("scan audit records failed, " + i18nString(self.dbType, self.drv, e))
+		}
+
+		record := map[string]interface{}{"actor": actor.String,
+			"remote_addr": remote_addr.String,
+			"action":      action,
+			"target":      target.String}
+		if before.Valid {
+			record["before"] = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			record["after"] = json.RawMessage(after.String)
+		}
+		if created_at.Valid {
+			record["created_at"] = created_at.Time
+		}
+		results = append(results, record)
+	}
+	if e = rows.Err(); nil != e {
+		return nil, errors.New("next audit records failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return results, nil
+}
+
+// jobSnapshot returns the state of the job before it is retried or deleted,
+// it returns nil if the job is not found.
+func (self *dbBackend) jobSnapshot(id int64) map[string]interface{} {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	var queue, handler_id, last_error sql.NullString
+	var attempts int
+	var failed_at NullTime
+	e := self.db.QueryRow("SELECT queue, handler_id, attempts, last_error, failed_at FROM "+self.table+
+		" WHERE id = "+args.add(id), args.values...).Scan(&queue, &handler_id, &attempts, &last_error, &failed_at)
+	if nil != e {
+		return nil
+	}
+
+	snapshot := map[string]interface{}{"queue": queue.String,
+		"handler_id": handler_id.String,
+		"attempts":   attempts,
+		"last_error": last_error.String}
+	if failed_at.Valid {
+		snapshot["failed_at"] = failed_at.Time
+	}
+	return snapshot
+}
+
+// flattenSettings flattens the nested settings into the keys of the flags,
+// such as "mail.smtp_server".
+func flattenSettings(prefix string, settings map[string]interface{}, out map[string]interface{}) map[string]interface{} {
+	if nil == out {
+		out = map[string]interface{}{}
+	}
+	for k, v := range settings {
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenSettings(prefix+k+".", m, out)
+		} else {
+			out[prefix+k] = v
+		}
+	}
+	return out
+}
+
+// diffSettings returns the changed keys with the values before and after.
+func diffSettings(old_settings, new_settings map[string]interface{}) ([]string, map[string]interface{}, map[string]interface{}) {
+	old_flat := flattenSettings("", old_settings, nil)
+	new_flat := flattenSettings("", new_settings, nil)
+
+	var keys []string
+	before := map[string]interface{}{}
+	after := map[string]interface{}{}
+	for k, v := range new_flat {
+		if old, ok := old_flat[k]; !ok || jsonString(old) != jsonString(v) {
+			keys = append(keys, k)
+			if ok {
+				before[k] = old
+			}
+			after[k] = v
+		}
+	}
+	for k, v := range old_flat {
+		if _, ok := new_flat[k]; !ok {
+			keys = append(keys, k)
+			before[k] = v
+		}
+	}
+	sort.Strings(keys)
+	return keys, before, after
+}
+
+func jsonString(v interface{}) string {
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
+
+// readSettingsFile reads the settings in the config file, it returns an empty
+// map if the file isn't exists or invalid.
+func readSettingsFile(file string) map[string]interface{} {
+	settings, e := readConfigFile(file)
+	if nil != e {
+		return map[string]interface{}{}
+	}
+	return settings
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	query, e := parseAuditQuery(r)
+	if nil != e {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, e.Error())
+		return
+	}
+
+	results, e := backend.auditRecords(query)
+	if nil != e {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,150 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffSettings(t *testing.T) {
+	old_settings := map[string]interface{}{"db_url": "host=127.0.0.1",
+		"mail": map[string]interface{}{"smtp_server": "a.com", "password": "123"},
+		"sms":  map[string]interface{}{"url": "http://a.com"}}
+	new_settings := map[string]interface{}{"db_url": "host=127.0.0.1",
+		"mail":         map[string]interface{}{"smtp_server": "b.com", "password": "456"},
+		"max_attempts": json.Number("5")}
+
+	keys, before, after := diffSettings(old_settings, new_settings)
+	if "mail.password,mail.smtp_server,max_attempts,sms.url" != strings.Join(keys, ",") {
+		t.Error("excepted keys is [mail.password mail.smtp_server max_attempts sms.url], actual is", keys)
+	}
+	if "a.com" != before["mail.smtp_server"] || "http://a.com" != before["sms.url"] {
+		t.Error("before is unexcepted,", before)
+	}
+	if _, ok := before["max_attempts"]; ok {
+		t.Error("max_attempts shouldn't be in before,", before)
+	}
+	if "b.com" != after["mail.smtp_server"] || json.Number("5") != after["max_attempts"] {
+		t.Error("after is unexcepted,", after)
+	}
+	if _, ok := after["sms.url"]; ok {
+		t.Error("sms.url shouldn't be in after,", after)
+	}
+
+	if s := auditValue(after).String; strings.Contains(s, "456") {
+		t.Error("password should be redacted,", s)
+	}
+	if auditValue(nil).Valid {
+		t.Error("nil should be NULL")
+	}
+}
+
+func TestParseAuditQuery(t *testing.T) {
+	query, e := parseAuditQuery(httptest.NewRequest("GET", "/audit?action=retry&actor=mfk&since=2020-01-02T03:04:05Z&limit=5000", nil))
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if "retry" != query.action || "mfk" != query.actor || max_audit_limit != query.limit {
+		t.Error("query is unexcepted,", *query)
+	}
+	if !query.since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) || !query.until.IsZero() {
+		t.Error("since or until is unexcepted,", query.since, query.until)
+	}
+
+	for _, u := range []string{"/audit?since=abc", "/audit?limit=0", "/audit?limit=a"} {
+		if _, e := parseAuditQuery(httptest.NewRequest("GET", u, nil)); nil == e {
+			t.Error(u, "should be failed")
+		}
+	}
+}
+
+func TestAuditByHttp(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		e := backend.enqueue(1, 0, "sms", 0, "aa", time.Time{}, map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		results, e := backend.where(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(results) {
+			t.Error("excepted jobs is 1, actual is", len(results))
+			return
+		}
+		id := results[0]["id"].(int64)
+
+		front := &webFront{dbBackend: backend}
+		for _, u := range []string{"/delayed_jobs/queues/sms/pause", "/delayed_jobs/" + strconv.FormatInt(id, 10) + "/delete"} {
+			r := httptest.NewRecorder()
+			front.ServeHTTP(r, httptest.NewRequest("POST", u, nil))
+			if http.StatusOK != r.Code {
+				t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+				return
+			}
+		}
+
+		r := httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("POST", "/delayed_jobs/bulk/priority", strings.NewReader(`{"filter":{"queue":"sms"},"priority":3}`)))
+		if http.StatusOK != r.Code {
+			t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+			return
+		}
+
+		r = httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("POST", "/delayed_jobs/test", strings.NewReader(`{"type":"test","error":"send to 13800000000 failed"}`)))
+		if http.StatusInternalServerError != r.Code {
+			t.Error("excepted code is 500, actual is", r.Code, r.Body.String())
+			return
+		}
+
+		r = httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("GET", "/audit", nil))
+		if http.StatusOK != r.Code {
+			t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+			return
+		}
+		var records []map[string]interface{}
+		if e = json.Unmarshal(r.Body.Bytes(), &records); nil != e {
+			t.Error(e)
+			return
+		}
+		if 4 != len(records) {
+			t.Error("excepted records is 4, actual is", records)
+			return
+		}
+		actions := map[string]map[string]interface{}{}
+		for _, record := range records {
+			actions[record["action"].(string)] = record
+		}
+		if record, ok := actions["pause_queue"]; !ok || "sms" != record["target"] {
+			t.Error("pause_queue is unexcepted,", records)
+		}
+		if record, ok := actions["delete"]; !ok || strconv.FormatInt(id, 10) != record["target"] || nil == record["before"] {
+			t.Error("delete is unexcepted,", records)
+		}
+		if record, ok := actions["bulk_priority"]; !ok || !strings.Contains(fmt.Sprint(record["after"]), "ids:["+strconv.FormatInt(id, 10)+"]") {
+			t.Error("bulk_priority is unexcepted,", records)
+		}
+		if record, ok := actions["test"]; !ok || !strings.Contains(fmt.Sprint(record["after"]), "error:send to 13800000000 failed") {
+			t.Error("test is unexcepted,", records)
+		}
+
+		records, e = backend.auditRecords(&auditQuery{action: "delete", limit: 10})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(records) {
+			t.Error("excepted records is 1, actual is", records)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package delayed_job
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var (
+	auth_tokens         = flag.String("auth.tokens", "", "the api tokens of the console, in the format 'token:role,...', the role is viewer, operator or admin")
+	auth_users          = flag.String("auth.users", "", "the users of the console, in the format 'name:bcrypt_hash:role,...'")
+	auth_anonymous_role = flag.String("auth.anonymous_role", "", "the role of the request without credential if the authentication is enabled, the request is rejected if it is empty")
+
+	role_levels = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+)
+
+// Authenticator authenticates the request of the console, ok is false if the
+// request has no credential for it, and e is not nil if the credential is
+// invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (user, role string, ok bool, e error)
+}
+
+type authUserKey struct{}
+
+// authUser returns the name of the user who sends the request, it is empty if
+// the authentication is disabled.
+func authUser(r *http.Request) string {
+	user, _ := r.Context().Value(authUserKey{}).(string)
+	return user
+}
+
+func parseRole(role string) (string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if _, ok := role_levels[role]; !ok {
+		return "", errors.New("role '" + role + "' is unsupported.")
+	}
+	return role, nil
+}
+
+// tokenAuthenticator reads the token from 'Authorization: Bearer <token>',
+// 'X-Api-Token' or the 'token' query parameter (EventSource can't send the
+// headers).
+type tokenAuthenticator struct {
+	tokens map[string]string
+}
+
+func newTokenAuthenticator(s string) (*tokenAuthenticator, error) {
+	tokens := map[string]string{}
+	for _, item := range splitNames(s) {
+		idx := strings.LastIndexByte(item, ':')
+		if idx <= 0 {
+			return nil, errors.New("token '" + item[:len(item)/2] + "...' hasn't a role.")
+		}
+		role, e := parseRole(item[idx+1:])
+		if nil != e {
+			return nil, e
+		}
+		tokens[item[:idx]] = role
+	}
+	return &tokenAuthenticator{tokens: tokens}, nil
+}
+
+func (self *tokenAuthenticator) Authenticate(r *http.Request) (string, string, bool, error) {
+	token := r.Header.Get("X-Api-Token")
+	if 0 == len(token) {
+		if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			token = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		}
+	}
+	if 0 == len(token) {
+		token = r.URL.Query().Get("token")
+	}
+	if 0 == len(token) {
+		return "", "", false, nil
+	}
+
+	for t, role := range self.tokens {
+		if 1 == subtle.ConstantTimeCompare([]byte(t), []byte(token)) {
+			sum := sha256.Sum256([]byte(t))
+			return "token:" + hex.EncodeToString(sum[:4]), role, true, nil
+		}
+	}
+	return "", "", true, errors.New("token is invalid.")
+}
+
+type basicUser struct {
+	hash []byte
+	role string
+}
+
+// basicAuthenticator checks the users of HTTP basic authentication with the
+// bcrypt hashes, the passed credentials are cached so that bcrypt isn't run
+// on every request.
+type basicAuthenticator struct {
+	users  map[string]basicUser
+	passed sync.Map
+}
+
+func newBasicAuthenticator(s string) (*basicAuthenticator, error) {
+	users := map[string]basicUser{}
+	for _, item := range splitNames(s) {
+		ss := strings.Split(item, ":")
+		if 3 != len(ss) {
+			return nil, errors.New("user '" + ss[0] + "' isn't in the format 'name:bcrypt_hash:role'.")
+		}
+		if _, e := bcrypt.Cost([]byte(ss[1])); nil != e {
+			return nil, errors.New("hash of user '" + ss[0] + "' is invalid, " + e.Error())
+		}
+		role, e := parseRole(ss[2])
+		if nil != e {
+			return nil, e
+		}
+		users[ss[0]] = basicUser{hash: []byte(ss[1]), role: role}
+	}
+	return &basicAuthenticator{users: users}, nil
+}
+
+func (self *basicAuthenticator) Authenticate(r *http.Request) (string, string, bool, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return "", "", false, nil
+	}
+	user, ok := self.users[name]
+	if !ok {
+		return "", "", true, errors.New("user or password is invalid.")
+	}
+
+	key := sha256.Sum256([]byte(name + "\x00" + password + "\x00" + string(user.hash)))
+	if _, ok := self.passed.Load(key); ok {
+		return name, user.role, true, nil
+	}
+	if e := bcrypt.CompareHashAndPassword(user.hash, []byte(password)); nil != e {
+		return "", "", true, errors.New("user or password is invalid.")
+	}
+	self.passed.Store(key, true)
+	return name, user.role, true, nil
+}
+
+// authenticatorsFromFlags creates the authenticators from 'auth.tokens' and
+// 'auth.users'.
+func authenticatorsFromFlags() ([]Authenticator, error) {
+	var authenticators []Authenticator
+	if 0 != len(strings.TrimSpace(*auth_tokens)) {
+		a, e := newTokenAuthenticator(*auth_tokens)
+		if nil != e {
+			return nil, errors.New("load 'auth.tokens' failed, " + e.Error())
+		}
+		authenticators = append(authenticators, a)
+	}
+	if 0 != len(strings.TrimSpace(*auth_users)) {
+		a, e := newBasicAuthenticator(*auth_users)
+		if nil != e {
+			return nil, errors.New("load 'auth.users' failed, " + e.Error())
+		}
+		authenticators = append(authenticators, a)
+	}
+	return authenticators, nil
+}
+
+// requiredRole returns the role of the request, the settings and pprof are
+// for the admin, the changes of jobs and queues are for the operator, and
+// the others are read only.
+func requiredRole(r *http.Request) string {
+	pa := "/" + strings.TrimPrefix(r.URL.Path, "/")
+	for _, prefix := range []string{"/delayed_jobs/delayed_jobs", "/delayed_jobs", "/delayed_job"} {
+		if strings.HasPrefix(pa, prefix+"/") {
+			pa = strings.TrimPrefix(pa, prefix)
+			break
+		}
+	}
+
+	if strings.HasPrefix(pa, "/settings_") || strings.HasPrefix(pa, "/debug/") {
+		return RoleAdmin
+	}
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return RoleViewer
+	}
+	return RoleOperator
+}
+
+// authHandler authenticates the requests before they are passed to the
+// console, it is disabled if there is no authenticator.
+type authHandler struct {
+	authenticators []Authenticator
+	anonymous_role string
+	next           http.Handler
+}
+
+func newAuthHandler(next http.Handler, authenticators []Authenticator, anonymous_role string) (http.Handler, error) {
+	if 0 == len(authenticators) {
+		return next, nil
+	}
+	if 0 != len(anonymous_role) {
+		role, e := parseRole(anonymous_role)
+		if nil != e {
+			return nil, errors.New("load 'auth.anonymous_role' failed, " + e.Error())
+		}
+		anonymous_role = role
+	}
+	return &authHandler{authenticators: authenticators, anonymous_role: anonymous_role, next: next}, nil
+}
+
+func (self *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, role := "", self.anonymous_role
+	for _, a := range self.authenticators {
+		name, r_role, ok, e := a.Authenticate(r)
+		if nil != e {
+			self.unauthorized(w, e.Error())
+			return
+		}
+		if ok {
+			user, role = name, r_role
+			break
+		}
+	}
+
+	if 0 == len(role) {
+		self.unauthorized(w, "authentication is required.")
+		return
+	}
+	if role_levels[role] < role_levels[requiredRole(r)] {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("role '" + role + "' is not allowed, '" + requiredRole(r) + "' is required."))
+		return
+	}
+
+	if 0 != len(user) {
+		r = r.WithContext(context.WithValue(r.Context(), authUserKey{}, user))
+	}
+	self.next.ServeHTTP(w, r)
+}
+
+func (self *authHandler) unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="delayed_job"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(msg))
+}
@@ -0,0 +1,152 @@
+package delayed_job
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRequiredRole(t *testing.T) {
+	for idx, test := range []struct {
+		method string
+		url    string
+		role   string
+	}{{method: "GET", url: "/", role: RoleViewer},
+		{method: "GET", url: "/delayed_jobs/queues", role: RoleViewer},
+		{method: "GET", url: "/delayed_jobs/delayed_jobs/failed", role: RoleViewer},
+		{method: "PUT", url: "/push", role: RoleOperator},
+		{method: "POST", url: "/delayed_jobs/test", role: RoleOperator},
+		{method: "DELETE", url: "/delayed_jobs/12", role: RoleOperator},
+		{method: "GET", url: "/settings_file", role: RoleAdmin},
+		{method: "POST", url: "/delayed_jobs/settings_file", role: RoleAdmin},
+		{method: "POST", url: "/delayed_job/settings_validate", role: RoleAdmin},
+		{method: "GET", url: "/settings_schema", role: RoleAdmin},
+		{method: "GET", url: "/debug/pprof/", role: RoleAdmin},
+		{method: "GET", url: "/delayed_job/debug/vars", role: RoleAdmin}} {
+		r := httptest.NewRequest(test.method, test.url, nil)
+		if role := requiredRole(r); test.role != role {
+			t.Error("[", idx, "] excepted role is", test.role, ", actual is", role)
+		}
+	}
+}
+
+func TestAuthenticators(t *testing.T) {
+	hash, e := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	if _, e := newTokenAuthenticator("abc"); nil == e {
+		t.Error("token without role should be failed")
+	}
+	if _, e := newTokenAuthenticator("abc:root"); nil == e {
+		t.Error("token with unknown role should be failed")
+	}
+	if _, e := newBasicAuthenticator("mfk:abc:admin"); nil == e {
+		t.Error("user with invalid hash should be failed")
+	}
+
+	tokens, e := newTokenAuthenticator("[abc:viewer def:operator]")
+	if nil != e {
+		t.Fatal(e)
+	}
+	users, e := newBasicAuthenticator("mfk:" + string(hash) + ":admin")
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	for idx, test := range []struct {
+		a    Authenticator
+		init func(r *http.Request)
+		role string
+		ok   bool
+		err  bool
+	}{{a: tokens, init: func(r *http.Request) {}},
+		{a: tokens, init: func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") }, role: RoleViewer, ok: true},
+		{a: tokens, init: func(r *http.Request) { r.Header.Set("X-Api-Token", "def") }, role: RoleOperator, ok: true},
+		{a: tokens, init: func(r *http.Request) { r.URL.RawQuery = "token=def" }, role: RoleOperator, ok: true},
+		{a: tokens, init: func(r *http.Request) { r.Header.Set("X-Api-Token", "xyz") }, ok: true, err: true},
+		{a: users, init: func(r *http.Request) {}},
+		{a: users, init: func(r *http.Request) { r.SetBasicAuth("mfk", "123") }, role: RoleAdmin, ok: true},
+		{a: users, init: func(r *http.Request) { r.SetBasicAuth("mfk", "123") }, role: RoleAdmin, ok: true},
+		{a: users, init: func(r *http.Request) { r.SetBasicAuth("mfk", "456") }, ok: true, err: true},
+		{a: users, init: func(r *http.Request) { r.SetBasicAuth("abc", "123") }, ok: true, err: true}} {
+		r := httptest.NewRequest("GET", "/", nil)
+		test.init(r)
+		_, role, ok, e := test.a.Authenticate(r)
+		if test.err != (nil != e) {
+			t.Error("[", idx, "] excepted error is", test.err, ", actual is", e)
+		}
+		if test.ok != ok {
+			t.Error("[", idx, "] excepted ok is", test.ok, ", actual is", ok)
+		}
+		if test.role != role {
+			t.Error("[", idx, "] excepted role is", test.role, ", actual is", role)
+		}
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	tokens, e := newTokenAuthenticator("abc:viewer,def:operator,ghi:admin")
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	var user string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = authUser(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if h, e := newAuthHandler(next, nil, ""); nil != e {
+		t.Error(e)
+	} else if _, ok := h.(*authHandler); ok {
+		t.Error("auth should be disabled without authenticators")
+	}
+	if _, e := newAuthHandler(next, []Authenticator{tokens}, "root"); nil == e {
+		t.Error("unknown anonymous role should be failed")
+	}
+
+	for idx, test := range []struct {
+		anonymous string
+		method    string
+		url       string
+		token     string
+		status    int
+	}{{method: "GET", url: "/queues", status: http.StatusUnauthorized},
+		{anonymous: RoleViewer, method: "GET", url: "/queues", status: http.StatusOK},
+		{anonymous: RoleViewer, method: "PUT", url: "/push", status: http.StatusForbidden},
+		{method: "GET", url: "/queues", token: "xyz", status: http.StatusUnauthorized},
+		{method: "GET", url: "/queues", token: "abc", status: http.StatusOK},
+		{method: "PUT", url: "/push", token: "abc", status: http.StatusForbidden},
+		{method: "PUT", url: "/push", token: "def", status: http.StatusOK},
+		{method: "GET", url: "/settings_file", token: "def", status: http.StatusForbidden},
+		{method: "GET", url: "/debug/pprof/", token: "def", status: http.StatusForbidden},
+		{method: "POST", url: "/settings_file", token: "ghi", status: http.StatusOK}} {
+		h, e := newAuthHandler(next, []Authenticator{tokens}, test.anonymous)
+		if nil != e {
+			t.Error("[", idx, "]", e)
+			continue
+		}
+
+		user = ""
+		r := httptest.NewRequest(test.method, test.url, nil)
+		if 0 != len(test.token) {
+			r.Header.Set("X-Api-Token", test.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if test.status != w.Code {
+			t.Error("[", idx, "] excepted status is", test.status, ", actual is", w.Code, w.Body.String())
+		}
+		if http.StatusUnauthorized == w.Code && 0 == len(w.Header().Get("WWW-Authenticate")) {
+			t.Error("[", idx, "] WWW-Authenticate is missing")
+		}
+		if http.StatusOK == w.Code && 0 != len(test.token) && 0 == len(user) {
+			t.Error("[", idx, "] user isn't passed to the handler")
+		}
+	}
+}
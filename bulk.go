@@ -0,0 +1,339 @@
+package delayed_job
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the max count of the job ids which are recorded in the audit record of a
+// bulk action, the ids aren't recorded if more jobs are changed.
+const max_bulk_audit_ids = 1000
+
+var (
+	bulk_confirm_timeout   = flag.Duration("bulk_confirm_timeout", 5*time.Minute, "the lifetime of the confirmation token of the destructive bulk actions")
+	bulk_confirm_threshold = flag.Int("bulk_confirm_threshold", 100, "the bulk actions which match more jobs than it require the confirmation token")
+
+	bulk_secret = flag.String("bulk_secret", "", "the secret which signs the confirmation token of the bulk actions, set the same secret on every console behind a load balancer, it is random if empty")
+
+	bulk_random_secret = func() []byte {
+		bs := make([]byte, 32)
+		if _, e := rand.Read(bs); nil != e {
+			panic(e.Error())
+		}
+		return bs
+	}()
+
+	// the values of the bulk actions, they are signed with the filter.
+	bulk_value_fields = []string{"queue", "priority", "run_at"}
+
+	// the columns which can be used in the filter of bulk actions.
+	bulk_filter_fields = map[string]bool{"id": true,
+		"priority":   true,
+		"attempts":   true,
+		"queue":      true,
+		"handler_id": true,
+		"locked_by":  true,
+		"run_at":     true,
+		"failed_at":  true,
+		"locked_at":  true,
+		"expires_at": true}
+)
+
+// isDestructiveBulkAction returns true if the action always requires a
+// confirmation token which is returned by the dry run, retry and reschedule
+// run the matched jobs again (such as resend all failed alarms).
+func isDestructiveBulkAction(action string) bool {
+	switch action {
+	case "delete", "retry", "reschedule":
+		return true
+	}
+	return false
+}
+
+// isEmptyBulkFilter returns true if the filter has no column, it matches all
+// jobs of the scope.
+func isEmptyBulkFilter(filter map[string]interface{}) bool {
+	for k := range filter {
+		if "scope" != k {
+			return false
+		}
+	}
+	return true
+}
+
+// bulkConfirmRequired returns true if the action requires a confirmation
+// token, count is the count of the matched jobs, it is used only if the action
+// isn't destructive and the filter isn't empty.
+func bulkConfirmRequired(action string, filter map[string]interface{}, count int64) bool {
+	return isDestructiveBulkAction(action) || isEmptyBulkFilter(filter) || count > int64(*bulk_confirm_threshold)
+}
+
+// bulkWhere builds the condition of the filter, the filter takes the scope of
+// the listing api ("all", "failed", "queued" or "active") and the columns of
+// the jobs, a column value may be nil, "[notnull]" or a list of values.
+func bulkWhere(args *sqlArguments, filter map[string]interface{}) (string, error) {
+	var conditions []string
+	switch scope := stringWithDefault(filter, "scope", "all"); scope {
+	case "", "all":
+	case "failed":
+		conditions = append(conditions, "failed_at IS NOT NULL")
+	case "queued":
+		conditions = append(conditions, "failed_at IS NULL AND locked_by IS NULL")
+	case "active":
+		conditions = append(conditions, "failed_at IS NULL AND locked_by IS NOT NULL")
+	default:
+		return "", errors.New("scope '" + scope + "' is unsupported.")
+	}
+
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		if "scope" != k {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := filter[k]
+		column := strings.TrimPrefix(k, "@")
+		if !bulk_filter_fields[column] {
+			return "", errors.New("filter '" + k + "' is unsupported.")
+		}
+
+		switch value := v.(type) {
+		case nil:
+			conditions = append(conditions, column+" IS NULL")
+		case []interface{}:
+			if 0 == len(value) {
+				return "", errors.New("filter '" + k + "' is empty.")
+			}
+			placeholders := make([]string, 0, len(value))
+			for _, item := range value {
+				placeholders = append(placeholders, args.add(bulkValue(item)))
+			}
+			conditions = append(conditions, column+" IN ("+strings.Join(placeholders, ", ")+")")
+		default:
+			if "[notnull]" == v {
+				conditions = append(conditions, column+" IS NOT NULL")
+			} else {
+				conditions = append(conditions, column+" = "+args.add(bulkValue(v)))
+			}
+		}
+	}
+
+	if 0 == len(conditions) {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), nil
+}
+
+func bulkValue(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if i, e := n.Int64(); nil == e {
+			return i
+		}
+		if f, e := n.Float64(); nil == e {
+			return f
+		}
+		return n.String()
+	}
+	return v
+}
+
+// bulk applies the action to the jobs matching the filter, it returns the
+// count of the matched jobs only if dry_run is true. The actions are "retry",
+// "delete", "move" (values["queue"]), "priority" (values["priority"]) and
+// "reschedule" (values["run_at"]). The ids of the changed jobs are returned
+// for the audit record, they are nil if more than max_bulk_audit_ids jobs
+// are changed.
+func (self *dbBackend) bulk(action string, filter, values map[string]interface{}, dry_run bool) (int64, []int64, error) {
+	now := self.db_time_now()
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+
+	var query string
+	switch action {
+	case "retry":
+		query = "UPDATE " + self.table + " SET failed_at = NULL, progress = NULL, progress_message = NULL, updated_at = " + self.nowSQL(args, now)
+		if _, ok := filter["scope"]; !ok {
+			copied := map[string]interface{}{"scope": "failed"}
+			for k, v := range filter {
+				copied[k] = v
+			}
+			filter = copied
+		}
+	case "delete":
+		query = "DELETE FROM " + self.table
+	case "move":
+		queue := stringWithDefault(values, "queue", "")
+		if 0 == len(queue) {
+			return 0, nil, errors.New("'queue' is required.")
+		}
+		query = "UPDATE " + self.table + " SET queue = " + args.add(queue) + ", updated_at = " + self.nowSQL(args, now)
+	case "priority":
+		if _, ok := values["priority"]; !ok {
+			return 0, nil, errors.New("'priority' is required.")
+		}
+		priority := intWithDefault(values, "priority", *default_priority)
+		query = "UPDATE " + self.table + " SET priority = " + args.add(priority) + ", updated_at = " + self.nowSQL(args, now)
+	case "reschedule":
+		run_at := timeWithDefault(values, "run_at", time.Time{})
+		if run_at.IsZero() {
+			return 0, nil, errors.New("'run_at' is required.")
+		}
+		query = "UPDATE " + self.table + " SET run_at = " + args.add(self.dbTime(run_at)) + ", updated_at = " + self.nowSQL(args, now)
+	default:
+		return 0, nil, errors.New("bulk action '" + action + "' is unsupported.")
+	}
+
+	if dry_run {
+		args = &sqlArguments{isNumeric: self.isNumericParams}
+		where, e := bulkWhere(args, filter)
+		if nil != e {
+			return 0, nil, e
+		}
+
+		count := int64(0)
+		e = self.db.QueryRow("SELECT count(*) FROM "+self.table+where, args.values...).Scan(&count)
+		if nil != e && sql.ErrNoRows != e {
+			return 0, nil, i18n(self.dbType, self.drv, e)
+		}
+		return count, nil, nil
+	}
+
+	where, e := bulkWhere(args, filter)
+	if nil != e {
+		return 0, nil, e
+	}
+
+	var count int64
+	var ids []int64
+	e = self.transaction(func(tx *sql.Tx) error {
+		var e error
+		ids, e = self.bulkIDs(tx, filter)
+		if nil != e {
+			return e
+		}
+
+		result, e := tx.Exec(query+where, args.values...)
+		if nil != e {
+			return errors.New(action + " jobs failed, " + i18nString(self.dbType, self.drv, e))
+		}
+		count, e = result.RowsAffected()
+		return e
+	})
+	if nil != e {
+		return 0, nil, e
+	}
+	if len(ids) > max_bulk_audit_ids {
+		ids = nil
+	}
+	return count, ids, nil
+}
+
+// bulkIDs returns the ids of the jobs matching the filter, it returns at
+// most max_bulk_audit_ids + 1 ids.
+func (self *dbBackend) bulkIDs(tx *sql.Tx, filter map[string]interface{}) ([]int64, error) {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	where, e := bulkWhere(args, filter)
+	if nil != e {
+		return nil, e
+	}
+
+	rows, e := tx.Query(limitSQL(self.dbType, "SELECT id FROM "+self.table+where+" ORDER BY id", max_bulk_audit_ids+1), args.values...)
+	if nil != e {
+		return nil, errors.New("query ids of jobs failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if e = rows.Scan(&id); nil != e {
+			return nil, errors.New("scan ids of jobs failed, " + i18nString(self.dbType, self.drv, e))
+		}
+		ids = append(ids, id)
+	}
+	if e = rows.Err(); nil != e {
+		return nil, errors.New("next ids of jobs failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return ids, nil
+}
+
+// bulkValues returns the values of the action in the body of the request.
+func bulkValues(ent map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, k := range bulk_value_fields {
+		if v, ok := ent[k]; ok {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// bulkSecret returns the secret of the confirmation token, it is
+// Options.BulkSecret or the flag 'bulk_secret', the random secret of the
+// process is used only if both are empty.
+func (self *dbBackend) bulkSecret() []byte {
+	if 0 != len(self.bulk_secret) {
+		return []byte(self.bulk_secret)
+	}
+	if 0 != len(*bulk_secret) {
+		return []byte(*bulk_secret)
+	}
+	return bulk_random_secret
+}
+
+// bulkConfirmToken returns a token which confirms the destructive action for
+// the filter and the values, it is valid in bulk_confirm_timeout.
+func (self *dbBackend) bulkConfirmToken(action string, filter, values map[string]interface{}, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return ts + "." + self.bulkSignature(ts, action, filter, values)
+}
+
+func (self *dbBackend) bulkSignature(ts, action string, filter, values map[string]interface{}) string {
+	// encoding/json sorts the keys of map, so the filter and the values are
+	// canonical.
+	filter_bytes, _ := json.Marshal(filter)
+	values_bytes, _ := json.Marshal(bulkValues(values))
+	mac := hmac.New(sha256.New, self.bulkSecret())
+	mac.Write([]byte(ts))
+	mac.Write([]byte{0})
+	mac.Write([]byte(action))
+	mac.Write([]byte{0})
+	mac.Write(filter_bytes)
+	mac.Write([]byte{0})
+	mac.Write(values_bytes)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (self *dbBackend) verifyBulkConfirmToken(token, action string, filter, values map[string]interface{}, now time.Time) error {
+	if 0 == len(token) {
+		return errors.New("'confirm_token' is required, please run it with 'dry_run' first.")
+	}
+
+	idx := strings.IndexByte(token, '.')
+	if idx <= 0 {
+		return errors.New("'confirm_token' is invalid.")
+	}
+	ts, e := strconv.ParseInt(token[:idx], 10, 64)
+	if nil != e {
+		return errors.New("'confirm_token' is invalid.")
+	}
+	if !hmac.Equal([]byte(token[idx+1:]), []byte(self.bulkSignature(token[:idx], action, filter, values))) {
+		return errors.New("'confirm_token' is not match the action, the filter and the values.")
+	}
+	if now.Sub(time.Unix(ts, 0)) > *bulk_confirm_timeout {
+		return errors.New("'confirm_token' is expired.")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBulkWhere(t *testing.T) {
+	for idx, test := range []struct {
+		filter   map[string]interface{}
+		excepted string
+		values   []interface{}
+		is_error bool
+	}{
+		{filter: nil, excepted: ""},
+		{filter: map[string]interface{}{"scope": "failed"}, excepted: " WHERE failed_at IS NOT NULL"},
+		{filter: map[string]interface{}{"scope": "queued", "queue": "sms"}, excepted: " WHERE failed_at IS NULL AND locked_by IS NULL AND queue = $1", values: []interface{}{"sms"}},
+		{filter: map[string]interface{}{"@queue": "sms", "priority": json.Number("3")}, excepted: " WHERE queue = $1 AND priority = $2", values: []interface{}{"sms", int64(3)}},
+		{filter: map[string]interface{}{"id": []interface{}{json.Number("1"), json.Number("2")}, "locked_by": nil}, excepted: " WHERE id IN ($1, $2) AND locked_by IS NULL", values: []interface{}{int64(1), int64(2)}},
+		{filter: map[string]interface{}{"failed_at": "[notnull]"}, excepted: " WHERE failed_at IS NOT NULL"},
+		{filter: map[string]interface{}{"scope": "abc"}, is_error: true},
+		{filter: map[string]interface{}{"1=1; DROP TABLE a; --": 1}, is_error: true},
+	} {
+		args := &sqlArguments{isNumeric: true}
+		where, e := bulkWhere(args, test.filter)
+		if test.is_error {
+			if nil == e {
+				t.Errorf("[%d] excepted error, actual is '%s'", idx, where)
+			}
+			continue
+		}
+		if nil != e {
+			t.Errorf("[%d] %v", idx, e)
+			continue
+		}
+		if test.excepted != where {
+			t.Errorf("[%d] excepted is '%s', actual is '%s'", idx, test.excepted, where)
+		}
+		if 0 != len(test.values) || 0 != len(args.values) {
+			if !reflect.DeepEqual(test.values, args.values) {
+				t.Errorf("[%d] excepted values is %v, actual is %v", idx, test.values, args.values)
+			}
+		}
+	}
+}
+
+func TestBulkConfirmToken(t *testing.T) {
+	backend := &dbBackend{}
+	now := time.Now()
+	filter := map[string]interface{}{"scope": "failed", "queue": "sms"}
+	values := map[string]interface{}{"queue": "mail", "confirm_token": "", "dry_run": true}
+	token := backend.bulkConfirmToken("move", filter, values, now)
+
+	if e := backend.verifyBulkConfirmToken(token, "move", map[string]interface{}{"queue": "sms", "scope": "failed"}, map[string]interface{}{"queue": "mail", "confirm_token": token}, now); nil != e {
+		t.Error(e)
+	}
+	if e := backend.verifyBulkConfirmToken("", "move", filter, values, now); nil == e {
+		t.Error("excepted error for the empty token")
+	}
+	if e := backend.verifyBulkConfirmToken(token, "move", map[string]interface{}{"scope": "all"}, values, now); nil == e {
+		t.Error("excepted error for the other filter")
+	}
+	if e := backend.verifyBulkConfirmToken(token, "delete", filter, values, now); nil == e {
+		t.Error("excepted error for the other action")
+	}
+	if e := backend.verifyBulkConfirmToken(token, "move", filter, map[string]interface{}{"queue": "other"}, now); nil == e {
+		t.Error("excepted error for the other values")
+	}
+	if e := backend.verifyBulkConfirmToken(token, "move", filter, values, now.Add(*bulk_confirm_timeout+time.Minute)); nil == e {
+		t.Error("excepted error for the expired token")
+	}
+
+	// the consoles with the same secret accept the tokens of each other.
+	old := *bulk_secret
+	defer flag.Set("bulk_secret", old)
+	flag.Set("bulk_secret", "abc")
+	token = backend.bulkConfirmToken("move", filter, values, now)
+	if e := (&dbBackend{}).verifyBulkConfirmToken(token, "move", filter, values, now); nil != e {
+		t.Error(e)
+	}
+	if e := (&dbBackend{bulk_secret: "other"}).verifyBulkConfirmToken(token, "move", filter, values, now); nil == e {
+		t.Error("excepted error for the other secret")
+	}
+}
+
+func TestBulkConfirmRequired(t *testing.T) {
+	filter := map[string]interface{}{"queue": "sms"}
+	for idx, test := range []struct {
+		action   string
+		filter   map[string]interface{}
+		count    int64
+		required bool
+	}{{action: "delete", filter: filter, count: 1, required: true},
+		{action: "retry", filter: filter, count: 1, required: true},
+		{action: "reschedule", filter: filter, count: 1, required: true},
+		{action: "move", filter: filter, count: 1, required: false},
+		{action: "move", filter: filter, count: int64(*bulk_confirm_threshold) + 1, required: true},
+		{action: "priority", filter: nil, count: 1, required: true},
+		{action: "priority", filter: map[string]interface{}{"scope": "queued"}, count: 1, required: true}} {
+		if required := bulkConfirmRequired(test.action, test.filter, test.count); test.required != required {
+			t.Errorf("[%d] excepted required of %v is %v, actual is %v", idx, test.action, test.required, required)
+		}
+	}
+}
+
+func TestBulkActions(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		for _, queue := range []string{"sms", "sms", "mail"} {
+			e := backend.enqueue(1, 0, "", 0, queue, time.Time{}, map[string]interface{}{"type": "test"})
+			if nil != e {
+				t.Error(e)
+				return
+			}
+		}
+
+		count, _, e := backend.bulk("move", map[string]interface{}{"queue": "sms"}, map[string]interface{}{"queue": "sms2"}, true)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != count {
+			t.Error("excepted dry run count is 2, actual is", count)
+		}
+
+		count, ids, e := backend.bulk("move", map[string]interface{}{"queue": "sms"}, map[string]interface{}{"queue": "sms2"}, false)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != count {
+			t.Error("excepted moved count is 2, actual is", count)
+		}
+		if 2 != len(ids) || ids[0] >= ids[1] {
+			t.Error("excepted ids of the moved jobs, actual is", ids)
+		}
+
+		count, _, e = backend.bulk("delete", map[string]interface{}{"queue": "sms2"}, nil, true)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != count {
+			t.Error("excepted count of sms2 is 2, actual is", count)
+		}
+
+		count, ids, e = backend.bulk("delete", map[string]interface{}{"queue": "mail"}, nil, false)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != count {
+			t.Error("excepted deleted count is 1, actual is", count)
+		}
+		if 1 != len(ids) {
+			t.Error("excepted id of the deleted job, actual is", ids)
+		}
+
+		count, _, e = backend.bulk("delete", nil, nil, true)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != count {
+			t.Error("excepted count is 2, actual is", count)
+		}
+	})
+}
@@ -0,0 +1,803 @@
+package delayed_job
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cliCommand is a subcommand of the command line, the subcommands operate the
+// database directly, so they work without the console.
+type cliCommand struct {
+	name  string
+	usage string
+	run   func(c *cliContext, args []string) error
+}
+
+var cli_commands []cliCommand
+
+func init() {
+	cli_commands = []cliCommand{
+		{name: "enqueue", usage: "enqueue the jobs from -file or from -type, -payload and -arg", run: cmdEnqueue},
+		{name: "list", usage: "list the jobs, filtered by -scope, -queue and -handler_id", run: cmdList},
+		{name: "show", usage: "show the job, usage: show <id>", run: cmdShow},
+		{name: "retry", usage: "re-run the failed jobs, usage: retry <id>...", run: cmdRetry},
+		{name: "delete", usage: "delete the jobs, usage: delete <id>...", run: cmdDelete},
+		{name: "stats", usage: "show the counts of the jobs and the state of the queues", run: cmdStats},
+		{name: "workers", usage: "show the workers which lock the jobs", run: cmdWorkers},
+		{name: "export", usage: "export the jobs to -file in the format of /pushAll", run: cmdExport},
+		{name: "import", usage: "import the jobs from -file which is exported by 'export'", run: cmdImport},
+		{name: "render", usage: "build the jobs like 'enqueue' and print the rendered output of the handlers without sending them", run: cmdRender}}
+}
+
+// IsCommand returns true if the name is a subcommand of the command line.
+func IsCommand(name string) bool {
+	for _, cmd := range cli_commands {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return "help" == name
+}
+
+// RunCommand runs the subcommand, args[0] is the name of the subcommand and
+// the others are its arguments.
+func RunCommand(args []string, out io.Writer) error {
+	if 0 == len(args) || "help" == args[0] {
+		commandUsage(out)
+		return nil
+	}
+
+	var cmd *cliCommand
+	for i := range cli_commands {
+		if cli_commands[i].name == args[0] {
+			cmd = &cli_commands[i]
+			break
+		}
+	}
+	if nil == cmd {
+		commandUsage(out)
+		return errors.New("command '" + args[0] + "' is unsupported.")
+	}
+
+	if e := loadSettings(); nil != e {
+		return e
+	}
+
+	c := &cliContext{out: out, format: "table"}
+	defer c.Close()
+	return cmd.run(c, args[1:])
+}
+
+func commandUsage(out io.Writer) {
+	io.WriteString(out, "Usage: delayed_job [flags] <command> [arguments]\n\nThe commands are:\n")
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, cmd := range cli_commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	w.Flush()
+	io.WriteString(out, "\nUse \"delayed_job <command> -h\" for the arguments of the command.\n")
+}
+
+type cliContext struct {
+	out     io.Writer
+	format  string
+	backend *dbBackend
+}
+
+func (self *cliContext) Close() error {
+	if nil != self.backend {
+		return self.backend.Close()
+	}
+	return nil
+}
+
+// flagSet creates the flags of the command, '-output' is added to all.
+func (self *cliContext) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(self.out)
+	fs.StringVar(&self.format, "output", "table", "the format of the output, table or json")
+	return fs
+}
+
+func (self *cliContext) parse(fs *flag.FlagSet, args []string) error {
+	if e := fs.Parse(args); nil != e {
+		return e
+	}
+	switch self.format {
+	case "table", "json":
+		return nil
+	}
+	return errors.New("output '" + self.format + "' is unsupported, it must be table or json.")
+}
+
+func (self *cliContext) openBackend() (*dbBackend, error) {
+	if nil == self.backend {
+		backend, e := newBackend(*db_drv, *db_url, map[string]interface{}{})
+		if nil != e {
+			return nil, e
+		}
+		self.backend = backend
+	}
+	return self.backend, nil
+}
+
+func (self *cliContext) writeJSON(v interface{}) error {
+	encoder := json.NewEncoder(self.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (self *cliContext) writeTable(headers []string, rows [][]string) error {
+	w := tabwriter.NewWriter(self.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// writeRecords writes the records in the format of the output, the columns
+// are used by the table only.
+func (self *cliContext) writeRecords(columns []string, records []map[string]interface{}) error {
+	if nil == records {
+		records = []map[string]interface{}{}
+	}
+	if "json" == self.format {
+		return self.writeJSON(records)
+	}
+
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = cliCell(record[column])
+		}
+		rows = append(rows, row)
+	}
+	return self.writeTable(columns, rows)
+}
+
+func (self *cliContext) printf(format string, args ...interface{}) {
+	if "json" != self.format {
+		fmt.Fprintf(self.out, format, args...)
+	}
+}
+
+// cliActor is the actor of the audit records from the command line.
+func cliActor() string {
+	if u, e := user.Current(); nil == e {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func cliCell(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05")
+	case sql.NullString:
+		return value.String
+	case string:
+		if len(value) > 60 {
+			return value[:57] + "..."
+		}
+		return strings.Replace(value, "\n", " ", -1)
+	}
+	return fmt.Sprint(v)
+}
+
+// cliJob converts the job of where() for the output, the handler is decoded.
+func cliJob(job map[string]interface{}) map[string]interface{} {
+	for k, v := range job {
+		if s, ok := v.(sql.NullString); ok {
+			if s.Valid {
+				job[k] = s.String
+			} else {
+				job[k] = nil
+			}
+		}
+	}
+	if s, ok := job["handler"].(string); ok {
+		var handler map[string]interface{}
+		if nil == json.Unmarshal([]byte(s), &handler) {
+			job["handler"] = handler
+		}
+	}
+	return job
+}
+
+func parseIds(args []string) ([]int64, error) {
+	if 0 == len(args) {
+		return nil, errors.New("job id is missing.")
+	}
+	ids := make([]int64, 0, len(args))
+	for _, s := range args {
+		id, e := strconv.ParseInt(s, 10, 64)
+		if nil != e {
+			return nil, errors.New("job id '" + s + "' isn't a number.")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// stringMap is the flag which is set repeatedly as 'key=value'.
+type stringMap map[string]interface{}
+
+func (self stringMap) String() string {
+	return fmt.Sprint(map[string]interface{}(self))
+}
+
+func (self stringMap) Set(s string) error {
+	idx := strings.IndexByte(s, '=')
+	if idx <= 0 {
+		return errors.New("'" + s + "' isn't key=value.")
+	}
+	self[s[:idx]] = s[idx+1:]
+	return nil
+}
+
+// jobFlags are the flags of building the jobs, they are shared by 'enqueue'
+// and 'render'.
+type jobFlags struct {
+	file         *string
+	typ          *string
+	payload      *string
+	args         stringMap
+	queue        *string
+	priority     *int
+	max_attempts *int
+	handler_id   *string
+	run_at       *string
+	ttl          *time.Duration
+}
+
+func addJobFlags(fs *flag.FlagSet) *jobFlags {
+	jf := &jobFlags{file: fs.String("file", "", "the JSON file of the job or the list of jobs, '-' is the stdin"),
+		typ:          fs.String("type", "", "the type of the handler, such as web, mail or exec"),
+		payload:      fs.String("payload", "", "the payload of the handler in JSON"),
+		args:         stringMap{},
+		queue:        fs.String("queue", "", "the queue of the job"),
+		priority:     fs.Int("priority", 0, "the priority of the job"),
+		max_attempts: fs.Int("max_attempts", 0, "the max attempts of the job"),
+		handler_id:   fs.String("handler_id", "", "the handler_id of the job, the job with the same handler_id is replaced"),
+		run_at:       fs.String("run_at", "", "the time (RFC3339) to run the job"),
+		ttl:          fs.Duration("ttl", 0, "the job is expired if it isn't run in the duration")}
+	fs.Var(jf.args, "arg", "the argument of the payload as key=value, it may be repeated")
+	return jf
+}
+
+// entities returns the jobs of the file or the flags, the flags which are
+// set override the attributes in the file.
+func (self *jobFlags) entities(fs *flag.FlagSet) ([]map[string]interface{}, error) {
+	var entities []map[string]interface{}
+	if 0 != len(*self.file) {
+		var e error
+		entities, e = readJobsFile(*self.file)
+		if nil != e {
+			return nil, e
+		}
+	} else {
+		if 0 == len(*self.typ) {
+			return nil, errors.New("-file or -type is required.")
+		}
+		handler := map[string]interface{}{}
+		if 0 != len(*self.payload) {
+			decoder := json.NewDecoder(strings.NewReader(*self.payload))
+			decoder.UseNumber()
+			if e := decoder.Decode(&handler); nil != e {
+				return nil, errors.New("-payload isn't a JSON object, " + e.Error())
+			}
+		}
+		for k, v := range self.args {
+			handler[k] = v
+		}
+		handler["type"] = *self.typ
+		entities = []map[string]interface{}{{"handler": handler}}
+	}
+
+	if 0 != len(*self.run_at) {
+		if _, e := time.Parse(time.RFC3339, *self.run_at); nil != e {
+			return nil, errors.New("-run_at isn't a RFC3339 time, " + e.Error())
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		for _, ent := range entities {
+			switch f.Name {
+			case "queue":
+				ent["queue"] = *self.queue
+			case "priority":
+				ent["priority"] = *self.priority
+			case "max_attempts":
+				ent["max_attempts"] = *self.max_attempts
+			case "run_at":
+				ent["run_at"] = *self.run_at
+			case "ttl":
+				ent["ttl"] = self.ttl.String()
+			case "handler_id":
+				if handler, ok := ent["handler"].(map[string]interface{}); ok {
+					delete(handler, "_uid")
+					handler["handler_id"] = *self.handler_id
+				}
+			}
+		}
+	})
+	return entities, nil
+}
+
+// readJobsFile reads a job or a list of jobs in the format of /push.
+func readJobsFile(file string) ([]map[string]interface{}, error) {
+	var bs []byte
+	var e error
+	if "-" == file {
+		bs, e = io.ReadAll(os.Stdin)
+	} else {
+		bs, e = os.ReadFile(file)
+	}
+	if nil != e {
+		return nil, errors.New("read '" + file + "' failed, " + e.Error())
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(bs)))
+	decoder.UseNumber()
+	if e = decoder.Decode(&v); nil != e {
+		return nil, errors.New("read '" + file + "' failed, " + e.Error())
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, nil
+	case []interface{}:
+		entities := make([]map[string]interface{}, 0, len(value))
+		for i, item := range value {
+			ent, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("read '" + file + "' failed, data[" + strconv.Itoa(i) + "] isn't a JSON object.")
+			}
+			entities = append(entities, ent)
+		}
+		return entities, nil
+	}
+	return nil, errors.New("read '" + file + "' failed, it isn't a JSON object or array.")
+}
+
+func createJobs(backend *dbBackend, entities []map[string]interface{}) ([]*Job, error) {
+	jobs := make([]*Job, len(entities))
+	for i, ent := range entities {
+		job, e := createJobFromMap(backend, ent)
+		if nil != e {
+			return nil, errors.New("parse data[" + strconv.Itoa(i) + "] failed, " + e.Error())
+		}
+		jobs[i] = job
+	}
+	return jobs, nil
+}
+
+// restoreJob restores the state of the job which is exported by 'export', the
+// state isn't accepted from the other entities.
+func restoreJob(job *Job, ent map[string]interface{}) {
+	if handler_id := stringWithDefault(ent, "handler_id", ""); 0 != len(handler_id) {
+		job.handler_id = handler_id
+	}
+	job.attempts = intWithDefault(ent, "attempts", 0)
+	job.last_error = stringWithDefault(ent, "last_error", "")
+	job.failed_at = job.backend.dbTime(timeWithDefault(ent, "failed_at", time.Time{}))
+}
+
+// saveJobs creates the jobs of the entities, the state of the jobs (attempts,
+// failed_at and last_error) is restored if restore is true.
+func (self *cliContext) saveJobs(entities []map[string]interface{}, restore bool) error {
+	backend, e := self.openBackend()
+	if nil != e {
+		return e
+	}
+	jobs, e := createJobs(backend, entities)
+	if nil != e {
+		return e
+	}
+	if restore {
+		for i, job := range jobs {
+			restoreJob(job, entities[i])
+		}
+	}
+	if 0 != len(jobs) {
+		if e = backend.create(jobs...); nil != e {
+			return e
+		}
+	}
+
+	records := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		records = append(records, map[string]interface{}{"handler_id": job.handler_id,
+			"queue":    job.queue,
+			"priority": job.priority,
+			"run_at":   job.run_at})
+	}
+	return self.writeRecords([]string{"handler_id", "queue", "priority", "run_at"}, records)
+}
+
+func cmdEnqueue(c *cliContext, args []string) error {
+	fs := c.flagSet("enqueue")
+	jf := addJobFlags(fs)
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+	entities, e := jf.entities(fs)
+	if nil != e {
+		return e
+	}
+	return c.saveJobs(entities, false)
+}
+
+func cmdRender(c *cliContext, args []string) error {
+	fs := c.flagSet("render")
+	jf := addJobFlags(fs)
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+	entities, e := jf.entities(fs)
+	if nil != e {
+		return e
+	}
+
+	// the jobs are built without the database.
+	backend := &dbBackend{ctx: map[string]interface{}{}, drv: *db_drv, dbType: DbType(*db_drv)}
+	backend.ctx["backend"] = backend
+	jobs, e := createJobs(backend, entities)
+	if nil != e {
+		return e
+	}
+
+	records := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		record := map[string]interface{}{"handler_id": job.handler_id,
+			"queue":        job.queue,
+			"priority":     job.priority,
+			"max_attempts": job.max_attempts,
+			"run_at":       job.run_at,
+			"handler":      job.handler_attributes}
+		if !job.expires_at.IsZero() {
+			record["expires_at"] = job.expires_at
+		}
+		output, e := job.render()
+		if nil != e {
+			return e
+		}
+		record["output"] = output
+		records = append(records, record)
+	}
+	if "json" == c.format {
+		return c.writeJSON(records)
+	}
+	for _, record := range records {
+		// the texts of the output are written line by line, such as the
+		// mail message.
+		if e := c.writeRecord(flattenSettings("", record, nil)); nil != e {
+			return e
+		}
+		io.WriteString(c.out, "\n")
+	}
+	return nil
+}
+
+// writeRecord writes the fields of the record line by line, the maps are
+// written in JSON.
+func (self *cliContext) writeRecord(record map[string]interface{}) error {
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(self.out, 0, 8, 2, ' ', 0)
+	for _, k := range keys {
+		var s string
+		switch v := record[k].(type) {
+		case map[string]interface{}, []interface{}:
+			bs, _ := json.MarshalIndent(v, "", "  ")
+			s = string(bs)
+		case string:
+			s = v
+		default:
+			s = cliCell(v)
+		}
+		lines := strings.Split(s, "\n")
+		fmt.Fprintf(w, "%s:\t%s\n", k, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "\t%s\n", line)
+		}
+	}
+	return w.Flush()
+}
+
+func cmdList(c *cliContext, args []string) error {
+	fs := c.flagSet("list")
+	scope := fs.String("scope", "all", "the scope of the jobs, all, failed, queued or active")
+	queue := fs.String("queue", "", "the queue of the jobs")
+	handler_id := fs.String("handler_id", "", "the handler_id of the jobs")
+	limit := fs.Int("limit", 50, "the max count of the jobs, 0 is unlimited")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+
+	filter := map[string]interface{}{"scope": *scope}
+	if 0 != len(*queue) {
+		filter["queue"] = *queue
+	}
+	if 0 != len(*handler_id) {
+		filter["handler_id"] = *handler_id
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	jobs, e := backend.search(filter, *limit)
+	if nil != e {
+		return e
+	}
+	for _, job := range jobs {
+		cliJob(job)
+	}
+	return c.writeRecords([]string{"id", "queue", "priority", "attempts", "handler_id", "run_at", "failed_at", "locked_by", "last_error_summary"}, jobs)
+}
+
+func cmdShow(c *cliContext, args []string) error {
+	fs := c.flagSet("show")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+	ids, e := parseIds(fs.Args())
+	if nil != e {
+		return e
+	}
+	if 1 != len(ids) {
+		return errors.New("only one job id is required.")
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	jobs, e := backend.search(map[string]interface{}{"id": ids[0]}, 1)
+	if nil != e {
+		return e
+	}
+	if 0 == len(jobs) {
+		return errors.New("job '" + strconv.FormatInt(ids[0], 10) + "' is not found.")
+	}
+	job := cliJob(jobs[0])
+	delete(job, "last_error_summary")
+	if result, e := backend.jobResult(ids[0], ""); nil == e && nil != result {
+		job["result"] = result
+	}
+
+	if "json" == c.format {
+		return c.writeJSON(job)
+	}
+	return c.writeRecord(job)
+}
+
+func cmdRetry(c *cliContext, args []string) error {
+	fs := c.flagSet("retry")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+	ids, e := parseIds(fs.Args())
+	if nil != e {
+		return e
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	actor := cliActor()
+	for _, id := range ids {
+		before := backend.jobSnapshot(id)
+		if e = backend.retry(id); nil != e {
+			return errors.New("retry job '" + strconv.FormatInt(id, 10) + "' failed, " + e.Error())
+		}
+		backend.auditAs(actor, "", "retry", strconv.FormatInt(id, 10), before, map[string]interface{}{"failed_at": nil})
+		c.printf("The job %d has been queued for a re-run\n", id)
+	}
+	if "json" == c.format {
+		return c.writeJSON(map[string]interface{}{"retried": ids})
+	}
+	return nil
+}
+
+func cmdDelete(c *cliContext, args []string) error {
+	fs := c.flagSet("delete")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+	ids, e := parseIds(fs.Args())
+	if nil != e {
+		return e
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	actor := cliActor()
+	for _, id := range ids {
+		before := backend.jobSnapshot(id)
+		if e = backend.destroy(id); nil != e {
+			return errors.New("delete job '" + strconv.FormatInt(id, 10) + "' failed, " + e.Error())
+		}
+		backend.auditAs(actor, "", "delete", strconv.FormatInt(id, 10), before, nil)
+		c.printf("The job %d was deleted\n", id)
+	}
+	if "json" == c.format {
+		return c.writeJSON(map[string]interface{}{"deleted": ids})
+	}
+	return nil
+}
+
+func cmdStats(c *cliContext, args []string) error {
+	fs := c.flagSet("stats")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	counts, e := backend.counts()
+	if nil != e {
+		return e
+	}
+	queues, e := backend.queueStates()
+	if nil != e {
+		return e
+	}
+
+	if "json" == c.format {
+		return c.writeJSON(map[string]interface{}{"counts": counts, "queues": queues})
+	}
+	e = c.writeTable([]string{"all", "failed", "active", "queued"}, [][]string{{
+		strconv.FormatInt(counts["all"], 10),
+		strconv.FormatInt(counts["failed"], 10),
+		strconv.FormatInt(counts["active"], 10),
+		strconv.FormatInt(counts["queued"], 10)}})
+	if nil != e {
+		return e
+	}
+	io.WriteString(c.out, "\n")
+	return c.writeRecords([]string{"name", "paused", "backlog", "paused_at"}, queues)
+}
+
+// lockedWorkers returns the workers which lock the jobs, the workers are not
+// registered, so the idle workers are not included.
+func (self *dbBackend) lockedWorkers() ([]map[string]interface{}, error) {
+	rows, e := self.db.Query("SELECT locked_by, COUNT(*), MIN(locked_at) FROM " + self.table +
+		" WHERE locked_by IS NOT NULL AND failed_at IS NULL GROUP BY locked_by ORDER BY locked_by")
+	if nil != e {
+		return nil, errors.New("query workers failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		var name string
+		var count int64
+		var locked_at NullTime
+		if e = rows.Scan(&name, &count, &locked_at); nil != e {
+			return nil, errors.New("scan workers failed, " + i18nString(self.dbType, self.drv, e))
+		}
+		worker := map[string]interface{}{"name": name, "jobs": count}
+		if locked_at.Valid {
+			worker["locked_since"] = locked_at.Time
+		}
+		results = append(results, worker)
+	}
+	if e = rows.Err(); nil != e {
+		return nil, errors.New("next workers failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return results, nil
+}
+
+func cmdWorkers(c *cliContext, args []string) error {
+	fs := c.flagSet("workers")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	workers, e := backend.lockedWorkers()
+	if nil != e {
+		return e
+	}
+	return c.writeRecords([]string{"name", "jobs", "locked_since"}, workers)
+}
+
+// exportJob converts the job into the format of /push, so that it can be
+// imported again.
+func exportJob(job map[string]interface{}) map[string]interface{} {
+	job = cliJob(job)
+	ent := map[string]interface{}{"handler": job["handler"]}
+	for _, k := range []string{"priority", "repeat_count", "repeat_interval", "max_attempts", "queue", "run_at", "expires_at",
+		"handler_id", "attempts", "failed_at", "last_error"} {
+		if v, ok := job[k]; ok && nil != v {
+			ent[k] = v
+		}
+	}
+	return ent
+}
+
+func cmdExport(c *cliContext, args []string) error {
+	fs := c.flagSet("export")
+	file := fs.String("file", "-", "the file which the jobs are written to, '-' is the stdout")
+	scope := fs.String("scope", "all", "the scope of the jobs, all, failed, queued or active")
+	queue := fs.String("queue", "", "the queue of the jobs")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+
+	filter := map[string]interface{}{"scope": *scope}
+	if 0 != len(*queue) {
+		filter["queue"] = *queue
+	}
+
+	backend, e := c.openBackend()
+	if nil != e {
+		return e
+	}
+	jobs, e := backend.search(filter, 0)
+	if nil != e {
+		return e
+	}
+	entities := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		entities = append(entities, exportJob(job))
+	}
+
+	bs, e := json.MarshalIndent(entities, "", "  ")
+	if nil != e {
+		return e
+	}
+	if "-" == *file {
+		_, e = c.out.Write(append(bs, '\n'))
+		return e
+	}
+	if e = os.WriteFile(*file, bs, 0666); nil != e {
+		return e
+	}
+	c.printf("%d jobs are exported to '%s'\n", len(entities), *file)
+	return nil
+}
+
+func cmdImport(c *cliContext, args []string) error {
+	fs := c.flagSet("import")
+	file := fs.String("file", "-", "the file of the jobs which are exported by 'export', '-' is the stdin")
+	if e := c.parse(fs, args); nil != e {
+		return e
+	}
+
+	entities, e := readJobsFile(*file)
+	if nil != e {
+		return e
+	}
+	return c.saveJobs(entities, true)
+}
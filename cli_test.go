@@ -0,0 +1,252 @@
+package delayed_job
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	jf := addJobFlags(fs)
+	e := fs.Parse([]string{"-type", "exec", "-payload", `{"command": "echo", "timeout": 3}`,
+		"-arg", "arguments=abc", "-queue", "q1", "-priority", "3", "-handler_id", "h1", "-ttl", "1m"})
+	if nil != e {
+		t.Fatal(e)
+	}
+	entities, e := jf.entities(fs)
+	if nil != e {
+		t.Fatal(e)
+	}
+	if 1 != len(entities) {
+		t.Fatal("excepted is 1 entity, actual is", entities)
+	}
+	ent := entities[0]
+	if "q1" != ent["queue"] || 3 != ent["priority"] || "1m0s" != ent["ttl"] {
+		t.Error("excepted attributes are set, actual is", ent)
+	}
+	if _, ok := ent["max_attempts"]; ok {
+		t.Error("max_attempts isn't set, actual is", ent["max_attempts"])
+	}
+	handler := ent["handler"].(map[string]interface{})
+	if "exec" != handler["type"] || "echo" != handler["command"] || "abc" != handler["arguments"] || "h1" != handler["handler_id"] {
+		t.Error("excepted handler is built from flags, actual is", handler)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	jf = addJobFlags(fs)
+	if e = fs.Parse([]string{"-queue", "q1"}); nil != e {
+		t.Fatal(e)
+	}
+	if _, e = jf.entities(fs); nil == e {
+		t.Error("excepted error if -file and -type are missing")
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	jf = addJobFlags(fs)
+	if e = fs.Parse([]string{"-type", "test", "-run_at", "tomorrow"}); nil != e {
+		t.Fatal(e)
+	}
+	if _, e = jf.entities(fs); nil == e {
+		t.Error("excepted error if -run_at is invalid")
+	}
+}
+
+func TestReadJobsFile(t *testing.T) {
+	dir := t.TempDir()
+	for idx, test := range []struct {
+		content  string
+		count    int
+		is_error bool
+	}{{content: `{"queue": "a", "handler": {"type": "test"}}`, count: 1},
+		{content: `[{"handler": {"type": "test"}}, {"handler": {"type": "test"}}]`, count: 2},
+		{content: `[1]`, is_error: true},
+		{content: `"abc"`, is_error: true},
+		{content: `{`, is_error: true}} {
+		file := filepath.Join(dir, "jobs.json")
+		if e := os.WriteFile(file, []byte(test.content), 0666); nil != e {
+			t.Fatal(e)
+		}
+		entities, e := readJobsFile(file)
+		if test.is_error {
+			if nil == e {
+				t.Errorf("[%d] excepted error, actual is %v", idx, entities)
+			}
+			continue
+		}
+		if nil != e {
+			t.Errorf("[%d] %v", idx, e)
+			continue
+		}
+		if test.count != len(entities) {
+			t.Errorf("[%d] excepted count is %d, actual is %d", idx, test.count, len(entities))
+		}
+	}
+}
+
+func TestParseIds(t *testing.T) {
+	ids, e := parseIds([]string{"1", "23"})
+	if nil != e {
+		t.Fatal(e)
+	}
+	if 2 != len(ids) || 1 != ids[0] || 23 != ids[1] {
+		t.Error("excepted is [1 23], actual is", ids)
+	}
+	if _, e = parseIds(nil); nil == e {
+		t.Error("excepted error if id is missing")
+	}
+	if _, e = parseIds([]string{"a"}); nil == e {
+		t.Error("excepted error if id isn't a number")
+	}
+}
+
+func TestExportJob(t *testing.T) {
+	failed_at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ent := exportJob(map[string]interface{}{"id": int64(3),
+		"priority":   2,
+		"attempts":   4,
+		"queue":      "q1",
+		"handler":    `{"type": "test"}`,
+		"handler_id": sql.NullString{String: "h1", Valid: true},
+		"last_error": "timeout",
+		"failed_at":  failed_at,
+		"locked_by":  "w1"})
+	if _, ok := ent["locked_by"]; ok {
+		t.Error("excepted locked_by isn't exported, actual is", ent)
+	}
+
+	bs, e := json.Marshal([]interface{}{ent})
+	if nil != e {
+		t.Fatal(e)
+	}
+	file := filepath.Join(t.TempDir(), "jobs.json")
+	if e = os.WriteFile(file, bs, 0666); nil != e {
+		t.Fatal(e)
+	}
+	entities, e := readJobsFile(file)
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+	jobs, e := createJobs(backend, entities)
+	if nil != e {
+		t.Fatal(e)
+	}
+	restoreJob(jobs[0], entities[0])
+	job := jobs[0]
+	if "h1" != job.handler_id || 4 != job.attempts || "timeout" != job.last_error || !failed_at.Equal(job.failed_at) || "q1" != job.queue {
+		t.Error("excepted the state of job is restored, actual is", job.handler_id, job.attempts, job.last_error, job.failed_at, job.queue)
+	}
+}
+
+// restoreSettings restores the flags after the test, RunCommand loads the
+// environment and the config file into the flags.
+func restoreSettings(t *testing.T) {
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	restoreFlags(t, names...)
+
+	old_actuals := default_actuals
+	t.Cleanup(func() {
+		default_actuals = old_actuals
+	})
+}
+
+func TestRenderCommand(t *testing.T) {
+	restoreSettings(t)
+
+	var out bytes.Buffer
+	e := RunCommand([]string{"render", "-output", "json", "-type", "test", "-queue", "render_q", "-arg", "content=abc"}, &out)
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	var records []map[string]interface{}
+	if e = json.Unmarshal(out.Bytes(), &records); nil != e {
+		t.Fatal(e, out.String())
+	}
+	if 1 != len(records) || "render_q" != records[0]["queue"] {
+		t.Error("excepted the job of render_q, actual is", out.String())
+	}
+
+	out.Reset()
+	if e = RunCommand([]string{"render", "-type", "not_exists"}, &out); nil == e {
+		t.Error("excepted error if type is unknown")
+	}
+	if e = RunCommand([]string{"abc"}, &out); nil == e {
+		t.Error("excepted error if command is unknown")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	restoreSettings(t)
+
+	backendTest(t, func(backend *dbBackend) {
+		var out bytes.Buffer
+		e := RunCommand([]string{"enqueue", "-type", "test", "-queue", "cli_q", "-handler_id", "cli_1"}, &out)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		out.Reset()
+		if e = RunCommand([]string{"list", "-output", "json", "-queue", "cli_q"}, &out); nil != e {
+			t.Error(e)
+			return
+		}
+		var jobs []map[string]interface{}
+		if e = json.Unmarshal(out.Bytes(), &jobs); nil != e {
+			t.Error(e, out.String())
+			return
+		}
+		if 1 != len(jobs) || "cli_1" != jobs[0]["handler_id"] {
+			t.Error("excepted the job cli_1, actual is", out.String())
+			return
+		}
+		id := fmt.Sprint(jobs[0]["id"])
+
+		out.Reset()
+		if e = RunCommand([]string{"show", id}, &out); nil != e {
+			t.Error(e)
+		} else if !strings.Contains(out.String(), "cli_q") {
+			t.Error("excepted queue is cli_q, actual is", out.String())
+		}
+
+		out.Reset()
+		if e = RunCommand([]string{"stats", "-output", "json"}, &out); nil != e {
+			t.Error(e)
+		} else if !strings.Contains(out.String(), "cli_q") {
+			t.Error("excepted queue cli_q in stats, actual is", out.String())
+		}
+
+		file := filepath.Join(t.TempDir(), "jobs.json")
+		if e = RunCommand([]string{"export", "-queue", "cli_q", "-file", file}, &out); nil != e {
+			t.Error(e)
+			return
+		}
+
+		if e = RunCommand([]string{"delete", id}, &out); nil != e {
+			t.Error(e)
+		}
+		if count, _ := backend.count(nil); 0 != count {
+			t.Error("excepted the job is deleted, actual count is", count)
+		}
+
+		if e = RunCommand([]string{"import", "-file", file}, &out); nil != e {
+			t.Error(e)
+		}
+		if count, _ := backend.count(nil); 1 != count {
+			t.Error("excepted the job is imported, actual count is", count)
+		}
+	})
+}
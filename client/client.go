@@ -0,0 +1,369 @@
+// Package client is the Go client of the http api of delayed_job, it builds
+// the jobs in the shape which the server expects and pushes them.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var sequence_id uint64
+
+// generateId returns a handler_id which is unique in the process, the server
+// replaces the job with the same handler_id, so a push is idempotent when it
+// is retried.
+func generateId() string {
+	return "c" + strconv.FormatInt(time.Now().UnixNano(), 36) + "_" + strconv.FormatUint(atomic.AddUint64(&sequence_id, 1), 10)
+}
+
+// Job is the builder of a job.
+type Job struct {
+	attributes map[string]interface{}
+	handler    map[string]interface{}
+}
+
+// NewJob creates a job with the handler type (such as "exec", "web" or
+// "mail") and the payload of the handler.
+func NewJob(handler_type string, payload map[string]interface{}) *Job {
+	handler := make(map[string]interface{}, len(payload)+2)
+	for k, v := range payload {
+		handler[k] = v
+	}
+	handler["type"] = handler_type
+	if _, ok := handler["handler_id"]; !ok {
+		if _, ok := handler["_uid"]; !ok {
+			handler["handler_id"] = generateId()
+		}
+	}
+	return &Job{attributes: map[string]interface{}{}, handler: handler}
+}
+
+// ID returns the handler_id of the job.
+func (self *Job) ID() string {
+	if id, ok := self.handler["_uid"]; ok {
+		return toString(id)
+	}
+	return toString(self.handler["handler_id"])
+}
+
+// WithID sets the handler_id of the job, the job with the same handler_id is
+// replaced.
+func (self *Job) WithID(id string) *Job {
+	delete(self.handler, "_uid")
+	self.handler["handler_id"] = id
+	return self
+}
+
+func (self *Job) WithPriority(priority int) *Job {
+	self.attributes["priority"] = priority
+	return self
+}
+
+func (self *Job) WithQueue(queue string) *Job {
+	self.attributes["queue"] = queue
+	return self
+}
+
+func (self *Job) WithMaxAttempts(max_attempts int) *Job {
+	self.attributes["max_attempts"] = max_attempts
+	return self
+}
+
+// RunAt schedules the job at the time.
+func (self *Job) RunAt(t time.Time) *Job {
+	self.attributes["run_at"] = t.Format(time.RFC3339Nano)
+	return self
+}
+
+// RunIn schedules the job after the duration.
+func (self *Job) RunIn(d time.Duration) *Job {
+	return self.RunAt(time.Now().Add(d))
+}
+
+// Repeat runs the job count times more with the interval.
+func (self *Job) Repeat(count int, interval time.Duration) *Job {
+	self.attributes["repeat_count"] = count
+	self.attributes["repeat_interval"] = interval.String()
+	return self
+}
+
+// ExpiresAt sets the deadline of the job.
+func (self *Job) ExpiresAt(t time.Time) *Job {
+	self.attributes["expires_at"] = t.Format(time.RFC3339Nano)
+	return self
+}
+
+// TTL sets the deadline of the job relative to run_at.
+func (self *Job) TTL(d time.Duration) *Job {
+	self.attributes["ttl"] = d.String()
+	return self
+}
+
+// Set sets a field of the handler payload.
+func (self *Job) Set(key string, value interface{}) *Job {
+	self.handler[key] = value
+	return self
+}
+
+// Map returns the job in the shape of the push api.
+func (self *Job) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(self.attributes)+1)
+	for k, v := range self.attributes {
+		m[k] = v
+	}
+	m["handler"] = self.handler
+	return m
+}
+
+// Error is returned when the server responds with an error.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (self *Error) Error() string {
+	return strconv.Itoa(self.StatusCode) + " " + self.Message
+}
+
+// IsNotFound returns true if the error is a 404.
+func IsNotFound(e error) bool {
+	if err, ok := e.(*Error); ok {
+		return http.StatusNotFound == err.StatusCode
+	}
+	return false
+}
+
+// Client talks to the http api of delayed_job.
+type Client struct {
+	base string
+
+	HTTPClient *http.Client
+	// the count of retries after the network error or 5xx response.
+	MaxRetries int
+	RetryDelay time.Duration
+
+	// the credential of the console which enables the authentication, Token
+	// is sent as 'Authorization: Bearer <Token>', otherwise Username and
+	// Password are sent as the basic authentication.
+	Token    string
+	Username string
+	Password string
+}
+
+// New creates a client, base_url is the address of the console, such as
+// "http://127.0.0.1:37078" or "http://127.0.0.1:37078/delayed_jobs".
+func New(base_url string) *Client {
+	return &Client{base: strings.TrimSuffix(base_url, "/"),
+		HTTPClient: http.DefaultClient,
+		MaxRetries: 3,
+		RetryDelay: 500 * time.Millisecond}
+}
+
+func (self *Client) do(method, path string, body interface{}, idempotency_key string) ([]byte, error) {
+	var bs []byte
+	if nil != body {
+		var e error
+		bs, e = json.Marshal(body)
+		if nil != e {
+			return nil, e
+		}
+	}
+
+	var last_error error
+	for i := 0; i <= self.MaxRetries; i++ {
+		if i > 0 && self.RetryDelay > 0 {
+			time.Sleep(self.RetryDelay * time.Duration(i))
+		}
+
+		var reader io.Reader
+		if nil != bs {
+			reader = bytes.NewReader(bs)
+		}
+		req, e := http.NewRequest(method, self.base+path, reader)
+		if nil != e {
+			return nil, e
+		}
+		if nil != bs {
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+		if 0 != len(idempotency_key) {
+			req.Header.Set("Idempotency-Key", idempotency_key)
+		}
+		if 0 != len(self.Token) {
+			req.Header.Set("Authorization", "Bearer "+self.Token)
+		} else if 0 != len(self.Username) {
+			req.SetBasicAuth(self.Username, self.Password)
+		}
+
+		resp, e := self.HTTPClient.Do(req)
+		if nil != e {
+			last_error = e
+			continue
+		}
+		respBody, e := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if nil != e {
+			last_error = e
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return respBody, nil
+		}
+
+		last_error = &Error{StatusCode: resp.StatusCode, Message: string(respBody)}
+		if resp.StatusCode < 500 {
+			break
+		}
+	}
+	return nil, last_error
+}
+
+func (self *Client) getJSON(path string, value interface{}) error {
+	bs, e := self.do("GET", path, nil, "")
+	if nil != e {
+		return e
+	}
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// Push pushes a job, it is safe to retry because the job is identified by its
+// handler_id. The retries carry the same Idempotency-Key, the server replays
+// the first response for the key in '-idempotency_ttl', so the job isn't
+// replaced again.
+func (self *Client) Push(job *Job) error {
+	_, e := self.do("PUT", "/push", job.Map(), generateId())
+	return e
+}
+
+// PushAll pushes the jobs in a transaction, the retries carry the same
+// Idempotency-Key as Push.
+func (self *Client) PushAll(jobs ...*Job) error {
+	if 0 == len(jobs) {
+		return nil
+	}
+
+	entities := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		entities = append(entities, job.Map())
+	}
+	_, e := self.do("PUT", "/pushAll", entities, generateId())
+	return e
+}
+
+// All returns all jobs.
+func (self *Client) All() ([]map[string]interface{}, error) {
+	return self.list("/all")
+}
+
+// Failed returns the failed jobs.
+func (self *Client) Failed() ([]map[string]interface{}, error) {
+	return self.list("/failed")
+}
+
+// Queued returns the jobs which are waiting.
+func (self *Client) Queued() ([]map[string]interface{}, error) {
+	return self.list("/queued")
+}
+
+// Active returns the jobs which are running.
+func (self *Client) Active() ([]map[string]interface{}, error) {
+	return self.list("/active")
+}
+
+func (self *Client) list(path string) ([]map[string]interface{}, error) {
+	var results []map[string]interface{}
+	if e := self.getJSON(path, &results); nil != e {
+		return nil, e
+	}
+	return results, nil
+}
+
+// Counts is the count of jobs in every state.
+type Counts struct {
+	All    int64 `json:"all"`
+	Failed int64 `json:"failed"`
+	Active int64 `json:"active"`
+	Queued int64 `json:"queued"`
+}
+
+// Counts returns the count of jobs in every state.
+func (self *Client) Counts() (*Counts, error) {
+	counts := &Counts{}
+	if e := self.getJSON("/counts", counts); nil != e {
+		return nil, e
+	}
+	return counts, nil
+}
+
+// Retry queues the failed job for a re-run.
+func (self *Client) Retry(id int64) error {
+	_, e := self.do("POST", "/"+strconv.FormatInt(id, 10)+"/retry", nil, "")
+	return e
+}
+
+// Delete deletes the job.
+func (self *Client) Delete(id int64) error {
+	_, e := self.do("DELETE", "/"+strconv.FormatInt(id, 10), nil, "")
+	return e
+}
+
+// Result is the result of the finished job.
+type Result struct {
+	ID        int64           `json:"id"`
+	HandlerID string          `json:"handler_id"`
+	Status    string          `json:"status"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Result returns the result of the finished job by id or handler_id.
+func (self *Client) Result(id_or_handler_id string) (*Result, error) {
+	result := &Result{}
+	if e := self.getJSON("/jobs/"+url.PathEscape(id_or_handler_id)+"/result", result); nil != e {
+		return nil, e
+	}
+	return result, nil
+}
+
+// PauseQueue stops the workers to run the jobs of the queue.
+func (self *Client) PauseQueue(queue string) error {
+	if 0 == len(queue) {
+		return errors.New("queue is empty")
+	}
+	_, e := self.do("POST", "/queues/"+url.PathEscape(queue)+"/pause", nil, "")
+	return e
+}
+
+// ResumeQueue restarts the jobs of the paused queue.
+func (self *Client) ResumeQueue(queue string) error {
+	if 0 == len(queue) {
+		return errors.New("queue is empty")
+	}
+	_, e := self.do("POST", "/queues/"+url.PathEscape(queue)+"/resume", nil, "")
+	return e
+}
+
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		bs, _ := json.Marshal(value)
+		return string(bs)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJobMap(t *testing.T) {
+	run_at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	job := NewJob("exec", map[string]interface{}{"command": "echo"}).
+		WithPriority(3).
+		WithQueue("sms").
+		WithMaxAttempts(5).
+		RunAt(run_at).
+		Repeat(2, time.Minute).
+		TTL(time.Hour)
+
+	m := job.Map()
+	if 3 != m["priority"] || "sms" != m["queue"] || 5 != m["max_attempts"] || 2 != m["repeat_count"] || "1m0s" != m["repeat_interval"] || "1h0m0s" != m["ttl"] {
+		t.Error("attributes is not excepted, actual is", m)
+	}
+	if "2020-01-02T03:04:05Z" != m["run_at"] {
+		t.Error("excepted run_at is '2020-01-02T03:04:05Z', actual is", m["run_at"])
+	}
+
+	handler, ok := m["handler"].(map[string]interface{})
+	if !ok {
+		t.Error("excepted handler is a map, actual is", m["handler"])
+		return
+	}
+	if "exec" != handler["type"] || "echo" != handler["command"] {
+		t.Error("handler is not excepted, actual is", handler)
+	}
+	if 0 == len(job.ID()) || job.ID() != handler["handler_id"] {
+		t.Error("excepted handler_id is generated, actual is", handler["handler_id"])
+	}
+
+	if id := NewJob("exec", nil).ID(); id == job.ID() {
+		t.Error("excepted handler_id is unique, actual is", id)
+	}
+	if id := job.WithID("abc").ID(); "abc" != id {
+		t.Error("excepted handler_id is 'abc', actual is", id)
+	}
+}
+
+func TestPushWithRetries(t *testing.T) {
+	var requests int
+	var keys []string
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if "PUT" != r.Method || "/push" != r.URL.Path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(bs, &body)
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	c.RetryDelay = time.Millisecond
+	e := c.Push(NewJob("test", map[string]interface{}{"a": "b"}).WithQueue("q1"))
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if 3 != requests {
+		t.Error("excepted requests is 3, actual is", requests)
+	}
+	if 0 == len(keys[0]) || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Error("excepted the same idempotency key in retries, actual is", keys)
+	}
+	if "q1" != body["queue"] {
+		t.Error("excepted queue is 'q1', actual is", body)
+	}
+}
+
+func TestNoRetryOnBadRequest(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	c.RetryDelay = time.Millisecond
+	_, e := c.Result("12")
+	if !IsNotFound(e) {
+		t.Error("excepted error is not found, actual is", e)
+	}
+	if 1 != requests {
+		t.Error("excepted requests is 1, actual is", requests)
+	}
+}
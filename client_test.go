@@ -0,0 +1,181 @@
+package delayed_job
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/delayed_job/client"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestClient(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		srv := httptest.NewServer(&webFront{dbBackend: backend})
+		defer srv.Close()
+
+		c := client.New(srv.URL)
+		e := c.Push(client.NewJob("test", map[string]interface{}{"a": "b"}).WithPriority(3).WithQueue("q1").RunIn(time.Hour))
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		e = c.PushAll(client.NewJob("test", nil).WithQueue("q2"), client.NewJob("test", nil).WithQueue("q2"))
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		counts, e := c.Counts()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 3 != counts.All {
+			t.Error("excepted all is 3, actual is", counts.All)
+		}
+
+		jobs, e := c.All()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 3 != len(jobs) {
+			t.Error("excepted jobs is 3, actual is", len(jobs))
+			return
+		}
+
+		for _, job := range jobs {
+			if "q1" != job["queue"] {
+				continue
+			}
+			id, e := job["id"].(interface {
+				Int64() (int64, error)
+			}).Int64()
+			if nil != e {
+				t.Error(e)
+				return
+			}
+
+			if e = c.Delete(id); nil != e {
+				t.Error(e)
+				return
+			}
+		}
+
+		counts, e = c.Counts()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != counts.All {
+			t.Error("excepted all is 2, actual is", counts.All)
+		}
+	})
+}
+
+func TestClientWithPrefix(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		srv := httptest.NewServer(&webFront{dbBackend: backend})
+		defer srv.Close()
+
+		for _, prefix := range []string{"/delayed_jobs", "/delayed_job/"} {
+			c := client.New(srv.URL + prefix)
+			e := c.Push(client.NewJob("test", nil).WithQueue("q1"))
+			if nil != e {
+				t.Error(prefix, e)
+				return
+			}
+
+			e = c.PushAll(client.NewJob("test", nil).WithQueue("q2"))
+			if nil != e {
+				t.Error(prefix, e)
+				return
+			}
+
+			counts, e := c.Counts()
+			if nil != e {
+				t.Error(prefix, e)
+				return
+			}
+			if 0 == counts.All {
+				t.Error(prefix, "excepted all is not 0, actual is", counts.All)
+			}
+
+			for _, list := range []func() ([]map[string]interface{}, error){c.All, c.Failed, c.Queued, c.Active} {
+				if _, e = list(); nil != e {
+					t.Error(prefix, e)
+					return
+				}
+			}
+
+			if e = c.PauseQueue("q1"); nil != e {
+				t.Error(prefix, e)
+				return
+			}
+			if e = c.ResumeQueue("q1"); nil != e {
+				t.Error(prefix, e)
+				return
+			}
+		}
+	})
+}
+
+func TestClientWithAuth(t *testing.T) {
+	hash, e := bcrypt.GenerateFromPassword([]byte("123"), bcrypt.MinCost)
+	if nil != e {
+		t.Fatal(e)
+	}
+	tokens, e := newTokenAuthenticator("abc:operator")
+	if nil != e {
+		t.Fatal(e)
+	}
+	users, e := newBasicAuthenticator("mfk:" + string(hash) + ":viewer")
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "GET" == r.Method {
+			io.WriteString(w, `{"all":1,"failed":0,"active":0,"queued":1}`)
+		}
+	})
+	h, e := newAuthHandler(next, []Authenticator{tokens, users}, "")
+	if nil != e {
+		t.Fatal(e)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	c.MaxRetries = 0
+	if _, e = c.Counts(); nil == e || !strings.Contains(e.Error(), "401") {
+		t.Error("excepted 401 without credential, actual is", e)
+	}
+
+	c.Token = "abc"
+	if e = c.Push(client.NewJob("test", nil)); nil != e {
+		t.Error(e)
+	}
+
+	c.Token = ""
+	c.Username = "mfk"
+	c.Password = "123"
+	if counts, e := c.Counts(); nil != e {
+		t.Error(e)
+	} else if 1 != counts.All {
+		t.Error("excepted all is 1, actual is", counts.All)
+	}
+	if e = c.Push(client.NewJob("test", nil)); nil == e || !strings.Contains(e.Error(), "403") {
+		t.Error("excepted 403 for the viewer, actual is", e)
+	}
+
+	c.Password = "456"
+	if _, e = c.Counts(); nil == e || !strings.Contains(e.Error(), "401") {
+		t.Error("excepted 401 for the invalid password, actual is", e)
+	}
+}
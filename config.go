@@ -1,14 +1,33 @@
 package delayed_job
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
-var default_actuals = map[string]string{}
+// the prefix of the environment variables which override the flags, such as
+// DELAYED_JOB_MAIL_SMTP_SERVER for 'mail.smtp_server'.
+const env_prefix = "DELAYED_JOB_"
+
+var (
+	config_strict = flag.Bool("config_strict", false, "fail on the unknown or mistyped keys in the config file and the DELAYED_JOB_* environment variables")
+
+	default_actuals = map[string]string{}
+
+	// the extensions of the config file, the file is JSON if the extension
+	// is unknown.
+	config_extensions = []string{".conf", ".json", ".yaml", ".yml", ".toml"}
+)
 
 func loadActualFlags(flagSet *flag.FlagSet) map[string]string {
 	actual := map[string]string{}
@@ -24,13 +43,7 @@ func loadActualFlags(flagSet *flag.FlagSet) map[string]string {
 }
 
 func loadConfig(nm string, flagSet *flag.FlagSet, isOverride bool) error {
-	f, e := os.Open(nm)
-	if nil != e {
-		return fmt.Errorf("load config '%s' failed, %v", nm, e)
-	}
-
-	var res map[string]interface{}
-	e = json.NewDecoder(f).Decode(&res)
+	res, e := readConfigFile(nm)
 	if nil != e {
 		return fmt.Errorf("load config '%s' failed, %v", nm, e)
 	}
@@ -52,6 +65,92 @@ func loadConfig(nm string, flagSet *flag.FlagSet, isOverride bool) error {
 	return nil
 }
 
+func configFormat(nm string) string {
+	switch strings.ToLower(filepath.Ext(nm)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// readConfigFile reads the config file in JSON, YAML or TOML by the extension
+// of the file.
+func readConfigFile(nm string) (map[string]interface{}, error) {
+	bs, e := os.ReadFile(nm)
+	if nil != e {
+		return nil, e
+	}
+
+	var res map[string]interface{}
+	switch configFormat(nm) {
+	case "yaml":
+		e = yaml.Unmarshal(bs, &res)
+	case "toml":
+		e = toml.Unmarshal(bs, &res)
+	default:
+		e = json.Unmarshal(bs, &res)
+	}
+	if nil != e {
+		return nil, e
+	}
+	if nil == res {
+		res = map[string]interface{}{}
+	}
+	return res, nil
+}
+
+// writeConfigFile writes the settings in the format of the config file.
+func writeConfigFile(nm string, settings map[string]interface{}) error {
+	settings = normalizeSettings(settings).(map[string]interface{})
+
+	var bs []byte
+	var e error
+	switch configFormat(nm) {
+	case "yaml":
+		bs, e = yaml.Marshal(settings)
+	case "toml":
+		var buffer bytes.Buffer
+		e = toml.NewEncoder(&buffer).Encode(settings)
+		bs = buffer.Bytes()
+	default:
+		bs, e = json.MarshalIndent(settings, "", "  ")
+	}
+	if nil != e {
+		return e
+	}
+	return os.WriteFile(nm, bs, 0666)
+}
+
+// normalizeSettings converts the json.Number into the int64 or the float64,
+// so that they are written as the numbers in YAML and TOML.
+func normalizeSettings(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			copied[k] = normalizeSettings(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = normalizeSettings(item)
+		}
+		return copied
+	case json.Number:
+		if i, e := value.Int64(); nil == e {
+			return i
+		}
+		if f, e := value.Float64(); nil == e {
+			return f
+		}
+		return value.String()
+	}
+	return v
+}
+
 func assignFlagSet(prefix string, res map[string]interface{}, flagSet *flag.FlagSet, actual map[string]string, isOverride bool) error {
 	for k, v := range res {
 		switch value := v.(type) {
@@ -64,6 +163,9 @@ func assignFlagSet(prefix string, res map[string]interface{}, flagSet *flag.Flag
 		case []interface{}:
 		case string:
 		case float64:
+		case int:
+		case int64:
+		case json.Number:
 		case bool:
 		case nil:
 			continue
@@ -74,7 +176,7 @@ func assignFlagSet(prefix string, res map[string]interface{}, flagSet *flag.Flag
 
 		if !isOverride {
 			if _, ok := actual[nm]; ok {
-				log.Printf("load flag '%s' from config is skipped.\n", nm)
+				defaultLogger().Info("load flag from config is skipped.", "flag", nm)
 				continue
 			}
 		}
@@ -87,15 +189,37 @@ func assignFlagSet(prefix string, res map[string]interface{}, flagSet *flag.Flag
 		}
 
 		if nil == g {
-			log.Printf("flag '%s' is not defined.\n", nm)
+			if *config_strict {
+				return errors.New("flag '" + nm + "' is not defined.")
+			}
+			defaultLogger().Warn("flag is not defined.", "flag", nm)
 			continue
 		}
+		if *config_strict {
+			if e := checkFlagType(g, v); nil != e {
+				return e
+			}
+		}
 
 		err := g.Value.Set(fmt.Sprint(v))
 		if nil != err {
-			return err
+			return fmt.Errorf("set flag '%s' failed, %v", nm, err)
 		}
-		log.Println("set", nm, "=", v)
+		defaultLogger().Info("set flag", "flag", nm, "value", v)
+	}
+	return nil
+}
+
+// checkFlagType fails if the bool value is set to the flag which isn't bool,
+// or the value of the bool flag isn't bool.
+func checkFlagType(g *flag.Flag, v interface{}) error {
+	_, is_bool := v.(bool)
+	if bf, ok := g.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+		if !is_bool {
+			return fmt.Errorf("flag '%s' is bool, actual value is %T", g.Name, v)
+		}
+	} else if is_bool {
+		return fmt.Errorf("flag '%s' isn't bool, actual value is bool", g.Name)
 	}
 	return nil
 }
@@ -106,3 +230,82 @@ func combineName(prefix, nm string) string {
 	}
 	return prefix + "." + nm
 }
+
+var env_replacer = strings.NewReplacer(".", "_", "-", "_")
+
+// envName returns the environment variable of the flag, such as
+// DELAYED_JOB_MAIL_SMTP_SERVER for 'mail.smtp_server'.
+func envName(nm string) string {
+	return env_prefix + strings.ToUpper(env_replacer.Replace(nm))
+}
+
+// loadEnvironment sets the flags from the DELAYED_JOB_* environment
+// variables, the flags in the command line are skipped. It must be called
+// before the config file is loaded, so that the environment variables
+// override the config file.
+func loadEnvironment(flagSet *flag.FlagSet, environ []string) error {
+	actual := loadActualFlags(flagSet)
+	names := map[string]*flag.Flag{}
+	fn := func(f *flag.Flag) {
+		names[envName(f.Name)] = f
+	}
+	if nil == flagSet {
+		flag.VisitAll(fn)
+	} else {
+		flagSet.VisitAll(fn)
+	}
+
+	// config_strict may be set by the environment variable too.
+	strict := *config_strict
+	if s, ok := lookupEnv(environ, envName("config_strict")); ok {
+		if _, is_set := actual["config_strict"]; !is_set {
+			if b, e := strconv.ParseBool(s); nil == e {
+				strict = b
+			}
+		}
+	}
+
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, env_prefix) {
+			continue
+		}
+		idx := strings.IndexByte(kv, '=')
+		if idx < 0 {
+			continue
+		}
+		key, value := kv[:idx], kv[idx+1:]
+
+		g, ok := names[key]
+		if !ok {
+			if strict {
+				return errors.New("environment variable '" + key + "' isn't a flag.")
+			}
+			defaultLogger().Warn("environment variable isn't a flag.", "env", key)
+			continue
+		}
+		if _, ok := actual[g.Name]; ok {
+			defaultLogger().Info("load flag from environment is skipped.", "flag", g.Name, "env", key)
+			continue
+		}
+		var e error
+		if nil == flagSet {
+			e = flag.Set(g.Name, value)
+		} else {
+			e = flagSet.Set(g.Name, value)
+		}
+		if nil != e {
+			return errors.New("set flag '" + g.Name + "' from environment variable '" + key + "' failed, " + e.Error())
+		}
+		defaultLogger().Info("set flag from environment", "flag", g.Name, "env", key)
+	}
+	return nil
+}
+
+func lookupEnv(environ []string, key string) (string, bool) {
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, key+"=") {
+			return kv[len(key)+1:], true
+		}
+	}
+	return "", false
+}
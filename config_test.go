@@ -1,7 +1,11 @@
 package delayed_job
 
 import (
+	"encoding/json"
 	"flag"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -144,3 +148,121 @@ func TestLoadConfigWithOverride(t *testing.T) {
 		t.Errorf("dc != \"67\", actual is %s", *dc)
 	}
 }
+
+func TestLoadConfigWithYamlAndToml(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"delayed_job.yaml": "a: 1\nb: true\nc: abc\nd:\n  a: 1323\n  c: \"67\"\n",
+		"delayed_job.toml": "a = 1\nb = true\nc = \"abc\"\n[d]\na = 1323\nc = \"67\"\n"} {
+		file := filepath.Join(dir, name)
+		if e := os.WriteFile(file, []byte(content), 0666); nil != e {
+			t.Fatal(e)
+		}
+
+		var flagSet flag.FlagSet
+		a := flagSet.Int("a", -1, "for test")
+		b := flagSet.Bool("b", false, "for test")
+		c := flagSet.String("c", "-1", "for test")
+		da := flagSet.Int("d.a", -1, "for test")
+		dc := flagSet.String("d.c", "-1", "for test")
+		if e := loadConfig(file, &flagSet, false); nil != e {
+			t.Error(name, e)
+			continue
+		}
+		if 1 != *a || !*b || "abc" != *c || 1323 != *da || "67" != *dc {
+			t.Error(name, "is unexcepted,", *a, *b, *c, *da, *dc)
+		}
+
+		settings, e := readConfigFile(file)
+		if nil != e {
+			t.Error(name, e)
+			continue
+		}
+		settings["c"] = "xyz"
+		settings["e"] = json.Number("12")
+		if e := writeConfigFile(file, settings); nil != e {
+			t.Error(name, e)
+			continue
+		}
+		if e := loadConfig(file, &flagSet, true); nil != e {
+			t.Error(name, e)
+			continue
+		}
+		if "xyz" != *c {
+			t.Error(name, "excepted c is xyz after it is written, actual is", *c)
+		}
+		if bs, _ := os.ReadFile(file); strings.Contains(string(bs), "\"12\"") {
+			t.Error(name, "number is written as string,", string(bs))
+		}
+	}
+}
+
+func TestLoadConfigWithStrict(t *testing.T) {
+	restoreFlags(t, "config_strict")
+
+	var flagSet flag.FlagSet
+	flagSet.Int("a", -1, "for test")
+	flagSet.String("c", "-1", "for test")
+
+	flag.Set("config_strict", "false")
+	if e := assignFlagSet("", map[string]interface{}{"x": 1, "c": true}, &flagSet, map[string]string{}, false); nil != e {
+		t.Error(e)
+	}
+
+	flag.Set("config_strict", "true")
+	for _, settings := range []map[string]interface{}{{"x": 1},
+		{"d": map[string]interface{}{"a": 1}},
+		{"a": "abc"},
+		{"c": true}} {
+		if e := assignFlagSet("", settings, &flagSet, map[string]string{}, false); nil == e {
+			t.Error(settings, "should be failed in strict mode")
+		}
+	}
+	if e := assignFlagSet("", map[string]interface{}{"a": 2, "c": 3}, &flagSet, map[string]string{}, false); nil != e {
+		t.Error(e)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	var flagSet flag.FlagSet
+	a := flagSet.Int("a", -1, "for test")
+	c := flagSet.String("c", "-1", "for test")
+	dc := flagSet.String("d.c", "-1", "for test")
+	smtp := flagSet.String("mail.smtp-server", "", "for test")
+	flagSet.Set("a", "2")
+
+	e := loadEnvironment(&flagSet, []string{"PATH=/bin",
+		"DELAYED_JOB_A=3",
+		"DELAYED_JOB_C=env",
+		"DELAYED_JOB_D_C=env2",
+		"DELAYED_JOB_MAIL_SMTP_SERVER=a.com:25",
+		"DELAYED_JOB_UNKNOWN=1"})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if 2 != *a {
+		t.Error("flag in the command line should not be overridden, actual is", *a)
+	}
+	if "env" != *c || "env2" != *dc || "a.com:25" != *smtp {
+		t.Error("flags are unexcepted,", *c, *dc, *smtp)
+	}
+
+	// the environment variables override the config file.
+	if e = loadConfig("config_test.txt", &flagSet, false); nil != e {
+		t.Error(e)
+		return
+	}
+	if "env" != *c || "env2" != *dc {
+		t.Error("config file should not override the environment variables,", *c, *dc)
+	}
+
+	if e = loadEnvironment(&flagSet, []string{"DELAYED_JOB_C=1", "DELAYED_JOB_CONFIG_STRICT=true", "DELAYED_JOB_UNKNOWN=1"}); nil == e {
+		t.Error("unknown environment variable should be failed in strict mode")
+	}
+
+	var intSet flag.FlagSet
+	intSet.Int("a", -1, "for test")
+	if e = loadEnvironment(&intSet, []string{"DELAYED_JOB_A=abc"}); nil == e {
+		t.Error("mistyped environment variable should be failed")
+	}
+}
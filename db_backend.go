@@ -8,6 +8,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
@@ -40,8 +41,7 @@ var (
 	is_test_for_lock = false
 	test_ch_for_lock = make(chan int)
 
-	select_sql_string = ""
-	fields_sql_string = " id, priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, failed_at, locked_by, created_at, updated_at "
+	fields_sql_string = " id, priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, failed_at, locked_by, created_at, updated_at, expires_at, progress, progress_message "
 )
 
 func preprocessArgs(args interface{}) interface{} {
@@ -79,18 +79,14 @@ func DbType(drv string) int {
 }
 func initDB() {
 	flag.Set("db_type", fmt.Sprint(DbType(*db_drv)))
-	createSQL()
-}
-
-func createSQL() {
-	select_sql_string = "SELECT " + fields_sql_string + " FROM " + *table_name + " "
 }
 
+// Deprecated: use Options.Table instead.
 func SetTable(table_name string) {
 	flag.Set("db_table", table_name)
-	createSQL()
 }
 
+// Deprecated: use Options.DbDrv and Options.DbURL instead.
 func SetDbUrl(drv, url string) {
 	flag.Set("db_url", url)
 	flag.Set("db_drv", drv)
@@ -186,19 +182,76 @@ type dbBackend struct {
 	dbType          int
 	db              *sql.DB
 	isNumericParams bool
+
+	table      string
+	select_sql string
+
+	lifecycle *lifecycle
+	logger    *slog.Logger
+
+	// the priority aging of the listing, it is the same as the worker which
+	// owns the backend, so that the listing is ordered as the reservation.
+	priority_aging_rate  time.Duration
+	priority_aging_floor int
+
+	server_time bool          // use the clock of the database server
+	result_ttl  time.Duration // the lifetime of the results
+	bulk_secret string        // the secret of the confirmation token of the bulk actions
+}
+
+func (self *dbBackend) log() *slog.Logger {
+	if nil == self.logger {
+		return defaultLogger()
+	}
+	return self.logger
 }
 
 func newBackend(drvName, url string, ctx map[string]interface{}) (*dbBackend, error) {
+	lc, e := newLifecycle(splitNames(*default_middlewares), splitNames(*default_hooks))
+	if nil != e {
+		return nil, e
+	}
+
+	backend, e := newBackendWithTable(drvName, url, *table_name, *db_type, ctx)
+	if nil != e {
+		return nil, e
+	}
+	backend.lifecycle = lc
+	return backend, nil
+}
+
+func newBackendWithTable(drvName, url, table string, dbType int, ctx map[string]interface{}) (*dbBackend, error) {
 	drv := drvName
 	if strings.HasPrefix(drvName, "odbc_with_") {
 		drv = "odbc"
 	}
+	if AUTO == dbType {
+		dbType = DbType(drvName)
+	}
 
 	db, e := sql.Open(drv, url)
 	if nil != e {
 		return nil, e
 	}
-	return &dbBackend{ctx: ctx, drv: drv, db: db, dbType: *db_type, isNumericParams: IsNumericParams(drvName)}, nil
+	backend := &dbBackend{ctx: ctx,
+		drv:             drv,
+		db:              db,
+		dbType:          dbType,
+		isNumericParams: IsNumericParams(drvName),
+		table:           table,
+		select_sql:      "SELECT " + fields_sql_string + " FROM " + table + " ",
+
+		priority_aging_rate:  *default_priority_aging_rate,
+		priority_aging_floor: *default_priority_aging_floor,
+
+		server_time: *db_server_time,
+		result_ttl:  *result_ttl}
+	if nil != ctx {
+		// the handlers which enqueue the jobs (such as multiplexed) are
+		// built with the ctx, also when they are validated by the console.
+		ctx["backend"] = backend
+	}
+	return backend, nil
 }
 
 func (self *dbBackend) Close() error {
@@ -223,13 +276,25 @@ func (self *dbBackend) enqueue(priority, repeat_count int, repeat_interval strin
 func (self *dbBackend) clearLocks(worker_name string) error {
 	var e error
 	if self.isNumericParams {
-		_, e = self.db.Exec("UPDATE "+*table_name+" SET locked_by = NULL, locked_at = NULL WHERE locked_by = $1", worker_name)
+		_, e = self.db.Exec("UPDATE "+self.table+" SET locked_by = NULL, locked_at = NULL WHERE locked_by = $1", worker_name)
 	} else {
-		_, e = self.db.Exec("UPDATE "+*table_name+" SET locked_by = NULL, locked_at = NULL WHERE locked_by = ?", worker_name)
+		_, e = self.db.Exec("UPDATE "+self.table+" SET locked_by = NULL, locked_at = NULL WHERE locked_by = ?", worker_name)
 	}
 	return i18n(self.dbType, self.drv, e)
 }
 
+// scanWith appends the extra columns after the fields of job.
+type scanWith struct {
+	row interface {
+		Scan(dest ...interface{}) error
+	}
+	extra []interface{}
+}
+
+func (self scanWith) Scan(dest ...interface{}) error {
+	return self.row.Scan(append(dest, self.extra...)...)
+}
+
 func (self *dbBackend) readJobFromRow(row interface {
 	Scan(dest ...interface{}) error
 }) (*Job, error) {
@@ -245,6 +310,9 @@ func (self *dbBackend) readJobFromRow(row interface {
 	var locked_by sql.NullString
 	var created_at NullTime
 	var updated_at NullTime
+	var expires_at NullTime
+	var progress sql.NullInt64
+	var progress_message sql.NullString
 
 	e := row.Scan(
 		&job.id,
@@ -262,7 +330,10 @@ func (self *dbBackend) readJobFromRow(row interface {
 		&failed_at,
 		&locked_by,
 		&created_at,
-		&updated_at)
+		&updated_at,
+		&expires_at,
+		&progress,
+		&progress_message)
 	if nil != e {
 		return nil, errors.New("scan job failed from the database, " + i18nString(self.dbType, self.drv, e))
 	}
@@ -311,26 +382,25 @@ func (self *dbBackend) readJobFromRow(row interface {
 		job.updated_at = updated_at.Time
 	}
 
-	job.backend = self
-	return job, nil
-}
+	if expires_at.Valid {
+		job.expires_at = expires_at.Time
+	}
 
-func (self *dbBackend) reserve(w *worker) (*Job, error) {
-	var buffer bytes.Buffer
+	if progress.Valid {
+		job.progress = int(progress.Int64)
+	}
 
-	//buffer.WriteString("SELECT id, priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, failed_at, locked_by, created_at, updated_at FROM "+ *table_name+"")
-	//buffer.WriteString(select_sql_string)
-	if self.isNumericParams {
-		if self.dbType == POSTGRESQL {
-			buffer.WriteString(" WHERE ((run_at IS NULL OR run_at <= $3) AND (locked_at IS NULL OR locked_at < $4) OR locked_by = $5) AND failed_at IS NULL")
-		} else {
-			buffer.WriteString(" WHERE ((run_at IS NULL OR run_at <= $1) AND (locked_at IS NULL OR locked_at < $2) OR locked_by = $3) AND failed_at IS NULL")
-		}
-	} else {
-		buffer.WriteString(" WHERE ((run_at IS NULL OR run_at <= ?) AND (locked_at IS NULL OR locked_at < ?) OR locked_by = ?) AND failed_at IS NULL")
+	if progress_message.Valid {
+		job.progress_message = progress_message.String
 	}
 
-	// scope to filter to the single next eligible job
+	job.backend = self
+	return job, nil
+}
+
+// writeWorkerScope appends the conditions of priority range and queues of the
+// worker to the where clause.
+func (self *dbBackend) writeWorkerScope(buffer *bytes.Buffer, w *worker) {
 	if -1 != w.min_priority {
 		buffer.WriteString(" AND priority >= ")
 		buffer.WriteString(strconv.FormatInt(int64(w.min_priority), 10))
@@ -362,17 +432,66 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 			buffer.WriteString(")")
 		}
 	}
-	buffer.WriteString(" ORDER BY priority ASC, run_at ASC")
 
-	now := self.db_time_now()
+	buffer.WriteString(self.pausedQueuesSQL())
+}
+
+func (self *dbBackend) reserve(w *worker) (*Job, error) {
+	var now time.Time
+	if !self.server_time {
+		now = self.db_time_now()
+	}
+
+	// readyScope returns the conditions of the jobs which are ready to run.
+	readyScope := func(args *sqlArguments) string {
+		var buffer bytes.Buffer
+		now_sql := self.nowSQL(args, now)
+		buffer.WriteString(" WHERE ((run_at IS NULL OR run_at <= ")
+		buffer.WriteString(now_sql)
+		buffer.WriteString(") AND (locked_at IS NULL OR locked_at < ")
+		buffer.WriteString(self.lockExpiredSQL(args, now, w.max_run_time))
+		buffer.WriteString(") OR locked_by = ")
+		buffer.WriteString(args.add(w.name))
+		buffer.WriteString(") AND failed_at IS NULL AND (expires_at IS NULL OR expires_at > ")
+		if args.isNumeric || self.server_time {
+			buffer.WriteString(now_sql)
+		} else {
+			buffer.WriteString(args.add(now))
+		}
+		buffer.WriteString(")")
+
+		// scope to filter to the single next eligible job
+		self.writeWorkerScope(&buffer, w)
+
+		if w.priority_aging_rate > 0 {
+			order_by := effectivePrioritySQL(self.dbType, now_sql, w.priority_aging_rate, w.priority_aging_floor)
+			if !args.isNumeric && !self.server_time {
+				// every placeholder needs its own argument
+				for i := strings.Count(order_by, "?"); i > 0; i-- {
+					args.add(now)
+				}
+			}
+
+			buffer.WriteString(" ORDER BY ")
+			buffer.WriteString(order_by)
+			buffer.WriteString(" ASC, priority ASC, run_at ASC")
+		} else {
+			buffer.WriteString(" ORDER BY priority ASC, run_at ASC")
+		}
+		return buffer.String()
+	}
 
 	// Optimizations for faster lookups on some common databases
 	switch self.dbType {
 	case POSTGRESQL:
-		sql_str := "UPDATE " + *table_name + " SET locked_at = $1, locked_by = $2 WHERE id in (SELECT id FROM " + *table_name +
-			buffer.String() + " LIMIT 1) RETURNING " + fields_sql_string
-		// fmt.Println(sql_str, now, w.name, now, now.Truncate(w.max_run_time), w.name)
-		rows, e := self.db.Query(sql_str, now, w.name, now, now.Truncate(w.max_run_time), w.name)
+		args := &sqlArguments{isNumeric: self.isNumericParams}
+		// the subquery in RETURNING reads the snapshot before the update, so it
+		// returns the previous owner of the lock.
+		sql_str := "UPDATE " + self.table + " SET locked_at = " + self.nowSQL(args, now) + ", locked_by = " + args.add(w.name) +
+			" WHERE id in (SELECT id FROM " + self.table + readyScope(args) + " LIMIT 1) RETURNING " + fields_sql_string +
+			", (SELECT prev.locked_by FROM " + self.table + " prev WHERE prev.id = " + self.table + ".id)"
+		// fmt.Println(sql_str, args.values)
+		rows, e := self.db.Query(sql_str, args.values...)
 		if nil != e {
 			if sql.ErrNoRows == e {
 				return nil, nil
@@ -382,12 +501,19 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 		defer rows.Close()
 
 		for rows.Next() {
-			return self.readJobFromRow(rows)
+			var prev_locked_by sql.NullString
+			job, e := self.readJobFromRow(scanWith{row: rows, extra: []interface{}{&prev_locked_by}})
+			if nil == e {
+				observeLockSteal(w, prev_locked_by.String)
+			}
+			return job, e
 		}
 		return nil, nil
 	default:
-		// fmt.Println(buffer.String(), ",", now, now.Truncate(w.max_run_time), w.name)
-		rows, e := self.db.Query(select_sql_string+buffer.String(), now, now.Truncate(w.max_run_time), w.name)
+		args := &sqlArguments{isNumeric: self.isNumericParams}
+		sql_str := self.select_sql + readyScope(args)
+		// fmt.Println(sql_str, args.values)
+		rows, e := self.db.Query(sql_str, args.values...)
 		if nil != e {
 			if sql.ErrNoRows == e {
 				return nil, nil
@@ -407,14 +533,17 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 				<-test_ch_for_lock
 			}
 
+			lock_args := &sqlArguments{isNumeric: self.isNumericParams}
+			lock_sql := "UPDATE " + self.table + " SET locked_at = " + self.nowSQL(lock_args, now) +
+				", locked_by = " + lock_args.add(w.name) +
+				" WHERE id = " + lock_args.add(job.id) +
+				" AND (locked_at IS NULL OR locked_at < " + self.lockExpiredSQL(lock_args, now, w.max_run_time) +
+				" OR locked_by = " + lock_args.add(w.name) + ") AND failed_at IS NULL"
+
 			var c int64
 			var result sql.Result
-			if self.isNumericParams {
-				result, e = self.db.Exec("UPDATE "+*table_name+" SET locked_at = $1, locked_by = $2 WHERE id = $3 AND (locked_at IS NULL OR locked_at < $4 OR locked_by = $5) AND failed_at IS NULL", now, w.name, job.id, now.Truncate(w.max_run_time), w.name)
-			} else {
-				result, e = self.db.Exec("UPDATE "+*table_name+" SET locked_at = ?, locked_by = ? WHERE id = ? AND (locked_at IS NULL OR locked_at < ? OR locked_by = ?) AND failed_at IS NULL", now, w.name, job.id, now.Truncate(w.max_run_time), w.name)
-				// fmt.Println("UPDATE "+*table_name+" SET locked_at = ?, locked_by = ? WHERE id = ? AND (locked_at IS NULL OR locked_at < ? OR locked_by = ?) AND failed_at IS NULL", now, w.name, job.id, now.Truncate(w.max_run_time), w.name)
-			}
+			result, e = self.db.Exec(lock_sql, lock_args.values...)
+			// fmt.Println(lock_sql, lock_args.values)
 			if nil != e {
 				return nil, errors.New("lock job failed from the database, " + i18nString(self.dbType, self.drv, e))
 			}
@@ -425,6 +554,7 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 			}
 
 			if c > 0 {
+				observeLockSteal(w, job.locked_by)
 				return job, nil
 			}
 		}
@@ -452,7 +582,7 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 	//   // Note: active_record would attempt to generate UPDATE...LIMIT like sql for postgres if we use a .limit() filter, but it would not use
 	//   // 'FOR UPDATE' and we would have many locking conflicts
 	//   subquery_sql      = ready_scope.limit(1).lock(true).select('id').to_sql
-	//   reserved          = self.find_by_sql(["UPDATE "+ *table_name+" SET locked_at = ?, locked_by = ? WHERE id IN (select id from "+ *table_name+" " + buffer.+") RETURNING *", now, worker.name])
+	//   reserved          = self.find_by_sql(["UPDATE "+ self.table+" SET locked_at = ?, locked_by = ? WHERE id IN (select id from "+ self.table+" " + buffer.+") RETURNING *", now, worker.name])
 	//   reserved[0]
 	// case "MySQL", "Mysql2":
 	//   // This works on MySQL and possibly some other DBs that support UPDATE...LIMIT. It uses separate queries to lock and return the job
@@ -465,7 +595,7 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 	//   // select("id") doesn't generate a subquery, so force a subquery
 	//   subquery_sql = "SELECT id FROM (//{subsubquery_sql}) AS x"
 	//   quoted_table_name = self.connection.quote_table_name(self.table_name)
-	//   sql = ["UPDATE "+ *table_name+" SET locked_at = ?, locked_by = ? WHERE id IN (//{subquery_sql})", now, worker.name]
+	//   sql = ["UPDATE "+ self.table+" SET locked_at = ?, locked_by = ? WHERE id IN (//{subquery_sql})", now, worker.name]
 	//   count = self.connection.execute(sanitize_sql(sql))
 	//   return nil if count == 0
 	//   // MSSQL JDBC doesn't support OUTPUT INSERTED.* for returning a result set, so query locked row
@@ -479,22 +609,70 @@ func (self *dbBackend) reserve(w *worker) (*Job, error) {
 	// }
 }
 
-// Get the current time (GMT or local depending on DB)
-// Note: This does not ping the DB to get the time, so all your clients
-// must have syncronized clocks.
-func (self *dbBackend) db_time_now() time.Time {
-	switch *db_type {
-	case MSSQL:
-		return time.Now() //.UTC()
-	case POSTGRESQL:
-		return time.Now()
+// nextRunAt returns the earliest run_at of the jobs which are waiting for the
+// worker, it is zero if there is no such job.
+func (self *dbBackend) nextRunAt(w *worker) (time.Time, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("SELECT MIN(run_at) FROM ")
+	buffer.WriteString(self.table)
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	buffer.WriteString(" WHERE run_at > ")
+	if self.server_time {
+		buffer.WriteString(currentTimeSQL(self.dbType))
+	} else {
+		buffer.WriteString(args.add(self.db_time_now()))
+	}
+	buffer.WriteString(" AND locked_at IS NULL AND failed_at IS NULL")
+	self.writeWorkerScope(&buffer, w)
+
+	var run_at NullTime
+	e := self.db.QueryRow(buffer.String(), args.values...).Scan(&run_at)
+	if nil != e {
+		if sql.ErrNoRows == e {
+			return time.Time{}, nil
+		}
+		return time.Time{}, errors.New("query next run_at failed from the database, " + i18nString(self.dbType, self.drv, e))
 	}
-	return time.Now().UTC()
+	if !run_at.Valid {
+		return time.Time{}, nil
+	}
+	return self.dbTime(run_at.Time), nil
 }
 
-func (self *dbBackend) create(jobs ...*Job) (e error) {
-	now := self.db_time_now()
+func (self *dbBackend) create(jobs ...*Job) error {
+	e := self.transaction(func(tx *sql.Tx) error {
+		return self.insertJobs(tx, jobs)
+	})
+	if nil != e {
+		return e
+	}
+	self.created(jobs)
+	return nil
+}
+
+// changeWith applies the change of a job and inserts the jobs (such as the
+// callbacks of the change) in a transaction, so that the jobs are created only
+// if the change is applied.
+func (self *dbBackend) changeWith(jobs []*Job, change func(db sqlExecutor) error) error {
+	if 0 == len(jobs) {
+		return change(self.db)
+	}
 
+	e := self.transaction(func(tx *sql.Tx) error {
+		if e := change(tx); nil != e {
+			return e
+		}
+		return self.insertJobs(tx, jobs)
+	})
+	if nil != e {
+		return e
+	}
+	self.created(jobs)
+	return nil
+}
+
+// transaction runs fn in a transaction, it is committed if fn returns nil.
+func (self *dbBackend) transaction(fn func(tx *sql.Tx) error) (e error) {
 	tx, e := self.db.Begin()
 	if nil != e {
 		return errors.New("open transaction failed, " + i18nString(self.dbType, self.drv, e))
@@ -509,9 +687,26 @@ func (self *dbBackend) create(jobs ...*Job) (e error) {
 		}
 	}()
 
+	if e = fn(tx); nil != e {
+		return e
+	}
+
+	isCommited = true
+	e = tx.Commit()
+	if nil != e {
+		return errors.New("commit transaction failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// insertJobs inserts the jobs in the transaction, the job which has the same
+// handler_id is replaced.
+func (self *dbBackend) insertJobs(tx sqlExecutor, jobs []*Job) error {
+	now := self.db_time_now()
+	var e error
 	for _, job := range jobs {
 		if job.run_at.IsZero() {
-			job.run_at = now.Truncate(10 * time.Second)
+			job.run_at = now
 		}
 
 		// var queue sql.NullString
@@ -522,64 +717,84 @@ func (self *dbBackend) create(jobs ...*Job) (e error) {
 		// 	queue.String = job.queue
 		// }
 
+		// last_error and failed_at are set only if the job is imported.
+		last_error := sql.NullString{String: job.last_error, Valid: 0 != len(job.last_error)}
+		failed_at := NullTime{Time: job.failed_at, Valid: !job.failed_at.IsZero()}
+
 		//1         2         3      4        5           NULL        6       NULL       NULL       NULL       7           8
 		//priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at
 		switch self.dbType {
 		case ORACLE:
-			_, e = tx.Exec("DELETE FROM "+*table_name+" WHERE handler_id = ?", job.handler_id)
+			_, e = tx.Exec("DELETE FROM "+self.table+" WHERE handler_id = ?", job.handler_id)
 			if nil != e {
 				break
 			}
 
-			// _, e = tx.Exec("INSERT INTO "+*table_name+"(priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (:1, :2, :3, :4, :5, NULL, :6, NULL, NULL, NULL, :7, :8)",
+			// _, e = tx.Exec("INSERT INTO "+self.table+"(priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (:1, :2, :3, :4, :5, NULL, :6, NULL, NULL, NULL, :7, :8)",
 			// 	job.priority, job.attempts, job.queue, job.handler, job.handler_id, job.run_at, now, now)
-			// fmt.Println("INSERT INTO "+*table_name+"(priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (:1, :2, :3, :4, :5, NULL, :6, NULL, NULL, NULL, :7, :8)",
+			// fmt.Println("INSERT INTO "+self.table+"(priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (:1, :2, :3, :4, :5, NULL, :6, NULL, NULL, NULL, :7, :8)",
 			// 	job.priority, job.attempts, job.queue, job.handler, job.handler_id, job.run_at, now, now)
 			now_str := now.Format("2006-01-02 15:04:05")
-			_, e = tx.Exec(fmt.Sprintf("INSERT INTO "+*table_name+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, run_at, created_at, updated_at) VALUES (%d, %d, '%d', %d, %d,'%s', :1, '%s', TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'))",
-				job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler_id, job.run_at.Format("2006-01-02 15:04:05"), now_str, now_str), job.handler)
-			//fmt.Println(fmt.Sprintf("INSERT INTO "+*table_name+"(priority, attempts, queue, handler, handler_id, run_at, created_at, updated_at) VALUES (%d, %d, '%s', :1, '%s', TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'))",
+			expires_at_str := "NULL"
+			if !job.expires_at.IsZero() {
+				expires_at_str = "TO_TIMESTAMP('" + job.expires_at.Format("2006-01-02 15:04:05.000") + "', 'YYYY-MM-DD HH24:MI:SS.FF3')"
+			}
+			failed_at_str := "NULL"
+			if !job.failed_at.IsZero() {
+				failed_at_str = "TO_TIMESTAMP('" + job.failed_at.Format("2006-01-02 15:04:05.000") + "', 'YYYY-MM-DD HH24:MI:SS.FF3')"
+			}
+			_, e = tx.Exec(fmt.Sprintf("INSERT INTO "+self.table+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, failed_at, created_at, updated_at, expires_at) VALUES (%d, %d, '%d', %d, %d,'%s', :1, '%s', :2, TO_TIMESTAMP('%s', 'YYYY-MM-DD HH24:MI:SS.FF3'), %s, TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), %s)",
+				job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler_id, job.run_at.Format("2006-01-02 15:04:05.000"), failed_at_str, now_str, now_str, expires_at_str), job.handler, last_error)
+			//fmt.Println(fmt.Sprintf("INSERT INTO "+self.table+"(priority, attempts, queue, handler, handler_id, run_at, created_at, updated_at) VALUES (%d, %d, '%s', :1, '%s', TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'), TO_DATE('%s', 'YYYY-MM-DD HH24:MI:SS'))",
 			//	job.priority, job.attempts, job.queue, job.handler_id, job.run_at.Format("2006-01-02 15:04:05"), now_str, now_str), job.handler)
 		case POSTGRESQL:
-			_, e = tx.Exec("DELETE FROM "+*table_name+" WHERE handler_id = $1", job.handler_id)
+			_, e = tx.Exec("DELETE FROM "+self.table+" WHERE handler_id = $1", job.handler_id)
 			if nil != e {
 				break
 			}
 
-			_, e = tx.Exec("INSERT INTO "+*table_name+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL, $9, NULL, NULL, NULL, $10, $11)",
-				job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler, job.handler_id, job.run_at, now, now)
-			// fmt.Println("INSERT INTO "+*table_name+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL, $9, NULL, NULL, NULL, $10, $11)",
+			_, e = tx.Exec("INSERT INTO "+self.table+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULL, NULL, $11, $12, $13, $14)",
+				job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler, job.handler_id, last_error, job.run_at, failed_at, now, now, NullTime{Time: job.expires_at, Valid: !job.expires_at.IsZero()})
+			// fmt.Println("INSERT INTO "+self.table+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL, $9, NULL, NULL, NULL, $10, $11)",
 			//	job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler, job.handler_id, job.run_at, now, now)
 		default:
-			_, e = tx.Exec("DELETE FROM "+*table_name+" WHERE handler_id = ?", job.handler_id)
+			_, e = tx.Exec("DELETE FROM "+self.table+" WHERE handler_id = ?", job.handler_id)
 			if nil != e {
 				break
 			}
 
-			_, e = tx.Exec("INSERT INTO "+*table_name+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL, ?, NULL, NULL, NULL, ?, ?)",
-				job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler, job.handler_id, job.run_at, now, now)
-			//fmt.Println("INSERT INTO "+*table_name+"(priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, NULL, ?, NULL, NULL, NULL, ?, ?)",
+			_, e = tx.Exec("INSERT INTO "+self.table+"(priority, repeat_count, repeat_interval, attempts, max_attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, NULL, ?, ?, ?, ?)",
+				job.priority, job.repeat_count, job.repeat_interval, job.attempts, job.max_attempts, job.queue, job.handler, job.handler_id, last_error, job.run_at, failed_at, now, now, NullTime{Time: job.expires_at, Valid: !job.expires_at.IsZero()})
+			//fmt.Println("INSERT INTO "+self.table+"(priority, attempts, queue, handler, handler_id, last_error, run_at, locked_at, locked_by, failed_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, NULL, ?, NULL, NULL, NULL, ?, ?)",
 			//	job.priority, job.attempts, job.queue, job.handler, job.handler_id, job.run_at, now, now)
 		}
 		if nil != e {
 			return i18n(self.dbType, self.drv, e)
 		}
 	}
+	return nil
+}
 
-	isCommited = true
-	e = tx.Commit()
-	if nil != e {
-		return errors.New("commit transaction failed, " + i18nString(self.dbType, self.drv, e))
+// created notifies the jobs which are inserted and committed.
+func (self *dbBackend) created(jobs []*Job) {
+	for _, job := range jobs {
+		info := job.info()
+		metric_jobs_enqueued.inc(info.Queue, info.Type)
+		publishJobEvent(JobEnqueued, info, nil)
+		self.lifecycle.fire(EventEnqueue, info, nil)
 	}
-	return nil
 }
 
 func (self *dbBackend) update(id int64, attributes map[string]interface{}) error {
+	return self.updateWith(self.db, id, attributes)
+}
+
+func (self *dbBackend) updateWith(db sqlExecutor, id int64, attributes map[string]interface{}) error {
 	var buffer bytes.Buffer
 	params := make([]interface{}, 0, len(attributes))
 
 	buffer.WriteString("UPDATE ")
-	buffer.WriteString(*table_name)
+	buffer.WriteString(self.table)
 	buffer.WriteString(" SET ")
 	is_first := true
 
@@ -619,30 +834,41 @@ func (self *dbBackend) update(id int64, attributes map[string]interface{}) error
 		buffer.WriteString(", ")
 	}
 
+	if self.server_time {
+		buffer.WriteString("updated_at = ")
+		buffer.WriteString(currentTimeSQL(self.dbType))
+	}
+
 	switch self.dbType {
 	case ORACLE:
-		buffer.WriteString("updated_at = :")
-		buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
-		params = append(params, self.db_time_now())
+		if !self.server_time {
+			buffer.WriteString("updated_at = :")
+			buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
+			params = append(params, self.db_time_now())
+		}
 		buffer.WriteString(" WHERE id = :")
 		buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
 		params = append(params, id)
 	case POSTGRESQL:
-		buffer.WriteString("updated_at = $")
-		buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
-		params = append(params, self.db_time_now())
+		if !self.server_time {
+			buffer.WriteString("updated_at = $")
+			buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
+			params = append(params, self.db_time_now())
+		}
 		buffer.WriteString(" WHERE id = $")
 		buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
 		params = append(params, id)
 	default:
-		buffer.WriteString("updated_at = ?")
-		params = append(params, self.db_time_now())
+		if !self.server_time {
+			buffer.WriteString("updated_at = ?")
+			params = append(params, self.db_time_now())
+		}
 		buffer.WriteString(" WHERE id = ?")
 		params = append(params, id)
 	}
 
 	//fmt.Println(buffer.String(), "\r\n", params)
-	_, e := self.db.Exec(buffer.String(), params...)
+	_, e := db.Exec(buffer.String(), params...)
 	if nil != e && sql.ErrNoRows != e {
 		return i18n(self.dbType, self.drv, e)
 	}
@@ -650,11 +876,15 @@ func (self *dbBackend) update(id int64, attributes map[string]interface{}) error
 }
 
 func (self *dbBackend) destroy(id int64) error {
+	return self.destroyWith(self.db, id)
+}
+
+func (self *dbBackend) destroyWith(db sqlExecutor, id int64) error {
 	var e error
 	if self.isNumericParams {
-		_, e = self.db.Exec("DELETE FROM "+*table_name+" WHERE id = $1", id)
+		_, e = db.Exec("DELETE FROM "+self.table+" WHERE id = $1", id)
 	} else {
-		_, e = self.db.Exec("DELETE FROM "+*table_name+" WHERE id = ?", id)
+		_, e = db.Exec("DELETE FROM "+self.table+" WHERE id = ?", id)
 	}
 
 	if nil != e && sql.ErrNoRows != e {
@@ -796,7 +1026,7 @@ func (self *dbBackend) count(params map[string]interface{}) (int64, error) {
 	}
 
 	count := int64(0)
-	e = self.db.QueryRow("SELECT count(*) FROM "+*table_name+query, arguments...).Scan(&count)
+	e = self.db.QueryRow("SELECT count(*) FROM "+self.table+query, arguments...).Scan(&count)
 	if nil != e {
 		if sql.ErrNoRows == e {
 			return 0, nil
@@ -806,14 +1036,33 @@ func (self *dbBackend) count(params map[string]interface{}) (int64, error) {
 	return count, nil
 }
 
+// counts returns the count of all, failed, queued and active jobs.
+func (self *dbBackend) counts() (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, scope := range []struct {
+		name   string
+		params map[string]interface{}
+	}{{name: "all"},
+		{name: "failed", params: map[string]interface{}{"@failed_at": "[notnull]"}},
+		{name: "queued", params: map[string]interface{}{"@failed_at": nil, "locked_by": nil}},
+		{name: "active", params: map[string]interface{}{"@failed_at": nil, "locked_by": "[notnull]"}}} {
+		count, e := self.count(scope.params)
+		if nil != e {
+			return nil, e
+		}
+		counts[scope.name] = count
+	}
+	return counts, nil
+}
+
 func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interface{}, error) {
 	query, arguments, e := buildSQL(self.dbType, params)
 	if nil != e {
 		return nil, i18n(self.dbType, self.drv, e)
 	}
 
-	//// fmt.Println(select_sql_string + query)
-	rows, e := self.db.Query(select_sql_string+query, arguments...)
+	//// fmt.Println(self.select_sql + query)
+	rows, e := self.db.Query(self.select_sql+query, arguments...)
 	if nil != e {
 		if sql.ErrNoRows == e {
 			return nil, nil
@@ -821,9 +1070,33 @@ func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interf
 		return nil, i18n(self.dbType, self.drv, e)
 	}
 	defer rows.Close()
+	return self.scanJobs(rows, 0)
+}
+
+// search returns the jobs matching the filter of the bulk actions, the jobs
+// are ordered by id and at most limit jobs are returned if limit > 0.
+func (self *dbBackend) search(filter map[string]interface{}, limit int) ([]map[string]interface{}, error) {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	where, e := bulkWhere(args, filter)
+	if nil != e {
+		return nil, e
+	}
+
+	rows, e := self.db.Query(self.select_sql+where+" ORDER BY id", args.values...)
+	if nil != e {
+		return nil, i18n(self.dbType, self.drv, e)
+	}
+	defer rows.Close()
+
+	return self.scanJobs(rows, limit)
+}
 
+// scanJobs reads the jobs from the rows of select_sql, at most limit jobs are
+// read if limit > 0.
+func (self *dbBackend) scanJobs(rows *sql.Rows, limit int) ([]map[string]interface{}, error) {
+	now := self.db_time_now()
 	var results []map[string]interface{}
-	for rows.Next() {
+	for (limit <= 0 || len(results) < limit) && rows.Next() {
 		var id int64
 		var priority int
 		var repeat_count int
@@ -841,8 +1114,11 @@ func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interf
 		var locked_at NullTime
 		var failed_at NullTime
 		var locked_by sql.NullString
+		var expires_at NullTime
+		var progress sql.NullInt64
+		var progress_message sql.NullString
 
-		e = rows.Scan(
+		e := rows.Scan(
 			&id,
 			&priority,
 			&repeat_count,
@@ -858,7 +1134,10 @@ func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interf
 			&failed_at,
 			&locked_by,
 			&created_at,
-			&updated_at)
+			&updated_at,
+			&expires_at,
+			&progress,
+			&progress_message)
 		if nil != e {
 			return nil, i18n(self.dbType, self.drv, e)
 		}
@@ -898,6 +1177,9 @@ func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interf
 
 		if run_at.Valid {
 			result["run_at"] = run_at.Time
+			result["effective_priority"] = effectivePriority(priority, run_at.Time, now, self.priority_aging_rate, self.priority_aging_floor)
+		} else {
+			result["effective_priority"] = priority
 		}
 
 		if locked_at.Valid {
@@ -915,11 +1197,23 @@ func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interf
 			result["locked_by"] = locked_by.String
 		}
 
+		if expires_at.Valid {
+			result["expires_at"] = expires_at.Time
+			result["expired"] = !now.Before(expires_at.Time)
+		}
+
+		if progress.Valid {
+			result["has_progress"] = true
+			result["progress"] = progress.Int64
+			if progress_message.Valid {
+				result["progress_message"] = progress_message.String
+			}
+		}
+
 		results = append(results, result)
 	}
 
-	e = rows.Err()
-	if nil != e {
+	if e := rows.Err(); nil != e {
 		return nil, i18n(self.dbType, self.drv, e)
 	}
 	return results, nil
@@ -941,6 +1235,87 @@ func (self *dbBackend) where(params map[string]interface{}) ([]map[string]interf
 // 	return self.where("failed_at IS NULL AND locked_by IS NULL")
 // }
 
+// expiredJobs returns the jobs which are past their deadline and are not
+// locked by other workers.
+func (self *dbBackend) expiredJobs(w *worker) ([]*Job, error) {
+	var now time.Time
+	if !self.server_time {
+		now = self.db_time_now()
+	}
+
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	rows, e := self.db.Query(self.select_sql+" WHERE expires_at IS NOT NULL AND expires_at <= "+self.nowSQL(args, now)+
+		" AND failed_at IS NULL AND (locked_at IS NULL OR locked_at < "+self.lockExpiredSQL(args, now, w.max_run_time)+
+		" OR locked_by = "+args.add(w.name)+")", args.values...)
+	if nil != e {
+		if sql.ErrNoRows == e {
+			return nil, nil
+		}
+		return nil, errors.New("execute query sql failed while fetch expired jobs from the database, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, e := self.readJobFromRow(rows)
+		if nil != e {
+			return nil, e
+		}
+		jobs = append(jobs, job)
+	}
+
+	e = rows.Err()
+	if nil != e {
+		return nil, errors.New("next job failed from the database, " + i18nString(self.dbType, self.drv, e))
+	}
+	return jobs, nil
+}
+
+// expire marks the job as failed because it is past its deadline, it returns
+// false if the job has been locked or expired by other worker.
+func (self *dbBackend) expire(w *worker, job *Job, err string, callbacks ...*Job) (bool, error) {
+	now := self.db_time_now()
+
+	e := self.changeWith(callbacks, func(db sqlExecutor) error {
+		args := &sqlArguments{isNumeric: self.isNumericParams}
+		result, e := db.Exec("UPDATE "+self.table+" SET failed_at = "+self.nowSQL(args, now)+
+			", last_error = "+args.add(err)+
+			", locked_at = NULL, locked_by = NULL, updated_at = "+self.nowSQL(args, now)+
+			" WHERE id = "+args.add(job.id)+
+			" AND failed_at IS NULL AND (locked_at IS NULL OR locked_at < "+self.lockExpiredSQL(args, now, w.max_run_time)+
+			" OR locked_by = "+args.add(w.name)+")", args.values...)
+		if nil != e {
+			return errors.New("expire job failed from the database, " + i18nString(self.dbType, self.drv, e))
+		}
+
+		c, e := result.RowsAffected()
+		if nil != e {
+			return errors.New("expire job failed from the database, " + i18nString(self.dbType, self.drv, e))
+		}
+		if 0 == c {
+			// the callbacks are rolled back.
+			return errNotExpired
+		}
+		return nil
+	})
+	if nil != e {
+		if errNotExpired == e {
+			return false, nil
+		}
+		return false, e
+	}
+
+	job.failed_at = now
+	job.last_error = err
+	job.locked_at = time.Time{}
+	job.locked_by = ""
+	return true, nil
+}
+
+// errNotExpired is returned if the job is locked by another worker or has
+// been failed.
+var errNotExpired = errors.New("job isn't expired")
+
 func (self *dbBackend) retry(id int64) error {
-	return self.update(id, map[string]interface{}{"@failed_at": nil})
+	return self.update(id, map[string]interface{}{"@failed_at": nil, "@progress": nil, "@progress_message": nil})
 }
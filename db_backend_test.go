@@ -570,3 +570,53 @@ func TestRescheduleIt(t *testing.T) {
 
 	})
 }
+
+func TestUpgradeTables(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		e := backend.enqueue(1, 0, "", 0, "aa", time.Time{}, map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		for _, script := range []string{"ALTER TABLE " + backend.table + " DROP COLUMN progress_message",
+			backend.queueTableScripts()[0]} {
+			if _, e = backend.db.Exec(script); nil != e {
+				t.Error(e)
+				return
+			}
+		}
+		if backend.tableExists(backend.table, "progress_message") {
+			t.Error("excepted progress_message is dropped, actual is exists")
+		}
+		if backend.tableExists(backend.queueTable()) {
+			t.Error("excepted queue table is dropped, actual is exists")
+		}
+
+		if e = backend.upgradeTables(); nil != e {
+			t.Error(e)
+			return
+		}
+		if !backend.tableExists(backend.table, "expires_at", "progress", "progress_message") {
+			t.Error("excepted progress_message is added, actual is not exists")
+		}
+		if !backend.tableExists(backend.queueTable()) {
+			t.Error("excepted queue table is created, actual is not exists")
+		}
+
+		// upgrading twice is harmless.
+		if e = backend.upgradeTables(); nil != e {
+			t.Error(e)
+			return
+		}
+
+		count, e := backend.count(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != count {
+			t.Error("excepted count is 1, actual is", count)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -25,7 +26,105 @@ type dbHandler struct {
 	drv    string
 	urlStr string
 
-	script string
+	script   string
+	reporter ProgressReporter
+
+	// the results of the statements, see Result.
+	results []map[string]interface{}
+}
+
+// the max count of the rows of a query which are kept in the result.
+const max_result_rows = 1000
+
+// Result implements Resulter, it is the rows of the queries and the affected
+// rows of the other statements.
+func (self *dbHandler) Result() interface{} {
+	if 0 == len(self.results) {
+		return nil
+	}
+	return map[string]interface{}{"statements": self.results}
+}
+
+// isQueryStatement returns true if the statement returns the rows.
+func isQueryStatement(statement string) bool {
+	fields := strings.Fields(statement)
+	if 0 == len(fields) {
+		return false
+	}
+	switch strings.ToUpper(strings.TrimLeft(fields[0], "(")) {
+	case "SELECT", "WITH", "SHOW", "DESC", "DESCRIBE", "EXPLAIN", "VALUES":
+		return true
+	}
+	return false
+}
+
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// execStatement executes the statement and keeps its result, the rows of the
+// query are kept at most max_result_rows.
+func (self *dbHandler) execStatement(db sqlExecutor, statement string) error {
+	if !isQueryStatement(statement) {
+		result, e := db.Exec(statement)
+		if nil != e {
+			return e
+		}
+		if affected, e := result.RowsAffected(); nil == e {
+			self.results = append(self.results, map[string]interface{}{"rows_affected": affected})
+		}
+		return nil
+	}
+
+	rows, e := db.Query(statement)
+	if nil != e {
+		return e
+	}
+	defer rows.Close()
+
+	columns, e := rows.Columns()
+	if nil != e {
+		return e
+	}
+	var values [][]interface{}
+	truncated := false
+	for rows.Next() {
+		if len(values) >= max_result_rows {
+			truncated = true
+			break
+		}
+		row := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if e = rows.Scan(dest...); nil != e {
+			return e
+		}
+		for i, v := range row {
+			if bs, ok := v.([]byte); ok {
+				row[i] = string(bs)
+			}
+		}
+		values = append(values, row)
+	}
+	if e = rows.Err(); nil != e {
+		return e
+	}
+
+	result := map[string]interface{}{"columns": columns, "rows": values}
+	if truncated {
+		result["truncated"] = true
+	}
+	self.results = append(self.results, result)
+	return nil
+}
+
+// SetProgressReporter implements Progresser, the progress is reported after
+// every statement if the script is executed one by one.
+func (self *dbHandler) SetProgressReporter(reporter ProgressReporter) {
+	self.reporter = reporter
 }
 
 func parseUrl(urlStr string) (map[string]string, error) {
@@ -127,7 +226,7 @@ func transformUrl(drv, urlStr string) (string, error) {
 	if nil != e {
 		return "", e
 	}
-	fmt.Println(options)
+	defaultLogger().Debug("transform url", "options", options)
 	switch drv {
 	case "postgres":
 		host, port, dbname, user, password, _, e := fetchArguments(options)
@@ -304,6 +403,44 @@ func newDbHandler(ctx, params map[string]interface{}) (Handler, error) {
 	return &dbHandler{drv: drv, urlStr: urlStr, script: script}, nil
 }
 
+// splitScript splits the script into the statements which are executed one by
+// one, it is used by mysql and oracle which don't execute multiple statements.
+func splitScript(dbType int, script string) []string {
+	var statements []string
+	scaner := bufio.NewScanner(bytes.NewBufferString(script))
+	scaner.Split(bufio.ScanLines)
+	var line string
+	for scaner.Scan() {
+		line += strings.TrimSpace(scaner.Text())
+		if strings.HasSuffix(line, ";") {
+			if ORACLE == dbType {
+				line = strings.TrimSuffix(line, ";")
+			}
+			statements = append(statements, line)
+			line = ""
+		}
+	}
+	if 0 != len(line) {
+		statements = append(statements, line)
+	}
+	return statements
+}
+
+var dsn_password_pattern = regexp.MustCompile(`(?i)\b(password|pwd)=[^ ;]*`)
+
+// Render returns the statements which would be executed, the password in the
+// url is redacted.
+func (self *dbHandler) Render() (map[string]interface{}, error) {
+	dbType := DbType(self.drv)
+	statements := []string{self.script}
+	if MYSQL == dbType || ORACLE == dbType {
+		statements = splitScript(dbType, self.script)
+	}
+	return map[string]interface{}{"drv": self.drv,
+		"url":        dsn_password_pattern.ReplaceAllString(redactString(self.urlStr), "${1}="+redacted),
+		"statements": statements}, nil
+}
+
 func (self *dbHandler) Perform() (err error) {
 	dbType := DbType(self.drv)
 	drv := self.drv
@@ -338,28 +475,15 @@ func (self *dbHandler) Perform() (err error) {
 			}
 		}()
 
-		scaner := bufio.NewScanner(bytes.NewBufferString(self.script))
-		scaner.Split(bufio.ScanLines)
-		var line string
-		for scaner.Scan() {
-			line += strings.TrimSpace(scaner.Text())
-			if strings.HasSuffix(line, ";") {
-				if ORACLE == dbType {
-					line = strings.TrimSuffix(line, ";")
-				}
-				_, e = db.Exec(line)
-				if nil != e {
-					return e
-				}
-
-				line = ""
-			}
-		}
-		if 0 != len(line) {
-			_, e = db.Exec(line)
+		statements := splitScript(dbType, self.script)
+		for idx, statement := range statements {
+			e = self.execStatement(db, statement)
 			if nil != e {
 				return i18n(dbType, self.drv, e)
 			}
+			if nil != self.reporter {
+				self.reporter.Report((idx+1)*100/len(statements), fmt.Sprintf("%d/%d statements", idx+1, len(statements)))
+			}
 		}
 
 		isCommited = true
@@ -371,7 +495,7 @@ func (self *dbHandler) Perform() (err error) {
 		return nil
 	}
 
-	_, e = db.Exec(self.script)
+	e = self.execStatement(db, self.script)
 	if nil != e {
 		return i18n(dbType, drv, e)
 	}
@@ -381,4 +505,15 @@ func (self *dbHandler) Perform() (err error) {
 func init() {
 	Handlers["db"] = newDbHandler
 	Handlers["db_command"] = newDbHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "db",
+		Description: "execute the sql script in the database",
+		Aliases:     []string{"db_command"},
+		Params: []HandlerParam{{Name: "script", Type: "string", Required: true, Template: true,
+			Description: "the sql script, the statements are executed one by one"},
+			{Name: "drv", Type: "string", Description: "the driver of the database, it is '-db_drv' if missing"},
+			{Name: "url", Type: "string", Template: true, Secret: true,
+				Description: "the url of the database, it is '-db_url' if missing"},
+			param_arguments},
+		TemplateArgs: default_template_args})
 }
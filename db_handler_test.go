@@ -345,3 +345,33 @@ func TestDbHandlerArguments(t *testing.T) {
 		assertCount(t, db, "SELECT count(*) FROM tpt_test_for_handler", 2)
 	})
 }
+
+func TestDbHandlerRender(t *testing.T) {
+	handler, e := newDbHandler(map[string]interface{}{}, map[string]interface{}{"drv": "mysql",
+		"url":    "user:pass@tcp(127.0.0.1:3306)/test",
+		"script": "INSERT INTO a VALUES(1);\nINSERT INTO a VALUES(2);"})
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	output, e := handler.(Renderer).Render()
+	if nil != e {
+		t.Fatal(e)
+	}
+	if statements := output["statements"].([]string); 2 != len(statements) || "INSERT INTO a VALUES(2);" != statements[1] {
+		t.Error("excepted 2 statements, actual is", statements)
+	}
+
+	handler, e = newDbHandler(map[string]interface{}{}, map[string]interface{}{"drv": "postgres",
+		"url":    "host=127.0.0.1 user=a password=secret dbname=b",
+		"script": "SELECT 1"})
+	if nil != e {
+		t.Fatal(e)
+	}
+	if output, e = handler.(Renderer).Render(); nil != e {
+		t.Fatal(e)
+	}
+	if url := output["url"].(string); strings.Contains(url, "secret") {
+		t.Error("excepted password is redacted, actual is", url)
+	}
+}
@@ -0,0 +1,130 @@
+package delayed_job
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var db_server_time = flag.Bool("db_server_time", false, "use the clock of the database server instead of the local clock for scheduling and locking")
+
+// sqlArguments collects the arguments of a statement and returns the
+// placeholder of each argument in the style of the driver.
+type sqlArguments struct {
+	isNumeric bool
+	values    []interface{}
+}
+
+func (self *sqlArguments) add(value interface{}) string {
+	self.values = append(self.values, value)
+	if self.isNumeric {
+		return "$" + strconv.FormatInt(int64(len(self.values)), 10)
+	}
+	return "?"
+}
+
+// currentTimeSQL returns the expression of the current time of the database.
+func currentTimeSQL(dbType int) string {
+	switch dbType {
+	case POSTGRESQL:
+		return "now()"
+	case MYSQL:
+		return "NOW(3)"
+	case MSSQL, SYBASE:
+		return "SYSDATETIME()"
+	case ORACLE:
+		return "SYSTIMESTAMP"
+	default:
+		return "CURRENT_TIMESTAMP"
+	}
+}
+
+// subtractSQL returns the expression of `expr - d` for the database.
+func subtractSQL(dbType int, expr string, d time.Duration) string {
+	seconds := strconv.FormatInt(int64(d/time.Second), 10)
+	switch dbType {
+	case POSTGRESQL:
+		return "(" + expr + " - interval '" + seconds + " seconds')"
+	case MSSQL, SYBASE:
+		return "DATEADD(second, -" + seconds + ", " + expr + ")"
+	case ORACLE:
+		return "(" + expr + " - NUMTODSINTERVAL(" + seconds + ", 'SECOND'))"
+	default:
+		return "(" + expr + " - INTERVAL " + seconds + " SECOND)"
+	}
+}
+
+// limitSQL returns the select statement which returns at most limit rows, the
+// statement must start with "SELECT ".
+func limitSQL(dbType int, query string, limit int) string {
+	n := strconv.Itoa(limit)
+	switch dbType {
+	case MSSQL, SYBASE:
+		return "SELECT TOP " + n + " " + strings.TrimPrefix(query, "SELECT ")
+	case ORACLE:
+		return "SELECT * FROM (" + query + ") WHERE ROWNUM <= " + n
+	case DB2:
+		return query + " FETCH FIRST " + n + " ROWS ONLY"
+	default:
+		return query + " LIMIT " + n
+	}
+}
+
+// nowSQL returns the expression of the current time, it is the clock of the
+// database if db_server_time is enabled, otherwise it is a parameter with the
+// local clock.
+func (self *dbBackend) nowSQL(args *sqlArguments, now time.Time) string {
+	if self.server_time {
+		return currentTimeSQL(self.dbType)
+	}
+	return args.add(now)
+}
+
+// lockExpiredSQL returns the expression of the time before which a lock is
+// considered stale.
+func (self *dbBackend) lockExpiredSQL(args *sqlArguments, now time.Time, max_run_time time.Duration) string {
+	if self.server_time {
+		return subtractSQL(self.dbType, currentTimeSQL(self.dbType), max_run_time)
+	}
+	return args.add(now.Truncate(max_run_time))
+}
+
+// location returns the time zone in which the times are stored.
+func (self *dbBackend) location() *time.Location {
+	switch self.dbType {
+	case MSSQL, POSTGRESQL:
+		return time.Local
+	}
+	return time.UTC
+}
+
+// dbTime converts the time into the time zone of the database, so the values
+// parsed from the requests are compared consistently with db_time_now.
+func (self *dbBackend) dbTime(t time.Time) time.Time {
+	if nil == self || t.IsZero() {
+		return t
+	}
+	return t.In(self.location())
+}
+
+// Get the current time (GMT or local depending on DB)
+// Note: This does not ping the DB to get the time unless db_server_time is
+// enabled, otherwise all your clients must have syncronized clocks.
+func (self *dbBackend) db_time_now() time.Time {
+	if self.server_time && nil != self.db {
+		var query string
+		switch self.dbType {
+		case ORACLE:
+			query = "SELECT " + currentTimeSQL(self.dbType) + " FROM dual"
+		default:
+			query = "SELECT " + currentTimeSQL(self.dbType)
+		}
+
+		var now NullTime
+		if e := self.db.QueryRow(query).Scan(&now); nil == e && now.Valid {
+			return now.Time.In(self.location())
+		}
+	}
+	return time.Now().In(self.location())
+}
@@ -0,0 +1,107 @@
+package delayed_job
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSqlArguments(t *testing.T) {
+	args := &sqlArguments{isNumeric: true}
+	if s := args.add(1); "$1" != s {
+		t.Error("excepted is '$1', actual is", s)
+	}
+	if s := args.add("a"); "$2" != s {
+		t.Error("excepted is '$2', actual is", s)
+	}
+	if 2 != len(args.values) {
+		t.Error("excepted values is 2, actual is", len(args.values))
+	}
+
+	args = &sqlArguments{}
+	if s := args.add(1); "?" != s {
+		t.Error("excepted is '?', actual is", s)
+	}
+}
+
+func TestCurrentTimeSQL(t *testing.T) {
+	for _, test := range []struct {
+		dbType   int
+		excepted string
+	}{
+		{dbType: POSTGRESQL, excepted: "now()"},
+		{dbType: MYSQL, excepted: "NOW(3)"},
+		{dbType: MSSQL, excepted: "SYSDATETIME()"},
+		{dbType: ORACLE, excepted: "SYSTIMESTAMP"},
+	} {
+		if s := currentTimeSQL(test.dbType); test.excepted != s {
+			t.Errorf("excepted is '%s', actual is '%s'", test.excepted, s)
+		}
+	}
+
+	if s := subtractSQL(POSTGRESQL, "now()", time.Minute); !strings.Contains(s, "interval '60 seconds'") {
+		t.Error("excepted contains the interval, actual is", s)
+	}
+	if s := subtractSQL(MSSQL, "SYSDATETIME()", time.Minute); "DATEADD(second, -60, SYSDATETIME())" != s {
+		t.Error("excepted contains DATEADD, actual is", s)
+	}
+}
+
+func TestReserveWithServerTime(t *testing.T) {
+	old := *db_server_time
+	*db_server_time = true
+	defer func() {
+		*db_server_time = old
+	}()
+
+	backendTest(t, func(backend *dbBackend) {
+		now := backend.db_time_now()
+		e := backend.enqueue(1, 0, "", 0, "aa", now.Add(-1*time.Second), map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		e = backend.enqueue(1, 0, "", 0, "aa", now.Add(1*time.Hour), map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := &worker{min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute}
+		job, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == job {
+			t.Error("excepted job is not nil, actual is nil")
+			return
+		}
+
+		job, e = backend.reserve(&worker{min_priority: -1, max_priority: -1, name: "bb_pid:123", max_run_time: 1 * time.Minute})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil != job {
+			t.Error("excepted job is nil, actual is", job.id)
+		}
+	})
+}
+
+func TestLimitSQL(t *testing.T) {
+	for _, test := range []struct {
+		dbType   int
+		excepted string
+	}{
+		{dbType: POSTGRESQL, excepted: "SELECT a FROM t ORDER BY a LIMIT 10"},
+		{dbType: MYSQL, excepted: "SELECT a FROM t ORDER BY a LIMIT 10"},
+		{dbType: MSSQL, excepted: "SELECT TOP 10 a FROM t ORDER BY a"},
+		{dbType: ORACLE, excepted: "SELECT * FROM (SELECT a FROM t ORDER BY a) WHERE ROWNUM <= 10"},
+		{dbType: DB2, excepted: "SELECT a FROM t ORDER BY a FETCH FIRST 10 ROWS ONLY"},
+	} {
+		if s := limitSQL(test.dbType, "SELECT a FROM t ORDER BY a", 10); test.excepted != s {
+			t.Errorf("excepted is '%s', actual is '%s'", test.excepted, s)
+		}
+	}
+}
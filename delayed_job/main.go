@@ -3,23 +3,36 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
 
 	"github.com/runner-mei/delayed_job"
 )
 
 var (
 	listenAddress = flag.String("listen", ":37078", "the address of http")
-	run_mode      = flag.String("mode", "all", "init_db, console, backend, all")
+	run_mode      = flag.String("mode", "all", "init_db, upgrade_db, console, backend, all")
 )
 
 func main() {
 	flag.Parse()
-	if nil != flag.Args() && 0 != len(flag.Args()) {
-		flag.Usage()
+	if 0 != flag.NArg() {
+		if !delayed_job.IsCommand(flag.Arg(0)) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if e := delayed_job.RunCommand(flag.Args(), os.Stdout); nil != e {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
 		return
 	}
 
-	e := delayed_job.Main(*listenAddress, *run_mode)
+	e := delayed_job.Main(*run_mode, func(handler http.Handler) {
+		if e := http.ListenAndServe(*listenAddress, handler); nil != e {
+			fmt.Println(e)
+		}
+	})
 	if nil != e {
 		fmt.Println(e)
 		return
@@ -0,0 +1,132 @@
+package delayed_job
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Server is the http console of the jobs, it is a http.Handler which serves
+// the dashboard and the api.
+type Server struct {
+	backend *dbBackend
+	front   http.Handler
+}
+
+// NewServer creates a console with the options.
+func NewServer(opts *Options) (*Server, error) {
+	backend, e := opts.newBackend(map[string]interface{}{})
+	if nil != e {
+		return nil, e
+	}
+	front, e := newAuthHandler(&webFront{dbBackend: backend}, opts.Authenticators, opts.AnonymousRole)
+	if nil != e {
+		backend.Close()
+		return nil, e
+	}
+	return &Server{backend: backend, front: front}, nil
+}
+
+// InitDB drops and creates the tables of the jobs.
+func (self *Server) InitDB() error {
+	return self.backend.initTables()
+}
+
+// UpgradeDB adds the columns and the tables which are missing in the tables
+// of an earlier version, the jobs are kept.
+func (self *Server) UpgradeDB() error {
+	return self.backend.upgradeTables()
+}
+
+func (self *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.front.ServeHTTP(w, r)
+}
+
+func (self *Server) Close() error {
+	return self.backend.Close()
+}
+
+// Worker runs the jobs.
+type Worker struct {
+	w *worker
+}
+
+// NewWorker creates a worker with the options.
+func NewWorker(opts *Options) (*Worker, error) {
+	w, e := newWorkerWithOptions(opts, opts.workerOptions())
+	if nil != e {
+		return nil, e
+	}
+	return &Worker{w: w}, nil
+}
+
+// Name returns the name of the worker which is used to lock the jobs.
+func (self *Worker) Name() string {
+	return self.w.name
+}
+
+// Start runs the worker in the background until Close is called.
+func (self *Worker) Start() {
+	self.w.start()
+}
+
+// RunForever runs the worker in the current goroutine.
+func (self *Worker) RunForever() {
+	self.w.RunForever()
+}
+
+// WorkOff runs at most num jobs which are ready, it returns the count of the
+// succeeded and the failed jobs.
+func (self *Worker) WorkOff(num int) (int, int, error) {
+	return self.w.work_off(num)
+}
+
+// Close stops the worker which is started by Start and releases the
+// connections.
+func (self *Worker) Close() error {
+	return self.w.Close()
+}
+
+// Client enqueues the jobs into the database directly.
+type Client struct {
+	backend *dbBackend
+}
+
+// NewClient creates a client with the options.
+func NewClient(opts *Options) (*Client, error) {
+	backend, e := opts.newBackend(map[string]interface{}{})
+	if nil != e {
+		return nil, e
+	}
+	return &Client{backend: backend}, nil
+}
+
+// Enqueue creates a job, the job has the same shape as the body of '/push'.
+func (self *Client) Enqueue(job map[string]interface{}) error {
+	j, e := createJobFromMap(self.backend, job)
+	if nil != e {
+		return e
+	}
+	return self.backend.create(j)
+}
+
+// EnqueueAll creates the jobs in a transaction.
+func (self *Client) EnqueueAll(jobs ...map[string]interface{}) error {
+	if 0 == len(jobs) {
+		return nil
+	}
+
+	created := make([]*Job, len(jobs))
+	for i, job := range jobs {
+		j, e := createJobFromMap(self.backend, job)
+		if nil != e {
+			return errors.New("parse data[" + strconv.FormatInt(int64(i), 10) + "] failed, " + e.Error())
+		}
+		created[i] = j
+	}
+	return self.backend.create(created...)
+}
+
+func (self *Client) Close() error {
+	return self.backend.Close()
+}
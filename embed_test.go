@@ -0,0 +1,147 @@
+package delayed_job
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsToWorker(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Name = "embed_worker"
+	opts.Queues = []string{"a", "b"}
+	opts.MaxRunTime = 3 * time.Minute
+	opts.MinPriority = 2
+
+	w := &worker{}
+	w.initialize(opts.workerOptions())
+	if "embed_worker" != w.name {
+		t.Error("excepted name is 'embed_worker', actual is", w.name)
+	}
+	if 2 != len(w.queues) || "a" != w.queues[0] || "b" != w.queues[1] {
+		t.Error("excepted queues is [a b], actual is", w.queues)
+	}
+	if 3*time.Minute != w.max_run_time {
+		t.Error("excepted max_run_time is 3m, actual is", w.max_run_time)
+	}
+	if 2 != w.min_priority {
+		t.Error("excepted min_priority is 2, actual is", w.min_priority)
+	}
+
+	opts.Name = ""
+	opts.NamePrefix = "embed"
+	w.initialize(opts.workerOptions())
+	if !strings.HasPrefix(w.name, "embed_pid:") {
+		t.Error("excepted name is 'embed_pid:<pid>', actual is", w.name)
+	}
+
+	w.initialize(map[string]interface{}{"sleep_delay": 7 * time.Second})
+	if 3*time.Minute != w.max_run_time || 2 != len(w.queues) || 7*time.Second != w.sleep_delay {
+		t.Error("excepted the missing options are kept, actual is", w.max_run_time, w.queues, w.sleep_delay)
+	}
+}
+
+func TestOptionsWithTable(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Table = "embed_jobs"
+	opts.DbServerTime = !*db_server_time
+	opts.ResultTTL = 7 * time.Hour
+	backend, e := opts.newBackend(nil)
+	if nil != e {
+		t.Skip(e)
+		return
+	}
+	defer backend.Close()
+
+	if "embed_jobs" != backend.table {
+		t.Error("excepted table is 'embed_jobs', actual is", backend.table)
+	}
+	if "SELECT "+fields_sql_string+" FROM embed_jobs " != backend.select_sql {
+		t.Error("excepted select from 'embed_jobs', actual is", backend.select_sql)
+	}
+	if "embed_jobs_queues" != backend.queueTable() {
+		t.Error("excepted queue table is 'embed_jobs_queues', actual is", backend.queueTable())
+	}
+	if opts.DbServerTime != backend.server_time || 7*time.Hour != backend.result_ttl {
+		t.Error("excepted server_time and result_ttl are from the options, actual is", backend.server_time, backend.result_ttl)
+	}
+}
+
+func TestEmbedWithMultiplexed(t *testing.T) {
+	job := map[string]interface{}{"handler": map[string]interface{}{"type": "multiplexed",
+		"rules": []interface{}{map[string]interface{}{"type": "test"}}}}
+
+	c, e := NewClient(DefaultOptions())
+	if nil != e {
+		t.Skip(e)
+		return
+	}
+	defer c.Close()
+	if _, e = createJobFromMap(c.backend, job); nil != e {
+		t.Error(e)
+	}
+
+	srv, e := NewServer(DefaultOptions())
+	if nil != e {
+		t.Skip(e)
+		return
+	}
+	defer srv.Close()
+	if _, e = createJobFromMap(srv.backend, job); nil != e {
+		t.Error(e)
+	}
+}
+
+func TestEmbedWithTwoTables(t *testing.T) {
+	a := DefaultOptions()
+	b := DefaultOptions()
+	b.Table = a.Table + "_embed"
+
+	for _, opts := range []*Options{a, b} {
+		srv, e := NewServer(opts)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		e = srv.InitDB()
+		srv.Close()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+	}
+
+	client, e := NewClient(b)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer client.Close()
+
+	e = client.EnqueueAll(map[string]interface{}{"priority": 1, "handler": map[string]interface{}{"type": "test", "handler_id": "embed_1"}},
+		map[string]interface{}{"priority": 2, "handler": map[string]interface{}{"type": "test", "handler_id": "embed_2"}})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	for _, test := range []struct {
+		opts     *Options
+		excepted int
+	}{{opts: a, excepted: 0}, {opts: b, excepted: 2}} {
+		backend, e := test.opts.newBackend(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		results, e := backend.where(nil)
+		backend.Close()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if test.excepted != len(results) {
+			t.Error("excepted jobs of", test.opts.Table, "is", test.excepted, ", actual is", len(results))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	JobEnqueued  = "enqueued"
+	JobStarted   = "started"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobRetried   = "retried"
+	JobDeleted   = "deleted"
+)
+
+var (
+	events_counts_interval = flag.Duration("events_counts_interval", 5*time.Second, "the interval of the counts in the '/events' stream")
+	events_buffer_size     = flag.Int("events_buffer_size", 100, "the size of buffer for every subscriber of '/events', the events are dropped if it is full")
+
+	job_events = &eventBroker{subscribers: map[chan *jobEvent]struct{}{}}
+)
+
+// jobEvent is published to the '/events' stream, ID is 0 if the event isn't
+// for a single job, such as the bulk actions.
+type jobEvent struct {
+	Event     string    `json:"event"`
+	ID        int64     `json:"id,omitempty"`
+	HandlerID string    `json:"handler_id,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Queue     string    `json:"queue,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	Count     int64     `json:"count,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// eventBroker delivers the events of the jobs in this process to the
+// subscribers, a slow subscriber misses the events instead of blocking the
+// worker. It isn't shared between the processes, see eventsHandler.
+type eventBroker struct {
+	lock        sync.Mutex
+	subscribers map[chan *jobEvent]struct{}
+}
+
+func (self *eventBroker) subscribe() chan *jobEvent {
+	ch := make(chan *jobEvent, *events_buffer_size)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (self *eventBroker) unsubscribe(ch chan *jobEvent) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	delete(self.subscribers, ch)
+}
+
+func (self *eventBroker) publish(event *jobEvent) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for ch := range self.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func publishJobEvent(event string, job *JobInfo, e error) {
+	ev := &jobEvent{Event: event, At: time.Now()}
+	if nil != job {
+		ev.ID = job.ID
+		ev.HandlerID = job.HandlerID
+		ev.Type = job.Type
+		ev.Queue = job.Queue
+		ev.Attempts = job.Attempts
+	}
+	if nil != e {
+		// the viewers subscribe the events, hide the passwords of the urls.
+		ev.Error = redactString(e.Error())
+	}
+	job_events.publish(ev)
+}
+
+// publishBulkEvent publishes the event of the bulk action which is applied to
+// count jobs.
+func publishBulkEvent(action string, count int64) {
+	event := "updated"
+	switch action {
+	case "retry":
+		event = JobRetried
+	case "delete":
+		event = JobDeleted
+	}
+	job_events.publish(&jobEvent{Event: event, Count: count, At: time.Now()})
+}
+
+func writeServerEvent(w io.Writer, event string, data interface{}) error {
+	bs, e := json.Marshal(data)
+	if nil != e {
+		return e
+	}
+	_, e = io.WriteString(w, "event: "+event+"\ndata: "+string(bs)+"\n\n")
+	return e
+}
+
+// countsChanged returns true if the counts are different.
+func countsChanged(last, counts map[string]int64) bool {
+	if len(last) != len(counts) {
+		return true
+	}
+	for k, v := range counts {
+		if old, ok := last[k]; !ok || old != v {
+			return true
+		}
+	}
+	return false
+}
+
+// eventsHandler streams the events of the jobs and the counts every
+// events_counts_interval as Server-Sent Events. The events of the jobs come
+// only from the workers in this process (such as '-mode all' or the embedded
+// workers), so that the workers in the other processes (such as '-mode
+// console' with '-mode backend') are followed by the counts which are read
+// from the database, an 'updated' event is sent if the counts are changed.
+func eventsHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		io.WriteString(w, "streaming is unsupported.")
+		return
+	}
+
+	ch := job_events.subscribe()
+	defer job_events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	var last map[string]int64
+	writeCounts := func() error {
+		counts, e := backend.counts()
+		if nil != e {
+			return writeServerEvent(w, "error", map[string]string{"error": e.Error()})
+		}
+		if nil != last && countsChanged(last, counts) {
+			if e = writeServerEvent(w, "updated", &jobEvent{Event: "updated", At: time.Now()}); nil != e {
+				return e
+			}
+		}
+		last = counts
+		return writeServerEvent(w, "counts", counts)
+	}
+
+	if e := writeCounts(); nil != e {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(*events_counts_interval)
+	defer ticker.Stop()
+
+	for {
+		var e error
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			e = writeServerEvent(w, event.Event, event)
+		case <-ticker.C:
+			e = writeCounts()
+		}
+		if nil != e {
+			return
+		}
+		flusher.Flush()
+	}
+}
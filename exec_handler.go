@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -28,6 +29,30 @@ type execHandler struct {
 	command        string
 	arguments      []string
 	environments   []string
+
+	progress_pattern *regexp.Regexp
+	reporter         ProgressReporter
+
+	output string
+
+	handlerLogger
+}
+
+// progressPattern reads 'progress_pattern', its first group is the percent
+// and the optional second group is the message.
+func progressPattern(params map[string]interface{}) (*regexp.Regexp, error) {
+	s := stringWithDefault(params, "progress_pattern", "")
+	if 0 == len(s) {
+		return default_progress_pattern, nil
+	}
+	pattern, e := regexp.Compile(s)
+	if nil != e {
+		return nil, errors.New("'progress_pattern' is invalid, " + e.Error())
+	}
+	if pattern.NumSubexp() < 1 {
+		return nil, errors.New("'progress_pattern' must have a group of percent")
+	}
+	return pattern, nil
 }
 
 func newExecHandler(ctx, params map[string]interface{}) (Handler, error) {
@@ -45,6 +70,10 @@ func newExecHandler(ctx, params map[string]interface{}) (Handler, error) {
 	if 0 == len(command) {
 		return nil, errors.New("'command' is required")
 	}
+	progress_pattern, e := progressPattern(params)
+	if nil != e {
+		return nil, e
+	}
 
 	if args, ok := params["arguments"]; ok {
 		args = preprocessArgs(args)
@@ -100,7 +129,9 @@ func newExecHandler(ctx, params map[string]interface{}) (Handler, error) {
 		prompt:       prompt,
 		command:      command,
 		arguments:    arguments,
-		environments: environments}, nil
+		environments: environments,
+
+		progress_pattern: progress_pattern}, nil
 }
 
 func newExecHandler2(ctx, params map[string]interface{}) (Handler, error) {
@@ -118,6 +149,10 @@ func newExecHandler2(ctx, params map[string]interface{}) (Handler, error) {
 	if 0 == len(command) {
 		return nil, errors.New("'command' is required")
 	}
+	progress_pattern, e := progressPattern(params)
+	if nil != e {
+		return nil, e
+	}
 
 	var arguments []string
 	if args, ok := params["arguments"]; ok {
@@ -169,7 +204,9 @@ func newExecHandler2(ctx, params map[string]interface{}) (Handler, error) {
 		prompt:       prompt,
 		command:      command,
 		arguments:    arguments,
-		environments: environments}, nil
+		environments: environments,
+
+		progress_pattern: progress_pattern}, nil
 }
 
 var ExecutableFolder string
@@ -177,7 +214,7 @@ var ExecutableFolder string
 func init() {
 	executableFolder, e := osext.ExecutableFolder()
 	if nil != e {
-		fmt.Println("[warn]", e)
+		defaultLogger().Warn("read executable folder failed", "error", e)
 		return
 	}
 
@@ -229,18 +266,70 @@ func lookPath(executableFolder string, alias ...string) (string, bool) {
 	return "", false
 }
 
-func (self *execHandler) Perform() error {
+func (self *execHandler) SetProgressReporter(reporter ProgressReporter) {
+	self.reporter = reporter
+}
+
+func (self *execHandler) Result() interface{} {
+	if 0 == len(self.output) {
+		return nil
+	}
+	return map[string]interface{}{"output": self.output}
+}
+
+// resolveCommand returns the path of the command.
+func (self *execHandler) resolveCommand() string {
 	if "tpt" == self.command || "tpt.exe" == self.command {
 		if a, ok := lookPath(ExecutableFolder, "tpt"); ok {
-			self.command = a
+			return a
 		}
 	} else {
 		if a, ok := lookPath(ExecutableFolder, self.command); ok {
-			self.command = a
+			return a
 		}
 	}
+	return self.command
+}
+
+// Render returns the command line which would be executed, the values of the
+// sensitive environments are redacted.
+func (self *execHandler) Render() (map[string]interface{}, error) {
+	command := self.resolveCommand()
+	words := make([]string, 0, len(self.arguments)+1)
+	for _, s := range append([]string{command}, self.arguments...) {
+		words = append(words, shellQuote(s))
+	}
+
+	environments := make([]string, 0, len(self.environments))
+	for _, env := range self.environments {
+		if idx := strings.IndexByte(env, '='); idx > 0 && isSensitive(env[:idx]) {
+			env = env[:idx+1] + redacted
+		}
+		environments = append(environments, env)
+	}
 
-	fmt.Println(self.command, self.arguments)
+	result := map[string]interface{}{"command": command,
+		"arguments":      self.arguments,
+		"command_line":   strings.Join(words, " "),
+		"work_directory": self.work_directory,
+		"environments":   environments}
+	if 0 != len(self.prompt) {
+		result["prompt"] = self.prompt
+	}
+	return result, nil
+}
+
+func shellQuote(s string) string {
+	if 0 != len(s) && !strings.ContainsAny(s, " \t\r\n\"'\\$`|&;<>()*?[]{}~#") {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (self *execHandler) Perform() error {
+	self.command = self.resolveCommand()
+
+	self.log().Debug("execute command", "command", self.command, "arguments", self.arguments)
 	cmd := exec.Command(self.command, self.arguments...)
 	cmd.Dir = self.work_directory
 
@@ -256,6 +345,9 @@ func (self *execHandler) Perform() error {
 	if 0 == len(self.prompt) {
 		var buffer bytes.Buffer
 		cmd.Stderr = &buffer
+		if nil != self.reporter {
+			cmd.Stderr = io.MultiWriter(&buffer, &progressWriter{pattern: self.progress_pattern, reporter: self.reporter})
+		}
 		cmd.Stdout = cmd.Stderr
 
 		err := cmd.Start()
@@ -282,8 +374,9 @@ func (self *execHandler) Perform() error {
 				return errors.New(buffer.String())
 			}
 			if logCmdOutput {
-				fmt.Println(buffer.String())
+				self.log().Info("command output", "output", buffer.String())
 			}
+			self.output = truncateResultText(buffer.String())
 			return nil
 		}
 		return nil
@@ -306,17 +399,25 @@ func (self *execHandler) Perform() error {
 
 	var scan_error error
 	var wait sync.WaitGroup
+	// the output before the prompt, it is the result of the job.
+	buffer := bytes.NewBuffer(make([]byte, 0, 10240))
 	wait.Add(1)
 	go func() {
 		defer wait.Done()
 
-		buffer := bytes.NewBuffer(make([]byte, 0, 10240))
 		scanner := bufio.NewScanner(pr)
 		for scanner.Scan() {
 			if strings.Contains(scanner.Text(), self.prompt) {
+				buffer.Write(scanner.Bytes())
 				return
 			}
+			if nil != self.reporter {
+				if percent, message, ok := parseProgress(self.progress_pattern, scanner.Text()); ok {
+					self.reporter.Report(percent, message)
+				}
+			}
 			buffer.Write(scanner.Bytes())
+			buffer.WriteByte('\n')
 
 			if buffer.Len() > 10*1024*1024 {
 				buffer.WriteString("\r\n ************************* read too large *************************\r\n")
@@ -344,7 +445,9 @@ func (self *execHandler) Perform() error {
 		}
 		return errors.New("start cmd failed, " + err.Error())
 	}
-
+	if nil == scan_error {
+		self.output = truncateResultText(buffer.String())
+	}
 	return scan_error
 }
 
@@ -353,4 +456,41 @@ func init() {
 	Handlers["exec_command"] = newExecHandler
 	Handlers["exec2"] = newExecHandler2
 	Handlers["exec2_command"] = newExecHandler2
+
+	params := []HandlerParam{{Name: "command", Type: "string", Required: true, Template: true,
+		Description: "the command, it is split into the arguments unless 'command_arguments' is set"},
+		{Name: "command_arguments", Type: "strings", Description: "the arguments of the command"},
+		{Name: "work_directory", Type: "string", Description: "the work directory, it is '-default_directory' if missing"},
+		{Name: "environments", Type: "strings", Template: true,
+			Description: "the environments, such as 'A=1;B=2'"},
+		{Name: "prompt", Type: "string", Template: true, Description: "the text which is written to the stdin"},
+		{Name: "progress_pattern", Type: "string",
+			Description: "the regexp of the progress in the output, its first group is the percent"},
+		param_arguments}
+	RegisterHandlerInfo(HandlerInfo{Type: "exec",
+		Description:  "execute the command",
+		Aliases:      []string{"exec_command"},
+		Params:       params,
+		TemplateArgs: default_template_args})
+
+	params2 := make([]HandlerParam, 0, len(params)+1)
+	for _, param := range params {
+		switch param.Name {
+		case "command":
+			param.Description = "the path of the command"
+		case "command_arguments":
+			param = HandlerParam{Name: "arguments", Type: "strings", Template: true,
+				Description: "the arguments of the command"}
+		case "arguments":
+			param = HandlerParam{Name: "options", Type: "any", Description: "the arguments of the templates"}
+		}
+		params2 = append(params2, param)
+	}
+	RegisterHandlerInfo(HandlerInfo{Type: "exec2",
+		Description: "execute the command with the arguments",
+		Aliases:     []string{"exec2_command"},
+		Params:      params2,
+		TemplateArgs: []HandlerParam{{Name: "options", Type: "object",
+			Description: "the values in 'options' are the top-level template arguments"},
+			template_arg_self}})
 }
@@ -113,6 +113,10 @@ func TestExecHandlerPromptFound(t *testing.T) {
 		t.Error(e)
 		return
 	}
+	result := handler.(Resulter).Result().(map[string]interface{})
+	if output, _ := result["output"].(string); !strings.Contains(output, runtime.GOARCH) {
+		t.Error("excepted output contains the prompt line, actual is", result)
+	}
 }
 
 func TestExecHandlerArguments(t *testing.T) {
@@ -185,3 +189,24 @@ func TestExecPlink(t *testing.T) {
 		return
 	}
 }
+
+func TestExecHandlerRender(t *testing.T) {
+	handler, e := newExecHandler(map[string]interface{}{}, map[string]interface{}{"command": "not_exists_{{.name}}",
+		"arguments":         map[string]interface{}{"name": "cmd"},
+		"command_arguments": []interface{}{"mei", "a b"},
+		"environments":      "A=1;DB_PASSWORD=abc"})
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	output, e := handler.(Renderer).Render()
+	if nil != e {
+		t.Fatal(e)
+	}
+	if "not_exists_cmd mei 'a b'" != output["command_line"] {
+		t.Error("excepted command_line is [not_exists_cmd mei 'a b'], actual is", output["command_line"])
+	}
+	if environments := strings.Join(output["environments"].([]string), ";"); "A=1;DB_PASSWORD="+redacted != environments {
+		t.Error("excepted environments are redacted, actual is", environments)
+	}
+}
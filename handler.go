@@ -11,6 +11,32 @@ type Updater interface {
 	UpdatePayloadObject(options map[string]interface{})
 }
 
+// ProgressReporter receives the progress of the running job, percent is
+// between 0 and 100.
+type ProgressReporter interface {
+	Report(percent int, message string)
+}
+
+// Progresser is implemented by the handler which reports the progress during
+// Perform, the reporter is set before Perform is called.
+type Progresser interface {
+	SetProgressReporter(reporter ProgressReporter)
+}
+
+// Resulter is implemented by the handler which has a result payload after
+// Perform, such as the output of command or the response body, the result is
+// kept after the job is finished.
+type Resulter interface {
+	Result() interface{}
+}
+
+// Renderer is implemented by the handler which can render its output without
+// any side effect, such as the http request or the mail message, it is used by
+// the dry run of '/test' and the 'render' command.
+type Renderer interface {
+	Render() (map[string]interface{}, error)
+}
+
 type MakeHandler func(ctx, options map[string]interface{}) (Handler, error)
 
 var Handlers = map[string]MakeHandler{}
@@ -47,10 +73,18 @@ func (self testHandler) UpdatePayloadObject(options map[string]interface{}) {
 	options["UpdatePayloadObject"] = "UpdatePayloadObject"
 }
 
+func (self testHandler) Render() (map[string]interface{}, error) {
+	return map[string]interface{}(self), nil
+}
+
 func newTest(ctx, options map[string]interface{}) (Handler, error) {
 	return testHandler(options), nil
 }
 
 func init() {
 	Handlers["test"] = newTest
+
+	RegisterHandlerInfo(HandlerInfo{Type: "test",
+		Description: "send the payload to the test channel, it fails with 'error' if it is set",
+		Params:      []HandlerParam{{Name: "error", Type: "string", Description: "the error of the job"}}})
 }
@@ -0,0 +1,351 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HandlerParam describes a parameter of the handler, the type is one of
+// string, int, float, bool, duration, time, strings, object, array and any.
+//
+// strings is a comma separated string or an array of strings, and the value of
+// a template parameter is rendered with the template arguments.
+type HandlerParam struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Aliases     []string    `json:"aliases,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Allowed     []string    `json:"allowed,omitempty"`
+	Template    bool        `json:"template,omitempty"`
+	Secret      bool        `json:"secret,omitempty"`
+}
+
+// HandlerInfo is the metadata of a handler type, it is served by '/handlers'
+// and used to validate the payload before the job is created.
+type HandlerInfo struct {
+	Type         string         `json:"type"`
+	Description  string         `json:"description"`
+	Aliases      []string       `json:"aliases,omitempty"`
+	Params       []HandlerParam `json:"params"`
+	TemplateArgs []HandlerParam `json:"template_args,omitempty"`
+}
+
+var handler_infos = map[string]*HandlerInfo{}
+
+// RegisterHandlerInfo registers the metadata of the handler type and its
+// aliases, the handlers must be registered in Handlers separately.
+func RegisterHandlerInfo(info HandlerInfo) {
+	p := &info
+	handler_infos[info.Type] = p
+	for _, alias := range info.Aliases {
+		handler_infos[alias] = p
+	}
+}
+
+// the template arguments which are shared by the most handlers.
+var (
+	template_arg_arguments = HandlerParam{Name: "arguments", Type: "object",
+		Description: "the values in 'arguments' are the top-level template arguments"}
+	template_arg_self = HandlerParam{Name: "self", Type: "object",
+		Description: "the payload of the handler"}
+	template_arg_content = HandlerParam{Name: "content", Type: "string",
+		Description: "'this_is_test_message' if it isn't in 'arguments'"}
+
+	default_template_args = []HandlerParam{template_arg_arguments, template_arg_self, template_arg_content}
+
+	param_arguments = HandlerParam{Name: "arguments", Type: "any",
+		Description: "the arguments of the templates"}
+)
+
+// handlerInfos returns the metadata of all handler types, sorted by the type,
+// the types without the metadata are listed with the type only.
+func handlerInfos() []*HandlerInfo {
+	seen := map[*HandlerInfo]bool{}
+	var infos []*HandlerInfo
+	for name := range Handlers {
+		info, ok := handler_infos[name]
+		if !ok {
+			info = &HandlerInfo{Type: name, Params: []HandlerParam{}}
+		} else if seen[info] {
+			continue
+		}
+		seen[info] = true
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Type < infos[j].Type
+	})
+	return infos
+}
+
+// fieldError is the problem of a field in the payload.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// payloadError is returned if the payload doesn't match the parameters of the
+// handler.
+type payloadError struct {
+	Type   string       `json:"type"`
+	Fields []fieldError `json:"errors"`
+}
+
+func (self *payloadError) Error() string {
+	messages := make([]string, 0, len(self.Fields))
+	for _, f := range self.Fields {
+		messages = append(messages, f.Message)
+	}
+	return "payload of '" + self.Type + "' is invalid, " + strings.Join(messages, "; ")
+}
+
+// validatePayload checks the payload with the parameters of its handler type,
+// the unknown fields are ignored since the most handlers accept the dynamic
+// fields, such as 'head.xxx' of the web handler.
+func validatePayload(payload map[string]interface{}) error {
+	typ := stringWithDefault(payload, "type", "")
+	info, ok := handler_infos[typ]
+	if !ok {
+		return nil
+	}
+
+	var errs []fieldError
+	for _, param := range info.Params {
+		name, v := lookupParam(payload, param)
+		if nil == v || "" == v {
+			if param.Required {
+				errs = append(errs, fieldError{Field: param.Name, Message: "'" + param.Name + "' is required"})
+			}
+			continue
+		}
+		if e := checkParam(param, v); nil != e {
+			errs = append(errs, fieldError{Field: name, Message: "'" + name + "' " + e.Error()})
+		}
+	}
+	if 0 != len(errs) {
+		return &payloadError{Type: typ, Fields: errs}
+	}
+	return nil
+}
+
+func lookupParam(payload map[string]interface{}, param HandlerParam) (string, interface{}) {
+	if v, ok := payload[param.Name]; ok && nil != v {
+		return param.Name, v
+	}
+	for _, alias := range param.Aliases {
+		if v, ok := payload[alias]; ok && nil != v {
+			return alias, v
+		}
+	}
+	return param.Name, nil
+}
+
+func isTemplateText(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && strings.Contains(s, "{{")
+}
+
+func checkParam(param HandlerParam, v interface{}) error {
+	if e := checkParamType(param.Type, v); nil != e {
+		return e
+	}
+	if 0 == len(param.Allowed) || isTemplateText(v) {
+		return nil
+	}
+	if s := fmt.Sprint(v); !stringInSlice(param.Allowed, s) {
+		return errors.New("'" + s + "' isn't one of [" + strings.Join(param.Allowed, ", ") + "]")
+	}
+	return nil
+}
+
+func checkParamType(typ string, v interface{}) error {
+	switch typ {
+	case "string":
+		switch v.(type) {
+		case map[string]interface{}, []interface{}, []string:
+			return errors.New("must be a string")
+		}
+	case "int", "float":
+		switch value := v.(type) {
+		case int, int32, int64, float32, float64:
+		case json.Number:
+			if _, e := value.Float64(); nil != e {
+				return errors.New("must be a number")
+			}
+		case string:
+			if isTemplateText(value) {
+				return nil
+			}
+			if _, e := strconv.ParseFloat(value, 64); nil != e {
+				return errors.New("must be a number")
+			}
+		default:
+			return errors.New("must be a number")
+		}
+	case "bool":
+		if _, ok := v.(bool); ok {
+			return nil
+		}
+		switch fmt.Sprint(v) {
+		case "1", "0", "true", "false":
+		default:
+			return errors.New("must be a boolean")
+		}
+	case "duration":
+		switch value := v.(type) {
+		case time.Duration, int, int64, float64, json.Number:
+		case string:
+			if _, e := time.ParseDuration(value); nil != e {
+				return errors.New("must be a duration, such as '5s'")
+			}
+		default:
+			return errors.New("must be a duration, such as '5s'")
+		}
+	case "time":
+		if _, ok := v.(time.Time); ok {
+			return nil
+		}
+		if asTimeWithDefault(v, time.Time{}).IsZero() {
+			return errors.New("must be a time, such as '" + time.RFC3339 + "'")
+		}
+	case "strings":
+		switch value := v.(type) {
+		case string, []string:
+		case []interface{}:
+			for _, s := range value {
+				switch s.(type) {
+				case map[string]interface{}, []interface{}:
+					return errors.New("must be an array of strings")
+				}
+			}
+		default:
+			return errors.New("must be a string or an array of strings")
+		}
+	case "object":
+		if _, ok := v.(map[string]interface{}); !ok {
+			return errors.New("must be an object")
+		}
+	case "array":
+		switch v.(type) {
+		case []interface{}, []string, []map[string]interface{}:
+		default:
+			return errors.New("must be an array")
+		}
+	}
+	return nil
+}
+
+// typedHandlerInfo derives the metadata from the tags of the payload, see
+// Register for the tags.
+func typedHandlerInfo(name string, payload interface{}) HandlerInfo {
+	info := HandlerInfo{Type: name, Params: []HandlerParam{}}
+	rt := reflect.TypeOf(payload)
+	for nil != rt && reflect.Ptr == rt.Kind() {
+		rt = rt.Elem()
+	}
+	if nil == rt || reflect.Struct != rt.Kind() {
+		return info
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if 0 != len(field.PkgPath) {
+			continue
+		}
+		param := HandlerParam{Name: fieldName(field),
+			Type:        paramType(field.Type),
+			Description: field.Tag.Get("description"),
+			Required:    "true" == field.Tag.Get("required")}
+		if "-" == param.Name {
+			continue
+		}
+		for _, alias := range strings.Split(field.Tag.Get("alias"), ",") {
+			if alias = strings.TrimSpace(alias); 0 != len(alias) {
+				param.Aliases = append(param.Aliases, alias)
+			}
+		}
+		if s, ok := field.Tag.Lookup("default"); ok {
+			param.Default = s
+			param.Required = false
+		}
+		info.Params = append(info.Params, param)
+	}
+	return info
+}
+
+func paramType(rt reflect.Type) string {
+	if durationType == rt {
+		return "duration"
+	}
+	if reflect.TypeOf(time.Time{}) == rt {
+		return "time"
+	}
+	switch rt.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		if reflect.String == rt.Elem().Kind() {
+			return "strings"
+		}
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "any"
+}
+
+// writeJobError writes the error of creating the job, the field errors are
+// written as json with 400 if the payload is invalid.
+func writeJobError(w http.ResponseWriter, code int, prefix string, e error) {
+	var pe *payloadError
+	if !errors.As(e, &pe) {
+		w.WriteHeader(code)
+		io.WriteString(w, prefix+e.Error())
+		return
+	}
+
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": prefix + e.Error(), "type": pe.Type, "errors": pe.Fields})
+}
+
+// handlersHandler serves the metadata of all handler types, or the one whose
+// type or alias is the last segment of '/handlers/xxx'.
+func handlersHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	name := ""
+	if idx := strings.Index(r.URL.Path, "/handlers/"); idx >= 0 {
+		name = strings.Trim(r.URL.Path[idx+len("/handlers/"):], "/")
+	}
+
+	var result interface{}
+	if 0 == len(name) {
+		result = handlerInfos()
+	} else if info, ok := handler_infos[name]; ok {
+		result = info
+	} else if _, ok := Handlers[name]; ok {
+		result = &HandlerInfo{Type: name, Params: []HandlerParam{}}
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "handler '"+name+"' isn't found.")
+		return
+	}
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	json.NewEncoder(w).Encode(result)
+}
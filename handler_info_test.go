@@ -0,0 +1,137 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerInfos(t *testing.T) {
+	for name, info := range handler_infos {
+		if _, ok := Handlers[name]; !ok {
+			t.Error("handler '"+name+"' of", info.Type, "isn't registered")
+		}
+	}
+	for _, name := range []string{"web", "http_command", "itsm_command", "smtp", "sms_action", "exec2", "db", "redis", "syslog", "weixin", "multiplexed"} {
+		if _, ok := handler_infos[name]; !ok {
+			t.Error("handler '" + name + "' has no metadata")
+		}
+	}
+	if "mail" != handler_infos["smtp"].Type {
+		t.Error("excepted smtp is an alias of mail, actual is", handler_infos["smtp"].Type)
+	}
+
+	seen := map[string]bool{}
+	for _, info := range handlerInfos() {
+		if seen[info.Type] {
+			t.Error(info.Type, "is listed twice")
+		}
+		seen[info.Type] = true
+	}
+	if seen["smtp"] || !seen["mail"] {
+		t.Error("excepted aliases aren't listed, actual is", seen)
+	}
+}
+
+func TestValidatePayload(t *testing.T) {
+	for idx, test := range []struct {
+		payload map[string]interface{}
+		fields  string
+	}{{payload: map[string]interface{}{"type": "mail", "subject": "a", "content": "b"}},
+		{payload: map[string]interface{}{"type": "smtp", "content_text": "b"}, fields: "subject"},
+		{payload: map[string]interface{}{"type": "web", "method": "GET", "url": "http://127.0.0.1/{{.a}}", "responseCode": json.Number("200")}},
+		{payload: map[string]interface{}{"type": "web", "method": "GETS", "url": "http://127.0.0.1", "responseCode": "abc"}, fields: "method,responseCode"},
+		{payload: map[string]interface{}{"type": "syslog", "to_address": []interface{}{"127.0.0.1"}, "content": "a", "facility": "abc"}, fields: "facility"},
+		{payload: map[string]interface{}{"type": "exec", "command": map[string]interface{}{}}, fields: "command"},
+		{payload: map[string]interface{}{"type": "multiplexed", "rules": "abc"}, fields: "rules"},
+		{payload: map[string]interface{}{"type": "not_exists", "a": "b"}}} {
+		e := validatePayload(test.payload)
+		if 0 == len(test.fields) {
+			if nil != e {
+				t.Errorf("[%d] %v", idx, e)
+			}
+			continue
+		}
+
+		pe, ok := e.(*payloadError)
+		if !ok {
+			t.Errorf("[%d] excepted payload error, actual is %v", idx, e)
+			continue
+		}
+		fields := make([]string, 0, len(pe.Fields))
+		for _, f := range pe.Fields {
+			fields = append(fields, f.Field)
+		}
+		if test.fields != strings.Join(fields, ",") {
+			t.Errorf("[%d] excepted fields are %v, actual is %v", idx, test.fields, pe.Fields)
+		}
+	}
+}
+
+func TestTypedHandlerInfo(t *testing.T) {
+	info := typedHandlerInfo("typed_info", typedTestPayload{})
+	params := map[string]HandlerParam{}
+	for _, param := range info.Params {
+		params[param.Name] = param
+	}
+	if param := params["user"]; "string" != param.Type || !param.Required || "user_name,userName" != strings.Join(param.Aliases, ",") {
+		t.Error("excepted user is a required string, actual is", param)
+	}
+	if param := params["timeout"]; "duration" != param.Type || "10s" != param.Default || param.Required {
+		t.Error("excepted timeout is a duration, actual is", param)
+	}
+	if param := params["tags"]; "strings" != param.Type {
+		t.Error("excepted tags are strings, actual is", param)
+	}
+}
+
+func TestHandlersByHttp(t *testing.T) {
+	front := &webFront{nil, &dbBackend{ctx: map[string]interface{}{}}}
+
+	r := httptest.NewRequest("GET", "/handlers", nil)
+	w := httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	var infos []HandlerInfo
+	if e := json.Unmarshal(w.Body.Bytes(), &infos); nil != e {
+		t.Fatal(e, w.Body.String())
+	}
+	if len(infos) < 10 {
+		t.Error("excepted all handlers are listed, actual is", w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/delayed_jobs/handlers/http_command", nil)
+	w = httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	var info HandlerInfo
+	if e := json.Unmarshal(w.Body.Bytes(), &info); nil != e {
+		t.Fatal(e, w.Body.String())
+	}
+	if "web" != info.Type || 0 == len(info.Params) || 0 == len(info.TemplateArgs) {
+		t.Error("excepted the metadata of web, actual is", w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/handlers/not_exists", nil)
+	w = httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	if http.StatusNotFound != w.Code {
+		t.Error("excepted status is 404, actual is", w.Code)
+	}
+
+	r = httptest.NewRequest("POST", "/push", strings.NewReader(`{"handler": {"type": "mail", "content": "a"}}`))
+	w = httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	if http.StatusBadRequest != w.Code {
+		t.Fatal("excepted status is 400, actual is", w.Code, w.Body.String())
+	}
+	var result struct {
+		Errors []fieldError `json:"errors"`
+	}
+	if e := json.Unmarshal(w.Body.Bytes(), &result); nil != e {
+		t.Fatal(e, w.Body.String())
+	}
+	if 1 != len(result.Errors) || "subject" != result.Errors[0].Field {
+		t.Error("excepted subject is required, actual is", w.Body.String())
+	}
+}
@@ -0,0 +1,297 @@
+package delayed_job
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	idempotency_ttl   = flag.Duration("idempotency_ttl", 24*time.Hour, "the lifetime of the idempotency keys of '/push' and '/pushAll', 0 is disabled")
+	idempotency_lease = flag.Duration("idempotency_lease", 1*time.Minute, "the max duration of a push with the idempotency key, the key which is in progress longer than it is abandoned (such as the process crashed) and can be used again")
+)
+
+const (
+	idempotency_header = "Idempotency-Key"
+	// the max length of the idempotency key and the saved response.
+	max_idempotency_key      = 200
+	max_idempotency_response = 2000
+)
+
+// idempotencyTable is the table which keeps the responses of the pushes by
+// the idempotency key, the status_code is 0 while the push is in progress,
+// created_at is the time when the key is reserved.
+func (self *dbBackend) idempotencyTable() string {
+	return self.table + "_idempotency"
+}
+
+func (self *dbBackend) idempotencyTableScripts() []string {
+	switch self.dbType {
+	case MSSQL:
+		return []string{`if object_id('dbo.` + self.idempotencyTable() + `', 'U') is not null
+				BEGIN
+							 DROP TABLE ` + self.idempotencyTable() + `;
+				END`,
+			`CREATE TABLE dbo.` + self.idempotencyTable() + ` (
+						  idempotency_key   varchar(200) NOT NULL PRIMARY KEY,
+						  fingerprint       varchar(64) NOT NULL,
+						  status_code       INT NOT NULL,
+						  response          varchar(2000),
+						  created_at        DATETIME2 NOT NULL
+						);`}
+	case POSTGRESQL:
+		return []string{`DROP TABLE IF EXISTS ` + self.idempotencyTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.idempotencyTable() + ` (
+				  idempotency_key   varchar(200) NOT NULL PRIMARY KEY,
+				  fingerprint       varchar(64) NOT NULL,
+				  status_code       int NOT NULL,
+				  response          varchar(2000),
+				  created_at        timestamp with time zone NOT NULL
+				);`}
+	case ORACLE:
+		return []string{`BEGIN EXECUTE IMMEDIATE 'DROP TABLE ` + self.idempotencyTable() + `';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE TABLE ` + self.idempotencyTable() + ` (
+					  idempotency_key   varchar2(200 BYTE) NOT NULL PRIMARY KEY,
+					  fingerprint       varchar2(64 BYTE) NOT NULL,
+					  status_code       NUMBER(10) NOT NULL,
+					  response          VARCHAR2(2000 BYTE),
+					  created_at        DATE
+					)`}
+	default:
+		return []string{`DROP TABLE IF EXISTS ` + self.idempotencyTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.idempotencyTable() + ` (
+					  idempotency_key   varchar(200) NOT NULL PRIMARY KEY,
+					  fingerprint       varchar(64) NOT NULL,
+					  status_code       int NOT NULL,
+					  response          VARCHAR(2000),
+					  created_at        DATETIME NOT NULL
+					);`}
+	}
+}
+
+// idempotencyBeforeSQL returns the expression of the time which is d before
+// now, the idempotency keys which are created before it are expired (d is
+// idempotency_ttl) or abandoned (d is idempotency_lease).
+func (self *dbBackend) idempotencyBeforeSQL(args *sqlArguments, now time.Time, d time.Duration) string {
+	if self.server_time {
+		return subtractSQL(self.dbType, currentTimeSQL(self.dbType), d)
+	}
+	return args.add(now.Add(-d))
+}
+
+// idempotentResponse is the response which is saved with the idempotency key,
+// status_code is 0 if the push is in progress.
+type idempotentResponse struct {
+	fingerprint string
+	status_code int
+	response    string
+}
+
+// reserveIdempotencyKey saves the key before the push, it returns the saved
+// response if the key has been used and isn't expired. The key which is in
+// progress longer than idempotency_lease is abandoned, it is reserved again.
+func (self *dbBackend) reserveIdempotencyKey(key, fingerprint string) (*idempotentResponse, error) {
+	now := self.db_time_now()
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := self.db.Exec("DELETE FROM "+self.idempotencyTable()+" WHERE idempotency_key = "+args.add(key)+
+		" AND (created_at < "+self.idempotencyBeforeSQL(args, now, *idempotency_ttl)+
+		" OR (status_code = 0 AND created_at < "+self.idempotencyBeforeSQL(args, now, *idempotency_lease)+"))", args.values...)
+	if nil != e && sql.ErrNoRows != e {
+		return nil, errors.New("remove expired idempotency key failed, " + i18nString(self.dbType, self.drv, e))
+	}
+
+	args = &sqlArguments{isNumeric: self.isNumericParams}
+	_, e = self.db.Exec("INSERT INTO "+self.idempotencyTable()+"(idempotency_key, fingerprint, status_code, created_at) VALUES ("+
+		args.add(key)+", "+args.add(fingerprint)+", 0, "+self.nowSQL(args, now)+")", args.values...)
+	if nil == e {
+		return nil, nil
+	}
+
+	// the insert is failed by the duplicated key in the most cases, the
+	// other errors are reported if the key isn't found.
+	saved, err := self.idempotentResponse(key)
+	if nil != err {
+		return nil, err
+	}
+	if nil == saved {
+		return nil, errors.New("save idempotency key failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return saved, nil
+}
+
+func (self *dbBackend) idempotentResponse(key string) (*idempotentResponse, error) {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	row := self.db.QueryRow("SELECT fingerprint, status_code, response FROM "+self.idempotencyTable()+
+		" WHERE idempotency_key = "+args.add(key), args.values...)
+
+	var saved idempotentResponse
+	var response sql.NullString
+	e := row.Scan(&saved.fingerprint, &saved.status_code, &response)
+	if nil != e {
+		if sql.ErrNoRows == e {
+			return nil, nil
+		}
+		return nil, errors.New("query idempotency key failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	saved.response = response.String
+	return &saved, nil
+}
+
+// saveIdempotentResponse saves the response of the push which is succeeded,
+// db is the transaction which creates the jobs of the push.
+func (self *dbBackend) saveIdempotentResponse(db sqlExecutor, key string, status_code int, response string) error {
+	if len(response) > max_idempotency_response {
+		response = response[:max_idempotency_response]
+	}
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := db.Exec("UPDATE "+self.idempotencyTable()+" SET status_code = "+args.add(status_code)+
+		", response = "+args.add(response)+" WHERE idempotency_key = "+args.add(key), args.values...)
+	if nil != e {
+		return errors.New("save idempotent response failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// releaseIdempotencyKey removes the key of the push which is failed, so that
+// the push can be retried with the same key.
+func (self *dbBackend) releaseIdempotencyKey(key string) error {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := self.db.Exec("DELETE FROM "+self.idempotencyTable()+" WHERE idempotency_key = "+args.add(key)+
+		" AND status_code = 0", args.values...)
+	if nil != e && sql.ErrNoRows != e {
+		return errors.New("release idempotency key failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// pruneIdempotencyKeys removes the expired idempotency keys.
+func (self *dbBackend) pruneIdempotencyKeys(now time.Time) error {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := self.db.Exec("DELETE FROM "+self.idempotencyTable()+" WHERE created_at < "+self.idempotencyBeforeSQL(args, now, *idempotency_ttl), args.values...)
+	if nil != e && sql.ErrNoRows != e {
+		return errors.New("prune idempotency keys failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// idempotencyKey returns the key in the 'Idempotency-Key' header, or the
+// 'idempotency_key' field of the job, the field is removed from the job.
+func idempotencyKey(r *http.Request, ent map[string]interface{}) string {
+	key := r.Header.Get(idempotency_header)
+	if nil != ent {
+		if 0 == len(key) {
+			key = stringWithDefault(ent, "idempotency_key", "")
+		}
+		delete(ent, "idempotency_key")
+	}
+	return key
+}
+
+func fingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder keeps the response of the push, so that it can be saved
+// with the idempotency key.
+type responseRecorder struct {
+	header      http.Header
+	status_code int
+	body        bytes.Buffer
+}
+
+func (self *responseRecorder) Header() http.Header {
+	return self.header
+}
+
+func (self *responseRecorder) Write(bs []byte) (int, error) {
+	if 0 == self.status_code {
+		self.status_code = http.StatusOK
+	}
+	return self.body.Write(bs)
+}
+
+func (self *responseRecorder) WriteHeader(status_code int) {
+	if 0 == self.status_code {
+		self.status_code = status_code
+	}
+}
+
+// idempotentSaver saves the response of the push with the idempotency key,
+// the push calls it in the transaction which creates the jobs, so that the
+// key isn't left in progress if the process exits after the jobs are created.
+type idempotentSaver func(db sqlExecutor, status_code int, response string) error
+
+// idempotent runs the push once for the key, the response of the first push
+// is replayed for the same key until the key is expired, the jobs aren't
+// created or replaced again. The key is released if the push is failed.
+func idempotent(w http.ResponseWriter, backend *dbBackend, key string, body []byte, push func(w http.ResponseWriter, save idempotentSaver)) {
+	if 0 == len(key) || *idempotency_ttl <= 0 {
+		push(w, func(sqlExecutor, int, string) error {
+			return nil
+		})
+		return
+	}
+	if len(key) > max_idempotency_key {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "'"+idempotency_header+"' is too long, the max length is "+strconv.Itoa(max_idempotency_key)+".")
+		return
+	}
+
+	sum := fingerprint(body)
+	saved, e := backend.reserveIdempotencyKey(key, sum)
+	if nil != e {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+	if nil != saved {
+		if saved.fingerprint != sum {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			io.WriteString(w, "'"+idempotency_header+"' is used by another request with the different body.")
+		} else if 0 == saved.status_code {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, "the request with the same '"+idempotency_header+"' is in progress.")
+		} else {
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.status_code)
+			io.WriteString(w, saved.response)
+		}
+		return
+	}
+
+	is_saved := false
+	recorder := &responseRecorder{header: w.Header()}
+	push(recorder, func(db sqlExecutor, status_code int, response string) error {
+		if e := backend.saveIdempotentResponse(db, key, status_code, response); nil != e {
+			return e
+		}
+		is_saved = true
+		return nil
+	})
+	if 0 == recorder.status_code {
+		recorder.status_code = http.StatusOK
+	}
+
+	if recorder.status_code >= 200 && recorder.status_code < 300 {
+		if !is_saved {
+			// the push which creates no job doesn't save the response.
+			e = backend.saveIdempotentResponse(backend.db, key, recorder.status_code, recorder.body.String())
+		}
+	} else {
+		e = backend.releaseIdempotencyKey(key)
+	}
+	if nil != e {
+		backend.log().Warn("update idempotency key failed", "key", key, "error", e)
+	}
+
+	w.WriteHeader(recorder.status_code)
+	w.Write(recorder.body.Bytes())
+}
@@ -0,0 +1,138 @@
+package delayed_job
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/push", nil)
+	ent := map[string]interface{}{"idempotency_key": "k2"}
+	if key := idempotencyKey(r, ent); "k2" != key {
+		t.Error("excepted key is k2, actual is", key)
+	}
+	if _, ok := ent["idempotency_key"]; ok {
+		t.Error("idempotency_key should be removed from the job")
+	}
+
+	r.Header.Set("Idempotency-Key", "k1")
+	ent = map[string]interface{}{"idempotency_key": "k2"}
+	if key := idempotencyKey(r, ent); "k1" != key {
+		t.Error("excepted key of the header is k1, actual is", key)
+	}
+	if key := idempotencyKey(r, nil); "k1" != key {
+		t.Error("excepted key is k1, actual is", key)
+	}
+
+	if fingerprint([]byte("a")) == fingerprint([]byte("b")) {
+		t.Error("excepted fingerprints are different")
+	}
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	restoreFlags(t, "idempotency_ttl")
+
+	count := 0
+	push := func(w http.ResponseWriter, save idempotentSaver) {
+		count++
+		if e := save(nil, http.StatusOK, "OK"); nil != e {
+			t.Error(e)
+		}
+		io.WriteString(w, "OK")
+	}
+
+	w := httptest.NewRecorder()
+	idempotent(w, nil, "", nil, push)
+	if 1 != count || "OK" != w.Body.String() {
+		t.Error("excepted push is called, actual is", count, w.Body.String())
+	}
+
+	flag.Set("idempotency_ttl", "0")
+	w = httptest.NewRecorder()
+	idempotent(w, nil, "k1", nil, push)
+	if 2 != count {
+		t.Error("excepted push is called if ttl is 0, actual is", count)
+	}
+
+	flag.Set("idempotency_ttl", "1h")
+	w = httptest.NewRecorder()
+	idempotent(w, nil, strings.Repeat("a", max_idempotency_key+1), nil, push)
+	if 2 != count || http.StatusBadRequest != w.Code {
+		t.Error("excepted the long key is rejected, actual is", w.Code, w.Body.String())
+	}
+}
+
+func TestPushWithIdempotencyKey(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		front := &webFront{nil, backend}
+		push := func(key, body string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("PUT", "/push", strings.NewReader(body))
+			if 0 != len(key) {
+				r.Header.Set("Idempotency-Key", key)
+			}
+			w := httptest.NewRecorder()
+			front.ServeHTTP(w, r)
+			return w
+		}
+
+		body := `{"queue": "idem", "handler": {"type": "test", "handler_id": "idem_1"}}`
+		if w := push("k1", body); http.StatusOK != w.Code {
+			t.Error("excepted status is 200, actual is", w.Code, w.Body.String())
+			return
+		}
+		// the response is saved in the transaction which creates the job.
+		if saved, e := backend.idempotentResponse("k1"); nil != e {
+			t.Error(e)
+			return
+		} else if nil == saved || http.StatusOK != saved.status_code || "OK" != saved.response {
+			t.Error("excepted the response is saved, actual is", saved)
+		}
+		if _, e := backend.db.Exec("UPDATE " + backend.table + " SET attempts = 3"); nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := push("k1", body)
+		if http.StatusOK != w.Code || "OK" != w.Body.String() || "true" != w.Header().Get("Idempotent-Replayed") {
+			t.Error("excepted the response is replayed, actual is", w.Code, w.Body.String(), w.Header())
+		}
+		if jobs, e := backend.where(nil); nil != e {
+			t.Error(e)
+		} else if 1 != len(jobs) || "3" != fmt.Sprint(jobs[0]["attempts"]) {
+			t.Error("excepted the job isn't replaced, actual is", jobs)
+		}
+
+		if w = push("k1", `{"handler": {"type": "test"}}`); http.StatusUnprocessableEntity != w.Code {
+			t.Error("excepted status is 422 if the body is different, actual is", w.Code, w.Body.String())
+		}
+
+		if w = push("k2", `{"handler": {"type": "mail"}}`); http.StatusBadRequest != w.Code {
+			t.Error("excepted status is 400, actual is", w.Code, w.Body.String())
+		}
+		if w = push("k2", body); http.StatusOK != w.Code || "" != w.Header().Get("Idempotent-Replayed") {
+			t.Error("excepted the key is released after the failure, actual is", w.Code, w.Body.String())
+		}
+
+		// the key which is left in progress by a crash.
+		if saved, e := backend.reserveIdempotencyKey("k3", fingerprint([]byte(body))); nil != e || nil != saved {
+			t.Error("excepted the key is reserved, actual is", saved, e)
+			return
+		}
+		if w = push("k3", body); http.StatusConflict != w.Code {
+			t.Error("excepted status is 409 if the key is in progress, actual is", w.Code, w.Body.String())
+		}
+		restoreFlags(t, "idempotency_lease")
+		flag.Set("idempotency_lease", "1ms")
+		// created_at of some databases is in seconds.
+		time.Sleep(1100 * time.Millisecond)
+		if w = push("k3", body); http.StatusOK != w.Code || "" != w.Header().Get("Idempotent-Replayed") {
+			t.Error("excepted the abandoned key is reserved again, actual is", w.Code, w.Body.String())
+		}
+	})
+}
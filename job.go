@@ -6,7 +6,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"runtime"
 	"strconv"
 	"sync"
@@ -38,22 +38,25 @@ func generate_id() string {
 type Job struct {
 	backend *dbBackend
 
-	id              int64
-	priority        int
-	repeat_count    int
-	repeat_interval string
-	attempts        int
-	max_attempts    int
-	queue           string
-	handler         string
-	handler_id      string
-	last_error      string
-	run_at          time.Time
-	failed_at       time.Time
-	locked_at       time.Time
-	locked_by       string
-	created_at      time.Time
-	updated_at      time.Time
+	id               int64
+	priority         int
+	repeat_count     int
+	repeat_interval  string
+	attempts         int
+	max_attempts     int
+	queue            string
+	handler          string
+	handler_id       string
+	last_error       string
+	run_at           time.Time
+	failed_at        time.Time
+	locked_at        time.Time
+	locked_by        string
+	created_at       time.Time
+	updated_at       time.Time
+	expires_at       time.Time
+	progress         int
+	progress_message string
 
 	changed_attributes map[string]interface{}
 	handler_attributes map[string]interface{}
@@ -77,8 +80,50 @@ func createJobFromMap(backend *dbBackend, args map[string]interface{}) (*Job, er
 		return nil, errors.New("'Handler' is not a map[string]interface{}.")
 	}
 
+	for _, name := range []string{"on_expired", "webhook", "keep_result"} {
+		if o, ok := args[name]; ok && nil != o {
+			if _, exists := handler[name]; !exists {
+				handler[name] = o
+			}
+		}
+	}
+
+	if o, ok := handler["webhook"]; ok && nil != o {
+		webhook, e := encryptWebhook(o)
+		if nil != e {
+			return nil, &payloadError{Type: stringWithDefault(handler, "type", ""),
+				Fields: []fieldError{{Field: "webhook", Message: e.Error()}}}
+		}
+		handler["webhook"] = webhook
+	}
+
 	is_valid_rule := boolWithDefault(args, "is_valid_rule", true)
-	return newJob(backend, priority, repeat_count, repeat_interval, max_attempts, queue, run_at, handler, is_valid_rule)
+	if is_valid_rule {
+		if e := validatePayload(handler); nil != e {
+			return nil, e
+		}
+	}
+	job, e := newJob(backend, priority, repeat_count, repeat_interval, max_attempts, queue, run_at, handler, is_valid_rule)
+	if nil != e {
+		return nil, e
+	}
+	job.expires_at = backend.dbTime(backend.deadlineWithDefault(args, run_at, time.Time{}))
+	return job, nil
+}
+
+// deadlineWithDefault reads the deadline of job from 'expires_at' or 'ttl',
+// the ttl is relative to run_at (or the time of the db if run_at is zero).
+func (self *dbBackend) deadlineWithDefault(args map[string]interface{}, run_at, defaultValue time.Time) time.Time {
+	if expires_at := timeWithDefault(args, "expires_at", time.Time{}); !expires_at.IsZero() {
+		return expires_at
+	}
+	if ttl := durationWithDefault(args, "ttl", 0); ttl > 0 {
+		if run_at.IsZero() {
+			run_at = self.db_time_now()
+		}
+		return run_at.Add(ttl)
+	}
+	return defaultValue
 }
 
 func newJob(backend *dbBackend, priority, repeat_count int, repeat_interval string, max_attempts int, queue string, run_at time.Time, args map[string]interface{}, is_valid_payload_object bool) (*Job, error) {
@@ -100,7 +145,7 @@ func newJob(backend *dbBackend, priority, repeat_count int, repeat_interval stri
 		queue:              queue,
 		handler:            string(s),
 		handler_id:         id,
-		run_at:             run_at,
+		run_at:             backend.dbTime(run_at),
 		handler_attributes: args}
 
 	if is_valid_payload_object {
@@ -166,29 +211,34 @@ func (self *Job) payload_object() (Handler, error) {
 var ErrTimeout = errors.New("time out")
 
 func (self *Job) invokeJob() error {
-	job, e := self.payload_object()
-	if nil != e {
-		return e
-	}
+	return self.invokeJobWith(nil, nil)
+}
+
+// invokeJobWith runs the handler in the middlewares of lc, the middlewares run
+// in the goroutine of the handler, so that a panic of the handler passes through
+// them (a middleware may recover it) and then is returned as a *PanicError.
+func (self *Job) invokeJobWith(lc *lifecycle, info *JobInfo) error {
 	ch := make(chan error, 1)
 	go func() {
 		defer func() {
-			if e := recover(); nil != e {
-				var buffer bytes.Buffer
-				buffer.WriteString(fmt.Sprintf("[panic]%v", e))
-				for i := 1; ; i += 1 {
-					_, file, line, ok := runtime.Caller(i)
-					if !ok {
-						break
-					}
-					buffer.WriteString(fmt.Sprintf("    %s:%d\r\n", file, line))
-				}
-				msg := buffer.String()
-				ch <- errors.New(msg)
+			if o := recover(); nil != o {
+				ch <- newPanicError(o)
 			}
 		}()
 
-		ch <- job.Perform()
+		ch <- lc.invoke(info, func() error {
+			job, e := self.payload_object()
+			if nil != e {
+				return e
+			}
+			if p, ok := job.(Progresser); ok {
+				p.SetProgressReporter(&jobProgress{job: self, interval: *progress_interval, locked_by: self.locked_by})
+			}
+			if l, ok := job.(Loggable); ok {
+				l.SetLogger(self.logger())
+			}
+			return job.Perform()
+		})
 	}()
 
 	timer := time.NewTimer(self.execTimeout())
@@ -201,6 +251,70 @@ func (self *Job) invokeJob() error {
 	}
 }
 
+// PanicError is the error of the job which panics, Value is the value of
+// the panic.
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func newPanicError(o interface{}) *PanicError {
+	var buffer bytes.Buffer
+	for i := 2; ; i += 1 {
+		_, file, line, ok := runtime.Caller(i)
+		if !ok {
+			break
+		}
+		buffer.WriteString(fmt.Sprintf("    %s:%d\r\n", file, line))
+	}
+	return &PanicError{Value: o, Stack: buffer.String()}
+}
+
+func (self *PanicError) Error() string {
+	return fmt.Sprintf("[panic]%v", self.Value) + self.Stack
+}
+
+// logger returns the logger with the fields of the job.
+func (self *Job) logger() *slog.Logger {
+	var logger *slog.Logger
+	if nil == self.backend {
+		logger = defaultLogger()
+	} else {
+		logger = self.backend.log()
+	}
+	return logger.With("job_id", self.id, "queue", self.queue, "type", self.typeName(), "attempts", self.attempts)
+}
+
+// result returns the result payload of the handler, it is nil if the handler
+// is not a Resulter.
+func (self *Job) result() interface{} {
+	if r, ok := self.handler_object.(Resulter); ok {
+		return r.Result()
+	}
+	return nil
+}
+
+// keepResult returns true if the caller asks to keep the status of the
+// finished job even if the handler has no result.
+func (self *Job) keepResult() bool {
+	options, e := self.attributes()
+	return nil == e && boolWithDefault(options, "keep_result", false)
+}
+
+// render returns the output of the handler without performing it, such as the
+// http request or the mail message.
+func (self *Job) render() (map[string]interface{}, error) {
+	job, e := self.payload_object()
+	if nil != e {
+		return nil, e
+	}
+	r, ok := job.(Renderer)
+	if !ok {
+		return nil, errors.New("handler '" + self.typeName() + "' doesn't support the dry run.")
+	}
+	return r.Render()
+}
+
 func (self *Job) needReschedule() (time.Time, bool) {
 	if self.repeat_count <= 0 {
 		return time.Time{}, false
@@ -231,6 +345,38 @@ default_duration:
 	return self.backend.db_time_now().Add(duration).Add(5 + time.Second)
 }
 
+func (self *Job) isExpired(now time.Time) bool {
+	return !self.expires_at.IsZero() && !now.Before(self.expires_at)
+}
+
+// fallbackJob creates the job that is enqueued when this job expired, it is
+// configured by 'on_expired' in the handler. 'on_expired' is either a job
+// (with a 'handler' field) or a handler only, which inherits priority and
+// queue from this job.
+func (self *Job) fallbackJob() (*Job, error) {
+	options, e := self.attributes()
+	if nil != e {
+		return nil, e
+	}
+
+	o, ok := options["on_expired"]
+	if !ok || nil == o {
+		return nil, nil
+	}
+
+	args, ok := o.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'on_expired' is not a map - %T", o)
+	}
+
+	if _, ok := args["handler"]; !ok {
+		args = map[string]interface{}{"priority": self.priority,
+			"queue":   self.queue,
+			"handler": args}
+	}
+	return createJobFromMap(self.backend, args)
+}
+
 func (self *Job) get_max_attempts() int {
 	return self.max_attempts
 }
@@ -246,7 +392,7 @@ func (self *Job) execTimeout() time.Duration {
 		if nil == e {
 			return i
 		}
-		log.Println("[warn] [", self.id, self.name(), "] parse exec_timeout(", m, ") failed,", e)
+		self.logger().Warn("parse exec_timeout failed", "exec_timeout", m, "error", e)
 	}
 	return MaxJobTimeout
 }
@@ -288,7 +434,9 @@ func (self *Job) will_update_attributes() map[string]interface{} {
 	return self.changed_attributes
 }
 
-func (self *Job) rescheduleIt(next_time time.Time, err string) error {
+// rescheduleIt updates the job to run at next_time, the callbacks are created
+// with the update in a transaction.
+func (self *Job) rescheduleIt(next_time time.Time, err string, callbacks ...*Job) error {
 	if len(err) > 2000 {
 		err = err[:1900] + "\r\n===========================\r\n**error message is overflow."
 	}
@@ -298,6 +446,8 @@ func (self *Job) rescheduleIt(next_time time.Time, err string) error {
 	self.locked_at = time.Time{}
 	self.locked_by = ""
 	self.last_error = err
+	self.progress = 0
+	self.progress_message = ""
 
 	changed := self.will_update_attributes()
 	e := stringifiedHander(changed)
@@ -309,25 +459,33 @@ func (self *Job) rescheduleIt(next_time time.Time, err string) error {
 	changed["@locked_at"] = nil
 	changed["@locked_by"] = nil
 	changed["@last_error"] = err
+	changed["@progress"] = nil
+	changed["@progress_message"] = nil
 	if "" == err {
 		changed["@repeat_count"] = self.repeat_count - 1
 	}
 
-	e = self.backend.update(self.id, changed)
+	e = self.backend.changeWith(callbacks, func(db sqlExecutor) error {
+		return self.backend.updateWith(db, self.id, changed)
+	})
 	self.changed_attributes = nil
 	return e
 }
 
-func (self *Job) failIt(err string) error {
+func (self *Job) failIt(err string, callbacks ...*Job) error {
 	if len(err) > 2000 {
 		err = err[:1900] + "\r\n===========================\r\n**error message is overflow."
 	}
 	now := self.backend.db_time_now()
 	self.failed_at = now
 	self.last_error = err
-	return self.backend.update(self.id, map[string]interface{}{"@failed_at": now, "@last_error": err})
+	return self.backend.changeWith(callbacks, func(db sqlExecutor) error {
+		return self.backend.updateWith(db, self.id, map[string]interface{}{"@failed_at": now, "@last_error": err})
+	})
 }
 
-func (self *Job) destroyIt() error {
-	return self.backend.destroy(self.id)
+func (self *Job) destroyIt(callbacks ...*Job) error {
+	return self.backend.changeWith(callbacks, func(db sqlExecutor) error {
+		return self.backend.destroyWith(db, self.id)
+	})
 }
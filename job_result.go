@@ -0,0 +1,162 @@
+package delayed_job
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"time"
+)
+
+var result_ttl = flag.Duration("result_ttl", 72*time.Hour, "the lifetime of the results of the finished jobs, 0 is disabled")
+
+// the max length of the text in the result, the rest is truncated.
+const max_result_text = 64 * 1024
+
+func truncateResultText(s string) string {
+	if len(s) > max_result_text {
+		return s[:max_result_text] + "\r\n**result is overflow."
+	}
+	return s
+}
+
+// resultTable is the table which keeps the results of the finished jobs, the
+// job itself is destroyed after it is completed.
+func (self *dbBackend) resultTable() string {
+	return self.table + "_results"
+}
+
+func (self *dbBackend) resultTableScripts() []string {
+	switch self.dbType {
+	case MSSQL:
+		return []string{`if object_id('dbo.` + self.resultTable() + `', 'U') is not null
+				BEGIN
+							 DROP TABLE ` + self.resultTable() + `;
+				END`,
+			`CREATE TABLE dbo.` + self.resultTable() + ` (
+						  job_id            INT NOT NULL,
+						  handler_id        varchar(200),
+						  status            varchar(20) NOT NULL,
+						  result            text,
+						  last_error        varchar(2000),
+						  created_at        DATETIME2 NOT NULL
+						);`}
+	case POSTGRESQL:
+		return []string{`DROP TABLE IF EXISTS ` + self.resultTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.resultTable() + ` (
+				  job_id            int NOT NULL,
+				  handler_id        varchar(200),
+				  status            varchar(20) NOT NULL,
+				  result            text,
+				  last_error        varchar(2000),
+				  created_at        timestamp with time zone NOT NULL
+				);`}
+	case ORACLE:
+		return []string{`BEGIN EXECUTE IMMEDIATE 'DROP TABLE ` + self.resultTable() + `';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE TABLE ` + self.resultTable() + ` (
+					  job_id            NUMBER(10) NOT NULL,
+					  handler_id        varchar2(200 BYTE),
+					  status            varchar2(20 BYTE) NOT NULL,
+					  result            clob,
+					  last_error        VARCHAR2(2000 BYTE),
+					  created_at        DATE
+					)`}
+	default:
+		return []string{`DROP TABLE IF EXISTS ` + self.resultTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.resultTable() + ` (
+					  job_id            int NOT NULL,
+					  handler_id        varchar(200),
+					  status            varchar(20) NOT NULL,
+					  result            text,
+					  last_error        VARCHAR(2000),
+					  created_at        DATETIME NOT NULL
+					);`}
+	}
+}
+
+// saveResult keeps the result of the job, status is "completed" or "failed".
+func (self *dbBackend) saveResult(job *Job, status string, result interface{}, last_error string) error {
+	var payload sql.NullString
+	if nil != result {
+		bs, e := json.Marshal(result)
+		if nil != e {
+			return errors.New("marshal result failed, " + e.Error())
+		}
+		payload.Valid = true
+		payload.String = string(bs)
+	}
+	if len(last_error) > 2000 {
+		last_error = last_error[:1900] + "\r\n===========================\r\n**error message is overflow."
+	}
+
+	now := self.db_time_now()
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := self.db.Exec("INSERT INTO "+self.resultTable()+"(job_id, handler_id, status, result, last_error, created_at) VALUES ("+
+		args.add(job.id)+", "+args.add(job.handler_id)+", "+args.add(status)+", "+args.add(payload)+", "+
+		args.add(last_error)+", "+self.nowSQL(args, now)+")", args.values...)
+	if nil != e {
+		return errors.New("save result failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// jobResult returns the latest result of the job by id, or by handler_id if
+// id is 0, it returns nil if the result is not found.
+func (self *dbBackend) jobResult(id int64, handler_id string) (map[string]interface{}, error) {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	var where string
+	if 0 != id {
+		where = " WHERE job_id = " + args.add(id)
+	} else {
+		where = " WHERE handler_id = " + args.add(handler_id)
+	}
+
+	rows, e := self.db.Query("SELECT job_id, handler_id, status, result, last_error, created_at FROM "+self.resultTable()+
+		where+" ORDER BY created_at DESC", args.values...)
+	if nil != e {
+		return nil, errors.New("query result failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if e = rows.Err(); nil != e {
+			return nil, errors.New("query result failed, " + i18nString(self.dbType, self.drv, e))
+		}
+		return nil, nil
+	}
+
+	var job_id int64
+	var job_handler_id sql.NullString
+	var status string
+	var payload sql.NullString
+	var last_error sql.NullString
+	var created_at NullTime
+	e = rows.Scan(&job_id, &job_handler_id, &status, &payload, &last_error, &created_at)
+	if nil != e {
+		return nil, errors.New("scan result failed, " + i18nString(self.dbType, self.drv, e))
+	}
+
+	result := map[string]interface{}{"id": job_id,
+		"handler_id": job_handler_id.String,
+		"status":     status}
+	if payload.Valid {
+		result["result"] = json.RawMessage(payload.String)
+	}
+	if last_error.Valid && 0 != len(last_error.String) {
+		result["last_error"] = last_error.String
+	}
+	if created_at.Valid {
+		result["created_at"] = created_at.Time
+	}
+	return result, nil
+}
+
+// pruneResults removes the results which are older than the time.
+func (self *dbBackend) pruneResults(before time.Time) error {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	_, e := self.db.Exec("DELETE FROM "+self.resultTable()+" WHERE created_at < "+args.add(before), args.values...)
+	if nil != e && sql.ErrNoRows != e {
+		return errors.New("prune results failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncateResultText(t *testing.T) {
+	if s := truncateResultText("abc"); "abc" != s {
+		t.Error("excepted is 'abc', actual is", s)
+	}
+	if s := truncateResultText(strings.Repeat("a", max_result_text+10)); !strings.HasSuffix(s, "**result is overflow.") {
+		t.Error("excepted is truncated, actual is", s[len(s)-30:])
+	}
+}
+
+func TestWebHandlerResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	handler, e := newHandler(nil, map[string]interface{}{"type": "web", "method": "GET", "url": srv.URL})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if e = handler.Perform(); nil != e {
+		t.Error(e)
+		return
+	}
+
+	result, ok := handler.(Resulter).Result().(map[string]interface{})
+	if !ok {
+		t.Error("excepted result is a map, actual is", handler.(Resulter).Result())
+		return
+	}
+	if http.StatusOK != result["status_code"] || "hello" != result["body"] {
+		t.Error("excepted result is [200 hello], actual is", result)
+	}
+}
+
+func TestJobResult(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		job := &Job{backend: backend, id: 12, handler_id: "abc"}
+		e := backend.saveResult(job, "completed", map[string]interface{}{"output": "ok"}, "")
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		front := &webFront{dbBackend: backend}
+		for _, key := range []string{"12", "abc"} {
+			r := httptest.NewRecorder()
+			front.ServeHTTP(r, httptest.NewRequest("GET", "/delayed_jobs/jobs/"+key+"/result", nil))
+			if http.StatusOK != r.Code {
+				t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+				continue
+			}
+
+			var result map[string]interface{}
+			if e := json.Unmarshal(r.Body.Bytes(), &result); nil != e {
+				t.Error(e)
+				continue
+			}
+			if "completed" != result["status"] {
+				t.Error("excepted status is 'completed', actual is", result["status"])
+			}
+			if m, ok := result["result"].(map[string]interface{}); !ok || "ok" != m["output"] {
+				t.Error("excepted result is {output: ok}, actual is", result["result"])
+			}
+		}
+
+		r := httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("GET", "/jobs/13/result", nil))
+		if http.StatusNotFound != r.Code {
+			t.Error("excepted code is 404, actual is", r.Code, r.Body.String())
+		}
+
+		e = backend.pruneResults(backend.db_time_now().Add(1 * time.Minute))
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		result, e := backend.jobResult(12, "")
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil != result {
+			t.Error("excepted result is pruned, actual is", result)
+		}
+	})
+}
+
+func TestKeepResult(t *testing.T) {
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+	job, e := createJobFromMap(backend, map[string]interface{}{"keep_result": true,
+		"handler": map[string]interface{}{"type": "test"}})
+	if nil != e {
+		t.Fatal(e)
+	}
+	if !job.keepResult() {
+		t.Error("excepted keep_result is copied to the handler")
+	}
+
+	job, e = createJobFromMap(backend, map[string]interface{}{"handler": map[string]interface{}{"type": "test"}})
+	if nil != e {
+		t.Fatal(e)
+	}
+	if job.keepResult() {
+		t.Error("excepted the result isn't kept by default")
+	}
+}
+
+func TestIsQueryStatement(t *testing.T) {
+	for _, test := range []struct {
+		statement string
+		is_query  bool
+	}{{statement: "select * from a", is_query: true},
+		{statement: "  WITH t AS (SELECT 1) SELECT * FROM t", is_query: true},
+		{statement: "(SELECT 1) UNION (SELECT 2)", is_query: true},
+		{statement: "update a set b = 1", is_query: false},
+		{statement: "", is_query: false}} {
+		if is_query := isQueryStatement(test.statement); test.is_query != is_query {
+			t.Error("excepted", test.statement, "is", test.is_query, ", actual is", is_query)
+		}
+	}
+	if nil != (&dbHandler{}).Result() {
+		t.Error("excepted result is nil before the script is executed")
+	}
+}
@@ -0,0 +1,84 @@
+package delayed_job
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadlineWithDefault(t *testing.T) {
+	run_at := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+
+	if deadline := backend.deadlineWithDefault(map[string]interface{}{}, run_at, time.Time{}); !deadline.IsZero() {
+		t.Error("excepted deadline is zero, actual is", deadline)
+	}
+
+	deadline := backend.deadlineWithDefault(map[string]interface{}{"ttl": "6h"}, run_at, time.Time{})
+	if !deadline.Equal(run_at.Add(6 * time.Hour)) {
+		t.Error("excepted deadline is", run_at.Add(6*time.Hour), ", actual is", deadline)
+	}
+
+	expires_at := time.Date(2016, 1, 2, 5, 0, 0, 0, time.UTC)
+	deadline = backend.deadlineWithDefault(map[string]interface{}{"ttl": "6h", "expires_at": expires_at}, run_at, time.Time{})
+	if !deadline.Equal(expires_at) {
+		t.Error("excepted deadline is", expires_at, ", actual is", deadline)
+	}
+}
+
+func TestCreateJobWithTTL(t *testing.T) {
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+	run_at := time.Now()
+	job, e := createJobFromMap(backend, map[string]interface{}{
+		"priority":   1,
+		"queue":      "aa",
+		"run_at":     run_at,
+		"ttl":        "1m",
+		"on_expired": map[string]interface{}{"type": "test", "content": "fallback"},
+		"handler":    map[string]interface{}{"type": "test"}})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	if !job.expires_at.Equal(run_at.Add(time.Minute)) {
+		t.Error("excepted expires_at is", run_at.Add(time.Minute), ", actual is", job.expires_at)
+	}
+	if job.isExpired(run_at) {
+		t.Error("excepted job is not expired at", run_at)
+	}
+	if !job.isExpired(run_at.Add(time.Minute)) {
+		t.Error("excepted job is expired at", run_at.Add(time.Minute))
+	}
+
+	fallback, e := job.fallbackJob()
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if nil == fallback {
+		t.Error("excepted fallback is not nil")
+		return
+	}
+	if 1 != fallback.priority || "aa" != fallback.queue {
+		t.Error("excepted fallback inherits priority and queue, actual is", fallback.priority, fallback.queue)
+	}
+	if "fallback" != stringWithDefault(fallback.handler_attributes, "content", "") {
+		t.Error("excepted content of fallback is 'fallback', actual is", fallback.handler_attributes)
+	}
+}
+
+func TestCreateJobWithPreciseRunAt(t *testing.T) {
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+	job, e := createJobFromMap(backend, map[string]interface{}{
+		"run_at":  "2016-01-02T03:04:05.123Z",
+		"handler": map[string]interface{}{"type": "test"}})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	excepted := time.Date(2016, 1, 2, 3, 4, 5, 123*int(time.Millisecond), time.UTC)
+	if !job.run_at.Equal(excepted) {
+		t.Error("excepted run_at is", excepted, ", actual is", job.run_at)
+	}
+}
@@ -0,0 +1,160 @@
+package delayed_job
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventEnqueue          = "enqueue"
+	EventBeforePerform    = "before_perform"
+	EventAfterSuccess     = "after_success"
+	EventAfterFailure     = "after_failure"
+	EventPermanentFailure = "permanent_failure"
+	EventBeforeFork       = "before_fork"
+	EventAfterFork        = "after_fork"
+)
+
+var (
+	default_middlewares = flag.String("middlewares", "", "the names of the middlewares around the job execution, separated by comma")
+	default_hooks       = flag.String("lifecycle_hooks", "", "the names of the lifecycle hooks, separated by comma")
+
+	lifecycle_lock sync.RWMutex
+	middlewares    = map[string]Middleware{}
+	hooks          = map[string]Hook{}
+)
+
+// JobInfo is the snapshot of a job which is passed to the middlewares and the
+// hooks, ID is 0 in the enqueue event.
+type JobInfo struct {
+	ID          int64
+	HandlerID   string
+	Type        string
+	Name        string
+	Queue       string
+	Priority    int
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+}
+
+// Middleware wraps the execution of a job, it calls next to run the handler
+// (and the inner middlewares) and may change the returned error. It runs in
+// the goroutine of the handler, so a panic of the handler passes through it,
+// the panic which isn't recovered is returned as a *PanicError.
+type Middleware func(job *JobInfo, next func() error) error
+
+// Hook is notified with the event of the job, e is the error of the job in
+// the after_failure and the permanent_failure events. The before_fork and the
+// after_fork events are fired when a worker starts, the job is empty.
+type Hook func(event string, job *JobInfo, e error)
+
+// RegisterMiddleware registers a middleware by the name, it is enabled by the
+// 'middlewares' flag (or the config file) or Options.Middlewares.
+func RegisterMiddleware(name string, middleware Middleware) {
+	lifecycle_lock.Lock()
+	defer lifecycle_lock.Unlock()
+	middlewares[name] = middleware
+}
+
+// RegisterHook registers a hook by the name, it is enabled by the
+// 'lifecycle_hooks' flag (or the config file) or Options.Hooks.
+func RegisterHook(name string, hook Hook) {
+	lifecycle_lock.Lock()
+	defer lifecycle_lock.Unlock()
+	hooks[name] = hook
+}
+
+// splitNames splits the names in the flag, the list in the config file is
+// formatted as "[a b]".
+func splitNames(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return ',' == r || ' ' == r
+	})
+}
+
+type lifecycle struct {
+	middlewares []Middleware
+	hooks       []Hook
+}
+
+func newLifecycle(middleware_names, hook_names []string) (*lifecycle, error) {
+	lifecycle_lock.RLock()
+	defer lifecycle_lock.RUnlock()
+
+	lc := &lifecycle{}
+	for _, name := range middleware_names {
+		middleware, ok := middlewares[name]
+		if !ok {
+			return nil, errors.New("middleware '" + name + "' is not registered.")
+		}
+		lc.middlewares = append(lc.middlewares, middleware)
+	}
+	for _, name := range hook_names {
+		hook, ok := hooks[name]
+		if !ok {
+			return nil, errors.New("hook '" + name + "' is not registered.")
+		}
+		lc.hooks = append(lc.hooks, hook)
+	}
+	return lc, nil
+}
+
+// invoke runs perform in the middlewares, the first middleware is outermost.
+func (self *lifecycle) invoke(job *JobInfo, perform func() error) error {
+	if nil == self {
+		return perform()
+	}
+
+	next := perform
+	for i := len(self.middlewares) - 1; i >= 0; i-- {
+		middleware, inner := self.middlewares[i], next
+		next = func() error {
+			return middleware(job, inner)
+		}
+	}
+	return next()
+}
+
+// fire notifies the hooks, a panic in the hook is logged and ignored.
+func (self *lifecycle) fire(event string, job *JobInfo, e error) {
+	if nil == self {
+		return
+	}
+
+	for _, hook := range self.hooks {
+		func() {
+			defer func() {
+				if o := recover(); nil != o {
+					defaultLogger().Error("lifecycle hook panic", "event", event, "panic", fmt.Sprint(o))
+				}
+			}()
+			hook(event, job, e)
+		}()
+	}
+}
+
+func (self *Job) info() *JobInfo {
+	info := &JobInfo{ID: self.id,
+		HandlerID:   self.handler_id,
+		Name:        self.name(),
+		Queue:       self.queue,
+		Priority:    self.priority,
+		Attempts:    self.attempts,
+		MaxAttempts: self.max_attempts,
+		RunAt:       self.run_at,
+		Type:        self.typeName()}
+	return info
+}
+
+func (self *Job) typeName() string {
+	if attributes, e := self.attributes(); nil == e {
+		return stringWithDefault(attributes, "type", "")
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package delayed_job
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitNames(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		excepted string
+	}{{s: "", excepted: ""},
+		{s: "a", excepted: "a"},
+		{s: "a,b", excepted: "a|b"},
+		{s: "[a b]", excepted: "a|b"},
+		{s: " a, b ", excepted: "a|b"}} {
+		if actual := strings.Join(splitNames(test.s), "|"); test.excepted != actual {
+			t.Errorf("excepted names of %q is %q, actual is %q", test.s, test.excepted, actual)
+		}
+	}
+}
+
+func TestLifecycleInvoke(t *testing.T) {
+	var calls []string
+	RegisterMiddleware("test_outer", func(job *JobInfo, next func() error) error {
+		calls = append(calls, "outer:"+job.HandlerID)
+		e := next()
+		calls = append(calls, "outer_end")
+		return e
+	})
+	RegisterMiddleware("test_inner", func(job *JobInfo, next func() error) error {
+		calls = append(calls, "inner")
+		if e := next(); nil != e {
+			return errors.New("wrapped " + e.Error())
+		}
+		return nil
+	})
+	RegisterHook("test_panic", func(event string, job *JobInfo, e error) {
+		panic("test")
+	})
+	RegisterHook("test_record", func(event string, job *JobInfo, e error) {
+		calls = append(calls, "hook:"+event)
+	})
+	defer func() {
+		delete(middlewares, "test_outer")
+		delete(middlewares, "test_inner")
+		delete(hooks, "test_panic")
+		delete(hooks, "test_record")
+	}()
+
+	if _, e := newLifecycle([]string{"test_not_exists"}, nil); nil == e {
+		t.Error("excepted error is not nil, actual is nil")
+	}
+
+	lc, e := newLifecycle([]string{"test_outer", "test_inner"}, []string{"test_panic", "test_record"})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	e = lc.invoke(&JobInfo{HandlerID: "abc"}, func() error {
+		calls = append(calls, "perform")
+		return errors.New("failed")
+	})
+	if nil == e || "wrapped failed" != e.Error() {
+		t.Error("excepted error is 'wrapped failed', actual is", e)
+	}
+	lc.fire(EventAfterFailure, &JobInfo{}, e)
+
+	excepted := "outer:abc,inner,perform,outer_end,hook:after_failure"
+	if actual := strings.Join(calls, ","); excepted != actual {
+		t.Error("excepted calls is", excepted, ", actual is", actual)
+	}
+
+	var nil_lc *lifecycle
+	if e = nil_lc.invoke(&JobInfo{}, func() error { return nil }); nil != e {
+		t.Error(e)
+	}
+	nil_lc.fire(EventEnqueue, &JobInfo{}, nil)
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	events := make(chan string, 10)
+	RegisterHook("test_events", func(event string, job *JobInfo, e error) {
+		if "test" == job.Type {
+			events <- event
+		}
+	})
+	defer delete(hooks, "test_events")
+
+	workTest(t, func(w *worker, backend *dbBackend) {
+		lc, e := newLifecycle(nil, []string{"test_events"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		backend.lifecycle = lc
+		w.backend.lifecycle = lc
+
+		e = backend.enqueue(1, 0, "", 1, "aa", time.Time{}, map[string]interface{}{"type": "test", "error": "throw a"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		var actual []string
+		for len(actual) < 3 {
+			select {
+			case event := <-events:
+				actual = append(actual, event)
+			case <-time.After(3 * time.Second):
+				t.Error("excepted events are received, actual is", actual)
+				return
+			}
+		}
+		excepted := "enqueue,before_perform,after_failure"
+		if excepted != strings.Join(actual, ",") {
+			t.Error("excepted events is", excepted, ", actual is", actual)
+		}
+	})
+}
+
+type testPanicHandler struct{}
+
+func (self testPanicHandler) Perform() error {
+	panic("test panic")
+}
+
+func TestLifecyclePanic(t *testing.T) {
+	Handlers["test_panic"] = func(ctx, options map[string]interface{}) (Handler, error) {
+		return testPanicHandler{}, nil
+	}
+	var recovered interface{}
+	RegisterMiddleware("test_recover", func(job *JobInfo, next func() error) error {
+		defer func() {
+			recovered = recover()
+		}()
+		return next()
+	})
+	RegisterMiddleware("test_observe", func(job *JobInfo, next func() error) error {
+		defer func() {
+			if o := recover(); nil != o {
+				recovered = o
+				panic(o)
+			}
+		}()
+		return next()
+	})
+	defer func() {
+		delete(Handlers, "test_panic")
+		delete(middlewares, "test_recover")
+		delete(middlewares, "test_observe")
+	}()
+
+	job, e := createJobFromMap(&dbBackend{ctx: map[string]interface{}{}}, map[string]interface{}{
+		"handler": map[string]interface{}{"type": "test_panic"}})
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	lc, e := newLifecycle([]string{"test_recover"}, nil)
+	if nil != e {
+		t.Fatal(e)
+	}
+	if e = job.invokeJobWith(lc, job.info()); nil != e || "test panic" != recovered {
+		t.Error("excepted the panic is recovered by the middleware, actual is", recovered, e)
+	}
+
+	recovered = nil
+	lc, e = newLifecycle([]string{"test_observe"}, nil)
+	if nil != e {
+		t.Fatal(e)
+	}
+	e = job.invokeJobWith(lc, job.info())
+	if pe, ok := e.(*PanicError); !ok || "test panic" != pe.Value || "test panic" != recovered {
+		t.Error("excepted the panic is passed through the middleware, actual is", recovered, e)
+	} else if !strings.HasPrefix(e.Error(), "[panic]test panic") {
+		t.Error("excepted error starts with '[panic]test panic', actual is", e)
+	}
+}
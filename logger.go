@@ -0,0 +1,262 @@
+package delayed_job
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	log_level  = flag.String("log_level", "info", "the level of log, debug, info, warn or error")
+	log_format = flag.String("log_format", "text", "the format of log, text (logfmt) or json")
+
+	// the keys which contain the words are redacted in the log.
+	sensitive_words = []string{"password", "passwd", "pwd", "secret", "token", "authorization", "api_key", "apikey", "access_key", "private_key", "cookie"}
+
+	// the user and the password of the urls in a message.
+	url_password_pattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^\s/:@"']+:)[^\s/@"']*@`)
+
+	logger_lock    sync.RWMutex
+	default_logger *slog.Logger
+)
+
+const redacted = "******"
+
+// Loggable is implemented by the handler which logs during Perform, the logger
+// is set before Perform is called and it has the fields of the job.
+type Loggable interface {
+	SetLogger(logger *slog.Logger)
+}
+
+// SetLogger replaces the logger of the package, the sensitive fields are
+// redacted before they are passed to the handler of the logger.
+func SetLogger(logger *slog.Logger) {
+	logger_lock.Lock()
+	defer logger_lock.Unlock()
+	if nil == logger {
+		default_logger = nil
+		return
+	}
+	default_logger = slog.New(&redactHandler{inner: logger.Handler()})
+}
+
+// initLogger creates the logger from the 'log_level' and 'log_format' flags.
+func initLogger() error {
+	logger, e := newLogger(logWriter{}, *log_format, *log_level)
+	if nil != e {
+		return e
+	}
+
+	logger_lock.Lock()
+	defer logger_lock.Unlock()
+	default_logger = logger
+	return nil
+}
+
+func defaultLogger() *slog.Logger {
+	logger_lock.RLock()
+	logger := default_logger
+	logger_lock.RUnlock()
+	if nil != logger {
+		return logger
+	}
+
+	logger, e := newLogger(logWriter{}, *log_format, *log_level)
+	if nil != e {
+		logger, _ = newLogger(logWriter{}, "text", "info")
+	}
+
+	logger_lock.Lock()
+	defer logger_lock.Unlock()
+	if nil == default_logger {
+		default_logger = logger
+	}
+	return default_logger
+}
+
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if e := lvl.UnmarshalText([]byte(level)); nil != e {
+		return nil, errors.New("log level '" + level + "' is unsupported.")
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "", "text", "logfmt":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, errors.New("log format '" + format + "' is unsupported.")
+	}
+	return slog.New(&redactHandler{inner: handler}), nil
+}
+
+// logWriter writes to the output of the standard log package, so that
+// log.SetOutput takes effect on the logger.
+type logWriter struct{}
+
+func (logWriter) Write(bs []byte) (int, error) {
+	return log.Writer().Write(bs)
+}
+
+// redactHandler replaces the values of the sensitive fields and the password
+// in the urls.
+type redactHandler struct {
+	inner slog.Handler
+}
+
+func (self *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return self.inner.Enabled(ctx, level)
+}
+
+func (self *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted_record := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted_record.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return self.inner.Handle(ctx, redacted_record)
+}
+
+func (self *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted_attrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted_attrs[i] = redactAttr(attr)
+	}
+	return &redactHandler{inner: self.inner.WithAttrs(redacted_attrs)}
+}
+
+func (self *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: self.inner.WithGroup(name)}
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitive_words {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		attrs := value.Group()
+		redacted_attrs := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted_attrs[i] = redactAttr(a)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted_attrs...)}
+	case slog.KindString:
+		return slog.String(attr.Key, redactString(value.String()))
+	case slog.KindAny:
+		return slog.Any(attr.Key, redactValue(value.Any()))
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactValue redacts the sensitive keys in the maps and the passwords of the
+// urls in the strings and the errors.
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			if isSensitive(k) {
+				copied[k] = redacted
+			} else {
+				copied[k] = redactValue(item)
+			}
+		}
+		return copied
+	case map[string]string:
+		copied := make(map[string]string, len(value))
+		for k, item := range value {
+			if isSensitive(k) {
+				copied[k] = redacted
+			} else {
+				copied[k] = redactString(item)
+			}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = redactValue(item)
+		}
+		return copied
+	case []string:
+		copied := make([]string, len(value))
+		for i, item := range value {
+			copied[i] = redactString(item)
+		}
+		return copied
+	case string:
+		return redactString(value)
+	case error:
+		if nil == value {
+			return v
+		}
+		return redactString(value.Error())
+	case *url.URL:
+		if nil == value {
+			return value
+		}
+		return value.Redacted()
+	}
+	return v
+}
+
+// redactString hides the password of the url in the string, the string may be
+// a message which contains the urls (such as an error).
+func redactString(s string) string {
+	if !strings.Contains(s, "://") || !strings.Contains(s, "@") {
+		return s
+	}
+	u, e := url.Parse(s)
+	if nil != e || nil == u.User {
+		return url_password_pattern.ReplaceAllString(s, "${1}xxxxx@")
+	}
+	if _, has_password := u.User.Password(); !has_password {
+		return s
+	}
+	return u.Redacted()
+}
+
+// sprint formats the text as log.Println without the newline.
+func sprint(text ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(text...), "\n")
+}
+
+// handlerLogger is embedded by the handlers which implement Loggable.
+type handlerLogger struct {
+	logger *slog.Logger
+}
+
+func (self *handlerLogger) SetLogger(logger *slog.Logger) {
+	self.logger = logger
+}
+
+func (self *handlerLogger) log() *slog.Logger {
+	if nil == self.logger {
+		return defaultLogger()
+	}
+	return self.logger
+}
@@ -41,6 +41,11 @@ var (
 	Decrypt     = func(s string) string {
 		return s
 	}
+	// Encrypt is the reverse of Decrypt, the secrets in the jobs (such as the
+	// secret of the webhook) are saved after they are encrypted.
+	Encrypt = func(s string) string {
+		return s
+	}
 	GetUserMail func(id string) (string, error)
 )
 
@@ -63,6 +68,8 @@ type mailHandler struct {
 	host        string
 	removeFiles []string
 	closers     []io.Closer
+
+	handlerLogger
 }
 
 func toAddressListString(addresses []*mail.Address) string {
@@ -295,7 +302,7 @@ func newMailHandler(ctx, params map[string]interface{}) (Handler, error) {
 			}
 
 			if GetUserMail == nil {
-				log.Println("GetUserMail hook is empty")
+				defaultLogger().Warn("GetUserMail hook is empty")
 				continue
 			}
 			mailAddr, err := GetUserMail(id)
@@ -303,9 +310,9 @@ func newMailHandler(ctx, params map[string]interface{}) (Handler, error) {
 				return nil, err
 			}
 			if mailAddr == "" {
-				log.Println("mail is missing for user", id)
+				defaultLogger().Warn("mail is missing for user", "user", id)
 			} else if addr, err := mail.ParseAddress(mailAddr); err != nil {
-				log.Println("mail '", mailAddr, "' is invalid for user", id)
+				defaultLogger().Warn("mail is invalid for user", "user", id, "mail", mailAddr)
 			} else {
 				users = append(users, addr)
 				// log.Println("mail is '", mailAddr, "' for user", id)
@@ -413,6 +420,35 @@ func (self *mailHandler) Perform() error {
 		return nil
 	}
 
+	e := self.send()
+	observeDelivery("smtp", e)
+	return e
+}
+
+// Render returns the MIME message which would be sent, the files of the
+// attachments are closed but not removed.
+func (self *mailHandler) Render() (map[string]interface{}, error) {
+	defer func() {
+		for _, closer := range self.closers {
+			closer.Close()
+		}
+		self.closers = nil
+	}()
+
+	bs, e := self.message.Bytes()
+	if nil != e {
+		return nil, e
+	}
+	return map[string]interface{}{"smtp_server": self.smtpServer,
+		"from":    toMailString(&self.message.From),
+		"to":      toAddressListString(self.message.To),
+		"cc":      toAddressListString(self.message.Cc),
+		"bcc":     toAddressListString(self.message.Bcc),
+		"subject": self.message.Subject,
+		"message": string(bs)}, nil
+}
+
+func (self *mailHandler) send() error {
 	close := func() {
 		if len(self.closers) > 0 {
 			for _, closer := range self.closers {
@@ -423,7 +459,7 @@ func (self *mailHandler) Perform() error {
 
 		for _, nm := range self.removeFiles {
 			if e := os.Remove(nm); nil != e {
-				log.Println("[warn] [mail] remove file - '"+nm+"',", e)
+				self.log().Warn("remove file failed", "file", nm, "error", e)
 			}
 		}
 	}
@@ -472,11 +508,17 @@ func (self *mailHandler) Perform() error {
 		timer.Stop()
 
 		if nil != e {
-			fmt.Println(cmd.Path, cmd.Args)
+			args := append([]string(nil), cmd.Args...)
+			for i := 1; i < len(args); i++ {
+				if "-pw" == args[i-1] {
+					args[i] = redacted
+				}
+			}
+			self.log().Warn("execute blat failed", "path", cmd.Path, "args", args)
 			return errors.New(string(output))
 		}
 
-		log.Println("################\r\n" + string(output) + "\r\n################")
+		self.log().Debug("execute blat", "output", string(output))
 		// if !bytes.Contains(output, []byte(excepted)) {
 		// 	return errors.New(string(output))
 		// }
@@ -569,4 +611,33 @@ func init() {
 	Handlers["mail_command"] = newMailHandler
 	Handlers["smtp"] = newMailHandler
 	Handlers["smtp_command"] = newMailHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "mail",
+		Description: "send the mail by the smtp server",
+		Aliases:     []string{"mail_command", "smtp", "smtp_command"},
+		Params: []HandlerParam{{Name: "subject", Type: "string", Required: true, Template: true,
+			Description: "the subject of the mail"},
+			{Name: "content", Type: "string", Template: true, Aliases: []string{"content_text", "content_html"},
+				Description: "the content of the mail, 'content_text' or 'content_html' is used if it is missing"},
+			{Name: "content_type", Type: "string", Allowed: []string{"", "text", "html"},
+				Description: "the type of 'content'"},
+			{Name: "from_address", Type: "any",
+				Description: "the sender, such as 'a@b.com' or {\"name\": \"a\", \"address\": \"a@b.com\"}, it is '-mail.from' if missing"},
+			{Name: "to_address", Type: "any",
+				Description: "the recipients, the addresses are separated by the comma or the new line"},
+			{Name: "cc_address", Type: "any", Description: "the cc recipients"},
+			{Name: "bcc_address", Type: "any", Description: "the bcc recipients"},
+			{Name: "to_mail_addresses", Type: "any", Description: "the other recipients"},
+			{Name: "users", Type: "strings", Description: "the ids of the users whose mails are the recipients"},
+			{Name: "attachments", Type: "array",
+				Description: "the files, such as '/a/b.txt' or {\"name\": \"b.txt\", \"file\": \"/a/b.txt\", \"is_removed\": true}"},
+			{Name: "smtp_server", Type: "string", Description: "the address of the smtp server, it is '-mail.smtp_server' if missing"},
+			{Name: "user", Type: "string", Description: "the user of the smtp auth, the '-mail.auth.*' are used if missing"},
+			{Name: "password", Type: "string", Secret: true, Description: "the password of the smtp auth"},
+			{Name: "auth_type", Type: "string", Default: "plain", Allowed: []string{"login", "plain", "cram-md5", "ntlm", "ntlmv1", "ntlmv2"},
+				Description: "the type of the smtp auth"},
+			{Name: "identity", Type: "string", Description: "the identity of the smtp auth"},
+			{Name: "host", Type: "string", Description: "the host of the smtp auth, it is the host of smtp_server if missing"},
+			param_arguments},
+		TemplateArgs: default_template_args})
 }
@@ -0,0 +1,268 @@
+package delayed_job
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	metric_jobs_enqueued  = newCounterVec("delayed_job_jobs_enqueued_total", "The count of the enqueued jobs.", "queue", "type")
+	metric_jobs_succeeded = newCounterVec("delayed_job_jobs_succeeded_total", "The count of the succeeded jobs.", "queue", "type")
+	metric_jobs_failed    = newCounterVec("delayed_job_jobs_failed_total", "The count of the jobs which are failed permanently.", "queue", "type")
+	metric_jobs_retried   = newCounterVec("delayed_job_jobs_retried_total", "The count of the failed jobs which are rescheduled.", "queue", "type")
+	metric_jobs_expired   = newCounterVec("delayed_job_jobs_expired_total", "The count of the expired jobs.", "queue", "type")
+	metric_job_duration   = newHistogramVec("delayed_job_job_duration_seconds", "The execution time of the jobs.",
+		[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}, "queue", "type")
+	metric_queue_lag = newHistogramVec("delayed_job_queue_lag_seconds", "The delay from run_at to the reservation of the jobs.",
+		[]float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800, 3600}, "queue")
+	metric_lock_steals = newCounterVec("delayed_job_lock_steals_total", "The count of the jobs which are reserved after the lock of other worker is expired.")
+	metric_deliveries  = newCounterVec("delayed_job_deliveries_total", "The outcomes of the delivery of mail, http and sms.", "channel", "outcome")
+
+	all_metrics = []metricWriter{metric_jobs_enqueued,
+		metric_jobs_succeeded,
+		metric_jobs_failed,
+		metric_jobs_retried,
+		metric_jobs_expired,
+		metric_job_duration,
+		metric_queue_lag,
+		metric_lock_steals,
+		metric_deliveries}
+)
+
+type metricWriter interface {
+	writeTo(buffer *bytes.Buffer)
+}
+
+func observeDelivery(channel string, e error) {
+	if nil == e {
+		metric_deliveries.inc(channel, "success")
+	} else {
+		metric_deliveries.inc(channel, "failure")
+	}
+}
+
+// observeLockSteal counts the job which is reserved after the lock of other
+// worker is expired.
+func observeLockSteal(w *worker, prev_locked_by string) {
+	if 0 != len(prev_locked_by) && w.name != prev_locked_by {
+		metric_lock_steals.inc()
+	}
+}
+
+type metricVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu   sync.Mutex
+	keys map[string][]string
+}
+
+// key returns the key of the label values, the values are padded if it is
+// less than the labels.
+func (self *metricVec) key(values []string) string {
+	if len(values) < len(self.labels) {
+		values = append(values, make([]string, len(self.labels)-len(values))...)
+	}
+	key := strings.Join(values[:len(self.labels)], "\x00")
+	if _, ok := self.keys[key]; !ok {
+		self.keys[key] = values[:len(self.labels)]
+	}
+	return key
+}
+
+func (self *metricVec) sortedKeys() []string {
+	keys := make([]string, 0, len(self.keys))
+	for k := range self.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (self *metricVec) writeHeader(buffer *bytes.Buffer, typ string) {
+	buffer.WriteString("# HELP ")
+	buffer.WriteString(self.name)
+	buffer.WriteString(" ")
+	buffer.WriteString(self.help)
+	buffer.WriteString("\n# TYPE ")
+	buffer.WriteString(self.name)
+	buffer.WriteString(" ")
+	buffer.WriteString(typ)
+	buffer.WriteString("\n")
+}
+
+type counterVec struct {
+	metricVec
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{metricVec: metricVec{name: name, help: help, labels: labels, keys: map[string][]string{}},
+		values: map[string]float64{}}
+}
+
+func (self *counterVec) inc(values ...string) {
+	self.add(1, values...)
+}
+
+func (self *counterVec) add(v float64, values ...string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.values[self.key(values)] += v
+}
+
+func (self *counterVec) writeTo(buffer *bytes.Buffer) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.writeHeader(buffer, "counter")
+	for _, k := range self.sortedKeys() {
+		writeSample(buffer, self.name, self.labels, self.keys[k], "", "", self.values[k])
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type histogramVec struct {
+	metricVec
+	buckets []float64
+	values  map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{metricVec: metricVec{name: name, help: help, labels: labels, keys: map[string][]string{}},
+		buckets: buckets,
+		values:  map[string]*histogram{}}
+}
+
+func (self *histogramVec) observe(v float64, values ...string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	key := self.key(values)
+	h := self.values[key]
+	if nil == h {
+		h = &histogram{counts: make([]uint64, len(self.buckets))}
+		self.values[key] = h
+	}
+	for i, upper := range self.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (self *histogramVec) writeTo(buffer *bytes.Buffer) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.writeHeader(buffer, "histogram")
+	for _, k := range self.sortedKeys() {
+		h := self.values[k]
+		for i, upper := range self.buckets {
+			writeSample(buffer, self.name+"_bucket", self.labels, self.keys[k], "le", formatFloat(upper), float64(h.counts[i]))
+		}
+		writeSample(buffer, self.name+"_bucket", self.labels, self.keys[k], "le", "+Inf", float64(h.count))
+		writeSample(buffer, self.name+"_sum", self.labels, self.keys[k], "", "", h.sum)
+		writeSample(buffer, self.name+"_count", self.labels, self.keys[k], "", "", float64(h.count))
+	}
+}
+
+func writeSample(buffer *bytes.Buffer, name string, labels, values []string, extra_label, extra_value string, v float64) {
+	buffer.WriteString(name)
+	if 0 != len(labels) || 0 != len(extra_label) {
+		buffer.WriteString("{")
+		for i, label := range labels {
+			if 0 != i {
+				buffer.WriteString(",")
+			}
+			writeLabel(buffer, label, values[i])
+		}
+		if 0 != len(extra_label) {
+			if 0 != len(labels) {
+				buffer.WriteString(",")
+			}
+			writeLabel(buffer, extra_label, extra_value)
+		}
+		buffer.WriteString("}")
+	}
+	buffer.WriteString(" ")
+	buffer.WriteString(formatFloat(v))
+	buffer.WriteString("\n")
+}
+
+var label_replacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func writeLabel(buffer *bytes.Buffer, label, value string) {
+	buffer.WriteString(label)
+	buffer.WriteString("=\"")
+	label_replacer.WriteString(buffer, value)
+	buffer.WriteString("\"")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeGauges writes the metrics which are read at the time of scraping, the
+// backlog of the queues and the budget of the sms limiter.
+func writeGauges(buffer *bytes.Buffer, backend *dbBackend) error {
+	queues, e := backend.queueStates()
+	if nil != e {
+		return e
+	}
+
+	backlog := &metricVec{name: "delayed_job_backlog", help: "The count of the queued jobs in the queue.", labels: []string{"queue"}}
+	backlog.writeHeader(buffer, "gauge")
+	for _, queue := range queues {
+		count, _ := queue["backlog"].(int64)
+		writeSample(buffer, backlog.name, backlog.labels, []string{stringWithDefault(queue, "name", "")}, "", "", float64(count))
+	}
+
+	if nil != smsLimiter {
+		day, week, month := smsLimiter.Remaining()
+		budget := &metricVec{name: "delayed_job_sms_limiter_remaining", help: "The remaining budget of the sms limiter, -1 is unlimited.", labels: []string{"period"}}
+		budget.writeHeader(buffer, "gauge")
+		writeSample(buffer, budget.name, budget.labels, []string{"day"}, "", "", float64(day))
+		writeSample(buffer, budget.name, budget.labels, []string{"week"}, "", "", float64(week))
+		writeSample(buffer, budget.name, budget.labels, []string{"month"}, "", "", float64(month))
+	}
+	return nil
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	var buffer bytes.Buffer
+	for _, m := range all_metrics {
+		m.writeTo(&buffer)
+	}
+	if e := writeGauges(&buffer, backend); nil != e {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buffer.Bytes())
+}
@@ -0,0 +1,87 @@
+package delayed_job
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	counter := newCounterVec("test_total", "The test counter.", "queue", "type")
+	counter.inc("a", "mail")
+	counter.inc("a", "mail")
+	counter.inc("b\"", "sms")
+	counter.inc()
+
+	histogram := newHistogramVec("test_seconds", "The test histogram.", []float64{0.5, 1}, "queue")
+	histogram.observe(0.2, "a")
+	histogram.observe(0.7, "a")
+	histogram.observe(3, "a")
+
+	var buffer bytes.Buffer
+	counter.writeTo(&buffer)
+	histogram.writeTo(&buffer)
+
+	excepted := `# HELP test_total The test counter.
+# TYPE test_total counter
+test_total{queue="",type=""} 1
+test_total{queue="a",type="mail"} 2
+test_total{queue="b\"",type="sms"} 1
+# HELP test_seconds The test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{queue="a",le="0.5"} 1
+test_seconds_bucket{queue="a",le="1"} 2
+test_seconds_bucket{queue="a",le="+Inf"} 3
+test_seconds_sum{queue="a"} 3.9
+test_seconds_count{queue="a"} 3
+`
+	if excepted != buffer.String() {
+		t.Error("excepted is", excepted)
+		t.Error("actual is", buffer.String())
+	}
+}
+
+func TestSmsLimiterRemaining(t *testing.T) {
+	limiter, e := NewSMSLimiter(filepath.Join(os.TempDir(), "sms_limiter_remaining_test.json"), 10, 0, 100)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer os.Remove(limiter.filename)
+
+	limiter.Add(3)
+	day, week, month := limiter.Remaining()
+	if 7 != day || -1 != week || 97 != month {
+		t.Error("excepted remaining is 7, -1, 97, actual is", day, week, month)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		e := backend.enqueue(1, 0, "", 0, "metrics_queue", time.Time{}, map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		front := &webFront{dbBackend: backend}
+		r := httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("GET", "/delayed_jobs/metrics", nil))
+		if http.StatusOK != r.Code {
+			t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+			return
+		}
+
+		for _, s := range []string{`delayed_job_jobs_enqueued_total{queue="metrics_queue",type="test"}`,
+			`delayed_job_backlog{queue="metrics_queue"} 1`} {
+			if !strings.Contains(r.Body.String(), s) {
+				t.Error("excepted contains", s, ", actual is", r.Body.String())
+			}
+		}
+	})
+}
@@ -33,11 +33,12 @@ func newMultiplexedHandler(ctx, params map[string]interface{}) (Handler, error)
 		return nil, errors.New("backend in the ctx is nil")
 	}
 
-	is_valid_rule := boolWithDefault(params, "is_valid_rule", false)
+	is_valid_rule := boolWithDefault(params, "is_valid_rule", true)
 	gpriority := intWithDefault(params, "priority", *default_priority)
 	gqueue := stringWithDefault(params, "queue", *default_queue_name)
 	gmax_attempts := intWithDefault(params, "max_attempts", *default_max_attempts)
 	grun_at := timeWithDefault(params, "run_at", time.Time{})
+	gexpires_at := backend.deadlineWithDefault(params, grun_at, time.Time{})
 	args := params["arguments"]
 
 	o, ok = params["rules"]
@@ -71,6 +72,11 @@ func newMultiplexedHandler(ctx, params map[string]interface{}) (Handler, error)
 		repeat_interval := stringWithDefault(options, "repeat_interval", "")
 		max_attempts := intWithDefault(options, "max_attempts", gmax_attempts)
 		run_at := timeWithDefault(options, "run_at", grun_at)
+		if is_valid_rule {
+			if e := validatePayload(options); nil != e {
+				return nil, fmt.Errorf("rules[%d] is invalid, %v", idx, e)
+			}
+		}
 
 		if nil != args {
 			if own_args, ok := options["arguments"]; !ok || nil == own_args {
@@ -87,6 +93,7 @@ func newMultiplexedHandler(ctx, params map[string]interface{}) (Handler, error)
 		if nil != e {
 			return nil, fmt.Errorf("rules[%d] is invalid, %v", idx, e)
 		}
+		j.expires_at = backend.dbTime(backend.deadlineWithDefault(options, run_at, gexpires_at))
 
 		rules = append(rules, j)
 	}
@@ -101,6 +108,37 @@ func (self *multiplexedHandler) Perform() error {
 	return self.backend.create(self.rules...)
 }
 
+// Render returns the jobs which would be created by the rules with their
+// rendered output.
+func (self *multiplexedHandler) Render() (map[string]interface{}, error) {
+	rules := make([]interface{}, 0, len(self.rules))
+	for idx, job := range self.rules {
+		output, e := job.render()
+		if nil != e {
+			return nil, fmt.Errorf("rules[%d] is invalid, %v", idx, e)
+		}
+		rules = append(rules, map[string]interface{}{"type": job.typeName(),
+			"queue":    job.queue,
+			"priority": job.priority,
+			"run_at":   job.run_at,
+			"output":   output})
+	}
+	return map[string]interface{}{"rules": rules}, nil
+}
+
 func init() {
 	Handlers["multiplexed"] = newMultiplexedHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "multiplexed",
+		Description: "create a job for each rule",
+		Params: []HandlerParam{{Name: "rules", Type: "array", Required: true,
+			Description: "the payloads of the jobs, the job attributes such as 'queue' in the rule override the global ones"},
+			{Name: "is_valid_rule", Type: "bool", Default: true, Description: "the rules are validated if it is true, it is the same as 'is_valid_rule' of a job"},
+			{Name: "priority", Type: "int", Description: "the priority of the jobs"},
+			{Name: "queue", Type: "string", Description: "the queue of the jobs"},
+			{Name: "max_attempts", Type: "int", Description: "the max attempts of the jobs"},
+			{Name: "run_at", Type: "time", Description: "the time when the jobs run"},
+			{Name: "expires_at", Type: "time", Description: "the deadline of the jobs"},
+			{Name: "ttl", Type: "duration", Description: "the deadline of the jobs relative to run_at"},
+			{Name: "arguments", Type: "any", Description: "the arguments which are merged into the arguments of the rules"}}})
 }
@@ -110,3 +110,14 @@ func TestMultiplexedHandler2(t *testing.T) {
 		assertCount(t, "SELECT count(*) FROM "+*table_name+" where priority = 23 and queue = 'cc'", 1)
 	})
 }
+
+func TestMultiplexedHandlerValidRule(t *testing.T) {
+	ctx := map[string]interface{}{"backend": &dbBackend{ctx: map[string]interface{}{}}}
+	rules := []interface{}{map[string]interface{}{"type": "not_exists"}}
+	if _, e := newMultiplexedHandler(ctx, map[string]interface{}{"rules": rules}); nil == e {
+		t.Error("excepted the rules are validated by default, actual error is nil")
+	}
+	if _, e := newMultiplexedHandler(ctx, map[string]interface{}{"rules": rules, "is_valid_rule": false}); nil != e {
+		t.Error("excepted the rules aren't validated, actual is", e)
+	}
+}
@@ -0,0 +1,145 @@
+package delayed_job
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Options configures a Server, a Worker or a Client. The zero value of a field
+// is a valid value (such as MinPriority), so start from DefaultOptions which
+// is filled with the command line flags.
+type Options struct {
+	DbDrv  string
+	DbURL  string
+	DbType int // AUTO is detected by DbDrv
+	Table  string
+
+	RedisAddress  string
+	RedisPassword string
+
+	// the options of worker
+	Name               string // the default is "<NamePrefix>_pid:<pid>"
+	NamePrefix         string
+	Queues             []string
+	MinPriority        int // -1 is unlimited
+	MaxPriority        int // -1 is unlimited
+	MaxAttempts        int
+	MaxRunTime         time.Duration
+	SleepDelay         time.Duration
+	ReadAhead          int
+	PriorityAgingRate  time.Duration
+	PriorityAgingFloor int
+	DestroyFailedJobs  bool
+	ExitOnComplete     bool
+	ExpireInterval     time.Duration
+	PruneInterval      time.Duration
+
+	// the options of the backend
+	DbServerTime bool          // use the clock of the database server
+	ResultTTL    time.Duration // the lifetime of the results, 0 is disabled
+	BulkSecret   string        // signs the confirmation token of the bulk actions, it is random if empty
+
+	// the names of the middlewares and the hooks, see RegisterMiddleware and
+	// RegisterHook.
+	Middlewares []string
+	Hooks       []string
+
+	// the logger of the instance, the default is the logger of the package.
+	Logger *slog.Logger
+
+	// the authenticators of the console, the console isn't authenticated if
+	// it is empty. AnonymousRole is the role of the request without
+	// credential, the request is rejected if it is empty.
+	Authenticators []Authenticator
+	AnonymousRole  string
+}
+
+// DefaultOptions returns the options from the command line flags.
+func DefaultOptions() *Options {
+	var queues []string
+	if 0 != len(*default_queues) {
+		queues = strings.Split(*default_queues, ",")
+	}
+
+	return &Options{DbDrv: *db_drv,
+		DbURL:  *db_url,
+		DbType: *db_type,
+		Table:  *table_name,
+
+		RedisAddress:  *redisAddress,
+		RedisPassword: *redisPassword,
+
+		NamePrefix:         *name_prefix,
+		Queues:             queues,
+		MinPriority:        *default_min_priority,
+		MaxPriority:        *default_max_priority,
+		MaxAttempts:        *default_max_attempts,
+		MaxRunTime:         *default_max_run_time,
+		SleepDelay:         *default_sleep_delay,
+		ReadAhead:          *default_read_ahead,
+		PriorityAgingRate:  *default_priority_aging_rate,
+		PriorityAgingFloor: *default_priority_aging_floor,
+		DestroyFailedJobs:  *default_destroy_failed_jobs,
+		ExitOnComplete:     *default_exit_on_complete,
+		ExpireInterval:     *default_expire_interval,
+		PruneInterval:      *default_prune_interval,
+
+		DbServerTime: *db_server_time,
+		ResultTTL:    *result_ttl,
+		BulkSecret:   *bulk_secret,
+
+		Middlewares: splitNames(*default_middlewares),
+		Hooks:       splitNames(*default_hooks),
+
+		AnonymousRole: *auth_anonymous_role}
+}
+
+func (self *Options) newBackend(ctx map[string]interface{}) (*dbBackend, error) {
+	table := self.Table
+	if 0 == len(table) {
+		table = *table_name
+	}
+	lc, e := newLifecycle(self.Middlewares, self.Hooks)
+	if nil != e {
+		return nil, e
+	}
+
+	backend, e := newBackendWithTable(self.DbDrv, self.DbURL, table, self.DbType, ctx)
+	if nil != e {
+		return nil, e
+	}
+	backend.lifecycle = lc
+	backend.priority_aging_rate = self.PriorityAgingRate
+	backend.priority_aging_floor = self.PriorityAgingFloor
+	backend.server_time = self.DbServerTime
+	backend.result_ttl = self.ResultTTL
+	backend.bulk_secret = self.BulkSecret
+	if nil != self.Logger {
+		backend.logger = slog.New(&redactHandler{inner: self.Logger.Handler()})
+	}
+	return backend, nil
+}
+
+// workerOptions converts the options into the map of worker.initialize.
+func (self *Options) workerOptions() map[string]interface{} {
+	options := map[string]interface{}{"queues": self.Queues,
+		"min_priority":         self.MinPriority,
+		"max_priority":         self.MaxPriority,
+		"max_attempts":         self.MaxAttempts,
+		"max_run_time":         self.MaxRunTime,
+		"sleep_delay":          self.SleepDelay,
+		"read_ahead":           self.ReadAhead,
+		"priority_aging_rate":  self.PriorityAgingRate,
+		"priority_aging_floor": self.PriorityAgingFloor,
+		"destroy_failed_jobs":  self.DestroyFailedJobs,
+		"exit_on_complete":     self.ExitOnComplete,
+		"expire_interval":      self.ExpireInterval,
+		"prune_interval":       self.PruneInterval}
+	if 0 != len(self.Name) {
+		options["name"] = self.Name
+	} else {
+		options["name"] = defaultWorkerName(self.NamePrefix)
+	}
+	return options
+}
@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -48,7 +47,7 @@ func createPidFile(pidFile, image string) error {
 	file, err := os.Create(pidFile)
 	if err != nil {
 		if e := os.MkdirAll(filepath.Dir(pidFile), 0666); e != nil {
-			log.Println("[warn] mkdir '"+filepath.Dir(pidFile)+"' fail:", e)
+			defaultLogger().Warn("mkdir failed", "dir", filepath.Dir(pidFile), "error", e)
 		}
 		file, err = os.Create(pidFile)
 		if err != nil {
@@ -63,6 +62,6 @@ func createPidFile(pidFile, image string) error {
 
 func removePidFile(pidFile string) {
 	if err := os.Remove(pidFile); err != nil {
-		fmt.Printf("Error removing %s: %s\r\n", pidFile, err)
+		defaultLogger().Error("remove pid file failed", "file", pidFile, "error", err)
 	}
 }
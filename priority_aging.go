@@ -0,0 +1,65 @@
+package delayed_job
+
+import (
+	"flag"
+	"strconv"
+	"time"
+)
+
+var (
+	default_priority_aging_rate  = flag.Duration("priority_aging_rate", 0, "the waiting time past run_at that improves the priority of job by one, 0 is disabled")
+	default_priority_aging_floor = flag.Int("priority_aging_floor", 0, "the lowest priority number that a job can reach by aging")
+)
+
+// effectivePriority computes the priority of a job after aging. A job gains one
+// priority point (its number decreases) for every `rate` it has waited past
+// run_at, but aging never pushes it below `floor`; jobs whose declared priority
+// is already at or below the floor are unchanged.
+func effectivePriority(priority int, run_at, now time.Time, rate time.Duration, floor int) int {
+	if rate <= 0 || run_at.IsZero() || priority <= floor {
+		return priority
+	}
+
+	waited := now.Sub(run_at)
+	if waited <= 0 {
+		return priority
+	}
+
+	aged := priority - int(waited/rate)
+	if aged < floor {
+		return floor
+	}
+	return aged
+}
+
+// waitedSecondsSQL returns the expression of the seconds elapsed from run_at to
+// the parameter `now` for the specified database.
+func waitedSecondsSQL(dbType int, now string) string {
+	switch dbType {
+	case POSTGRESQL:
+		return "EXTRACT(EPOCH FROM (" + now + " - run_at))"
+	case MSSQL, SYBASE:
+		return "DATEDIFF(second, run_at, " + now + ")"
+	case ORACLE:
+		return "((CAST(" + now + " AS DATE) - CAST(run_at AS DATE)) * 86400)"
+	default:
+		return "TIMESTAMPDIFF(SECOND, run_at, " + now + ")"
+	}
+}
+
+// effectivePrioritySQL is the SQL counterpart of effectivePriority, it is used
+// in the ORDER BY clause of reserve.
+func effectivePrioritySQL(dbType int, now string, rate time.Duration, floor int) string {
+	if rate <= 0 {
+		return "priority"
+	}
+
+	seconds := rate.Seconds()
+	floor_str := strconv.FormatInt(int64(floor), 10)
+	aged := "(priority - FLOOR(" + waitedSecondsSQL(dbType, now) + " / " + strconv.FormatFloat(seconds, 'f', -1, 64) + "))"
+
+	return "(CASE WHEN run_at IS NULL OR priority <= " + floor_str + " THEN priority" +
+		" WHEN " + aged + " < " + floor_str + " THEN " + floor_str +
+		" WHEN " + aged + " > priority THEN priority" +
+		" ELSE " + aged + " END)"
+}
@@ -0,0 +1,117 @@
+package delayed_job
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEffectivePriority(t *testing.T) {
+	now := time.Now()
+	for idx, test := range []struct {
+		priority int
+		run_at   time.Time
+		rate     time.Duration
+		floor    int
+		excepted int
+	}{
+		{priority: 10, run_at: now.Add(-1 * time.Hour), rate: 0, floor: 0, excepted: 10},
+		{priority: 10, run_at: time.Time{}, rate: time.Minute, floor: 0, excepted: 10},
+		{priority: 10, run_at: now.Add(1 * time.Hour), rate: time.Minute, floor: 0, excepted: 10},
+		{priority: 10, run_at: now.Add(-3*time.Minute - time.Second), rate: time.Minute, floor: 0, excepted: 7},
+		{priority: 10, run_at: now.Add(-1 * time.Hour), rate: time.Minute, floor: 2, excepted: 2},
+		{priority: 1, run_at: now.Add(-1 * time.Hour), rate: time.Minute, floor: 2, excepted: 1},
+	} {
+		actual := effectivePriority(test.priority, test.run_at, now, test.rate, test.floor)
+		if actual != test.excepted {
+			t.Errorf("[%d] excepted effective priority is %d, actual is %d", idx, test.excepted, actual)
+		}
+	}
+}
+
+func TestEffectivePrioritySQL(t *testing.T) {
+	if s := effectivePrioritySQL(POSTGRESQL, "$6", 0, 0); "priority" != s {
+		t.Error("excepted is 'priority', actual is", s)
+	}
+
+	s := effectivePrioritySQL(POSTGRESQL, "$6", 2*time.Minute, 3)
+	if !strings.Contains(s, "EXTRACT(EPOCH FROM ($6 - run_at)) / 120") {
+		t.Error("excepted contains the waited seconds, actual is", s)
+	}
+	if !strings.Contains(s, "priority <= 3 THEN priority") {
+		t.Error("excepted contains the floor, actual is", s)
+	}
+
+	s = effectivePrioritySQL(MYSQL, "?", time.Minute, 0)
+	if !strings.Contains(s, "TIMESTAMPDIFF(SECOND, run_at, ?)") {
+		t.Error("excepted contains TIMESTAMPDIFF, actual is", s)
+	}
+	s = effectivePrioritySQL(MSSQL, "?", time.Minute, 0)
+	if !strings.Contains(s, "DATEDIFF(second, run_at, ?)") {
+		t.Error("excepted contains DATEDIFF, actual is", s)
+	}
+}
+
+func TestReserveWithPriorityAging(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		now := backend.db_time_now()
+		e := backend.enqueue(1, 0, "", 0, "aa", now, map[string]interface{}{"type": "test", "handler_id": "new"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		e = backend.enqueue(5, 0, "", 0, "aa", now.Add(-10*time.Minute), map[string]interface{}{"type": "test", "handler_id": "old"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := &worker{min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute}
+		job, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == job {
+			t.Error("excepted job is not nil, actual is nil")
+			return
+		}
+		if "new" != job.handler_id {
+			t.Error("excepted job is 'new' without aging, actual is", job.handler_id)
+		}
+		backend.clearLocks(w.name)
+
+		w.priority_aging_rate = 1 * time.Minute
+		job, e = backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == job {
+			t.Error("excepted job is not nil, actual is nil")
+			return
+		}
+		if "old" != job.handler_id {
+			t.Error("excepted job is 'old' with aging, actual is", job.handler_id)
+		}
+
+		w.backend = backend
+		w.syncPriorityAging()
+		results, e := backend.where(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != len(results) {
+			t.Error("excepted results is 2, actual is", len(results))
+			return
+		}
+		for _, result := range results {
+			if _, ok := result["effective_priority"]; !ok {
+				t.Error("excepted effective_priority is exists, actual is", result)
+			} else if "old" == result["handler_id"] && 0 != result["effective_priority"] {
+				t.Error("excepted effective_priority of 'old' is aged by the worker, actual is", result["effective_priority"])
+			}
+		}
+	})
+}
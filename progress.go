@@ -0,0 +1,113 @@
+package delayed_job
+
+import (
+	"errors"
+	"flag"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	progress_interval = flag.Duration("progress_interval", 5*time.Second, "the minimum interval of saving the progress of job to the database")
+
+	// matches the lines such as "progress: 45 copying files" or "PROGRESS=45% done"
+	default_progress_pattern = regexp.MustCompile(`(?i)^\s*progress\s*[:=]\s*(\d{1,3})\s*%?\s*(.*)$`)
+)
+
+// jobProgress saves the progress of the running job, the progress is saved at
+// most once every progress_interval except that it reaches 100.
+type jobProgress struct {
+	job      *Job
+	interval time.Duration
+	// the worker which runs the job, the progress isn't saved after the job
+	// is unlocked (such as it is rescheduled).
+	locked_by string
+
+	lock     sync.Mutex
+	saved_at time.Time
+}
+
+func (self *jobProgress) Report(percent int, message string) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	if len(message) > 2000 {
+		message = message[:1900] + "..."
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	now := time.Now()
+	if percent < 100 && now.Sub(self.saved_at) < self.interval {
+		return
+	}
+	self.saved_at = now
+
+	if e := self.job.backend.updateProgress(self.job.id, self.locked_by, percent, message); nil != e {
+		self.job.logger().Warn("save progress failed", "error", e)
+	}
+}
+
+// parseProgress parses the progress from a line of output, the first group of
+// the pattern is the percent and the optional second group is the message.
+func parseProgress(pattern *regexp.Regexp, line string) (int, string, bool) {
+	matches := pattern.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if len(matches) < 2 {
+		return 0, "", false
+	}
+	percent, e := strconv.Atoi(matches[1])
+	if nil != e {
+		return 0, "", false
+	}
+	if len(matches) > 2 {
+		return percent, strings.TrimSpace(matches[2]), true
+	}
+	return percent, "", true
+}
+
+// progressWriter reports the progress lines of the output to the reporter.
+type progressWriter struct {
+	pattern  *regexp.Regexp
+	reporter ProgressReporter
+	line     []byte
+}
+
+func (self *progressWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if '\n' != c {
+			if len(self.line) < 4096 {
+				self.line = append(self.line, c)
+			}
+			continue
+		}
+
+		if percent, message, ok := parseProgress(self.pattern, string(self.line)); ok {
+			self.reporter.Report(percent, message)
+		}
+		self.line = self.line[:0]
+	}
+	return len(p), nil
+}
+
+// updateProgress saves the progress of the job which is locked by locked_by,
+// so that a late report of the timed out run doesn't overwrite the progress
+// which is cleared by the reschedule.
+func (self *dbBackend) updateProgress(id int64, locked_by string, percent int, message string) error {
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	query := "UPDATE " + self.table + " SET progress = " + args.add(percent) +
+		", progress_message = " + args.add(message) + " WHERE id = " + args.add(id)
+	if 0 != len(locked_by) {
+		query += " AND locked_by = " + args.add(locked_by)
+	}
+	_, e := self.db.Exec(query, args.values...)
+	if nil != e {
+		return errors.New("update progress failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
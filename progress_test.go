@@ -0,0 +1,144 @@
+package delayed_job
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+type testProgressReporter struct {
+	percents []int
+	messages []string
+}
+
+func (self *testProgressReporter) Report(percent int, message string) {
+	self.percents = append(self.percents, percent)
+	self.messages = append(self.messages, message)
+}
+
+func TestParseProgress(t *testing.T) {
+	for idx, test := range []struct {
+		line     string
+		percent  int
+		message  string
+		excepted bool
+	}{
+		{line: "progress: 45 copying files", percent: 45, message: "copying files", excepted: true},
+		{line: "PROGRESS=100%\r\n", percent: 100, excepted: true},
+		{line: "  Progress : 7% step 1", percent: 7, message: "step 1", excepted: true},
+		{line: "copying files", excepted: false},
+		{line: "progress: abc", excepted: false},
+	} {
+		percent, message, ok := parseProgress(default_progress_pattern, test.line)
+		if ok != test.excepted {
+			t.Errorf("[%d] excepted is %v, actual is %v", idx, test.excepted, ok)
+			continue
+		}
+		if percent != test.percent || message != test.message {
+			t.Errorf("[%d] excepted is %d '%s', actual is %d '%s'", idx, test.percent, test.message, percent, message)
+		}
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	reporter := &testProgressReporter{}
+	w := &progressWriter{pattern: default_progress_pattern, reporter: reporter}
+	w.Write([]byte("start\nprogress: 10 a\npro"))
+	w.Write([]byte("gress: 20 b\nend\n"))
+
+	if 2 != len(reporter.percents) {
+		t.Error("excepted reports is 2, actual is", reporter.percents)
+		return
+	}
+	if 10 != reporter.percents[0] || "a" != reporter.messages[0] || 20 != reporter.percents[1] || "b" != reporter.messages[1] {
+		t.Error("excepted reports is [10 a, 20 b], actual is", reporter.percents, reporter.messages)
+	}
+}
+
+func TestExecHandlerWithProgress(t *testing.T) {
+	if "windows" == runtime.GOOS {
+		t.Skip("sh is required")
+	}
+
+	handler, e := newExecHandler(map[string]interface{}{}, map[string]interface{}{"command": "sh",
+		"command_arguments": []interface{}{"-c", "echo 'step: 30 half'; echo done"},
+		"progress_pattern":  `^step: (\d+) (.*)$`})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	reporter := &testProgressReporter{}
+	handler.(Progresser).SetProgressReporter(reporter)
+	e = handler.Perform()
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if 1 != len(reporter.percents) || 30 != reporter.percents[0] || "half" != reporter.messages[0] {
+		t.Error("excepted reports is [30 half], actual is", reporter.percents, reporter.messages)
+	}
+}
+
+func TestJobProgress(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		e := backend.enqueue(1, 0, "", 0, "aa", time.Time{}, map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := &worker{min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute}
+		job, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == job {
+			t.Error("excepted job is not nil, actual is nil")
+			return
+		}
+
+		progress := &jobProgress{job: job, interval: time.Hour, locked_by: job.locked_by}
+		progress.Report(20, "first")
+		progress.Report(50, "throttled")
+
+		results, e := backend.where(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(results) {
+			t.Error("excepted results is 1, actual is", len(results))
+			return
+		}
+		if int64(20) != results[0]["progress"] || "first" != results[0]["progress_message"] {
+			t.Error("excepted progress is 20 'first', actual is", results[0]["progress"], results[0]["progress_message"])
+		}
+
+		progress.Report(100, "done")
+		results, e = backend.where(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if int64(100) != results[0]["progress"] {
+			t.Error("excepted progress is 100, actual is", results[0]["progress"])
+		}
+
+		if e = job.rescheduleIt(time.Now(), "failed"); nil != e {
+			t.Error(e)
+			return
+		}
+		// the late report of the run isn't saved after the job is rescheduled.
+		progress.Report(100, "late")
+		results, e = backend.where(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if has, _ := results[0]["has_progress"].(bool); has {
+			t.Error("excepted progress is cleared, actual is", results[0]["progress"], results[0]["progress_message"])
+		}
+	})
+}
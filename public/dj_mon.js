@@ -12,16 +12,22 @@ $(function(){
     var dataUrl = tabContent.data('url');
 
     $.getJSON(dataUrl).success(function(data){
-      var template = $('#dj_reports_template').html();
+      if (tabContent.attr('id') === 'audit') {
+        $.each(data || [], function(i, record) {
+          if (record.before !== undefined) record.before_text = JSON.stringify(record.before);
+          if (record.after !== undefined) record.after_text = JSON.stringify(record.after);
+        });
+      }
+      var template = $('#' + (tabContent.data('template') || 'dj_reports_template')).html();
       if(!! data && data.length > 0)
         var output = Mustache.render(template, data);
       else
-        var output = "<div class='alert centered'>No Jobs</div>";
+        var output = "<div class='alert centered'>" + (tabContent.data('empty') || 'No Jobs') + "</div>";
       tabContent.html(output);
 
 
 
-      $('form').submit(function(){
+      tabContent.find('form').submit(function(){
           $.ajax({
            url: $(this).attr('action'),
            type:'post',           //数据发送方式
@@ -31,6 +37,8 @@ $(function(){
             var params = {level: "success",  data: resp.responseText}
             if (resp.status != 200) {
               params.level = "warning"
+            } else {
+              refreshActiveTab();
             }
 
             var template = $('#dj_message_template').html();
@@ -65,13 +73,46 @@ $(function(){
     $('.modal').hide().remove();
   });
 
-  (function refreshCount() {
+  function renderCounts(data) {
+    var template = $('#dj_counts_template').html();
+    var output = Mustache.render(template, data);
+    $('#dj-counts-view').html(output);
+  }
+
+  function refreshCount() {
     $.getJSON(dj_counts_dj_reports_url).success(function(data){
-      var template = $('#dj_counts_template').html();
-      var output = Mustache.render(template, data);
-      $('#dj-counts-view').html(output);
+      renderCounts(data);
       setTimeout(refreshCount, 5000);
     });
-  })();
+  }
+
+  // reload the active tab at most once a second while the events arrive.
+  var refreshTimer = null;
+  function refreshActiveTab() {
+    if (refreshTimer) {
+      return;
+    }
+    refreshTimer = setTimeout(function() {
+      refreshTimer = null;
+      $('.nav.nav-tabs li.active a[data-toggle="tab"]').trigger('shown');
+    }, 1000);
+  }
+
+  if (window.EventSource && typeof dj_events_url !== 'undefined') {
+    var source = new EventSource(dj_events_url);
+    source.addEventListener('counts', function(e) {
+      renderCounts(JSON.parse(e.data));
+    });
+    $.each(['enqueued', 'started', 'succeeded', 'failed', 'retried', 'deleted', 'updated'], function(i, name) {
+      source.addEventListener(name, refreshActiveTab);
+    });
+    source.onerror = function() {
+      if (source.readyState === EventSource.CLOSED) {
+        refreshCount();
+      }
+    };
+  } else {
+    refreshCount();
+  }
 
 })
\ No newline at end of file
@@ -114,3 +114,25 @@ func TestPush(t *testing.T) {
 		}
 	})
 }
+
+func TestTestJobWithDryRun(t *testing.T) {
+	front := &webFront{nil, &dbBackend{ctx: map[string]interface{}{}}}
+
+	r := httptest.NewRequest("POST", "/test?dry_run=true", strings.NewReader(`{"handler": {"type": "sms", "phone_numbers": "13800000000", "content": "hello"}}`))
+	w := httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	if http.StatusOK != w.Code {
+		t.Fatal("excepted status is 200, actual is", w.Code, w.Body.String())
+	}
+
+	var result struct {
+		Type   string                 `json:"type"`
+		Output map[string]interface{} `json:"output"`
+	}
+	if e := json.Unmarshal(w.Body.Bytes(), &result); nil != e {
+		t.Fatal(e)
+	}
+	if "sms" != result.Type || "hello" != result.Output["content"] {
+		t.Error("excepted the sms is rendered, actual is", w.Body.String())
+	}
+}
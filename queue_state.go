@@ -0,0 +1,174 @@
+package delayed_job
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// queueTable is the table which persists the state of the queues.
+func (self *dbBackend) queueTable() string {
+	return self.table + "_queues"
+}
+
+// default_queue is the reserved name of the queue of the jobs which have no
+// queue, so that they can be paused like the other queues.
+const default_queue = "default"
+
+// pausedQueuesSQL is the condition which excludes the jobs of the paused
+// queues, it is a part of the worker scope. The table of the queues is
+// created by '-mode init_db' or '-mode upgrade_db'.
+func (self *dbBackend) pausedQueuesSQL() string {
+	return " AND COALESCE(NULLIF(queue, ''), '" + default_queue + "') NOT IN (SELECT name FROM " + self.queueTable() + " WHERE paused_at IS NOT NULL)"
+}
+
+func (self *dbBackend) queueTableScripts() []string {
+	switch self.dbType {
+	case MSSQL:
+		return []string{`if object_id('dbo.` + self.queueTable() + `', 'U') is not null
+				BEGIN
+							 DROP TABLE ` + self.queueTable() + `;
+				END`,
+			`CREATE TABLE dbo.` + self.queueTable() + ` (
+						  name              varchar(200) PRIMARY KEY,
+						  paused_at         DATETIME2,
+						  updated_at        DATETIME2 NOT NULL
+						);`}
+	case POSTGRESQL:
+		return []string{`DROP TABLE IF EXISTS ` + self.queueTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.queueTable() + ` (
+				  name              varchar(200) PRIMARY KEY,
+				  paused_at         timestamp with time zone,
+				  updated_at        timestamp with time zone NOT NULL
+				);`}
+	case ORACLE:
+		return []string{`BEGIN EXECUTE IMMEDIATE 'DROP TABLE ` + self.queueTable() + `';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE TABLE ` + self.queueTable() + ` (
+					  name              varchar2(200 BYTE) PRIMARY KEY,
+					  paused_at         DATE,
+					  updated_at        DATE
+					)`}
+	default:
+		return []string{`DROP TABLE IF EXISTS ` + self.queueTable() + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.queueTable() + ` (
+					  name              varchar(200) PRIMARY KEY,
+					  paused_at         DATETIME NULL,
+					  updated_at        DATETIME NOT NULL
+					);`}
+	}
+}
+
+// pauseQueue stops the workers to reserve the jobs of the queue, the jobs are
+// kept in the database.
+func (self *dbBackend) pauseQueue(name string) error {
+	return self.setQueueState(name, true)
+}
+
+// resumeQueue restarts the jobs of the paused queue.
+func (self *dbBackend) resumeQueue(name string) error {
+	return self.setQueueState(name, false)
+}
+
+func (self *dbBackend) setQueueState(name string, paused bool) error {
+	if 0 == len(name) {
+		name = default_queue
+	}
+
+	now := self.db_time_now()
+	paused_at := func(args *sqlArguments) string {
+		if paused {
+			return self.nowSQL(args, now)
+		}
+		return "NULL"
+	}
+
+	args := &sqlArguments{isNumeric: self.isNumericParams}
+	result, e := self.db.Exec("UPDATE "+self.queueTable()+" SET paused_at = "+paused_at(args)+
+		", updated_at = "+self.nowSQL(args, now)+" WHERE name = "+args.add(name), args.values...)
+	if nil != e {
+		return errors.New("update queue state failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	if c, e := result.RowsAffected(); nil == e && c > 0 {
+		return nil
+	}
+
+	args = &sqlArguments{isNumeric: self.isNumericParams}
+	_, e = self.db.Exec("INSERT INTO "+self.queueTable()+"(name, paused_at, updated_at) VALUES ("+
+		args.add(name)+", "+paused_at(args)+", "+self.nowSQL(args, now)+")", args.values...)
+	if nil != e {
+		return errors.New("insert queue state failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// queueStates returns the state and the backlog of every queue, the backlog
+// is the count of the jobs which are not failed, the jobs without queue are
+// counted in the queue 'default'.
+func (self *dbBackend) queueStates() ([]map[string]interface{}, error) {
+	states := map[string]map[string]interface{}{}
+	get := func(name string) map[string]interface{} {
+		state, ok := states[name]
+		if !ok {
+			state = map[string]interface{}{"name": name, "paused": false, "backlog": int64(0)}
+			states[name] = state
+		}
+		return state
+	}
+
+	rows, e := self.db.Query("SELECT queue, COUNT(*) FROM " + self.table + " WHERE failed_at IS NULL GROUP BY queue")
+	if nil != e {
+		return nil, errors.New("query backlog of queues failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var queue sql.NullString
+		var backlog int64
+		if e = rows.Scan(&queue, &backlog); nil != e {
+			return nil, errors.New("scan backlog of queues failed, " + i18nString(self.dbType, self.drv, e))
+		}
+		name := queue.String
+		if 0 == len(name) {
+			name = default_queue
+		}
+		state := get(name)
+		state["backlog"] = state["backlog"].(int64) + backlog
+	}
+	if e = rows.Err(); nil != e {
+		return nil, errors.New("next backlog of queues failed, " + i18nString(self.dbType, self.drv, e))
+	}
+
+	rows, e = self.db.Query("SELECT name, paused_at FROM " + self.queueTable())
+	if nil != e {
+		return nil, errors.New("query state of queues failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var paused_at NullTime
+		if e = rows.Scan(&name, &paused_at); nil != e {
+			return nil, errors.New("scan state of queues failed, " + i18nString(self.dbType, self.drv, e))
+		}
+		state := get(name)
+		if paused_at.Valid {
+			state["paused"] = true
+			state["paused_at"] = paused_at.Time
+		}
+	}
+	if e = rows.Err(); nil != e {
+		return nil, errors.New("next state of queues failed, " + i18nString(self.dbType, self.drv, e))
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		results = append(results, states[name])
+	}
+	return results, nil
+}
@@ -0,0 +1,188 @@
+package delayed_job
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPauseQueue(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		e := backend.enqueue(1, 0, "sms", 0, "aa", time.Time{}, map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		e = backend.pauseQueue("sms")
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := &worker{min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute}
+		job, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil != job {
+			t.Error("excepted job is nil while queue is paused, actual is", job.id)
+			return
+		}
+
+		states, e := backend.queueStates()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(states) {
+			t.Error("excepted states is 1, actual is", len(states))
+			return
+		}
+		if "sms" != states[0]["name"] || true != states[0]["paused"] || int64(1) != states[0]["backlog"] {
+			t.Error("excepted queue 'sms' is paused with 1 job, actual is", states[0])
+		}
+
+		e = backend.resumeQueue("sms")
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		job, e = backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == job {
+			t.Error("excepted job is not nil after queue is resumed, actual is nil")
+		}
+	})
+}
+
+func TestPauseDefaultQueue(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		e := backend.enqueue(1, 0, "", 0, "aa", time.Time{}, map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		e = backend.pauseQueue("")
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := &worker{min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute}
+		job, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil != job {
+			t.Error("excepted job is nil while default queue is paused, actual is", job.id)
+			return
+		}
+
+		states, e := backend.queueStates()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(states) || default_queue != states[0]["name"] || true != states[0]["paused"] || int64(1) != states[0]["backlog"] {
+			t.Error("excepted queue 'default' is paused with 1 job, actual is", states)
+		}
+
+		e = backend.resumeQueue(default_queue)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		job, e = backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == job {
+			t.Error("excepted job is not nil after default queue is resumed, actual is nil")
+		}
+	})
+}
+
+func TestPauseQueueByHttp(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		front := &webFront{dbBackend: backend}
+
+		r := httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("POST", "/delayed_jobs/queues/sms/pause", nil))
+		if http.StatusOK != r.Code {
+			t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+			return
+		}
+
+		states, e := backend.queueStates()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(states) || true != states[0]["paused"] {
+			t.Error("excepted queue 'sms' is paused, actual is", states)
+			return
+		}
+
+		r = httptest.NewRecorder()
+		front.ServeHTTP(r, httptest.NewRequest("POST", "/queues/sms/resume", nil))
+		if http.StatusOK != r.Code {
+			t.Error("excepted code is 200, actual is", r.Code, r.Body.String())
+			return
+		}
+
+		states, e = backend.queueStates()
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(states) || false != states[0]["paused"] {
+			t.Error("excepted queue 'sms' is resumed, actual is", states)
+		}
+
+		req := httptest.NewRequest("POST", "/delayed_jobs/queues/sms/pause", strings.NewReader("commit=Pause"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = httptest.NewRecorder()
+		front.ServeHTTP(r, req)
+		if http.StatusSeeOther != r.Code || "../../../#queues" != r.Header().Get("Location") {
+			t.Error("excepted the form is redirected to the dashboard, actual is", r.Code, r.Header().Get("Location"))
+		}
+	})
+}
+
+func TestSeeDashboard(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		location string
+	}{{path: "/delayed_jobs/queues/sms/pause", location: "../../../#queues"},
+		{path: "/delayed_jobs/queues/sms/pause/", location: "../../../../#queues"},
+		{path: "/delayed_jobs/delayed_jobs/queues/sms/resume", location: "../../../#queues"},
+		{path: "/queues/sms/resume", location: "../../#queues"}} {
+		r := httptest.NewRequest("POST", test.path, strings.NewReader("commit=Pause"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if !isFormPost(r) {
+			t.Error("excepted the request is a form post")
+		}
+		w := httptest.NewRecorder()
+		seeDashboard(w, r, "queues")
+		if http.StatusSeeOther != w.Code || test.location != w.Header().Get("Location") {
+			t.Error("excepted location of", test.path, "is", test.location, ", actual is", w.Code, w.Header().Get("Location"))
+		}
+
+		r.Header.Set("X-Requested-With", "XMLHttpRequest")
+		if isFormPost(r) {
+			t.Error("excepted the ajax request isn't a form post")
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"expvar"
 	"flag"
 	"fmt"
-	"log"
 	"runtime"
 	"strings"
 	"sync"
@@ -31,6 +30,23 @@ type redis_gateway struct {
 	c         chan *redis_request
 	is_closed int32
 	wait      sync.WaitGroup
+
+	lock      sync.Mutex
+	reconnect chan struct{}
+}
+
+// reset changes the address and the password, the connection is
+// re-established with them.
+func (self *redis_gateway) reset(address, password string) {
+	self.lock.Lock()
+	self.Address = address
+	self.Password = password
+	self.lock.Unlock()
+
+	select {
+	case self.reconnect <- struct{}{}:
+	default:
+	}
 }
 
 func (self *redis_gateway) isRunning() bool {
@@ -60,7 +76,7 @@ func (self *redis_gateway) serve() {
 	defer func() {
 		atomic.StoreInt32(&self.is_closed, 1)
 		self.wait.Done()
-		log.Println("redis client is exit.")
+		defaultLogger().Info("redis client is exit.")
 	}()
 
 	error_count := uint(0)
@@ -86,27 +102,31 @@ func (self *redis_gateway) runOnce(error_count *uint) {
 			}
 			msg := buffer.String()
 			redis_error.Set(msg)
-			log.Println(msg)
+			defaultLogger().Error("redis client panic", "panic", msg)
 		}
 	}()
 
+	self.lock.Lock()
+	address, password := self.Address, self.Password
+	self.lock.Unlock()
+
 	dialOpts := []redis.DialOption{
 		redis.DialWriteTimeout(1 * time.Second),
 		redis.DialReadTimeout(1 * time.Second),
 	}
-	if self.Password != "" {
-		dialOpts = append(dialOpts, redis.DialPassword(self.Password))
+	if password != "" {
+		dialOpts = append(dialOpts, redis.DialPassword(password))
 	}
-	c, err := redis.Dial("tcp", self.Address, dialOpts...)
-	// c, err := redis.DialTimeout("tcp", self.Address, 1*time.Second, 1*time.Second, 1*time.Second)
+	c, err := redis.Dial("tcp", address, dialOpts...)
+	// c, err := redis.DialTimeout("tcp", address, 1*time.Second, 1*time.Second, 1*time.Second)
 	if err != nil {
-		msg := fmt.Sprintf("[redis] connect to '%s' failed, %v", self.Address, err)
+		msg := fmt.Sprintf("[redis] connect to '%s' failed, %v", address, err)
 		redis_error.Set(msg)
 		*error_count++
 		if *error_count < 5 {
-			log.Println(msg)
+			defaultLogger().Warn(msg)
 		} else if 0 == (*error_count % 10) {
-			log.Println(msg)
+			defaultLogger().Warn(msg)
 
 			for {
 				select {
@@ -129,11 +149,20 @@ func (self *redis_gateway) runOnce(error_count *uint) {
 		return
 	}
 
+	defer c.Close()
+
 	*error_count = 0
 	redis_error.Set("")
 
 	for self.isRunning() {
-		req, ok := <-self.c
+		var req *redis_request
+		var ok bool
+		select {
+		case req, ok = <-self.c:
+		case <-self.reconnect:
+			defaultLogger().Info("redis client is reconnecting", "address", address)
+			return
+		}
 		if !ok {
 			break
 		}
@@ -232,7 +261,7 @@ func (self *redis_gateway) redis_do(c redis.Conn, cmd []string) (err error) {
 }
 
 func newRedis(address, password string) (*redis_gateway, error) {
-	client := &redis_gateway{Address: address, Password: password, c: make(chan *redis_request, 3000)}
+	client := &redis_gateway{Address: address, Password: password, c: make(chan *redis_request, 3000), reconnect: make(chan struct{}, 1)}
 	go client.serve()
 	client.wait.Add(1)
 	return client, nil
@@ -214,6 +214,17 @@ commands_label:
 	}
 }
 
+// Render returns the commands which would be sent to the redis.
+func (self *redisHandler) Render() (map[string]interface{}, error) {
+	address := self.address
+	if nil != self.client {
+		self.client.lock.Lock()
+		address = self.client.Address
+		self.client.lock.Unlock()
+	}
+	return map[string]interface{}{"address": address, "commands": self.commands}, nil
+}
+
 func (self *redisHandler) Perform() error {
 	if self.client == nil {
 		dialOpts := []redis.DialOption{
@@ -245,4 +256,17 @@ func (self *redisHandler) Perform() error {
 func init() {
 	Handlers["redis"] = newRedisHandler
 	Handlers["redis_command"] = newRedisHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "redis",
+		Description: "execute the commands in the redis",
+		Aliases:     []string{"redis_command"},
+		Params: []HandlerParam{{Name: "command", Type: "any",
+			Description: "the command, such as 'SET a $name', it is required unless 'commands' is set"},
+			{Name: "commands", Type: "any", Description: "the commands, one command per line or an array of commands"},
+			{Name: "address", Type: "string", Description: "the address of the redis if the redis isn't configured"},
+			{Name: "password", Type: "string", Secret: true, Description: "the password of the redis"},
+			{Name: "arguments", Type: "any", Description: "the values of the placeholders"}},
+		TemplateArgs: []HandlerParam{{Name: "$name", Type: "any",
+			Description: "the argument is replaced by the value of 'name' in 'arguments'"},
+			{Name: "$$", Type: "object", Description: "the argument is replaced by the json of 'arguments'"}}})
 }
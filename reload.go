@@ -0,0 +1,252 @@
+package delayed_job
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	config_watch_interval = flag.Duration("config_watch_interval", 10*time.Second, "the interval of checking the config file for changes, 0 is disabled")
+
+	// the flags which are read at every use, they take effect immediately
+	// after they are changed.
+	live_flag_prefixes = []string{"mail.",
+		"sms.",
+		"syslog.",
+		"exec.",
+		"gammu",
+		"with_smsd",
+		"default_priority",
+		"default_queue_name",
+		"progress_interval",
+		"bulk_confirm_timeout",
+		"bulk_confirm_threshold",
+		"bulk_secret",
+		"events_counts_interval",
+		"events_buffer_size"}
+
+	reload_lock sync.Mutex
+	reloaders   = map[int]reloader{}
+	reloader_id = 0
+)
+
+// reloader applies the changed flags to the running instance, it returns the
+// flags which take effect.
+type reloader func(changed map[string]bool) []string
+
+// reloadReport is the result of a reload, the flags which are changed but not
+// applied take effect after restart.
+type reloadReport struct {
+	Changed         []string `json:"changed"`
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// registerReloader adds the reloader, the returned function removes it.
+func registerReloader(fn reloader) func() {
+	reload_lock.Lock()
+	defer reload_lock.Unlock()
+
+	reloader_id++
+	id := reloader_id
+	reloaders[id] = fn
+	return func() {
+		reload_lock.Lock()
+		defer reload_lock.Unlock()
+		delete(reloaders, id)
+	}
+}
+
+func snapshotFlags() map[string]string {
+	values := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// resetFlags sets the flags back to the values of the snapshot, so that the
+// settings which fail are not applied partially.
+func resetFlags(values map[string]string) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if value, ok := values[f.Name]; ok && value != f.Value.String() {
+			if e := f.Value.Set(value); nil != e {
+				defaultLogger().Warn("reset flag failed", "flag", f.Name, "error", e)
+			}
+		}
+	})
+}
+
+func isLiveFlag(name string) bool {
+	for _, prefix := range live_flag_prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applySettings assigns the settings to the flags (the flags in the command
+// line are skipped) and re-applies the changed flags, none of the settings is
+// assigned if one of them fails.
+func applySettings(settings map[string]interface{}) (*reloadReport, error) {
+	reload_lock.Lock()
+	defer reload_lock.Unlock()
+
+	before := snapshotFlags()
+	if e := assignFlagSet("", settings, nil, default_actuals, false); nil != e {
+		resetFlags(before)
+		return nil, e
+	}
+
+	changed := map[string]bool{}
+	report := &reloadReport{Changed: []string{}, Applied: []string{}, RestartRequired: []string{}}
+	for name, value := range snapshotFlags() {
+		if before[name] != value {
+			changed[name] = true
+			report.Changed = append(report.Changed, name)
+		}
+	}
+	if 0 == len(changed) {
+		return report, nil
+	}
+
+	applied := map[string]bool{}
+	for name := range changed {
+		if isLiveFlag(name) {
+			applied[name] = true
+		}
+	}
+	if changed["log_level"] || changed["log_format"] {
+		if e := initLogger(); nil != e {
+			defaultLogger().Warn("reload logger failed", "error", e)
+		} else {
+			applied["log_level"] = true
+			applied["log_format"] = true
+		}
+	}
+	for _, fn := range reloaders {
+		for _, name := range fn(changed) {
+			applied[name] = true
+		}
+	}
+
+	for _, name := range report.Changed {
+		if applied[name] {
+			report.Applied = append(report.Applied, name)
+		} else {
+			report.RestartRequired = append(report.RestartRequired, name)
+		}
+	}
+	sort.Strings(report.Changed)
+	sort.Strings(report.Applied)
+	sort.Strings(report.RestartRequired)
+
+	defaultLogger().Info("config is reloaded", "applied", report.Applied, "restart_required", report.RestartRequired)
+	return report, nil
+}
+
+// reloadConfig reads the config file and applies it.
+func reloadConfig(file string) (*reloadReport, error) {
+	settings, e := readConfigFile(file)
+	if nil != e {
+		return nil, errors.New("reload config '" + file + "' failed, " + e.Error())
+	}
+
+	report, e := applySettings(settings)
+	if nil != e {
+		return nil, errors.New("reload config '" + file + "' failed, " + e.Error())
+	}
+	return report, nil
+}
+
+// saveSettings writes the settings into the config file and applies them,
+// the file is written first so that the running process doesn't use the
+// settings which aren't saved, and it is restored if the settings can't be
+// applied.
+func saveSettings(file string, settings map[string]interface{}) (*reloadReport, error) {
+	old, read_err := os.ReadFile(file)
+	if e := writeConfigFile(file, settings); nil != e {
+		return nil, e
+	}
+
+	report, e := applySettings(settings)
+	if nil != e {
+		var err error
+		if nil == read_err {
+			err = os.WriteFile(file, old, 0666)
+		} else if os.IsNotExist(read_err) {
+			err = os.Remove(file)
+		}
+		if nil != err {
+			defaultLogger().Warn("restore config failed", "file", file, "error", err)
+		}
+		return nil, e
+	}
+	return report, nil
+}
+
+// startConfigReloader reloads the config file on SIGHUP and when the file is
+// modified, the returned function stops it.
+func startConfigReloader(file string) func() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var watcher *time.Ticker
+	var ticker <-chan time.Time
+	if *config_watch_interval > 0 {
+		watcher = time.NewTicker(*config_watch_interval)
+		ticker = watcher.C
+	}
+
+	modified := func() time.Time {
+		if st, e := os.Stat(file); nil == e {
+			return st.ModTime()
+		}
+		return time.Time{}
+	}
+
+	shutdown := make(chan struct{})
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+
+		last_modified := modified()
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-hup:
+				defaultLogger().Info("SIGHUP is received, reload config", "file", file)
+			case <-ticker:
+				m := modified()
+				if m.IsZero() || m.Equal(last_modified) {
+					continue
+				}
+				last_modified = m
+				defaultLogger().Info("config file is modified, reload it", "file", file)
+			}
+
+			if _, e := reloadConfig(file); nil != e {
+				defaultLogger().Error("reload config failed", "file", file, "error", e)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		if nil != watcher {
+			watcher.Stop()
+		}
+		close(shutdown)
+		wait.Wait()
+	}
+}
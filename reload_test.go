@@ -0,0 +1,167 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func restoreFlags(t *testing.T, names ...string) {
+	values := map[string]string{}
+	for _, name := range names {
+		values[name] = flag.Lookup(name).Value.String()
+	}
+	t.Cleanup(func() {
+		for name, value := range values {
+			// flag.Set marks the flag as set, so the unchanged flag is skipped.
+			if value != flag.Lookup(name).Value.String() {
+				flag.Set(name, value)
+			}
+		}
+	})
+}
+
+func TestApplySettings(t *testing.T) {
+	restoreFlags(t, "syslog.tag", "sleep_delay", "queues", "db_table")
+
+	w := &worker{backend: &dbBackend{},
+		sleep_delay:   10 * time.Second,
+		reload_signal: make(chan struct{}, 1)}
+	defer registerReloader(w.reloadFlags)()
+
+	report, e := applySettings(map[string]interface{}{"syslog": map[string]interface{}{"tag": "abc"},
+		"sleep_delay":  "3s",
+		"queues":       "a,b",
+		"db_table":     "reload_jobs",
+		"max_attempts": json.Number(flag.Lookup("max_attempts").Value.String())})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	if "db_table,queues,sleep_delay,syslog.tag" != strings.Join(report.Changed, ",") {
+		t.Error("excepted changed is [db_table queues sleep_delay syslog.tag], actual is", report.Changed)
+	}
+	if "queues,sleep_delay,syslog.tag" != strings.Join(report.Applied, ",") {
+		t.Error("excepted applied is [queues sleep_delay syslog.tag], actual is", report.Applied)
+	}
+	if "db_table" != strings.Join(report.RestartRequired, ",") {
+		t.Error("excepted restart_required is [db_table], actual is", report.RestartRequired)
+	}
+
+	select {
+	case <-w.reload_signal:
+	default:
+		t.Error("worker isn't notified")
+	}
+	if 10*time.Second != w.sleep_delay {
+		t.Error("options should be applied before the next reservation, actual is", w.sleep_delay)
+	}
+	w.applyReloadOptions()
+	if 3*time.Second != w.sleep_delay {
+		t.Error("excepted sleep_delay is 3s, actual is", w.sleep_delay)
+	}
+	if "a,b" != strings.Join(w.queues, ",") {
+		t.Error("excepted queues is [a b], actual is", w.queues)
+	}
+
+	report, e = applySettings(map[string]interface{}{"sleep_delay": "3s"})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if 0 != len(report.Changed) {
+		t.Error("excepted changed is empty, actual is", report.Changed)
+	}
+
+	if _, e = applySettings(map[string]interface{}{"sleep_delay": "abc"}); nil == e {
+		t.Error("invalid value should be failed")
+	}
+
+	if _, e = applySettings(map[string]interface{}{"syslog": map[string]interface{}{"tag": "xyz"},
+		"queues":      "c",
+		"db_table":    "reload_jobs2",
+		"sleep_delay": "abc"}); nil == e {
+		t.Error("invalid value should be failed")
+	}
+	if tag := flag.Lookup("syslog.tag").Value.String(); "abc" != tag {
+		t.Error("excepted syslog.tag isn't changed, actual is", tag)
+	}
+	if queues := flag.Lookup("queues").Value.String(); "a,b" != queues {
+		t.Error("excepted queues isn't changed, actual is", queues)
+	}
+	if "reload_jobs" != *table_name {
+		t.Error("excepted db_table isn't changed, actual is", *table_name)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	restoreFlags(t, "syslog.severity")
+
+	file := filepath.Join(t.TempDir(), "delayed_job.conf")
+	if e := os.WriteFile(file, []byte(`{"syslog": {"severity": "warning"}}`), 0666); nil != e {
+		t.Fatal(e)
+	}
+
+	report, e := reloadConfig(file)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if "syslog.severity" != strings.Join(report.Applied, ",") {
+		t.Error("excepted applied is [syslog.severity], actual is", report.Applied)
+	}
+	if "warning" != *default_severity {
+		t.Error("excepted severity is warning, actual is", *default_severity)
+	}
+
+	if _, e = reloadConfig(filepath.Join(t.TempDir(), "not_exists.conf")); nil == e {
+		t.Error("reload a missing file should be failed")
+	}
+}
+
+func TestSaveSettings(t *testing.T) {
+	restoreFlags(t, "syslog.severity", "sleep_delay")
+
+	old := `{"syslog": {"severity": "error"}}`
+	file := filepath.Join(t.TempDir(), "delayed_job.conf")
+	if e := os.WriteFile(file, []byte(old), 0666); nil != e {
+		t.Fatal(e)
+	}
+
+	if _, e := saveSettings(file, map[string]interface{}{"syslog": map[string]interface{}{"severity": "warning"},
+		"sleep_delay": "abc"}); nil == e {
+		t.Error("invalid value should be failed")
+	}
+	if bs, e := os.ReadFile(file); nil != e {
+		t.Error(e)
+	} else if old != string(bs) {
+		t.Error("excepted the file is restored, actual is", string(bs))
+	}
+
+	missing := filepath.Join(t.TempDir(), "not_exists", "delayed_job.conf")
+	if _, e := saveSettings(missing, map[string]interface{}{"syslog": map[string]interface{}{"severity": "warning"}}); nil == e {
+		t.Error("write a file in the missing directory should be failed")
+	}
+	if "warning" == *default_severity {
+		t.Error("excepted severity isn't applied if the file isn't written, actual is", *default_severity)
+	}
+
+	report, e := saveSettings(file, map[string]interface{}{"syslog": map[string]interface{}{"severity": "warning"}})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if "syslog.severity" != strings.Join(report.Applied, ",") || "warning" != *default_severity {
+		t.Error("excepted severity is warning, actual is", report.Applied, *default_severity)
+	}
+	if settings, e := readConfigFile(file); nil != e {
+		t.Error(e)
+	} else if !strings.Contains(jsonString(settings), "warning") {
+		t.Error("excepted the file is written, actual is", settings)
+	}
+}
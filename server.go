@@ -1,13 +1,14 @@
 package delayed_job
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	_ "expvar"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rakyll/statik/fs"
 
@@ -27,16 +29,36 @@ var (
 	cd_dir, _   = os.Getwd()
 
 	retry_list = []*regexp.Regexp{regexp.MustCompile(`^/?[0-9]+/retry/?$`),
-		regexp.MustCompile(`^/?delayed_jobs/[0-9]+/retry/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/[0-9]+/retry/?$`),
 		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/[0-9]+/retry/?$`)}
 
 	delete_by_id_list = []*regexp.Regexp{regexp.MustCompile(`^/?[0-9]+/delete/?$`),
-		regexp.MustCompile(`^/?delayed_jobs/[0-9]+/delete/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/[0-9]+/delete/?$`),
 		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/[0-9]+/delete/?$`)}
 
 	job_id_list = []*regexp.Regexp{regexp.MustCompile(`^/?[0-9]+/?$`),
-		regexp.MustCompile(`^/?delayed_jobs/[0-9]+/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/[0-9]+/?$`),
 		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/[0-9]+/?$`)}
+
+	queue_pause_list = []*regexp.Regexp{regexp.MustCompile(`^/?queues/[^/]+/pause/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/queues/[^/]+/pause/?$`),
+		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/queues/[^/]+/pause/?$`)}
+
+	job_result_list = []*regexp.Regexp{regexp.MustCompile(`^/?jobs/[^/]+/result/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/jobs/[^/]+/result/?$`),
+		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/jobs/[^/]+/result/?$`)}
+
+	handler_info_list = []*regexp.Regexp{regexp.MustCompile(`^/?handlers/[^/]+/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/handlers/[^/]+/?$`),
+		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/handlers/[^/]+/?$`)}
+
+	bulk_list = []*regexp.Regexp{regexp.MustCompile(`^/?bulk/[a-z]+/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/bulk/[a-z]+/?$`),
+		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/bulk/[a-z]+/?$`)}
+
+	queue_resume_list = []*regexp.Regexp{regexp.MustCompile(`^/?queues/[^/]+/resume/?$`),
+		regexp.MustCompile(`^/?delayed_jobs?/queues/[^/]+/resume/?$`),
+		regexp.MustCompile(`^/?delayed_jobs/delayed_jobs/queues/[^/]+/resume/?$`)}
 )
 
 func abs(pa string) string {
@@ -48,12 +70,16 @@ func abs(pa string) string {
 }
 
 func searchFile() (string, bool) {
-	files := []string{*config_file,
-		filepath.Join("data", "conf", "delayed_job.conf"),
-		filepath.Join("data", "etc", "delayed_job.conf"),
-		filepath.Join("..", "data", "conf", "delayed_job.conf"),
-		filepath.Join("..", "data", "etc", "delayed_job.conf"),
-		"/etc/tpt/delayed_job.conf"}
+	files := []string{*config_file}
+	for _, base := range []string{filepath.Join("data", "conf", "delayed_job"),
+		filepath.Join("data", "etc", "delayed_job"),
+		filepath.Join("..", "data", "conf", "delayed_job"),
+		filepath.Join("..", "data", "etc", "delayed_job"),
+		"/etc/tpt/delayed_job"} {
+		for _, ext := range config_extensions {
+			files = append(files, base+ext)
+		}
+	}
 
 	for _, file := range files {
 		if st, e := os.Stat(file); nil == e && nil != st && !st.IsDir() {
@@ -78,24 +104,265 @@ func searchFile() (string, bool) {
 	}
 }
 
-func Main(run_mode string, runHttp func(http.Handler)) error {
+// initTables drops and creates the tables of the jobs.
+func (self *dbBackend) initTables() error {
+	var e error
+	switch self.dbType {
+	case MSSQL:
+		script := `if object_id('dbo.` + self.table + `', 'U') is not null
+			BEGIN 
+						 DROP TABLE ` + self.table + `; 
+			END
+			if object_id('dbo.` + self.table + `', 'U') is null
+			BEGIN
+			 CREATE TABLE dbo.` + self.table + ` (
+					  id                INT IDENTITY(1,1)  PRIMARY KEY,
+					  priority          int DEFAULT 0,
+					  repeat_count      int DEFAULT 0,
+					  repeat_interval   varchar(20) DEFAULT '',
+					  attempts          int DEFAULT 0,
+					  max_attempts      int DEFAULT 0,
+					  queue             varchar(200),
+					  handler           text  NOT NULL,
+					  handler_id        varchar(200),
+					  last_error        varchar(2000),
+					  run_at            DATETIME2,
+					  locked_at         DATETIME2,
+					  failed_at         DATETIME2,
+					  locked_by         varchar(200),
+					  created_at        DATETIME2 NOT NULL,
+					  updated_at        DATETIME2 NOT NULL,
+					  expires_at        DATETIME2,
+					  progress          int,
+					  progress_message  varchar(2000)
+					); 
+			END`
+		self.log().Debug("execute script", "sql", script)
+		_, e = self.db.Exec(script)
+		if nil != e {
+			return e
+		}
+	case POSTGRESQL:
+		script := `DROP TABLE IF EXISTS ` + self.table + `;
+			CREATE TABLE IF NOT EXISTS ` + self.table + ` (
+			  id                SERIAL PRIMARY KEY,
+			  priority          int DEFAULT 0,
+	      repeat_count      int DEFAULT 0,
+	      repeat_interval   varchar(20) DEFAULT '',
+			  attempts          int DEFAULT 0,
+	      max_attempts      int DEFAULT 0,
+			  queue             varchar(200),
+			  handler           text  NOT NULL,
+			  handler_id        varchar(200),
+			  last_error        varchar(2000),
+			  run_at            timestamp with time zone,
+			  locked_at         timestamp with time zone,
+			  failed_at         timestamp with time zone,
+			  locked_by         varchar(200),
+			  created_at        timestamp with time zone NOT NULL,
+			  updated_at        timestamp with time zone NOT NULL,
+			  expires_at        timestamp with time zone,
+			  progress          int,
+			  progress_message  varchar(2000)
+			);`
+		self.log().Debug("execute script", "sql", script)
+		_, e = self.db.Exec(script)
+		if nil != e {
+			return e
+		}
+	case ORACLE:
+		for _, script := range []string{`BEGIN     EXECUTE IMMEDIATE 'DROP SEQUENCE ` + self.table + `_sequence_id';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE SEQUENCE ` + self.table + `_sequence_id START WITH 1 INCREMENT BY 1 CACHE 100`,
+			`BEGIN EXECUTE IMMEDIATE 'DROP TABLE ` + self.table + `';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE TABLE ` + self.table + ` (
+				  id                NUMBER(10) PRIMARY KEY,
+				  priority          NUMBER(10) DEFAULT 0,
+	        repeat_count      NUMBER(10) DEFAULT 0,
+	        repeat_interval   varchar2(20) DEFAULT '',
+				  attempts          NUMBER(10) DEFAULT 0,
+	        max_attempts      NUMBER(10) DEFAULT 0,
+				  queue             varchar2(200 BYTE),
+				  handler           clob,--  NOT NULL,
+				  handler_id        varchar2(200 BYTE),
+				  last_error        VARCHAR2(2000 BYTE),
+				  run_at            TIMESTAMP(3),
+				  locked_at         DATE,
+				  failed_at         DATE,
+				  locked_by         varchar2(200 BYTE),
+				  created_at        DATE, -- NOT NULL,
+				  updated_at        DATE, -- timestamp with time zone
+				  expires_at        TIMESTAMP(3),
+				  progress          NUMBER(10),
+				  progress_message  VARCHAR2(2000 BYTE)
+				)`,
+			`BEGIN     EXECUTE IMMEDIATE 'DROP TRIGGER ` + self.table + `_trigger';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
+			`CREATE OR REPLACE TRIGGER ` + self.table + `_trigger
+				  BEFORE INSERT ON ` + self.table + `
+				  FOR EACH ROW
+				BEGIN
+				  SELECT ` + self.table + `_sequence_id.nextval
+				    INTO :new.id
+				    FROM dual;
+				END;`} {
+			self.log().Debug("execute script", "sql", script)
+			_, e = self.db.Exec(script)
+			if nil != e {
+				return i18n(ORACLE, "oci8", e)
+			}
+		}
+	default:
+		for _, script := range []string{`DROP TABLE IF EXISTS ` + self.table + `;`,
+			`CREATE TABLE IF NOT EXISTS ` + self.table + ` (
+				  id                SERIAL PRIMARY KEY,
+				  priority          int DEFAULT 0,
+	        repeat_count      int DEFAULT 0,
+	        repeat_interval   varchar(20) DEFAULT '',
+				  attempts          int DEFAULT 0,
+	        max_attempts      int DEFAULT 0,
+				  queue             varchar(200),
+				  handler           text  NOT NULL,
+				  handler_id        varchar(200),
+				  last_error        VARCHAR(2000),
+				  run_at            DATETIME(3),
+				  locked_at         DATETIME,
+				  failed_at         DATETIME,
+				  locked_by         varchar(200),
+				  created_at        DATETIME NOT NULL,
+				  updated_at        timestamp NOT NULL,
+				  expires_at        DATETIME(3) NULL,
+				  progress          int NULL,
+				  progress_message  VARCHAR(2000) NULL
+				);`} {
+			self.log().Debug("execute script", "sql", script)
+			_, e = self.db.Exec(script)
+			if nil != e {
+				return e
+			}
+		}
+	}
+
+	scripts := append(self.queueTableScripts(), self.resultTableScripts()...)
+	scripts = append(scripts, self.auditTableScripts()...)
+	for _, script := range append(scripts, self.idempotencyTableScripts()...) {
+		self.log().Debug("execute script", "sql", script)
+		_, e = self.db.Exec(script)
+		if nil != e {
+			return i18n(self.dbType, self.drv, e)
+		}
+	}
+	return nil
+}
+
+// upgradeTables adds the columns and the tables which are missing in the
+// tables of an earlier version, the jobs in the tables are kept.
+func (self *dbBackend) upgradeTables() error {
+	if !self.tableExists(self.table) {
+		return errors.New("table '" + self.table + "' isn't found, please run '-mode init_db' first")
+	}
+
+	for _, column := range self.upgradeColumns() {
+		if self.tableExists(self.table, column[0]) {
+			continue
+		}
+		script := self.addColumnSQL(self.table, column[0], column[1])
+		self.log().Debug("execute script", "sql", script)
+		if _, e := self.db.Exec(script); nil != e {
+			return i18n(self.dbType, self.drv, e)
+		}
+	}
+
+	for _, table := range []struct {
+		name    string
+		scripts []string
+	}{{self.queueTable(), self.queueTableScripts()},
+		{self.resultTable(), self.resultTableScripts()},
+		{self.auditTable(), self.auditTableScripts()},
+		{self.idempotencyTable(), self.idempotencyTableScripts()}} {
+		if self.tableExists(table.name) {
+			continue
+		}
+
+		// the first script drops the table, skip it.
+		for _, script := range table.scripts[1:] {
+			self.log().Debug("execute script", "sql", script)
+			if _, e := self.db.Exec(script); nil != e {
+				return i18n(self.dbType, self.drv, e)
+			}
+		}
+	}
+	return nil
+}
+
+// upgradeColumns returns the columns which are added to the table of the jobs
+// after it is created, and their types.
+func (self *dbBackend) upgradeColumns() [][2]string {
+	switch self.dbType {
+	case MSSQL:
+		return [][2]string{{"expires_at", "DATETIME2"},
+			{"progress", "int"},
+			{"progress_message", "varchar(2000)"}}
+	case POSTGRESQL:
+		return [][2]string{{"expires_at", "timestamp with time zone"},
+			{"progress", "int"},
+			{"progress_message", "varchar(2000)"}}
+	case ORACLE:
+		return [][2]string{{"expires_at", "TIMESTAMP(3)"},
+			{"progress", "NUMBER(10)"},
+			{"progress_message", "VARCHAR2(2000 BYTE)"}}
+	default:
+		return [][2]string{{"expires_at", "DATETIME(3) NULL"},
+			{"progress", "int NULL"},
+			{"progress_message", "VARCHAR(2000) NULL"}}
+	}
+}
+
+func (self *dbBackend) addColumnSQL(table, column, typ string) string {
+	switch self.dbType {
+	case MSSQL:
+		return "ALTER TABLE " + table + " ADD " + column + " " + typ
+	case ORACLE:
+		return "ALTER TABLE " + table + " ADD (" + column + " " + typ + ")"
+	default:
+		return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + typ
+	}
+}
+
+// tableExists checks if the table and the columns exist by selecting them.
+func (self *dbBackend) tableExists(table string, columns ...string) bool {
+	fields := "*"
+	if 0 != len(columns) {
+		fields = strings.Join(columns, ", ")
+	}
+	rows, e := self.db.Query("SELECT " + fields + " FROM " + table + " WHERE 1 = 0")
+	if nil != e {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// loadSettings loads the flags from the environment variables and the config
+// file, and initializes the logger.
+func loadSettings() error {
+	if e := loadEnvironment(nil, os.Environ()); nil != e {
+		return e
+	}
 	default_actuals = loadActualFlags(nil)
 	initDB()
 
 	file, found := searchFile()
 	flag.Set("delayed-config", file)
-	fmt.Println("[info] config file is '" + file + "'")
-
 	if found {
-		fmt.Println("[warn] load file '" + file + "'.")
 		e := loadConfig(file, nil, false)
 		if nil != e {
 			return errors.New("load file '" + file + "' failed, " + e.Error())
 		}
 	}
-
-	fmt.Println("useTLS=", *default_mail_useTLS)
-	fmt.Println("useFQDN=", *default_mail_useFQDN)
+	if e := initLogger(); nil != e {
+		return e
+	}
+	defaultLogger().Info("config file is loaded", "file", file, "found", found)
+	defaultLogger().Debug("mail options", "use_tls", *default_mail_useTLS, "use_fqdn", *default_mail_useFQDN)
 
 	if !fileExists(gammu_config) {
 		for _, s := range []string{"data/conf/gammu.conf",
@@ -109,6 +376,13 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 			}
 		}
 	}
+	return nil
+}
+
+func Main(run_mode string, runHttp func(http.Handler)) error {
+	if e := loadSettings(); nil != e {
+		return e
+	}
 
 	switch run_mode {
 	case "init_db":
@@ -118,127 +392,16 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 			return e
 		}
 		defer backend.Close()
-		switch *db_type {
-		case MSSQL:
-			script := `if object_id('dbo.` + *table_name + `', 'U') is not null
-				BEGIN 
-							 DROP TABLE ` + *table_name + `; 
-				END
-				if object_id('dbo.` + *table_name + `', 'U') is null
-				BEGIN
-				 CREATE TABLE dbo.` + *table_name + ` (
-						  id                INT IDENTITY(1,1)  PRIMARY KEY,
-						  priority          int DEFAULT 0,
-						  repeat_count      int DEFAULT 0,
-						  repeat_interval   varchar(20) DEFAULT '',
-						  attempts          int DEFAULT 0,
-						  max_attempts      int DEFAULT 0,
-						  queue             varchar(200),
-						  handler           text  NOT NULL,
-						  handler_id        varchar(200),
-						  last_error        varchar(2000),
-						  run_at            DATETIME2,
-						  locked_at         DATETIME2,
-						  failed_at         DATETIME2,
-						  locked_by         varchar(200),
-						  created_at        DATETIME2 NOT NULL,
-						  updated_at        DATETIME2 NOT NULL
-						); 
-				END`
-			fmt.Println(script)
-			_, e = backend.db.Exec(script)
-			if nil != e {
-				return e
-			}
-		case POSTGRESQL:
-			script := `DROP TABLE IF EXISTS ` + *table_name + `;
-				CREATE TABLE IF NOT EXISTS ` + *table_name + ` (
-				  id                SERIAL PRIMARY KEY,
-				  priority          int DEFAULT 0,
-		      repeat_count      int DEFAULT 0,
-		      repeat_interval   varchar(20) DEFAULT '',
-				  attempts          int DEFAULT 0,
-		      max_attempts      int DEFAULT 0,
-				  queue             varchar(200),
-				  handler           text  NOT NULL,
-				  handler_id        varchar(200),
-				  last_error        varchar(2000),
-				  run_at            timestamp with time zone,
-				  locked_at         timestamp with time zone,
-				  failed_at         timestamp with time zone,
-				  locked_by         varchar(200),
-				  created_at        timestamp with time zone NOT NULL,
-				  updated_at        timestamp with time zone NOT NULL
-				);`
-			fmt.Println(script)
-			_, e = backend.db.Exec(script)
-			if nil != e {
-				return e
-			}
-		case ORACLE:
-			for _, script := range []string{`BEGIN     EXECUTE IMMEDIATE 'DROP SEQUENCE ` + *table_name + `_sequence_id';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
-				`CREATE SEQUENCE ` + *table_name + `_sequence_id START WITH 1 INCREMENT BY 1 CACHE 100`,
-				`BEGIN EXECUTE IMMEDIATE 'DROP TABLE ` + *table_name + `';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
-				`CREATE TABLE ` + *table_name + ` (
-					  id                NUMBER(10) PRIMARY KEY,
-					  priority          NUMBER(10) DEFAULT 0,
-		        repeat_count      NUMBER(10) DEFAULT 0,
-		        repeat_interval   varchar2(20) DEFAULT '',
-					  attempts          NUMBER(10) DEFAULT 0,
-		        max_attempts      NUMBER(10) DEFAULT 0,
-					  queue             varchar2(200 BYTE),
-					  handler           clob,--  NOT NULL,
-					  handler_id        varchar2(200 BYTE),
-					  last_error        VARCHAR2(2000 BYTE),
-					  run_at            DATE,
-					  locked_at         DATE,
-					  failed_at         DATE,
-					  locked_by         varchar2(200 BYTE),
-					  created_at        DATE, -- NOT NULL,
-					  updated_at        DATE -- timestamp with time zone
-					)`,
-				`BEGIN     EXECUTE IMMEDIATE 'DROP TRIGGER ` + *table_name + `_trigger';     EXCEPTION WHEN OTHERS THEN NULL; END;`,
-				`CREATE OR REPLACE TRIGGER ` + *table_name + `_trigger
-					  BEFORE INSERT ON ` + *table_name + `
-					  FOR EACH ROW
-					BEGIN
-					  SELECT ` + *table_name + `_sequence_id.nextval
-					    INTO :new.id
-					    FROM dual;
-					END;`} {
-				fmt.Println(script)
-				_, e = backend.db.Exec(script)
-				if nil != e {
-					return i18n(ORACLE, "oci8", e)
-				}
-			}
-		default:
-			for _, script := range []string{`DROP TABLE IF EXISTS ` + *table_name + `;`,
-				`CREATE TABLE IF NOT EXISTS ` + *table_name + ` (
-					  id                SERIAL PRIMARY KEY,
-					  priority          int DEFAULT 0,
-		        repeat_count      int DEFAULT 0,
-		        repeat_interval   varchar(20) DEFAULT '',
-					  attempts          int DEFAULT 0,
-		        max_attempts      int DEFAULT 0,
-					  queue             varchar(200),
-					  handler           text  NOT NULL,
-					  handler_id        varchar(200),
-					  last_error        VARCHAR(2000),
-					  run_at            DATETIME,
-					  locked_at         DATETIME,
-					  failed_at         DATETIME,
-					  locked_by         varchar(200),
-					  created_at        DATETIME NOT NULL,
-					  updated_at        timestamp NOT NULL
-					);`} {
-				fmt.Println(script)
-				_, e = backend.db.Exec(script)
-				if nil != e {
-					return e
-				}
-			}
+		return backend.initTables()
+
+	case "upgrade_db":
+		ctx := map[string]interface{}{}
+		backend, e := newBackend(*db_drv, *db_url, ctx)
+		if nil != e {
+			return e
 		}
+		defer backend.Close()
+		return backend.upgradeTables()
 
 	case "console":
 		ctx := map[string]interface{}{}
@@ -246,6 +409,10 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 		if nil != e {
 			return e
 		}
+		handler, e := newConsoleHandler(backend, findFs())
+		if nil != e {
+			return e
+		}
 
 		nm := filepath.Base(os.Args[0])
 		if !isPidInitialize() {
@@ -256,11 +423,12 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 			}
 		}
 		if err := createPidFile(*pidFile, nm); err != nil {
-			fmt.Println(err)
+			defaultLogger().Error("create pid file failed", "file", *pidFile, "error", err)
 			os.Exit(1)
 		}
 		defer removePidFile(*pidFile)
-		httpServe(backend, findFs(), runHttp)
+		defer startConfigReloader(*config_file)()
+		runHttp(handler)
 	case "backend":
 		w, e := newWorker(map[string]interface{}{})
 		if nil != e {
@@ -276,10 +444,12 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 			}
 		}
 		if err := createPidFile(*pidFile, nm); err != nil {
-			fmt.Println(err)
+			defaultLogger().Error("create pid file failed", "file", *pidFile, "error", err)
 			os.Exit(1)
 		}
 		defer removePidFile(*pidFile)
+		defer startConfigReloader(*config_file)()
+		defer registerReloader(w.reloadFlags)()
 
 		w.RunForever()
 	case "all":
@@ -287,6 +457,10 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 		if nil != e {
 			return e
 		}
+		handler, e := newConsoleHandler(w.backend, findFs())
+		if nil != e {
+			return e
+		}
 
 		nm := filepath.Base(os.Args[0])
 		if !isPidInitialize() {
@@ -297,11 +471,13 @@ func Main(run_mode string, runHttp func(http.Handler)) error {
 			}
 		}
 		if err := createPidFile(*pidFile, nm); err != nil {
-			fmt.Println(err)
+			defaultLogger().Error("create pid file failed", "file", *pidFile, "error", err)
 			os.Exit(1)
 		}
 		defer removePidFile(*pidFile)
-		go httpServe(w.backend, findFs(), runHttp)
+		defer startConfigReloader(*config_file)()
+		defer registerReloader(w.reloadFlags)()
+		go runHttp(handler)
 		w.RunForever()
 	}
 	return nil
@@ -313,7 +489,7 @@ func findFs() http.Handler {
 		filepath.Join("..", "public", "index.html"),
 		filepath.Join("lib", "delayed_jobs", "index.html")} {
 		if fileExists(s) {
-			log.Println("public directory is found in the", s)
+			defaultLogger().Info("public directory is found", "file", s)
 			return http.FileServer(http.Dir(filepath.Dir(s)))
 		}
 	}
@@ -413,35 +589,208 @@ func activeHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
 }
 
 func countsHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
-	var all_size, failed_size, queued_size, active_size int64
-	var e error
+	counts, e := backend.counts()
+	if nil != e {
+		w.Header()["Content-Type"] = []string{"text/plain; charset=utf-8"}
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	io.WriteString(w, fmt.Sprintf(`{"all":%v,"failed":%v,"active":%v,"queued":%v}`, counts["all"], counts["failed"], counts["active"], counts["queued"]))
+}
 
-	all_size, e = backend.count(nil)
+func queuesHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	results, e := backend.queueStates()
 	if nil != e {
-		goto failed
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
 	}
-	failed_size, e = backend.count(map[string]interface{}{"@failed_at": "[notnull]"})
+
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	e = json.NewEncoder(w).Encode(results)
 	if nil != e {
-		goto failed
+		w.Header()["Content-Type"] = []string{"text/plain; charset=utf-8"}
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+}
+
+func queueStateHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend, paused bool) {
+	ss := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	name := ss[len(ss)-2]
+
+	var e error
+	if paused {
+		e = backend.pauseQueue(name)
+	} else {
+		e = backend.resumeQueue(name)
 	}
-	queued_size, e = backend.count(map[string]interface{}{"@failed_at": nil, "locked_by": nil})
 	if nil != e {
-		goto failed
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+
+	if paused {
+		backend.audit(r, "pause_queue", name, nil, nil)
+	} else {
+		backend.audit(r, "resume_queue", name, nil, nil)
+	}
+
+	if isFormPost(r) {
+		seeDashboard(w, r, "queues")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if paused {
+		io.WriteString(w, "The queue '"+name+"' has been paused")
+	} else {
+		io.WriteString(w, "The queue '"+name+"' has been resumed")
+	}
+}
+
+// isFormPost returns true if the request is posted by a html form of the
+// dashboard without the script, the ajax requests of dj_mon.js have the
+// 'X-Requested-With' header.
+func isFormPost(r *http.Request) bool {
+	if "" != r.Header.Get("X-Requested-With") {
+		return false
+	}
+	content_type := r.Header.Get("Content-Type")
+	return strings.HasPrefix(content_type, "application/x-www-form-urlencoded") ||
+		strings.HasPrefix(content_type, "multipart/form-data")
+}
+
+// seeDashboard redirects the form post back to the tab of the dashboard. The
+// location is relative, because the actions of the dashboard are relative to
+// it (such as 'delayed_jobs/queues/{name}/pause') and the console may be
+// mounted under a prefix.
+func seeDashboard(w http.ResponseWriter, r *http.Request, tab string) {
+	path := r.URL.Path
+	idx := strings.LastIndex(path, "delayed_jobs/"+tab+"/")
+	if idx < 0 {
+		idx = strings.LastIndex(path, tab+"/")
+	}
+	location := "./"
+	if idx >= 0 {
+		location = strings.Repeat("../", strings.Count(path[idx:], "/"))
+	}
+	w.Header().Set("Location", location+"#"+tab)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// jobResultHandler returns the result of the finished job, the job is
+// specified by id or handler_id.
+func jobResultHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	ss := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	key := ss[len(ss)-2]
+
+	var result map[string]interface{}
+	var e error
+	if id, err := strconv.ParseInt(key, 10, 64); nil == err {
+		result, e = backend.jobResult(id, "")
+	}
+	if nil == e && nil == result {
+		result, e = backend.jobResult(0, key)
 	}
-	active_size, e = backend.count(map[string]interface{}{"@failed_at": nil, "locked_by": "[notnull]"})
 	if nil != e {
-		goto failed
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+	if nil == result {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "the result of job '"+key+"' is not found")
+		return
 	}
 
 	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
-	io.WriteString(w, fmt.Sprintf(`{"all":%v,"failed":%v,"active":%v,"queued":%v}`, all_size, failed_size, active_size, queued_size))
-	return
+	json.NewEncoder(w).Encode(result)
+}
 
-failed:
-	w.Header()["Content-Type"] = []string{"text/plain; charset=utf-8"}
-	w.WriteHeader(http.StatusInternalServerError)
-	io.WriteString(w, e.Error())
-	return
+// bulkHandler applies the action to the jobs matching the filter, the body is
+// {"filter": {...}, "queue": "", "priority": 0, "run_at": "", "dry_run": false, "confirm_token": ""}.
+func bulkHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	ss := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	action := ss[len(ss)-1]
+
+	var ent map[string]interface{}
+	if nil != r.Body {
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		e := decoder.Decode(&ent)
+		if nil != e && io.EOF != e {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, e.Error())
+			return
+		}
+	}
+	if nil == ent {
+		ent = map[string]interface{}{}
+	}
+
+	var filter map[string]interface{}
+	if o, ok := ent["filter"]; ok && nil != o {
+		if filter, ok = o.(map[string]interface{}); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "'filter' is not a map[string]interface{}.")
+			return
+		}
+	}
+
+	dry_run := boolWithDefault(ent, "dry_run", false)
+	if !dry_run {
+		required := isDestructiveBulkAction(action) || isEmptyBulkFilter(filter)
+		if !required {
+			// the action is confirmed if it matches too many jobs.
+			count, _, e := backend.bulk(action, filter, ent, true)
+			if nil != e {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, e.Error())
+				return
+			}
+			required = bulkConfirmRequired(action, filter, count)
+		}
+		if required {
+			e := backend.verifyBulkConfirmToken(stringWithDefault(ent, "confirm_token", ""), action, filter, ent, time.Now())
+			if nil != e {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				io.WriteString(w, e.Error())
+				return
+			}
+		}
+	}
+
+	count, ids, e := backend.bulk(action, filter, ent, dry_run)
+	if nil != e {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, e.Error())
+		return
+	}
+	if !dry_run {
+		if count > 0 {
+			publishBulkEvent(action, count)
+		}
+		changes := bulkValues(ent)
+		changes["count"] = count
+		if nil != ids {
+			changes["ids"] = ids
+		}
+		backend.audit(r, "bulk_"+action, jsonString(filter), nil, changes)
+	}
+
+	result := map[string]interface{}{"action": action, "dry_run": dry_run, "count": count}
+	if dry_run && bulkConfirmRequired(action, filter, count) {
+		result["confirm_token"] = backend.bulkConfirmToken(action, filter, ent, time.Now())
+	}
+
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	json.NewEncoder(w).Encode(result)
 }
 
 func testJobHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
@@ -455,10 +804,15 @@ func testJobHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend)
 		return
 	}
 
+	dry_run := boolWithDefault(ent, "dry_run", false)
+	if s := r.URL.Query().Get("dry_run"); 0 != len(s) {
+		dry_run, _ = strconv.ParseBool(s)
+	}
+	delete(ent, "dry_run")
+
 	job, e := createJobFromMap(backend, ent)
 	if nil != e {
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, e.Error())
+		writeJobError(w, http.StatusInternalServerError, "", e)
 		return
 	}
 
@@ -468,85 +822,126 @@ func testJobHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend)
 		}
 	}
 
+	if dry_run {
+		output, e := job.render()
+		if nil != e {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, e.Error())
+			return
+		}
+		w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+		json.NewEncoder(w).Encode(map[string]interface{}{"type": job.typeName(), "output": output})
+		return
+	}
+
 	e = job.invokeJob()
 	if nil != e {
+		// the test may fail after it is sent to a part of the receivers.
+		failed := map[string]interface{}{}
+		for k, v := range ent {
+			failed[k] = v
+		}
+		failed["error"] = e
+		backend.audit(r, "test", stringWithDefault(ent, "type", ""), nil, failed)
+
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, e.Error())
 		return
 	}
+	backend.audit(r, "test", stringWithDefault(ent, "type", ""), nil, ent)
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, "OK")
 	return
 }
 
 func pushHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
-	decoder := json.NewDecoder(r.Body)
-	decoder.UseNumber()
-	var ent map[string]interface{}
-	e := decoder.Decode(&ent)
+	body, e := ioutil.ReadAll(r.Body)
 	if nil != e {
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, e.Error())
 		return
 	}
-
-	job, e := createJobFromMap(backend, ent)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var ent map[string]interface{}
+	e = decoder.Decode(&ent)
 	if nil != e {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, e.Error())
 		return
 	}
 
-	e = backend.create(job)
+	idempotent(w, backend, idempotencyKey(r, ent), body, func(w http.ResponseWriter, save idempotentSaver) {
+		job, e := createJobFromMap(backend, ent)
+		if nil != e {
+			writeJobError(w, http.StatusInternalServerError, "", e)
+			return
+		}
+
+		e = backend.changeWith([]*Job{job}, func(db sqlExecutor) error {
+			return save(db, http.StatusOK, "OK")
+		})
+		if nil != e {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, e.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "OK")
+	})
+}
+
+func pushAllHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	body, e := ioutil.ReadAll(r.Body)
 	if nil != e {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, e.Error())
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, "OK")
-	return
-}
-
-func pushAllHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
-	var jobs []*Job
-	decoder := json.NewDecoder(r.Body)
+	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.UseNumber()
 	var entities []map[string]interface{}
-	e := decoder.Decode(&entities)
+	e = decoder.Decode(&entities)
 	if nil != e {
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, e.Error())
 		return
 	}
-	if nil == entities || 0 == len(entities) {
-		goto OK
-	}
 
-	jobs = make([]*Job, len(entities))
-	for i, ent := range entities {
-		jobs[i], e = createJobFromMap(backend, ent)
-		if nil != e {
-			w.WriteHeader(http.StatusBadRequest)
-			io.WriteString(w, "parse data["+strconv.FormatInt(int64(i), 10)+"] failed, "+e.Error())
-			return
+	idempotent(w, backend, idempotencyKey(r, nil), body, func(w http.ResponseWriter, save idempotentSaver) {
+		if 0 != len(entities) {
+			jobs := make([]*Job, len(entities))
+			for i, ent := range entities {
+				job, e := createJobFromMap(backend, ent)
+				if nil != e {
+					writeJobError(w, http.StatusBadRequest, "parse data["+strconv.FormatInt(int64(i), 10)+"] failed, ", e)
+					return
+				}
+				jobs[i] = job
+			}
+
+			e := backend.changeWith(jobs, func(db sqlExecutor) error {
+				return save(db, http.StatusOK, "OK")
+			})
+			if nil != e {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, e.Error())
+				return
+			}
 		}
-	}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "OK")
+	})
+}
 
-	backend.create(jobs...)
-	if nil != e {
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, e.Error())
+func readSettingsFileHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	if "json" == configFormat(*config_file) {
+		fileHandler(w, r, *config_file, "{}")
 		return
 	}
-OK:
-	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, "OK")
-	return
-}
 
-func readSettingsFileHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
-	fileHandler(w, r, *config_file, "{}")
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	json.NewEncoder(w).Encode(readSettingsFile(*config_file))
 }
 
 func settingsFileHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
@@ -560,37 +955,25 @@ func settingsFileHandler(w http.ResponseWriter, r *http.Request, backend *dbBack
 		return
 	}
 
-	e = assignFlagSet("", entities, nil, default_actuals, false)
-	if nil != e {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, e.Error())
+	if errs := checkSettings(r, entities); hasSettingErrors(errs) {
+		writeSettingErrors(w, http.StatusBadRequest, errs)
 		return
 	}
 
-	f, e := os.OpenFile(*config_file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	keys, before, after := diffSettings(readSettingsFile(*config_file), entities)
+	report, e := saveSettings(*config_file, entities)
 	if nil != e {
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, e.Error())
 		return
 	}
-	defer f.Close()
-
-	b, e := json.MarshalIndent(entities, "", "  ")
-	if e != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, e.Error())
-		return
-	}
-	_, e = f.Write(b)
-	if e != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, e.Error())
-		return
+	if 0 != len(keys) {
+		backend.audit(r, "settings", strings.Join(keys, ","), before, after)
 	}
 
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
 	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, "OK")
-	return
+	json.NewEncoder(w).Encode(report)
 }
 
 type webFront struct {
@@ -604,25 +987,57 @@ func (self *webFront) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
 		switch r.URL.Path {
-		case "/all":
+		case "/all", "/delayed_jobs/all", "/delayed_job/all":
 			allHandler(w, r, backend)
 			return
-		case "/failed":
+		case "/failed", "/delayed_jobs/failed", "/delayed_job/failed":
 			failedHandler(w, r, backend)
 			return
-		case "/queued":
+		case "/queued", "/delayed_jobs/queued", "/delayed_job/queued":
 			queuedHandler(w, r, backend)
 			return
-		case "/active":
+		case "/active", "/delayed_jobs/active", "/delayed_job/active":
 			activeHandler(w, r, backend)
 			return
-		case "/counts":
+		case "/counts", "/delayed_jobs/counts", "/delayed_job/counts":
 			countsHandler(w, r, backend)
 			return
+		case "/queues", "/delayed_jobs/queues", "/delayed_job/queues":
+			queuesHandler(w, r, backend)
+			return
+		case "/events", "/delayed_jobs/events", "/delayed_job/events":
+			eventsHandler(w, r, backend)
+			return
+		case "/metrics", "/delayed_jobs/metrics", "/delayed_job/metrics":
+			metricsHandler(w, r, backend)
+			return
 		case "/settings_file", "/delayed_jobs/settings_file", "/delayed_job/settings_file":
 			readSettingsFileHandler(w, r, backend)
 			return
+		case "/settings_schema", "/delayed_jobs/settings_schema", "/delayed_job/settings_schema":
+			settingsSchemaHandler(w, r, backend)
+			return
+		case "/audit", "/delayed_jobs/audit", "/delayed_job/audit":
+			auditHandler(w, r, backend)
+			return
+		case "/handlers", "/delayed_jobs/handlers", "/delayed_job/handlers":
+			handlersHandler(w, r, backend)
+			return
 		default:
+			for _, job_result := range job_result_list {
+				if job_result.MatchString(r.URL.Path) {
+					jobResultHandler(w, r, backend)
+					return
+				}
+			}
+
+			for _, handler_info := range handler_info_list {
+				if handler_info.MatchString(r.URL.Path) {
+					handlersHandler(w, r, backend)
+					return
+				}
+			}
+
 			if nil == self.fs && !strings.HasPrefix(r.URL.Path, "/debug/") {
 				statikFS, err := fs.New()
 				if err != nil {
@@ -643,36 +1058,65 @@ func (self *webFront) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			testJobHandler(w, r, backend)
 			return
 
-		case "/push":
+		case "/push", "/delayed_jobs/push", "/delayed_job/push":
 			pushHandler(w, r, backend)
 			return
 
-		case "/pushAll":
+		case "/pushAll", "/delayed_jobs/pushAll", "/delayed_job/pushAll":
 			pushAllHandler(w, r, backend)
 			return
 
 		case "/settings_file", "/delayed_jobs/settings_file", "/delayed_job/settings_file":
 			settingsFileHandler(w, r, backend)
 			return
+
+		case "/settings_validate", "/delayed_jobs/settings_validate", "/delayed_job/settings_validate":
+			settingsValidateHandler(w, r, backend)
+			return
 		}
 
 	case "POST":
 		switch r.URL.Path {
-		case "/test", "/delayed_jobs/test":
+		case "/test", "/delayed_jobs/test", "/delayed_job/test":
 			testJobHandler(w, r, backend)
 			return
 
-		case "/push":
+		case "/push", "/delayed_jobs/push", "/delayed_job/push":
 			pushHandler(w, r, backend)
 			return
 
-		case "/pushAll":
+		case "/pushAll", "/delayed_jobs/pushAll", "/delayed_job/pushAll":
 			pushAllHandler(w, r, backend)
 			return
 
 		case "/settings_file", "/delayed_jobs/settings_file", "/delayed_job/settings_file":
 			settingsFileHandler(w, r, backend)
 			return
+
+		case "/settings_validate", "/delayed_jobs/settings_validate", "/delayed_job/settings_validate":
+			settingsValidateHandler(w, r, backend)
+			return
+		}
+
+		for _, bulk := range bulk_list {
+			if bulk.MatchString(r.URL.Path) {
+				bulkHandler(w, r, backend)
+				return
+			}
+		}
+
+		for _, pause := range queue_pause_list {
+			if pause.MatchString(r.URL.Path) {
+				queueStateHandler(w, r, backend, true)
+				return
+			}
+		}
+
+		for _, resume := range queue_resume_list {
+			if resume.MatchString(r.URL.Path) {
+				queueStateHandler(w, r, backend, false)
+				return
+			}
 		}
 
 		for _, retry := range retry_list {
@@ -685,8 +1129,11 @@ func (self *webFront) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 
+				before := backend.jobSnapshot(id)
 				e = backend.retry(id)
 				if nil == e {
+					publishJobEvent(JobRetried, &JobInfo{ID: id}, nil)
+					backend.audit(r, "retry", strconv.FormatInt(id, 10), before, map[string]interface{}{"failed_at": nil})
 					w.WriteHeader(http.StatusOK)
 					io.WriteString(w, "The job has been queued for a re-run")
 				} else {
@@ -707,8 +1154,11 @@ func (self *webFront) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 
+				before := backend.jobSnapshot(id)
 				e = backend.destroy(id)
 				if nil == e {
+					publishJobEvent(JobDeleted, &JobInfo{ID: id}, nil)
+					backend.audit(r, "delete", strconv.FormatInt(id, 10), before, nil)
 					w.WriteHeader(http.StatusOK)
 					io.WriteString(w, "The job was deleted")
 				} else {
@@ -729,8 +1179,11 @@ func (self *webFront) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 
+				before := backend.jobSnapshot(id)
 				e = backend.destroy(id)
 				if nil == e {
+					publishJobEvent(JobDeleted, &JobInfo{ID: id}, nil)
+					backend.audit(r, "delete", strconv.FormatInt(id, 10), before, nil)
 					w.WriteHeader(http.StatusOK)
 					io.WriteString(w, "The job was deleted")
 				} else {
@@ -745,6 +1198,12 @@ func (self *webFront) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.DefaultServeMux.ServeHTTP(w, r)
 }
 
-func httpServe(backend *dbBackend, handler http.Handler, runHttp func(http.Handler)) {
-	runHttp(&webFront{dbBackend: backend, fs: handler})
+// newConsoleHandler creates the handler of the console, the requests are
+// authenticated if 'auth.tokens' or 'auth.users' is set.
+func newConsoleHandler(backend *dbBackend, fs http.Handler) (http.Handler, error) {
+	authenticators, e := authenticatorsFromFlags()
+	if nil != e {
+		return nil, e
+	}
+	return newAuthHandler(&webFront{dbBackend: backend, fs: fs}, authenticators, *auth_anonymous_role)
 }
@@ -0,0 +1,348 @@
+package delayed_job
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	settings_check_timeout = flag.Duration("settings_check_timeout", 3*time.Second, "the timeout of the connectivity checks of the settings")
+
+	// the allowed values of the settings, nil is unlimited.
+	setting_allowed_values = map[string]func() []string{
+		"log_level":           staticValues("debug", "info", "warn", "error"),
+		"log_format":          staticValues("text", "logfmt", "json"),
+		"auth.anonymous_role": staticValues("", RoleViewer, RoleOperator, RoleAdmin),
+		"mail.useTLS":         staticValues("", "auto", "true", "always", "false", "never"),
+		"mail.auth.type":      staticValues("", "login", "plain", "cram-md5", "ntlm", "ntlmv1", "ntlmv2"),
+		"syslog.facility":     func() []string { return sortedKeys(string_2_facility) },
+		"syslog.severity":     func() []string { return sortedKeys(string_2_severity) },
+		"sms.method": func() []string {
+			// the methods are unknown if SendSMS is replaced.
+			if nil != SendSMS {
+				return nil
+			}
+			return []string{"", "gammu", "ns20"}
+		}}
+)
+
+func staticValues(values ...string) func() []string {
+	return func() []string {
+		return values
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// settingSchema describes a setting, it is derived from the flag.
+type settingSchema struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+	Allowed     []string    `json:"allowed,omitempty"`
+	Secret      bool        `json:"secret"`
+}
+
+// settingError is a problem of a setting, the level is "error" or "warning",
+// the settings with the errors can't be saved.
+type settingError struct {
+	Key     string `json:"key"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// settingType returns the type of the flag, it is one of bool, int, float,
+// duration and string.
+func settingType(f *flag.Flag) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "string"
+	}
+	switch getter.Get().(type) {
+	case bool:
+		return "bool"
+	case int, int64, uint, uint64:
+		return "int"
+	case float64:
+		return "float"
+	case time.Duration:
+		return "duration"
+	}
+	return "string"
+}
+
+func settingDefault(f *flag.Flag, typ string) interface{} {
+	if isSensitive(f.Name) && 0 != len(f.DefValue) {
+		return redacted
+	}
+	switch typ {
+	case "bool":
+		if b, e := strconv.ParseBool(f.DefValue); nil == e {
+			return b
+		}
+	case "int":
+		if i, e := strconv.ParseInt(f.DefValue, 10, 64); nil == e {
+			return i
+		}
+	case "float":
+		if v, e := strconv.ParseFloat(f.DefValue, 64); nil == e {
+			return v
+		}
+	}
+	return f.DefValue
+}
+
+// settingsSchema returns the schema of all settings, sorted by the name.
+func settingsSchema() []settingSchema {
+	var schemas []settingSchema
+	flag.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "test.") {
+			return
+		}
+
+		typ := settingType(f)
+		schema := settingSchema{Name: f.Name,
+			Type:        typ,
+			Default:     settingDefault(f, typ),
+			Description: f.Usage,
+			Secret:      isSensitive(f.Name)}
+		if allowed, ok := setting_allowed_values[f.Name]; ok {
+			schema.Allowed = allowed()
+		}
+		schemas = append(schemas, schema)
+	})
+	sort.Slice(schemas, func(i, j int) bool {
+		return schemas[i].Name < schemas[j].Name
+	})
+	return schemas
+}
+
+func checkSettingValue(typ, s string) error {
+	var e error
+	switch typ {
+	case "bool":
+		_, e = strconv.ParseBool(s)
+	case "int":
+		_, e = strconv.ParseInt(s, 10, 64)
+	case "float":
+		_, e = strconv.ParseFloat(s, 64)
+	case "duration":
+		_, e = time.ParseDuration(s)
+	}
+	if nil != e {
+		return fmt.Errorf("'%s' isn't a valid %s", s, typ)
+	}
+	return nil
+}
+
+// validateSettings checks the types and the allowed values of the settings,
+// the unknown keys are warnings unless config_strict is set.
+func validateSettings(settings map[string]interface{}) []settingError {
+	flat := flattenSettings("", settings, nil)
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []settingError
+	for _, k := range keys {
+		v := flat[k]
+		if nil == v {
+			continue
+		}
+
+		f := flag.Lookup(k)
+		if nil == f {
+			level := "warning"
+			if *config_strict {
+				level = "error"
+			}
+			errs = append(errs, settingError{Key: k, Level: level, Message: "setting '" + k + "' is unknown."})
+			continue
+		}
+		if e := checkFlagType(f, v); nil != e {
+			errs = append(errs, settingError{Key: k, Level: "error", Message: e.Error()})
+			continue
+		}
+
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		s := fmt.Sprint(v)
+		if e := checkSettingValue(settingType(f), s); nil != e {
+			errs = append(errs, settingError{Key: k, Level: "error", Message: e.Error()})
+			continue
+		}
+		if allowed, ok := setting_allowed_values[k]; ok {
+			if values := allowed(); nil != values && !stringInSlice(values, s) {
+				errs = append(errs, settingError{Key: k, Level: "error",
+					Message: "'" + s + "' isn't one of [" + strings.Join(values, ", ") + "]"})
+			}
+		}
+	}
+	return errs
+}
+
+func stringInSlice(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// settingValue returns the value in the settings, or the current value of the
+// flag if it isn't in the settings.
+func settingValue(flat map[string]interface{}, name string) string {
+	if v, ok := flat[name]; ok && nil != v {
+		return fmt.Sprint(v)
+	}
+	if f := flag.Lookup(name); nil != f {
+		return f.Value.String()
+	}
+	return ""
+}
+
+func hasAnySetting(flat map[string]interface{}, names ...string) bool {
+	for _, name := range names {
+		if _, ok := flat[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConnectivity connects to the smtp server, the redis and the database in
+// the settings, only the services whose settings are present are checked.
+func checkConnectivity(settings map[string]interface{}) []settingError {
+	flat := flattenSettings("", settings, nil)
+	timeout := *settings_check_timeout
+
+	var errs []settingError
+	if hasAnySetting(flat, "mail.smtp_server") {
+		if address := settingValue(flat, "mail.smtp_server"); 0 != len(address) {
+			if _, _, e := net.SplitHostPort(address); nil != e {
+				address = net.JoinHostPort(address, "25")
+			}
+			conn, e := net.DialTimeout("tcp", address, timeout)
+			if nil != e {
+				errs = append(errs, settingError{Key: "mail.smtp_server", Level: "error", Message: "connect to smtp server failed, " + e.Error()})
+			} else {
+				conn.Close()
+			}
+		}
+	}
+
+	if hasAnySetting(flat, "redis.address", "redis.password") {
+		if address := settingValue(flat, "redis.address"); 0 != len(address) {
+			options := []redis.DialOption{redis.DialConnectTimeout(timeout),
+				redis.DialReadTimeout(timeout),
+				redis.DialWriteTimeout(timeout)}
+			if password := settingValue(flat, "redis.password"); 0 != len(password) {
+				options = append(options, redis.DialPassword(password))
+			}
+			c, e := redis.Dial("tcp", address, options...)
+			if nil == e {
+				_, e = c.Do("PING")
+				c.Close()
+			}
+			if nil != e {
+				errs = append(errs, settingError{Key: "redis.address", Level: "error", Message: "connect to redis failed, " + e.Error()})
+			}
+		}
+	}
+
+	if hasAnySetting(flat, "db_drv", "db_url") {
+		drv := settingValue(flat, "db_drv")
+		if strings.HasPrefix(drv, "odbc_with_") {
+			drv = "odbc"
+		}
+		if e := pingDB(drv, settingValue(flat, "db_url"), timeout); nil != e {
+			errs = append(errs, settingError{Key: "db_url", Level: "error", Message: "connect to database failed, " + redactString(e.Error())})
+		}
+	}
+	return errs
+}
+
+func pingDB(drv, url string, timeout time.Duration) error {
+	db, e := sql.Open(drv, url)
+	if nil != e {
+		return e
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+func hasSettingErrors(errs []settingError) bool {
+	for _, e := range errs {
+		if "error" == e.Level {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSettings validates the settings, the connectivity is checked unless the
+// 'check' query parameter is false.
+func checkSettings(r *http.Request, settings map[string]interface{}) []settingError {
+	errs := validateSettings(settings)
+	if check, e := strconv.ParseBool(r.URL.Query().Get("check")); nil != e || check {
+		if !hasSettingErrors(errs) {
+			errs = append(errs, checkConnectivity(settings)...)
+		}
+	}
+	return errs
+}
+
+func writeSettingErrors(w http.ResponseWriter, code int, errs []settingError) {
+	if nil == errs {
+		errs = []settingError{}
+	}
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": !hasSettingErrors(errs), "errors": errs})
+}
+
+func settingsSchemaHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	w.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	json.NewEncoder(w).Encode(settingsSchema())
+}
+
+// settingsValidateHandler validates the settings without saving them.
+func settingsValidateHandler(w http.ResponseWriter, r *http.Request, backend *dbBackend) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var settings map[string]interface{}
+	if e := decoder.Decode(&settings); nil != e {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, e.Error())
+		return
+	}
+	writeSettingErrors(w, http.StatusOK, checkSettings(r, settings))
+}
@@ -0,0 +1,153 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSettingsSchema(t *testing.T) {
+	schemas := map[string]settingSchema{}
+	for _, schema := range settingsSchema() {
+		schemas[schema.Name] = schema
+	}
+
+	for _, test := range []struct {
+		name string
+		typ  string
+	}{{name: "sleep_delay", typ: "duration"},
+		{name: "max_attempts", typ: "int"},
+		{name: "config_strict", typ: "bool"},
+		{name: "mail.smtp_server", typ: "string"}} {
+		schema, ok := schemas[test.name]
+		if !ok {
+			t.Error(test.name, "isn't in the schema")
+			continue
+		}
+		if test.typ != schema.Type {
+			t.Error(test.name, "excepted type is", test.typ, ", actual is", schema.Type)
+		}
+		if 0 == len(schema.Description) {
+			t.Error(test.name, "description is empty")
+		}
+	}
+
+	if schema := schemas["log_format"]; "text,logfmt,json" != strings.Join(schema.Allowed, ",") {
+		t.Error("excepted allowed of log_format is [text logfmt json], actual is", schema.Allowed)
+	}
+	if schema := schemas["syslog.facility"]; 0 == len(schema.Allowed) {
+		t.Error("allowed of syslog.facility is empty")
+	}
+	if schema := schemas["mail.auth.password"]; !schema.Secret {
+		t.Error("mail.auth.password should be secret")
+	}
+	if schema := schemas["sleep_delay"]; schema.Secret {
+		t.Error("sleep_delay shouldn't be secret")
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	restoreFlags(t, "config_strict")
+
+	errs := validateSettings(map[string]interface{}{"sleep_delay": "3s",
+		"max_attempts": json.Number("3"),
+		"log_format":   "json",
+		"mail":         map[string]interface{}{"useTLS": "auto"}})
+	if 0 != len(errs) {
+		t.Error("excepted no errors, actual is", errs)
+	}
+
+	errs = validateSettings(map[string]interface{}{"sleep_delay": "abc",
+		"max_attempts":  "3.5",
+		"log_format":    "xml",
+		"config_strict": "true",
+		"not_exists":    "a"})
+	levels := map[string]string{}
+	for _, e := range errs {
+		levels[e.Key] = e.Level
+	}
+	for _, key := range []string{"sleep_delay", "max_attempts", "log_format", "config_strict"} {
+		if "error" != levels[key] {
+			t.Error(key, "excepted level is error, actual is", levels[key])
+		}
+	}
+	if "warning" != levels["not_exists"] {
+		t.Error("not_exists excepted level is warning, actual is", levels["not_exists"])
+	}
+
+	flag.Set("config_strict", "true")
+	errs = validateSettings(map[string]interface{}{"not_exists": "a"})
+	if 1 != len(errs) || "error" != errs[0].Level {
+		t.Error("unknown key should be an error in strict mode, actual is", errs)
+	}
+}
+
+func TestCheckConnectivity(t *testing.T) {
+	restoreFlags(t, "settings_check_timeout")
+	flag.Set("settings_check_timeout", "1s")
+
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if nil != e {
+		t.Fatal(e)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	errs := checkConnectivity(map[string]interface{}{"mail": map[string]interface{}{"smtp_server": address}})
+	if 1 != len(errs) || "mail.smtp_server" != errs[0].Key {
+		t.Error("excepted smtp server is unreachable, actual is", errs)
+	}
+
+	errs = checkConnectivity(map[string]interface{}{"db_drv": "not_exists", "db_url": "abc"})
+	if 1 != len(errs) || "db_url" != errs[0].Key {
+		t.Error("excepted db driver is unknown, actual is", errs)
+	}
+
+	if errs = checkConnectivity(map[string]interface{}{"sleep_delay": "3s"}); 0 != len(errs) {
+		t.Error("excepted nothing is checked, actual is", errs)
+	}
+}
+
+func TestSettingsValidateByHttp(t *testing.T) {
+	front := &webFront{nil, nil}
+
+	r := httptest.NewRequest("GET", "/settings_schema", nil)
+	w := httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	var schemas []settingSchema
+	if e := json.Unmarshal(w.Body.Bytes(), &schemas); nil != e {
+		t.Fatal(e, w.Body.String())
+	}
+	if 0 == len(schemas) {
+		t.Error("schema is empty")
+	}
+
+	r = httptest.NewRequest("POST", "/delayed_jobs/settings_validate?check=false",
+		strings.NewReader(`{"sleep_delay": "abc", "mail": {"smtp_server": "127.0.0.1:1"}}`))
+	w = httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	if http.StatusOK != w.Code {
+		t.Fatal("excepted status is 200, actual is", w.Code, w.Body.String())
+	}
+	var result struct {
+		Valid  bool           `json:"valid"`
+		Errors []settingError `json:"errors"`
+	}
+	if e := json.Unmarshal(w.Body.Bytes(), &result); nil != e {
+		t.Fatal(e)
+	}
+	if result.Valid || 1 != len(result.Errors) || "sleep_delay" != result.Errors[0].Key {
+		t.Error("excepted sleep_delay is invalid, actual is", w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/settings_file", strings.NewReader(`{"log_level": "verbose"}`))
+	w = httptest.NewRecorder()
+	front.ServeHTTP(w, r)
+	if http.StatusBadRequest != w.Code || !strings.Contains(w.Body.String(), "log_level") {
+		t.Error("excepted invalid settings are rejected, actual is", w.Code, w.Body.String())
+	}
+}
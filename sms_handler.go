@@ -56,6 +56,8 @@ type smsHandler struct {
 	content              string
 	phone_numbers        []string
 	failed_phone_numbers []string
+
+	handlerLogger
 }
 
 func readPhoneNumbers(params map[string]interface{}) ([]string, error) {
@@ -84,7 +86,7 @@ func readPhoneNumbers(params map[string]interface{}) ([]string, error) {
 			}
 
 			if GetUserPhone == nil {
-				log.Println("GetUserPhone hook is empty")
+				defaultLogger().Warn("GetUserPhone hook is empty")
 				continue
 			}
 			phone, err := GetUserPhone(id)
@@ -92,7 +94,7 @@ func readPhoneNumbers(params map[string]interface{}) ([]string, error) {
 				return nil, err
 			}
 			if phone == "" {
-				log.Println("phone is missing for user", id)
+				defaultLogger().Warn("phone is missing for user", "user", id)
 			} else {
 				phoneNumbers = append(phoneNumbers, phone)
 				// log.Println("phone is '", phone, "' for user", id)
@@ -147,7 +149,8 @@ func (self *smsHandler) UpdatePayloadObject(options map[string]interface{}) {
 func (self *smsHandler) Perform() error {
 	if smsLimiter != nil {
 		if !smsLimiter.CanSend() {
-			log.Println("超过限制不能再发了")
+			self.log().Warn("超过限制不能再发了")
+			metric_deliveries.inc("sms", "limited")
 			return nil
 		}
 	}
@@ -172,6 +175,7 @@ func (self *smsHandler) Perform() error {
 				e = errors.New("sms method '" + smsMethod + "' is unknown")
 			}
 		}
+		observeDelivery("sms", e)
 
 		if nil != e {
 			phone_numbers = append(phone_numbers, phone)
@@ -190,6 +194,21 @@ func (self *smsHandler) Perform() error {
 	return last
 }
 
+// Render returns the text and the phone numbers which the sms would be sent
+// to.
+func (self *smsHandler) Render() (map[string]interface{}, error) {
+	phone_numbers := make([]string, 0, len(self.phone_numbers))
+	for _, phone := range self.phone_numbers {
+		if "" == strings.TrimSpace(phone) || "null" == strings.TrimSpace(phone) {
+			continue
+		}
+		phone_numbers = append(phone_numbers, phone)
+	}
+	return map[string]interface{}{"method": smsMethod,
+		"phone_numbers": phone_numbers,
+		"content":       self.content}, nil
+}
+
 func SendByGammu(phone, content string) error {
 	var excepted string
 	var cmd *exec.Cmd
@@ -247,4 +266,15 @@ func init() {
 	Handlers["sms"] = newSMSHandler
 	Handlers["sms_action"] = newSMSHandler
 	Handlers["sms_command"] = newSMSHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "sms",
+		Description: "send the short message by the '-sms.method'",
+		Aliases:     []string{"sms_action", "sms_command"},
+		Params: []HandlerParam{{Name: "content", Type: "string", Required: true, Template: true,
+			Description: "the content of the message"},
+			{Name: "phone_numbers", Type: "strings", Aliases: []string{"phoneNumbers"},
+				Description: "the phone numbers, they are separated by the comma or the new line"},
+			{Name: "users", Type: "strings", Description: "the ids of the users whose phones are the recipients"},
+			param_arguments},
+		TemplateArgs: default_template_args})
 }
@@ -31,3 +31,23 @@ func TestSMSHandler(t *testing.T) {
 		return
 	}
 }
+
+func TestSMSHandlerRender(t *testing.T) {
+	handler, e := newSMSHandler(map[string]interface{}{}, map[string]interface{}{"phone_numbers": "13800000000, null,13900000000",
+		"content":   "hello {{.name}}",
+		"arguments": map[string]interface{}{"name": "mei"}})
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	output, e := handler.(Renderer).Render()
+	if nil != e {
+		t.Fatal(e)
+	}
+	if "hello mei" != output["content"] {
+		t.Error("excepted content is 'hello mei', actual is", output["content"])
+	}
+	if phone_numbers := output["phone_numbers"].([]string); 2 != len(phone_numbers) {
+		t.Error("excepted phone_numbers is 2 numbers, actual is", phone_numbers)
+	}
+}
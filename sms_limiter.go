@@ -3,7 +3,6 @@ package delayed_job
 import (
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"os"
 	"sync"
 	"time"
@@ -73,6 +72,28 @@ func (smsLimiter *SmsLimiter) CanSend() bool {
 	return true
 }
 
+// Remaining returns the budget of today, the last 7 days and the last 30 days,
+// it is -1 if the limit is disabled.
+func (smsLimiter *SmsLimiter) Remaining() (int32, int32, int32) {
+	smsLimiter.mu.Lock()
+	defer smsLimiter.mu.Unlock()
+
+	ts := time.Now()
+	year := ts.Year()
+	day := int32(year)*10000 + int32(ts.YearDay())
+
+	remaining := func(limit, rangeValue int32) int32 {
+		if limit <= 0 {
+			return -1
+		}
+		if count := smsLimiter.countByRange(day, rangeValue); count < limit {
+			return limit - count
+		}
+		return 0
+	}
+	return remaining(smsLimiter.dayLimit, 1), remaining(smsLimiter.weekLimit, 7), remaining(smsLimiter.monthLimit, 30)
+}
+
 func (smsLimiter *SmsLimiter) Add(count int) {
 	smsLimiter.mu.Lock()
 	defer smsLimiter.mu.Unlock()
@@ -118,7 +139,7 @@ func NewSMSLimiter(filename string, dayLimit, weekLimit, monthLimit int32) (*Sms
 	} else {
 		err = json.Unmarshal(bs, &limiter.data)
 		if err != nil {
-			log.Println("载入 sms limiter 失败", err)
+			defaultLogger().Warn("载入 sms limiter 失败", "file", filename, "error", err)
 		} else if len(limiter.data) > 365 {
 			limiter.data = limiter.data[:365]
 		}
@@ -5,6 +5,6 @@ import (
 )
 
 func init() {
-	data := "PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00\x00\x00bootstrap.css/*!\x0d\n * Bootstrap v2.0.3\x0d\n *\x0d\n * Copyright 2012 Twitter, Inc\x0d\n * Licensed under the Apache License v2.0\x0d\n * http://www.apache.org/licenses/LICENSE-2.0\x0d\n *\x0d\n * Designed and built with all the love in the world @twitter by @mdo and @fat.\x0d\n */\x0d\narticle,\x0d\naside,\x0d\ndetails,\x0d\nfigcaption,\x0d\nfigure,\x0d\nfooter,\x0d\nheader,\x0d\nhgroup,\x0d\nnav,\x0d\nsection {\x0d\n  display: block;\x0d\n}\x0d\naudio,\x0d\ncanvas,\x0d\nvideo {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  *zoom: 1;\x0d\n}\x0d\naudio:not([controls]) {\x0d\n  display: none;\x0d\n}\x0d\nhtml {\x0d\n  font-size: 100%;\x0d\n  -webkit-text-size-adjust: 100%;\x0d\n  -ms-text-size-adjust: 100%;\x0d\n}\x0d\na:focus {\x0d\n  outline: thin dotted #333;\x0d\n  outline: 5px auto -webkit-focus-ring-color;\x0d\n  outline-offset: -2px;\x0d\n}\x0d\na:hover,\x0d\na:active {\x0d\n  outline: 0;\x0d\n}\x0d\nsub,\x0d\nsup {\x0d\n  position: relative;\x0d\n  font-size: 75%;\x0d\n  line-height: 0;\x0d\n  vertical-align: baseline;\x0d\n}\x0d\nsup {\x0d\n  top: -0.5em;\x0d\n}\x0d\nsub {\x0d\n  bottom: -0.25em;\x0d\n}\x0d\nimg {\x0d\n  max-width: 100%;\x0d\n  vertical-align: middle;\x0d\n  border: 0;\x0d\n  -ms-interpolation-mode: bicubic;\x0d\n}\x0d\nbutton,\x0d\ninput,\x0d\nselect,\x0d\ntextarea {\x0d\n  margin: 0;\x0d\n  font-size: 100%;\x0d\n  vertical-align: middle;\x0d\n}\x0d\nbutton,\x0d\ninput {\x0d\n  *overflow: visible;\x0d\n  line-height: normal;\x0d\n}\x0d\nbutton::-moz-focus-inner,\x0d\ninput::-moz-focus-inner {\x0d\n  padding: 0;\x0d\n  border: 0;\x0d\n}\x0d\nbutton,\x0d\ninput[type=\"button\"],\x0d\ninput[type=\"reset\"],\x0d\ninput[type=\"submit\"] {\x0d\n  cursor: pointer;\x0d\n  -webkit-appearance: button;\x0d\n}\x0d\ninput[type=\"search\"] {\x0d\n  -webkit-box-sizing: content-box;\x0d\n  -moz-box-sizing: content-box;\x0d\n  box-sizing: content-box;\x0d\n  -webkit-appearance: textfield;\x0d\n}\x0d\ninput[type=\"search\"]::-webkit-search-decoration,\x0d\ninput[type=\"search\"]::-webkit-search-cancel-button {\x0d\n  -webkit-appearance: none;\x0d\n}\x0d\ntextarea {\x0d\n  overflow: auto;\x0d\n  vertical-align: top;\x0d\n}\x0d\n.clearfix {\x0d\n  *zoom: 1;\x0d\n}\x0d\n.clearfix:before,\x0d\n.clearfix:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.clearfix:after {\x0d\n  clear: both;\x0d\n}\x0d\n.hide-text {\x0d\n  font: 0/0 a;\x0d\n  color: transparent;\x0d\n  text-shadow: none;\x0d\n  background-color: transparent;\x0d\n  border: 0;\x0d\n}\x0d\n.input-block-level {\x0d\n  display: block;\x0d\n  width: 100%;\x0d\n  min-height: 28px;\x0d\n  -webkit-box-sizing: border-box;\x0d\n  -moz-box-sizing: border-box;\x0d\n  -ms-box-sizing: border-box;\x0d\n  box-sizing: border-box;\x0d\n}\x0d\nbody {\x0d\n  margin: 0;\x0d\n  font-family: \"Helvetica Neue\", Helvetica, Arial, sans-serif;\x0d\n  font-size: 13px;\x0d\n  line-height: 18px;\x0d\n  color: #333333;\x0d\n  background-color: #ffffff;\x0d\n}\x0d\na {\x0d\n  color: #4183c4;\x0d\n  text-decoration: none;\x0d\n}\x0d\na:hover {\x0d\n  color: #4183c4;\x0d\n  text-decoration: underline;\x0d\n}\x0d\n.row {\x0d\n  margin-left: -20px;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.row:before,\x0d\n.row:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.row:after {\x0d\n  clear: both;\x0d\n}\x0d\n[class*=\"span\"] {\x0d\n  float: left;\x0d\n  margin-left: 20px;\x0d\n}\x0d\n.container,\x0d\n.navbar-fixed-top .container,\x0d\n.navbar-fixed-bottom .container {\x0d\n  width: 940px;\x0d\n}\x0d\n.span12 {\x0d\n  width: 940px;\x0d\n}\x0d\n.span11 {\x0d\n  width: 860px;\x0d\n}\x0d\n.span10 {\x0d\n  width: 780px;\x0d\n}\x0d\n.span9 {\x0d\n  width: 700px;\x0d\n}\x0d\n.span8 {\x0d\n  width: 620px;\x0d\n}\x0d\n.span7 {\x0d\n  width: 540px;\x0d\n}\x0d\n.span6 {\x0d\n  width: 460px;\x0d\n}\x0d\n.span5 {\x0d\n  width: 380px;\x0d\n}\x0d\n.span4 {\x0d\n  width: 300px;\x0d\n}\x0d\n.span3 {\x0d\n  width: 220px;\x0d\n}\x0d\n.span2 {\x0d\n  width: 140px;\x0d\n}\x0d\n.span1 {\x0d\n  width: 60px;\x0d\n}\x0d\n.offset12 {\x0d\n  margin-left: 980px;\x0d\n}\x0d\n.offset11 {\x0d\n  margin-left: 900px;\x0d\n}\x0d\n.offset10 {\x0d\n  margin-left: 820px;\x0d\n}\x0d\n.offset9 {\x0d\n  margin-left: 740px;\x0d\n}\x0d\n.offset8 {\x0d\n  margin-left: 660px;\x0d\n}\x0d\n.offset7 {\x0d\n  margin-left: 580px;\x0d\n}\x0d\n.offset6 {\x0d\n  margin-left: 500px;\x0d\n}\x0d\n.offset5 {\x0d\n  margin-left: 420px;\x0d\n}\x0d\n.offset4 {\x0d\n  margin-left: 340px;\x0d\n}\x0d\n.offset3 {\x0d\n  margin-left: 260px;\x0d\n}\x0d\n.offset2 {\x0d\n  margin-left: 180px;\x0d\n}\x0d\n.offset1 {\x0d\n  margin-left: 100px;\x0d\n}\x0d\n.row-fluid {\x0d\n  width: 100%;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.row-fluid:before,\x0d\n.row-fluid:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.row-fluid:after {\x0d\n  clear: both;\x0d\n}\x0d\n.row-fluid [class*=\"span\"] {\x0d\n  display: block;\x0d\n  width: 100%;\x0d\n  min-height: 28px;\x0d\n  -webkit-box-sizing: border-box;\x0d\n  -moz-box-sizing: border-box;\x0d\n  -ms-box-sizing: border-box;\x0d\n  box-sizing: border-box;\x0d\n  float: left;\x0d\n  margin-left: 2.127659574%;\x0d\n  *margin-left: 2.0744680846382977%;\x0d\n}\x0d\n.row-fluid [class*=\"span\"]:first-child {\x0d\n  margin-left: 0;\x0d\n}\x0d\n.row-fluid .span12 {\x0d\n  width: 99.99999998999999%;\x0d\n  *width: 99.94680850063828%;\x0d\n}\x0d\n.row-fluid .span11 {\x0d\n  width: 91.489361693%;\x0d\n  *width: 91.4361702036383%;\x0d\n}\x0d\n.row-fluid .span10 {\x0d\n  width: 82.97872339599999%;\x0d\n  *width: 82.92553190663828%;\x0d\n}\x0d\n.row-fluid .span9 {\x0d\n  width: 74.468085099%;\x0d\n  *width: 74.4148936096383%;\x0d\n}\x0d\n.row-fluid .span8 {\x0d\n  width: 65.95744680199999%;\x0d\n  *width: 65.90425531263828%;\x0d\n}\x0d\n.row-fluid .span7 {\x0d\n  width: 57.446808505%;\x0d\n  *width: 57.3936170156383%;\x0d\n}\x0d\n.row-fluid .span6 {\x0d\n  width: 48.93617020799999%;\x0d\n  *width: 48.88297871863829%;\x0d\n}\x0d\n.row-fluid .span5 {\x0d\n  width: 40.425531911%;\x0d\n  *width: 40.3723404216383%;\x0d\n}\x0d\n.row-fluid .span4 {\x0d\n  width: 31.914893614%;\x0d\n  *width: 31.8617021246383%;\x0d\n}\x0d\n.row-fluid .span3 {\x0d\n  width: 23.404255317%;\x0d\n  *width: 23.3510638276383%;\x0d\n}\x0d\n.row-fluid .span2 {\x0d\n  width: 14.89361702%;\x0d\n  *width: 14.8404255306383%;\x0d\n}\x0d\n.row-fluid .span1 {\x0d\n  width: 6.382978723%;\x0d\n  *width: 6.329787233638298%;\x0d\n}\x0d\n.container {\x0d\n  margin-right: auto;\x0d\n  margin-left: auto;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.container:before,\x0d\n.container:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.container:after {\x0d\n  clear: both;\x0d\n}\x0d\n.container-fluid {\x0d\n  padding-right: 20px;\x0d\n  padding-left: 20px;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.container-fluid:before,\x0d\n.container-fluid:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.container-fluid:after {\x0d\n  clear: both;\x0d\n}\x0d\np {\x0d\n  margin: 0 0 9px;\x0d\n  font-family: \"Helvetica Neue\", Helvetica, Arial, sans-serif;\x0d\n  font-size: 13px;\x0d\n  line-height: 18px;\x0d\n}\x0d\np small {\x0d\n  font-size: 11px;\x0d\n  color: #999999;\x0d\n}\x0d\n.lead {\x0d\n  margin-bottom: 18px;\x0d\n  font-size: 20px;\x0d\n  font-weight: 200;\x0d\n  line-height: 27px;\x0d\n}\x0d\nh1,\x0d\nh2,\x0d\nh3,\x0d\nh4,\x0d\nh5,\x0d\nh6 {\x0d\n  margin: 0;\x0d\n  font-family: inherit;\x0d\n  font-weight: bold;\x0d\n  color: inherit;\x0d\n  text-rendering: optimizelegibility;\x0d\n}\x0d\nh1 small,\x0d\nh2 small,\x0d\nh3 small,\x0d\nh4 small,\x0d\nh5 small,\x0d\nh6 small {\x0d\n  font-weight: normal;\x0d\n  color: #999999;\x0d\n}\x0d\nh1 {\x0d\n  font-size: 30px;\x0d\n  line-height: 36px;\x0d\n}\x0d\nh1 small {\x0d\n  font-size: 18px;\x0d\n}\x0d\nh2 {\x0d\n  font-size: 24px;\x0d\n  line-height: 36px;\x0d\n}\x0d\nh2 small {\x0d\n  font-size: 18px;\x0d\n}\x0d\nh3 {\x0d\n  font-size: 18px;\x0d\n  line-height: 27px;\x0d\n}\x0d\nh3 small {\x0d\n  font-size: 14px;\x0d\n}\x0d\nh4,\x0d\nh5,\x0d\nh6 {\x0d\n  line-height: 18px;\x0d\n}\x0d\nh4 {\x0d\n  font-size: 14px;\x0d\n}\x0d\nh4 small {\x0d\n  font-size: 12px;\x0d\n}\x0d\nh5 {\x0d\n  font-size: 12px;\x0d\n}\x0d\nh6 {\x0d\n  font-size: 11px;\x0d\n  color: #999999;\x0d\n  text-transform: uppercase;\x0d\n}\x0d\n.page-header {\x0d\n  padding-bottom: 17px;\x0d\n  margin: 18px 0;\x0d\n  border-bottom: 1px solid #f5f5f5;\x0d\n}\x0d\n.page-header h1 {\x0d\n  line-height: 1;\x0d\n}\x0d\nul,\x0d\nol {\x0d\n  padding: 0;\x0d\n  margin: 0 0 9px 25px;\x0d\n}\x0d\nul ul,\x0d\nul ol,\x0d\nol ol,\x0d\nol ul {\x0d\n  margin-bottom: 0;\x0d\n}\x0d\nul {\x0d\n  list-style: disc;\x0d\n}\x0d\nol {\x0d\n  list-style: decimal;\x0d\n}\x0d\nli {\x0d\n  line-height: 18px;\x0d\n}\x0d\nul.unstyled,\x0d\nol.unstyled {\x0d\n  margin-left: 0;\x0d\n  list-style: none;\x0d\n}\x0d\ndl {\x0d\n  margin-bottom: 18px;\x0d\n}\x0d\ndt,\x0d\ndd {\x0d\n  line-height: 18px;\x0d\n}\x0d\ndt {\x0d\n  font-weight: bold;\x0d\n  line-height: 17px;\x0d\n}\x0d\ndd {\x0d\n  margin-left: 9px;\x0d\n}\x0d\n.dl-horizontal dt {\x0d\n  float: left;\x0d\n  width: 120px;\x0d\n  clear: left;\x0d\n  text-align: right;\x0d\n  overflow: hidden;\x0d\n  text-overflow: ellipsis;\x0d\n  white-space: nowrap;\x0d\n}\x0d\n.dl-horizontal dd {\x0d\n  margin-left: 130px;\x0d\n}\x0d\nhr {\x0d\n  margin: 18px 0;\x0d\n  border: 0;\x0d\n  border-top: 1px solid #f5f5f5;\x0d\n  border-bottom: 1px solid #ffffff;\x0d\n}\x0d\nstrong {\x0d\n  font-weight: bold;\x0d\n}\x0d\nem {\x0d\n  font-style: italic;\x0d\n}\x0d\n.muted {\x0d\n  color: #999999;\x0d\n}\x0d\nabbr[title] {\x0d\n  cursor: help;\x0d\n  border-bottom: 1px dotted #ddd;\x0d\n}\x0d\nabbr.initialism {\x0d\n  font-size: 90%;\x0d\n  text-transform: uppercase;\x0d\n}\x0d\nblockquote {\x0d\n  padding: 0 0 0 15px;\x0d\n  margin: 0 0 18px;\x0d\n  border-left: 5px solid #f5f5f5;\x0d\n}\x0d\nblockquote p {\x0d\n  margin-bottom: 0;\x0d\n  font-size: 16px;\x0d\n  font-weight: 300;\x0d\n  line-height: 22.5px;\x0d\n}\x0d\nblockquote small {\x0d\n  display: block;\x0d\n  line-height: 18px;\x0d\n  color: #999999;\x0d\n}\x0d\nblockquote small:before {\x0d\n  content: '\\2014 \\00A0';\x0d\n}\x0d\nblockquote.pull-right {\x0d\n  float: right;\x0d\n  padding-right: 15px;\x0d\n  padding-left: 0;\x0d\n  border-right: 5px solid #f5f5f5;\x0d\n  border-left: 0;\x0d\n}\x0d\nblockquote.pull-right p,\x0d\nblockquote.pull-right small {\x0d\n  text-align: right;\x0d\n}\x0d\nq:before,\x0d\nq:after,\x0d\nblockquote:before,\x0d\nblockquote:after {\x0d\n  content: \"\";\x0d\n}\x0d\naddress {\x0d\n  display: block;\x0d\n  margin-bottom: 18px;\x0d\n  font-style: normal;\x0d\n  line-height: 18px;\x0d\n}\x0d\nsmall {\x0d\n  font-size: 100%;\x0d\n}\x0d\ncite {\x0d\n  font-style: normal;\x0d\n}\x0d\ncode,\x0d\npre {\x0d\n  padding: 0 3px 2px;\x0d\n  font-family: Menlo, Monaco, Consolas, \"Courier New\", monospace;\x0d\n  font-size: 12px;\x0d\n  color: #333333;\x0d\n  -webkit-border-radius: 3px;\x0d\n  -moz-border-radius: 3px;\x0d\n  border-radius: 3px;\x0d\n}\x0d\ncode {\x0d\n  padding: 2px 4px;\x0d\n  color: #d14;\x0d\n  background-color: #f7f7f9;\x0d\n  border: 1px solid #e1e1e8;\x0d\n}\x0d\npre {\x0d\n  display: block;\x0d\n  padding: 8.5px;\x0d\n  margin: 0 0 9px;\x0d\n  font-size: 12.025px;\x0d\n  line-height: 18px;\x0d\n  word-break: break-all;\x0d\n  word-wrap: break-word;\x0d\n  white-space: pre;\x0d\n  white-space: pre-wrap;\x0d\n  background-color: #f5f5f5;\x0d\n  border: 1px solid #ccc;\x0d\n  border: 1px solid rgba(0, 0, 0, 0.15);\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\npre.prettyprint {\x0d\n  margin-bottom: 18px;\x0d\n}\x0d\npre code {\x0d\n  padding: 0;\x0d\n  color: inherit;\x0d\n  background-color: transparent;\x0d\n  border: 0;\x0d\n}\x0d\n.pre-scrollable {\x0d\n  max-height: 340px;\x0d\n  overflow-y: scroll;\x0d\n}\x0d\nform {\x0d\n  margin: 0 0 18px;\x0d\n}\x0d\nfieldset {\x0d\n  padding: 0;\x0d\n  margin: 0;\x0d\n  border: 0;\x0d\n}\x0d\nlegend {\x0d\n  display: block;\x0d\n  width: 100%;\x0d\n  padding: 0;\x0d\n  margin-bottom: 27px;\x0d\n  font-size: 19.5px;\x0d\n  line-height: 36px;\x0d\n  color: #333333;\x0d\n  border: 0;\x0d\n  border-bottom: 1px solid #eee;\x0d\n}\x0d\nlegend small {\x0d\n  font-size: 13.5px;\x0d\n  color: #999999;\x0d\n}\x0d\nlabel,\x0d\ninput,\x0d\nbutton,\x0d\nselect,\x0d\ntextarea {\x0d\n  font-size: 13px;\x0d\n  font-weight: normal;\x0d\n  line-height: 18px;\x0d\n}\x0d\ninput,\x0d\nbutton,\x0d\nselect,\x0d\ntextarea {\x0d\n  font-family: \"Helvetica Neue\", Helvetica, Arial, sans-serif;\x0d\n}\x0d\nlabel {\x0d\n  display: block;\x0d\n  margin-bottom: 5px;\x0d\n  color: #333333;\x0d\n}\x0d\ninput,\x0d\ntextarea,\x0d\nselect,\x0d\n.uneditable-input {\x0d\n  display: inline-block;\x0d\n  width: 210px;\x0d\n  height: 18px;\x0d\n  padding: 4px;\x0d\n  margin-bottom: 9px;\x0d\n  font-size: 13px;\x0d\n  line-height: 18px;\x0d\n  color: #555555;\x0d\n  background-color: #ffffff;\x0d\n  border: 1px solid #cccccc;\x0d\n  -webkit-border-radius: 3px;\x0d\n  -moz-border-radius: 3px;\x0d\n  border-radius: 3px;\x0d\n}\x0d\n.uneditable-textarea {\x0d\n  width: auto;\x0d\n  height: auto;\x0d\n}\x0d\nlabel input,\x0d\nlabel textarea,\x0d\nlabel select {\x0d\n  display: block;\x0d\n}\x0d\ninput[type=\"image\"],\x0d\ninput[type=\"checkbox\"],\x0d\ninput[type=\"radio\"] {\x0d\n  width: auto;\x0d\n  height: auto;\x0d\n  padding: 0;\x0d\n  margin: 3px 0;\x0d\n  *margin-top: 0;\x0d\n  /* IE7 */\x0d\n\x0d\n  line-height: normal;\x0d\n  cursor: pointer;\x0d\n  background-color: transparent;\x0d\n  border: 0 \\9;\x0d\n  /* IE9 and down */\x0d\n\x0d\n  -webkit-border-radius: 0;\x0d\n  -moz-border-radius: 0;\x0d\n  border-radius: 0;\x0d\n}\x0d\ninput[type=\"image\"] {\x0d\n  border: 0;\x0d\n}\x0d\ninput[type=\"file\"] {\x0d\n  width: auto;\x0d\n  padding: initial;\x0d\n  line-height: initial;\x0d\n  background-color: #ffffff;\x0d\n  background-color: initial;\x0d\n  border: initial;\x0d\n  -webkit-box-shadow: none;\x0d\n  -moz-box-shadow: none;\x0d\n  box-shadow: none;\x0d\n}\x0d\ninput[type=\"button\"],\x0d\ninput[type=\"reset\"],\x0d\ninput[type=\"submit\"] {\x0d\n  width: auto;\x0d\n  height: auto;\x0d\n}\x0d\nselect,\x0d\ninput[type=\"file\"] {\x0d\n  height: 28px;\x0d\n  /* In IE7, the height of the select element cannot be changed by height, only font-size */\x0d\n\x0d\n  *margin-top: 4px;\x0d\n  /* For IE7, add top margin to align select with labels */\x0d\n\x0d\n  line-height: 28px;\x0d\n}\x0d\ninput[type=\"file\"] {\x0d\n  line-height: 18px \\9;\x0d\n}\x0d\nselect {\x0d\n  width: 220px;\x0d\n  background-color: #ffffff;\x0d\n}\x0d\nselect[multiple],\x0d\nselect[size] {\x0d\n  height: auto;\x0d\n}\x0d\ninput[type=\"image\"] {\x0d\n  -webkit-box-shadow: none;\x0d\n  -moz-box-shadow: none;\x0d\n  box-shadow: none;\x0d\n}\x0d\ntextarea {\x0d\n  height: auto;\x0d\n}\x0d\ninput[type=\"hidden\"] {\x0d\n  display: none;\x0d\n}\x0d\n.radio,\x0d\n.checkbox {\x0d\n  min-height: 18px;\x0d\n  padding-left: 18px;\x0d\n}\x0d\n.radio input[type=\"radio\"],\x0d\n.checkbox input[type=\"checkbox\"] {\x0d\n  float: left;\x0d\n  margin-left: -18px;\x0d\n}\x0d\n.controls > .radio:first-child,\x0d\n.controls > .checkbox:first-child {\x0d\n  padding-top: 5px;\x0d\n}\x0d\n.radio.inline,\x0d\n.checkbox.inline {\x0d\n  display: inline-block;\x0d\n  padding-top: 5px;\x0d\n  margin-bottom: 0;\x0d\n  vertical-align: middle;\x0d\n}\x0d\n.radio.inline + .radio.inline,\x0d\n.checkbox.inline + .checkbox.inline {\x0d\n  margin-left: 10px;\x0d\n}\x0d\ninput,\x0d\ntextarea {\x0d\n  -webkit-box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.075);\x0d\n  -moz-box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.075);\x0d\n  box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.075);\x0d\n  -webkit-transition: border linear 0.2s, box-shadow linear 0.2s;\x0d\n  -moz-transition: border linear 0.2s, box-shadow linear 0.2s;\x0d\n  -ms-transition: border linear 0.2s, box-shadow linear 0.2s;\x0d\n  -o-transition: border linear 0.2s, box-shadow linear 0.2s;\x0d\n  transition: border linear 0.2s, box-shadow linear 0.2s;\x0d\n}\x0d\ninput:focus,\x0d\ntextarea:focus {\x0d\n  border-color: rgba(82, 168, 236, 0.8);\x0d\n  outline: 0;\x0d\n  outline: thin dotted \\9;\x0d\n  /* IE6-9 */\x0d\n\x0d\n  -webkit-box-shadow: inset 0 1px 1px rgba(0,0,0,.075), 0 0 8px rgba(82,168,236,.6);\x0d\n  -moz-box-shadow: inset 0 1px 1px rgba(0,0,0,.075), 0 0 8px rgba(82,168,236,.6);\x0d\n  box-shadow: inset 0 1px 1px rgba(0,0,0,.075), 0 0 8px rgba(82,168,236,.6);\x0d\n}\x0d\ninput[type=\"file\"]:focus,\x0d\ninput[type=\"radio\"]:focus,\x0d\ninput[type=\"checkbox\"]:focus,\x0d\nselect:focus {\x0d\n  outline: thin dotted #333;\x0d\n  outline: 5px auto -webkit-focus-ring-color;\x0d\n  outline-offset: -2px;\x0d\n  -webkit-box-shadow: none;\x0d\n  -moz-box-shadow: none;\x0d\n  box-shadow: none;\x0d\n}\x0d\n.input-mini {\x0d\n  width: 60px;\x0d\n}\x0d\n.input-small {\x0d\n  width: 90px;\x0d\n}\x0d\n.input-medium {\x0d\n  width: 150px;\x0d\n}\x0d\n.input-large {\x0d\n  width: 210px;\x0d\n}\x0d\n.input-xlarge {\x0d\n  width: 270px;\x0d\n}\x0d\n.input-xxlarge {\x0d\n  width: 530px;\x0d\n}\x0d\ninput[class*=\"span\"],\x0d\nselect[class*=\"span\"],\x0d\ntextarea[class*=\"span\"],\x0d\n.uneditable-input[class*=\"span\"],\x0d\n.row-fluid input[class*=\"span\"],\x0d\n.row-fluid select[class*=\"span\"],\x0d\n.row-fluid textarea[class*=\"span\"],\x0d\n.row-fluid .uneditable-input[class*=\"span\"] {\x0d\n  float: none;\x0d\n  margin-left: 0;\x0d\n}\x0d\ninput,\x0d\ntextarea,\x0d\n.uneditable-input {\x0d\n  margin-left: 0;\x0d\n}\x0d\ninput.span12, textarea.span12, .uneditable-input.span12 {\x0d\n  width: 930px;\x0d\n}\x0d\ninput.span11, textarea.span11, .uneditable-input.span11 {\x0d\n  width: 850px;\x0d\n}\x0d\ninput.span10, textarea.span10, .uneditable-input.span10 {\x0d\n  width: 770px;\x0d\n}\x0d\ninput.span9, textarea.span9, .uneditable-input.span9 {\x0d\n  width: 690px;\x0d\n}\x0d\ninput.span8, textarea.span8, .uneditable-input.span8 {\x0d\n  width: 610px;\x0d\n}\x0d\ninput.span7, textarea.span7, .uneditable-input.span7 {\x0d\n  width: 530px;\x0d\n}\x0d\ninput.span6, textarea.span6, .uneditable-input.span6 {\x0d\n  width: 450px;\x0d\n}\x0d\ninput.span5, textarea.span5, .uneditable-input.span5 {\x0d\n  width: 370px;\x0d\n}\x0d\ninput.span4, textarea.span4, .uneditable-input.span4 {\x0d\n  width: 290px;\x0d\n}\x0d\ninput.span3, textarea.span3, .uneditable-input.span3 {\x0d\n  width: 210px;\x0d\n}\x0d\ninput.span2, textarea.span2, .uneditable-input.span2 {\x0d\n  width: 130px;\x0d\n}\x0d\ninput.span1, textarea.span1, .uneditable-input.span1 {\x0d\n  width: 50px;\x0d\n}\x0d\ninput[disabled],\x0d\nselect[disabled],\x0d\ntextarea[disabled],\x0d\ninput[readonly],\x0d\nselect[readonly],\x0d\ntextarea[readonly] {\x0d\n  cursor: not-allowed;\x0d\n  background-color: #f5f5f5;\x0d\n  border-color: #ddd;\x0d\n}\x0d\ninput[type=\"radio\"][disabled],\x0d\ninput[type=\"checkbox\"][disabled],\x0d\ninput[type=\"radio\"][readonly],\x0d\ninput[type=\"checkbox\"][readonly] {\x0d\n  background-color: transparent;\x0d\n}\x0d\n.control-group.warning > label,\x0d\n.control-group.warning .help-block,\x0d\n.control-group.warning .help-inline {\x0d\n  color: #393939;\x0d\n}\x0d\n.control-group.warning input,\x0d\n.control-group.warning select,\x0d\n.control-group.warning textarea {\x0d\n  color: #393939;\x0d\n  border-color: #393939;\x0d\n}\x0d\n.control-group.warning input:focus,\x0d\n.control-group.warning select:focus,\x0d\n.control-group.warning textarea:focus {\x0d\n  border-color: #202020;\x0d\n  -webkit-box-shadow: 0 0 6px #6c6c6c;\x0d\n  -moz-box-shadow: 0 0 6px #6c6c6c;\x0d\n  box-shadow: 0 0 6px #6c6c6c;\x0d\n}\x0d\n.control-group.warning .input-prepend .add-on,\x0d\n.control-group.warning .input-append .add-on {\x0d\n  color: #393939;\x0d\n  background-color: #f5f3b4;\x0d\n  border-color: #393939;\x0d\n}\x0d\n.control-group.error > label,\x0d\n.control-group.error .help-block,\x0d\n.control-group.error .help-inline {\x0d\n  color: #393939;\x0d\n}\x0d\n.control-group.error input,\x0d\n.control-group.error select,\x0d\n.control-group.error textarea {\x0d\n  color: #393939;\x0d\n  border-color: #393939;\x0d\n}\x0d\n.control-group.error input:focus,\x0d\n.control-group.error select:focus,\x0d\n.control-group.error textarea:focus {\x0d\n  border-color: #202020;\x0d\n  -webkit-box-shadow: 0 0 6px #6c6c6c;\x0d\n  -moz-box-shadow: 0 0 6px #6c6c6c;\x0d\n  box-shadow: 0 0 6px #6c6c6c;\x0d\n}\x0d\n.control-group.error .input-prepend .add-on,\x0d\n.control-group.error .input-append .add-on {\x0d\n  color: #393939;\x0d\n  background-color: #ffe9e9;\x0d\n  border-color: #393939;\x0d\n}\x0d\n.control-group.success > label,\x0d\n.control-group.success .help-block,\x0d\n.control-group.success .help-inline {\x0d\n  color: #333333;\x0d\n}\x0d\n.control-group.success input,\x0d\n.control-group.success select,\x0d\n.control-group.success textarea {\x0d\n  color: #333333;\x0d\n  border-color: #333333;\x0d\n}\x0d\n.control-group.success input:focus,\x0d\n.control-group.success select:focus,\x0d\n.control-group.success textarea:focus {\x0d\n  border-color: #1a1a1a;\x0d\n  -webkit-box-shadow: 0 0 6px #666666;\x0d\n  -moz-box-shadow: 0 0 6px #666666;\x0d\n  box-shadow: 0 0 6px #666666;\x0d\n}\x0d\n.control-group.success .input-prepend .add-on,\x0d\n.control-group.success .input-append .add-on {\x0d\n  color: #333333;\x0d\n  background-color: #bedebe;\x0d\n  border-color: #333333;\x0d\n}\x0d\ninput:focus:required:invalid,\x0d\ntextarea:focus:required:invalid,\x0d\nselect:focus:required:invalid {\x0d\n  color: #b94a48;\x0d\n  border-color: #ee5f5b;\x0d\n}\x0d\ninput:focus:required:invalid:focus,\x0d\ntextarea:focus:required:invalid:focus,\x0d\nselect:focus:required:invalid:focus {\x0d\n  border-color: #e9322d;\x0d\n  -webkit-box-shadow: 0 0 6px #f8b9b7;\x0d\n  -moz-box-shadow: 0 0 6px #f8b9b7;\x0d\n  box-shadow: 0 0 6px #f8b9b7;\x0d\n}\x0d\n.form-actions {\x0d\n  padding: 17px 20px 18px;\x0d\n  margin-top: 18px;\x0d\n  margin-bottom: 18px;\x0d\n  background-color: #f5f5f5;\x0d\n  border-top: 1px solid #ddd;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.form-actions:before,\x0d\n.form-actions:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.form-actions:after {\x0d\n  clear: both;\x0d\n}\x0d\n.uneditable-input {\x0d\n  overflow: hidden;\x0d\n  white-space: nowrap;\x0d\n  cursor: not-allowed;\x0d\n  background-color: #ffffff;\x0d\n  border-color: #eee;\x0d\n  -webkit-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.025);\x0d\n  -moz-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.025);\x0d\n  box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.025);\x0d\n}\x0d\n:-moz-placeholder {\x0d\n  color: #999999;\x0d\n}\x0d\n::-webkit-input-placeholder {\x0d\n  color: #999999;\x0d\n}\x0d\n.help-block,\x0d\n.help-inline {\x0d\n  color: #555555;\x0d\n}\x0d\n.help-block {\x0d\n  display: block;\x0d\n  margin-bottom: 9px;\x0d\n}\x0d\n.help-inline {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  /* IE7 inline-block hack */\x0d\n\x0d\n  *zoom: 1;\x0d\n  vertical-align: middle;\x0d\n  padding-left: 5px;\x0d\n}\x0d\n.input-prepend,\x0d\n.input-append {\x0d\n  margin-bottom: 5px;\x0d\n}\x0d\n.input-prepend input,\x0d\n.input-append input,\x0d\n.input-prepend select,\x0d\n.input-append select,\x0d\n.input-prepend .uneditable-input,\x0d\n.input-append .uneditable-input {\x0d\n  position: relative;\x0d\n  margin-bottom: 0;\x0d\n  *margin-left: 0;\x0d\n  vertical-align: middle;\x0d\n  -webkit-border-radius: 0 3px 3px 0;\x0d\n  -moz-border-radius: 0 3px 3px 0;\x0d\n  border-radius: 0 3px 3px 0;\x0d\n}\x0d\n.input-prepend input:focus,\x0d\n.input-append input:focus,\x0d\n.input-prepend select:focus,\x0d\n.input-append select:focus,\x0d\n.input-prepend .uneditable-input:focus,\x0d\n.input-append .uneditable-input:focus {\x0d\n  z-index: 2;\x0d\n}\x0d\n.input-prepend .uneditable-input,\x0d\n.input-append .uneditable-input {\x0d\n  border-left-color: #ccc;\x0d\n}\x0d\n.input-prepend .add-on,\x0d\n.input-append .add-on {\x0d\n  display: inline-block;\x0d\n  width: auto;\x0d\n  height: 18px;\x0d\n  min-width: 16px;\x0d\n  padding: 4px 5px;\x0d\n  font-weight: normal;\x0d\n  line-height: 18px;\x0d\n  text-align: center;\x0d\n  text-shadow: 0 1px 0 #ffffff;\x0d\n  vertical-align: middle;\x0d\n  background-color: #f5f5f5;\x0d\n  border: 1px solid #ccc;\x0d\n}\x0d\n.input-prepend .add-on,\x0d\n.input-append .add-on,\x0d\n.input-prepend .btn,\x0d\n.input-append .btn {\x0d\n  margin-left: -1px;\x0d\n  -webkit-border-radius: 0;\x0d\n  -moz-border-radius: 0;\x0d\n  border-radius: 0;\x0d\n}\x0d\n.input-prepend .active,\x0d\n.input-append .active {\x0d\n  background-color: #fafefa;\x0d\n  border-color: #84de81;\x0d\n}\x0d\n.input-prepend .add-on,\x0d\n.input-prepend .btn {\x0d\n  margin-right: -1px;\x0d\n}\x0d\n.input-prepend .add-on:first-child,\x0d\n.input-prepend .btn:first-child {\x0d\n  -webkit-border-radius: 3px 0 0 3px;\x0d\n  -moz-border-radius: 3px 0 0 3px;\x0d\n  border-radius: 3px 0 0 3px;\x0d\n}\x0d\n.input-append input,\x0d\n.input-append select,\x0d\n.input-append .uneditable-input {\x0d\n  -webkit-border-radius: 3px 0 0 3px;\x0d\n  -moz-border-radius: 3px 0 0 3px;\x0d\n  border-radius: 3px 0 0 3px;\x0d\n}\x0d\n.input-append .uneditable-input {\x0d\n  border-right-color: #ccc;\x0d\n  border-left-color: #eee;\x0d\n}\x0d\n.input-append .add-on:last-child,\x0d\n.input-append .btn:last-child {\x0d\n  -webkit-border-radius: 0 3px 3px 0;\x0d\n  -moz-border-radius: 0 3px 3px 0;\x0d\n  border-radius: 0 3px 3px 0;\x0d\n}\x0d\n.input-prepend.input-append input,\x0d\n.input-prepend.input-append select,\x0d\n.input-prepend.input-append .uneditable-input {\x0d\n  -webkit-border-radius: 0;\x0d\n  -moz-border-radius: 0;\x0d\n  border-radius: 0;\x0d\n}\x0d\n.input-prepend.input-append .add-on:first-child,\x0d\n.input-prepend.input-append .btn:first-child {\x0d\n  margin-right: -1px;\x0d\n  -webkit-border-radius: 3px 0 0 3px;\x0d\n  -moz-border-radius: 3px 0 0 3px;\x0d\n  border-radius: 3px 0 0 3px;\x0d\n}\x0d\n.input-prepend.input-append .add-on:last-child,\x0d\n.input-prepend.input-append .btn:last-child {\x0d\n  margin-left: -1px;\x0d\n  -webkit-border-radius: 0 3px 3px 0;\x0d\n  -moz-border-radius: 0 3px 3px 0;\x0d\n  border-radius: 0 3px 3px 0;\x0d\n}\x0d\n.search-query {\x0d\n  padding-right: 14px;\x0d\n  padding-right: 4px \\9;\x0d\n  padding-left: 14px;\x0d\n  padding-left: 4px \\9;\x0d\n  /* IE7-8 doesn't have border-radius, so don't indent the padding */\x0d\n\x0d\n  margin-bottom: 0;\x0d\n  -webkit-border-radius: 14px;\x0d\n  -moz-border-radius: 14px;\x0d\n  border-radius: 14px;\x0d\n}\x0d\n.form-search input,\x0d\n.form-inline input,\x0d\n.form-horizontal input,\x0d\n.form-search textarea,\x0d\n.form-inline textarea,\x0d\n.form-horizontal textarea,\x0d\n.form-search select,\x0d\n.form-inline select,\x0d\n.form-horizontal select,\x0d\n.form-search .help-inline,\x0d\n.form-inline .help-inline,\x0d\n.form-horizontal .help-inline,\x0d\n.form-search .uneditable-input,\x0d\n.form-inline .uneditable-input,\x0d\n.form-horizontal .uneditable-input,\x0d\n.form-search .input-prepend,\x0d\n.form-inline .input-prepend,\x0d\n.form-horizontal .input-prepend,\x0d\n.form-search .input-append,\x0d\n.form-inline .input-append,\x0d\n.form-horizontal .input-append {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  /* IE7 inline-block hack */\x0d\n\x0d\n  *zoom: 1;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.form-search .hide,\x0d\n.form-inline .hide,\x0d\n.form-horizontal .hide {\x0d\n  display: none;\x0d\n}\x0d\n.form-search label,\x0d\n.form-inline label {\x0d\n  display: inline-block;\x0d\n}\x0d\n.form-search .input-append,\x0d\n.form-inline .input-append,\x0d\n.form-search .input-prepend,\x0d\n.form-inline .input-prepend {\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.form-search .radio,\x0d\n.form-search .checkbox,\x0d\n.form-inline .radio,\x0d\n.form-inline .checkbox {\x0d\n  padding-left: 0;\x0d\n  margin-bottom: 0;\x0d\n  vertical-align: middle;\x0d\n}\x0d\n.form-search .radio input[type=\"radio\"],\x0d\n.form-search .checkbox input[type=\"checkbox\"],\x0d\n.form-inline .radio input[type=\"radio\"],\x0d\n.form-inline .checkbox input[type=\"checkbox\"] {\x0d\n  float: left;\x0d\n  margin-right: 3px;\x0d\n  margin-left: 0;\x0d\n}\x0d\n.control-group {\x0d\n  margin-bottom: 9px;\x0d\n}\x0d\nlegend + .control-group {\x0d\n  margin-top: 18px;\x0d\n  -webkit-margin-top-collapse: separate;\x0d\n}\x0d\n.form-horizontal .control-group {\x0d\n  margin-bottom: 18px;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.form-horizontal .control-group:before,\x0d\n.form-horizontal .control-group:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.form-horizontal .control-group:after {\x0d\n  clear: both;\x0d\n}\x0d\n.form-horizontal .control-label {\x0d\n  float: left;\x0d\n  width: 140px;\x0d\n  padding-top: 5px;\x0d\n  text-align: right;\x0d\n}\x0d\n.form-horizontal .controls {\x0d\n  *display: inline-block;\x0d\n  *padding-left: 20px;\x0d\n  margin-left: 160px;\x0d\n  *margin-left: 0;\x0d\n}\x0d\n.form-horizontal .controls:first-child {\x0d\n  *padding-left: 160px;\x0d\n}\x0d\n.form-horizontal .help-block {\x0d\n  margin-top: 9px;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.form-horizontal .form-actions {\x0d\n  padding-left: 160px;\x0d\n}\x0d\ntable {\x0d\n  max-width: 100%;\x0d\n  background-color: transparent;\x0d\n  border-collapse: collapse;\x0d\n  border-spacing: 0;\x0d\n}\x0d\n.table {\x0d\n  width: 100%;\x0d\n  margin-bottom: 18px;\x0d\n}\x0d\n.table th,\x0d\n.table td {\x0d\n  padding: 8px;\x0d\n  line-height: 18px;\x0d\n  text-align: left;\x0d\n  vertical-align: top;\x0d\n  border-top: 1px solid #dddddd;\x0d\n}\x0d\n.table th {\x0d\n  font-weight: bold;\x0d\n}\x0d\n.table thead th {\x0d\n  vertical-align: bottom;\x0d\n}\x0d\n.table caption + thead tr:first-child th,\x0d\n.table caption + thead tr:first-child td,\x0d\n.table colgroup + thead tr:first-child th,\x0d\n.table colgroup + thead tr:first-child td,\x0d\n.table thead:first-child tr:first-child th,\x0d\n.table thead:first-child tr:first-child td {\x0d\n  border-top: 0;\x0d\n}\x0d\n.table tbody + tbody {\x0d\n  border-top: 2px solid #dddddd;\x0d\n}\x0d\n.table-condensed th,\x0d\n.table-condensed td {\x0d\n  padding: 4px 5px;\x0d\n}\x0d\n.table-bordered {\x0d\n  border: 1px solid #dddddd;\x0d\n  border-collapse: separate;\x0d\n  *border-collapse: collapsed;\x0d\n  border-left: 0;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\n.table-bordered th,\x0d\n.table-bordered td {\x0d\n  border-left: 1px solid #dddddd;\x0d\n}\x0d\n.table-bordered caption + thead tr:first-child th,\x0d\n.table-bordered caption + tbody tr:first-child th,\x0d\n.table-bordered caption + tbody tr:first-child td,\x0d\n.table-bordered colgroup + thead tr:first-child th,\x0d\n.table-bordered colgroup + tbody tr:first-child th,\x0d\n.table-bordered colgroup + tbody tr:first-child td,\x0d\n.table-bordered thead:first-child tr:first-child th,\x0d\n.table-bordered tbody:first-child tr:first-child th,\x0d\n.table-bordered tbody:first-child tr:first-child td {\x0d\n  border-top: 0;\x0d\n}\x0d\n.table-bordered thead:first-child tr:first-child th:first-child,\x0d\n.table-bordered tbody:first-child tr:first-child td:first-child {\x0d\n  -webkit-border-top-left-radius: 4px;\x0d\n  border-top-left-radius: 4px;\x0d\n  -moz-border-radius-topleft: 4px;\x0d\n}\x0d\n.table-bordered thead:first-child tr:first-child th:last-child,\x0d\n.table-bordered tbody:first-child tr:first-child td:last-child {\x0d\n  -webkit-border-top-right-radius: 4px;\x0d\n  border-top-right-radius: 4px;\x0d\n  -moz-border-radius-topright: 4px;\x0d\n}\x0d\n.table-bordered thead:last-child tr:last-child th:first-child,\x0d\n.table-bordered tbody:last-child tr:last-child td:first-child {\x0d\n  -webkit-border-radius: 0 0 0 4px;\x0d\n  -moz-border-radius: 0 0 0 4px;\x0d\n  border-radius: 0 0 0 4px;\x0d\n  -webkit-border-bottom-left-radius: 4px;\x0d\n  border-bottom-left-radius: 4px;\x0d\n  -moz-border-radius-bottomleft: 4px;\x0d\n}\x0d\n.table-bordered thead:last-child tr:last-child th:last-child,\x0d\n.table-bordered tbody:last-child tr:last-child td:last-child {\x0d\n  -webkit-border-bottom-right-radius: 4px;\x0d\n  border-bottom-right-radius: 4px;\x0d\n  -moz-border-radius-bottomright: 4px;\x0d\n}\x0d\n.table-striped tbody tr:nth-child(odd) td,\x0d\n.table-striped tbody tr:nth-child(odd) th {\x0d\n  background-color: #f9f9f9;\x0d\n}\x0d\n.table tbody tr:hover td,\x0d\n.table tbody tr:hover th {\x0d\n  background-color: #f5f5f5;\x0d\n}\x0d\ntable .span1 {\x0d\n  float: none;\x0d\n  width: 44px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span2 {\x0d\n  float: none;\x0d\n  width: 124px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span3 {\x0d\n  float: none;\x0d\n  width: 204px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span4 {\x0d\n  float: none;\x0d\n  width: 284px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span5 {\x0d\n  float: none;\x0d\n  width: 364px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span6 {\x0d\n  float: none;\x0d\n  width: 444px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span7 {\x0d\n  float: none;\x0d\n  width: 524px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span8 {\x0d\n  float: none;\x0d\n  width: 604px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span9 {\x0d\n  float: none;\x0d\n  width: 684px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span10 {\x0d\n  float: none;\x0d\n  width: 764px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span11 {\x0d\n  float: none;\x0d\n  width: 844px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span12 {\x0d\n  float: none;\x0d\n  width: 924px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span13 {\x0d\n  float: none;\x0d\n  width: 1004px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span14 {\x0d\n  float: none;\x0d\n  width: 1084px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span15 {\x0d\n  float: none;\x0d\n  width: 1164px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span16 {\x0d\n  float: none;\x0d\n  width: 1244px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span17 {\x0d\n  float: none;\x0d\n  width: 1324px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span18 {\x0d\n  float: none;\x0d\n  width: 1404px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span19 {\x0d\n  float: none;\x0d\n  width: 1484px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span20 {\x0d\n  float: none;\x0d\n  width: 1564px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span21 {\x0d\n  float: none;\x0d\n  width: 1644px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span22 {\x0d\n  float: none;\x0d\n  width: 1724px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span23 {\x0d\n  float: none;\x0d\n  width: 1804px;\x0d\n  margin-left: 0;\x0d\n}\x0d\ntable .span24 {\x0d\n  float: none;\x0d\n  width: 1884px;\x0d\n  margin-left: 0;\x0d\n}\x0d\n[class^=\"icon-\"],\x0d\n[class*=\" icon-\"] {\x0d\n  display: inline-block;\x0d\n  width: 14px;\x0d\n  height: 14px;\x0d\n  *margin-right: .3em;\x0d\n  line-height: 14px;\x0d\n  vertical-align: text-top;\x0d\n  background-image: url(\"../img/glyphicons-halflings.png\");\x0d\n  background-position: 14px 14px;\x0d\n  background-repeat: no-repeat;\x0d\n}\x0d\n[class^=\"icon-\"]:last-child,\x0d\n[class*=\" icon-\"]:last-child {\x0d\n  *margin-left: 0;\x0d\n}\x0d\n.icon-white {\x0d\n  background-image: url(\"../img/glyphicons-halflings-white.png\");\x0d\n}\x0d\n.icon-glass {\x0d\n  background-position: 0      0;\x0d\n}\x0d\n.icon-music {\x0d\n  background-position: -24px 0;\x0d\n}\x0d\n.icon-search {\x0d\n  background-position: -48px 0;\x0d\n}\x0d\n.icon-envelope {\x0d\n  background-position: -72px 0;\x0d\n}\x0d\n.icon-heart {\x0d\n  background-position: -96px 0;\x0d\n}\x0d\n.icon-star {\x0d\n  background-position: -120px 0;\x0d\n}\x0d\n.icon-star-empty {\x0d\n  background-position: -144px 0;\x0d\n}\x0d\n.icon-user {\x0d\n  background-position: -168px 0;\x0d\n}\x0d\n.icon-film {\x0d\n  background-position: -192px 0;\x0d\n}\x0d\n.icon-th-large {\x0d\n  background-position: -216px 0;\x0d\n}\x0d\n.icon-th {\x0d\n  background-position: -240px 0;\x0d\n}\x0d\n.icon-th-list {\x0d\n  background-position: -264px 0;\x0d\n}\x0d\n.icon-ok {\x0d\n  background-position: -288px 0;\x0d\n}\x0d\n.icon-remove {\x0d\n  background-position: -312px 0;\x0d\n}\x0d\n.icon-zoom-in {\x0d\n  background-position: -336px 0;\x0d\n}\x0d\n.icon-zoom-out {\x0d\n  background-position: -360px 0;\x0d\n}\x0d\n.icon-off {\x0d\n  background-position: -384px 0;\x0d\n}\x0d\n.icon-signal {\x0d\n  background-position: -408px 0;\x0d\n}\x0d\n.icon-cog {\x0d\n  background-position: -432px 0;\x0d\n}\x0d\n.icon-trash {\x0d\n  background-position: -456px 0;\x0d\n}\x0d\n.icon-home {\x0d\n  background-position: 0 -24px;\x0d\n}\x0d\n.icon-file {\x0d\n  background-position: -24px -24px;\x0d\n}\x0d\n.icon-time {\x0d\n  background-position: -48px -24px;\x0d\n}\x0d\n.icon-road {\x0d\n  background-position: -72px -24px;\x0d\n}\x0d\n.icon-download-alt {\x0d\n  background-position: -96px -24px;\x0d\n}\x0d\n.icon-download {\x0d\n  background-position: -120px -24px;\x0d\n}\x0d\n.icon-upload {\x0d\n  background-position: -144px -24px;\x0d\n}\x0d\n.icon-inbox {\x0d\n  background-position: -168px -24px;\x0d\n}\x0d\n.icon-play-circle {\x0d\n  background-position: -192px -24px;\x0d\n}\x0d\n.icon-repeat {\x0d\n  background-position: -216px -24px;\x0d\n}\x0d\n.icon-refresh {\x0d\n  background-position: -240px -24px;\x0d\n}\x0d\n.icon-list-alt {\x0d\n  background-position: -264px -24px;\x0d\n}\x0d\n.icon-lock {\x0d\n  background-position: -287px -24px;\x0d\n}\x0d\n.icon-flag {\x0d\n  background-position: -312px -24px;\x0d\n}\x0d\n.icon-headphones {\x0d\n  background-position: -336px -24px;\x0d\n}\x0d\n.icon-volume-off {\x0d\n  background-position: -360px -24px;\x0d\n}\x0d\n.icon-volume-down {\x0d\n  background-position: -384px -24px;\x0d\n}\x0d\n.icon-volume-up {\x0d\n  background-position: -408px -24px;\x0d\n}\x0d\n.icon-qrcode {\x0d\n  background-position: -432px -24px;\x0d\n}\x0d\n.icon-barcode {\x0d\n  background-position: -456px -24px;\x0d\n}\x0d\n.icon-tag {\x0d\n  background-position: 0 -48px;\x0d\n}\x0d\n.icon-tags {\x0d\n  background-position: -25px -48px;\x0d\n}\x0d\n.icon-book {\x0d\n  background-position: -48px -48px;\x0d\n}\x0d\n.icon-bookmark {\x0d\n  background-position: -72px -48px;\x0d\n}\x0d\n.icon-print {\x0d\n  background-position: -96px -48px;\x0d\n}\x0d\n.icon-camera {\x0d\n  background-position: -120px -48px;\x0d\n}\x0d\n.icon-font {\x0d\n  background-position: -144px -48px;\x0d\n}\x0d\n.icon-bold {\x0d\n  background-position: -167px -48px;\x0d\n}\x0d\n.icon-italic {\x0d\n  background-position: -192px -48px;\x0d\n}\x0d\n.icon-text-height {\x0d\n  background-position: -216px -48px;\x0d\n}\x0d\n.icon-text-width {\x0d\n  background-position: -240px -48px;\x0d\n}\x0d\n.icon-align-left {\x0d\n  background-position: -264px -48px;\x0d\n}\x0d\n.icon-align-center {\x0d\n  background-position: -288px -48px;\x0d\n}\x0d\n.icon-align-right {\x0d\n  background-position: -312px -48px;\x0d\n}\x0d\n.icon-align-justify {\x0d\n  background-position: -336px -48px;\x0d\n}\x0d\n.icon-list {\x0d\n  background-position: -360px -48px;\x0d\n}\x0d\n.icon-indent-left {\x0d\n  background-position: -384px -48px;\x0d\n}\x0d\n.icon-indent-right {\x0d\n  background-position: -408px -48px;\x0d\n}\x0d\n.icon-facetime-video {\x0d\n  background-position: -432px -48px;\x0d\n}\x0d\n.icon-picture {\x0d\n  background-position: -456px -48px;\x0d\n}\x0d\n.icon-pencil {\x0d\n  background-position: 0 -72px;\x0d\n}\x0d\n.icon-map-marker {\x0d\n  background-position: -24px -72px;\x0d\n}\x0d\n.icon-adjust {\x0d\n  background-position: -48px -72px;\x0d\n}\x0d\n.icon-tint {\x0d\n  background-position: -72px -72px;\x0d\n}\x0d\n.icon-edit {\x0d\n  background-position: -96px -72px;\x0d\n}\x0d\n.icon-share {\x0d\n  background-position: -120px -72px;\x0d\n}\x0d\n.icon-check {\x0d\n  background-position: -144px -72px;\x0d\n}\x0d\n.icon-move {\x0d\n  background-position: -168px -72px;\x0d\n}\x0d\n.icon-step-backward {\x0d\n  background-position: -192px -72px;\x0d\n}\x0d\n.icon-fast-backward {\x0d\n  background-position: -216px -72px;\x0d\n}\x0d\n.icon-backward {\x0d\n  background-position: -240px -72px;\x0d\n}\x0d\n.icon-play {\x0d\n  background-position: -264px -72px;\x0d\n}\x0d\n.icon-pause {\x0d\n  background-position: -288px -72px;\x0d\n}\x0d\n.icon-stop {\x0d\n  background-position: -312px -72px;\x0d\n}\x0d\n.icon-forward {\x0d\n  background-position: -336px -72px;\x0d\n}\x0d\n.icon-fast-forward {\x0d\n  background-position: -360px -72px;\x0d\n}\x0d\n.icon-step-forward {\x0d\n  background-position: -384px -72px;\x0d\n}\x0d\n.icon-eject {\x0d\n  background-position: -408px -72px;\x0d\n}\x0d\n.icon-chevron-left {\x0d\n  background-position: -432px -72px;\x0d\n}\x0d\n.icon-chevron-right {\x0d\n  background-position: -456px -72px;\x0d\n}\x0d\n.icon-plus-sign {\x0d\n  background-position: 0 -96px;\x0d\n}\x0d\n.icon-minus-sign {\x0d\n  background-position: -24px -96px;\x0d\n}\x0d\n.icon-remove-sign {\x0d\n  background-position: -48px -96px;\x0d\n}\x0d\n.icon-ok-sign {\x0d\n  background-position: -72px -96px;\x0d\n}\x0d\n.icon-question-sign {\x0d\n  background-position: -96px -96px;\x0d\n}\x0d\n.icon-info-sign {\x0d\n  background-position: -120px -96px;\x0d\n}\x0d\n.icon-screenshot {\x0d\n  background-position: -144px -96px;\x0d\n}\x0d\n.icon-remove-circle {\x0d\n  background-position: -168px -96px;\x0d\n}\x0d\n.icon-ok-circle {\x0d\n  background-position: -192px -96px;\x0d\n}\x0d\n.icon-ban-circle {\x0d\n  background-position: -216px -96px;\x0d\n}\x0d\n.icon-arrow-left {\x0d\n  background-position: -240px -96px;\x0d\n}\x0d\n.icon-arrow-right {\x0d\n  background-position: -264px -96px;\x0d\n}\x0d\n.icon-arrow-up {\x0d\n  background-position: -289px -96px;\x0d\n}\x0d\n.icon-arrow-down {\x0d\n  background-position: -312px -96px;\x0d\n}\x0d\n.icon-share-alt {\x0d\n  background-position: -336px -96px;\x0d\n}\x0d\n.icon-resize-full {\x0d\n  background-position: -360px -96px;\x0d\n}\x0d\n.icon-resize-small {\x0d\n  background-position: -384px -96px;\x0d\n}\x0d\n.icon-plus {\x0d\n  background-position: -408px -96px;\x0d\n}\x0d\n.icon-minus {\x0d\n  background-position: -433px -96px;\x0d\n}\x0d\n.icon-asterisk {\x0d\n  background-position: -456px -96px;\x0d\n}\x0d\n.icon-exclamation-sign {\x0d\n  background-position: 0 -120px;\x0d\n}\x0d\n.icon-gift {\x0d\n  background-position: -24px -120px;\x0d\n}\x0d\n.icon-leaf {\x0d\n  background-position: -48px -120px;\x0d\n}\x0d\n.icon-fire {\x0d\n  background-position: -72px -120px;\x0d\n}\x0d\n.icon-eye-open {\x0d\n  background-position: -96px -120px;\x0d\n}\x0d\n.icon-eye-close {\x0d\n  background-position: -120px -120px;\x0d\n}\x0d\n.icon-warning-sign {\x0d\n  background-position: -144px -120px;\x0d\n}\x0d\n.icon-plane {\x0d\n  background-position: -168px -120px;\x0d\n}\x0d\n.icon-calendar {\x0d\n  background-position: -192px -120px;\x0d\n}\x0d\n.icon-random {\x0d\n  background-position: -216px -120px;\x0d\n}\x0d\n.icon-comment {\x0d\n  background-position: -240px -120px;\x0d\n}\x0d\n.icon-magnet {\x0d\n  background-position: -264px -120px;\x0d\n}\x0d\n.icon-chevron-up {\x0d\n  background-position: -288px -120px;\x0d\n}\x0d\n.icon-chevron-down {\x0d\n  background-position: -313px -119px;\x0d\n}\x0d\n.icon-retweet {\x0d\n  background-position: -336px -120px;\x0d\n}\x0d\n.icon-shopping-cart {\x0d\n  background-position: -360px -120px;\x0d\n}\x0d\n.icon-folder-close {\x0d\n  background-position: -384px -120px;\x0d\n}\x0d\n.icon-folder-open {\x0d\n  background-position: -408px -120px;\x0d\n}\x0d\n.icon-resize-vertical {\x0d\n  background-position: -432px -119px;\x0d\n}\x0d\n.icon-resize-horizontal {\x0d\n  background-position: -456px -118px;\x0d\n}\x0d\n.icon-hdd {\x0d\n  background-position: 0 -144px;\x0d\n}\x0d\n.icon-bullhorn {\x0d\n  background-position: -24px -144px;\x0d\n}\x0d\n.icon-bell {\x0d\n  background-position: -48px -144px;\x0d\n}\x0d\n.icon-certificate {\x0d\n  background-position: -72px -144px;\x0d\n}\x0d\n.icon-thumbs-up {\x0d\n  background-position: -96px -144px;\x0d\n}\x0d\n.icon-thumbs-down {\x0d\n  background-position: -120px -144px;\x0d\n}\x0d\n.icon-hand-right {\x0d\n  background-position: -144px -144px;\x0d\n}\x0d\n.icon-hand-left {\x0d\n  background-position: -168px -144px;\x0d\n}\x0d\n.icon-hand-up {\x0d\n  background-position: -192px -144px;\x0d\n}\x0d\n.icon-hand-down {\x0d\n  background-position: -216px -144px;\x0d\n}\x0d\n.icon-circle-arrow-right {\x0d\n  background-position: -240px -144px;\x0d\n}\x0d\n.icon-circle-arrow-left {\x0d\n  background-position: -264px -144px;\x0d\n}\x0d\n.icon-circle-arrow-up {\x0d\n  background-position: -288px -144px;\x0d\n}\x0d\n.icon-circle-arrow-down {\x0d\n  background-position: -312px -144px;\x0d\n}\x0d\n.icon-globe {\x0d\n  background-position: -336px -144px;\x0d\n}\x0d\n.icon-wrench {\x0d\n  background-position: -360px -144px;\x0d\n}\x0d\n.icon-tasks {\x0d\n  background-position: -384px -144px;\x0d\n}\x0d\n.icon-filter {\x0d\n  background-position: -408px -144px;\x0d\n}\x0d\n.icon-briefcase {\x0d\n  background-position: -432px -144px;\x0d\n}\x0d\n.icon-fullscreen {\x0d\n  background-position: -456px -144px;\x0d\n}\x0d\n.dropup,\x0d\n.dropdown {\x0d\n  position: relative;\x0d\n}\x0d\n.dropdown-toggle {\x0d\n  *margin-bottom: -3px;\x0d\n}\x0d\n.dropdown-toggle:active,\x0d\n.open .dropdown-toggle {\x0d\n  outline: 0;\x0d\n}\x0d\n.caret {\x0d\n  display: inline-block;\x0d\n  width: 0;\x0d\n  height: 0;\x0d\n  vertical-align: top;\x0d\n  border-top: 4px solid #000000;\x0d\n  border-right: 4px solid transparent;\x0d\n  border-left: 4px solid transparent;\x0d\n  content: \"\";\x0d\n  opacity: 0.3;\x0d\n  filter: alpha(opacity=30);\x0d\n}\x0d\n.dropdown .caret {\x0d\n  margin-top: 8px;\x0d\n  margin-left: 2px;\x0d\n}\x0d\n.dropdown:hover .caret,\x0d\n.open .caret {\x0d\n  opacity: 1;\x0d\n  filter: alpha(opacity=100);\x0d\n}\x0d\n.dropdown-menu {\x0d\n  position: absolute;\x0d\n  top: 100%;\x0d\n  left: 0;\x0d\n  z-index: 1000;\x0d\n  display: none;\x0d\n  float: left;\x0d\n  min-width: 160px;\x0d\n  padding: 4px 0;\x0d\n  margin: 1px 0 0;\x0d\n  list-style: none;\x0d\n  background-color: #ffffff;\x0d\n  border: 1px solid #ccc;\x0d\n  border: 1px solid rgba(0, 0, 0, 0.2);\x0d\n  *border-right-width: 2px;\x0d\n  *border-bottom-width: 2px;\x0d\n  -webkit-border-radius: 5px;\x0d\n  -moz-border-radius: 5px;\x0d\n  border-radius: 5px;\x0d\n  -webkit-box-shadow: 0 5px 10px rgba(0, 0, 0, 0.2);\x0d\n  -moz-box-shadow: 0 5px 10px rgba(0, 0, 0, 0.2);\x0d\n  box-shadow: 0 5px 10px rgba(0, 0, 0, 0.2);\x0d\n  -webkit-background-clip: padding-box;\x0d\n  -moz-background-clip: padding;\x0d\n  background-clip: padding-box;\x0d\n}\x0d\n.dropdown-menu.pull-right {\x0d\n  right: 0;\x0d\n  left: auto;\x0d\n}\x0d\n.dropdown-menu .divider {\x0d\n  *width: 100%;\x0d\n  height: 1px;\x0d\n  margin: 8px 1px;\x0d\n  *margin: -5px 0 5px;\x0d\n  overflow: hidden;\x0d\n  background-color: #e5e5e5;\x0d\n  border-bottom: 1px solid #ffffff;\x0d\n}\x0d\n.dropdown-menu a {\x0d\n  display: block;\x0d\n  padding: 3px 15px;\x0d\n  clear: both;\x0d\n  font-weight: normal;\x0d\n  line-height: 18px;\x0d\n  color: #333333;\x0d\n  white-space: nowrap;\x0d\n}\x0d\n.dropdown-menu li > a:hover,\x0d\n.dropdown-menu .active > a,\x0d\n.dropdown-menu .active > a:hover {\x0d\n  color: #ffffff;\x0d\n  text-decoration: none;\x0d\n  background-color: #4183c4;\x0d\n}\x0d\n.open {\x0d\n  *z-index: 1000;\x0d\n}\x0d\n.open .dropdown-menu {\x0d\n  display: block;\x0d\n}\x0d\n.pull-right .dropdown-menu {\x0d\n  right: 0;\x0d\n  left: auto;\x0d\n}\x0d\n.dropup .caret,\x0d\n.navbar-fixed-bottom .dropdown .caret {\x0d\n  border-top: 0;\x0d\n  border-bottom: 4px solid #000000;\x0d\n  content: \"\\2191\";\x0d\n}\x0d\n.dropup .dropdown-menu,\x0d\n.navbar-fixed-bottom .dropdown .dropdown-menu {\x0d\n  top: auto;\x0d\n  bottom: 100%;\x0d\n  margin-bottom: 1px;\x0d\n}\x0d\n.typeahead {\x0d\n  margin-top: 2px;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\n.well {\x0d\n  min-height: 20px;\x0d\n  padding: 19px;\x0d\n  margin-bottom: 20px;\x0d\n  background-color: #f5f5f5;\x0d\n  border: 1px solid #eee;\x0d\n  border: 1px solid rgba(0, 0, 0, 0.05);\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n  -webkit-box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.05);\x0d\n  -moz-box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.05);\x0d\n  box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.05);\x0d\n}\x0d\n.well blockquote {\x0d\n  border-color: #ddd;\x0d\n  border-color: rgba(0, 0, 0, 0.15);\x0d\n}\x0d\n.well-large {\x0d\n  padding: 24px;\x0d\n  -webkit-border-radius: 6px;\x0d\n  -moz-border-radius: 6px;\x0d\n  border-radius: 6px;\x0d\n}\x0d\n.well-small {\x0d\n  padding: 9px;\x0d\n  -webkit-border-radius: 3px;\x0d\n  -moz-border-radius: 3px;\x0d\n  border-radius: 3px;\x0d\n}\x0d\n.fade {\x0d\n  opacity: 0;\x0d\n  filter: alpha(opacity=0);\x0d\n  -webkit-transition: opacity 0.15s linear;\x0d\n  -moz-transition: opacity 0.15s linear;\x0d\n  -ms-transition: opacity 0.15s linear;\x0d\n  -o-transition: opacity 0.15s linear;\x0d\n  transition: opacity 0.15s linear;\x0d\n}\x0d\n.fade.in {\x0d\n  opacity: 1;\x0d\n  filter: alpha(opacity=100);\x0d\n}\x0d\n.collapse {\x0d\n  position: relative;\x0d\n  height: 0;\x0d\n  overflow: hidden;\x0d\n  -webkit-transition: height 0.35s ease;\x0d\n  -moz-transition: height 0.35s ease;\x0d\n  -ms-transition: height 0.35s ease;\x0d\n  -o-transition: height 0.35s ease;\x0d\n  transition: height 0.35s ease;\x0d\n}\x0d\n.collapse.in {\x0d\n  height: auto;\x0d\n}\x0d\n.close {\x0d\n  float: right;\x0d\n  font-size: 20px;\x0d\n  font-weight: bold;\x0d\n  line-height: 18px;\x0d\n  color: #000000;\x0d\n  text-shadow: 0 1px 0 #ffffff;\x0d\n  opacity: 0.2;\x0d\n  filter: alpha(opacity=20);\x0d\n}\x0d\n.close:hover {\x0d\n  color: #000000;\x0d\n  text-decoration: none;\x0d\n  cursor: pointer;\x0d\n  opacity: 0.4;\x0d\n  filter: alpha(opacity=40);\x0d\n}\x0d\nbutton.close {\x0d\n  padding: 0;\x0d\n  cursor: pointer;\x0d\n  background: transparent;\x0d\n  border: 0;\x0d\n  -webkit-appearance: none;\x0d\n}\x0d\n.btn {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  /* IE7 inline-block hack */\x0d\n\x0d\n  *zoom: 1;\x0d\n  padding: 4px 10px 4px;\x0d\n  margin-bottom: 0;\x0d\n  font-size: 13px;\x0d\n  line-height: 18px;\x0d\n  *line-height: 20px;\x0d\n  color: #333333;\x0d\n  text-align: center;\x0d\n  text-shadow: 0 1px 1px rgba(255, 255, 255, 0.75);\x0d\n  vertical-align: middle;\x0d\n  cursor: pointer;\x0d\n  background-color: #f5f5f5;\x0d\n  background-image: -moz-linear-gradient(top, #ffffff, #e6e6e6);\x0d\n  background-image: -ms-linear-gradient(top, #ffffff, #e6e6e6);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffffff), to(#e6e6e6));\x0d\n  background-image: -webkit-linear-gradient(top, #ffffff, #e6e6e6);\x0d\n  background-image: -o-linear-gradient(top, #ffffff, #e6e6e6);\x0d\n  background-image: linear-gradient(top, #ffffff, #e6e6e6);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffffff', endColorstr='#e6e6e6', GradientType=0);\x0d\n  border-color: #e6e6e6 #e6e6e6 #bfbfbf;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #e6e6e6;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n  border: 1px solid #cccccc;\x0d\n  *border: 0;\x0d\n  border-bottom-color: #b3b3b3;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n  *margin-left: .3em;\x0d\n  -webkit-box-shadow: inset 0 1px 0 rgba(255,255,255,.2), 0 1px 2px rgba(0,0,0,.05);\x0d\n  -moz-box-shadow: inset 0 1px 0 rgba(255,255,255,.2), 0 1px 2px rgba(0,0,0,.05);\x0d\n  box-shadow: inset 0 1px 0 rgba(255,255,255,.2), 0 1px 2px rgba(0,0,0,.05);\x0d\n}\x0d\n.btn:hover,\x0d\n.btn:active,\x0d\n.btn.active,\x0d\n.btn.disabled,\x0d\n.btn[disabled] {\x0d\n  background-color: #e6e6e6;\x0d\n  *background-color: #d9d9d9;\x0d\n}\x0d\n.btn:active,\x0d\n.btn.active {\x0d\n  background-color: #cccccc \\9;\x0d\n}\x0d\n.btn:first-child {\x0d\n  *margin-left: 0;\x0d\n}\x0d\n.btn:hover {\x0d\n  color: #333333;\x0d\n  text-decoration: none;\x0d\n  background-color: #e6e6e6;\x0d\n  *background-color: #d9d9d9;\x0d\n  /* Buttons in IE7 don't get borders, so darken on hover */\x0d\n\x0d\n  background-position: 0 -15px;\x0d\n  -webkit-transition: background-position 0.1s linear;\x0d\n  -moz-transition: background-position 0.1s linear;\x0d\n  -ms-transition: background-position 0.1s linear;\x0d\n  -o-transition: background-position 0.1s linear;\x0d\n  transition: background-position 0.1s linear;\x0d\n}\x0d\n.btn:focus {\x0d\n  outline: thin dotted #333;\x0d\n  outline: 5px auto -webkit-focus-ring-color;\x0d\n  outline-offset: -2px;\x0d\n}\x0d\n.btn.active,\x0d\n.btn:active {\x0d\n  background-color: #e6e6e6;\x0d\n  background-color: #d9d9d9 \\9;\x0d\n  background-image: none;\x0d\n  outline: 0;\x0d\n  -webkit-box-shadow: inset 0 2px 4px rgba(0,0,0,.15), 0 1px 2px rgba(0,0,0,.05);\x0d\n  -moz-box-shadow: inset 0 2px 4px rgba(0,0,0,.15), 0 1px 2px rgba(0,0,0,.05);\x0d\n  box-shadow: inset 0 2px 4px rgba(0,0,0,.15), 0 1px 2px rgba(0,0,0,.05);\x0d\n}\x0d\n.btn.disabled,\x0d\n.btn[disabled] {\x0d\n  cursor: default;\x0d\n  background-color: #e6e6e6;\x0d\n  background-image: none;\x0d\n  opacity: 0.65;\x0d\n  filter: alpha(opacity=65);\x0d\n  -webkit-box-shadow: none;\x0d\n  -moz-box-shadow: none;\x0d\n  box-shadow: none;\x0d\n}\x0d\n.btn-large {\x0d\n  padding: 9px 14px;\x0d\n  font-size: 15px;\x0d\n  line-height: normal;\x0d\n  -webkit-border-radius: 5px;\x0d\n  -moz-border-radius: 5px;\x0d\n  border-radius: 5px;\x0d\n}\x0d\n.btn-large [class^=\"icon-\"] {\x0d\n  margin-top: 1px;\x0d\n}\x0d\n.btn-small {\x0d\n  padding: 5px 9px;\x0d\n  font-size: 11px;\x0d\n  line-height: 16px;\x0d\n}\x0d\n.btn-small [class^=\"icon-\"] {\x0d\n  margin-top: -1px;\x0d\n}\x0d\n.btn-mini {\x0d\n  padding: 2px 6px;\x0d\n  font-size: 11px;\x0d\n  line-height: 14px;\x0d\n}\x0d\n.btn-primary,\x0d\n.btn-primary:hover,\x0d\n.btn-warning,\x0d\n.btn-warning:hover,\x0d\n.btn-danger,\x0d\n.btn-danger:hover,\x0d\n.btn-success,\x0d\n.btn-success:hover,\x0d\n.btn-info,\x0d\n.btn-info:hover,\x0d\n.btn-inverse,\x0d\n.btn-inverse:hover {\x0d\n  color: #ffffff;\x0d\n  text-shadow: 0 -1px 0 rgba(0, 0, 0, 0.25);\x0d\n}\x0d\n.btn-primary.active,\x0d\n.btn-warning.active,\x0d\n.btn-danger.active,\x0d\n.btn-success.active,\x0d\n.btn-info.active,\x0d\n.btn-inverse.active {\x0d\n  color: rgba(255, 255, 255, 0.75);\x0d\n}\x0d\n.btn {\x0d\n  border-color: #ccc;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n}\x0d\n.btn-primary {\x0d\n  background-color: #4176c4;\x0d\n  background-image: -moz-linear-gradient(top, #4183c4, #4162c4);\x0d\n  background-image: -ms-linear-gradient(top, #4183c4, #4162c4);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#4183c4), to(#4162c4));\x0d\n  background-image: -webkit-linear-gradient(top, #4183c4, #4162c4);\x0d\n  background-image: -o-linear-gradient(top, #4183c4, #4162c4);\x0d\n  background-image: linear-gradient(top, #4183c4, #4162c4);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#4183c4', endColorstr='#4162c4', GradientType=0);\x0d\n  border-color: #4162c4 #4162c4 #2c448d;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #4162c4;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-primary:hover,\x0d\n.btn-primary:active,\x0d\n.btn-primary.active,\x0d\n.btn-primary.disabled,\x0d\n.btn-primary[disabled] {\x0d\n  background-color: #4162c4;\x0d\n  *background-color: #3857b4;\x0d\n}\x0d\n.btn-primary:active,\x0d\n.btn-primary.active {\x0d\n  background-color: #324ea0 \\9;\x0d\n}\x0d\n.btn-warning {\x0d\n  background-color: #ff942e;\x0d\n  background-image: -moz-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: -ms-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffa44d), to(#ff7d00));\x0d\n  background-image: -webkit-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: -o-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffa44d', endColorstr='#ff7d00', GradientType=0);\x0d\n  border-color: #ff7d00 #ff7d00 #b35800;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #ff7d00;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-warning:hover,\x0d\n.btn-warning:active,\x0d\n.btn-warning.active,\x0d\n.btn-warning.disabled,\x0d\n.btn-warning[disabled] {\x0d\n  background-color: #ff7d00;\x0d\n  *background-color: #e67100;\x0d\n}\x0d\n.btn-warning:active,\x0d\n.btn-warning.active {\x0d\n  background-color: #cc6400 \\9;\x0d\n}\x0d\n.btn-danger {\x0d\n  background-color: #da4f49;\x0d\n  background-image: -moz-linear-gradient(top, #ee5f5b, #bd362f);\x0d\n  background-image: -ms-linear-gradient(top, #ee5f5b, #bd362f);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ee5f5b), to(#bd362f));\x0d\n  background-image: -webkit-linear-gradient(top, #ee5f5b, #bd362f);\x0d\n  background-image: -o-linear-gradient(top, #ee5f5b, #bd362f);\x0d\n  background-image: linear-gradient(top, #ee5f5b, #bd362f);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ee5f5b', endColorstr='#bd362f', GradientType=0);\x0d\n  border-color: #bd362f #bd362f #802420;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #bd362f;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-danger:hover,\x0d\n.btn-danger:active,\x0d\n.btn-danger.active,\x0d\n.btn-danger.disabled,\x0d\n.btn-danger[disabled] {\x0d\n  background-color: #bd362f;\x0d\n  *background-color: #a9302a;\x0d\n}\x0d\n.btn-danger:active,\x0d\n.btn-danger.active {\x0d\n  background-color: #942a25 \\9;\x0d\n}\x0d\n.btn-success {\x0d\n  background-color: #5bb75b;\x0d\n  background-image: -moz-linear-gradient(top, #62c462, #51a351);\x0d\n  background-image: -ms-linear-gradient(top, #62c462, #51a351);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#62c462), to(#51a351));\x0d\n  background-image: -webkit-linear-gradient(top, #62c462, #51a351);\x0d\n  background-image: -o-linear-gradient(top, #62c462, #51a351);\x0d\n  background-image: linear-gradient(top, #62c462, #51a351);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#62c462', endColorstr='#51a351', GradientType=0);\x0d\n  border-color: #51a351 #51a351 #387038;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #51a351;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-success:hover,\x0d\n.btn-success:active,\x0d\n.btn-success.active,\x0d\n.btn-success.disabled,\x0d\n.btn-success[disabled] {\x0d\n  background-color: #51a351;\x0d\n  *background-color: #499249;\x0d\n}\x0d\n.btn-success:active,\x0d\n.btn-success.active {\x0d\n  background-color: #408140 \\9;\x0d\n}\x0d\n.btn-info {\x0d\n  background-color: #49afcd;\x0d\n  background-image: -moz-linear-gradient(top, #5bc0de, #2f96b4);\x0d\n  background-image: -ms-linear-gradient(top, #5bc0de, #2f96b4);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#5bc0de), to(#2f96b4));\x0d\n  background-image: -webkit-linear-gradient(top, #5bc0de, #2f96b4);\x0d\n  background-image: -o-linear-gradient(top, #5bc0de, #2f96b4);\x0d\n  background-image: linear-gradient(top, #5bc0de, #2f96b4);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#5bc0de', endColorstr='#2f96b4', GradientType=0);\x0d\n  border-color: #2f96b4 #2f96b4 #1f6377;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #2f96b4;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-info:hover,\x0d\n.btn-info:active,\x0d\n.btn-info.active,\x0d\n.btn-info.disabled,\x0d\n.btn-info[disabled] {\x0d\n  background-color: #2f96b4;\x0d\n  *background-color: #2a85a0;\x0d\n}\x0d\n.btn-info:active,\x0d\n.btn-info.active {\x0d\n  background-color: #24748c \\9;\x0d\n}\x0d\n.btn-inverse {\x0d\n  background-color: #414141;\x0d\n  background-image: -moz-linear-gradient(top, #555555, #222222);\x0d\n  background-image: -ms-linear-gradient(top, #555555, #222222);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#555555), to(#222222));\x0d\n  background-image: -webkit-linear-gradient(top, #555555, #222222);\x0d\n  background-image: -o-linear-gradient(top, #555555, #222222);\x0d\n  background-image: linear-gradient(top, #555555, #222222);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#555555', endColorstr='#222222', GradientType=0);\x0d\n  border-color: #222222 #222222 #000000;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #222222;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-inverse:hover,\x0d\n.btn-inverse:active,\x0d\n.btn-inverse.active,\x0d\n.btn-inverse.disabled,\x0d\n.btn-inverse[disabled] {\x0d\n  background-color: #222222;\x0d\n  *background-color: #151515;\x0d\n}\x0d\n.btn-inverse:active,\x0d\n.btn-inverse.active {\x0d\n  background-color: #080808 \\9;\x0d\n}\x0d\nbutton.btn,\x0d\ninput[type=\"submit\"].btn {\x0d\n  *padding-top: 2px;\x0d\n  *padding-bottom: 2px;\x0d\n}\x0d\nbutton.btn::-moz-focus-inner,\x0d\ninput[type=\"submit\"].btn::-moz-focus-inner {\x0d\n  padding: 0;\x0d\n  border: 0;\x0d\n}\x0d\nbutton.btn.btn-large,\x0d\ninput[type=\"submit\"].btn.btn-large {\x0d\n  *padding-top: 7px;\x0d\n  *padding-bottom: 7px;\x0d\n}\x0d\nbutton.btn.btn-small,\x0d\ninput[type=\"submit\"].btn.btn-small {\x0d\n  *padding-top: 3px;\x0d\n  *padding-bottom: 3px;\x0d\n}\x0d\nbutton.btn.btn-mini,\x0d\ninput[type=\"submit\"].btn.btn-mini {\x0d\n  *padding-top: 1px;\x0d\n  *padding-bottom: 1px;\x0d\n}\x0d\n.btn-group {\x0d\n  position: relative;\x0d\n  *zoom: 1;\x0d\n  *margin-left: .3em;\x0d\n}\x0d\n.btn-group:before,\x0d\n.btn-group:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.btn-group:after {\x0d\n  clear: both;\x0d\n}\x0d\n.btn-group:first-child {\x0d\n  *margin-left: 0;\x0d\n}\x0d\n.btn-group + .btn-group {\x0d\n  margin-left: 5px;\x0d\n}\x0d\n.btn-toolbar {\x0d\n  margin-top: 9px;\x0d\n  margin-bottom: 9px;\x0d\n}\x0d\n.btn-toolbar .btn-group {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  /* IE7 inline-block hack */\x0d\n\x0d\n  *zoom: 1;\x0d\n}\x0d\n.btn-group > .btn {\x0d\n  position: relative;\x0d\n  float: left;\x0d\n  margin-left: -1px;\x0d\n  -webkit-border-radius: 0;\x0d\n  -moz-border-radius: 0;\x0d\n  border-radius: 0;\x0d\n}\x0d\n.btn-group > .btn:first-child {\x0d\n  margin-left: 0;\x0d\n  -webkit-border-top-left-radius: 4px;\x0d\n  -moz-border-radius-topleft: 4px;\x0d\n  border-top-left-radius: 4px;\x0d\n  -webkit-border-bottom-left-radius: 4px;\x0d\n  -moz-border-radius-bottomleft: 4px;\x0d\n  border-bottom-left-radius: 4px;\x0d\n}\x0d\n.btn-group > .btn:last-child,\x0d\n.btn-group > .dropdown-toggle {\x0d\n  -webkit-border-top-right-radius: 4px;\x0d\n  -moz-border-radius-topright: 4px;\x0d\n  border-top-right-radius: 4px;\x0d\n  -webkit-border-bottom-right-radius: 4px;\x0d\n  -moz-border-radius-bottomright: 4px;\x0d\n  border-bottom-right-radius: 4px;\x0d\n}\x0d\n.btn-group > .btn.large:first-child {\x0d\n  margin-left: 0;\x0d\n  -webkit-border-top-left-radius: 6px;\x0d\n  -moz-border-radius-topleft: 6px;\x0d\n  border-top-left-radius: 6px;\x0d\n  -webkit-border-bottom-left-radius: 6px;\x0d\n  -moz-border-radius-bottomleft: 6px;\x0d\n  border-bottom-left-radius: 6px;\x0d\n}\x0d\n.btn-group > .btn.large:last-child,\x0d\n.btn-group > .large.dropdown-toggle {\x0d\n  -webkit-border-top-right-radius: 6px;\x0d\n  -moz-border-radius-topright: 6px;\x0d\n  border-top-right-radius: 6px;\x0d\n  -webkit-border-bottom-right-radius: 6px;\x0d\n  -moz-border-radius-bottomright: 6px;\x0d\n  border-bottom-right-radius: 6px;\x0d\n}\x0d\n.btn-group > .btn:hover,\x0d\n.btn-group > .btn:focus,\x0d\n.btn-group > .btn:active,\x0d\n.btn-group > .btn.active {\x0d\n  z-index: 2;\x0d\n}\x0d\n.btn-group .dropdown-toggle:active,\x0d\n.btn-group.open .dropdown-toggle {\x0d\n  outline: 0;\x0d\n}\x0d\n.btn-group > .dropdown-toggle {\x0d\n  padding-left: 8px;\x0d\n  padding-right: 8px;\x0d\n  -webkit-box-shadow: inset 1px 0 0 rgba(255,255,255,.125), inset 0 1px 0 rgba(255,255,255,.2), 0 1px 2px rgba(0,0,0,.05);\x0d\n  -moz-box-shadow: inset 1px 0 0 rgba(255,255,255,.125), inset 0 1px 0 rgba(255,255,255,.2), 0 1px 2px rgba(0,0,0,.05);\x0d\n  box-shadow: inset 1px 0 0 rgba(255,255,255,.125), inset 0 1px 0 rgba(255,255,255,.2), 0 1px 2px rgba(0,0,0,.05);\x0d\n  *padding-top: 4px;\x0d\n  *padding-bottom: 4px;\x0d\n}\x0d\n.btn-group > .btn-mini.dropdown-toggle {\x0d\n  padding-left: 5px;\x0d\n  padding-right: 5px;\x0d\n}\x0d\n.btn-group > .btn-small.dropdown-toggle {\x0d\n  *padding-top: 4px;\x0d\n  *padding-bottom: 4px;\x0d\n}\x0d\n.btn-group > .btn-large.dropdown-toggle {\x0d\n  padding-left: 12px;\x0d\n  padding-right: 12px;\x0d\n}\x0d\n.btn-group.open .dropdown-toggle {\x0d\n  background-image: none;\x0d\n  -webkit-box-shadow: inset 0 2px 4px rgba(0,0,0,.15), 0 1px 2px rgba(0,0,0,.05);\x0d\n  -moz-box-shadow: inset 0 2px 4px rgba(0,0,0,.15), 0 1px 2px rgba(0,0,0,.05);\x0d\n  box-shadow: inset 0 2px 4px rgba(0,0,0,.15), 0 1px 2px rgba(0,0,0,.05);\x0d\n}\x0d\n.btn-group.open .btn.dropdown-toggle {\x0d\n  background-color: #e6e6e6;\x0d\n}\x0d\n.btn-group.open .btn-primary.dropdown-toggle {\x0d\n  background-color: #4162c4;\x0d\n}\x0d\n.btn-group.open .btn-warning.dropdown-toggle {\x0d\n  background-color: #ff7d00;\x0d\n}\x0d\n.btn-group.open .btn-danger.dropdown-toggle {\x0d\n  background-color: #bd362f;\x0d\n}\x0d\n.btn-group.open .btn-success.dropdown-toggle {\x0d\n  background-color: #51a351;\x0d\n}\x0d\n.btn-group.open .btn-info.dropdown-toggle {\x0d\n  background-color: #2f96b4;\x0d\n}\x0d\n.btn-group.open .btn-inverse.dropdown-toggle {\x0d\n  background-color: #222222;\x0d\n}\x0d\n.btn .caret {\x0d\n  margin-top: 7px;\x0d\n  margin-left: 0;\x0d\n}\x0d\n.btn:hover .caret,\x0d\n.open.btn-group .caret {\x0d\n  opacity: 1;\x0d\n  filter: alpha(opacity=100);\x0d\n}\x0d\n.btn-mini .caret {\x0d\n  margin-top: 5px;\x0d\n}\x0d\n.btn-small .caret {\x0d\n  margin-top: 6px;\x0d\n}\x0d\n.btn-large .caret {\x0d\n  margin-top: 6px;\x0d\n  border-left-width: 5px;\x0d\n  border-right-width: 5px;\x0d\n  border-top-width: 5px;\x0d\n}\x0d\n.dropup .btn-large .caret {\x0d\n  border-bottom: 5px solid #000000;\x0d\n  border-top: 0;\x0d\n}\x0d\n.btn-primary .caret,\x0d\n.btn-warning .caret,\x0d\n.btn-danger .caret,\x0d\n.btn-info .caret,\x0d\n.btn-success .caret,\x0d\n.btn-inverse .caret {\x0d\n  border-top-color: #ffffff;\x0d\n  border-bottom-color: #ffffff;\x0d\n  opacity: 0.75;\x0d\n  filter: alpha(opacity=75);\x0d\n}\x0d\n.alert {\x0d\n  padding: 8px 35px 8px 14px;\x0d\n  margin-bottom: 18px;\x0d\n  text-shadow: 0 1px 0 rgba(255, 255, 255, 0.5);\x0d\n  background-color: #f5f3b4;\x0d\n  border: 1px solid #f3e4a7;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n  color: #393939;\x0d\n}\x0d\n.alert-heading {\x0d\n  color: inherit;\x0d\n}\x0d\n.alert .close {\x0d\n  position: relative;\x0d\n  top: -2px;\x0d\n  right: -21px;\x0d\n  line-height: 18px;\x0d\n}\x0d\n.alert-success {\x0d\n  background-color: #bedebe;\x0d\n  border-color: #b4d5ad;\x0d\n  color: #333333;\x0d\n}\x0d\n.alert-danger,\x0d\n.alert-error {\x0d\n  background-color: #ffe9e9;\x0d\n  border-color: #ffdae0;\x0d\n  color: #393939;\x0d\n}\x0d\n.alert-info {\x0d\n  background-color: #e4f0ff;\x0d\n  border-color: #c0e7ff;\x0d\n  color: #1b3650;\x0d\n}\x0d\n.alert-block {\x0d\n  padding-top: 14px;\x0d\n  padding-bottom: 14px;\x0d\n}\x0d\n.alert-block > p,\x0d\n.alert-block > ul {\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.alert-block p + p {\x0d\n  margin-top: 5px;\x0d\n}\x0d\n.nav {\x0d\n  margin-left: 0;\x0d\n  margin-bottom: 18px;\x0d\n  list-style: none;\x0d\n}\x0d\n.nav > li > a {\x0d\n  display: block;\x0d\n}\x0d\n.nav > li > a:hover {\x0d\n  text-decoration: none;\x0d\n  background-color: #f5f5f5;\x0d\n}\x0d\n.nav > .pull-right {\x0d\n  float: right;\x0d\n}\x0d\n.nav .nav-header {\x0d\n  display: block;\x0d\n  padding: 3px 15px;\x0d\n  font-size: 11px;\x0d\n  font-weight: bold;\x0d\n  line-height: 18px;\x0d\n  color: #999999;\x0d\n  text-shadow: 0 1px 0 rgba(255, 255, 255, 0.5);\x0d\n  text-transform: uppercase;\x0d\n}\x0d\n.nav li + .nav-header {\x0d\n  margin-top: 9px;\x0d\n}\x0d\n.nav-list {\x0d\n  padding-left: 15px;\x0d\n  padding-right: 15px;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.nav-list > li > a,\x0d\n.nav-list .nav-header {\x0d\n  margin-left: -15px;\x0d\n  margin-right: -15px;\x0d\n  text-shadow: 0 1px 0 rgba(255, 255, 255, 0.5);\x0d\n}\x0d\n.nav-list > li > a {\x0d\n  padding: 3px 15px;\x0d\n}\x0d\n.nav-list > .active > a,\x0d\n.nav-list > .active > a:hover {\x0d\n  color: #ffffff;\x0d\n  text-shadow: 0 -1px 0 rgba(0, 0, 0, 0.2);\x0d\n  background-color: #4183c4;\x0d\n}\x0d\n.nav-list [class^=\"icon-\"] {\x0d\n  margin-right: 2px;\x0d\n}\x0d\n.nav-list .divider {\x0d\n  *width: 100%;\x0d\n  height: 1px;\x0d\n  margin: 8px 1px;\x0d\n  *margin: -5px 0 5px;\x0d\n  overflow: hidden;\x0d\n  background-color: #e5e5e5;\x0d\n  border-bottom: 1px solid #ffffff;\x0d\n}\x0d\n.nav-tabs,\x0d\n.nav-pills {\x0d\n  *zoom: 1;\x0d\n}\x0d\n.nav-tabs:before,\x0d\n.nav-pills:before,\x0d\n.nav-tabs:after,\x0d\n.nav-pills:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.nav-tabs:after,\x0d\n.nav-pills:after {\x0d\n  clear: both;\x0d\n}\x0d\n.nav-tabs > li,\x0d\n.nav-pills > li {\x0d\n  float: left;\x0d\n}\x0d\n.nav-tabs > li > a,\x0d\n.nav-pills > li > a {\x0d\n  padding-right: 12px;\x0d\n  padding-left: 12px;\x0d\n  margin-right: 2px;\x0d\n  line-height: 14px;\x0d\n}\x0d\n.nav-tabs {\x0d\n  border-bottom: 1px solid #ddd;\x0d\n}\x0d\n.nav-tabs > li {\x0d\n  margin-bottom: -1px;\x0d\n}\x0d\n.nav-tabs > li > a {\x0d\n  padding-top: 8px;\x0d\n  padding-bottom: 8px;\x0d\n  line-height: 18px;\x0d\n  border: 1px solid transparent;\x0d\n  -webkit-border-radius: 4px 4px 0 0;\x0d\n  -moz-border-radius: 4px 4px 0 0;\x0d\n  border-radius: 4px 4px 0 0;\x0d\n}\x0d\n.nav-tabs > li > a:hover {\x0d\n  border-color: #f5f5f5 #f5f5f5 #dddddd;\x0d\n}\x0d\n.nav-tabs > .active > a,\x0d\n.nav-tabs > .active > a:hover {\x0d\n  color: #555555;\x0d\n  background-color: #ffffff;\x0d\n  border: 1px solid #ddd;\x0d\n  border-bottom-color: transparent;\x0d\n  cursor: default;\x0d\n}\x0d\n.nav-pills > li > a {\x0d\n  padding-top: 8px;\x0d\n  padding-bottom: 8px;\x0d\n  margin-top: 2px;\x0d\n  margin-bottom: 2px;\x0d\n  -webkit-border-radius: 5px;\x0d\n  -moz-border-radius: 5px;\x0d\n  border-radius: 5px;\x0d\n}\x0d\n.nav-pills > .active > a,\x0d\n.nav-pills > .active > a:hover {\x0d\n  color: #ffffff;\x0d\n  background-color: #4183c4;\x0d\n}\x0d\n.nav-stacked > li {\x0d\n  float: none;\x0d\n}\x0d\n.nav-stacked > li > a {\x0d\n  margin-right: 0;\x0d\n}\x0d\n.nav-tabs.nav-stacked {\x0d\n  border-bottom: 0;\x0d\n}\x0d\n.nav-tabs.nav-stacked > li > a {\x0d\n  border: 1px solid #ddd;\x0d\n  -webkit-border-radius: 0;\x0d\n  -moz-border-radius: 0;\x0d\n  border-radius: 0;\x0d\n}\x0d\n.nav-tabs.nav-stacked > li:first-child > a {\x0d\n  -webkit-border-radius: 4px 4px 0 0;\x0d\n  -moz-border-radius: 4px 4px 0 0;\x0d\n  border-radius: 4px 4px 0 0;\x0d\n}\x0d\n.nav-tabs.nav-stacked > li:last-child > a {\x0d\n  -webkit-border-radius: 0 0 4px 4px;\x0d\n  -moz-border-radius: 0 0 4px 4px;\x0d\n  border-radius: 0 0 4px 4px;\x0d\n}\x0d\n.nav-tabs.nav-stacked > li > a:hover {\x0d\n  border-color: #ddd;\x0d\n  z-index: 2;\x0d\n}\x0d\n.nav-pills.nav-stacked > li > a {\x0d\n  margin-bottom: 3px;\x0d\n}\x0d\n.nav-pills.nav-stacked > li:last-child > a {\x0d\n  margin-bottom: 1px;\x0d\n}\x0d\n.nav-tabs .dropdown-menu {\x0d\n  -webkit-border-radius: 0 0 5px 5px;\x0d\n  -moz-border-radius: 0 0 5px 5px;\x0d\n  border-radius: 0 0 5px 5px;\x0d\n}\x0d\n.nav-pills .dropdown-menu {\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\n.nav-tabs .dropdown-toggle .caret,\x0d\n.nav-pills .dropdown-toggle .caret {\x0d\n  border-top-color: #4183c4;\x0d\n  border-bottom-color: #4183c4;\x0d\n  margin-top: 6px;\x0d\n}\x0d\n.nav-tabs .dropdown-toggle:hover .caret,\x0d\n.nav-pills .dropdown-toggle:hover .caret {\x0d\n  border-top-color: #4183c4;\x0d\n  border-bottom-color: #4183c4;\x0d\n}\x0d\n.nav-tabs .active .dropdown-toggle .caret,\x0d\n.nav-pills .active .dropdown-toggle .caret {\x0d\n  border-top-color: #333333;\x0d\n  border-bottom-color: #333333;\x0d\n}\x0d\n.nav > .dropdown.active > a:hover {\x0d\n  color: #000000;\x0d\n  cursor: pointer;\x0d\n}\x0d\n.nav-tabs .open .dropdown-toggle,\x0d\n.nav-pills .open .dropdown-toggle,\x0d\n.nav > li.dropdown.open.active > a:hover {\x0d\n  color: #ffffff;\x0d\n  background-color: #999999;\x0d\n  border-color: #999999;\x0d\n}\x0d\n.nav li.dropdown.open .caret,\x0d\n.nav li.dropdown.open.active .caret,\x0d\n.nav li.dropdown.open a:hover .caret {\x0d\n  border-top-color: #ffffff;\x0d\n  border-bottom-color: #ffffff;\x0d\n  opacity: 1;\x0d\n  filter: alpha(opacity=100);\x0d\n}\x0d\n.tabs-stacked .open > a:hover {\x0d\n  border-color: #999999;\x0d\n}\x0d\n.tabbable {\x0d\n  *zoom: 1;\x0d\n}\x0d\n.tabbable:before,\x0d\n.tabbable:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.tabbable:after {\x0d\n  clear: both;\x0d\n}\x0d\n.tab-content {\x0d\n  overflow: auto;\x0d\n}\x0d\n.tabs-below > .nav-tabs,\x0d\n.tabs-right > .nav-tabs,\x0d\n.tabs-left > .nav-tabs {\x0d\n  border-bottom: 0;\x0d\n}\x0d\n.tab-content > .tab-pane,\x0d\n.pill-content > .pill-pane {\x0d\n  display: none;\x0d\n}\x0d\n.tab-content > .active,\x0d\n.pill-content > .active {\x0d\n  display: block;\x0d\n}\x0d\n.tabs-below > .nav-tabs {\x0d\n  border-top: 1px solid #ddd;\x0d\n}\x0d\n.tabs-below > .nav-tabs > li {\x0d\n  margin-top: -1px;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.tabs-below > .nav-tabs > li > a {\x0d\n  -webkit-border-radius: 0 0 4px 4px;\x0d\n  -moz-border-radius: 0 0 4px 4px;\x0d\n  border-radius: 0 0 4px 4px;\x0d\n}\x0d\n.tabs-below > .nav-tabs > li > a:hover {\x0d\n  border-bottom-color: transparent;\x0d\n  border-top-color: #ddd;\x0d\n}\x0d\n.tabs-below > .nav-tabs > .active > a,\x0d\n.tabs-below > .nav-tabs > .active > a:hover {\x0d\n  border-color: transparent #ddd #ddd #ddd;\x0d\n}\x0d\n.tabs-left > .nav-tabs > li,\x0d\n.tabs-right > .nav-tabs > li {\x0d\n  float: none;\x0d\n}\x0d\n.tabs-left > .nav-tabs > li > a,\x0d\n.tabs-right > .nav-tabs > li > a {\x0d\n  min-width: 74px;\x0d\n  margin-right: 0;\x0d\n  margin-bottom: 3px;\x0d\n}\x0d\n.tabs-left > .nav-tabs {\x0d\n  float: left;\x0d\n  margin-right: 19px;\x0d\n  border-right: 1px solid #ddd;\x0d\n}\x0d\n.tabs-left > .nav-tabs > li > a {\x0d\n  margin-right: -1px;\x0d\n  -webkit-border-radius: 4px 0 0 4px;\x0d\n  -moz-border-radius: 4px 0 0 4px;\x0d\n  border-radius: 4px 0 0 4px;\x0d\n}\x0d\n.tabs-left > .nav-tabs > li > a:hover {\x0d\n  border-color: #f5f5f5 #dddddd #f5f5f5 #f5f5f5;\x0d\n}\x0d\n.tabs-left > .nav-tabs .active > a,\x0d\n.tabs-left > .nav-tabs .active > a:hover {\x0d\n  border-color: #ddd transparent #ddd #ddd;\x0d\n  *border-right-color: #ffffff;\x0d\n}\x0d\n.tabs-right > .nav-tabs {\x0d\n  float: right;\x0d\n  margin-left: 19px;\x0d\n  border-left: 1px solid #ddd;\x0d\n}\x0d\n.tabs-right > .nav-tabs > li > a {\x0d\n  margin-left: -1px;\x0d\n  -webkit-border-radius: 0 4px 4px 0;\x0d\n  -moz-border-radius: 0 4px 4px 0;\x0d\n  border-radius: 0 4px 4px 0;\x0d\n}\x0d\n.tabs-right > .nav-tabs > li > a:hover {\x0d\n  border-color: #f5f5f5 #f5f5f5 #f5f5f5 #dddddd;\x0d\n}\x0d\n.tabs-right > .nav-tabs .active > a,\x0d\n.tabs-right > .nav-tabs .active > a:hover {\x0d\n  border-color: #ddd #ddd #ddd transparent;\x0d\n  *border-left-color: #ffffff;\x0d\n}\x0d\n.navbar {\x0d\n  *position: relative;\x0d\n  *z-index: 2;\x0d\n  overflow: visible;\x0d\n  margin-bottom: 18px;\x0d\n}\x0d\n.navbar-inner {\x0d\n  min-height: 40px;\x0d\n  padding-left: 20px;\x0d\n  padding-right: 20px;\x0d\n  background-color: #f7f7f7;\x0d\n  background-image: -moz-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: -ms-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffffff), to(#eaeaea));\x0d\n  background-image: -webkit-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: -o-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffffff', endColorstr='#eaeaea', GradientType=0);\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n  -webkit-box-shadow: 0 1px 3px rgba(0,0,0,.25), inset 0 -1px 0 rgba(0,0,0,.1);\x0d\n  -moz-box-shadow: 0 1px 3px rgba(0,0,0,.25), inset 0 -1px 0 rgba(0,0,0,.1);\x0d\n  box-shadow: 0 1px 3px rgba(0,0,0,.25), inset 0 -1px 0 rgba(0,0,0,.1);\x0d\n}\x0d\n.navbar .container {\x0d\n  width: auto;\x0d\n}\x0d\n.nav-collapse.collapse {\x0d\n  height: auto;\x0d\n}\x0d\n.navbar {\x0d\n  color: #222222;\x0d\n}\x0d\n.navbar .brand:hover {\x0d\n  text-decoration: none;\x0d\n}\x0d\n.navbar .brand {\x0d\n  float: left;\x0d\n  display: block;\x0d\n  padding: 8px 20px 12px;\x0d\n  margin-left: -20px;\x0d\n  font-size: 20px;\x0d\n  font-weight: 200;\x0d\n  line-height: 1;\x0d\n  color: #333333;\x0d\n}\x0d\n.navbar .navbar-text {\x0d\n  margin-bottom: 0;\x0d\n  line-height: 40px;\x0d\n}\x0d\n.navbar .navbar-link {\x0d\n  color: #222222;\x0d\n}\x0d\n.navbar .navbar-link:hover {\x0d\n  color: #4183c4;\x0d\n}\x0d\n.navbar .btn,\x0d\n.navbar .btn-group {\x0d\n  margin-top: 5px;\x0d\n}\x0d\n.navbar .btn-group .btn {\x0d\n  margin: 0;\x0d\n}\x0d\n.navbar-form {\x0d\n  margin-bottom: 0;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.navbar-form:before,\x0d\n.navbar-form:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.navbar-form:after {\x0d\n  clear: both;\x0d\n}\x0d\n.navbar-form input,\x0d\n.navbar-form select,\x0d\n.navbar-form .radio,\x0d\n.navbar-form .checkbox {\x0d\n  margin-top: 5px;\x0d\n}\x0d\n.navbar-form input,\x0d\n.navbar-form select {\x0d\n  display: inline-block;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.navbar-form input[type=\"image\"],\x0d\n.navbar-form input[type=\"checkbox\"],\x0d\n.navbar-form input[type=\"radio\"] {\x0d\n  margin-top: 3px;\x0d\n}\x0d\n.navbar-form .input-append,\x0d\n.navbar-form .input-prepend {\x0d\n  margin-top: 6px;\x0d\n  white-space: nowrap;\x0d\n}\x0d\n.navbar-form .input-append input,\x0d\n.navbar-form .input-prepend input {\x0d\n  margin-top: 0;\x0d\n}\x0d\n.navbar-search {\x0d\n  position: relative;\x0d\n  float: left;\x0d\n  margin-top: 6px;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.navbar-search .search-query {\x0d\n  padding: 4px 9px;\x0d\n  font-family: \"Helvetica Neue\", Helvetica, Arial, sans-serif;\x0d\n  font-size: 13px;\x0d\n  font-weight: normal;\x0d\n  line-height: 1;\x0d\n  color: #ffffff;\x0d\n  background-color: #ffffff;\x0d\n  border: 1px solid #b3b3b3;\x0d\n  -webkit-box-shadow: inset 0 1px 2px rgba(0,0,0,.1), 0 1px 0 rgba(255,255,255,.15);\x0d\n  -moz-box-shadow: inset 0 1px 2px rgba(0,0,0,.1), 0 1px 0 rgba(255,255,255,.15);\x0d\n  box-shadow: inset 0 1px 2px rgba(0,0,0,.1), 0 1px 0 rgba(255,255,255,.15);\x0d\n  -webkit-transition: none;\x0d\n  -moz-transition: none;\x0d\n  -ms-transition: none;\x0d\n  -o-transition: none;\x0d\n  transition: none;\x0d\n}\x0d\n.navbar-search .search-query:-moz-placeholder {\x0d\n  color: #cccccc;\x0d\n}\x0d\n.navbar-search .search-query::-webkit-input-placeholder {\x0d\n  color: #cccccc;\x0d\n}\x0d\n.navbar-search .search-query:focus,\x0d\n.navbar-search .search-query.focused {\x0d\n  padding: 5px 10px;\x0d\n  color: #333333;\x0d\n  text-shadow: 0 1px 0 #ffffff;\x0d\n  background-color: #ffffff;\x0d\n  border: 0;\x0d\n  -webkit-box-shadow: 0 0 3px rgba(0, 0, 0, 0.15);\x0d\n  -moz-box-shadow: 0 0 3px rgba(0, 0, 0, 0.15);\x0d\n  box-shadow: 0 0 3px rgba(0, 0, 0, 0.15);\x0d\n  outline: 0;\x0d\n}\x0d\n.navbar-fixed-top,\x0d\n.navbar-fixed-bottom {\x0d\n  position: fixed;\x0d\n  right: 0;\x0d\n  left: 0;\x0d\n  z-index: 1030;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.navbar-fixed-top .navbar-inner,\x0d\n.navbar-fixed-bottom .navbar-inner {\x0d\n  padding-left: 0;\x0d\n  padding-right: 0;\x0d\n  -webkit-border-radius: 0;\x0d\n  -moz-border-radius: 0;\x0d\n  border-radius: 0;\x0d\n}\x0d\n.navbar-fixed-top .container,\x0d\n.navbar-fixed-bottom .container {\x0d\n  width: 940px;\x0d\n}\x0d\n.navbar-fixed-top {\x0d\n  top: 0;\x0d\n}\x0d\n.navbar-fixed-bottom {\x0d\n  bottom: 0;\x0d\n}\x0d\n.navbar .nav {\x0d\n  position: relative;\x0d\n  left: 0;\x0d\n  display: block;\x0d\n  float: left;\x0d\n  margin: 0 10px 0 0;\x0d\n}\x0d\n.navbar .nav.pull-right {\x0d\n  float: right;\x0d\n}\x0d\n.navbar .nav > li {\x0d\n  display: block;\x0d\n  float: left;\x0d\n}\x0d\n.navbar .nav > li > a {\x0d\n  float: none;\x0d\n  padding: 9px 10px 11px;\x0d\n  line-height: 19px;\x0d\n  color: #222222;\x0d\n  text-decoration: none;\x0d\n  text-shadow: 0 -1px 0 rgba(0, 0, 0, 0.25);\x0d\n}\x0d\n.navbar .btn {\x0d\n  display: inline-block;\x0d\n  padding: 4px 10px 4px;\x0d\n  margin: 5px 5px 6px;\x0d\n  line-height: 18px;\x0d\n}\x0d\n.navbar .btn-group {\x0d\n  margin: 0;\x0d\n  padding: 5px 5px 6px;\x0d\n}\x0d\n.navbar .nav > li > a:hover {\x0d\n  background-color: transparent;\x0d\n  color: #4183c4;\x0d\n  text-decoration: none;\x0d\n}\x0d\n.navbar .nav .active > a,\x0d\n.navbar .nav .active > a:hover {\x0d\n  color: #4183c4;\x0d\n  text-decoration: none;\x0d\n  background-color: #eaeaea;\x0d\n}\x0d\n.navbar .divider-vertical {\x0d\n  height: 40px;\x0d\n  width: 1px;\x0d\n  margin: 0 9px;\x0d\n  overflow: hidden;\x0d\n  background-color: #eaeaea;\x0d\n  border-right: 1px solid #ffffff;\x0d\n}\x0d\n.navbar .nav.pull-right {\x0d\n  margin-left: 10px;\x0d\n  margin-right: 0;\x0d\n}\x0d\n.navbar .btn-navbar {\x0d\n  display: none;\x0d\n  float: right;\x0d\n  padding: 7px 10px;\x0d\n  margin-left: 5px;\x0d\n  margin-right: 5px;\x0d\n  background-color: #f7f7f7;\x0d\n  background-image: -moz-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: -ms-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffffff), to(#eaeaea));\x0d\n  background-image: -webkit-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: -o-linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-image: linear-gradient(top, #ffffff, #eaeaea);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffffff', endColorstr='#eaeaea', GradientType=0);\x0d\n  border-color: #eaeaea #eaeaea #c4c4c4;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #eaeaea;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n  -webkit-box-shadow: inset 0 1px 0 rgba(255,255,255,.1), 0 1px 0 rgba(255,255,255,.075);\x0d\n  -moz-box-shadow: inset 0 1px 0 rgba(255,255,255,.1), 0 1px 0 rgba(255,255,255,.075);\x0d\n  box-shadow: inset 0 1px 0 rgba(255,255,255,.1), 0 1px 0 rgba(255,255,255,.075);\x0d\n}\x0d\n.navbar .btn-navbar:hover,\x0d\n.navbar .btn-navbar:active,\x0d\n.navbar .btn-navbar.active,\x0d\n.navbar .btn-navbar.disabled,\x0d\n.navbar .btn-navbar[disabled] {\x0d\n  background-color: #eaeaea;\x0d\n  *background-color: #dddddd;\x0d\n}\x0d\n.navbar .btn-navbar:active,\x0d\n.navbar .btn-navbar.active {\x0d\n  background-color: #d1d1d1 \\9;\x0d\n}\x0d\n.navbar .btn-navbar .icon-bar {\x0d\n  display: block;\x0d\n  width: 18px;\x0d\n  height: 2px;\x0d\n  background-color: #f5f5f5;\x0d\n  -webkit-border-radius: 1px;\x0d\n  -moz-border-radius: 1px;\x0d\n  border-radius: 1px;\x0d\n  -webkit-box-shadow: 0 1px 0 rgba(0, 0, 0, 0.25);\x0d\n  -moz-box-shadow: 0 1px 0 rgba(0, 0, 0, 0.25);\x0d\n  box-shadow: 0 1px 0 rgba(0, 0, 0, 0.25);\x0d\n}\x0d\n.btn-navbar .icon-bar + .icon-bar {\x0d\n  margin-top: 3px;\x0d\n}\x0d\n.navbar .dropdown-menu:before {\x0d\n  content: '';\x0d\n  display: inline-block;\x0d\n  border-left: 7px solid transparent;\x0d\n  border-right: 7px solid transparent;\x0d\n  border-bottom: 7px solid #ccc;\x0d\n  border-bottom-color: rgba(0, 0, 0, 0.2);\x0d\n  position: absolute;\x0d\n  top: -7px;\x0d\n  left: 9px;\x0d\n}\x0d\n.navbar .dropdown-menu:after {\x0d\n  content: '';\x0d\n  display: inline-block;\x0d\n  border-left: 6px solid transparent;\x0d\n  border-right: 6px solid transparent;\x0d\n  border-bottom: 6px solid #ffffff;\x0d\n  position: absolute;\x0d\n  top: -6px;\x0d\n  left: 10px;\x0d\n}\x0d\n.navbar-fixed-bottom .dropdown-menu:before {\x0d\n  border-top: 7px solid #ccc;\x0d\n  border-top-color: rgba(0, 0, 0, 0.2);\x0d\n  border-bottom: 0;\x0d\n  bottom: -7px;\x0d\n  top: auto;\x0d\n}\x0d\n.navbar-fixed-bottom .dropdown-menu:after {\x0d\n  border-top: 6px solid #ffffff;\x0d\n  border-bottom: 0;\x0d\n  bottom: -6px;\x0d\n  top: auto;\x0d\n}\x0d\n.navbar .nav li.dropdown .dropdown-toggle .caret,\x0d\n.navbar .nav li.dropdown.open .caret {\x0d\n  border-top-color: #ffffff;\x0d\n  border-bottom-color: #ffffff;\x0d\n}\x0d\n.navbar .nav li.dropdown.active .caret {\x0d\n  opacity: 1;\x0d\n  filter: alpha(opacity=100);\x0d\n}\x0d\n.navbar .nav li.dropdown.open > .dropdown-toggle,\x0d\n.navbar .nav li.dropdown.active > .dropdown-toggle,\x0d\n.navbar .nav li.dropdown.open.active > .dropdown-toggle {\x0d\n  background-color: transparent;\x0d\n}\x0d\n.navbar .nav li.dropdown.active > .dropdown-toggle:hover {\x0d\n  color: #ffffff;\x0d\n}\x0d\n.navbar .pull-right .dropdown-menu,\x0d\n.navbar .dropdown-menu.pull-right {\x0d\n  left: auto;\x0d\n  right: 0;\x0d\n}\x0d\n.navbar .pull-right .dropdown-menu:before,\x0d\n.navbar .dropdown-menu.pull-right:before {\x0d\n  left: auto;\x0d\n  right: 12px;\x0d\n}\x0d\n.navbar .pull-right .dropdown-menu:after,\x0d\n.navbar .dropdown-menu.pull-right:after {\x0d\n  left: auto;\x0d\n  right: 13px;\x0d\n}\x0d\n.breadcrumb {\x0d\n  padding: 7px 14px;\x0d\n  margin: 0 0 18px;\x0d\n  list-style: none;\x0d\n  background-color: #fbfbfb;\x0d\n  background-image: -moz-linear-gradient(top, #ffffff, #f5f5f5);\x0d\n  background-image: -ms-linear-gradient(top, #ffffff, #f5f5f5);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffffff), to(#f5f5f5));\x0d\n  background-image: -webkit-linear-gradient(top, #ffffff, #f5f5f5);\x0d\n  background-image: -o-linear-gradient(top, #ffffff, #f5f5f5);\x0d\n  background-image: linear-gradient(top, #ffffff, #f5f5f5);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffffff', endColorstr='#f5f5f5', GradientType=0);\x0d\n  border: 1px solid #ddd;\x0d\n  -webkit-border-radius: 3px;\x0d\n  -moz-border-radius: 3px;\x0d\n  border-radius: 3px;\x0d\n  -webkit-box-shadow: inset 0 1px 0 #ffffff;\x0d\n  -moz-box-shadow: inset 0 1px 0 #ffffff;\x0d\n  box-shadow: inset 0 1px 0 #ffffff;\x0d\n}\x0d\n.breadcrumb li {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  /* IE7 inline-block hack */\x0d\n\x0d\n  *zoom: 1;\x0d\n  text-shadow: 0 1px 0 #ffffff;\x0d\n}\x0d\n.breadcrumb .divider {\x0d\n  padding: 0 5px;\x0d\n  color: #999999;\x0d\n}\x0d\n.breadcrumb .active a {\x0d\n  color: #333333;\x0d\n}\x0d\n.pagination {\x0d\n  height: 36px;\x0d\n  margin: 18px 0;\x0d\n}\x0d\n.pagination ul {\x0d\n  display: inline-block;\x0d\n  *display: inline;\x0d\n  /* IE7 inline-block hack */\x0d\n\x0d\n  *zoom: 1;\x0d\n  margin-left: 0;\x0d\n  margin-bottom: 0;\x0d\n  -webkit-border-radius: 3px;\x0d\n  -moz-border-radius: 3px;\x0d\n  border-radius: 3px;\x0d\n  -webkit-box-shadow: 0 1px 2px rgba(0, 0, 0, 0.05);\x0d\n  -moz-box-shadow: 0 1px 2px rgba(0, 0, 0, 0.05);\x0d\n  box-shadow: 0 1px 2px rgba(0, 0, 0, 0.05);\x0d\n}\x0d\n.pagination li {\x0d\n  display: inline;\x0d\n}\x0d\n.pagination a {\x0d\n  float: left;\x0d\n  padding: 0 14px;\x0d\n  line-height: 34px;\x0d\n  text-decoration: none;\x0d\n  border: 1px solid #ddd;\x0d\n  border-left-width: 0;\x0d\n}\x0d\n.pagination a:hover,\x0d\n.pagination .active a {\x0d\n  background-color: #f5f5f5;\x0d\n}\x0d\n.pagination .active a {\x0d\n  color: #999999;\x0d\n  cursor: default;\x0d\n}\x0d\n.pagination .disabled span,\x0d\n.pagination .disabled a,\x0d\n.pagination .disabled a:hover {\x0d\n  color: #999999;\x0d\n  background-color: transparent;\x0d\n  cursor: default;\x0d\n}\x0d\n.pagination li:first-child a {\x0d\n  border-left-width: 1px;\x0d\n  -webkit-border-radius: 3px 0 0 3px;\x0d\n  -moz-border-radius: 3px 0 0 3px;\x0d\n  border-radius: 3px 0 0 3px;\x0d\n}\x0d\n.pagination li:last-child a {\x0d\n  -webkit-border-radius: 0 3px 3px 0;\x0d\n  -moz-border-radius: 0 3px 3px 0;\x0d\n  border-radius: 0 3px 3px 0;\x0d\n}\x0d\n.pagination-centered {\x0d\n  text-align: center;\x0d\n}\x0d\n.pagination-right {\x0d\n  text-align: right;\x0d\n}\x0d\n.pager {\x0d\n  margin-left: 0;\x0d\n  margin-bottom: 18px;\x0d\n  list-style: none;\x0d\n  text-align: center;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.pager:before,\x0d\n.pager:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.pager:after {\x0d\n  clear: both;\x0d\n}\x0d\n.pager li {\x0d\n  display: inline;\x0d\n}\x0d\n.pager a {\x0d\n  display: inline-block;\x0d\n  padding: 5px 14px;\x0d\n  background-color: #fff;\x0d\n  border: 1px solid #ddd;\x0d\n  -webkit-border-radius: 15px;\x0d\n  -moz-border-radius: 15px;\x0d\n  border-radius: 15px;\x0d\n}\x0d\n.pager a:hover {\x0d\n  text-decoration: none;\x0d\n  background-color: #f5f5f5;\x0d\n}\x0d\n.pager .next a {\x0d\n  float: right;\x0d\n}\x0d\n.pager .previous a {\x0d\n  float: left;\x0d\n}\x0d\n.pager .disabled a,\x0d\n.pager .disabled a:hover {\x0d\n  color: #999999;\x0d\n  background-color: #fff;\x0d\n  cursor: default;\x0d\n}\x0d\n.modal-open .dropdown-menu {\x0d\n  z-index: 2050;\x0d\n}\x0d\n.modal-open .dropdown.open {\x0d\n  *z-index: 2050;\x0d\n}\x0d\n.modal-open .popover {\x0d\n  z-index: 2060;\x0d\n}\x0d\n.modal-open .tooltip {\x0d\n  z-index: 2070;\x0d\n}\x0d\n.modal-backdrop {\x0d\n  position: fixed;\x0d\n  top: 0;\x0d\n  right: 0;\x0d\n  bottom: 0;\x0d\n  left: 0;\x0d\n  z-index: 1040;\x0d\n  background-color: #000000;\x0d\n}\x0d\n.modal-backdrop.fade {\x0d\n  opacity: 0;\x0d\n}\x0d\n.modal-backdrop,\x0d\n.modal-backdrop.fade.in {\x0d\n  opacity: 0.8;\x0d\n  filter: alpha(opacity=80);\x0d\n}\x0d\n.modal {\x0d\n  position: fixed;\x0d\n  top: 50%;\x0d\n  left: 50%;\x0d\n  z-index: 1050;\x0d\n  overflow: auto;\x0d\n  width: 560px;\x0d\n  margin: -250px 0 0 -280px;\x0d\n  background-color: #ffffff;\x0d\n  border: 1px solid #999;\x0d\n  border: 1px solid rgba(0, 0, 0, 0.3);\x0d\n  *border: 1px solid #999;\x0d\n  /* IE6-7 */\x0d\n\x0d\n  -webkit-border-radius: 6px;\x0d\n  -moz-border-radius: 6px;\x0d\n  border-radius: 6px;\x0d\n  -webkit-box-shadow: 0 3px 7px rgba(0, 0, 0, 0.3);\x0d\n  -moz-box-shadow: 0 3px 7px rgba(0, 0, 0, 0.3);\x0d\n  box-shadow: 0 3px 7px rgba(0, 0, 0, 0.3);\x0d\n  -webkit-background-clip: padding-box;\x0d\n  -moz-background-clip: padding-box;\x0d\n  background-clip: padding-box;\x0d\n}\x0d\n.modal.fade {\x0d\n  -webkit-transition: opacity .3s linear, top .3s ease-out;\x0d\n  -moz-transition: opacity .3s linear, top .3s ease-out;\x0d\n  -ms-transition: opacity .3s linear, top .3s ease-out;\x0d\n  -o-transition: opacity .3s linear, top .3s ease-out;\x0d\n  transition: opacity .3s linear, top .3s ease-out;\x0d\n  top: -25%;\x0d\n}\x0d\n.modal.fade.in {\x0d\n  top: 50%;\x0d\n}\x0d\n.modal-header {\x0d\n  padding: 9px 15px;\x0d\n  border-bottom: 1px solid #eee;\x0d\n}\x0d\n.modal-header .close {\x0d\n  margin-top: 2px;\x0d\n}\x0d\n.modal-body {\x0d\n  overflow-y: auto;\x0d\n  max-height: 400px;\x0d\n  padding: 15px;\x0d\n}\x0d\n.modal-form {\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.modal-footer {\x0d\n  padding: 14px 15px 15px;\x0d\n  margin-bottom: 0;\x0d\n  text-align: right;\x0d\n  background-color: #f5f5f5;\x0d\n  border-top: 1px solid #ddd;\x0d\n  -webkit-border-radius: 0 0 6px 6px;\x0d\n  -moz-border-radius: 0 0 6px 6px;\x0d\n  border-radius: 0 0 6px 6px;\x0d\n  -webkit-box-shadow: inset 0 1px 0 #ffffff;\x0d\n  -moz-box-shadow: inset 0 1px 0 #ffffff;\x0d\n  box-shadow: inset 0 1px 0 #ffffff;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.modal-footer:before,\x0d\n.modal-footer:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.modal-footer:after {\x0d\n  clear: both;\x0d\n}\x0d\n.modal-footer .btn + .btn {\x0d\n  margin-left: 5px;\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.modal-footer .btn-group .btn + .btn {\x0d\n  margin-left: -1px;\x0d\n}\x0d\n.tooltip {\x0d\n  position: absolute;\x0d\n  z-index: 1020;\x0d\n  display: block;\x0d\n  visibility: visible;\x0d\n  padding: 5px;\x0d\n  font-size: 11px;\x0d\n  opacity: 0;\x0d\n  filter: alpha(opacity=0);\x0d\n}\x0d\n.tooltip.in {\x0d\n  opacity: 0.8;\x0d\n  filter: alpha(opacity=80);\x0d\n}\x0d\n.tooltip.top {\x0d\n  margin-top: -2px;\x0d\n}\x0d\n.tooltip.right {\x0d\n  margin-left: 2px;\x0d\n}\x0d\n.tooltip.bottom {\x0d\n  margin-top: 2px;\x0d\n}\x0d\n.tooltip.left {\x0d\n  margin-left: -2px;\x0d\n}\x0d\n.tooltip.top .tooltip-arrow {\x0d\n  bottom: 0;\x0d\n  left: 50%;\x0d\n  margin-left: -5px;\x0d\n  border-left: 5px solid transparent;\x0d\n  border-right: 5px solid transparent;\x0d\n  border-top: 5px solid #000000;\x0d\n}\x0d\n.tooltip.left .tooltip-arrow {\x0d\n  top: 50%;\x0d\n  right: 0;\x0d\n  margin-top: -5px;\x0d\n  border-top: 5px solid transparent;\x0d\n  border-bottom: 5px solid transparent;\x0d\n  border-left: 5px solid #000000;\x0d\n}\x0d\n.tooltip.bottom .tooltip-arrow {\x0d\n  top: 0;\x0d\n  left: 50%;\x0d\n  margin-left: -5px;\x0d\n  border-left: 5px solid transparent;\x0d\n  border-right: 5px solid transparent;\x0d\n  border-bottom: 5px solid #000000;\x0d\n}\x0d\n.tooltip.right .tooltip-arrow {\x0d\n  top: 50%;\x0d\n  left: 0;\x0d\n  margin-top: -5px;\x0d\n  border-top: 5px solid transparent;\x0d\n  border-bottom: 5px solid transparent;\x0d\n  border-right: 5px solid #000000;\x0d\n}\x0d\n.tooltip-inner {\x0d\n  max-width: 200px;\x0d\n  padding: 3px 8px;\x0d\n  color: #ffffff;\x0d\n  text-align: center;\x0d\n  text-decoration: none;\x0d\n  background-color: #000000;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\n.tooltip-arrow {\x0d\n  position: absolute;\x0d\n  width: 0;\x0d\n  height: 0;\x0d\n}\x0d\n.popover {\x0d\n  position: absolute;\x0d\n  top: 0;\x0d\n  left: 0;\x0d\n  z-index: 1010;\x0d\n  display: none;\x0d\n  padding: 5px;\x0d\n}\x0d\n.popover.top {\x0d\n  margin-top: -5px;\x0d\n}\x0d\n.popover.right {\x0d\n  margin-left: 5px;\x0d\n}\x0d\n.popover.bottom {\x0d\n  margin-top: 5px;\x0d\n}\x0d\n.popover.left {\x0d\n  margin-left: -5px;\x0d\n}\x0d\n.popover.top .arrow {\x0d\n  bottom: 0;\x0d\n  left: 50%;\x0d\n  margin-left: -5px;\x0d\n  border-left: 5px solid transparent;\x0d\n  border-right: 5px solid transparent;\x0d\n  border-top: 5px solid #000000;\x0d\n}\x0d\n.popover.right .arrow {\x0d\n  top: 50%;\x0d\n  left: 0;\x0d\n  margin-top: -5px;\x0d\n  border-top: 5px solid transparent;\x0d\n  border-bottom: 5px solid transparent;\x0d\n  border-right: 5px solid #000000;\x0d\n}\x0d\n.popover.bottom .arrow {\x0d\n  top: 0;\x0d\n  left: 50%;\x0d\n  margin-left: -5px;\x0d\n  border-left: 5px solid transparent;\x0d\n  border-right: 5px solid transparent;\x0d\n  border-bottom: 5px solid #000000;\x0d\n}\x0d\n.popover.left .arrow {\x0d\n  top: 50%;\x0d\n  right: 0;\x0d\n  margin-top: -5px;\x0d\n  border-top: 5px solid transparent;\x0d\n  border-bottom: 5px solid transparent;\x0d\n  border-left: 5px solid #000000;\x0d\n}\x0d\n.popover .arrow {\x0d\n  position: absolute;\x0d\n  width: 0;\x0d\n  height: 0;\x0d\n}\x0d\n.popover-inner {\x0d\n  padding: 3px;\x0d\n  width: 280px;\x0d\n  overflow: hidden;\x0d\n  background: #000000;\x0d\n  background: rgba(0, 0, 0, 0.8);\x0d\n  -webkit-border-radius: 6px;\x0d\n  -moz-border-radius: 6px;\x0d\n  border-radius: 6px;\x0d\n  -webkit-box-shadow: 0 3px 7px rgba(0, 0, 0, 0.3);\x0d\n  -moz-box-shadow: 0 3px 7px rgba(0, 0, 0, 0.3);\x0d\n  box-shadow: 0 3px 7px rgba(0, 0, 0, 0.3);\x0d\n}\x0d\n.popover-title {\x0d\n  padding: 9px 15px;\x0d\n  line-height: 1;\x0d\n  background-color: #f5f5f5;\x0d\n  border-bottom: 1px solid #eee;\x0d\n  -webkit-border-radius: 3px 3px 0 0;\x0d\n  -moz-border-radius: 3px 3px 0 0;\x0d\n  border-radius: 3px 3px 0 0;\x0d\n}\x0d\n.popover-content {\x0d\n  padding: 14px;\x0d\n  background-color: #ffffff;\x0d\n  -webkit-border-radius: 0 0 3px 3px;\x0d\n  -moz-border-radius: 0 0 3px 3px;\x0d\n  border-radius: 0 0 3px 3px;\x0d\n  -webkit-background-clip: padding-box;\x0d\n  -moz-background-clip: padding-box;\x0d\n  background-clip: padding-box;\x0d\n}\x0d\n.popover-content p,\x0d\n.popover-content ul,\x0d\n.popover-content ol {\x0d\n  margin-bottom: 0;\x0d\n}\x0d\n.thumbnails {\x0d\n  margin-left: -20px;\x0d\n  list-style: none;\x0d\n  *zoom: 1;\x0d\n}\x0d\n.thumbnails:before,\x0d\n.thumbnails:after {\x0d\n  display: table;\x0d\n  content: \"\";\x0d\n}\x0d\n.thumbnails:after {\x0d\n  clear: both;\x0d\n}\x0d\n.row-fluid .thumbnails {\x0d\n  margin-left: 0;\x0d\n}\x0d\n.thumbnails > li {\x0d\n  float: left;\x0d\n  margin-bottom: 18px;\x0d\n  margin-left: 20px;\x0d\n}\x0d\n.thumbnail {\x0d\n  display: block;\x0d\n  padding: 4px;\x0d\n  line-height: 1;\x0d\n  border: 1px solid #ddd;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n  -webkit-box-shadow: 0 1px 1px rgba(0, 0, 0, 0.075);\x0d\n  -moz-box-shadow: 0 1px 1px rgba(0, 0, 0, 0.075);\x0d\n  box-shadow: 0 1px 1px rgba(0, 0, 0, 0.075);\x0d\n}\x0d\na.thumbnail:hover {\x0d\n  border-color: #4183c4;\x0d\n  -webkit-box-shadow: 0 1px 4px rgba(0, 105, 214, 0.25);\x0d\n  -moz-box-shadow: 0 1px 4px rgba(0, 105, 214, 0.25);\x0d\n  box-shadow: 0 1px 4px rgba(0, 105, 214, 0.25);\x0d\n}\x0d\n.thumbnail > img {\x0d\n  display: block;\x0d\n  max-width: 100%;\x0d\n  margin-left: auto;\x0d\n  margin-right: auto;\x0d\n}\x0d\n.thumbnail .caption {\x0d\n  padding: 9px;\x0d\n}\x0d\n.label,\x0d\n.badge {\x0d\n  font-size: 10.998px;\x0d\n  font-weight: bold;\x0d\n  line-height: 14px;\x0d\n  color: #ffffff;\x0d\n  vertical-align: baseline;\x0d\n  white-space: nowrap;\x0d\n  text-shadow: 0 -1px 0 rgba(0, 0, 0, 0.25);\x0d\n  background-color: #999999;\x0d\n}\x0d\n.label {\x0d\n  padding: 1px 4px 2px;\x0d\n  -webkit-border-radius: 3px;\x0d\n  -moz-border-radius: 3px;\x0d\n  border-radius: 3px;\x0d\n}\x0d\n.badge {\x0d\n  padding: 1px 9px 2px;\x0d\n  -webkit-border-radius: 9px;\x0d\n  -moz-border-radius: 9px;\x0d\n  border-radius: 9px;\x0d\n}\x0d\na.label:hover,\x0d\na.badge:hover {\x0d\n  color: #ffffff;\x0d\n  text-decoration: none;\x0d\n  cursor: pointer;\x0d\n}\x0d\n.label-important,\x0d\n.badge-important {\x0d\n  background-color: #393939;\x0d\n}\x0d\n.label-important[href],\x0d\n.badge-important[href] {\x0d\n  background-color: #202020;\x0d\n}\x0d\n.label-warning,\x0d\n.badge-warning {\x0d\n  background-color: #ff7d00;\x0d\n}\x0d\n.label-warning[href],\x0d\n.badge-warning[href] {\x0d\n  background-color: #cc6400;\x0d\n}\x0d\n.label-success,\x0d\n.badge-success {\x0d\n  background-color: #333333;\x0d\n}\x0d\n.label-success[href],\x0d\n.badge-success[href] {\x0d\n  background-color: #1a1a1a;\x0d\n}\x0d\n.label-info,\x0d\n.badge-info {\x0d\n  background-color: #1b3650;\x0d\n}\x0d\n.label-info[href],\x0d\n.badge-info[href] {\x0d\n  background-color: #0e1c2a;\x0d\n}\x0d\n.label-inverse,\x0d\n.badge-inverse {\x0d\n  background-color: #333333;\x0d\n}\x0d\n.label-inverse[href],\x0d\n.badge-inverse[href] {\x0d\n  background-color: #1a1a1a;\x0d\n}\x0d\n@-webkit-keyframes progress-bar-stripes {\x0d\n  from {\x0d\n    background-position: 40px 0;\x0d\n  }\x0d\n  to {\x0d\n    background-position: 0 0;\x0d\n  }\x0d\n}\x0d\n@-moz-keyframes progress-bar-stripes {\x0d\n  from {\x0d\n    background-position: 40px 0;\x0d\n  }\x0d\n  to {\x0d\n    background-position: 0 0;\x0d\n  }\x0d\n}\x0d\n@-ms-keyframes progress-bar-stripes {\x0d\n  from {\x0d\n    background-position: 40px 0;\x0d\n  }\x0d\n  to {\x0d\n    background-position: 0 0;\x0d\n  }\x0d\n}\x0d\n@-o-keyframes progress-bar-stripes {\x0d\n  from {\x0d\n    background-position: 0 0;\x0d\n  }\x0d\n  to {\x0d\n    background-position: 40px 0;\x0d\n  }\x0d\n}\x0d\n@keyframes progress-bar-stripes {\x0d\n  from {\x0d\n    background-position: 40px 0;\x0d\n  }\x0d\n  to {\x0d\n    background-position: 0 0;\x0d\n  }\x0d\n}\x0d\n.progress {\x0d\n  overflow: hidden;\x0d\n  height: 18px;\x0d\n  margin-bottom: 18px;\x0d\n  background-color: #f7f7f7;\x0d\n  background-image: -moz-linear-gradient(top, #f5f5f5, #f9f9f9);\x0d\n  background-image: -ms-linear-gradient(top, #f5f5f5, #f9f9f9);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#f5f5f5), to(#f9f9f9));\x0d\n  background-image: -webkit-linear-gradient(top, #f5f5f5, #f9f9f9);\x0d\n  background-image: -o-linear-gradient(top, #f5f5f5, #f9f9f9);\x0d\n  background-image: linear-gradient(top, #f5f5f5, #f9f9f9);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#f5f5f5', endColorstr='#f9f9f9', GradientType=0);\x0d\n  -webkit-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.1);\x0d\n  -moz-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.1);\x0d\n  box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.1);\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\n.progress .bar {\x0d\n  width: 0%;\x0d\n  height: 18px;\x0d\n  color: #ffffff;\x0d\n  font-size: 12px;\x0d\n  text-align: center;\x0d\n  text-shadow: 0 -1px 0 rgba(0, 0, 0, 0.25);\x0d\n  background-color: #0e90d2;\x0d\n  background-image: -moz-linear-gradient(top, #149bdf, #0480be);\x0d\n  background-image: -ms-linear-gradient(top, #149bdf, #0480be);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#149bdf), to(#0480be));\x0d\n  background-image: -webkit-linear-gradient(top, #149bdf, #0480be);\x0d\n  background-image: -o-linear-gradient(top, #149bdf, #0480be);\x0d\n  background-image: linear-gradient(top, #149bdf, #0480be);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#149bdf', endColorstr='#0480be', GradientType=0);\x0d\n  -webkit-box-shadow: inset 0 -1px 0 rgba(0, 0, 0, 0.15);\x0d\n  -moz-box-shadow: inset 0 -1px 0 rgba(0, 0, 0, 0.15);\x0d\n  box-shadow: inset 0 -1px 0 rgba(0, 0, 0, 0.15);\x0d\n  -webkit-box-sizing: border-box;\x0d\n  -moz-box-sizing: border-box;\x0d\n  -ms-box-sizing: border-box;\x0d\n  box-sizing: border-box;\x0d\n  -webkit-transition: width 0.6s ease;\x0d\n  -moz-transition: width 0.6s ease;\x0d\n  -ms-transition: width 0.6s ease;\x0d\n  -o-transition: width 0.6s ease;\x0d\n  transition: width 0.6s ease;\x0d\n}\x0d\n.progress-striped .bar {\x0d\n  background-color: #149bdf;\x0d\n  background-image: -webkit-gradient(linear, 0 100%, 100% 0, color-stop(0.25, rgba(255, 255, 255, 0.15)), color-stop(0.25, transparent), color-stop(0.5, transparent), color-stop(0.5, rgba(255, 255, 255, 0.15)), color-stop(0.75, rgba(255, 255, 255, 0.15)), color-stop(0.75, transparent), to(transparent));\x0d\n  background-image: -webkit-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -moz-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -ms-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -o-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  -webkit-background-size: 40px 40px;\x0d\n  -moz-background-size: 40px 40px;\x0d\n  -o-background-size: 40px 40px;\x0d\n  background-size: 40px 40px;\x0d\n}\x0d\n.progress.active .bar {\x0d\n  -webkit-animation: progress-bar-stripes 2s linear infinite;\x0d\n  -moz-animation: progress-bar-stripes 2s linear infinite;\x0d\n  -ms-animation: progress-bar-stripes 2s linear infinite;\x0d\n  -o-animation: progress-bar-stripes 2s linear infinite;\x0d\n  animation: progress-bar-stripes 2s linear infinite;\x0d\n}\x0d\n.progress-danger .bar {\x0d\n  background-color: #dd514c;\x0d\n  background-image: -moz-linear-gradient(top, #ee5f5b, #c43c35);\x0d\n  background-image: -ms-linear-gradient(top, #ee5f5b, #c43c35);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ee5f5b), to(#c43c35));\x0d\n  background-image: -webkit-linear-gradient(top, #ee5f5b, #c43c35);\x0d\n  background-image: -o-linear-gradient(top, #ee5f5b, #c43c35);\x0d\n  background-image: linear-gradient(top, #ee5f5b, #c43c35);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ee5f5b', endColorstr='#c43c35', GradientType=0);\x0d\n}\x0d\n.progress-danger.progress-striped .bar {\x0d\n  background-color: #ee5f5b;\x0d\n  background-image: -webkit-gradient(linear, 0 100%, 100% 0, color-stop(0.25, rgba(255, 255, 255, 0.15)), color-stop(0.25, transparent), color-stop(0.5, transparent), color-stop(0.5, rgba(255, 255, 255, 0.15)), color-stop(0.75, rgba(255, 255, 255, 0.15)), color-stop(0.75, transparent), to(transparent));\x0d\n  background-image: -webkit-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -moz-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -ms-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -o-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n}\x0d\n.progress-success .bar {\x0d\n  background-color: #5eb95e;\x0d\n  background-image: -moz-linear-gradient(top, #62c462, #57a957);\x0d\n  background-image: -ms-linear-gradient(top, #62c462, #57a957);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#62c462), to(#57a957));\x0d\n  background-image: -webkit-linear-gradient(top, #62c462, #57a957);\x0d\n  background-image: -o-linear-gradient(top, #62c462, #57a957);\x0d\n  background-image: linear-gradient(top, #62c462, #57a957);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#62c462', endColorstr='#57a957', GradientType=0);\x0d\n}\x0d\n.progress-success.progress-striped .bar {\x0d\n  background-color: #62c462;\x0d\n  background-image: -webkit-gradient(linear, 0 100%, 100% 0, color-stop(0.25, rgba(255, 255, 255, 0.15)), color-stop(0.25, transparent), color-stop(0.5, transparent), color-stop(0.5, rgba(255, 255, 255, 0.15)), color-stop(0.75, rgba(255, 255, 255, 0.15)), color-stop(0.75, transparent), to(transparent));\x0d\n  background-image: -webkit-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -moz-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -ms-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -o-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n}\x0d\n.progress-info .bar {\x0d\n  background-color: #4bb1cf;\x0d\n  background-image: -moz-linear-gradient(top, #5bc0de, #339bb9);\x0d\n  background-image: -ms-linear-gradient(top, #5bc0de, #339bb9);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#5bc0de), to(#339bb9));\x0d\n  background-image: -webkit-linear-gradient(top, #5bc0de, #339bb9);\x0d\n  background-image: -o-linear-gradient(top, #5bc0de, #339bb9);\x0d\n  background-image: linear-gradient(top, #5bc0de, #339bb9);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#5bc0de', endColorstr='#339bb9', GradientType=0);\x0d\n}\x0d\n.progress-info.progress-striped .bar {\x0d\n  background-color: #5bc0de;\x0d\n  background-image: -webkit-gradient(linear, 0 100%, 100% 0, color-stop(0.25, rgba(255, 255, 255, 0.15)), color-stop(0.25, transparent), color-stop(0.5, transparent), color-stop(0.5, rgba(255, 255, 255, 0.15)), color-stop(0.75, rgba(255, 255, 255, 0.15)), color-stop(0.75, transparent), to(transparent));\x0d\n  background-image: -webkit-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -moz-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -ms-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -o-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n}\x0d\n.progress-warning .bar {\x0d\n  background-color: #ff942e;\x0d\n  background-image: -moz-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: -ms-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffa44d), to(#ff7d00));\x0d\n  background-image: -webkit-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: -o-linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-image: linear-gradient(top, #ffa44d, #ff7d00);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffa44d', endColorstr='#ff7d00', GradientType=0);\x0d\n}\x0d\n.progress-warning.progress-striped .bar {\x0d\n  background-color: #ffa44d;\x0d\n  background-image: -webkit-gradient(linear, 0 100%, 100% 0, color-stop(0.25, rgba(255, 255, 255, 0.15)), color-stop(0.25, transparent), color-stop(0.5, transparent), color-stop(0.5, rgba(255, 255, 255, 0.15)), color-stop(0.75, rgba(255, 255, 255, 0.15)), color-stop(0.75, transparent), to(transparent));\x0d\n  background-image: -webkit-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -moz-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -ms-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: -o-linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n  background-image: linear-gradient(-45deg, rgba(255, 255, 255, 0.15) 25%, transparent 25%, transparent 50%, rgba(255, 255, 255, 0.15) 50%, rgba(255, 255, 255, 0.15) 75%, transparent 75%, transparent);\x0d\n}\x0d\n.accordion {\x0d\n  margin-bottom: 18px;\x0d\n}\x0d\n.accordion-group {\x0d\n  margin-bottom: 2px;\x0d\n  border: 1px solid #e5e5e5;\x0d\n  -webkit-border-radius: 4px;\x0d\n  -moz-border-radius: 4px;\x0d\n  border-radius: 4px;\x0d\n}\x0d\n.accordion-heading {\x0d\n  border-bottom: 0;\x0d\n}\x0d\n.accordion-heading .accordion-toggle {\x0d\n  display: block;\x0d\n  padding: 8px 15px;\x0d\n}\x0d\n.accordion-toggle {\x0d\n  cursor: pointer;\x0d\n}\x0d\n.accordion-inner {\x0d\n  padding: 9px 15px;\x0d\n  border-top: 1px solid #e5e5e5;\x0d\n}\x0d\n.carousel {\x0d\n  position: relative;\x0d\n  margin-bottom: 18px;\x0d\n  line-height: 1;\x0d\n}\x0d\n.carousel-inner {\x0d\n  overflow: hidden;\x0d\n  width: 100%;\x0d\n  position: relative;\x0d\n}\x0d\n.carousel .item {\x0d\n  display: none;\x0d\n  position: relative;\x0d\n  -webkit-transition: 0.6s ease-in-out left;\x0d\n  -moz-transition: 0.6s ease-in-out left;\x0d\n  -ms-transition: 0.6s ease-in-out left;\x0d\n  -o-transition: 0.6s ease-in-out left;\x0d\n  transition: 0.6s ease-in-out left;\x0d\n}\x0d\n.carousel .item > img {\x0d\n  display: block;\x0d\n  line-height: 1;\x0d\n}\x0d\n.carousel .active,\x0d\n.carousel .next,\x0d\n.carousel .prev {\x0d\n  display: block;\x0d\n}\x0d\n.carousel .active {\x0d\n  left: 0;\x0d\n}\x0d\n.carousel .next,\x0d\n.carousel .prev {\x0d\n  position: absolute;\x0d\n  top: 0;\x0d\n  width: 100%;\x0d\n}\x0d\n.carousel .next {\x0d\n  left: 100%;\x0d\n}\x0d\n.carousel .prev {\x0d\n  left: -100%;\x0d\n}\x0d\n.carousel .next.left,\x0d\n.carousel .prev.right {\x0d\n  left: 0;\x0d\n}\x0d\n.carousel .active.left {\x0d\n  left: -100%;\x0d\n}\x0d\n.carousel .active.right {\x0d\n  left: 100%;\x0d\n}\x0d\n.carousel-control {\x0d\n  position: absolute;\x0d\n  top: 40%;\x0d\n  left: 15px;\x0d\n  width: 40px;\x0d\n  height: 40px;\x0d\n  margin-top: -20px;\x0d\n  font-size: 60px;\x0d\n  font-weight: 100;\x0d\n  line-height: 30px;\x0d\n  color: #ffffff;\x0d\n  text-align: center;\x0d\n  background: #222222;\x0d\n  border: 3px solid #ffffff;\x0d\n  -webkit-border-radius: 23px;\x0d\n  -moz-border-radius: 23px;\x0d\n  border-radius: 23px;\x0d\n  opacity: 0.5;\x0d\n  filter: alpha(opacity=50);\x0d\n}\x0d\n.carousel-control.right {\x0d\n  left: auto;\x0d\n  right: 15px;\x0d\n}\x0d\n.carousel-control:hover {\x0d\n  color: #ffffff;\x0d\n  text-decoration: none;\x0d\n  opacity: 0.9;\x0d\n  filter: alpha(opacity=90);\x0d\n}\x0d\n.carousel-caption {\x0d\n  position: absolute;\x0d\n  left: 0;\x0d\n  right: 0;\x0d\n  bottom: 0;\x0d\n  padding: 10px 15px 5px;\x0d\n  background: #333333;\x0d\n  background: rgba(0, 0, 0, 0.75);\x0d\n}\x0d\n.carousel-caption h4,\x0d\n.carousel-caption p {\x0d\n  color: #ffffff;\x0d\n}\x0d\n.hero-unit {\x0d\n  padding: 60px;\x0d\n  margin-bottom: 30px;\x0d\n  background-color: #f5f5f5;\x0d\n  -webkit-border-radius: 6px;\x0d\n  -moz-border-radius: 6px;\x0d\n  border-radius: 6px;\x0d\n}\x0d\n.hero-unit h1 {\x0d\n  margin-bottom: 0;\x0d\n  font-size: 60px;\x0d\n  line-height: 1;\x0d\n  color: inherit;\x0d\n  letter-spacing: -1px;\x0d\n}\x0d\n.hero-unit p {\x0d\n  font-size: 18px;\x0d\n  font-weight: 200;\x0d\n  line-height: 27px;\x0d\n  color: inherit;\x0d\n}\x0d\n.pull-right {\x0d\n  float: right;\x0d\n}\x0d\n.pull-left {\x0d\n  float: left;\x0d\n}\x0d\n.hide {\x0d\n  display: none;\x0d\n}\x0d\n.show {\x0d\n  display: block;\x0d\n}\x0d\n.invisible {\x0d\n  visibility: hidden;\x0d\n}\x0d\n.navbar {\x0d\n  border-bottom: 1px solid #CACACA;\x0d\n}\x0d\n.navbar .navbar-inner {\x0d\n  -webkit-box-shadow: 0 1px 0 rgba(255, 255, 255, 0.4) ,  0 0 10px rgba(0, 0, 0, 0.1);\x0d\n  -moz-box-shadow: 0 1px 0 rgba(255, 255, 255, 0.4) ,  0 0 10px rgba(0, 0, 0, 0.1);\x0d\n  box-shadow: 0 1px 0 rgba(255, 255, 255, 0.4) ,  0 0 10px rgba(0, 0, 0, 0.1);\x0d\n}\x0d\n.navbar .brand {\x0d\n  font-weight: bold;\x0d\n}\x0d\n.navbar .brand:hover {\x0d\n  color: #4183c4;\x0d\n}\x0d\n.navbar .nav > li > a {\x0d\n  font-weight: bold;\x0d\n  text-shadow: 0 1px 0 rgba(255, 255, 255, 0.5);\x0d\n}\x0d\n.navbar .nav .active > a {\x0d\n  background-color: transparent;\x0d\n  color: #333333;\x0d\n}\x0d\n.navbar .nav .active > a:hover {\x0d\n  background-color: transparent;\x0d\n  color: #4183c4;\x0d\n}\x0d\n.navbar .nav > li > a:hover,\x0d\n.navbar .nav li.open.dropdown .dropdown-toggle {\x0d\n  color: #4183c4;\x0d\n}\x0d\n.navbar .nav .dropdown-toggle .caret {\x0d\n  border-top-color: #333333;\x0d\n  opacity: 1;\x0d\n}\x0d\n.navbar .navbar-search .search-query,\x0d\n.navbar .navbar-search .search-query:hover {\x0d\n  border: none;\x0d\n  color: #999999;\x0d\n  -webkit-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.5);\x0d\n  -moz-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.5);\x0d\n  box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.5);\x0d\n}\x0d\n.navbar .navbar-search .search-query :-moz-placeholder,\x0d\n.navbar .navbar-search .search-query:hover :-moz-placeholder {\x0d\n  color: #999999;\x0d\n}\x0d\n.navbar .navbar-search .search-query ::-webkit-input-placeholder,\x0d\n.navbar .navbar-search .search-query:hover ::-webkit-input-placeholder {\x0d\n  color: #999999;\x0d\n}\x0d\n.navbar .navbar-search .search-query:focus,\x0d\n.navbar .navbar-search .search-query:hover:focus,\x0d\n.navbar .navbar-search .search-query.focused,\x0d\n.navbar .navbar-search .search-query:hover.focused {\x0d\n  -webkit-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.5);\x0d\n  -moz-box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.5);\x0d\n  box-shadow: inset 0 1px 2px rgba(0, 0, 0, 0.5);\x0d\n  color: #333333;\x0d\n}\x0d\n.navbar .nav-collapse.in .navbar-search {\x0d\n  border-top: none;\x0d\n  border-bottom: none;\x0d\n}\x0d\n.navbar .nav-collapse.in > .nav li > a {\x0d\n  color: #333333;\x0d\n}\x0d\n.navbar .nav-collapse.in > .nav li > a .caret {\x0d\n  border-top-color: #999999;\x0d\n}\x0d\n.navbar .nav-collapse.in > .nav li > a:hover {\x0d\n  text-shadow: none;\x0d\n  color: #4183c4;\x0d\n  background-color: transparent;\x0d\n}\x0d\n.navbar .nav-collapse.in > .nav li > a:hover .caret {\x0d\n  border-top-color: #ffffff;\x0d\n}\x0d\n.nav li.open.dropdown .caret,\x0d\n.nav .dropdown-toggle:hover .caret {\x0d\n  border-top-color: #4183c4;\x0d\n}\x0d\ndiv.subnav .nav > li > a {\x0d\n  font-weight: bold;\x0d\n  color: #777;\x0d\n}\x0d\ndiv.subnav .nav > li > a:hover {\x0d\n  color: #4183c4;\x0d\n}\x0d\ndiv.subnav .nav > li.active > a {\x0d\n  color: #333333;\x0d\n}\x0d\ndiv.subnav .nav > li.active > a:hover {\x0d\n  color: #333333;\x0d\n}\x0d\ndiv.subnav .nav > li > .dropdown-toggle {\x0d\n  background-color: transparent;\x0d\n}\x0d\ndiv.subnav .nav > li.dropdown.open > .dropdown-toggle {\x0d\n  border-left: 1px solid whiteSmoke;\x0d\n  border-right: 1px solid #E5E5E5;\x0d\n  color: #4183c4;\x0d\n}\x0d\ndiv.subnav .nav > .open > .dropdown-toggle:hover .caret {\x0d\n  border-top-color: #4183c4;\x0d\n}\x0d\n.btn {\x0d\n  background-color: #f1f1f1;\x0d\n  background-image: -moz-linear-gradient(top, #f4f4f4, #ececec);\x0d\n  background-image: -ms-linear-gradient(top, #f4f4f4, #ececec);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#f4f4f4), to(#ececec));\x0d\n  background-image: -webkit-linear-gradient(top, #f4f4f4, #ececec);\x0d\n  background-image: -o-linear-gradient(top, #f4f4f4, #ececec);\x0d\n  background-image: linear-gradient(top, #f4f4f4, #ececec);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#f4f4f4', endColorstr='#ececec', GradientType=0);\x0d\n  border-color: #ececec #ececec #c6c6c6;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #ececec;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn:hover,\x0d\n.btn:active,\x0d\n.btn.active,\x0d\n.btn.disabled,\x0d\n.btn[disabled] {\x0d\n  background-color: #ececec;\x0d\n  *background-color: #dfdfdf;\x0d\n}\x0d\n.btn:active,\x0d\n.btn.active {\x0d\n  background-color: #d3d3d3 \\9;\x0d\n}\x0d\n.btn-primary {\x0d\n  background-color: #707070;\x0d\n  background-image: -moz-linear-gradient(top, #909090, #3f3f3f);\x0d\n  background-image: -ms-linear-gradient(top, #909090, #3f3f3f);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#909090), to(#3f3f3f));\x0d\n  background-image: -webkit-linear-gradient(top, #909090, #3f3f3f);\x0d\n  background-image: -o-linear-gradient(top, #909090, #3f3f3f);\x0d\n  background-image: linear-gradient(top, #909090, #3f3f3f);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#909090', endColorstr='#3f3f3f', GradientType=0);\x0d\n  border-color: #3f3f3f #3f3f3f #191919;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #3f3f3f;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-primary:hover,\x0d\n.btn-primary:active,\x0d\n.btn-primary.active,\x0d\n.btn-primary.disabled,\x0d\n.btn-primary[disabled] {\x0d\n  background-color: #3f3f3f;\x0d\n  *background-color: #323232;\x0d\n}\x0d\n.btn-primary:active,\x0d\n.btn-primary.active {\x0d\n  background-color: #262626 \\9;\x0d\n}\x0d\n.btn-warning {\x0d\n  background-color: #fbd627;\x0d\n  background-image: -moz-linear-gradient(top, #ffde42, #f4ca00);\x0d\n  background-image: -ms-linear-gradient(top, #ffde42, #f4ca00);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#ffde42), to(#f4ca00));\x0d\n  background-image: -webkit-linear-gradient(top, #ffde42, #f4ca00);\x0d\n  background-image: -o-linear-gradient(top, #ffde42, #f4ca00);\x0d\n  background-image: linear-gradient(top, #ffde42, #f4ca00);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#ffde42', endColorstr='#f4ca00', GradientType=0);\x0d\n  border-color: #f4ca00 #f4ca00 #a88b00;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #f4ca00;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-warning:hover,\x0d\n.btn-warning:active,\x0d\n.btn-warning.active,\x0d\n.btn-warning.disabled,\x0d\n.btn-warning[disabled] {\x0d\n  background-color: #f4ca00;\x0d\n  *background-color: #dbb500;\x0d\n}\x0d\n.btn-warning:active,\x0d\n.btn-warning.active {\x0d\n  background-color: #c1a000 \\9;\x0d\n}\x0d\n.btn-danger {\x0d\n  background-color: #e15454;\x0d\n  background-image: -moz-linear-gradient(top, #e56e6e, #da2d2d);\x0d\n  background-image: -ms-linear-gradient(top, #e56e6e, #da2d2d);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#e56e6e), to(#da2d2d));\x0d\n  background-image: -webkit-linear-gradient(top, #e56e6e, #da2d2d);\x0d\n  background-image: -o-linear-gradient(top, #e56e6e, #da2d2d);\x0d\n  background-image: linear-gradient(top, #e56e6e, #da2d2d);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#e56e6e', endColorstr='#da2d2d', GradientType=0);\x0d\n  border-color: #da2d2d #da2d2d #9f1c1c;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #da2d2d;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-danger:hover,\x0d\n.btn-danger:active,\x0d\n.btn-danger.active,\x0d\n.btn-danger.disabled,\x0d\n.btn-danger[disabled] {\x0d\n  background-color: #da2d2d;\x0d\n  *background-color: #ca2424;\x0d\n}\x0d\n.btn-danger:active,\x0d\n.btn-danger.active {\x0d\n  background-color: #b42020 \\9;\x0d\n}\x0d\n.btn-success {\x0d\n  background-color: #79cb5d;\x0d\n  background-image: -moz-linear-gradient(top, #8add6d, #60b044);\x0d\n  background-image: -ms-linear-gradient(top, #8add6d, #60b044);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#8add6d), to(#60b044));\x0d\n  background-image: -webkit-linear-gradient(top, #8add6d, #60b044);\x0d\n  background-image: -o-linear-gradient(top, #8add6d, #60b044);\x0d\n  background-image: linear-gradient(top, #8add6d, #60b044);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#8add6d', endColorstr='#60b044', GradientType=0);\x0d\n  border-color: #60b044 #60b044 #42792f;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #60b044;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-success:hover,\x0d\n.btn-success:active,\x0d\n.btn-success.active,\x0d\n.btn-success.disabled,\x0d\n.btn-success[disabled] {\x0d\n  background-color: #60b044;\x0d\n  *background-color: #569e3d;\x0d\n}\x0d\n.btn-success:active,\x0d\n.btn-success.active {\x0d\n  background-color: #4c8b36 \\9;\x0d\n}\x0d\n.btn-info {\x0d\n  background-color: #669dc7;\x0d\n  background-image: -moz-linear-gradient(top, #7caccf, #4488bb);\x0d\n  background-image: -ms-linear-gradient(top, #7caccf, #4488bb);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#7caccf), to(#4488bb));\x0d\n  background-image: -webkit-linear-gradient(top, #7caccf, #4488bb);\x0d\n  background-image: -o-linear-gradient(top, #7caccf, #4488bb);\x0d\n  background-image: linear-gradient(top, #7caccf, #4488bb);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#7caccf', endColorstr='#4488bb', GradientType=0);\x0d\n  border-color: #4488bb #4488bb #305f83;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #4488bb;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-info:hover,\x0d\n.btn-info:active,\x0d\n.btn-info.active,\x0d\n.btn-info.disabled,\x0d\n.btn-info[disabled] {\x0d\n  background-color: #4488bb;\x0d\n  *background-color: #3d7aa8;\x0d\n}\x0d\n.btn-info:active,\x0d\n.btn-info.active {\x0d\n  background-color: #366d96 \\9;\x0d\n}\x0d\n.btn-inverse {\x0d\n  background-color: #466274;\x0d\n  background-image: -moz-linear-gradient(top, #4a687a, #405a6a);\x0d\n  background-image: -ms-linear-gradient(top, #4a687a, #405a6a);\x0d\n  background-image: -webkit-gradient(linear, 0 0, 0 100%, from(#4a687a), to(#405a6a));\x0d\n  background-image: -webkit-linear-gradient(top, #4a687a, #405a6a);\x0d\n  background-image: -o-linear-gradient(top, #4a687a, #405a6a);\x0d\n  background-image: linear-gradient(top, #4a687a, #405a6a);\x0d\n  background-repeat: repeat-x;\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(startColorstr='#4a687a', endColorstr='#405a6a', GradientType=0);\x0d\n  border-color: #405a6a #405a6a #23323a;\x0d\n  border-color: rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.1) rgba(0, 0, 0, 0.25);\x0d\n  *background-color: #405a6a;\x0d\n  /* Darken IE7 buttons by default so they stand out more given they won't have borders */\x0d\n\x0d\n  filter: progid:DXImageTransform.Microsoft.gradient(enabled = false);\x0d\n}\x0d\n.btn-inverse:hover,\x0d\n.btn-inverse:active,\x0d\n.btn-inverse.active,\x0d\n.btn-inverse.disabled,\x0d\n.btn-inverse[disabled] {\x0d\n  background-color: #405a6a;\x0d\n  *background-color: #364d5a;\x0d\n}\x0d\n.btn-inverse:active,\x0d\n.btn-inverse.active {\x0d\n  background-color: #2d3f4a \\9;\x0d\n}\x0d\n.control-group.warning > label,\x0d\n.control-group.warning .help-block,\x0d\n.control-group.warning .help-inline {\x0d\n  color: #e29235;\x0d\n}\x0d\n.control-group.warning input,\x0d\n.control-group.warning select,\x0d\n.control-group.warning textarea {\x0d\n  color: #e29235;\x0d\n  border-color: #e29235;\x0d\n}\x0d\n.control-group.warning input:focus,\x0d\n.control-group.warning select:focus,\x0d\n.control-group.warning textarea:focus {\x0d\n  border-color: #c7781d;\x0d\n  -webkit-box-shadow: 0 0 6px #efc28e;\x0d\n  -moz-box-shadow: 0 0 6px #efc28e;\x0d\n  box-shadow: 0 0 6px #efc28e;\x0d\n}\x0d\n.control-group.warning .input-prepend .add-on,\x0d\n.control-group.warning .input-append .add-on {\x0d\n  color: #e29235;\x0d\n  background-color: #f5f3b4;\x0d\n  border-color: #e29235;\x0d\n}\x0d\n.control-group.error > label,\x0d\n.control-group.error .help-block,\x0d\n.control-group.error .help-inline {\x0d\n  color: #cc0000;\x0d\n}\x0d\n.control-group.error input,\x0d\n.control-group.error select,\x0d\n.control-group.error textarea {\x0d\n  color: #cc0000;\x0d\n  border-color: #cc0000;\x0d\n}\x0d\n.control-group.error input:focus,\x0d\n.control-group.error select:focus,\x0d\n.control-group.error textarea:focus {\x0d\n  border-color: #990000;\x0d\n  -webkit-box-shadow: 0 0 6px #ff3333;\x0d\n  -moz-box-shadow: 0 0 6px #ff3333;\x0d\n  box-shadow: 0 0 6px #ff3333;\x0d\n}\x0d\n.control-group.error .input-prepend .add-on,\x0d\n.control-group.error .input-append .add-on {\x0d\n  color: #cc0000;\x0d\n  background-color: #ffe9e9;\x0d\n  border-color: #cc0000;\x0d\n}\x0d\n.control-group.success > label,\x0d\n.control-group.success .help-block,\x0d\n.control-group.success .help-inline {\x0d\n  color: #2ba949;\x0d\n}\x0d\n.control-group.success input,\x0d\n.control-group.success select,\x0d\n.control-group.success textarea {\x0d\n  color: #2ba949;\x0d\n  border-color: #2ba949;\x0d\n}\x0d\n.control-group.success input:focus,\x0d\n.control-group.success select:focus,\x0d\n.control-group.success textarea:focus {\x0d\n  border-color: #218037;\x0d\n  -webkit-box-shadow: 0 0 6px #63d77e;\x0d\n  -moz-box-shadow: 0 0 6px #63d77e;\x0d\n  box-shadow: 0 0 6px #63d77e;\x0d\n}\x0d\n.control-group.success .input-prepend .add-on,\x0d\n.control-group.success .input-append .add-on {\x0d\n  color: #2ba949;\x0d\n  background-color: #bedebe;\x0d\n  border-color: #2ba949;\x0d\n}\x0d\n.label-important {\x0d\n  background-color: #BD2C00;\x0d\n}\x0d\n.label-warning {\x0d\n  background-color: #E3E84D;\x0d\n}\x0d\n.label-success {\x0d\n  background-color: #6CC644;\x0d\n}\x0d\n.label-info {\x0d\n  background-color: #4183C4;\x0d\n}\x0d\n.hero-unit {\x0d\n  -webkit-box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.05);\x0d\n  -moz-box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.05);\x0d\n  box-shadow: inset 0 1px 1px rgba(0, 0, 0, 0.05);\x0d\n  border: 1px solid rgba(0, 0, 0, 0.05);\x0d\n}\x0d\n.pull-right {\x0d\n  float: right;\x0d\n}\x0d\n.pull-left {\x0d\n  float: left;\x0d\n}\x0d\n.hide {\x0d\n  display: none;\x0d\n}\x0d\n.show {\x0d\n  display: block;\x0d\n}\x0d\n.invisible {\x0d\n  visibility: hidden;\x0d\n}\x0d\nPK\x07\x08l\xd0H>\xcf\xc3\x01\x00\xcf\xc3\x01\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x00\x00\x00bootstrap_alert.js/* ========================================================================\x0d\n * Bootstrap: alert.js v3.3.4\x0d\n * http://getbootstrap.com/javascript/#alerts\x0d\n * ========================================================================\x0d\n * Copyright 2011-2015 Twitter, Inc.\x0d\n * Licensed under MIT (https://github.com/twbs/bootstrap/blob/master/LICENSE)\x0d\n * ======================================================================== */\x0d\n\x0d\n\x0d\n+function ($) {\x0d\n  'use strict';\x0d\n\x0d\n  // ALERT CLASS DEFINITION\x0d\n  // ======================\x0d\n\x0d\n  var dismiss = '[data-dismiss=\"alert\"]'\x0d\n  var Alert   = function (el) {\x0d\n    $(el).on('click', dismiss, this.close)\x0d\n  }\x0d\n\x0d\n  Alert.VERSION = '3.3.4'\x0d\n\x0d\n  Alert.TRANSITION_DURATION = 150\x0d\n\x0d\n  Alert.prototype.close = function (e) {\x0d\n    var $this    = $(this)\x0d\n    var selector = $this.attr('data-target')\x0d\n\x0d\n    if (!selector) {\x0d\n      selector = $this.attr('href')\x0d\n      selector = selector && selector.replace(/.*(?=#[^\\s]*$)/, '') // strip for ie7\x0d\n    }\x0d\n\x0d\n    var $parent = $(selector)\x0d\n\x0d\n    if (e) e.preventDefault()\x0d\n\x0d\n    if (!$parent.length) {\x0d\n      $parent = $this.closest('.alert')\x0d\n    }\x0d\n\x0d\n    $parent.trigger(e = $.Event('close.bs.alert'))\x0d\n\x0d\n    if (e.isDefaultPrevented()) return\x0d\n\x0d\n    $parent.removeClass('in')\x0d\n\x0d\n    function removeElement() {\x0d\n      // detach from parent, fire event then clean up data\x0d\n      $parent.detach().trigger('closed.bs.alert').remove()\x0d\n    }\x0d\n\x0d\n    $.support.transition && $parent.hasClass('fade') ?\x0d\n      $parent\x0d\n        .one('bsTransitionEnd', removeElement)\x0d\n        .emulateTransitionEnd(Alert.TRANSITION_DURATION) :\x0d\n      removeElement()\x0d\n  }\x0d\n\x0d\n\x0d\n  // ALERT PLUGIN DEFINITION\x0d\n  // =======================\x0d\n\x0d\n  function Plugin(option) {\x0d\n    return this.each(function () {\x0d\n      var $this = $(this)\x0d\n      var data  = $this.data('bs.alert')\x0d\n\x0d\n      if (!data) $this.data('bs.alert', (data = new Alert(this)))\x0d\n      if (typeof option == 'string') data[option].call($this)\x0d\n    })\x0d\n  }\x0d\n\x0d\n  var old = $.fn.alert\x0d\n\x0d\n  $.fn.alert             = Plugin\x0d\n  $.fn.alert.Constructor = Alert\x0d\n\x0d\n\x0d\n  // ALERT NO CONFLICT\x0d\n  // =================\x0d\n\x0d\n  $.fn.alert.noConflict = function () {\x0d\n    $.fn.alert = old\x0d\n    return this\x0d\n  }\x0d\n\x0d\n\x0d\n  // ALERT DATA-API\x0d\n  // ==============\x0d\n\x0d\n  $(document).on('click.bs.alert.data-api', dismiss, Alert.prototype.close)\x0d\n\x0d\n}(jQuery);PK\x07\x08\x94\xb9%\x020	\x00\x000	\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x00\x00\x00bootstrap_modal.js/* =========================================================\x0d\n * bootstrap-modal.js v2.0.4\x0d\n * http://twitter.github.com/bootstrap/javascript.html#modals\x0d\n * =========================================================\x0d\n * Copyright 2012 Twitter, Inc.\x0d\n *\x0d\n * Licensed under the Apache License, Version 2.0 (the \"License\");\x0d\n * you may not use this file except in compliance with the License.\x0d\n * You may obtain a copy of the License at\x0d\n *\x0d\n * http://www.apache.org/licenses/LICENSE-2.0\x0d\n *\x0d\n * Unless required by applicable law or agreed to in writing, software\x0d\n * distributed under the License is distributed on an \"AS IS\" BASIS,\x0d\n * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.\x0d\n * See the License for the specific language governing permissions and\x0d\n * limitations under the License.\x0d\n * ========================================================= */\x0d\n\x0d\n\x0d\n!function ($) {\x0d\n\x0d\n  \"use strict\"; // jshint ;_;\x0d\n\x0d\n\x0d\n /* MODAL CLASS DEFINITION\x0d\n  * ====================== */\x0d\n\x0d\n  var Modal = function (content, options) {\x0d\n    this.options = options\x0d\n    this.$element = $(content)\x0d\n      .delegate('[data-dismiss=\"modal\"]', 'click.dismiss.modal', $.proxy(this.hide, this))\x0d\n  }\x0d\n\x0d\n  Modal.prototype = {\x0d\n\x0d\n      constructor: Modal\x0d\n\x0d\n    , toggle: function () {\x0d\n        return this[!this.isShown ? 'show' : 'hide']()\x0d\n      }\x0d\n\x0d\n    , show: function () {\x0d\n        var that = this\x0d\n          , e = $.Event('show')\x0d\n\x0d\n        this.$element.trigger(e)\x0d\n\x0d\n        if (this.isShown || e.isDefaultPrevented()) return\x0d\n\x0d\n        $('body').addClass('modal-open')\x0d\n\x0d\n        this.isShown = true\x0d\n\x0d\n        escape.call(this)\x0d\n        backdrop.call(this, function () {\x0d\n          var transition = $.support.transition && that.$element.hasClass('fade')\x0d\n\x0d\n          if (!that.$element.parent().length) {\x0d\n            that.$element.appendTo(document.body) //don't move modals dom position\x0d\n          }\x0d\n\x0d\n          that.$element\x0d\n            .show()\x0d\n\x0d\n          if (transition) {\x0d\n            that.$element[0].offsetWidth // force reflow\x0d\n          }\x0d\n\x0d\n          that.$element.addClass('in')\x0d\n\x0d\n          transition ?\x0d\n            that.$element.one($.support.transition.end, function () { that.$element.trigger('shown') }) :\x0d\n            that.$element.trigger('shown')\x0d\n\x0d\n        })\x0d\n      }\x0d\n\x0d\n    , hide: function (e) {\x0d\n        e && e.preventDefault()\x0d\n\x0d\n        var that = this\x0d\n\x0d\n        e = $.Event('hide')\x0d\n\x0d\n        this.$element.trigger(e)\x0d\n\x0d\n        if (!this.isShown || e.isDefaultPrevented()) return\x0d\n\x0d\n        this.isShown = false\x0d\n\x0d\n        $('body').removeClass('modal-open')\x0d\n\x0d\n        escape.call(this)\x0d\n\x0d\n        this.$element.removeClass('in')\x0d\n\x0d\n        $.support.transition && this.$element.hasClass('fade') ?\x0d\n          hideWithTransition.call(this) :\x0d\n          hideModal.call(this)\x0d\n      }\x0d\n\x0d\n  }\x0d\n\x0d\n\x0d\n /* MODAL PRIVATE METHODS\x0d\n  * ===================== */\x0d\n\x0d\n  function hideWithTransition() {\x0d\n    var that = this\x0d\n      , timeout = setTimeout(function () {\x0d\n          that.$element.off($.support.transition.end)\x0d\n          hideModal.call(that)\x0d\n        }, 500)\x0d\n\x0d\n    this.$element.one($.support.transition.end, function () {\x0d\n      clearTimeout(timeout)\x0d\n      hideModal.call(that)\x0d\n    })\x0d\n  }\x0d\n\x0d\n  function hideModal(that) {\x0d\n    this.$element\x0d\n      .hide()\x0d\n      .trigger('hidden')\x0d\n\x0d\n    backdrop.call(this)\x0d\n  }\x0d\n\x0d\n  function backdrop(callback) {\x0d\n    var that = this\x0d\n      , animate = this.$element.hasClass('fade') ? 'fade' : ''\x0d\n\x0d\n    if (this.isShown && this.options.backdrop) {\x0d\n      var doAnimate = $.support.transition && animate\x0d\n\x0d\n      this.$backdrop = $('<div class=\"modal-backdrop ' + animate + '\" />')\x0d\n        .appendTo(document.body)\x0d\n\x0d\n      if (this.options.backdrop != 'static') {\x0d\n        this.$backdrop.click($.proxy(this.hide, this))\x0d\n      }\x0d\n\x0d\n      if (doAnimate) this.$backdrop[0].offsetWidth // force reflow\x0d\n\x0d\n      this.$backdrop.addClass('in')\x0d\n\x0d\n      doAnimate ?\x0d\n        this.$backdrop.one($.support.transition.end, callback) :\x0d\n        callback()\x0d\n\x0d\n    } else if (!this.isShown && this.$backdrop) {\x0d\n      this.$backdrop.removeClass('in')\x0d\n\x0d\n      $.support.transition && this.$element.hasClass('fade')?\x0d\n        this.$backdrop.one($.support.transition.end, $.proxy(removeBackdrop, this)) :\x0d\n        removeBackdrop.call(this)\x0d\n\x0d\n    } else if (callback) {\x0d\n      callback()\x0d\n    }\x0d\n  }\x0d\n\x0d\n  function removeBackdrop() {\x0d\n    this.$backdrop.remove()\x0d\n    this.$backdrop = null\x0d\n  }\x0d\n\x0d\n  function escape() {\x0d\n    var that = this\x0d\n    if (this.isShown && this.options.keyboard) {\x0d\n      $(document).on('keyup.dismiss.modal', function ( e ) {\x0d\n        e.which == 27 && that.hide()\x0d\n      })\x0d\n    } else if (!this.isShown) {\x0d\n      $(document).off('keyup.dismiss.modal')\x0d\n    }\x0d\n  }\x0d\n\x0d\n\x0d\n /* MODAL PLUGIN DEFINITION\x0d\n  * ======================= */\x0d\n\x0d\n  $.fn.modal = function (option) {\x0d\n    return this.each(function () {\x0d\n      var $this = $(this)\x0d\n        , data = $this.data('modal')\x0d\n        , options = $.extend({}, $.fn.modal.defaults, $this.data(), typeof option == 'object' && option)\x0d\n      if (!data) $this.data('modal', (data = new Modal(this, options)))\x0d\n      if (typeof option == 'string') data[option]()\x0d\n      else if (options.show) data.show()\x0d\n    })\x0d\n  }\x0d\n\x0d\n  $.fn.modal.defaults = {\x0d\n      backdrop: true\x0d\n    , keyboard: true\x0d\n    , show: true\x0d\n  }\x0d\n\x0d\n  $.fn.modal.Constructor = Modal\x0d\n\x0d\n\x0d\n /* MODAL DATA-API\x0d\n  * ============== */\x0d\n\x0d\n  $(function () {\x0d\n    $('body').on('click.modal.data-api', '[data-toggle=\"modal\"]', function ( e ) {\x0d\n      var $this = $(this), href\x0d\n        , $target = $($this.attr('data-target') || (href = $this.attr('href')) && href.replace(/.*(?=#[^\\s]+$)/, '')) //strip for ie7\x0d\n        , option = $target.data('modal') ? 'toggle' : $.extend({}, $target.data(), $this.data())\x0d\n\x0d\n      e.preventDefault()\x0d\n      $target.modal(option)\x0d\n    })\x0d\n  })\x0d\n\x0d\n}(window.jQuery);PK\x07\x08	\xef\xa4\x8c\x06\x17\x00\x00\x06\x17\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x14\x00\x00\x00bootstrap_popover.js/* ===========================================================\x0d\n * bootstrap-popover.js v2.0.4\x0d\n * http://twitter.github.com/bootstrap/javascript.html#popovers\x0d\n * ===========================================================\x0d\n * Copyright 2012 Twitter, Inc.\x0d\n *\x0d\n * Licensed under the Apache License, Version 2.0 (the \"License\");\x0d\n * you may not use this file except in compliance with the License.\x0d\n * You may obtain a copy of the License at\x0d\n *\x0d\n * http://www.apache.org/licenses/LICENSE-2.0\x0d\n *\x0d\n * Unless required by applicable law or agreed to in writing, software\x0d\n * distributed under the License is distributed on an \"AS IS\" BASIS,\x0d\n * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.\x0d\n * See the License for the specific language governing permissions and\x0d\n * limitations under the License.\x0d\n * =========================================================== */\x0d\n\x0d\n\x0d\n!function ($) {\x0d\n\x0d\n  \"use strict\"; // jshint ;_;\x0d\n\x0d\n\x0d\n /* POPOVER PUBLIC CLASS DEFINITION\x0d\n  * =============================== */\x0d\n\x0d\n  var Popover = function ( element, options ) {\x0d\n    this.init('popover', element, options)\x0d\n  }\x0d\n\x0d\n\x0d\n  /* NOTE: POPOVER EXTENDS BOOTSTRAP-TOOLTIP.js\x0d\n     ========================================== */\x0d\n\x0d\n  Popover.prototype = $.extend({}, $.fn.tooltip.Constructor.prototype, {\x0d\n\x0d\n    constructor: Popover\x0d\n\x0d\n  , setContent: function () {\x0d\n      var $tip = this.tip()\x0d\n        , title = this.getTitle()\x0d\n        , content = this.getContent()\x0d\n\x0d\n      $tip.find('.popover-title')[this.isHTML(title) ? 'html' : 'text'](title)\x0d\n      $tip.find('.popover-content > *')[this.isHTML(content) ? 'html' : 'text'](content)\x0d\n\x0d\n      $tip.removeClass('fade top bottom left right in')\x0d\n    }\x0d\n\x0d\n  , hasContent: function () {\x0d\n      return this.getTitle() || this.getContent()\x0d\n    }\x0d\n\x0d\n  , getContent: function () {\x0d\n      var content\x0d\n        , $e = this.$element\x0d\n        , o = this.options\x0d\n\x0d\n      content = $e.attr('data-content')\x0d\n        || (typeof o.content == 'function' ? o.content.call($e[0]) :  o.content)\x0d\n\x0d\n      return content\x0d\n    }\x0d\n\x0d\n  , tip: function () {\x0d\n      if (!this.$tip) {\x0d\n        this.$tip = $(this.options.template)\x0d\n      }\x0d\n      return this.$tip\x0d\n    }\x0d\n\x0d\n  })\x0d\n\x0d\n\x0d\n /* POPOVER PLUGIN DEFINITION\x0d\n  * ======================= */\x0d\n\x0d\n  $.fn.popover = function (option) {\x0d\n    return this.each(function () {\x0d\n      var $this = $(this)\x0d\n        , data = $this.data('popover')\x0d\n        , options = typeof option == 'object' && option\x0d\n      if (!data) $this.data('popover', (data = new Popover(this, options)))\x0d\n      if (typeof option == 'string') data[option]()\x0d\n    })\x0d\n  }\x0d\n\x0d\n  $.fn.popover.Constructor = Popover\x0d\n\x0d\n  $.fn.popover.defaults = $.extend({} , $.fn.tooltip.defaults, {\x0d\n    placement: 'right'\x0d\n  , content: ''\x0d\n  , template: '<div class=\"popover\"><div class=\"arrow\"></div><div class=\"popover-inner\"><h3 class=\"popover-title\"></h3><div class=\"popover-content\"><p></p></div></div></div>'\x0d\n  })\x0d\n\x0d\n}(window.jQuery);PK\x07\x08\xa5\x93g\xf1\x9b\x0b\x00\x00\x9b\x0b\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00\x00\x00bootstrap_tab.js/* ========================================================\x0d\n * bootstrap-tab.js v2.0.4\x0d\n * http://twitter.github.com/bootstrap/javascript.html#tabs\x0d\n * ========================================================\x0d\n * Copyright 2012 Twitter, Inc.\x0d\n *\x0d\n * Licensed under the Apache License, Version 2.0 (the \"License\");\x0d\n * you may not use this file except in compliance with the License.\x0d\n * You may obtain a copy of the License at\x0d\n *\x0d\n * http://www.apache.org/licenses/LICENSE-2.0\x0d\n *\x0d\n * Unless required by applicable law or agreed to in writing, software\x0d\n * distributed under the License is distributed on an \"AS IS\" BASIS,\x0d\n * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.\x0d\n * See the License for the specific language governing permissions and\x0d\n * limitations under the License.\x0d\n * ======================================================== */\x0d\n\x0d\n\x0d\n!function ($) {\x0d\n\x0d\n  \"use strict\"; // jshint ;_;\x0d\n\x0d\n\x0d\n /* TAB CLASS DEFINITION\x0d\n  * ==================== */\x0d\n\x0d\n  var Tab = function ( element ) {\x0d\n    this.element = $(element)\x0d\n  }\x0d\n\x0d\n  Tab.prototype = {\x0d\n\x0d\n    constructor: Tab\x0d\n\x0d\n  , show: function () {\x0d\n      var $this = this.element\x0d\n        , $ul = $this.closest('ul:not(.dropdown-menu)')\x0d\n        , selector = $this.attr('data-target')\x0d\n        , previous\x0d\n        , $target\x0d\n        , e\x0d\n\x0d\n      if (!selector) {\x0d\n        selector = $this.attr('href')\x0d\n        selector = selector && selector.replace(/.*(?=#[^\\s]*$)/, '') //strip for ie7\x0d\n      }\x0d\n\x0d\n      if ( $this.parent('li').hasClass('active') ) return\x0d\n\x0d\n      previous = $ul.find('.active a').last()[0]\x0d\n\x0d\n      e = $.Event('show', {\x0d\n        relatedTarget: previous\x0d\n      })\x0d\n\x0d\n      $this.trigger(e)\x0d\n\x0d\n      if (e.isDefaultPrevented()) return\x0d\n\x0d\n      $target = $(selector)\x0d\n\x0d\n      this.activate($this.parent('li'), $ul)\x0d\n      this.activate($target, $target.parent(), function () {\x0d\n        $this.trigger({\x0d\n          type: 'shown'\x0d\n        , relatedTarget: previous\x0d\n        })\x0d\n      })\x0d\n    }\x0d\n\x0d\n  , activate: function ( element, container, callback) {\x0d\n      var $active = container.find('> .active')\x0d\n        , transition = callback\x0d\n            && $.support.transition\x0d\n            && $active.hasClass('fade')\x0d\n\x0d\n      function next() {\x0d\n        $active\x0d\n          .removeClass('active')\x0d\n          .find('> .dropdown-menu > .active')\x0d\n          .removeClass('active')\x0d\n\x0d\n        element.addClass('active')\x0d\n\x0d\n        if (transition) {\x0d\n          element[0].offsetWidth // reflow for transition\x0d\n          element.addClass('in')\x0d\n        } else {\x0d\n          element.removeClass('fade')\x0d\n        }\x0d\n\x0d\n        if ( element.parent('.dropdown-menu') ) {\x0d\n          element.closest('li.dropdown').addClass('active')\x0d\n        }\x0d\n\x0d\n        callback && callback()\x0d\n      }\x0d\n\x0d\n      transition ?\x0d\n        $active.one($.support.transition.end, next) :\x0d\n        next()\x0d\n\x0d\n      $active.removeClass('in')\x0d\n    }\x0d\n  }\x0d\n\x0d\n\x0d\n /* TAB PLUGIN DEFINITION\x0d\n  * ===================== */\x0d\n\x0d\n  $.fn.tab = function ( option ) {\x0d\n    return this.each(function () {\x0d\n      var $this = $(this)\x0d\n        , data = $this.data('tab')\x0d\n      if (!data) $this.data('tab', (data = new Tab(this)))\x0d\n      if (typeof option == 'string') data[option]()\x0d\n    })\x0d\n  }\x0d\n\x0d\n  $.fn.tab.Constructor = Tab\x0d\n\x0d\n\x0d\n /* TAB DATA-API\x0d\n  * ============ */\x0d\n\x0d\n  $(function () {\x0d\n    $('body').on('click.tab.data-api', '[data-toggle=\"tab\"], [data-toggle=\"pill\"]', function (e) {\x0d\n      e.preventDefault()\x0d\n      $(this).tab('show')\x0d\n    })\x0d\n  })\x0d\n\x0d\n}(window.jQuery);PK\x07\x088\x9e\x04|\xbe\x0d\x00\x00\xbe\x0d\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x14\x00\x00\x00bootstrap_tooltip.js/* ===========================================================\x0d\n * bootstrap-tooltip.js v2.0.4\x0d\n * http://twitter.github.com/bootstrap/javascript.html#tooltips\x0d\n * Inspired by the original jQuery.tipsy by Jason Frame\x0d\n * ===========================================================\x0d\n * Copyright 2012 Twitter, Inc.\x0d\n *\x0d\n * Licensed under the Apache License, Version 2.0 (the \"License\");\x0d\n * you may not use this file except in compliance with the License.\x0d\n * You may obtain a copy of the License at\x0d\n *\x0d\n * http://www.apache.org/licenses/LICENSE-2.0\x0d\n *\x0d\n * Unless required by applicable law or agreed to in writing, software\x0d\n * distributed under the License is distributed on an \"AS IS\" BASIS,\x0d\n * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.\x0d\n * See the License for the specific language governing permissions and\x0d\n * limitations under the License.\x0d\n * ========================================================== */\x0d\n\x0d\n\x0d\n!function ($) {\x0d\n\x0d\n  \"use strict\"; // jshint ;_;\x0d\n\x0d\n\x0d\n /* TOOLTIP PUBLIC CLASS DEFINITION\x0d\n  * =============================== */\x0d\n\x0d\n  var Tooltip = function (element, options) {\x0d\n    this.init('tooltip', element, options)\x0d\n  }\x0d\n\x0d\n  Tooltip.prototype = {\x0d\n\x0d\n    constructor: Tooltip\x0d\n\x0d\n  , init: function (type, element, options) {\x0d\n      var eventIn\x0d\n        , eventOut\x0d\n\x0d\n      this.type = type\x0d\n      this.$element = $(element)\x0d\n      this.options = this.getOptions(options)\x0d\n      this.enabled = true\x0d\n\x0d\n      if (this.options.trigger != 'manual') {\x0d\n        eventIn  = this.options.trigger == 'hover' ? 'mouseenter' : 'focus'\x0d\n        eventOut = this.options.trigger == 'hover' ? 'mouseleave' : 'blur'\x0d\n        this.$element.on(eventIn, this.options.selector, $.proxy(this.enter, this))\x0d\n        this.$element.on(eventOut, this.options.selector, $.proxy(this.leave, this))\x0d\n      }\x0d\n\x0d\n      this.options.selector ?\x0d\n        (this._options = $.extend({}, this.options, { trigger: 'manual', selector: '' })) :\x0d\n        this.fixTitle()\x0d\n    }\x0d\n\x0d\n  , getOptions: function (options) {\x0d\n      options = $.extend({}, $.fn[this.type].defaults, options, this.$element.data())\x0d\n\x0d\n      if (options.delay && typeof options.delay == 'number') {\x0d\n        options.delay = {\x0d\n          show: options.delay\x0d\n        , hide: options.delay\x0d\n        }\x0d\n      }\x0d\n\x0d\n      return options\x0d\n    }\x0d\n\x0d\n  , enter: function (e) {\x0d\n      var self = $(e.currentTarget)[this.type](this._options).data(this.type)\x0d\n\x0d\n      if (!self.options.delay || !self.options.delay.show) return self.show()\x0d\n\x0d\n      clearTimeout(this.timeout)\x0d\n      self.hoverState = 'in'\x0d\n      this.timeout = setTimeout(function() {\x0d\n        if (self.hoverState == 'in') self.show()\x0d\n      }, self.options.delay.show)\x0d\n    }\x0d\n\x0d\n  , leave: function (e) {\x0d\n      var self = $(e.currentTarget)[this.type](this._options).data(this.type)\x0d\n\x0d\n      if (this.timeout) clearTimeout(this.timeout)\x0d\n      if (!self.options.delay || !self.options.delay.hide) return self.hide()\x0d\n\x0d\n      self.hoverState = 'out'\x0d\n      this.timeout = setTimeout(function() {\x0d\n        if (self.hoverState == 'out') self.hide()\x0d\n      }, self.options.delay.hide)\x0d\n    }\x0d\n\x0d\n  , show: function () {\x0d\n      var $tip\x0d\n        , inside\x0d\n        , pos\x0d\n        , actualWidth\x0d\n        , actualHeight\x0d\n        , placement\x0d\n        , tp\x0d\n\x0d\n      if (this.hasContent() && this.enabled) {\x0d\n        $tip = this.tip()\x0d\n        this.setContent()\x0d\n\x0d\n        if (this.options.animation) {\x0d\n          $tip.addClass('fade')\x0d\n        }\x0d\n\x0d\n        placement = typeof this.options.placement == 'function' ?\x0d\n          this.options.placement.call(this, $tip[0], this.$element[0]) :\x0d\n          this.options.placement\x0d\n\x0d\n        inside = /in/.test(placement)\x0d\n\x0d\n        $tip\x0d\n          .remove()\x0d\n          .css({ top: 0, left: 0, display: 'block' })\x0d\n          .appendTo(inside ? this.$element : document.body)\x0d\n\x0d\n        pos = this.getPosition(inside)\x0d\n\x0d\n        actualWidth = $tip[0].offsetWidth\x0d\n        actualHeight = $tip[0].offsetHeight\x0d\n\x0d\n        switch (inside ? placement.split(' ')[1] : placement) {\x0d\n          case 'bottom':\x0d\n            tp = {top: pos.top + pos.height, left: pos.left + pos.width / 2 - actualWidth / 2}\x0d\n            break\x0d\n          case 'top':\x0d\n            tp = {top: pos.top - actualHeight, left: pos.left + pos.width / 2 - actualWidth / 2}\x0d\n            break\x0d\n          case 'left':\x0d\n            tp = {top: pos.top + pos.height / 2 - actualHeight / 2, left: pos.left - actualWidth}\x0d\n            break\x0d\n          case 'right':\x0d\n            tp = {top: pos.top + pos.height / 2 - actualHeight / 2, left: pos.left + pos.width}\x0d\n            break\x0d\n        }\x0d\n\x0d\n        $tip\x0d\n          .css(tp)\x0d\n          .addClass(placement)\x0d\n          .addClass('in')\x0d\n      }\x0d\n    }\x0d\n\x0d\n  , isHTML: function(text) {\x0d\n      // html string detection logic adapted from jQuery\x0d\n      return typeof text != 'string'\x0d\n        || ( text.charAt(0) === \"<\"\x0d\n          && text.charAt( text.length - 1 ) === \">\"\x0d\n          && text.length >= 3\x0d\n        ) || /^(?:[^<]*<[\\w\\W]+>[^>]*$)/.exec(text)\x0d\n    }\x0d\n\x0d\n  , setContent: function () {\x0d\n      var $tip = this.tip()\x0d\n        , title = this.getTitle()\x0d\n\x0d\n      $tip.find('.tooltip-inner')[this.isHTML(title) ? 'html' : 'text'](title)\x0d\n      $tip.removeClass('fade in top bottom left right')\x0d\n    }\x0d\n\x0d\n  , hide: function () {\x0d\n      var that = this\x0d\n        , $tip = this.tip()\x0d\n\x0d\n      $tip.removeClass('in')\x0d\n\x0d\n      function removeWithAnimation() {\x0d\n        var timeout = setTimeout(function () {\x0d\n          $tip.off($.support.transition.end).remove()\x0d\n        }, 500)\x0d\n\x0d\n        $tip.one($.support.transition.end, function () {\x0d\n          clearTimeout(timeout)\x0d\n          $tip.remove()\x0d\n        })\x0d\n      }\x0d\n\x0d\n      $.support.transition && this.$tip.hasClass('fade') ?\x0d\n        removeWithAnimation() :\x0d\n        $tip.remove()\x0d\n    }\x0d\n\x0d\n  , fixTitle: function () {\x0d\n      var $e = this.$element\x0d\n      if ($e.attr('title') || typeof($e.attr('data-original-title')) != 'string') {\x0d\n        $e.attr('data-original-title', $e.attr('title') || '').removeAttr('title')\x0d\n      }\x0d\n    }\x0d\n\x0d\n  , hasContent: function () {\x0d\n      return this.getTitle()\x0d\n    }\x0d\n\x0d\n  , getPosition: function (inside) {\x0d\n      return $.extend({}, (inside ? {top: 0, left: 0} : this.$element.offset()), {\x0d\n        width: this.$element[0].offsetWidth\x0d\n      , height: this.$element[0].offsetHeight\x0d\n      })\x0d\n    }\x0d\n\x0d\n  , getTitle: function () {\x0d\n      var title\x0d\n        , $e = this.$element\x0d\n        , o = this.options\x0d\n\x0d\n      title = $e.attr('data-original-title')\x0d\n        || (typeof o.title == 'function' ? o.title.call($e[0]) :  o.title)\x0d\n\x0d\n      return title\x0d\n    }\x0d\n\x0d\n  , tip: function () {\x0d\n      return this.$tip = this.$tip || $(this.options.template)\x0d\n    }\x0d\n\x0d\n  , validate: function () {\x0d\n      if (!this.$element[0].parentNode) {\x0d\n        this.hide()\x0d\n        this.$element = null\x0d\n        this.options = null\x0d\n      }\x0d\n    }\x0d\n\x0d\n  , enable: function () {\x0d\n      this.enabled = true\x0d\n    }\x0d\n\x0d\n  , disable: function () {\x0d\n      this.enabled = false\x0d\n    }\x0d\n\x0d\n  , toggleEnabled: function () {\x0d\n      this.enabled = !this.enabled\x0d\n    }\x0d\n\x0d\n  , toggle: function () {\x0d\n      this[this.tip().hasClass('in') ? 'hide' : 'show']()\x0d\n    }\x0d\n\x0d\n  }\x0d\n\x0d\n\x0d\n /* TOOLTIP PLUGIN DEFINITION\x0d\n  * ========================= */\x0d\n\x0d\n  $.fn.tooltip = function ( option ) {\x0d\n    return this.each(function () {\x0d\n      var $this = $(this)\x0d\n        , data = $this.data('tooltip')\x0d\n        , options = typeof option == 'object' && option\x0d\n      if (!data) $this.data('tooltip', (data = new Tooltip(this, options)))\x0d\n      if (typeof option == 'string') data[option]()\x0d\n    })\x0d\n  }\x0d\n\x0d\n  $.fn.tooltip.Constructor = Tooltip\x0d\n\x0d\n  $.fn.tooltip.defaults = {\x0d\n    animation: true\x0d\n  , placement: 'top'\x0d\n  , selector: false\x0d\n  , template: '<div class=\"tooltip\"><div class=\"tooltip-arrow\"></div><div class=\"tooltip-inner\"></div></div>'\x0d\n  , trigger: 'hover'\x0d\n  , title: ''\x0d\n  , delay: 0\x0d\n  }\x0d\n\x0d\n}(window.jQuery);PK\x07\x08\x06G\x1e\xcc\x0b\x1f\x00\x00\x0b\x1f\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\n\x00\x00\x00dj_mon.css/*= require 'dj_mon/bootstrap' */\x0d\n\x0d\nbody {\x0d\n  padding: 90px;\x0d\n}\x0d\n\x0d\n.container {\x0d\n  width: 980px;\x0d\n}\x0d\n\x0d\n.navbar .btn#settings {\x0d\n  margin: 8px 5px 5px;\x0d\n  padding: 1px 10px 1px;\x0d\n}\x0d\n\x0d\ntable#jobs-table td, table#jobs-table th {\x0d\n  text-align: center;\x0d\n}\x0d\n\x0d\ntable#jobs-table td.date, table#jobs-table th.date {\x0d\n  text-align: left;\x0d\n}\x0d\n\x0d\ntable#jobs-table td.date {\x0d\n  font-size: 80%;\x0d\n}\x0d\n\x0d\n.centered {\x0d\n  text-align: center;\x0d\n}\x0d\n\x0d\ncode.block {\x0d\n  display: block;\x0d\n  word-wrap: break-word;\x0d\n}\x0d\n\x0d\n#dj-counts-view {\x0d\n  position: relative;\x0d\n  top: 12px;\x0d\n  width: 400px;\x0d\n}\x0d\n\x0d\n#dj-counts-view .badge {\x0d\n  float: right;\x0d\n  margin: 0 2px;\x0d\n}\x0d\n\x0d\nform.form-inline {\x0d\n  display: inline;\x0d\n}PK\x07\x08A\x88\xe0%\xa6\x02\x00\x00\xa6\x02\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\x12S8G\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00	\x00\x00\x00dj_mon.js//= require dj_mon/bootstrap_tooltip\x0d\n//= require dj_mon/bootstrap_tab\x0d\n//= require dj_mon/bootstrap_popover\x0d\n//= require dj_mon/bootstrap_modal\x0d\n//= require dj_mon/mustache\x0d\n\x0d\n$(function(){\x0d\n\x0d\n  $('a[data-toggle=\"tab\"]').bind('shown', function(e) {\x0d\n    var currentTab = e.target;\x0d\n    var tabContent = $($(currentTab).attr('href'));\x0d\n    var dataUrl = tabContent.data('url');\x0d\n\x0d\n    $.getJSON(dataUrl).success(function(data){\x0d\n      var template = $('#dj_reports_template').html();\x0d\n      if(!! data && data.length > 0)\x0d\n        var output = Mustache.render(template, data);\x0d\n      else\x0d\n        var output = \"<div class='alert centered'>No Jobs</div>\";\x0d\n      tabContent.html(output);\x0d\n\x0d\n\x0d\n\x0d\n      $('form').submit(function(){\x0d\n          $.ajax({\x0d\n           url: $(this).attr('action'),\x0d\n           type:'post',           //\xe6\x95\xb0\xe6\x8d\xae\xe5\x8f\x91\xe9\x80\x81\xe6\x96\xb9\xe5\xbc\x8f\x0d\n           dataType:'json',      //\xe6\x8e\xa5\xe5\x8f\x97\xe6\x95\xb0\xe6\x8d\xae\xe6\xa0\xbc\xe5\xbc\x8f\x0d\n           data: {},             //\xe8\xa6\x81\xe4\xbc\xa0\xe9\x80\x92\xe7\x9a\x84\xe6\x95\xb0\xe6\x8d\xae\x0d\n           complete:function(resp){\x0d\n            var params = {level: \"success\",  data: resp.responseText}\x0d\n            if (resp.status != 200) {\x0d\n              params.level = \"warning\"\x0d\n            }\x0d\n\x0d\n            var template = $('#dj_message_template').html();\x0d\n            var output = Mustache.render(template, params);\x0d\n            $('#dj-message-view').html(output);\x0d\n\x0d\n            $('[data-dismiss=\"alert\"]').live('click', function(){\x0d\n              $('.alert').hide().remove();\x0d\n            });\x0d\n\x0d\n           } //\xe5\x9b\x9e\xe4\xbc\xa0\xe5\x87\xbd\xe6\x95\xb0(\xe8\xbf\x99\xe9\x87\x8c\xe6\x98\xaf\xe5\x87\xbd\xe6\x95\xb0\xe5\x90\x8d)\x0d\n         });\x0d\n         return false\x0d\n      });\x0d\n    });\x0d\n\x0d\n  })\x0d\n\x0d\n  $('.nav.nav-tabs li.active a[data-toggle=\"tab\"]').trigger('shown');\x0d\n\x0d\n  $('a[rel=popover]').live('mouseenter', function(){\x0d\n    $(this).popover('show');\x0d\n  });\x0d\n\x0d\n  $('a[rel=modal]').live('click', function(){\x0d\n    var template = $($(this).attr('href')).html();\x0d\n    var output = Mustache.render(template, { content: $(this).data('content') });\x0d\n    $(output).appendTo($('body')).show();\x0d\n  });\x0d\n\x0d\n  $('[data-dismiss=\"modal\"]').live('click', function(){\x0d\n    $('.modal').hide().remove();\x0d\n  });\x0d\n\x0d\n  (function refreshCount() {\x0d\n    $.getJSON(dj_counts_dj_reports_url).success(function(data){\x0d\n      var template = $('#dj_counts_template').html();\x0d\n      var output = Mustache.render(template, data);\x0d\n      $('#dj-counts-view').html(output);\x0d\n      setTimeout(refreshCount, 5000);\x0d\n    });\x0d\n  })();\x0d\n\x0d\n})PK\x07\x08\x99\xb0\x8b\x0eT	\x00\x00T	\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00pE\x8eG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\n\x00\x00\x00index.html<!DOCTYPE html>\x0d\n<html>\x0d\n\x0d\n<head lang='en'>\x0d\n    <link href=\"dj_mon.css\" media=\"screen, projection\" rel=\"stylesheet\" type=\"text/css\" />\x0d\n    <link href=\"bootstrap.css\" media=\"screen, projection\" rel=\"stylesheet\" type=\"text/css\" />\x0d\n\x0d\n    <script src=\"jquery.min.js\" type=\"text/javascript\"></script>\x0d\n    <script src=\"dj_mon.js\" type=\"text/javascript\"></script>\x0d\n    <script src=\"bootstrap_tooltip.js\" type=\"text/javascript\"></script>\x0d\n    <script src=\"bootstrap_tab.js\" type=\"text/javascript\"></script>\x0d\n    <script src=\"bootstrap_popover.js\" type=\"text/javascript\"></script>\x0d\n    <script src=\"bootstrap_modal.js\" type=\"text/javascript\"></script>\x0d\n    <script src=\"mustache.js\" type=\"text/javascript\"></script>\x0d\n</head>\x0d\n\x0d\n<body>\x0d\n    <header>\x0d\n        <div class='navbar navbar-fixed-top'>\x0d\n            <div class='navbar-inner'>\x0d\n                <div class='container'>\x0d\n                    <div class='pull-left'>\x0d\n                        <!-- <a href=\"http://github.com/runner-mei/delayed_job\" class=\"brand\">Delayed Job</a> -->\x0d\n                        Delayed Job\x0d\n                    </div>\x0d\n                    <div class='pull-right'>\x0d\n                        <a href=\"#dj_settings_template\" class=\"btn btn-primary btn-mini\" data-content=\"{&quot;destroy_failed_jobs&quot;:false,&quot;sleep_delay&quot;:5,&quot;max_attempts&quot;:1,&quot;max_run_time&quot;:14400,&quot;read_ahead&quot;:5,&quot;delay_jobs&quot;:true,&quot;delayed_job_version&quot;:&quot;3.0.3&quot;,&quot;dj_mon_version&quot;:&quot;1.1.0&quot;}\" id=\"settings\" rel=\"modal\">Settings</a>\x0d\n                    </div>\x0d\n                    <div class='pull-right'>\x0d\n                        <div id='dj-counts-view'></div>\x0d\n                    </div>\x0d\n                </div>\x0d\n            </div>\x0d\n        </div>\x0d\n    </header>\x0d\n    <div class='container centered'></div>\x0d\n    <div class='container centered' id=\"dj-message-view\"></div>\x0d\n    <div class='container'>\x0d\n        <p>\x0d\n            <div class='lead'>\x0d\n                Delayed Jobs\x0d\n            </div>\x0d\n        </p>\x0d\n        <ul class='nav nav-tabs'>\x0d\n            <li class='active'>\x0d\n                <a href=\"#all\" data-toggle=\"tab\">All</a>\x0d\n            </li>\x0d\n            <li>\x0d\n                <a href=\"#failed\" data-toggle=\"tab\">Failed</a>\x0d\n            </li>\x0d\n            <li>\x0d\n                <a href=\"#queued\" data-toggle=\"tab\">Queued</a>\x0d\n            </li>\x0d\n            <li>\x0d\n                <a href=\"#active\" data-toggle=\"tab\">Active</a>\x0d\n            </li>\x0d\n        </ul>\x0d\n        <div class='tab-content'>\x0d\n            <div class='tab-pane active' data-url='all' id='all'></div>\x0d\n            <div class='tab-pane' data-url='failed' id='failed'></div>\x0d\n            <div class='tab-pane' data-url='active' id='active'></div>\x0d\n            <div class='tab-pane' data-url='queued' id='queued'></div>\x0d\n        </div>\x0d\n        <script id='dj_reports_template' type='text/x-handlebars-template'>\x0d\n        <table class='table table-striped' id='jobs-table'>\x0d\n        <thead>\x0d\n          <tr>\x0d\n          <th>Queue</th>\x0d\n          <th>ID</th>\x0d\n          <th>Priority</th>\x0d\n          <th>Attempts</th>\x0d\n          <th>Last Error</th>\x0d\n          <th class='date'>Run at</th>\x0d\n          <th class='date'>Created at</th>\x0d\n          <th class='date'>Failed at</th>\x0d\n          </tr>\x0d\n        </thead>\x0d\n        <tbody>\x0d\n          {{#.}}\x0d\n          <tr>\x0d\n            <td><div class='label label-info'>{{queue}}</div></td>\x0d\n            <td> <a href=\"#\" data-content=\"<code class='block'>{{payload}}</code>\" rel='popover' title='Payload'> {{id}} </a> </td>\x0d\n            <td> {{priority}} </td>\x0d\n            <td> {{attempts}} </td>\x0d\n            <td> <a href=\"#last_error_template\" data-content=\"{{last_error}}\" rel='modal' title='Last Error'> {{last_error_summary}} </a> </td>\x0d\n            <td class='date'> {{run_at}} </td>\x0d\n            <td class='date'> {{created_at}} </td>\x0d\n            <td class='date'>\x0d\n              {{#failed}}\x0d\n              {{failed_at}}\x0d\n              <form accept-charset=\"UTF-8\" action=\"delayed_jobs/{{id}}/retry\" class=\"form-inline\" method=\"post\"><div style=\"margin:0;padding:0;display:inline\">\x0d\n                <input name=\"utf8\" type=\"hidden\" value=\"&#x2713;\" />\x0d\n                <input name=\"authenticity_token\" type=\"hidden\" value=\"iObCtI46KYbhjIJCA4w01FI/nkV6PQyRxJkkSympj8A=\" /></div>\x0d\n                <input class=\"btn btn-info btn-mini\" name=\"commit\" type=\"submit\" value=\"Retry\" />\x0d\n              </form>\x0d\n\x0d\n              <form accept-charset=\"UTF-8\" action=\"delayed_jobs/{{id}}/delete\" class=\"form-inline\" method=\"post\">\x0d\n                <div style=\"margin:0;padding:0;display:inline\"><input name=\"utf8\" type=\"hidden\" value=\"&#x2713;\" />\x0d\n                  <input name=\"_method\" type=\"hidden\" value=\"delete\" />\x0d\n                  <input name=\"authenticity_token\" type=\"hidden\" value=\"iObCtI46KYbhjIJCA4w01FI/nkV6PQyRxJkkSympj8A=\" />\x0d\n                </div>\x0d\n                <input class=\"btn btn-danger btn-mini\" name=\"commit\" type=\"submit\" value=\"Delete\" />\x0d\n              </form>\x0d\n              {{/failed}}\x0d\n            </td>\x0d\n          </tr>\x0d\n          {{/.}}\x0d\n        </tbody>\x0d\n        </table>\x0d\n        </script>\x0d\n        <script id='last_error_template' type='text/x-handlebars-template'>\x0d\n        <div class='modal hide'>\x0d\n          <div class='modal-header'>\x0d\n          <button class='close' data-dismiss='modal' type='button'>\xc3\x97</button>\x0d\n          <h3>Last Error</h3>\x0d\n          </div>\x0d\n\x0d\n          <div class='modal-body'><code>{{content}}</code></div>\x0d\n          <div class='modal-footer'>\x0d\n            <a href=\"#\" class=\"btn btn-primary\" data-dismiss=\"modal\">Close</a>\x0d\n          </div>\x0d\n        </div>\x0d\n        </script>\x0d\n    </div>\x0d\n  \x0d\n\x0d\n  <script>\x0d\n  var dj_counts_dj_reports_url = \"counts\"\x0d\n  </script>\x0d\n\x0d\n\x0d\n  <script id='dj_message_template' type='text/x-handlebars-template'>\x0d\n    <div class=\"alert alert-{{level}} alert-dismissible\" role=\"alert\">\x0d\n      <button type=\"button\" class=\"close\" data-dismiss=\"alert\" aria-label=\"Close\"><span aria-hidden=\"true\">&times;</span></button>\x0d\n      {{data}}\x0d\n    </div>\x0d\n  </script>\x0d\n\x0d\n  <script id='dj_counts_template' type='text/x-handlebars-template'>\x0d\n    <span class='badge badge-warning'> {{failed}} failed </span>\x0d\n    <span class='badge badge-info'> {{queued}} queued </span>\x0d\n    <span class='badge badge-info'> {{active}} active </span>\x0d\n    <span class='badge badge-info'> {{all}} all </span>\x0d\n  </script>\x0d\n\x0d\n  <script id='dj_settings_template' type='text/x-handlebars-template'>\x0d\n    <div class='modal hide'>\x0d\n      <div class='modal-header'>\x0d\n        <button class='close' data-dismiss='modal' type='button'>\xc3\x97</button>\x0d\n        <h3> Settings </h3>\x0d\n      </div>\x0d\n\x0d\n      <div class='modal-body'>\x0d\n        <table class='table table-bordered table-striped'>\x0d\n          <tr>\x0d\n            <td>Delayed Job version</td>\x0d\n            <td><code>{{content.delayed_job_version}}</code></td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>DJ Mon version</td>\x0d\n            <td><code>{{content.dj_mon_version}}</code></td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>Destroy failed jobs</td>\x0d\n            <td><code>{{content.destroy_failed_jobs}}</code></td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>Sleep delay</td>\x0d\n            <td><code>{{content.sleep_delay}}</code> seconds</td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>Max attempts</td>\x0d\n            <td><code>{{content.max_attempts}}</code></td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>Max run time</td>\x0d\n            <td><code>{{content.max_run_time}}</code> seconds</td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>Read ahead</td>\x0d\n            <td><code>{{content.read_ahead}}</code></td>\x0d\n          </tr>\x0d\n          <tr>\x0d\n            <td>Delay Jobs</td>\x0d\n            <td><code>{{content.delay_jobs}}</code></td>\x0d\n          </tr>\x0d\n        </table>\x0d\n      </div>\x0d\n      <div class='modal-footer'> <a href=\"#\" class=\"btn btn-primary\" data-dismiss=\"modal\">Close</a> </div>\x0d\n    </div>\x0d\n  </script>\x0d\n</body>\x0d\n\x0d\n</html>PK\x07\x08W\xe2\x0c\x82U\x1f\x00\x00U\x1f\x00\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00\x00\x00jquery.min.js/*! jQuery v1.7.2 jquery.com | jquery.org/license */\x0d\n(function(a,b){function cy(a){return f.isWindow(a)?a:a.nodeType===9?a.defaultView||a.parentWindow:!1}function cu(a){if(!cj[a]){var b=c.body,d=f(\"<\"+a+\">\").appendTo(b),e=d.css(\"display\");d.remove();if(e===\"none\"||e===\"\"){ck||(ck=c.createElement(\"iframe\"),ck.frameBorder=ck.width=ck.height=0),b.appendChild(ck);if(!cl||!ck.createElement)cl=(ck.contentWindow||ck.contentDocument).document,cl.write((f.support.boxModel?\"<!doctype html>\":\"\")+\"<html><body>\"),cl.close();d=cl.createElement(a),cl.body.appendChild(d),e=f.css(d,\"display\"),b.removeChild(ck)}cj[a]=e}return cj[a]}function ct(a,b){var c={};f.each(cp.concat.apply([],cp.slice(0,b)),function(){c[this]=a});return c}function cs(){cq=b}function cr(){setTimeout(cs,0);return cq=f.now()}function ci(){try{return new a.ActiveXObject(\"Microsoft.XMLHTTP\")}catch(b){}}function ch(){try{return new a.XMLHttpRequest}catch(b){}}function cb(a,c){a.dataFilter&&(c=a.dataFilter(c,a.dataType));var d=a.dataTypes,e={},g,h,i=d.length,j,k=d[0],l,m,n,o,p;for(g=1;g<i;g++){if(g===1)for(h in a.converters)typeof h==\"string\"&&(e[h.toLowerCase()]=a.converters[h]);l=k,k=d[g];if(k===\"*\")k=l;else if(l!==\"*\"&&l!==k){m=l+\" \"+k,n=e[m]||e[\"* \"+k];if(!n){p=b;for(o in e){j=o.split(\" \");if(j[0]===l||j[0]===\"*\"){p=e[j[1]+\" \"+k];if(p){o=e[o],o===!0?n=p:p===!0&&(n=o);break}}}}!n&&!p&&f.error(\"No conversion from \"+m.replace(\" \",\" to \")),n!==!0&&(c=n?n(c):p(o(c)))}}return c}function ca(a,c,d){var e=a.contents,f=a.dataTypes,g=a.responseFields,h,i,j,k;for(i in g)i in d&&(c[g[i]]=d[i]);while(f[0]===\"*\")f.shift(),h===b&&(h=a.mimeType||c.getResponseHeader(\"content-type\"));if(h)for(i in e)if(e[i]&&e[i].test(h)){f.unshift(i);break}if(f[0]in d)j=f[0];else{for(i in d){if(!f[0]||a.converters[i+\" \"+f[0]]){j=i;break}k||(k=i)}j=j||k}if(j){j!==f[0]&&f.unshift(j);return d[j]}}function b_(a,b,c,d){if(f.isArray(b))f.each(b,function(b,e){c||bD.test(a)?d(a,e):b_(a+\"[\"+(typeof e==\"object\"?b:\"\")+\"]\",e,c,d)});else if(!c&&f.type(b)===\"object\")for(var e in b)b_(a+\"[\"+e+\"]\",b[e],c,d);else d(a,b)}function b$(a,c){var d,e,g=f.ajaxSettings.flatOptions||{};for(d in c)c[d]!==b&&((g[d]?a:e||(e={}))[d]=c[d]);e&&f.extend(!0,a,e)}function bZ(a,c,d,e,f,g){f=f||c.dataTypes[0],g=g||{},g[f]=!0;var h=a[f],i=0,j=h?h.length:0,k=a===bS,l;for(;i<j&&(k||!l);i++)l=h[i](c,d,e),typeof l==\"string\"&&(!k||g[l]?l=b:(c.dataTypes.unshift(l),l=bZ(a,c,d,e,l,g)));(k||!l)&&!g[\"*\"]&&(l=bZ(a,c,d,e,\"*\",g));return l}function bY(a){return function(b,c){typeof b!=\"string\"&&(c=b,b=\"*\");if(f.isFunction(c)){var d=b.toLowerCase().split(bO),e=0,g=d.length,h,i,j;for(;e<g;e++)h=d[e],j=/^\\+/.test(h),j&&(h=h.substr(1)||\"*\"),i=a[h]=a[h]||[],i[j?\"unshift\":\"push\"](c)}}}function bB(a,b,c){var d=b===\"width\"?a.offsetWidth:a.offsetHeight,e=b===\"width\"?1:0,g=4;if(d>0){if(c!==\"border\")for(;e<g;e+=2)c||(d-=parseFloat(f.css(a,\"padding\"+bx[e]))||0),c===\"margin\"?d+=parseFloat(f.css(a,c+bx[e]))||0:d-=parseFloat(f.css(a,\"border\"+bx[e]+\"Width\"))||0;return d+\"px\"}d=by(a,b);if(d<0||d==null)d=a.style[b];if(bt.test(d))return d;d=parseFloat(d)||0;if(c)for(;e<g;e+=2)d+=parseFloat(f.css(a,\"padding\"+bx[e]))||0,c!==\"padding\"&&(d+=parseFloat(f.css(a,\"border\"+bx[e]+\"Width\"))||0),c===\"margin\"&&(d+=parseFloat(f.css(a,c+bx[e]))||0);return d+\"px\"}function bo(a){var b=c.createElement(\"div\");bh.appendChild(b),b.innerHTML=a.outerHTML;return b.firstChild}function bn(a){var b=(a.nodeName||\"\").toLowerCase();b===\"input\"?bm(a):b!==\"script\"&&typeof a.getElementsByTagName!=\"undefined\"&&f.grep(a.getElementsByTagName(\"input\"),bm)}function bm(a){if(a.type===\"checkbox\"||a.type===\"radio\")a.defaultChecked=a.checked}function bl(a){return typeof a.getElementsByTagName!=\"undefined\"?a.getElementsByTagName(\"*\"):typeof a.querySelectorAll!=\"undefined\"?a.querySelectorAll(\"*\"):[]}function bk(a,b){var c;b.nodeType===1&&(b.clearAttributes&&b.clearAttributes(),b.mergeAttributes&&b.mergeAttributes(a),c=b.nodeName.toLowerCase(),c===\"object\"?b.outerHTML=a.outerHTML:c!==\"input\"||a.type!==\"checkbox\"&&a.type!==\"radio\"?c===\"option\"?b.selected=a.defaultSelected:c===\"input\"||c===\"textarea\"?b.defaultValue=a.defaultValue:c===\"script\"&&b.text!==a.text&&(b.text=a.text):(a.checked&&(b.defaultChecked=b.checked=a.checked),b.value!==a.value&&(b.value=a.value)),b.removeAttribute(f.expando),b.removeAttribute(\"_submit_attached\"),b.removeAttribute(\"_change_attached\"))}function bj(a,b){if(b.nodeType===1&&!!f.hasData(a)){var c,d,e,g=f._data(a),h=f._data(b,g),i=g.events;if(i){delete h.handle,h.events={};for(c in i)for(d=0,e=i[c].length;d<e;d++)f.event.add(b,c,i[c][d])}h.data&&(h.data=f.extend({},h.data))}}function bi(a,b){return f.nodeName(a,\"table\")?a.getElementsByTagName(\"tbody\")[0]||a.appendChild(a.ownerDocument.createElement(\"tbody\")):a}function U(a){var b=V.split(\"|\"),c=a.createDocumentFragment();if(c.createElement)while(b.length)c.createElement(b.pop());return c}function T(a,b,c){b=b||0;if(f.isFunction(b))return f.grep(a,function(a,d){var e=!!b.call(a,d,a);return e===c});if(b.nodeType)return f.grep(a,function(a,d){return a===b===c});if(typeof b==\"string\"){var d=f.grep(a,function(a){return a.nodeType===1});if(O.test(b))return f.filter(b,d,!c);b=f.filter(b,d)}return f.grep(a,function(a,d){return f.inArray(a,b)>=0===c})}function S(a){return!a||!a.parentNode||a.parentNode.nodeType===11}function K(){return!0}function J(){return!1}function n(a,b,c){var d=b+\"defer\",e=b+\"queue\",g=b+\"mark\",h=f._data(a,d);h&&(c===\"queue\"||!f._data(a,e))&&(c===\"mark\"||!f._data(a,g))&&setTimeout(function(){!f._data(a,e)&&!f._data(a,g)&&(f.removeData(a,d,!0),h.fire())},0)}function m(a){for(var b in a){if(b===\"data\"&&f.isEmptyObject(a[b]))continue;if(b!==\"toJSON\")return!1}return!0}function l(a,c,d){if(d===b&&a.nodeType===1){var e=\"data-\"+c.replace(k,\"-$1\").toLowerCase();d=a.getAttribute(e);if(typeof d==\"string\"){try{d=d===\"true\"?!0:d===\"false\"?!1:d===\"null\"?null:f.isNumeric(d)?+d:j.test(d)?f.parseJSON(d):d}catch(g){}f.data(a,c,d)}else d=b}return d}function h(a){var b=g[a]={},c,d;a=a.split(/\\s+/);for(c=0,d=a.length;c<d;c++)b[a[c]]=!0;return b}var c=a.document,d=a.navigator,e=a.location,f=function(){function J(){if(!e.isReady){try{c.documentElement.doScroll(\"left\")}catch(a){setTimeout(J,1);return}e.ready()}}var e=function(a,b){return new e.fn.init(a,b,h)},f=a.jQuery,g=a.$,h,i=/^(?:[^#<]*(<[\\w\\W]+>)[^>]*$|#([\\w\\-]*)$)/,j=/\\S/,k=/^\\s+/,l=/\\s+$/,m=/^<(\\w+)\\s*\\/?>(?:<\\/\\1>)?$/,n=/^[\\],:{}\\s]*$/,o=/\\\\(?:[\"\\\\\\/bfnrt]|u[0-9a-fA-F]{4})/g,p=/\"[^\"\\\\\\n\\r]*\"|true|false|null|-?\\d+(?:\\.\\d*)?(?:[eE][+\\-]?\\d+)?/g,q=/(?:^|:|,)(?:\\s*\\[)+/g,r=/(webkit)[ \\/]([\\w.]+)/,s=/(opera)(?:.*version)?[ \\/]([\\w.]+)/,t=/(msie) ([\\w.]+)/,u=/(mozilla)(?:.*? rv:([\\w.]+))?/,v=/-([a-z]|[0-9])/ig,w=/^-ms-/,x=function(a,b){return(b+\"\").toUpperCase()},y=d.userAgent,z,A,B,C=Object.prototype.toString,D=Object.prototype.hasOwnProperty,E=Array.prototype.push,F=Array.prototype.slice,G=String.prototype.trim,H=Array.prototype.indexOf,I={};e.fn=e.prototype={constructor:e,init:function(a,d,f){var g,h,j,k;if(!a)return this;if(a.nodeType){this.context=this[0]=a,this.length=1;return this}if(a===\"body\"&&!d&&c.body){this.context=c,this[0]=c.body,this.selector=a,this.length=1;return this}if(typeof a==\"string\"){a.charAt(0)!==\"<\"||a.charAt(a.length-1)!==\">\"||a.length<3?g=i.exec(a):g=[null,a,null];if(g&&(g[1]||!d)){if(g[1]){d=d instanceof e?d[0]:d,k=d?d.ownerDocument||d:c,j=m.exec(a),j?e.isPlainObject(d)?(a=[c.createElement(j[1])],e.fn.attr.call(a,d,!0)):a=[k.createElement(j[1])]:(j=e.buildFragment([g[1]],[k]),a=(j.cacheable?e.clone(j.fragment):j.fragment).childNodes);return e.merge(this,a)}h=c.getElementById(g[2]);if(h&&h.parentNode){if(h.id!==g[2])return f.find(a);this.length=1,this[0]=h}this.context=c,this.selector=a;return this}return!d||d.jquery?(d||f).find(a):this.constructor(d).find(a)}if(e.isFunction(a))return f.ready(a);a.selector!==b&&(this.selector=a.selector,this.context=a.context);return e.makeArray(a,this)},selector:\"\",jquery:\"1.7.2\",length:0,size:function(){return this.length},toArray:function(){return F.call(this,0)},get:function(a){return a==null?this.toArray():a<0?this[this.length+a]:this[a]},pushStack:function(a,b,c){var d=this.constructor();e.isArray(a)?E.apply(d,a):e.merge(d,a),d.prevObject=this,d.context=this.context,b===\"find\"?d.selector=this.selector+(this.selector?\" \":\"\")+c:b&&(d.selector=this.selector+\".\"+b+\"(\"+c+\")\");return d},each:function(a,b){return e.each(this,a,b)},ready:function(a){e.bindReady(),A.add(a);return this},eq:function(a){a=+a;return a===-1?this.slice(a):this.slice(a,a+1)},first:function(){return this.eq(0)},last:function(){return this.eq(-1)},slice:function(){return this.pushStack(F.apply(this,arguments),\"slice\",F.call(arguments).join(\",\"))},map:function(a){return this.pushStack(e.map(this,function(b,c){return a.call(b,c,b)}))},end:function(){return this.prevObject||this.constructor(null)},push:E,sort:[].sort,splice:[].splice},e.fn.init.prototype=e.fn,e.extend=e.fn.extend=function(){var a,c,d,f,g,h,i=arguments[0]||{},j=1,k=arguments.length,l=!1;typeof i==\"boolean\"&&(l=i,i=arguments[1]||{},j=2),typeof i!=\"object\"&&!e.isFunction(i)&&(i={}),k===j&&(i=this,--j);for(;j<k;j++)if((a=arguments[j])!=null)for(c in a){d=i[c],f=a[c];if(i===f)continue;l&&f&&(e.isPlainObject(f)||(g=e.isArray(f)))?(g?(g=!1,h=d&&e.isArray(d)?d:[]):h=d&&e.isPlainObject(d)?d:{},i[c]=e.extend(l,h,f)):f!==b&&(i[c]=f)}return i},e.extend({noConflict:function(b){a.$===e&&(a.$=g),b&&a.jQuery===e&&(a.jQuery=f);return e},isReady:!1,readyWait:1,holdReady:function(a){a?e.readyWait++:e.ready(!0)},ready:function(a){if(a===!0&&!--e.readyWait||a!==!0&&!e.isReady){if(!c.body)return setTimeout(e.ready,1);e.isReady=!0;if(a!==!0&&--e.readyWait>0)return;A.fireWith(c,[e]),e.fn.trigger&&e(c).trigger(\"ready\").off(\"ready\")}},bindReady:function(){if(!A){A=e.Callbacks(\"once memory\");if(c.readyState===\"complete\")return setTimeout(e.ready,1);if(c.addEventListener)c.addEventListener(\"DOMContentLoaded\",B,!1),a.addEventListener(\"load\",e.ready,!1);else if(c.attachEvent){c.attachEvent(\"onreadystatechange\",B),a.attachEvent(\"onload\",e.ready);var b=!1;try{b=a.frameElement==null}catch(d){}c.documentElement.doScroll&&b&&J()}}},isFunction:function(a){return e.type(a)===\"function\"},isArray:Array.isArray||function(a){return e.type(a)===\"array\"},isWindow:function(a){return a!=null&&a==a.window},isNumeric:function(a){return!isNaN(parseFloat(a))&&isFinite(a)},type:function(a){return a==null?String(a):I[C.call(a)]||\"object\"},isPlainObject:function(a){if(!a||e.type(a)!==\"object\"||a.nodeType||e.isWindow(a))return!1;try{if(a.constructor&&!D.call(a,\"constructor\")&&!D.call(a.constructor.prototype,\"isPrototypeOf\"))return!1}catch(c){return!1}var d;for(d in a);return d===b||D.call(a,d)},isEmptyObject:function(a){for(var b in a)return!1;return!0},error:function(a){throw new Error(a)},parseJSON:function(b){if(typeof b!=\"string\"||!b)return null;b=e.trim(b);if(a.JSON&&a.JSON.parse)return a.JSON.parse(b);if(n.test(b.replace(o,\"@\").replace(p,\"]\").replace(q,\"\")))return(new Function(\"return \"+b))();e.error(\"Invalid JSON: \"+b)},parseXML:function(c){if(typeof c!=\"string\"||!c)return null;var d,f;try{a.DOMParser?(f=new DOMParser,d=f.parseFromString(c,\"text/xml\")):(d=new ActiveXObject(\"Microsoft.XMLDOM\"),d.async=\"false\",d.loadXML(c))}catch(g){d=b}(!d||!d.documentElement||d.getElementsByTagName(\"parsererror\").length)&&e.error(\"Invalid XML: \"+c);return d},noop:function(){},globalEval:function(b){b&&j.test(b)&&(a.execScript||function(b){a.eval.call(a,b)})(b)},camelCase:function(a){return a.replace(w,\"ms-\").replace(v,x)},nodeName:function(a,b){return a.nodeName&&a.nodeName.toUpperCase()===b.toUpperCase()},each:function(a,c,d){var f,g=0,h=a.length,i=h===b||e.isFunction(a);if(d){if(i){for(f in a)if(c.apply(a[f],d)===!1)break}else for(;g<h;)if(c.apply(a[g++],d)===!1)break}else if(i){for(f in a)if(c.call(a[f],f,a[f])===!1)break}else for(;g<h;)if(c.call(a[g],g,a[g++])===!1)break;return a},trim:G?function(a){return a==null?\"\":G.call(a)}:function(a){return a==null?\"\":(a+\"\").replace(k,\"\").replace(l,\"\")},makeArray:function(a,b){var c=b||[];if(a!=null){var d=e.type(a);a.length==null||d===\"string\"||d===\"function\"||d===\"regexp\"||e.isWindow(a)?E.call(c,a):e.merge(c,a)}return c},inArray:function(a,b,c){var d;if(b){if(H)return H.call(b,a,c);d=b.length,c=c?c<0?Math.max(0,d+c):c:0;for(;c<d;c++)if(c in b&&b[c]===a)return c}return-1},merge:function(a,c){var d=a.length,e=0;if(typeof c.length==\"number\")for(var f=c.length;e<f;e++)a[d++]=c[e];else while(c[e]!==b)a[d++]=c[e++];a.length=d;return a},grep:function(a,b,c){var d=[],e;c=!!c;for(var f=0,g=a.length;f<g;f++)e=!!b(a[f],f),c!==e&&d.push(a[f]);return d},map:function(a,c,d){var f,g,h=[],i=0,j=a.length,k=a instanceof e||j!==b&&typeof j==\"number\"&&(j>0&&a[0]&&a[j-1]||j===0||e.isArray(a));if(k)for(;i<j;i++)f=c(a[i],i,d),f!=null&&(h[h.length]=f);else for(g in a)f=c(a[g],g,d),f!=null&&(h[h.length]=f);return h.concat.apply([],h)},guid:1,proxy:function(a,c){if(typeof c==\"string\"){var d=a[c];c=a,a=d}if(!e.isFunction(a))return b;var f=F.call(arguments,2),g=function(){return a.apply(c,f.concat(F.call(arguments)))};g.guid=a.guid=a.guid||g.guid||e.guid++;return g},access:function(a,c,d,f,g,h,i){var j,k=d==null,l=0,m=a.length;if(d&&typeof d==\"object\"){for(l in d)e.access(a,c,l,d[l],1,h,f);g=1}else if(f!==b){j=i===b&&e.isFunction(f),k&&(j?(j=c,c=function(a,b,c){return j.call(e(a),c)}):(c.call(a,f),c=null));if(c)for(;l<m;l++)c(a[l],d,j?f.call(a[l],l,c(a[l],d)):f,i);g=1}return g?a:k?c.call(a):m?c(a[0],d):h},now:function(){return(new Date).getTime()},uaMatch:function(a){a=a.toLowerCase();var b=r.exec(a)||s.exec(a)||t.exec(a)||a.indexOf(\"compatible\")<0&&u.exec(a)||[];return{browser:b[1]||\"\",version:b[2]||\"0\"}},sub:function(){function a(b,c){return new a.fn.init(b,c)}e.extend(!0,a,this),a.superclass=this,a.fn=a.prototype=this(),a.fn.constructor=a,a.sub=this.sub,a.fn.init=function(d,f){f&&f instanceof e&&!(f instanceof a)&&(f=a(f));return e.fn.init.call(this,d,f,b)},a.fn.init.prototype=a.fn;var b=a(c);return a},browser:{}}),e.each(\"Boolean Number String Function Array Date RegExp Object\".split(\" \"),function(a,b){I[\"[object \"+b+\"]\"]=b.toLowerCase()}),z=e.uaMatch(y),z.browser&&(e.browser[z.browser]=!0,e.browser.version=z.version),e.browser.webkit&&(e.browser.safari=!0),j.test(\"?\")&&(k=/^[\\s\\xA0]+/,l=/[\\s\\xA0]+$/),h=e(c),c.addEventListener?B=function(){c.removeEventListener(\"DOMContentLoaded\",B,!1),e.ready()}:c.attachEvent&&(B=function(){c.readyState===\"complete\"&&(c.detachEvent(\"onreadystatechange\",B),e.ready())});return e}(),g={};f.Callbacks=function(a){a=a?g[a]||h(a):{};var c=[],d=[],e,i,j,k,l,m,n=function(b){var d,e,g,h,i;for(d=0,e=b.length;d<e;d++)g=b[d],h=f.type(g),h===\"array\"?n(g):h===\"function\"&&(!a.unique||!p.has(g))&&c.push(g)},o=function(b,f){f=f||[],e=!a.memory||[b,f],i=!0,j=!0,m=k||0,k=0,l=c.length;for(;c&&m<l;m++)if(c[m].apply(b,f)===!1&&a.stopOnFalse){e=!0;break}j=!1,c&&(a.once?e===!0?p.disable():c=[]:d&&d.length&&(e=d.shift(),p.fireWith(e[0],e[1])))},p={add:function(){if(c){var a=c.length;n(arguments),j?l=c.length:e&&e!==!0&&(k=a,o(e[0],e[1]))}return this},remove:function(){if(c){var b=arguments,d=0,e=b.length;for(;d<e;d++)for(var f=0;f<c.length;f++)if(b[d]===c[f]){j&&f<=l&&(l--,f<=m&&m--),c.splice(f--,1);if(a.unique)break}}return this},has:function(a){if(c){var b=0,d=c.length;for(;b<d;b++)if(a===c[b])return!0}return!1},empty:function(){c=[];return this},disable:function(){c=d=e=b;return this},disabled:function(){return!c},lock:function(){d=b,(!e||e===!0)&&p.disable();return this},locked:function(){return!d},fireWith:function(b,c){d&&(j?a.once||d.push([b,c]):(!a.once||!e)&&o(b,c));return this},fire:function(){p.fireWith(this,arguments);return this},fired:function(){return!!i}};return p};var i=[].slice;f.extend({Deferred:function(a){var b=f.Callbacks(\"once memory\"),c=f.Callbacks(\"once memory\"),d=f.Callbacks(\"memory\"),e=\"pending\",g={resolve:b,reject:c,notify:d},h={done:b.add,fail:c.add,progress:d.add,state:function(){return e},isResolved:b.fired,isRejected:c.fired,then:function(a,b,c){i.done(a).fail(b).progress(c);return this},always:function(){i.done.apply(i,arguments).fail.apply(i,arguments);return this},pipe:function(a,b,c){return f.Deferred(function(d){f.each({done:[a,\"resolve\"],fail:[b,\"reject\"],progress:[c,\"notify\"]},function(a,b){var c=b[0],e=b[1],g;f.isFunction(c)?i[a](function(){g=c.apply(this,arguments),g&&f.isFunction(g.promise)?g.promise().then(d.resolve,d.reject,d.notify):d[e+\"With\"](this===i?d:this,[g])}):i[a](d[e])})}).promise()},promise:function(a){if(a==null)a=h;else for(var b in h)a[b]=h[b];return a}},i=h.promise({}),j;for(j in g)i[j]=g[j].fire,i[j+\"With\"]=g[j].fireWith;i.done(function(){e=\"resolved\"},c.disable,d.lock).fail(function(){e=\"rejected\"},b.disable,d.lock),a&&a.call(i,i);return i},when:function(a){function m(a){return function(b){e[a]=arguments.length>1?i.call(arguments,0):b,j.notifyWith(k,e)}}function l(a){return function(c){b[a]=arguments.length>1?i.call(arguments,0):c,--g||j.resolveWith(j,b)}}var b=i.call(arguments,0),c=0,d=b.length,e=Array(d),g=d,h=d,j=d<=1&&a&&f.isFunction(a.promise)?a:f.Deferred(),k=j.promise();if(d>1){for(;c<d;c++)b[c]&&b[c].promise&&f.isFunction(b[c].promise)?b[c].promise().then(l(c),j.reject,m(c)):--g;g||j.resolveWith(j,b)}else j!==a&&j.resolveWith(j,d?[a]:[]);return k}}),f.support=function(){var b,d,e,g,h,i,j,k,l,m,n,o,p=c.createElement(\"div\"),q=c.documentElement;p.setAttribute(\"className\",\"t\"),p.innerHTML=\"   <link/><table></table><a href='/a' style='top:1px;float:left;opacity:.55;'>a</a><input type='checkbox'/>\",d=p.getElementsByTagName(\"*\"),e=p.getElementsByTagName(\"a\")[0];if(!d||!d.length||!e)return{};g=c.createElement(\"select\"),h=g.appendChild(c.createElement(\"option\")),i=p.getElementsByTagName(\"input\")[0],b={leadingWhitespace:p.firstChild.nodeType===3,tbody:!p.getElementsByTagName(\"tbody\").length,htmlSerialize:!!p.getElementsByTagName(\"link\").length,style:/top/.test(e.getAttribute(\"style\")),hrefNormalized:e.getAttribute(\"href\")===\"/a\",opacity:/^0.55/.test(e.style.opacity),cssFloat:!!e.style.cssFloat,checkOn:i.value===\"on\",optSelected:h.selected,getSetAttribute:p.className!==\"t\",enctype:!!c.createElement(\"form\").enctype,html5Clone:c.createElement(\"nav\").cloneNode(!0).outerHTML!==\"<:nav></:nav>\",submitBubbles:!0,changeBubbles:!0,focusinBubbles:!1,deleteExpando:!0,noCloneEvent:!0,inlineBlockNeedsLayout:!1,shrinkWrapBlocks:!1,reliableMarginRight:!0,pixelMargin:!0},f.boxModel=b.boxModel=c.compatMode===\"CSS1Compat\",i.checked=!0,b.noCloneChecked=i.cloneNode(!0).checked,g.disabled=!0,b.optDisabled=!h.disabled;try{delete p.test}catch(r){b.deleteExpando=!1}!p.addEventListener&&p.attachEvent&&p.fireEvent&&(p.attachEvent(\"onclick\",function(){b.noCloneEvent=!1}),p.cloneNode(!0).fireEvent(\"onclick\")),i=c.createElement(\"input\"),i.value=\"t\",i.setAttribute(\"type\",\"radio\"),b.radioValue=i.value===\"t\",i.setAttribute(\"checked\",\"checked\"),i.setAttribute(\"name\",\"t\"),p.appendChild(i),j=c.createDocumentFragment(),j.appendChild(p.lastChild),b.checkClone=j.cloneNode(!0).cloneNode(!0).lastChild.checked,b.appendChecked=i.checked,j.removeChild(i),j.appendChild(p);if(p.attachEvent)for(n in{submit:1,change:1,focusin:1})m=\"on\"+n,o=m in p,o||(p.setAttribute(m,\"return;\"),o=typeof p[m]==\"function\"),b[n+\"Bubbles\"]=o;j.removeChild(p),j=g=h=p=i=null,f(function(){var d,e,g,h,i,j,l,m,n,q,r,s,t,u=c.getElementsByTagName(\"body\")[0];!u||(m=1,t=\"padding:0;margin:0;border:\",r=\"position:absolute;top:0;left:0;width:1px;height:1px;\",s=t+\"0;visibility:hidden;\",n=\"style='\"+r+t+\"5px solid #000;\",q=\"<div \"+n+\"display:block;'><div style='\"+t+\"0;display:block;overflow:hidden;'></div></div>\"+\"<table \"+n+\"' cellpadding='0' cellspacing='0'>\"+\"<tr><td></td></tr></table>\",d=c.createElement(\"div\"),d.style.cssText=s+\"width:0;height:0;position:static;top:0;margin-top:\"+m+\"px\",u.insertBefore(d,u.firstChild),p=c.createElement(\"div\"),d.appendChild(p),p.innerHTML=\"<table><tr><td style='\"+t+\"0;display:none'></td><td>t</td></tr></table>\",k=p.getElementsByTagName(\"td\"),o=k[0].offsetHeight===0,k[0].style.display=\"\",k[1].style.display=\"none\",b.reliableHiddenOffsets=o&&k[0].offsetHeight===0,a.getComputedStyle&&(p.innerHTML=\"\",l=c.createElement(\"div\"),l.style.width=\"0\",l.style.marginRight=\"0\",p.style.width=\"2px\",p.appendChild(l),b.reliableMarginRight=(parseInt((a.getComputedStyle(l,null)||{marginRight:0}).marginRight,10)||0)===0),typeof p.style.zoom!=\"undefined\"&&(p.innerHTML=\"\",p.style.width=p.style.padding=\"1px\",p.style.border=0,p.style.overflow=\"hidden\",p.style.display=\"inline\",p.style.zoom=1,b.inlineBlockNeedsLayout=p.offsetWidth===3,p.style.display=\"block\",p.style.overflow=\"visible\",p.innerHTML=\"<div style='width:5px;'></div>\",b.shrinkWrapBlocks=p.offsetWidth!==3),p.style.cssText=r+s,p.innerHTML=q,e=p.firstChild,g=e.firstChild,i=e.nextSibling.firstChild.firstChild,j={doesNotAddBorder:g.offsetTop!==5,doesAddBorderForTableAndCells:i.offsetTop===5},g.style.position=\"fixed\",g.style.top=\"20px\",j.fixedPosition=g.offsetTop===20||g.offsetTop===15,g.style.position=g.style.top=\"\",e.style.overflow=\"hidden\",e.style.position=\"relative\",j.subtractsBorderForOverflowNotVisible=g.offsetTop===-5,j.doesNotIncludeMarginInBodyOffset=u.offsetTop!==m,a.getComputedStyle&&(p.style.marginTop=\"1%\",b.pixelMargin=(a.getComputedStyle(p,null)||{marginTop:0}).marginTop!==\"1%\"),typeof d.style.zoom!=\"undefined\"&&(d.style.zoom=1),u.removeChild(d),l=p=d=null,f.extend(b,j))});return b}();var j=/^(?:\\{.*\\}|\\[.*\\])$/,k=/([A-Z])/g;f.extend({cache:{},uuid:0,expando:\"jQuery\"+(f.fn.jquery+Math.random()).replace(/\\D/g,\"\"),noData:{embed:!0,object:\"clsid:D27CDB6E-AE6D-11cf-96B8-444553540000\",applet:!0},hasData:function(a){a=a.nodeType?f.cache[a[f.expando]]:a[f.expando];return!!a&&!m(a)},data:function(a,c,d,e){if(!!f.acceptData(a)){var g,h,i,j=f.expando,k=typeof c==\"string\",l=a.nodeType,m=l?f.cache:a,n=l?a[j]:a[j]&&j,o=c===\"events\";if((!n||!m[n]||!o&&!e&&!m[n].data)&&k&&d===b)return;n||(l?a[j]=n=++f.uuid:n=j),m[n]||(m[n]={},l||(m[n].toJSON=f.noop));if(typeof c==\"object\"||typeof c==\"function\")e?m[n]=f.extend(m[n],c):m[n].data=f.extend(m[n].data,c);g=h=m[n],e||(h.data||(h.data={}),h=h.data),d!==b&&(h[f.camelCase(c)]=d);if(o&&!h[c])return g.events;k?(i=h[c],i==null&&(i=h[f.camelCase(c)])):i=h;return i}},removeData:function(a,b,c){if(!!f.acceptData(a)){var d,e,g,h=f.expando,i=a.nodeType,j=i?f.cache:a,k=i?a[h]:h;if(!j[k])return;if(b){d=c?j[k]:j[k].data;if(d){f.isArray(b)||(b in d?b=[b]:(b=f.camelCase(b),b in d?b=[b]:b=b.split(\" \")));for(e=0,g=b.length;e<g;e++)delete d[b[e]];if(!(c?m:f.isEmptyObject)(d))return}}if(!c){delete j[k].data;if(!m(j[k]))return}f.support.deleteExpando||!j.setInterval?delete j[k]:j[k]=null,i&&(f.support.deleteExpando?delete a[h]:a.removeAttribute?a.removeAttribute(h):a[h]=null)}},_data:function(a,b,c){return f.data(a,b,c,!0)},acceptData:function(a){if(a.nodeName){var b=f.noData[a.nodeName.toLowerCase()];if(b)return b!==!0&&a.getAttribute(\"classid\")===b}return!0}}),f.fn.extend({data:function(a,c){var d,e,g,h,i,j=this[0],k=0,m=null;if(a===b){if(this.length){m=f.data(j);if(j.nodeType===1&&!f._data(j,\"parsedAttrs\")){g=j.attributes;for(i=g.length;k<i;k++)h=g[k].name,h.indexOf(\"data-\")===0&&(h=f.camelCase(h.substring(5)),l(j,h,m[h]));f._data(j,\"parsedAttrs\",!0)}}return m}if(typeof a==\"object\")return this.each(function(){f.data(this,a)});d=a.split(\".\",2),d[1]=d[1]?\".\"+d[1]:\"\",e=d[1]+\"!\";return f.access(this,function(c){if(c===b){m=this.triggerHandler(\"getData\"+e,[d[0]]),m===b&&j&&(m=f.data(j,a),m=l(j,a,m));return m===b&&d[1]?this.data(d[0]):m}d[1]=c,this.each(function(){var b=f(this);b.triggerHandler(\"setData\"+e,d),f.data(this,a,c),b.triggerHandler(\"changeData\"+e,d)})},null,c,arguments.length>1,null,!1)},removeData:function(a){return this.each(function(){f.removeData(this,a)})}}),f.extend({_mark:function(a,b){a&&(b=(b||\"fx\")+\"mark\",f._data(a,b,(f._data(a,b)||0)+1))},_unmark:function(a,b,c){a!==!0&&(c=b,b=a,a=!1);if(b){c=c||\"fx\";var d=c+\"mark\",e=a?0:(f._data(b,d)||1)-1;e?f._data(b,d,e):(f.removeData(b,d,!0),n(b,c,\"mark\"))}},queue:function(a,b,c){var d;if(a){b=(b||\"fx\")+\"queue\",d=f._data(a,b),c&&(!d||f.isArray(c)?d=f._data(a,b,f.makeArray(c)):d.push(c));return d||[]}},dequeue:function(a,b){b=b||\"fx\";var c=f.queue(a,b),d=c.shift(),e={};d===\"inprogress\"&&(d=c.shift()),d&&(b===\"fx\"&&c.unshift(\"inprogress\"),f._data(a,b+\".run\",e),d.call(a,function(){f.dequeue(a,b)},e)),c.length||(f.removeData(a,b+\"queue \"+b+\".run\",!0),n(a,b,\"queue\"))}}),f.fn.extend({queue:function(a,c){var d=2;typeof a!=\"string\"&&(c=a,a=\"fx\",d--);if(arguments.length<d)return f.queue(this[0],a);return c===b?this:this.each(function(){var b=f.queue(this,a,c);a===\"fx\"&&b[0]!==\"inprogress\"&&f.dequeue(this,a)})},dequeue:function(a){return this.each(function(){f.dequeue(this,a)})},delay:function(a,b){a=f.fx?f.fx.speeds[a]||a:a,b=b||\"fx\";return this.queue(b,function(b,c){var d=setTimeout(b,a);c.stop=function(){clearTimeout(d)}})},clearQueue:function(a){return this.queue(a||\"fx\",[])},promise:function(a,c){function m(){--h||d.resolveWith(e,[e])}typeof a!=\"string\"&&(c=a,a=b),a=a||\"fx\";var d=f.Deferred(),e=this,g=e.length,h=1,i=a+\"defer\",j=a+\"queue\",k=a+\"mark\",l;while(g--)if(l=f.data(e[g],i,b,!0)||(f.data(e[g],j,b,!0)||f.data(e[g],k,b,!0))&&f.data(e[g],i,f.Callbacks(\"once memory\"),!0))h++,l.add(m);m();return d.promise(c)}});var o=/[\\n\\t\\r]/g,p=/\\s+/,q=/\\r/g,r=/^(?:button|input)$/i,s=/^(?:button|input|object|select|textarea)$/i,t=/^a(?:rea)?$/i,u=/^(?:autofocus|autoplay|async|checked|controls|defer|disabled|hidden|loop|multiple|open|readonly|required|scoped|selected)$/i,v=f.support.getSetAttribute,w,x,y;f.fn.extend({attr:function(a,b){return f.access(this,f.attr,a,b,arguments.length>1)},removeAttr:function(a){return this.each(function(){f.removeAttr(this,a)})},prop:function(a,b){return f.access(this,f.prop,a,b,arguments.length>1)},removeProp:function(a){a=f.propFix[a]||a;return this.each(function(){try{this[a]=b,delete this[a]}catch(c){}})},addClass:function(a){var b,c,d,e,g,h,i;if(f.isFunction(a))return this.each(function(b){f(this).addClass(a.call(this,b,this.className))});if(a&&typeof a==\"string\"){b=a.split(p);for(c=0,d=this.length;c<d;c++){e=this[c];if(e.nodeType===1)if(!e.className&&b.length===1)e.className=a;else{g=\" \"+e.className+\" \";for(h=0,i=b.length;h<i;h++)~g.indexOf(\" \"+b[h]+\" \")||(g+=b[h]+\" \");e.className=f.trim(g)}}}return this},removeClass:function(a){var c,d,e,g,h,i,j;if(f.isFunction(a))return this.each(function(b){f(this).removeClass(a.call(this,b,this.className))});if(a&&typeof a==\"string\"||a===b){c=(a||\"\").split(p);for(d=0,e=this.length;d<e;d++){g=this[d];if(g.nodeType===1&&g.className)if(a){h=(\" \"+g.className+\" \").replace(o,\" \");for(i=0,j=c.length;i<j;i++)h=h.replace(\" \"+c[i]+\" \",\" \");g.className=f.trim(h)}else g.className=\"\"}}return this},toggleClass:function(a,b){var c=typeof a,d=typeof b==\"boolean\";if(f.isFunction(a))return this.each(function(c){f(this).toggleClass(a.call(this,c,this.className,b),b)});return this.each(function(){if(c===\"string\"){var e,g=0,h=f(this),i=b,j=a.split(p);while(e=j[g++])i=d?i:!h.hasClass(e),h[i?\"addClass\":\"removeClass\"](e)}else if(c===\"undefined\"||c===\"boolean\")this.className&&f._data(this,\"__className__\",this.className),this.className=this.className||a===!1?\"\":f._data(this,\"__className__\")||\"\"})},hasClass:function(a){var b=\" \"+a+\" \",c=0,d=this.length;for(;c<d;c++)if(this[c].nodeType===1&&(\" \"+this[c].className+\" \").replace(o,\" \").indexOf(b)>-1)return!0;return!1},val:function(a){var c,d,e,g=this[0];{if(!!arguments.length){e=f.isFunction(a);return this.each(function(d){var g=f(this),h;if(this.nodeType===1){e?h=a.call(this,d,g.val()):h=a,h==null?h=\"\":typeof h==\"number\"?h+=\"\":f.isArray(h)&&(h=f.map(h,function(a){return a==null?\"\":a+\"\"})),c=f.valHooks[this.type]||f.valHooks[this.nodeName.toLowerCase()];if(!c||!(\"set\"in c)||c.set(this,h,\"value\")===b)this.value=h}})}if(g){c=f.valHooks[g.type]||f.valHooks[g.nodeName.toLowerCase()];if(c&&\"get\"in c&&(d=c.get(g,\"value\"))!==b)return d;d=g.value;return typeof d==\"string\"?d.replace(q,\"\"):d==null?\"\":d}}}}),f.extend({valHooks:{option:{get:function(a){var b=a.attributes.value;return!b||b.specified?a.value:a.text}},select:{get:function(a){var b,c,d,e,g=a.selectedIndex,h=[],i=a.options,j=a.type===\"select-one\";if(g<0)return null;c=j?g:0,d=j?g+1:i.length;for(;c<d;c++){e=i[c];if(e.selected&&(f.support.optDisabled?!e.disabled:e.getAttribute(\"disabled\")===null)&&(!e.parentNode.disabled||!f.nodeName(e.parentNode,\"optgroup\"))){b=f(e).val();if(j)return b;h.push(b)}}if(j&&!h.length&&i.length)return f(i[g]).val();return h},set:function(a,b){var c=f.makeArray(b);f(a).find(\"option\").each(function(){this.selected=f.inArray(f(this).val(),c)>=0}),c.length||(a.selectedIndex=-1);return c}}},attrFn:{val:!0,css:!0,html:!0,text:!0,data:!0,width:!0,height:!0,offset:!0},attr:function(a,c,d,e){var g,h,i,j=a.nodeType;if(!!a&&j!==3&&j!==8&&j!==2){if(e&&c in f.attrFn)return f(a)[c](d);if(typeof a.getAttribute==\"undefined\")return f.prop(a,c,d);i=j!==1||!f.isXMLDoc(a),i&&(c=c.toLowerCase(),h=f.attrHooks[c]||(u.test(c)?x:w));if(d!==b){if(d===null){f.removeAttr(a,c);return}if(h&&\"set\"in h&&i&&(g=h.set(a,d,c))!==b)return g;a.setAttribute(c,\"\"+d);return d}if(h&&\"get\"in h&&i&&(g=h.get(a,c))!==null)return g;g=a.getAttribute(c);return g===null?b:g}},removeAttr:function(a,b){var c,d,e,g,h,i=0;if(b&&a.nodeType===1){d=b.toLowerCase().split(p),g=d.length;for(;i<g;i++)e=d[i],e&&(c=f.propFix[e]||e,h=u.test(e),h||f.attr(a,e,\"\"),a.removeAttribute(v?e:c),h&&c in a&&(a[c]=!1))}},attrHooks:{type:{set:function(a,b){if(r.test(a.nodeName)&&a.parentNode)f.error(\"type property can't be changed\");else if(!f.support.radioValue&&b===\"radio\"&&f.nodeName(a,\"input\")){var c=a.value;a.setAttribute(\"type\",b),c&&(a.value=c);return b}}},value:{get:function(a,b){if(w&&f.nodeName(a,\"button\"))return w.get(a,b);return b in a?a.value:null},set:function(a,b,c){if(w&&f.nodeName(a,\"button\"))return w.set(a,b,c);a.value=b}}},propFix:{tabindex:\"tabIndex\",readonly:\"readOnly\",\"for\":\"htmlFor\",\"class\":\"className\",maxlength:\"maxLength\",cellspacing:\"cellSpacing\",cellpadding:\"cellPadding\",rowspan:\"rowSpan\",colspan:\"colSpan\",usemap:\"useMap\",frameborder:\"frameBorder\",contenteditable:\"contentEditable\"},prop:function(a,c,d){var e,g,h,i=a.nodeType;if(!!a&&i!==3&&i!==8&&i!==2){h=i!==1||!f.isXMLDoc(a),h&&(c=f.propFix[c]||c,g=f.propHooks[c]);return d!==b?g&&\"set\"in g&&(e=g.set(a,d,c))!==b?e:a[c]=d:g&&\"get\"in g&&(e=g.get(a,c))!==null?e:a[c]}},propHooks:{tabIndex:{get:function(a){var c=a.getAttributeNode(\"tabindex\");return c&&c.specified?parseInt(c.value,10):s.test(a.nodeName)||t.test(a.nodeName)&&a.href?0:b}}}}),f.attrHooks.tabindex=f.propHooks.tabIndex,x={get:function(a,c){var d,e=f.prop(a,c);return e===!0||typeof e!=\"boolean\"&&(d=a.getAttributeNode(c))&&d.nodeValue!==!1?c.toLowerCase():b},set:function(a,b,c){var d;b===!1?f.removeAttr(a,c):(d=f.propFix[c]||c,d in a&&(a[d]=!0),a.setAttribute(c,c.toLowerCase()));return c}},v||(y={name:!0,id:!0,coords:!0},w=f.valHooks.button={get:function(a,c){var d;d=a.getAttributeNode(c);return d&&(y[c]?d.nodeValue!==\"\":d.specified)?d.nodeValue:b},set:function(a,b,d){var e=a.getAttributeNode(d);e||(e=c.createAttribute(d),a.setAttributeNode(e));return e.nodeValue=b+\"\"}},f.attrHooks.tabindex.set=w.set,f.each([\"width\",\"height\"],function(a,b){f.attrHooks[b]=f.extend(f.attrHooks[b],{set:function(a,c){if(c===\"\"){a.setAttribute(b,\"auto\");return c}}})}),f.attrHooks.contenteditable={get:w.get,set:function(a,b,c){b===\"\"&&(b=\"false\"),w.set(a,b,c)}}),f.support.hrefNormalized||f.each([\"href\",\"src\",\"width\",\"height\"],function(a,c){f.attrHooks[c]=f.extend(f.attrHooks[c],{get:function(a){var d=a.getAttribute(c,2);return d===null?b:d}})}),f.support.style||(f.attrHooks.style={get:function(a){return a.style.cssText.toLowerCase()||b},set:function(a,b){return a.style.cssText=\"\"+b}}),f.support.optSelected||(f.propHooks.selected=f.extend(f.propHooks.selected,{get:function(a){var b=a.parentNode;b&&(b.selectedIndex,b.parentNode&&b.parentNode.selectedIndex);return null}})),f.support.enctype||(f.propFix.enctype=\"encoding\"),f.support.checkOn||f.each([\"radio\",\"checkbox\"],function(){f.valHooks[this]={get:function(a){return a.getAttribute(\"value\")===null?\"on\":a.value}}}),f.each([\"radio\",\"checkbox\"],function(){f.valHooks[this]=f.extend(f.valHooks[this],{set:function(a,b){if(f.isArray(b))return a.checked=f.inArray(f(a).val(),b)>=0}})});var z=/^(?:textarea|input|select)$/i,A=/^([^\\.]*)?(?:\\.(.+))?$/,B=/(?:^|\\s)hover(\\.\\S+)?\\b/,C=/^key/,D=/^(?:mouse|contextmenu)|click/,E=/^(?:focusinfocus|focusoutblur)$/,F=/^(\\w*)(?:#([\\w\\-]+))?(?:\\.([\\w\\-]+))?$/,G=function(\x0d\na){var b=F.exec(a);b&&(b[1]=(b[1]||\"\").toLowerCase(),b[3]=b[3]&&new RegExp(\"(?:^|\\\\s)\"+b[3]+\"(?:\\\\s|$)\"));return b},H=function(a,b){var c=a.attributes||{};return(!b[1]||a.nodeName.toLowerCase()===b[1])&&(!b[2]||(c.id||{}).value===b[2])&&(!b[3]||b[3].test((c[\"class\"]||{}).value))},I=function(a){return f.event.special.hover?a:a.replace(B,\"mouseenter$1 mouseleave$1\")};f.event={add:function(a,c,d,e,g){var h,i,j,k,l,m,n,o,p,q,r,s;if(!(a.nodeType===3||a.nodeType===8||!c||!d||!(h=f._data(a)))){d.handler&&(p=d,d=p.handler,g=p.selector),d.guid||(d.guid=f.guid++),j=h.events,j||(h.events=j={}),i=h.handle,i||(h.handle=i=function(a){return typeof f!=\"undefined\"&&(!a||f.event.triggered!==a.type)?f.event.dispatch.apply(i.elem,arguments):b},i.elem=a),c=f.trim(I(c)).split(\" \");for(k=0;k<c.length;k++){l=A.exec(c[k])||[],m=l[1],n=(l[2]||\"\").split(\".\").sort(),s=f.event.special[m]||{},m=(g?s.delegateType:s.bindType)||m,s=f.event.special[m]||{},o=f.extend({type:m,origType:l[1],data:e,handler:d,guid:d.guid,selector:g,quick:g&&G(g),namespace:n.join(\".\")},p),r=j[m];if(!r){r=j[m]=[],r.delegateCount=0;if(!s.setup||s.setup.call(a,e,n,i)===!1)a.addEventListener?a.addEventListener(m,i,!1):a.attachEvent&&a.attachEvent(\"on\"+m,i)}s.add&&(s.add.call(a,o),o.handler.guid||(o.handler.guid=d.guid)),g?r.splice(r.delegateCount++,0,o):r.push(o),f.event.global[m]=!0}a=null}},global:{},remove:function(a,b,c,d,e){var g=f.hasData(a)&&f._data(a),h,i,j,k,l,m,n,o,p,q,r,s;if(!!g&&!!(o=g.events)){b=f.trim(I(b||\"\")).split(\" \");for(h=0;h<b.length;h++){i=A.exec(b[h])||[],j=k=i[1],l=i[2];if(!j){for(j in o)f.event.remove(a,j+b[h],c,d,!0);continue}p=f.event.special[j]||{},j=(d?p.delegateType:p.bindType)||j,r=o[j]||[],m=r.length,l=l?new RegExp(\"(^|\\\\.)\"+l.split(\".\").sort().join(\"\\\\.(?:.*\\\\.)?\")+\"(\\\\.|$)\"):null;for(n=0;n<r.length;n++)s=r[n],(e||k===s.origType)&&(!c||c.guid===s.guid)&&(!l||l.test(s.namespace))&&(!d||d===s.selector||d===\"**\"&&s.selector)&&(r.splice(n--,1),s.selector&&r.delegateCount--,p.remove&&p.remove.call(a,s));r.length===0&&m!==r.length&&((!p.teardown||p.teardown.call(a,l)===!1)&&f.removeEvent(a,j,g.handle),delete o[j])}f.isEmptyObject(o)&&(q=g.handle,q&&(q.elem=null),f.removeData(a,[\"events\",\"handle\"],!0))}},customEvent:{getData:!0,setData:!0,changeData:!0},trigger:function(c,d,e,g){if(!e||e.nodeType!==3&&e.nodeType!==8){var h=c.type||c,i=[],j,k,l,m,n,o,p,q,r,s;if(E.test(h+f.event.triggered))return;h.indexOf(\"!\")>=0&&(h=h.slice(0,-1),k=!0),h.indexOf(\".\")>=0&&(i=h.split(\".\"),h=i.shift(),i.sort());if((!e||f.event.customEvent[h])&&!f.event.global[h])return;c=typeof c==\"object\"?c[f.expando]?c:new f.Event(h,c):new f.Event(h),c.type=h,c.isTrigger=!0,c.exclusive=k,c.namespace=i.join(\".\"),c.namespace_re=c.namespace?new RegExp(\"(^|\\\\.)\"+i.join(\"\\\\.(?:.*\\\\.)?\")+\"(\\\\.|$)\"):null,o=h.indexOf(\":\")<0?\"on\"+h:\"\";if(!e){j=f.cache;for(l in j)j[l].events&&j[l].events[h]&&f.event.trigger(c,d,j[l].handle.elem,!0);return}c.result=b,c.target||(c.target=e),d=d!=null?f.makeArray(d):[],d.unshift(c),p=f.event.special[h]||{};if(p.trigger&&p.trigger.apply(e,d)===!1)return;r=[[e,p.bindType||h]];if(!g&&!p.noBubble&&!f.isWindow(e)){s=p.delegateType||h,m=E.test(s+h)?e:e.parentNode,n=null;for(;m;m=m.parentNode)r.push([m,s]),n=m;n&&n===e.ownerDocument&&r.push([n.defaultView||n.parentWindow||a,s])}for(l=0;l<r.length&&!c.isPropagationStopped();l++)m=r[l][0],c.type=r[l][1],q=(f._data(m,\"events\")||{})[c.type]&&f._data(m,\"handle\"),q&&q.apply(m,d),q=o&&m[o],q&&f.acceptData(m)&&q.apply(m,d)===!1&&c.preventDefault();c.type=h,!g&&!c.isDefaultPrevented()&&(!p._default||p._default.apply(e.ownerDocument,d)===!1)&&(h!==\"click\"||!f.nodeName(e,\"a\"))&&f.acceptData(e)&&o&&e[h]&&(h!==\"focus\"&&h!==\"blur\"||c.target.offsetWidth!==0)&&!f.isWindow(e)&&(n=e[o],n&&(e[o]=null),f.event.triggered=h,e[h](),f.event.triggered=b,n&&(e[o]=n));return c.result}},dispatch:function(c){c=f.event.fix(c||a.event);var d=(f._data(this,\"events\")||{})[c.type]||[],e=d.delegateCount,g=[].slice.call(arguments,0),h=!c.exclusive&&!c.namespace,i=f.event.special[c.type]||{},j=[],k,l,m,n,o,p,q,r,s,t,u;g[0]=c,c.delegateTarget=this;if(!i.preDispatch||i.preDispatch.call(this,c)!==!1){if(e&&(!c.button||c.type!==\"click\")){n=f(this),n.context=this.ownerDocument||this;for(m=c.target;m!=this;m=m.parentNode||this)if(m.disabled!==!0){p={},r=[],n[0]=m;for(k=0;k<e;k++)s=d[k],t=s.selector,p[t]===b&&(p[t]=s.quick?H(m,s.quick):n.is(t)),p[t]&&r.push(s);r.length&&j.push({elem:m,matches:r})}}d.length>e&&j.push({elem:this,matches:d.slice(e)});for(k=0;k<j.length&&!c.isPropagationStopped();k++){q=j[k],c.currentTarget=q.elem;for(l=0;l<q.matches.length&&!c.isImmediatePropagationStopped();l++){s=q.matches[l];if(h||!c.namespace&&!s.namespace||c.namespace_re&&c.namespace_re.test(s.namespace))c.data=s.data,c.handleObj=s,o=((f.event.special[s.origType]||{}).handle||s.handler).apply(q.elem,g),o!==b&&(c.result=o,o===!1&&(c.preventDefault(),c.stopPropagation()))}}i.postDispatch&&i.postDispatch.call(this,c);return c.result}},props:\"attrChange attrName relatedNode srcElement altKey bubbles cancelable ctrlKey currentTarget eventPhase metaKey relatedTarget shiftKey target timeStamp view which\".split(\" \"),fixHooks:{},keyHooks:{props:\"char charCode key keyCode\".split(\" \"),filter:function(a,b){a.which==null&&(a.which=b.charCode!=null?b.charCode:b.keyCode);return a}},mouseHooks:{props:\"button buttons clientX clientY fromElement offsetX offsetY pageX pageY screenX screenY toElement\".split(\" \"),filter:function(a,d){var e,f,g,h=d.button,i=d.fromElement;a.pageX==null&&d.clientX!=null&&(e=a.target.ownerDocument||c,f=e.documentElement,g=e.body,a.pageX=d.clientX+(f&&f.scrollLeft||g&&g.scrollLeft||0)-(f&&f.clientLeft||g&&g.clientLeft||0),a.pageY=d.clientY+(f&&f.scrollTop||g&&g.scrollTop||0)-(f&&f.clientTop||g&&g.clientTop||0)),!a.relatedTarget&&i&&(a.relatedTarget=i===a.target?d.toElement:i),!a.which&&h!==b&&(a.which=h&1?1:h&2?3:h&4?2:0);return a}},fix:function(a){if(a[f.expando])return a;var d,e,g=a,h=f.event.fixHooks[a.type]||{},i=h.props?this.props.concat(h.props):this.props;a=f.Event(g);for(d=i.length;d;)e=i[--d],a[e]=g[e];a.target||(a.target=g.srcElement||c),a.target.nodeType===3&&(a.target=a.target.parentNode),a.metaKey===b&&(a.metaKey=a.ctrlKey);return h.filter?h.filter(a,g):a},special:{ready:{setup:f.bindReady},load:{noBubble:!0},focus:{delegateType:\"focusin\"},blur:{delegateType:\"focusout\"},beforeunload:{setup:function(a,b,c){f.isWindow(this)&&(this.onbeforeunload=c)},teardown:function(a,b){this.onbeforeunload===b&&(this.onbeforeunload=null)}}},simulate:function(a,b,c,d){var e=f.extend(new f.Event,c,{type:a,isSimulated:!0,originalEvent:{}});d?f.event.trigger(e,null,b):f.event.dispatch.call(b,e),e.isDefaultPrevented()&&c.preventDefault()}},f.event.handle=f.event.dispatch,f.removeEvent=c.removeEventListener?function(a,b,c){a.removeEventListener&&a.removeEventListener(b,c,!1)}:function(a,b,c){a.detachEvent&&a.detachEvent(\"on\"+b,c)},f.Event=function(a,b){if(!(this instanceof f.Event))return new f.Event(a,b);a&&a.type?(this.originalEvent=a,this.type=a.type,this.isDefaultPrevented=a.defaultPrevented||a.returnValue===!1||a.getPreventDefault&&a.getPreventDefault()?K:J):this.type=a,b&&f.extend(this,b),this.timeStamp=a&&a.timeStamp||f.now(),this[f.expando]=!0},f.Event.prototype={preventDefault:function(){this.isDefaultPrevented=K;var a=this.originalEvent;!a||(a.preventDefault?a.preventDefault():a.returnValue=!1)},stopPropagation:function(){this.isPropagationStopped=K;var a=this.originalEvent;!a||(a.stopPropagation&&a.stopPropagation(),a.cancelBubble=!0)},stopImmediatePropagation:function(){this.isImmediatePropagationStopped=K,this.stopPropagation()},isDefaultPrevented:J,isPropagationStopped:J,isImmediatePropagationStopped:J},f.each({mouseenter:\"mouseover\",mouseleave:\"mouseout\"},function(a,b){f.event.special[a]={delegateType:b,bindType:b,handle:function(a){var c=this,d=a.relatedTarget,e=a.handleObj,g=e.selector,h;if(!d||d!==c&&!f.contains(c,d))a.type=e.origType,h=e.handler.apply(this,arguments),a.type=b;return h}}}),f.support.submitBubbles||(f.event.special.submit={setup:function(){if(f.nodeName(this,\"form\"))return!1;f.event.add(this,\"click._submit keypress._submit\",function(a){var c=a.target,d=f.nodeName(c,\"input\")||f.nodeName(c,\"button\")?c.form:b;d&&!d._submit_attached&&(f.event.add(d,\"submit._submit\",function(a){a._submit_bubble=!0}),d._submit_attached=!0)})},postDispatch:function(a){a._submit_bubble&&(delete a._submit_bubble,this.parentNode&&!a.isTrigger&&f.event.simulate(\"submit\",this.parentNode,a,!0))},teardown:function(){if(f.nodeName(this,\"form\"))return!1;f.event.remove(this,\"._submit\")}}),f.support.changeBubbles||(f.event.special.change={setup:function(){if(z.test(this.nodeName)){if(this.type===\"checkbox\"||this.type===\"radio\")f.event.add(this,\"propertychange._change\",function(a){a.originalEvent.propertyName===\"checked\"&&(this._just_changed=!0)}),f.event.add(this,\"click._change\",function(a){this._just_changed&&!a.isTrigger&&(this._just_changed=!1,f.event.simulate(\"change\",this,a,!0))});return!1}f.event.add(this,\"beforeactivate._change\",function(a){var b=a.target;z.test(b.nodeName)&&!b._change_attached&&(f.event.add(b,\"change._change\",function(a){this.parentNode&&!a.isSimulated&&!a.isTrigger&&f.event.simulate(\"change\",this.parentNode,a,!0)}),b._change_attached=!0)})},handle:function(a){var b=a.target;if(this!==b||a.isSimulated||a.isTrigger||b.type!==\"radio\"&&b.type!==\"checkbox\")return a.handleObj.handler.apply(this,arguments)},teardown:function(){f.event.remove(this,\"._change\");return z.test(this.nodeName)}}),f.support.focusinBubbles||f.each({focus:\"focusin\",blur:\"focusout\"},function(a,b){var d=0,e=function(a){f.event.simulate(b,a.target,f.event.fix(a),!0)};f.event.special[b]={setup:function(){d++===0&&c.addEventListener(a,e,!0)},teardown:function(){--d===0&&c.removeEventListener(a,e,!0)}}}),f.fn.extend({on:function(a,c,d,e,g){var h,i;if(typeof a==\"object\"){typeof c!=\"string\"&&(d=d||c,c=b);for(i in a)this.on(i,c,d,a[i],g);return this}d==null&&e==null?(e=c,d=c=b):e==null&&(typeof c==\"string\"?(e=d,d=b):(e=d,d=c,c=b));if(e===!1)e=J;else if(!e)return this;g===1&&(h=e,e=function(a){f().off(a);return h.apply(this,arguments)},e.guid=h.guid||(h.guid=f.guid++));return this.each(function(){f.event.add(this,a,e,d,c)})},one:function(a,b,c,d){return this.on(a,b,c,d,1)},off:function(a,c,d){if(a&&a.preventDefault&&a.handleObj){var e=a.handleObj;f(a.delegateTarget).off(e.namespace?e.origType+\".\"+e.namespace:e.origType,e.selector,e.handler);return this}if(typeof a==\"object\"){for(var g in a)this.off(g,c,a[g]);return this}if(c===!1||typeof c==\"function\")d=c,c=b;d===!1&&(d=J);return this.each(function(){f.event.remove(this,a,d,c)})},bind:function(a,b,c){return this.on(a,null,b,c)},unbind:function(a,b){return this.off(a,null,b)},live:function(a,b,c){f(this.context).on(a,this.selector,b,c);return this},die:function(a,b){f(this.context).off(a,this.selector||\"**\",b);return this},delegate:function(a,b,c,d){return this.on(b,a,c,d)},undelegate:function(a,b,c){return arguments.length==1?this.off(a,\"**\"):this.off(b,a,c)},trigger:function(a,b){return this.each(function(){f.event.trigger(a,b,this)})},triggerHandler:function(a,b){if(this[0])return f.event.trigger(a,b,this[0],!0)},toggle:function(a){var b=arguments,c=a.guid||f.guid++,d=0,e=function(c){var e=(f._data(this,\"lastToggle\"+a.guid)||0)%d;f._data(this,\"lastToggle\"+a.guid,e+1),c.preventDefault();return b[e].apply(this,arguments)||!1};e.guid=c;while(d<b.length)b[d++].guid=c;return this.click(e)},hover:function(a,b){return this.mouseenter(a).mouseleave(b||a)}}),f.each(\"blur focus focusin focusout load resize scroll unload click dblclick mousedown mouseup mousemove mouseover mouseout mouseenter mouseleave change select submit keydown keypress keyup error contextmenu\".split(\" \"),function(a,b){f.fn[b]=function(a,c){c==null&&(c=a,a=null);return arguments.length>0?this.on(b,null,a,c):this.trigger(b)},f.attrFn&&(f.attrFn[b]=!0),C.test(b)&&(f.event.fixHooks[b]=f.event.keyHooks),D.test(b)&&(f.event.fixHooks[b]=f.event.mouseHooks)}),function(){function x(a,b,c,e,f,g){for(var h=0,i=e.length;h<i;h++){var j=e[h];if(j){var k=!1;j=j[a];while(j){if(j[d]===c){k=e[j.sizset];break}if(j.nodeType===1){g||(j[d]=c,j.sizset=h);if(typeof b!=\"string\"){if(j===b){k=!0;break}}else if(m.filter(b,[j]).length>0){k=j;break}}j=j[a]}e[h]=k}}}function w(a,b,c,e,f,g){for(var h=0,i=e.length;h<i;h++){var j=e[h];if(j){var k=!1;j=j[a];while(j){if(j[d]===c){k=e[j.sizset];break}j.nodeType===1&&!g&&(j[d]=c,j.sizset=h);if(j.nodeName.toLowerCase()===b){k=j;break}j=j[a]}e[h]=k}}}var a=/((?:\\((?:\\([^()]+\\)|[^()]+)+\\)|\\[(?:\\[[^\\[\\]]*\\]|['\"][^'\"]*['\"]|[^\\[\\]'\"]+)+\\]|\\\\.|[^ >+~,(\\[\\\\]+)+|[>+~])(\\s*,\\s*)?((?:.|\\r|\\n)*)/g,d=\"sizcache\"+(Math.random()+\"\").replace(\".\",\"\"),e=0,g=Object.prototype.toString,h=!1,i=!0,j=/\\\\/g,k=/\\r\\n/g,l=/\\W/;[0,0].sort(function(){i=!1;return 0});var m=function(b,d,e,f){e=e||[],d=d||c;var h=d;if(d.nodeType!==1&&d.nodeType!==9)return[];if(!b||typeof b!=\"string\")return e;var i,j,k,l,n,q,r,t,u=!0,v=m.isXML(d),w=[],x=b;do{a.exec(\"\"),i=a.exec(x);if(i){x=i[3],w.push(i[1]);if(i[2]){l=i[3];break}}}while(i);if(w.length>1&&p.exec(b))if(w.length===2&&o.relative[w[0]])j=y(w[0]+w[1],d,f);else{j=o.relative[w[0]]?[d]:m(w.shift(),d);while(w.length)b=w.shift(),o.relative[b]&&(b+=w.shift()),j=y(b,j,f)}else{!f&&w.length>1&&d.nodeType===9&&!v&&o.match.ID.test(w[0])&&!o.match.ID.test(w[w.length-1])&&(n=m.find(w.shift(),d,v),d=n.expr?m.filter(n.expr,n.set)[0]:n.set[0]);if(d){n=f?{expr:w.pop(),set:s(f)}:m.find(w.pop(),w.length===1&&(w[0]===\"~\"||w[0]===\"+\")&&d.parentNode?d.parentNode:d,v),j=n.expr?m.filter(n.expr,n.set):n.set,w.length>0?k=s(j):u=!1;while(w.length)q=w.pop(),r=q,o.relative[q]?r=w.pop():q=\"\",r==null&&(r=d),o.relative[q](k,r,v)}else k=w=[]}k||(k=j),k||m.error(q||b);if(g.call(k)===\"[object Array]\")if(!u)e.push.apply(e,k);else if(d&&d.nodeType===1)for(t=0;k[t]!=null;t++)k[t]&&(k[t]===!0||k[t].nodeType===1&&m.contains(d,k[t]))&&e.push(j[t]);else for(t=0;k[t]!=null;t++)k[t]&&k[t].nodeType===1&&e.push(j[t]);else s(k,e);l&&(m(l,h,e,f),m.uniqueSort(e));return e};m.uniqueSort=function(a){if(u){h=i,a.sort(u);if(h)for(var b=1;b<a.length;b++)a[b]===a[b-1]&&a.splice(b--,1)}return a},m.matches=function(a,b){return m(a,null,null,b)},m.matchesSelector=function(a,b){return m(b,null,null,[a]).length>0},m.find=function(a,b,c){var d,e,f,g,h,i;if(!a)return[];for(e=0,f=o.order.length;e<f;e++){h=o.order[e];if(g=o.leftMatch[h].exec(a)){i=g[1],g.splice(1,1);if(i.substr(i.length-1)!==\"\\\\\"){g[1]=(g[1]||\"\").replace(j,\"\"),d=o.find[h](g,b,c);if(d!=null){a=a.replace(o.match[h],\"\");break}}}}d||(d=typeof b.getElementsByTagName!=\"undefined\"?b.getElementsByTagName(\"*\"):[]);return{set:d,expr:a}},m.filter=function(a,c,d,e){var f,g,h,i,j,k,l,n,p,q=a,r=[],s=c,t=c&&c[0]&&m.isXML(c[0]);while(a&&c.length){for(h in o.filter)if((f=o.leftMatch[h].exec(a))!=null&&f[2]){k=o.filter[h],l=f[1],g=!1,f.splice(1,1);if(l.substr(l.length-1)===\"\\\\\")continue;s===r&&(r=[]);if(o.preFilter[h]){f=o.preFilter[h](f,s,d,r,e,t);if(!f)g=i=!0;else if(f===!0)continue}if(f)for(n=0;(j=s[n])!=null;n++)j&&(i=k(j,f,n,s),p=e^i,d&&i!=null?p?g=!0:s[n]=!1:p&&(r.push(j),g=!0));if(i!==b){d||(s=r),a=a.replace(o.match[h],\"\");if(!g)return[];break}}if(a===q)if(g==null)m.error(a);else break;q=a}return s},m.error=function(a){throw new Error(\"Syntax error, unrecognized expression: \"+a)};var n=m.getText=function(a){var b,c,d=a.nodeType,e=\"\";if(d){if(d===1||d===9||d===11){if(typeof a.textContent==\"string\")return a.textContent;if(typeof a.innerText==\"string\")return a.innerText.replace(k,\"\");for(a=a.firstChild;a;a=a.nextSibling)e+=n(a)}else if(d===3||d===4)return a.nodeValue}else for(b=0;c=a[b];b++)c.nodeType!==8&&(e+=n(c));return e},o=m.selectors={order:[\"ID\",\"NAME\",\"TAG\"],match:{ID:/#((?:[\\w\\u00c0-\\uFFFF\\-]|\\\\.)+)/,CLASS:/\\.((?:[\\w\\u00c0-\\uFFFF\\-]|\\\\.)+)/,NAME:/\\[name=['\"]*((?:[\\w\\u00c0-\\uFFFF\\-]|\\\\.)+)['\"]*\\]/,ATTR:/\\[\\s*((?:[\\w\\u00c0-\\uFFFF\\-]|\\\\.)+)\\s*(?:(\\S?=)\\s*(?:(['\"])(.*?)\\3|(#?(?:[\\w\\u00c0-\\uFFFF\\-]|\\\\.)*)|)|)\\s*\\]/,TAG:/^((?:[\\w\\u00c0-\\uFFFF\\*\\-]|\\\\.)+)/,CHILD:/:(only|nth|last|first)-child(?:\\(\\s*(even|odd|(?:[+\\-]?\\d+|(?:[+\\-]?\\d*)?n\\s*(?:[+\\-]\\s*\\d+)?))\\s*\\))?/,POS:/:(nth|eq|gt|lt|first|last|even|odd)(?:\\((\\d*)\\))?(?=[^\\-]|$)/,PSEUDO:/:((?:[\\w\\u00c0-\\uFFFF\\-]|\\\\.)+)(?:\\((['\"]?)((?:\\([^\\)]+\\)|[^\\(\\)]*)+)\\2\\))?/},leftMatch:{},attrMap:{\"class\":\"className\",\"for\":\"htmlFor\"},attrHandle:{href:function(a){return a.getAttribute(\"href\")},type:function(a){return a.getAttribute(\"type\")}},relative:{\"+\":function(a,b){var c=typeof b==\"string\",d=c&&!l.test(b),e=c&&!d;d&&(b=b.toLowerCase());for(var f=0,g=a.length,h;f<g;f++)if(h=a[f]){while((h=h.previousSibling)&&h.nodeType!==1);a[f]=e||h&&h.nodeName.toLowerCase()===b?h||!1:h===b}e&&m.filter(b,a,!0)},\">\":function(a,b){var c,d=typeof b==\"string\",e=0,f=a.length;if(d&&!l.test(b)){b=b.toLowerCase();for(;e<f;e++){c=a[e];if(c){var g=c.parentNode;a[e]=g.nodeName.toLowerCase()===b?g:!1}}}else{for(;e<f;e++)c=a[e],c&&(a[e]=d?c.parentNode:c.parentNode===b);d&&m.filter(b,a,!0)}},\"\":function(a,b,c){var d,f=e++,g=x;typeof b==\"string\"&&!l.test(b)&&(b=b.toLowerCase(),d=b,g=w),g(\"parentNode\",b,f,a,d,c)},\"~\":function(a,b,c){var d,f=e++,g=x;typeof b==\"string\"&&!l.test(b)&&(b=b.toLowerCase(),d=b,g=w),g(\"previousSibling\",b,f,a,d,c)}},find:{ID:function(a,b,c){if(typeof b.getElementById!=\"undefined\"&&!c){var d=b.getElementById(a[1]);return d&&d.parentNode?[d]:[]}},NAME:function(a,b){if(typeof b.getElementsByName!=\"undefined\"){var c=[],d=b.getElementsByName(a[1]);for(var e=0,f=d.length;e<f;e++)d[e].getAttribute(\"name\")===a[1]&&c.push(d[e]);return c.length===0?null:c}},TAG:function(a,b){if(typeof b.getElementsByTagName!=\"undefined\")return b.getElementsByTagName(a[1])}},preFilter:{CLASS:function(a,b,c,d,e,f){a=\" \"+a[1].replace(j,\"\")+\" \";if(f)return a;for(var g=0,h;(h=b[g])!=null;g++)h&&(e^(h.className&&(\" \"+h.className+\" \").replace(/[\\t\\n\\r]/g,\" \").indexOf(a)>=0)?c||d.push(h):c&&(b[g]=!1));return!1},ID:function(a){return a[1].replace(j,\"\")},TAG:function(a,b){return a[1].replace(j,\"\").toLowerCase()},CHILD:function(a){if(a[1]===\"nth\"){a[2]||m.error(a[0]),a[2]=a[2].replace(/^\\+|\\s*/g,\"\");var b=/(-?)(\\d*)(?:n([+\\-]?\\d*))?/.exec(a[2]===\"even\"&&\"2n\"||a[2]===\"odd\"&&\"2n+1\"||!/\\D/.test(a[2])&&\"0n+\"+a[2]||a[2]);a[2]=b[1]+(b[2]||1)-0,a[3]=b[3]-0}else a[2]&&m.error(a[0]);a[0]=e++;return a},ATTR:function(a,b,c,d,e,f){var g=a[1]=a[1].replace(j,\"\");!f&&o.attrMap[g]&&(a[1]=o.attrMap[g]),a[4]=(a[4]||a[5]||\"\").replace(j,\"\"),a[2]===\"~=\"&&(a[4]=\" \"+a[4]+\" \");return a},PSEUDO:function(b,c,d,e,f){if(b[1]===\"not\")if((a.exec(b[3])||\"\").length>1||/^\\w/.test(b[3]))b[3]=m(b[3],null,null,c);else{var g=m.filter(b[3],c,d,!0^f);d||e.push.apply(e,g);return!1}else if(o.match.POS.test(b[0])||o.match.CHILD.test(b[0]))return!0;return b},POS:function(a){a.unshift(!0);return a}},filters:{enabled:function(a){return a.disabled===!1&&a.type!==\"hidden\"},disabled:function(a){return a.disabled===!0},checked:function(a){return a.checked===!0},selected:function(a){a.parentNode&&a.parentNode.selectedIndex;return a.selected===!0},parent:function(a){return!!a.firstChild},empty:function(a){return!a.firstChild},has:function(a,b,c){return!!m(c[3],a).length},header:function(a){return/h\\d/i.test(a.nodeName)},text:function(a){var b=a.getAttribute(\"type\"),c=a.type;return a.nodeName.toLowerCase()===\"input\"&&\"text\"===c&&(b===c||b===null)},radio:function(a){return a.nodeName.toLowerCase()===\"input\"&&\"radio\"===a.type},checkbox:function(a){return a.nodeName.toLowerCase()===\"input\"&&\"checkbox\"===a.type},file:function(a){return a.nodeName.toLowerCase()===\"input\"&&\"file\"===a.type},password:function(a){return a.nodeName.toLowerCase()===\"input\"&&\"password\"===a.type},submit:function(a){var b=a.nodeName.toLowerCase();return(b===\"input\"||b===\"button\")&&\"submit\"===a.type},image:function(a){return a.nodeName.toLowerCase()===\"input\"&&\"image\"===a.type},reset:function(a){var b=a.nodeName.toLowerCase();return(b===\"input\"||b===\"button\")&&\"reset\"===a.type},button:function(a){var b=a.nodeName.toLowerCase();return b===\"input\"&&\"button\"===a.type||b===\"button\"},input:function(a){return/input|select|textarea|button/i.test(a.nodeName)},focus:function(a){return a===a.ownerDocument.activeElement}},setFilters:{first:function(a,b){return b===0},last:function(a,b,c,d){return b===d.length-1},even:function(a,b){return b%2===0},odd:function(a,b){return b%2===1},lt:function(a,b,c){return b<c[3]-0},gt:function(a,b,c){return b>c[3]-0},nth:function(a,b,c){return c[3]-0===b},eq:function(a,b,c){return c[3]-0===b}},filter:{PSEUDO:function(a,b,c,d){var e=b[1],f=o.filters[e];if(f)return f(a,c,b,d);if(e===\"contains\")return(a.textContent||a.innerText||n([a])||\"\").indexOf(b[3])>=0;if(e===\"not\"){var g=b[3];for(var h=0,i=g.length;h<i;h++)if(g[h]===a)return!1;return!0}m.error(e)},CHILD:function(a,b){var c,e,f,g,h,i,j,k=b[1],l=a;switch(k){case\"only\":case\"first\":while(l=l.previousSibling)if(l.nodeType===1)return!1;if(k===\"first\")return!0;l=a;case\"last\":while(l=l.nextSibling)if(l.nodeType===1)return!1;return!0;case\"nth\":c=b[2],e=b[3];if(c===1&&e===0)return!0;f=b[0],g=a.parentNode;if(g&&(g[d]!==f||!a.nodeIndex)){i=0;for(l=g.firstChild;l;l=l.nextSibling)l.nodeType===1&&(l.nodeIndex=++i);g[d]=f}j=a.nodeIndex-e;return c===0?j===0:j%c===0&&j/c>=0}},ID:function(a,b){return a.nodeType===1&&a.getAttribute(\"id\")===b},TAG:function(a,b){return b===\"*\"&&a.nodeType===1||!!a.nodeName&&a.nodeName.toLowerCase()===b},CLASS:function(a,b){return(\" \"+(a.className||a.getAttribute(\"class\"))+\" \").indexOf(b)>-1},ATTR:function(a,b){var c=b[1],d=m.attr?m.attr(a,c):o.attrHandle[c]?o.attrHandle[c](a):a[c]!=null?a[c]:a.getAttribute(c),e=d+\"\",f=b[2],g=b[4];return d==null?f===\"!=\":!f&&m.attr?d!=null:f===\"=\"?e===g:f===\"*=\"?e.indexOf(g)>=0:f===\"~=\"?(\" \"+e+\" \").indexOf(g)>=0:g?f===\"!=\"?e!==g:f===\"^=\"?e.indexOf(g)===0:f===\"$=\"?e.substr(e.length-g.length)===g:f===\"|=\"?e===g||e.substr(0,g.length+1)===g+\"-\":!1:e&&d!==!1},POS:function(a,b,c,d){var e=b[2],f=o.setFilters[e];if(f)return f(a,c,b,d)}}},p=o.match.POS,q=function(a,b){return\"\\\\\"+(b-0+1)};for(var r in o.match)o.match[r]=new RegExp(o.match[r].source+/(?![^\\[]*\\])(?![^\\(]*\\))/.source),o.leftMatch[r]=new RegExp(/(^(?:.|\\r|\\n)*?)/.source+o.match[r].source.replace(/\\\\(\\d+)/g,q));o.match.globalPOS=p;var s=function(a,b){a=Array.prototype.slice.call(a,0);if(b){b.push.apply(b,a);return b}return a};try{Array.prototype.slice.call(c.documentElement.childNodes,0)[0].nodeType}catch(t){s=function(a,b){var c=0,d=b||[];if(g.call(a)===\"[object Array]\")Array.prototype.push.apply(d,a);else if(typeof a.length==\"number\")for(var e=a.length;c<e;c++)d.push(a[c]);else for(;a[c];c++)d.push(a[c]);return d}}var u,v;c.documentElement.compareDocumentPosition?u=function(a,b){if(a===b){h=!0;return 0}if(!a.compareDocumentPosition||!b.compareDocumentPosition)return a.compareDocumentPosition?-1:1;return a.compareDocumentPosition(b)&4?-1:1}:(u=function(a,b){if(a===b){h=!0;return 0}if(a.sourceIndex&&b.sourceIndex)return a.sourceIndex-b.sourceIndex;var c,d,e=[],f=[],g=a.parentNode,i=b.parentNode,j=g;if(g===i)return v(a,b);if(!g)return-1;if(!i)return 1;while(j)e.unshift(j),j=j.parentNode;j=i;while(j)f.unshift(j),j=j.parentNode;c=e.length,d=f.length;for(var k=0;k<c&&k<d;k++)if(e[k]!==f[k])return v(e[k],f[k]);return k===c?v(a,f[k],-1):v(e[k],b,1)},v=function(a,b,c){if(a===b)return c;var d=a.nextSibling;while(d){if(d===b)return-1;d=d.nextSibling}return 1}),function(){var a=c.createElement(\"div\"),d=\"script\"+(new Date).getTime(),e=c.documentElement;a.innerHTML=\"<a name='\"+d+\"'/>\",e.insertBefore(a,e.firstChild),c.getElementById(d)&&(o.find.ID=function(a,c,d){if(typeof c.getElementById!=\"undefined\"&&!d){var e=c.getElementById(a[1]);return e?e.id===a[1]||typeof e.getAttributeNode!=\"undefined\"&&e.getAttributeNode(\"id\").nodeValue===a[1]?[e]:b:[]}},o.filter.ID=function(a,b){var c=typeof a.getAttributeNode!=\"undefined\"&&a.getAttributeNode(\"id\");return a.nodeType===1&&c&&c.nodeValue===b}),e.removeChild(a),e=a=null}(),function(){var a=c.createElement(\"div\");a.appendChild(c.createComment(\"\")),a.getElementsByTagName(\"*\").length>0&&(o.find.TAG=function(a,b){var c=b.getElementsByTagName(a[1]);if(a[1]===\"*\"){var d=[];for(var e=0;c[e];e++)c[e].nodeType===1&&d.push(c[e]);c=d}return c}),a.innerHTML=\"<a href='#'></a>\",a.firstChild&&typeof a.firstChild.getAttribute!=\"undefined\"&&a.firstChild.getAttribute(\"href\")!==\"#\"&&(o.attrHandle.href=function(a){return a.getAttribute(\"href\",2)}),a=null}(),c.querySelectorAll&&function(){var a=m,b=c.createElement(\"div\"),d=\"__sizzle__\";b.innerHTML=\"<p class='TEST'></p>\";if(!b.querySelectorAll||b.querySelectorAll(\".TEST\").length!==0){m=function(b,e,f,g){e=e||c;if(!g&&!m.isXML(e)){var h=/^(\\w+$)|^\\.([\\w\\-]+$)|^#([\\w\\-]+$)/.exec(b);if(h&&(e.nodeType===1||e.nodeType===9)){if(h[1])return s(e.getElementsByTagName(b),f);if(h[2]&&o.find.CLASS&&e.getElementsByClassName)return s(e.getElementsByClassName(h[2]),f)}if(e.nodeType===9){if(b===\"body\"&&e.body)return s([e.body],f);if(h&&h[3]){var i=e.getElementById(h[3]);if(!i||!i.parentNode)return s([],f);if(i.id===h[3])return s([i],f)}try{return s(e.querySelectorAll(b),f)}catch(j){}}else if(e.nodeType===1&&e.nodeName.toLowerCase()!==\"object\"){var k=e,l=e.getAttribute(\"id\"),n=l||d,p=e.parentNode,q=/^\\s*[+~]/.test(b);l?n=n.replace(/'/g,\"\\\\$&\"):e.setAttribute(\"id\",n),q&&p&&(e=e.parentNode);try{if(!q||p)return s(e.querySelectorAll(\"[id='\"+n+\"'] \"+b),f)}catch(r){}finally{l||k.removeAttribute(\"id\")}}}return a(b,e,f,g)};for(var e in a)m[e]=a[e];b=null}}(),function(){var a=c.documentElement,b=a.matchesSelector||a.mozMatchesSelector||a.webkitMatchesSelector||a.msMatchesSelector;if(b){var d=!b.call(c.createElement(\"div\"),\"div\"),e=!1;try{b.call(c.documentElement,\"[test!='']:sizzle\")}catch(f){e=!0}m.matchesSelector=function(a,c){c=c.replace(/\\=\\s*([^'\"\\]]*)\\s*\\]/g,\"='$1']\");if(!m.isXML(a))try{if(e||!o.match.PSEUDO.test(c)&&!/!=/.test(c)){var f=b.call(a,c);if(f||!d||a.document&&a.document.nodeType!==11)return f}}catch(g){}return m(c,null,null,[a]).length>0}}}(),function(){var a=c.createElement(\"div\");a.innerHTML=\"<div class='test e'></div><div class='test'></div>\";if(!!a.getElementsByClassName&&a.getElementsByClassName(\"e\").length!==0){a.lastChild.className=\"e\";if(a.getElementsByClassName(\"e\").length===1)return;o.order.splice(1,0,\"CLASS\"),o.find.CLASS=function(a,b,c){if(typeof b.getElementsByClassName!=\"undefined\"&&!c)return b.getElementsByClassName(a[1])},a=null}}(),c.documentElement.contains?m.contains=function(a,b){return a!==b&&(a.contains?a.contains(b):!0)}:c.documentElement.compareDocumentPosition?m.contains=function(a,b){return!!(a.compareDocumentPosition(b)&16)}:m.contains=function(){return!1},m.isXML=function(a){var b=(a?a.ownerDocument||a:0).documentElement;return b?b.nodeName!==\"HTML\":!1};var y=function(a,b,c){var d,e=[],f=\"\",g=b.nodeType?[b]:b;while(d=o.match.PSEUDO.exec(a))f+=d[0],a=a.replace(o.match.PSEUDO,\"\");a=o.relative[a]?a+\"*\":a;for(var h=0,i=g.length;h<i;h++)m(a,g[h],e,c);return m.filter(f,e)};m.attr=f.attr,m.selectors.attrMap={},f.find=m,f.expr=m.selectors,f.expr[\":\"]=f.expr.filters,f.unique=m.uniqueSort,f.text=m.getText,f.isXMLDoc=m.isXML,f.contains=m.contains}();var L=/Until$/,M=/^(?:parents|prevUntil|prevAll)/,N=/,/,O=/^.[^:#\\[\\.,]*$/,P=Array.prototype.slice,Q=f.expr.match.globalPOS,R={children:!0,contents:!0,next:!0,prev:!0};f.fn.extend({find:function(a){var b=this,c,d;if(typeof a!=\"string\")return f(a).filter(function(){for(c=0,d=b.length;c<d;c++)if(f.contains(b[c],this))return!0});var e=this.pushStack(\"\",\"find\",a),g,h,i;for(c=0,d=this.length;c<d;c++){g=e.length,f.find(a,this[c],e);if(c>0)for(h=g;h<e.length;h++)for(i=0;i<g;i++)if(e[i]===e[h]){e.splice(h--,1);break}}return e},has:function(a){var b=f(a);return this.filter(function(){for(var a=0,c=b.length;a<c;a++)if(f.contains(this,b[a]))return!0})},not:function(a){return this.pushStack(T(this,a,!1),\"not\",a)},filter:function(a){return this.pushStack(T(this,a,!0),\"filter\",a)},is:function(a){return!!a&&(typeof a==\"string\"?Q.test(a)?f(a,this.context).index(this[0])>=0:f.filter(a,this).length>0:this.filter(a).length>0)},closest:function(a,b){var c=[],d,e,g=this[0];if(f.isArray(a)){var h=1;while(g&&g.ownerDocument&&g!==b){for(d=0;d<a.length;d++)f(g).is(a[d])&&c.push({selector:a[d],elem:g,level:h});g=g.parentNode,h++}return c}var i=Q.test(a)||typeof a!=\"string\"?f(a,b||this.context):0;for(d=0,e=this.length;d<e;d++){g=this[d];while(g){if(i?i.index(g)>-1:f.find.matchesSelector(g,a)){c.push(g);break}g=g.parentNode;if(!g||!g.ownerDocument||g===b||g.nodeType===11)break}}c=c.length>1?f.unique(c):c;return this.pushStack(c,\"closest\",a)},index:function(a){if(!a)return this[0]&&this[0].parentNode?this.prevAll().length:-1;if(typeof a==\"string\")return f.inArray(this[0],f(a));return f.inArray(a.jquery?a[0]:a,this)},add:function(a,b){var c=typeof a==\"string\"?f(a,b):f.makeArray(a&&a.nodeType?[a]:a),d=f.merge(this.get(),c);return this.pushStack(S(c[0])||S(d[0])?d:f.unique(d))},andSelf:function(){return this.add(this.prevObject)}}),f.each({parent:function(a){var b=a.parentNode;return b&&b.nodeType!==11?b:null},parents:function(a){return f.dir(a,\"parentNode\")},parentsUntil:function(a,b,c){return f.dir(a,\"parentNode\",c)},next:function(a){return f.nth(a,2,\"nextSibling\")},prev:function(a){return f.nth(a,2,\"previousSibling\")},nextAll:function(a){return f.dir(a,\"nextSibling\")},prevAll:function(a){return f.dir(a,\"previousSibling\")},nextUntil:function(a,b,c){return f.dir(a,\"nextSibling\",c)},prevUntil:function(a,b,c){return f.dir(a,\"previousSibling\",c)},siblings:function(a){return f.sibling((a.parentNode||{}).firstChild,a)},children:function(a){return f.sibling(a.firstChild)},contents:function(a){return f.nodeName(a,\"iframe\")?a.contentDocument||a.contentWindow.document:f.makeArray(a.childNodes)}},function(a,b){f.fn[a]=function(c,d){var e=f.map(this,b,c);L.test(a)||(d=c),d&&typeof d==\"string\"&&(e=f.filter(d,e)),e=this.length>1&&!R[a]?f.unique(e):e,(this.length>1||N.test(d))&&M.test(a)&&(e=e.reverse());return this.pushStack(e,a,P.call(arguments).join(\",\"))}}),f.extend({filter:function(a,b,c){c&&(a=\":not(\"+a+\")\");return b.length===1?f.find.matchesSelector(b[0],a)?[b[0]]:[]:f.find.matches(a,b)},dir:function(a,c,d){var e=[],g=a[c];while(g&&g.nodeType!==9&&(d===b||g.nodeType!==1||!f(g).is(d)))g.nodeType===1&&e.push(g),g=g[c];return e},nth:function(a,b,c,d){b=b||1;var e=0;for(;a;a=a[c])if(a.nodeType===1&&++e===b)break;return a},sibling:function(a,b){var c=[];for(;a;a=a.nextSibling)a.nodeType===1&&a!==b&&c.push(a);return c}});var V=\"abbr|article|aside|audio|bdi|canvas|data|datalist|details|figcaption|figure|footer|header|hgroup|mark|meter|nav|output|progress|section|summary|time|video\",W=/ jQuery\\d+=\"(?:\\d+|null)\"/g,X=/^\\s+/,Y=/<(?!area|br|col|embed|hr|img|input|link|meta|param)(([\\w:]+)[^>]*)\\/>/ig,Z=/<([\\w:]+)/,$=/<tbody/i,_=/<|&#?\\w+;/,ba=/<(?:script|style)/i,bb=/<(?:script|object|embed|option|style)/i,bc=new RegExp(\"<(?:\"+V+\")[\\\\s/>]\",\"i\"),bd=/checked\\s*(?:[^=]|=\\s*.checked.)/i,be=/\\/(java|ecma)script/i,bf=/^\\s*<!(?:\\[CDATA\\[|\\-\\-)/,bg={option:[1,\"<select multiple='multiple'>\",\"</select>\"],legend:[1,\"<fieldset>\",\"</fieldset>\"],thead:[1,\"<table>\",\"</table>\"],tr:[2,\"<table><tbody>\",\"</tbody></table>\"],td:[3,\"<table><tbody><tr>\",\"</tr></tbody></table>\"],col:[2,\"<table><tbody></tbody><colgroup>\",\"</colgroup></table>\"],area:[1,\"<map>\",\"</map>\"],_default:[0,\"\",\"\"]},bh=U(c);bg.optgroup=bg.option,bg.tbody=bg.tfoot=bg.colgroup=bg.caption=bg.thead,bg.th=bg.td,f.support.htmlSerialize||(bg._default=[1,\"div<div>\",\"</div>\"]),f.fn.extend({text:function(a){return f.access(this,function(a){return a===b?f.text(this):this.empty().append((this[0]&&this[0].ownerDocument||c).createTextNode(a))},null,a,arguments.length)},wrapAll:function(a){if(f.isFunction(a))return this.each(function(b){f(this).wrapAll(a.call(this,b))});if(this[0]){var b=f(a,this[0].ownerDocument).eq(0).clone(!0);this[0].parentNode&&b.insertBefore(this[0]),b.map(function(){var a=this;while(a.firstChild&&a.firstChild.nodeType===1)a=a.firstChild;return a}).append(this)}return this},wrapInner:function(a){if(f.isFunction(a))return this.each(function(b){f(this).wrapInner(a.call(this,b))});return this.each(function(){var b=f(this),c=b.contents();c.length?c.wrapAll(a):b.append(a)})},wrap:function(a){var b=f.isFunction(a);return this.each(function(c){f(this).wrapAll(b?a.call(this,c):a)})},unwrap:function(){return this.parent().each(function(){f.nodeName(this,\"body\")||f(this).replaceWith(this.childNodes)}).end()},append:function(){return this.domManip(arguments,!0,function(a){this.nodeType===1&&this.appendChild(a)})},prepend:function(){return this.domManip(arguments,!0,function(a){this.nodeType===1&&this.insertBefore(a,this.firstChild)})},before:function(){if(this[0]&&this[0].parentNode)return this.domManip(arguments,!1,function(a){this.parentNode.insertBefore(a,this)});if(arguments.length){var a=f\x0d\n.clean(arguments);a.push.apply(a,this.toArray());return this.pushStack(a,\"before\",arguments)}},after:function(){if(this[0]&&this[0].parentNode)return this.domManip(arguments,!1,function(a){this.parentNode.insertBefore(a,this.nextSibling)});if(arguments.length){var a=this.pushStack(this,\"after\",arguments);a.push.apply(a,f.clean(arguments));return a}},remove:function(a,b){for(var c=0,d;(d=this[c])!=null;c++)if(!a||f.filter(a,[d]).length)!b&&d.nodeType===1&&(f.cleanData(d.getElementsByTagName(\"*\")),f.cleanData([d])),d.parentNode&&d.parentNode.removeChild(d);return this},empty:function(){for(var a=0,b;(b=this[a])!=null;a++){b.nodeType===1&&f.cleanData(b.getElementsByTagName(\"*\"));while(b.firstChild)b.removeChild(b.firstChild)}return this},clone:function(a,b){a=a==null?!1:a,b=b==null?a:b;return this.map(function(){return f.clone(this,a,b)})},html:function(a){return f.access(this,function(a){var c=this[0]||{},d=0,e=this.length;if(a===b)return c.nodeType===1?c.innerHTML.replace(W,\"\"):null;if(typeof a==\"string\"&&!ba.test(a)&&(f.support.leadingWhitespace||!X.test(a))&&!bg[(Z.exec(a)||[\"\",\"\"])[1].toLowerCase()]){a=a.replace(Y,\"<$1></$2>\");try{for(;d<e;d++)c=this[d]||{},c.nodeType===1&&(f.cleanData(c.getElementsByTagName(\"*\")),c.innerHTML=a);c=0}catch(g){}}c&&this.empty().append(a)},null,a,arguments.length)},replaceWith:function(a){if(this[0]&&this[0].parentNode){if(f.isFunction(a))return this.each(function(b){var c=f(this),d=c.html();c.replaceWith(a.call(this,b,d))});typeof a!=\"string\"&&(a=f(a).detach());return this.each(function(){var b=this.nextSibling,c=this.parentNode;f(this).remove(),b?f(b).before(a):f(c).append(a)})}return this.length?this.pushStack(f(f.isFunction(a)?a():a),\"replaceWith\",a):this},detach:function(a){return this.remove(a,!0)},domManip:function(a,c,d){var e,g,h,i,j=a[0],k=[];if(!f.support.checkClone&&arguments.length===3&&typeof j==\"string\"&&bd.test(j))return this.each(function(){f(this).domManip(a,c,d,!0)});if(f.isFunction(j))return this.each(function(e){var g=f(this);a[0]=j.call(this,e,c?g.html():b),g.domManip(a,c,d)});if(this[0]){i=j&&j.parentNode,f.support.parentNode&&i&&i.nodeType===11&&i.childNodes.length===this.length?e={fragment:i}:e=f.buildFragment(a,this,k),h=e.fragment,h.childNodes.length===1?g=h=h.firstChild:g=h.firstChild;if(g){c=c&&f.nodeName(g,\"tr\");for(var l=0,m=this.length,n=m-1;l<m;l++)d.call(c?bi(this[l],g):this[l],e.cacheable||m>1&&l<n?f.clone(h,!0,!0):h)}k.length&&f.each(k,function(a,b){b.src?f.ajax({type:\"GET\",global:!1,url:b.src,async:!1,dataType:\"script\"}):f.globalEval((b.text||b.textContent||b.innerHTML||\"\").replace(bf,\"/*$0*/\")),b.parentNode&&b.parentNode.removeChild(b)})}return this}}),f.buildFragment=function(a,b,d){var e,g,h,i,j=a[0];b&&b[0]&&(i=b[0].ownerDocument||b[0]),i.createDocumentFragment||(i=c),a.length===1&&typeof j==\"string\"&&j.length<512&&i===c&&j.charAt(0)===\"<\"&&!bb.test(j)&&(f.support.checkClone||!bd.test(j))&&(f.support.html5Clone||!bc.test(j))&&(g=!0,h=f.fragments[j],h&&h!==1&&(e=h)),e||(e=i.createDocumentFragment(),f.clean(a,i,e,d)),g&&(f.fragments[j]=h?e:1);return{fragment:e,cacheable:g}},f.fragments={},f.each({appendTo:\"append\",prependTo:\"prepend\",insertBefore:\"before\",insertAfter:\"after\",replaceAll:\"replaceWith\"},function(a,b){f.fn[a]=function(c){var d=[],e=f(c),g=this.length===1&&this[0].parentNode;if(g&&g.nodeType===11&&g.childNodes.length===1&&e.length===1){e[b](this[0]);return this}for(var h=0,i=e.length;h<i;h++){var j=(h>0?this.clone(!0):this).get();f(e[h])[b](j),d=d.concat(j)}return this.pushStack(d,a,e.selector)}}),f.extend({clone:function(a,b,c){var d,e,g,h=f.support.html5Clone||f.isXMLDoc(a)||!bc.test(\"<\"+a.nodeName+\">\")?a.cloneNode(!0):bo(a);if((!f.support.noCloneEvent||!f.support.noCloneChecked)&&(a.nodeType===1||a.nodeType===11)&&!f.isXMLDoc(a)){bk(a,h),d=bl(a),e=bl(h);for(g=0;d[g];++g)e[g]&&bk(d[g],e[g])}if(b){bj(a,h);if(c){d=bl(a),e=bl(h);for(g=0;d[g];++g)bj(d[g],e[g])}}d=e=null;return h},clean:function(a,b,d,e){var g,h,i,j=[];b=b||c,typeof b.createElement==\"undefined\"&&(b=b.ownerDocument||b[0]&&b[0].ownerDocument||c);for(var k=0,l;(l=a[k])!=null;k++){typeof l==\"number\"&&(l+=\"\");if(!l)continue;if(typeof l==\"string\")if(!_.test(l))l=b.createTextNode(l);else{l=l.replace(Y,\"<$1></$2>\");var m=(Z.exec(l)||[\"\",\"\"])[1].toLowerCase(),n=bg[m]||bg._default,o=n[0],p=b.createElement(\"div\"),q=bh.childNodes,r;b===c?bh.appendChild(p):U(b).appendChild(p),p.innerHTML=n[1]+l+n[2];while(o--)p=p.lastChild;if(!f.support.tbody){var s=$.test(l),t=m===\"table\"&&!s?p.firstChild&&p.firstChild.childNodes:n[1]===\"<table>\"&&!s?p.childNodes:[];for(i=t.length-1;i>=0;--i)f.nodeName(t[i],\"tbody\")&&!t[i].childNodes.length&&t[i].parentNode.removeChild(t[i])}!f.support.leadingWhitespace&&X.test(l)&&p.insertBefore(b.createTextNode(X.exec(l)[0]),p.firstChild),l=p.childNodes,p&&(p.parentNode.removeChild(p),q.length>0&&(r=q[q.length-1],r&&r.parentNode&&r.parentNode.removeChild(r)))}var u;if(!f.support.appendChecked)if(l[0]&&typeof (u=l.length)==\"number\")for(i=0;i<u;i++)bn(l[i]);else bn(l);l.nodeType?j.push(l):j=f.merge(j,l)}if(d){g=function(a){return!a.type||be.test(a.type)};for(k=0;j[k];k++){h=j[k];if(e&&f.nodeName(h,\"script\")&&(!h.type||be.test(h.type)))e.push(h.parentNode?h.parentNode.removeChild(h):h);else{if(h.nodeType===1){var v=f.grep(h.getElementsByTagName(\"script\"),g);j.splice.apply(j,[k+1,0].concat(v))}d.appendChild(h)}}}return j},cleanData:function(a){var b,c,d=f.cache,e=f.event.special,g=f.support.deleteExpando;for(var h=0,i;(i=a[h])!=null;h++){if(i.nodeName&&f.noData[i.nodeName.toLowerCase()])continue;c=i[f.expando];if(c){b=d[c];if(b&&b.events){for(var j in b.events)e[j]?f.event.remove(i,j):f.removeEvent(i,j,b.handle);b.handle&&(b.handle.elem=null)}g?delete i[f.expando]:i.removeAttribute&&i.removeAttribute(f.expando),delete d[c]}}}});var bp=/alpha\\([^)]*\\)/i,bq=/opacity=([^)]*)/,br=/([A-Z]|^ms)/g,bs=/^[\\-+]?(?:\\d*\\.)?\\d+$/i,bt=/^-?(?:\\d*\\.)?\\d+(?!px)[^\\d\\s]+$/i,bu=/^([\\-+])=([\\-+.\\de]+)/,bv=/^margin/,bw={position:\"absolute\",visibility:\"hidden\",display:\"block\"},bx=[\"Top\",\"Right\",\"Bottom\",\"Left\"],by,bz,bA;f.fn.css=function(a,c){return f.access(this,function(a,c,d){return d!==b?f.style(a,c,d):f.css(a,c)},a,c,arguments.length>1)},f.extend({cssHooks:{opacity:{get:function(a,b){if(b){var c=by(a,\"opacity\");return c===\"\"?\"1\":c}return a.style.opacity}}},cssNumber:{fillOpacity:!0,fontWeight:!0,lineHeight:!0,opacity:!0,orphans:!0,widows:!0,zIndex:!0,zoom:!0},cssProps:{\"float\":f.support.cssFloat?\"cssFloat\":\"styleFloat\"},style:function(a,c,d,e){if(!!a&&a.nodeType!==3&&a.nodeType!==8&&!!a.style){var g,h,i=f.camelCase(c),j=a.style,k=f.cssHooks[i];c=f.cssProps[i]||i;if(d===b){if(k&&\"get\"in k&&(g=k.get(a,!1,e))!==b)return g;return j[c]}h=typeof d,h===\"string\"&&(g=bu.exec(d))&&(d=+(g[1]+1)*+g[2]+parseFloat(f.css(a,c)),h=\"number\");if(d==null||h===\"number\"&&isNaN(d))return;h===\"number\"&&!f.cssNumber[i]&&(d+=\"px\");if(!k||!(\"set\"in k)||(d=k.set(a,d))!==b)try{j[c]=d}catch(l){}}},css:function(a,c,d){var e,g;c=f.camelCase(c),g=f.cssHooks[c],c=f.cssProps[c]||c,c===\"cssFloat\"&&(c=\"float\");if(g&&\"get\"in g&&(e=g.get(a,!0,d))!==b)return e;if(by)return by(a,c)},swap:function(a,b,c){var d={},e,f;for(f in b)d[f]=a.style[f],a.style[f]=b[f];e=c.call(a);for(f in b)a.style[f]=d[f];return e}}),f.curCSS=f.css,c.defaultView&&c.defaultView.getComputedStyle&&(bz=function(a,b){var c,d,e,g,h=a.style;b=b.replace(br,\"-$1\").toLowerCase(),(d=a.ownerDocument.defaultView)&&(e=d.getComputedStyle(a,null))&&(c=e.getPropertyValue(b),c===\"\"&&!f.contains(a.ownerDocument.documentElement,a)&&(c=f.style(a,b))),!f.support.pixelMargin&&e&&bv.test(b)&&bt.test(c)&&(g=h.width,h.width=c,c=e.width,h.width=g);return c}),c.documentElement.currentStyle&&(bA=function(a,b){var c,d,e,f=a.currentStyle&&a.currentStyle[b],g=a.style;f==null&&g&&(e=g[b])&&(f=e),bt.test(f)&&(c=g.left,d=a.runtimeStyle&&a.runtimeStyle.left,d&&(a.runtimeStyle.left=a.currentStyle.left),g.left=b===\"fontSize\"?\"1em\":f,f=g.pixelLeft+\"px\",g.left=c,d&&(a.runtimeStyle.left=d));return f===\"\"?\"auto\":f}),by=bz||bA,f.each([\"height\",\"width\"],function(a,b){f.cssHooks[b]={get:function(a,c,d){if(c)return a.offsetWidth!==0?bB(a,b,d):f.swap(a,bw,function(){return bB(a,b,d)})},set:function(a,b){return bs.test(b)?b+\"px\":b}}}),f.support.opacity||(f.cssHooks.opacity={get:function(a,b){return bq.test((b&&a.currentStyle?a.currentStyle.filter:a.style.filter)||\"\")?parseFloat(RegExp.$1)/100+\"\":b?\"1\":\"\"},set:function(a,b){var c=a.style,d=a.currentStyle,e=f.isNumeric(b)?\"alpha(opacity=\"+b*100+\")\":\"\",g=d&&d.filter||c.filter||\"\";c.zoom=1;if(b>=1&&f.trim(g.replace(bp,\"\"))===\"\"){c.removeAttribute(\"filter\");if(d&&!d.filter)return}c.filter=bp.test(g)?g.replace(bp,e):g+\" \"+e}}),f(function(){f.support.reliableMarginRight||(f.cssHooks.marginRight={get:function(a,b){return f.swap(a,{display:\"inline-block\"},function(){return b?by(a,\"margin-right\"):a.style.marginRight})}})}),f.expr&&f.expr.filters&&(f.expr.filters.hidden=function(a){var b=a.offsetWidth,c=a.offsetHeight;return b===0&&c===0||!f.support.reliableHiddenOffsets&&(a.style&&a.style.display||f.css(a,\"display\"))===\"none\"},f.expr.filters.visible=function(a){return!f.expr.filters.hidden(a)}),f.each({margin:\"\",padding:\"\",border:\"Width\"},function(a,b){f.cssHooks[a+b]={expand:function(c){var d,e=typeof c==\"string\"?c.split(\" \"):[c],f={};for(d=0;d<4;d++)f[a+bx[d]+b]=e[d]||e[d-2]||e[0];return f}}});var bC=/%20/g,bD=/\\[\\]$/,bE=/\\r?\\n/g,bF=/#.*$/,bG=/^(.*?):[ \\t]*([^\\r\\n]*)\\r?$/mg,bH=/^(?:color|date|datetime|datetime-local|email|hidden|month|number|password|range|search|tel|text|time|url|week)$/i,bI=/^(?:about|app|app\\-storage|.+\\-extension|file|res|widget):$/,bJ=/^(?:GET|HEAD)$/,bK=/^\\/\\//,bL=/\\?/,bM=/<script\\b[^<]*(?:(?!<\\/script>)<[^<]*)*<\\/script>/gi,bN=/^(?:select|textarea)/i,bO=/\\s+/,bP=/([?&])_=[^&]*/,bQ=/^([\\w\\+\\.\\-]+:)(?:\\/\\/([^\\/?#:]*)(?::(\\d+))?)?/,bR=f.fn.load,bS={},bT={},bU,bV,bW=[\"*/\"]+[\"*\"];try{bU=e.href}catch(bX){bU=c.createElement(\"a\"),bU.href=\"\",bU=bU.href}bV=bQ.exec(bU.toLowerCase())||[],f.fn.extend({load:function(a,c,d){if(typeof a!=\"string\"&&bR)return bR.apply(this,arguments);if(!this.length)return this;var e=a.indexOf(\" \");if(e>=0){var g=a.slice(e,a.length);a=a.slice(0,e)}var h=\"GET\";c&&(f.isFunction(c)?(d=c,c=b):typeof c==\"object\"&&(c=f.param(c,f.ajaxSettings.traditional),h=\"POST\"));var i=this;f.ajax({url:a,type:h,dataType:\"html\",data:c,complete:function(a,b,c){c=a.responseText,a.isResolved()&&(a.done(function(a){c=a}),i.html(g?f(\"<div>\").append(c.replace(bM,\"\")).find(g):c)),d&&i.each(d,[c,b,a])}});return this},serialize:function(){return f.param(this.serializeArray())},serializeArray:function(){return this.map(function(){return this.elements?f.makeArray(this.elements):this}).filter(function(){return this.name&&!this.disabled&&(this.checked||bN.test(this.nodeName)||bH.test(this.type))}).map(function(a,b){var c=f(this).val();return c==null?null:f.isArray(c)?f.map(c,function(a,c){return{name:b.name,value:a.replace(bE,\"\\r\\n\")}}):{name:b.name,value:c.replace(bE,\"\\r\\n\")}}).get()}}),f.each(\"ajaxStart ajaxStop ajaxComplete ajaxError ajaxSuccess ajaxSend\".split(\" \"),function(a,b){f.fn[b]=function(a){return this.on(b,a)}}),f.each([\"get\",\"post\"],function(a,c){f[c]=function(a,d,e,g){f.isFunction(d)&&(g=g||e,e=d,d=b);return f.ajax({type:c,url:a,data:d,success:e,dataType:g})}}),f.extend({getScript:function(a,c){return f.get(a,b,c,\"script\")},getJSON:function(a,b,c){return f.get(a,b,c,\"json\")},ajaxSetup:function(a,b){b?b$(a,f.ajaxSettings):(b=a,a=f.ajaxSettings),b$(a,b);return a},ajaxSettings:{url:bU,isLocal:bI.test(bV[1]),global:!0,type:\"GET\",contentType:\"application/x-www-form-urlencoded; charset=UTF-8\",processData:!0,async:!0,accepts:{xml:\"application/xml, text/xml\",html:\"text/html\",text:\"text/plain\",json:\"application/json, text/javascript\",\"*\":bW},contents:{xml:/xml/,html:/html/,json:/json/},responseFields:{xml:\"responseXML\",text:\"responseText\"},converters:{\"* text\":a.String,\"text html\":!0,\"text json\":f.parseJSON,\"text xml\":f.parseXML},flatOptions:{context:!0,url:!0}},ajaxPrefilter:bY(bS),ajaxTransport:bY(bT),ajax:function(a,c){function w(a,c,l,m){if(s!==2){s=2,q&&clearTimeout(q),p=b,n=m||\"\",v.readyState=a>0?4:0;var o,r,u,w=c,x=l?ca(d,v,l):b,y,z;if(a>=200&&a<300||a===304){if(d.ifModified){if(y=v.getResponseHeader(\"Last-Modified\"))f.lastModified[k]=y;if(z=v.getResponseHeader(\"Etag\"))f.etag[k]=z}if(a===304)w=\"notmodified\",o=!0;else try{r=cb(d,x),w=\"success\",o=!0}catch(A){w=\"parsererror\",u=A}}else{u=w;if(!w||a)w=\"error\",a<0&&(a=0)}v.status=a,v.statusText=\"\"+(c||w),o?h.resolveWith(e,[r,w,v]):h.rejectWith(e,[v,w,u]),v.statusCode(j),j=b,t&&g.trigger(\"ajax\"+(o?\"Success\":\"Error\"),[v,d,o?r:u]),i.fireWith(e,[v,w]),t&&(g.trigger(\"ajaxComplete\",[v,d]),--f.active||f.event.trigger(\"ajaxStop\"))}}typeof a==\"object\"&&(c=a,a=b),c=c||{};var d=f.ajaxSetup({},c),e=d.context||d,g=e!==d&&(e.nodeType||e instanceof f)?f(e):f.event,h=f.Deferred(),i=f.Callbacks(\"once memory\"),j=d.statusCode||{},k,l={},m={},n,o,p,q,r,s=0,t,u,v={readyState:0,setRequestHeader:function(a,b){if(!s){var c=a.toLowerCase();a=m[c]=m[c]||a,l[a]=b}return this},getAllResponseHeaders:function(){return s===2?n:null},getResponseHeader:function(a){var c;if(s===2){if(!o){o={};while(c=bG.exec(n))o[c[1].toLowerCase()]=c[2]}c=o[a.toLowerCase()]}return c===b?null:c},overrideMimeType:function(a){s||(d.mimeType=a);return this},abort:function(a){a=a||\"abort\",p&&p.abort(a),w(0,a);return this}};h.promise(v),v.success=v.done,v.error=v.fail,v.complete=i.add,v.statusCode=function(a){if(a){var b;if(s<2)for(b in a)j[b]=[j[b],a[b]];else b=a[v.status],v.then(b,b)}return this},d.url=((a||d.url)+\"\").replace(bF,\"\").replace(bK,bV[1]+\"//\"),d.dataTypes=f.trim(d.dataType||\"*\").toLowerCase().split(bO),d.crossDomain==null&&(r=bQ.exec(d.url.toLowerCase()),d.crossDomain=!(!r||r[1]==bV[1]&&r[2]==bV[2]&&(r[3]||(r[1]===\"http:\"?80:443))==(bV[3]||(bV[1]===\"http:\"?80:443)))),d.data&&d.processData&&typeof d.data!=\"string\"&&(d.data=f.param(d.data,d.traditional)),bZ(bS,d,c,v);if(s===2)return!1;t=d.global,d.type=d.type.toUpperCase(),d.hasContent=!bJ.test(d.type),t&&f.active++===0&&f.event.trigger(\"ajaxStart\");if(!d.hasContent){d.data&&(d.url+=(bL.test(d.url)?\"&\":\"?\")+d.data,delete d.data),k=d.url;if(d.cache===!1){var x=f.now(),y=d.url.replace(bP,\"$1_=\"+x);d.url=y+(y===d.url?(bL.test(d.url)?\"&\":\"?\")+\"_=\"+x:\"\")}}(d.data&&d.hasContent&&d.contentType!==!1||c.contentType)&&v.setRequestHeader(\"Content-Type\",d.contentType),d.ifModified&&(k=k||d.url,f.lastModified[k]&&v.setRequestHeader(\"If-Modified-Since\",f.lastModified[k]),f.etag[k]&&v.setRequestHeader(\"If-None-Match\",f.etag[k])),v.setRequestHeader(\"Accept\",d.dataTypes[0]&&d.accepts[d.dataTypes[0]]?d.accepts[d.dataTypes[0]]+(d.dataTypes[0]!==\"*\"?\", \"+bW+\"; q=0.01\":\"\"):d.accepts[\"*\"]);for(u in d.headers)v.setRequestHeader(u,d.headers[u]);if(d.beforeSend&&(d.beforeSend.call(e,v,d)===!1||s===2)){v.abort();return!1}for(u in{success:1,error:1,complete:1})v[u](d[u]);p=bZ(bT,d,c,v);if(!p)w(-1,\"No Transport\");else{v.readyState=1,t&&g.trigger(\"ajaxSend\",[v,d]),d.async&&d.timeout>0&&(q=setTimeout(function(){v.abort(\"timeout\")},d.timeout));try{s=1,p.send(l,w)}catch(z){if(s<2)w(-1,z);else throw z}}return v},param:function(a,c){var d=[],e=function(a,b){b=f.isFunction(b)?b():b,d[d.length]=encodeURIComponent(a)+\"=\"+encodeURIComponent(b)};c===b&&(c=f.ajaxSettings.traditional);if(f.isArray(a)||a.jquery&&!f.isPlainObject(a))f.each(a,function(){e(this.name,this.value)});else for(var g in a)b_(g,a[g],c,e);return d.join(\"&\").replace(bC,\"+\")}}),f.extend({active:0,lastModified:{},etag:{}});var cc=f.now(),cd=/(\\=)\\?(&|$)|\\?\\?/i;f.ajaxSetup({jsonp:\"callback\",jsonpCallback:function(){return f.expando+\"_\"+cc++}}),f.ajaxPrefilter(\"json jsonp\",function(b,c,d){var e=typeof b.data==\"string\"&&/^application\\/x\\-www\\-form\\-urlencoded/.test(b.contentType);if(b.dataTypes[0]===\"jsonp\"||b.jsonp!==!1&&(cd.test(b.url)||e&&cd.test(b.data))){var g,h=b.jsonpCallback=f.isFunction(b.jsonpCallback)?b.jsonpCallback():b.jsonpCallback,i=a[h],j=b.url,k=b.data,l=\"$1\"+h+\"$2\";b.jsonp!==!1&&(j=j.replace(cd,l),b.url===j&&(e&&(k=k.replace(cd,l)),b.data===k&&(j+=(/\\?/.test(j)?\"&\":\"?\")+b.jsonp+\"=\"+h))),b.url=j,b.data=k,a[h]=function(a){g=[a]},d.always(function(){a[h]=i,g&&f.isFunction(i)&&a[h](g[0])}),b.converters[\"script json\"]=function(){g||f.error(h+\" was not called\");return g[0]},b.dataTypes[0]=\"json\";return\"script\"}}),f.ajaxSetup({accepts:{script:\"text/javascript, application/javascript, application/ecmascript, application/x-ecmascript\"},contents:{script:/javascript|ecmascript/},converters:{\"text script\":function(a){f.globalEval(a);return a}}}),f.ajaxPrefilter(\"script\",function(a){a.cache===b&&(a.cache=!1),a.crossDomain&&(a.type=\"GET\",a.global=!1)}),f.ajaxTransport(\"script\",function(a){if(a.crossDomain){var d,e=c.head||c.getElementsByTagName(\"head\")[0]||c.documentElement;return{send:function(f,g){d=c.createElement(\"script\"),d.async=\"async\",a.scriptCharset&&(d.charset=a.scriptCharset),d.src=a.url,d.onload=d.onreadystatechange=function(a,c){if(c||!d.readyState||/loaded|complete/.test(d.readyState))d.onload=d.onreadystatechange=null,e&&d.parentNode&&e.removeChild(d),d=b,c||g(200,\"success\")},e.insertBefore(d,e.firstChild)},abort:function(){d&&d.onload(0,1)}}}});var ce=a.ActiveXObject?function(){for(var a in cg)cg[a](0,1)}:!1,cf=0,cg;f.ajaxSettings.xhr=a.ActiveXObject?function(){return!this.isLocal&&ch()||ci()}:ch,function(a){f.extend(f.support,{ajax:!!a,cors:!!a&&\"withCredentials\"in a})}(f.ajaxSettings.xhr()),f.support.ajax&&f.ajaxTransport(function(c){if(!c.crossDomain||f.support.cors){var d;return{send:function(e,g){var h=c.xhr(),i,j;c.username?h.open(c.type,c.url,c.async,c.username,c.password):h.open(c.type,c.url,c.async);if(c.xhrFields)for(j in c.xhrFields)h[j]=c.xhrFields[j];c.mimeType&&h.overrideMimeType&&h.overrideMimeType(c.mimeType),!c.crossDomain&&!e[\"X-Requested-With\"]&&(e[\"X-Requested-With\"]=\"XMLHttpRequest\");try{for(j in e)h.setRequestHeader(j,e[j])}catch(k){}h.send(c.hasContent&&c.data||null),d=function(a,e){var j,k,l,m,n;try{if(d&&(e||h.readyState===4)){d=b,i&&(h.onreadystatechange=f.noop,ce&&delete cg[i]);if(e)h.readyState!==4&&h.abort();else{j=h.status,l=h.getAllResponseHeaders(),m={},n=h.responseXML,n&&n.documentElement&&(m.xml=n);try{m.text=h.responseText}catch(a){}try{k=h.statusText}catch(o){k=\"\"}!j&&c.isLocal&&!c.crossDomain?j=m.text?200:404:j===1223&&(j=204)}}}catch(p){e||g(-1,p)}m&&g(j,k,m,l)},!c.async||h.readyState===4?d():(i=++cf,ce&&(cg||(cg={},f(a).unload(ce)),cg[i]=d),h.onreadystatechange=d)},abort:function(){d&&d(0,1)}}}});var cj={},ck,cl,cm=/^(?:toggle|show|hide)$/,cn=/^([+\\-]=)?([\\d+.\\-]+)([a-z%]*)$/i,co,cp=[[\"height\",\"marginTop\",\"marginBottom\",\"paddingTop\",\"paddingBottom\"],[\"width\",\"marginLeft\",\"marginRight\",\"paddingLeft\",\"paddingRight\"],[\"opacity\"]],cq;f.fn.extend({show:function(a,b,c){var d,e;if(a||a===0)return this.animate(ct(\"show\",3),a,b,c);for(var g=0,h=this.length;g<h;g++)d=this[g],d.style&&(e=d.style.display,!f._data(d,\"olddisplay\")&&e===\"none\"&&(e=d.style.display=\"\"),(e===\"\"&&f.css(d,\"display\")===\"none\"||!f.contains(d.ownerDocument.documentElement,d))&&f._data(d,\"olddisplay\",cu(d.nodeName)));for(g=0;g<h;g++){d=this[g];if(d.style){e=d.style.display;if(e===\"\"||e===\"none\")d.style.display=f._data(d,\"olddisplay\")||\"\"}}return this},hide:function(a,b,c){if(a||a===0)return this.animate(ct(\"hide\",3),a,b,c);var d,e,g=0,h=this.length;for(;g<h;g++)d=this[g],d.style&&(e=f.css(d,\"display\"),e!==\"none\"&&!f._data(d,\"olddisplay\")&&f._data(d,\"olddisplay\",e));for(g=0;g<h;g++)this[g].style&&(this[g].style.display=\"none\");return this},_toggle:f.fn.toggle,toggle:function(a,b,c){var d=typeof a==\"boolean\";f.isFunction(a)&&f.isFunction(b)?this._toggle.apply(this,arguments):a==null||d?this.each(function(){var b=d?a:f(this).is(\":hidden\");f(this)[b?\"show\":\"hide\"]()}):this.animate(ct(\"toggle\",3),a,b,c);return this},fadeTo:function(a,b,c,d){return this.filter(\":hidden\").css(\"opacity\",0).show().end().animate({opacity:b},a,c,d)},animate:function(a,b,c,d){function g(){e.queue===!1&&f._mark(this);var b=f.extend({},e),c=this.nodeType===1,d=c&&f(this).is(\":hidden\"),g,h,i,j,k,l,m,n,o,p,q;b.animatedProperties={};for(i in a){g=f.camelCase(i),i!==g&&(a[g]=a[i],delete a[i]);if((k=f.cssHooks[g])&&\"expand\"in k){l=k.expand(a[g]),delete a[g];for(i in l)i in a||(a[i]=l[i])}}for(g in a){h=a[g],f.isArray(h)?(b.animatedProperties[g]=h[1],h=a[g]=h[0]):b.animatedProperties[g]=b.specialEasing&&b.specialEasing[g]||b.easing||\"swing\";if(h===\"hide\"&&d||h===\"show\"&&!d)return b.complete.call(this);c&&(g===\"height\"||g===\"width\")&&(b.overflow=[this.style.overflow,this.style.overflowX,this.style.overflowY],f.css(this,\"display\")===\"inline\"&&f.css(this,\"float\")===\"none\"&&(!f.support.inlineBlockNeedsLayout||cu(this.nodeName)===\"inline\"?this.style.display=\"inline-block\":this.style.zoom=1))}b.overflow!=null&&(this.style.overflow=\"hidden\");for(i in a)j=new f.fx(this,b,i),h=a[i],cm.test(h)?(q=f._data(this,\"toggle\"+i)||(h===\"toggle\"?d?\"show\":\"hide\":0),q?(f._data(this,\"toggle\"+i,q===\"show\"?\"hide\":\"show\"),j[q]()):j[h]()):(m=cn.exec(h),n=j.cur(),m?(o=parseFloat(m[2]),p=m[3]||(f.cssNumber[i]?\"\":\"px\"),p!==\"px\"&&(f.style(this,i,(o||1)+p),n=(o||1)/j.cur()*n,f.style(this,i,n+p)),m[1]&&(o=(m[1]===\"-=\"?-1:1)*o+n),j.custom(n,o,p)):j.custom(n,h,\"\"));return!0}var e=f.speed(b,c,d);if(f.isEmptyObject(a))return this.each(e.complete,[!1]);a=f.extend({},a);return e.queue===!1?this.each(g):this.queue(e.queue,g)},stop:function(a,c,d){typeof a!=\"string\"&&(d=c,c=a,a=b),c&&a!==!1&&this.queue(a||\"fx\",[]);return this.each(function(){function h(a,b,c){var e=b[c];f.removeData(a,c,!0),e.stop(d)}var b,c=!1,e=f.timers,g=f._data(this);d||f._unmark(!0,this);if(a==null)for(b in g)g[b]&&g[b].stop&&b.indexOf(\".run\")===b.length-4&&h(this,g,b);else g[b=a+\".run\"]&&g[b].stop&&h(this,g,b);for(b=e.length;b--;)e[b].elem===this&&(a==null||e[b].queue===a)&&(d?e[b](!0):e[b].saveState(),c=!0,e.splice(b,1));(!d||!c)&&f.dequeue(this,a)})}}),f.each({slideDown:ct(\"show\",1),slideUp:ct(\"hide\",1),slideToggle:ct(\"toggle\",1),fadeIn:{opacity:\"show\"},fadeOut:{opacity:\"hide\"},fadeToggle:{opacity:\"toggle\"}},function(a,b){f.fn[a]=function(a,c,d){return this.animate(b,a,c,d)}}),f.extend({speed:function(a,b,c){var d=a&&typeof a==\"object\"?f.extend({},a):{complete:c||!c&&b||f.isFunction(a)&&a,duration:a,easing:c&&b||b&&!f.isFunction(b)&&b};d.duration=f.fx.off?0:typeof d.duration==\"number\"?d.duration:d.duration in f.fx.speeds?f.fx.speeds[d.duration]:f.fx.speeds._default;if(d.queue==null||d.queue===!0)d.queue=\"fx\";d.old=d.complete,d.complete=function(a){f.isFunction(d.old)&&d.old.call(this),d.queue?f.dequeue(this,d.queue):a!==!1&&f._unmark(this)};return d},easing:{linear:function(a){return a},swing:function(a){return-Math.cos(a*Math.PI)/2+.5}},timers:[],fx:function(a,b,c){this.options=b,this.elem=a,this.prop=c,b.orig=b.orig||{}}}),f.fx.prototype={update:function(){this.options.step&&this.options.step.call(this.elem,this.now,this),(f.fx.step[this.prop]||f.fx.step._default)(this)},cur:function(){if(this.elem[this.prop]!=null&&(!this.elem.style||this.elem.style[this.prop]==null))return this.elem[this.prop];var a,b=f.css(this.elem,this.prop);return isNaN(a=parseFloat(b))?!b||b===\"auto\"?0:b:a},custom:function(a,c,d){function h(a){return e.step(a)}var e=this,g=f.fx;this.startTime=cq||cr(),this.end=c,this.now=this.start=a,this.pos=this.state=0,this.unit=d||this.unit||(f.cssNumber[this.prop]?\"\":\"px\"),h.queue=this.options.queue,h.elem=this.elem,h.saveState=function(){f._data(e.elem,\"fxshow\"+e.prop)===b&&(e.options.hide?f._data(e.elem,\"fxshow\"+e.prop,e.start):e.options.show&&f._data(e.elem,\"fxshow\"+e.prop,e.end))},h()&&f.timers.push(h)&&!co&&(co=setInterval(g.tick,g.interval))},show:function(){var a=f._data(this.elem,\"fxshow\"+this.prop);this.options.orig[this.prop]=a||f.style(this.elem,this.prop),this.options.show=!0,a!==b?this.custom(this.cur(),a):this.custom(this.prop===\"width\"||this.prop===\"height\"?1:0,this.cur()),f(this.elem).show()},hide:function(){this.options.orig[this.prop]=f._data(this.elem,\"fxshow\"+this.prop)||f.style(this.elem,this.prop),this.options.hide=!0,this.custom(this.cur(),0)},step:function(a){var b,c,d,e=cq||cr(),g=!0,h=this.elem,i=this.options;if(a||e>=i.duration+this.startTime){this.now=this.end,this.pos=this.state=1,this.update(),i.animatedProperties[this.prop]=!0;for(b in i.animatedProperties)i.animatedProperties[b]!==!0&&(g=!1);if(g){i.overflow!=null&&!f.support.shrinkWrapBlocks&&f.each([\"\",\"X\",\"Y\"],function(a,b){h.style[\"overflow\"+b]=i.overflow[a]}),i.hide&&f(h).hide();if(i.hide||i.show)for(b in i.animatedProperties)f.style(h,b,i.orig[b]),f.removeData(h,\"fxshow\"+b,!0),f.removeData(h,\"toggle\"+b,!0);d=i.complete,d&&(i.complete=!1,d.call(h))}return!1}i.duration==Infinity?this.now=e:(c=e-this.startTime,this.state=c/i.duration,this.pos=f.easing[i.animatedProperties[this.prop]](this.state,c,0,1,i.duration),this.now=this.start+(this.end-this.start)*this.pos),this.update();return!0}},f.extend(f.fx,{tick:function(){var a,b=f.timers,c=0;for(;c<b.length;c++)a=b[c],!a()&&b[c]===a&&b.splice(c--,1);b.length||f.fx.stop()},interval:13,stop:function(){clearInterval(co),co=null},speeds:{slow:600,fast:200,_default:400},step:{opacity:function(a){f.style(a.elem,\"opacity\",a.now)},_default:function(a){a.elem.style&&a.elem.style[a.prop]!=null?a.elem.style[a.prop]=a.now+a.unit:a.elem[a.prop]=a.now}}}),f.each(cp.concat.apply([],cp),function(a,b){b.indexOf(\"margin\")&&(f.fx.step[b]=function(a){f.style(a.elem,b,Math.max(0,a.now)+a.unit)})}),f.expr&&f.expr.filters&&(f.expr.filters.animated=function(a){return f.grep(f.timers,function(b){return a===b.elem}).length});var cv,cw=/^t(?:able|d|h)$/i,cx=/^(?:body|html)$/i;\"getBoundingClientRect\"in c.documentElement?cv=function(a,b,c,d){try{d=a.getBoundingClientRect()}catch(e){}if(!d||!f.contains(c,a))return d?{top:d.top,left:d.left}:{top:0,left:0};var g=b.body,h=cy(b),i=c.clientTop||g.clientTop||0,j=c.clientLeft||g.clientLeft||0,k=h.pageYOffset||f.support.boxModel&&c.scrollTop||g.scrollTop,l=h.pageXOffset||f.support.boxModel&&c.scrollLeft||g.scrollLeft,m=d.top+k-i,n=d.left+l-j;return{top:m,left:n}}:cv=function(a,b,c){var d,e=a.offsetParent,g=a,h=b.body,i=b.defaultView,j=i?i.getComputedStyle(a,null):a.currentStyle,k=a.offsetTop,l=a.offsetLeft;while((a=a.parentNode)&&a!==h&&a!==c){if(f.support.fixedPosition&&j.position===\"fixed\")break;d=i?i.getComputedStyle(a,null):a.currentStyle,k-=a.scrollTop,l-=a.scrollLeft,a===e&&(k+=a.offsetTop,l+=a.offsetLeft,f.support.doesNotAddBorder&&(!f.support.doesAddBorderForTableAndCells||!cw.test(a.nodeName))&&(k+=parseFloat(d.borderTopWidth)||0,l+=parseFloat(d.borderLeftWidth)||0),g=e,e=a.offsetParent),f.support.subtractsBorderForOverflowNotVisible&&d.overflow!==\"visible\"&&(k+=parseFloat(d.borderTopWidth)||0,l+=parseFloat(d.borderLeftWidth)||0),j=d}if(j.position===\"relative\"||j.position===\"static\")k+=h.offsetTop,l+=h.offsetLeft;f.support.fixedPosition&&j.position===\"fixed\"&&(k+=Math.max(c.scrollTop,h.scrollTop),l+=Math.max(c.scrollLeft,h.scrollLeft));return{top:k,left:l}},f.fn.offset=function(a){if(arguments.length)return a===b?this:this.each(function(b){f.offset.setOffset(this,a,b)});var c=this[0],d=c&&c.ownerDocument;if(!d)return null;if(c===d.body)return f.offset.bodyOffset(c);return cv(c,d,d.documentElement)},f.offset={bodyOffset:function(a){var b=a.offsetTop,c=a.offsetLeft;f.support.doesNotIncludeMarginInBodyOffset&&(b+=parseFloat(f.css(a,\"marginTop\"))||0,c+=parseFloat(f.css(a,\"marginLeft\"))||0);return{top:b,left:c}},setOffset:function(a,b,c){var d=f.css(a,\"position\");d===\"static\"&&(a.style.position=\"relative\");var e=f(a),g=e.offset(),h=f.css(a,\"top\"),i=f.css(a,\"left\"),j=(d===\"absolute\"||d===\"fixed\")&&f.inArray(\"auto\",[h,i])>-1,k={},l={},m,n;j?(l=e.position(),m=l.top,n=l.left):(m=parseFloat(h)||0,n=parseFloat(i)||0),f.isFunction(b)&&(b=b.call(a,c,g)),b.top!=null&&(k.top=b.top-g.top+m),b.left!=null&&(k.left=b.left-g.left+n),\"using\"in b?b.using.call(a,k):e.css(k)}},f.fn.extend({position:function(){if(!this[0])return null;var a=this[0],b=this.offsetParent(),c=this.offset(),d=cx.test(b[0].nodeName)?{top:0,left:0}:b.offset();c.top-=parseFloat(f.css(a,\"marginTop\"))||0,c.left-=parseFloat(f.css(a,\"marginLeft\"))||0,d.top+=parseFloat(f.css(b[0],\"borderTopWidth\"))||0,d.left+=parseFloat(f.css(b[0],\"borderLeftWidth\"))||0;return{top:c.top-d.top,left:c.left-d.left}},offsetParent:function(){return this.map(function(){var a=this.offsetParent||c.body;while(a&&!cx.test(a.nodeName)&&f.css(a,\"position\")===\"static\")a=a.offsetParent;return a})}}),f.each({scrollLeft:\"pageXOffset\",scrollTop:\"pageYOffset\"},function(a,c){var d=/Y/.test(c);f.fn[a]=function(e){return f.access(this,function(a,e,g){var h=cy(a);if(g===b)return h?c in h?h[c]:f.support.boxModel&&h.document.documentElement[e]||h.document.body[e]:a[e];h?h.scrollTo(d?f(h).scrollLeft():g,d?g:f(h).scrollTop()):a[e]=g},a,e,arguments.length,null)}}),f.each({Height:\"height\",Width:\"width\"},function(a,c){var d=\"client\"+a,e=\"scroll\"+a,g=\"offset\"+a;f.fn[\"inner\"+a]=function(){var a=this[0];return a?a.style?parseFloat(f.css(a,c,\"padding\")):this[c]():null},f.fn[\"outer\"+a]=function(a){var b=this[0];return b?b.style?parseFloat(f.css(b,c,a?\"margin\":\"border\")):this[c]():null},f.fn[c]=function(a){return f.access(this,function(a,c,h){var i,j,k,l;if(f.isWindow(a)){i=a.document,j=i.documentElement[d];return f.support.boxModel&&j||i.body&&i.body[d]||j}if(a.nodeType===9){i=a.documentElement;if(i[d]>=i[e])return i[d];return Math.max(a.body[e],i[e],a.body[g],i[g])}if(h===b){k=f.css(a,c),l=parseFloat(k);return f.isNumeric(l)?l:k}f(a).css(c,h)},c,a,arguments.length,null)}}),a.jQuery=a.$=f,typeof define==\"function\"&&define.amd&&define.amd.jQuery&&define(\"jquery\",[],function(){return f})})(window);PK\x07\x08\xbcCoKzr\x01\x00zr\x01\x00PK\x03\x04\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0b\x00\x00\x00mustache.js/*!\x0d\n * mustache.js - Logic-less {{mustache}} templates with JavaScript\x0d\n * http://github.com/janl/mustache.js\x0d\n */\x0d\nvar Mustache = (typeof module !== \"undefined\" && module.exports) || {};\x0d\n\x0d\n(function (exports) {\x0d\n\x0d\n  exports.name = \"mustache.js\";\x0d\n  exports.version = \"0.5.0-dev\";\x0d\n  exports.tags = [\"{{\", \"}}\"];\x0d\n  exports.parse = parse;\x0d\n  exports.compile = compile;\x0d\n  exports.render = render;\x0d\n  exports.clearCache = clearCache;\x0d\n\x0d\n  // This is here for backwards compatibility with 0.4.x.\x0d\n  exports.to_html = function (template, view, partials, send) {\x0d\n    var result = render(template, view, partials);\x0d\n\x0d\n    if (typeof send === \"function\") {\x0d\n      send(result);\x0d\n    } else {\x0d\n      return result;\x0d\n    }\x0d\n  };\x0d\n\x0d\n  var _toString = Object.prototype.toString;\x0d\n  var _isArray = Array.isArray;\x0d\n  var _forEach = Array.prototype.forEach;\x0d\n  var _trim = String.prototype.trim;\x0d\n\x0d\n  var isArray;\x0d\n  if (_isArray) {\x0d\n    isArray = _isArray;\x0d\n  } else {\x0d\n    isArray = function (obj) {\x0d\n      return _toString.call(obj) === \"[object Array]\";\x0d\n    };\x0d\n  }\x0d\n\x0d\n  var forEach;\x0d\n  if (_forEach) {\x0d\n    forEach = function (obj, callback, scope) {\x0d\n      return _forEach.call(obj, callback, scope);\x0d\n    };\x0d\n  } else {\x0d\n    forEach = function (obj, callback, scope) {\x0d\n      for (var i = 0, len = obj.length; i < len; ++i) {\x0d\n        callback.call(scope, obj[i], i, obj);\x0d\n      }\x0d\n    };\x0d\n  }\x0d\n\x0d\n  var spaceRe = /^\\s*$/;\x0d\n\x0d\n  function isWhitespace(string) {\x0d\n    return spaceRe.test(string);\x0d\n  }\x0d\n\x0d\n  var trim;\x0d\n  if (_trim) {\x0d\n    trim = function (string) {\x0d\n      return string == null ? \"\" : _trim.call(string);\x0d\n    };\x0d\n  } else {\x0d\n    var trimLeft, trimRight;\x0d\n\x0d\n    if (isWhitespace(\"\\xA0\")) {\x0d\n      trimLeft = /^\\s+/;\x0d\n      trimRight = /\\s+$/;\x0d\n    } else {\x0d\n      // IE doesn't match non-breaking spaces with \\s, thanks jQuery.\x0d\n      trimLeft = /^[\\s\\xA0]+/;\x0d\n      trimRight = /[\\s\\xA0]+$/;\x0d\n    }\x0d\n\x0d\n    trim = function (string) {\x0d\n      return string == null ? \"\" :\x0d\n        String(string).replace(trimLeft, \"\").replace(trimRight, \"\");\x0d\n    };\x0d\n  }\x0d\n\x0d\n  var escapeMap = {\x0d\n    \"&\": \"&amp;\",\x0d\n    \"<\": \"&lt;\",\x0d\n    \">\": \"&gt;\",\x0d\n    '\"': '&quot;',\x0d\n    \"'\": '&#39;'\x0d\n  };\x0d\n\x0d\n  function escapeHTML(string) {\x0d\n    return String(string).replace(/&(?!\\w+;)|[<>\"']/g, function (s) {\x0d\n      return escapeMap[s] || s;\x0d\n    });\x0d\n  }\x0d\n\x0d\n  /**\x0d\n   * Adds the ` + \"`\" + `template` + \"`\" + `, ` + \"`\" + `line` + \"`\" + `, and ` + \"`\" + `file` + \"`\" + ` properties to the given error\x0d\n   * object and alters the message to provide more useful debugging information.\x0d\n   */\x0d\n  function debug(e, template, line, file) {\x0d\n    file = file || \"<template>\";\x0d\n\x0d\n    var lines = template.split(\"\\n\"),\x0d\n        start = Math.max(line - 3, 0),\x0d\n        end = Math.min(lines.length, line + 3),\x0d\n        context = lines.slice(start, end);\x0d\n\x0d\n    var c;\x0d\n    for (var i = 0, len = context.length; i < len; ++i) {\x0d\n      c = i + start + 1;\x0d\n      context[i] = (c === line ? \" >> \" : \"    \") + context[i];\x0d\n    }\x0d\n\x0d\n    e.template = template;\x0d\n    e.line = line;\x0d\n    e.file = file;\x0d\n    e.message = [file + \":\" + line, context.join(\"\\n\"), \"\", e.message].join(\"\\n\");\x0d\n\x0d\n    return e;\x0d\n  }\x0d\n\x0d\n  /**\x0d\n   * Looks up the value of the given ` + \"`\" + `name` + \"`\" + ` in the given context ` + \"`\" + `stack` + \"`\" + `.\x0d\n   */\x0d\n  function lookup(name, stack, defaultValue) {\x0d\n    if (name === \".\") {\x0d\n      return stack[stack.length - 1];\x0d\n    }\x0d\n\x0d\n    var names = name.split(\".\");\x0d\n    var lastIndex = names.length - 1;\x0d\n    var target = names[lastIndex];\x0d\n\x0d\n    var value, context, i = stack.length, j, localStack;\x0d\n    while (i) {\x0d\n      localStack = stack.slice(0);\x0d\n      context = stack[--i];\x0d\n\x0d\n      j = 0;\x0d\n      while (j < lastIndex) {\x0d\n        context = context[names[j++]];\x0d\n\x0d\n        if (context == null) {\x0d\n          break;\x0d\n        }\x0d\n\x0d\n        localStack.push(context);\x0d\n      }\x0d\n\x0d\n      if (context && typeof context === \"object\" && target in context) {\x0d\n        value = context[target];\x0d\n        break;\x0d\n      }\x0d\n    }\x0d\n\x0d\n    // If the value is a function, call it in the current context.\x0d\n    if (typeof value === \"function\") {\x0d\n      value = value.call(localStack[localStack.length - 1]);\x0d\n    }\x0d\n\x0d\n    if (value == null)  {\x0d\n      return defaultValue;\x0d\n    }\x0d\n\x0d\n    return value;\x0d\n  }\x0d\n\x0d\n  function renderSection(name, stack, callback, inverted) {\x0d\n    var buffer = \"\";\x0d\n    var value =  lookup(name, stack);\x0d\n\x0d\n    if (inverted) {\x0d\n      // From the spec: inverted sections may render text once based on the\x0d\n      // inverse value of the key. That is, they will be rendered if the key\x0d\n      // doesn't exist, is false, or is an empty list.\x0d\n      if (value == null || value === false || (isArray(value) && value.length === 0)) {\x0d\n        buffer += callback();\x0d\n      }\x0d\n    } else if (isArray(value)) {\x0d\n      forEach(value, function (value) {\x0d\n        stack.push(value);\x0d\n        buffer += callback();\x0d\n        stack.pop();\x0d\n      });\x0d\n    } else if (typeof value === \"object\") {\x0d\n      stack.push(value);\x0d\n      buffer += callback();\x0d\n      stack.pop();\x0d\n    } else if (typeof value === \"function\") {\x0d\n      var scope = stack[stack.length - 1];\x0d\n      var scopedRender = function (template) {\x0d\n        return render(template, scope);\x0d\n      };\x0d\n      buffer += value.call(scope, callback(), scopedRender) || \"\";\x0d\n    } else if (value) {\x0d\n      buffer += callback();\x0d\n    }\x0d\n\x0d\n    return buffer;\x0d\n  }\x0d\n\x0d\n  /**\x0d\n   * Parses the given ` + \"`\" + `template` + \"`\" + ` and returns the source of a function that,\x0d\n   * with the proper arguments, will render the template. Recognized options\x0d\n   * include the following:\x0d\n   *\x0d\n   *   - file     The name of the file the template comes from (displayed in\x0d\n   *              error messages)\x0d\n   *   - tags     An array of open and close tags the ` + \"`\" + `template` + \"`\" + ` uses. Defaults\x0d\n   *              to the value of Mustache.tags\x0d\n   *   - debug    Set ` + \"`\" + `true` + \"`\" + ` to log the body of the generated function to the\x0d\n   *              console\x0d\n   *   - space    Set ` + \"`\" + `true` + \"`\" + ` to preserve whitespace from lines that otherwise\x0d\n   *              contain only a {{tag}}. Defaults to ` + \"`\" + `false` + \"`\" + `\x0d\n   */\x0d\n  function parse(template, options) {\x0d\n    options = options || {};\x0d\n\x0d\n    var tags = options.tags || exports.tags,\x0d\n        openTag = tags[0],\x0d\n        closeTag = tags[tags.length - 1];\x0d\n\x0d\n    var code = [\x0d\n      'var buffer = \"\";', // output buffer\x0d\n      \"\\nvar line = 1;\", // keep track of source line number\x0d\n      \"\\ntry {\",\x0d\n      '\\nbuffer += \"'\x0d\n    ];\x0d\n\x0d\n    var spaces = [],      // indices of whitespace in code on the current line\x0d\n        hasTag = false,   // is there a {{tag}} on the current line?\x0d\n        nonSpace = false; // is there a non-space char on the current line?\x0d\n\x0d\n    // Strips all space characters from the code array for the current line\x0d\n    // if there was a {{tag}} on it and otherwise only spaces.\x0d\n    var stripSpace = function () {\x0d\n      if (hasTag && !nonSpace && !options.space) {\x0d\n        while (spaces.length) {\x0d\n          code.splice(spaces.pop(), 1);\x0d\n        }\x0d\n      } else {\x0d\n        spaces = [];\x0d\n      }\x0d\n\x0d\n      hasTag = false;\x0d\n      nonSpace = false;\x0d\n    };\x0d\n\x0d\n    var sectionStack = [], updateLine, nextOpenTag, nextCloseTag;\x0d\n\x0d\n    var setTags = function (source) {\x0d\n      tags = trim(source).split(/\\s+/);\x0d\n      nextOpenTag = tags[0];\x0d\n      nextCloseTag = tags[tags.length - 1];\x0d\n    };\x0d\n\x0d\n    var includePartial = function (source) {\x0d\n      code.push(\x0d\n        '\";',\x0d\n        updateLine,\x0d\n        '\\nvar partial = partials[\"' + trim(source) + '\"];',\x0d\n        '\\nif (partial) {',\x0d\n        '\\n  buffer += render(partial,stack[stack.length - 1],partials);',\x0d\n        '\\n}',\x0d\n        '\\nbuffer += \"'\x0d\n      );\x0d\n    };\x0d\n\x0d\n    var openSection = function (source, inverted) {\x0d\n      var name = trim(source);\x0d\n\x0d\n      if (name === \"\") {\x0d\n        throw debug(new Error(\"Section name may not be empty\"), template, line, options.file);\x0d\n      }\x0d\n\x0d\n      sectionStack.push({name: name, inverted: inverted});\x0d\n\x0d\n      code.push(\x0d\n        '\";',\x0d\n        updateLine,\x0d\n        '\\nvar name = \"' + name + '\";',\x0d\n        '\\nvar callback = (function () {',\x0d\n        '\\n  return function () {',\x0d\n        '\\n    var buffer = \"\";',\x0d\n        '\\nbuffer += \"'\x0d\n      );\x0d\n    };\x0d\n\x0d\n    var openInvertedSection = function (source) {\x0d\n      openSection(source, true);\x0d\n    };\x0d\n\x0d\n    var closeSection = function (source) {\x0d\n      var name = trim(source);\x0d\n      var openName = sectionStack.length != 0 && sectionStack[sectionStack.length - 1].name;\x0d\n\x0d\n      if (!openName || name != openName) {\x0d\n        throw debug(new Error('Section named \"' + name + '\" was never opened'), template, line, options.file);\x0d\n      }\x0d\n\x0d\n      var section = sectionStack.pop();\x0d\n\x0d\n      code.push(\x0d\n        '\";',\x0d\n        '\\n    return buffer;',\x0d\n        '\\n  };',\x0d\n        '\\n})();'\x0d\n      );\x0d\n\x0d\n      if (section.inverted) {\x0d\n        code.push(\"\\nbuffer += renderSection(name,stack,callback,true);\");\x0d\n      } else {\x0d\n        code.push(\"\\nbuffer += renderSection(name,stack,callback);\");\x0d\n      }\x0d\n\x0d\n      code.push('\\nbuffer += \"');\x0d\n    };\x0d\n\x0d\n    var sendPlain = function (source) {\x0d\n      code.push(\x0d\n        '\";',\x0d\n        updateLine,\x0d\n        '\\nbuffer += lookup(\"' + trim(source) + '\",stack,\"\");',\x0d\n        '\\nbuffer += \"'\x0d\n      );\x0d\n    };\x0d\n\x0d\n    var sendEscaped = function (source) {\x0d\n      code.push(\x0d\n        '\";',\x0d\n        updateLine,\x0d\n        '\\nbuffer += escapeHTML(lookup(\"' + trim(source) + '\",stack,\"\"));',\x0d\n        '\\nbuffer += \"'\x0d\n      );\x0d\n    };\x0d\n\x0d\n    var line = 1, c, callback;\x0d\n    for (var i = 0, len = template.length; i < len; ++i) {\x0d\n      if (template.slice(i, i + openTag.length) === openTag) {\x0d\n        i += openTag.length;\x0d\n        c = template.substr(i, 1);\x0d\n        updateLine = '\\nline = ' + line + ';';\x0d\n        nextOpenTag = openTag;\x0d\n        nextCloseTag = closeTag;\x0d\n        hasTag = true;\x0d\n\x0d\n        switch (c) {\x0d\n        case \"!\": // comment\x0d\n          i++;\x0d\n          callback = null;\x0d\n          break;\x0d\n        case \"=\": // change open/close tags, e.g. {{=<% %>=}}\x0d\n          i++;\x0d\n          closeTag = \"=\" + closeTag;\x0d\n          callback = setTags;\x0d\n          break;\x0d\n        case \">\": // include partial\x0d\n          i++;\x0d\n          callback = includePartial;\x0d\n          break;\x0d\n        case \"#\": // start section\x0d\n          i++;\x0d\n          callback = openSection;\x0d\n          break;\x0d\n        case \"^\": // start inverted section\x0d\n          i++;\x0d\n          callback = openInvertedSection;\x0d\n          break;\x0d\n        case \"/\": // end section\x0d\n          i++;\x0d\n          callback = closeSection;\x0d\n          break;\x0d\n        case \"{\": // plain variable\x0d\n          closeTag = \"}\" + closeTag;\x0d\n          // fall through\x0d\n        case \"&\": // plain variable\x0d\n          i++;\x0d\n          nonSpace = true;\x0d\n          callback = sendPlain;\x0d\n          break;\x0d\n        default: // escaped variable\x0d\n          nonSpace = true;\x0d\n          callback = sendEscaped;\x0d\n        }\x0d\n\x0d\n        var end = template.indexOf(closeTag, i);\x0d\n\x0d\n        if (end === -1) {\x0d\n          throw debug(new Error('Tag \"' + openTag + '\" was not closed properly'), template, line, options.file);\x0d\n        }\x0d\n\x0d\n        var source = template.substring(i, end);\x0d\n\x0d\n        if (callback) {\x0d\n          callback(source);\x0d\n        }\x0d\n\x0d\n        // Maintain line count for \\n in source.\x0d\n        var n = 0;\x0d\n        while (~(n = source.indexOf(\"\\n\", n))) {\x0d\n          line++;\x0d\n          n++;\x0d\n        }\x0d\n\x0d\n        i = end + closeTag.length - 1;\x0d\n        openTag = nextOpenTag;\x0d\n        closeTag = nextCloseTag;\x0d\n      } else {\x0d\n        c = template.substr(i, 1);\x0d\n\x0d\n        switch (c) {\x0d\n        case '\"':\x0d\n        case \"\\\\\":\x0d\n          nonSpace = true;\x0d\n          code.push(\"\\\\\" + c);\x0d\n          break;\x0d\n        case \"\\r\":\x0d\n          // Ignore carriage returns.\x0d\n          break;\x0d\n        case \"\\n\":\x0d\n          spaces.push(code.length);\x0d\n          code.push(\"\\\\n\");\x0d\n          stripSpace(); // Check for whitespace on the current line.\x0d\n          line++;\x0d\n          break;\x0d\n        default:\x0d\n          if (isWhitespace(c)) {\x0d\n            spaces.push(code.length);\x0d\n          } else {\x0d\n            nonSpace = true;\x0d\n          }\x0d\n\x0d\n          code.push(c);\x0d\n        }\x0d\n      }\x0d\n    }\x0d\n\x0d\n    if (sectionStack.length != 0) {\x0d\n      throw debug(new Error('Section \"' + sectionStack[sectionStack.length - 1].name + '\" was not closed properly'), template, line, options.file);\x0d\n    }\x0d\n\x0d\n    // Clean up any whitespace from a closing {{tag}} that was at the end\x0d\n    // of the template without a trailing \\n.\x0d\n    stripSpace();\x0d\n\x0d\n    code.push(\x0d\n      '\";',\x0d\n      \"\\nreturn buffer;\",\x0d\n      \"\\n} catch (e) { throw {error: e, line: line}; }\"\x0d\n    );\x0d\n\x0d\n    // Ignore ` + \"`\" + `buffer += \"\";` + \"`\" + ` statements.\x0d\n    var body = code.join(\"\").replace(/buffer \\+= \"\";\\n/g, \"\");\x0d\n\x0d\n    if (options.debug) {\x0d\n      if (typeof console != \"undefined\" && console.log) {\x0d\n        console.log(body);\x0d\n      } else if (typeof print === \"function\") {\x0d\n        print(body);\x0d\n      }\x0d\n    }\x0d\n\x0d\n    return body;\x0d\n  }\x0d\n\x0d\n  /**\x0d\n   * Used by ` + \"`\" + `compile` + \"`\" + ` to generate a reusable function for the given ` + \"`\" + `template` + \"`\" + `.\x0d\n   */\x0d\n  function _compile(template, options) {\x0d\n    var args = \"view,partials,stack,lookup,escapeHTML,renderSection,render\";\x0d\n    var body = parse(template, options);\x0d\n    var fn = new Function(args, body);\x0d\n\x0d\n    // This anonymous function wraps the generated function so we can do\x0d\n    // argument coercion, setup some variables, and handle any errors\x0d\n    // encountered while executing it.\x0d\n    return function (view, partials) {\x0d\n      partials = partials || {};\x0d\n\x0d\n      var stack = [view]; // context stack\x0d\n\x0d\n      try {\x0d\n        return fn(view, partials, stack, lookup, escapeHTML, renderSection, render);\x0d\n      } catch (e) {\x0d\n        throw debug(e.error, template, e.line, options.file);\x0d\n      }\x0d\n    };\x0d\n  }\x0d\n\x0d\n  // Cache of pre-compiled templates.\x0d\n  var _cache = {};\x0d\n\x0d\n  /**\x0d\n   * Clear the cache of compiled templates.\x0d\n   */\x0d\n  function clearCache() {\x0d\n    _cache = {};\x0d\n  }\x0d\n\x0d\n  /**\x0d\n   * Compiles the given ` + \"`\" + `template` + \"`\" + ` into a reusable function using the given\x0d\n   * ` + \"`\" + `options` + \"`\" + `. In addition to the options accepted by Mustache.parse,\x0d\n   * recognized options include the following:\x0d\n   *\x0d\n   *   - cache    Set ` + \"`\" + `false` + \"`\" + ` to bypass any pre-compiled version of the given\x0d\n   *              template. Otherwise, a given ` + \"`\" + `template` + \"`\" + ` string will be cached\x0d\n   *              the first time it is parsed\x0d\n   */\x0d\n  function compile(template, options) {\x0d\n    options = options || {};\x0d\n\x0d\n    // Use a pre-compiled version from the cache if we have one.\x0d\n    if (options.cache !== false) {\x0d\n      if (!_cache[template]) {\x0d\n        _cache[template] = _compile(template, options);\x0d\n      }\x0d\n\x0d\n      return _cache[template];\x0d\n    }\x0d\n\x0d\n    return _compile(template, options);\x0d\n  }\x0d\n\x0d\n  /**\x0d\n   * High-level function that renders the given ` + \"`\" + `template` + \"`\" + ` using the given\x0d\n   * ` + \"`\" + `view` + \"`\" + ` and ` + \"`\" + `partials` + \"`\" + `. If you need to use any of the template options (see\x0d\n   * ` + \"`\" + `compile` + \"`\" + ` above), you must compile in a separate step, and then call that\x0d\n   * compiled function.\x0d\n   */\x0d\n  function render(template, view, partials) {\x0d\n    return compile(template)(view, partials);\x0d\n  }\x0d\n\x0d\n})(Mustache);\x0d\nPK\x07\x08\x1f\xf3\x04%m<\x00\x00m<\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nGl\xd0H>\xcf\xc3\x01\x00\xcf\xc3\x01\x00\x0d\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\x00\x00\x00\x00bootstrap.cssPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x94\xb9%\x020	\x00\x000	\x00\x00\x12\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\n\xc4\x01\x00bootstrap_alert.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG	\xef\xa4\x8c\x06\x17\x00\x00\x06\x17\x00\x00\x12\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81z\xcd\x01\x00bootstrap_modal.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\xa5\x93g\xf1\x9b\x0b\x00\x00\x9b\x0b\x00\x00\x14\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\xc0\xe4\x01\x00bootstrap_popover.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG8\x9e\x04|\xbe\x0d\x00\x00\xbe\x0d\x00\x00\x10\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\x9d\xf0\x01\x00bootstrap_tab.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x06G\x1e\xcc\x0b\x1f\x00\x00\x0b\x1f\x00\x00\x14\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\x99\xfe\x01\x00bootstrap_tooltip.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nGA\x88\xe0%\xa6\x02\x00\x00\xa6\x02\x00\x00\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\xe6\x1d\x02\x00dj_mon.cssPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\x12S8G\x99\xb0\x8b\x0eT	\x00\x00T	\x00\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\xc4 \x02\x00dj_mon.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00pE\x8eGW\xe2\x0c\x82U\x1f\x00\x00U\x1f\x00\x00\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81O*\x02\x00index.htmlPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\xbcCoKzr\x01\x00zr\x01\x00\x0d\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\xdcI\x02\x00jquery.min.jsPK\x01\x02\x14\x03\x14\x00\x08\x00\x00\x00\xa4\x0d\nG\x1f\xf3\x04%m<\x00\x00m<\x00\x00\x0b\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\x91\xbc\x03\x00mustache.jsPK\x05\x06\x00\x00\x00\x00\x0b\x00\x0b\x00\x98\x02\x00\x007\xf9\x03\x00\x00\x00"
+	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00	\x00bootstrap.cssUT\x05\x00\x01\x80Cm8\xd4\xbdms\xe36\xb2(\xfc]\xbf\x02\x8fS[\xc9L$\x0dIQ\xaf\xa9\xa4v\xcf\xee>\xf7l\xd5\xd9\xfdr\xf7\xc3\xad\xca\xe6VA$d\xf1\x0cE2$e{\xe2\xf2\x7f\xbf\x05\xa0\x01\xe2\x9d\x94\xed\xd9S\xb1\x92\xb1\x05t7\x1a\x8dF\xa3\x014\x80O\x1f\xff\xbf\x19\xfa\x88\xfe\xa3\xae\xfb\xaeoq\x83\x1e\x92e\xb4\\\xcd\xd0G\x9a\xfc\xe7\xba\xf9\xd2\x16\xf7\xe7\x1e%Q\x9c\xa0\x7f>\x16}O\xda9\xfa[\x95\xd1\xec\xff*2Ru$G\xd7*'-\xea\xcf\x04\xfd\xa9\xc1\xd9\x99\x88\x1cF\x8dB\x9e\xfb\xbe9|\xfa\xf4\xf8\xf8\xb8\xc4\x0cbY\xb7\xf7\x9fJ\x8e\xdf}\xfa\xaf\xbf\xfd\xf9\xaf\xff\xf8\xdf\x7f]ph\x8a\xf0\x17\xd2\x15\xf7\x15\xc9\x11\xaert\xbc\x16e\x8f\x1e\x8b\xfe\x8cpY\xb2r\xca\xfa\x81\xa0\xa2b\x7f?\xd6m\x99\xa3?\xf6\x9c;t\xfc\x82\xfex\xc9k\x86\xf9\xc7\x13\xee\x973\xf4\xf1\xd3\x0c\xb7}\x91\x95d>\xc3]\x91\x93\xf9,'=.\xcan>;\x15\xf7\x19n\xfa\xa2\xae\xd8\xdf\xd7\x96\xccg\xa7\xba\xa6\xf5\x9c\x9d	\xce\xd9\xef\xfb\xb6\xbe6\xf3Y\x85\x1f\xe6\xb3\x8ed\x14\x1a=\xcf\x10\xca\x8b\xae)\xf1\x97\x03:\x96u\xf6\xf9\x87\xd9\xcb\x0c_\xf3\xa2\x9e\xcf2\\=\xe0n>{(rR\xeb\xa0EU\x16\x15Y\x00\x06B\x1f\x8d\x1c\x96\xf6[]_\x0e(\x96\x14\x0fU\xdd\x7f\xf7sVW}[\x97\xdd/\x1ft\x92U]\x11\nz\xee/%\xcb9\xd5U\xbf\xe8\x8a\xdf\xc8\x01\xc5Q\xf4\x07Jr\xf1H\x8e\x9f\x8b~\xd1\x93'\x9e\xb5\xc0\xf9\x7f_\xbb^\x81\xb8t\xde\xdc\x97\x19>\x9c\xea\xec\xda1\xf2\xf5\xb5\xa7u8\xa0\xfe\\T(\xaf\xfb\x9e\xe4\xe8\x9b\xd5j\xf5\x83\x9a\xb9n\x9e\x10\xbe\xf6\xb5,\x9a\x11X\xb4Eu\xbf\xc8\xea\xb2n\x15\xe8E}:u\xa4?\xa0E\xd2<\xd1\xaa\xe0\xc3\xb9~\xa0\xb2\xc7\x07\x9c\xf5\xc5\x03\xd1\x0b\x8e(Lw=\xceg\xdd\xb5aYM\xdd\x15\xb4]\x0e\xa8%%\xa6\x18?\xe8\x82\xd8\xae\x99\x1c(o\x8b3\xa1Z\xcd\xc8 \xf4@\xa8n\xe0r\x81\xcb\xe2\xbe:\xa0#\xee\x08\x85\xe2Ep\xea}\xdd\x1c\xd0\"Z\xae\xc9\x05Jf\xc9\xc7\xba\xefiC-\xa2e\x02Y\xc5\xe5\x9ee]\xf0\xd3\xe2\xb1\xc8\xfb\xf3 `\xb3\xa0K\x91\xe7%c\xf3X\xb79i\x81\x1f\xda\x0eE\xd5\x93\xb6\xa9iE\xeajq\xa9sr@\xc7\"\xbb\x1e\x8b\x8c\x16r\xbc\xf6=U\xd8\xa2j\xae=U\xc9\x92d\xfd|F[\x0f\xb7\x04\x03\x03\xed}Q\x01M\x87B\xf8\xb81\xa83Z\x1fi[\x9c\xca\xfa\xf1\x80\x1e\x8a\xae8\x96\xc4\x12eU\xb7\x17\\\x0e\xcc\x1d\x0e\x8bK\xfd\x1b\xb4yQU\xb4-\x19\xbbv\x06+\xa2\xc1y^T\xf7\xc0\xaf\"\x10\x83\x9f\x9f\xfb/\x0d\xf9\xf1\x8eK\xe0\xee\x17=\xb5%\x1d\xe9\xcd\xc4\xeez\xbc\x14\xfd\xdd/\xac\x98\xec\xdavu{@M\xcdD\xac\xf6\x0c\xdc4\x04\xb7\xb8\xca\xa8\xac\x19yZ\xb8J\xbe#\xb8\xcd\xce@Ih\xf5\xb1~\xa2\xfd\x89\xf1N;(\xa9X\x1a\xa3L+\x1a\xc8\x0f\xa1:\x98\xa2\xcd{*H\x99\xfb\xf8:\x1c\x04\x1a\xe7t\x91\x93\xacn\x99\x0e\xcd\xa7!d\xb4\xfa\xe5\x82W\x1f={\xa4#\xec\x8d\xa6o\x83\x8a\xd0N\xef\xeaX}\xddP\xce\x97YIp{*\x9e\xd0\xb3a\xead\xce\xe1HN5\xb5\xc4C\n>Q\xe3\xae\x99\xbd\x1e\x83\"\x82\xd8\x0f\xe8\xeeN'3 1:\x07\xdaa\xcf\x0c\xe4\\\xe4\x84Y;i/\x0f(\xfa\x14!\xcc\xe9\x95TG\xfa\x16W]\x83[R\xf54\x95B/\xba3\xcei\x1d\xb9\x08\x10:\xe2\xec3\x1d\x1d\xaa|\xe1\xc6\xd24y\xc9\x1a\x81\xdb\xfeEI\x1eH\xa9\xd7H\x0e\n\x86\xe5\xb8\x14\x95\xech\xc9\x8eZH\xb7\xfe\xf1\xc2\xbc\xeagfw\x81\\_\xce\xcb\xecX\xe7_<\x16\xe6\x84/E\xf9\xe5\x80\xee\xfe\x93\x94\x0f\x84\x9a\x17\xf4\x0fr%ws$\x13\xe6\xe8Om\x81\xcb9\xeap\xd5-:\xd2\x16'\xc3P\xc7\xab\xe6\xc9\xb2\xd41\xd4\x1a\x84L\x07\x1b\x18o\xec\x16\xf8\xe6\xc4~\xa8\xc0\xb9)\x14\xe9i\xbc[e\xa9l\xcb\xa1w\x88\xf6\x94\xe3\xceT4\xe6\xf9\x88\xc1b\xd9\xd6\x8f\x8a`\x16%9\xb1\x11-j\x9e\xccA\x9d\x82\x0eJN\xbf\xdc\xa2\xdf:\xbc\xa1\xda?g%\xee\xba\x8f?\xdeu\x0d\xae\xc0V\x9d\xca\x1a\xf7\x07D\x19\xfa\xc1\xe4\x8f\xb3\xf72[\xd2^\x84\x0bf\xa8\x97\x15~8\xe2vq*\x9eH\xbe\xe8\xeb\x06\xf9s\xf9\x18\xa8\x00\xa0\xe7A\x81\xf7\xa9\xa0N\xb9\x89\x93@^\xac\xe6\xed6Z^\xa4\xe6mwj\xde^\xcb\x8a\xd4\xac\x9d\x9a\xb5\x91\xf5\xa4\x9cl\xd5\xac\xb5\xc6\xe4F\xcdJ5>\xd6j\xd6Jc#\xd5\xb246VjV\xa2\xb1\xa1\xc9#\xd6e\xa5fI.\xb8\x9b\x14'\xb6\x9a\xedw\x06Ll\xab\xe2>2`\"\x1bf'\x19\xe4e\xedm\x90\xadd\x94\x83\xecl\x90\x8d\xc1\xf1\xd6\x06Y\x1b\x0co\x1c \x06\xbfk\x1b$5\xd8Mm\x90\x95\xc1\xee\xca\x06I\x0cv\x1d\xf2\x8dM\xf9:@$\xbbm\xfd\xb88\x95\xd7\"G\xcf\xb61W\x9d\xfb\x01R\xb3\x06\x1c\xf9V\x9b`a\x99\x83\x9e,\x0c\xb9\x8c\xc4\xefi\x14\x1a1i\xcb8\xd9n\xd6\xfb\xf56e>\xffG#7\xda\xa6\xe9f\x17\xed\xd2\xcdj\x97\xec\xb7\xdb?\x84\xa5s8\x15m\xd7/\xb2sQ\xe6v\xabG\x06\xb2\xcb\xd2\xed\x97{\xfe\xb3c\xff\xee9W\xd0\xb9i.cg\x1dE\x94\xa1\x9d\xc9\x0e\xa7\xa8\x19\x84}\xbcLw\xfb\xd5&\xde\xecW:\xb1x\x99\xae6\xf16J\xa2\xd5f\xb5[\xb9ii\xf6t\x97,\xf7\xdb\xdd6Y\xad\xf6k\x9b;\x9a\x9b\xac\xd7\xabx\x1fm\xfc\xdc\xe9V8]B}\x8c\x9a\xd2\x8c\x98\xf1\x1d\xed\xbd\xcc\xe9V{\xbd\xa4\xadH\xc9\xc56o47J\x19w\x89\x9f7\xdd\xd6o\x97)0\xb7\xd6h\xad\xb7\xcb\x15\x15\xe86\x8a\xd7^\xde\xf4\xb1a\xb7\xdc\x83\xa8\xb76o\xe9n\xb9\xa3\xca\xb5\xdb\xc6;\xca\xdb\xde\xc9\x9b6\xa2\xa4\xd1\x92Wf\x1f\xc7:\xadh\xb9\xda&\xab4J\x93\xd8\xcb\x9b>\x02\xc5\xcb=\x97t\x9cjl\xad\xe2\xe5\x8e\xf1\x1c'\xa9\x97\x94>b\xad\x96)\x08y\xab\x91JV\xcb\xd5:f*\xbb\xf5\x922F\xb8\xe5\x0eD\xa6Q\x8a\xd3\xe5\x0e\xca\x88\xbc\x94\xf4\x01qIE\xca\xb4V\xa3\xb4Y\xae \x99j\x7f\xb2\x87\xbe\xa4\xfb&\xd0}\xd9\xca\xd60[\xd1:\xb5H\xd4l\xb5\xa42\xd8\xea!\xe9\x16[\xed\xc22m\xb5\x84\x01UV\xe6\xc8\x82s\xe1X\xc2\xd4Y\x18?Hu\xb3\x0ec\x84]\x01k\xf0\x18\x1fr\x0c\x16\xfd\x95i\x14\xaby@\x11\x8a\xd0\x9e\xf3\xf8o\x994\xd0\xf2\xbb\x0b]9|6&\x1a\xb1>\xa7\xa0}x\xbf\xa7\x08\xcb\x92`\xcd\xd4\x8b\x85\x1e1\x0dQ\xd6S\x84\xbcY\xd2\xa3\x18\x1e\xa3\xc8ZlJ\xb6\xb4\xb8\x97\xd99\x9e\xcf\xce\xc9|v^\xcdg\xe7t>;\xaf\xe7\xb3\xf3fdFUTg\xd2\x16\xbdU\xd0\xb1.se^\xa4\x80\xb1\xe9jK\xe8\x04\x85\x0d\xacu\xd3\x17\x97\xe27R\x92\xfb\xe2X\x94E\xff\x85\xd6\xf4\x1cs\xd9P\x96\xe4_+\xf9W*\xffZ\xcb\xbf6\xa64\x1f\x8d% \x97D\xcf\xb1)\xfd\x15\xc8M[\x90[m\x84\x8c<M\xb6\x83\xfc\xc4$\x97\xa4!rP7/\xb9\x95;\xc7\xd7\x82  \x0b)\x85|\xbdU5\x1a\xb2\x06\xa9\x1f\xdbC\x1d\x96F\xcfko\xcef\xaa\x8a\xc3\x0c\x98\xadp\x9c\xea\xf6r@\xd7\xa6!m\x86;>\x93m\xf0=e\x99.\x7fk\x96G\xf6\x03\xa6\xcb\xc2h\xf2~\xa1\xae\xdc\x0d\x80\xcd\x13\xea\xea\xb2\xc8\xd17\xa75\xfdX\xe4\xcf\xb1CH\x14\xeaZ\xcegu\xa9\x16\x0f\x1dC\xf6\x12nHP\xb2\xa6\xcc\xbc\xcc\xae%\xa28\xd7\x12\xd5\x1c\x15~]K\xa5sI\xce\"@\xa1Ye\xd1\xf5\x8b\xae\xffR\x92\x03\xb5{l\x8d\xb5vd\x91\xac\x80E\xce\xb2\xf07\xed\xb5\\^+F-\xa7l\xc8/*\x17\xdcVG?\x18%\x88e\x88\xdc\xc9\xb2\xd0\x9d\xbc\x9f\xcf\xf2\xdc\xcf@\xde\xdb\x9dS\x18\n\x1d\x01LR\xee\xe0m\x0fs\x99\xbc\\\x9c\xeb\xb6\xf8\x8d\x1a\xfb\x12\xe5\xbdkA\x01|\x9eX\xd8B\xb0\xffb\xbd\x81\x99\"X]gc\xd7\x0f\xdaz\xe1\xb9\xc8sRI\xa5\x1c\x16\x12IY\x16MWt4\xeb\xf1\\\xf4d\xd15\x98\xae\x84V\xf5c\x8b\x1b\x17{\x8e\x8a\xc4+\x98\x96\x9d\xd5\xe1\xdf\xd6Y\xd0.\x98\x80\xb0\x15\x7f\x87\xf6J\x00\xa1G*\x8c\\w\xea\xfa\xb6\xae\xee}\xad\xf02#\x97!\x0f\x9a\xbe\xe8q\xc9W\xf7\x97\x97+\xddPyv\x1aR|<\xb6?\xf7E_\x12}A\xfbL\xca\xc6\xc3\x9d\xd8\xa0\xc9\xf3\\PX\x16U\xd1\x17\xb8,:\x95\x116\x9e\xed\xa3?\x8c\xda\x076C\xfc\xf5Z\xf7\xc4\xe8\x9elp\x8f\xd7\xbaq`i`OAxT3\x0eh\xed2\x0e\nm\xd5oP\xfb\xad>\x8ao\x1c\xe3\xef\xca5\xfe&K0\x14J\x11\x83\xa5\xb5\xa7\xbf\x8e\xbe\xe5j\x11\x93\x1a8W\xe8Yu\x99\xbe\xfdW\x12\xc5)\xfaW\x14\xfd)\xfaV\x17\xe1\xb2\xb9\x96%\xf7\xe9\xd4\xc5:\xd9Q\x0c\xafOHW$+\x96\x04\x84\x0b\x80\x0e\xe9\x1a\xf2\x8f\xfc\x8c4sO\xc6 0G\xaf~\x99\xfd*]\xcb_\xb9?\xa8\xd2\x91yJ\x92\xe24\xea^2\xce\xf3\x96t\x9d\xa7m\x0cc\xae\xfbe\xbcC\x89\x1d)c\x10\x17Ft\xa8\x88\xaaL\xb0\xdb\x99\x15\xa0\xda.\x82/\xb3\xac\xa6{\xc8\x0d42\xb4\x04U\xf4U\xf3\x84\x92\xe6\xc9r\xdf\xfeN\xaa\xb2\x9e\xa3\xbf\xd7\x15\xce\xea9\xfas]uu\x89\xbb9\xba\xfbs}m\x0b\xd2\xa2\x7f\x90\xc7\xbb9\xba\xd4U\xcdl\xdc\x0f\x06_\x89\xae}\xc3\xf2\xf7\xb0\x00\xc3\xfa}\x8b\xf3\xe2\xda\x1d\xd0\xaaQ\xb7\x00\\Y.\x04^3\xbdRI\xf3\x84R]\xf7\xf38\xf5\xad\xbcoO\xdb\xd3~P4\xcd<\x92\x98\xc4dGK\x11\x92\xb3\xdbU\x16\xbb[\x82\x9e\x1b\xa3\xbd%\x98e\x94\x00\xa4\xb3\xbf>\xd6m\xbe8\xb6\x04\x7f> \xf6k\x81\xcbRf\xd0aD\xa4SHk\xa4iZ\xe2Jc\x88>\x19\x80)s\xca \xcb2wN{\x7f\xc4\xdfEs\x04\xff-\xe3\xf5\x07}\x97Gk\xad\xd4\xdf\xbc\x90\xe5Je\x82_6-\xe9\xfb/M[T\xbd\xcb\xbe\x8a\xfeA\xdb\xc8\xd6\x86\xc8=\xd9\xb8q\x1b\xaci\xc9\xa2\xcb\xda\xba,\xe9r&p\xf1$gJ\xb0b;\xf8\x08\x8b/\x07\xc4\xe1):uX\x15\xce\xd5\x01\xe6e\xc66H;\xd2\x87\xfcF\x8b\xa1\x92\xdc\x93*\xf7\x98\x1ac\x15\xd4ES\n/\x01\xbfX5)\xfb\xa5K?W0l\xd9=Z\xd91\x94\xcd(\xe8\xab\xbd\x89\x10\x85u\xb75[-\xd7z)\x83\x1fQ\xe2#)aWx.\xb7\xd8\x9d\x91\x04je\xc0\xaehN\xcd\x88\xa1\x9d\\\xc4k\x17\x02\xa02\xd3F\x8a\xb5[\xec\x92M\xc1\xd6\x10U\xb1\xbcV$/\xd8*\xc8b\x08\x89\x90\x05\x99\xf1<\xa0.I\x0c:,\x94Z\x0cQR\x7f\xa0\xa3\x1a\xfc\xa9+#\xba\xcc\x9d\xe6M\xa8\xcf\x9a\xfd\xf8,\x12\xf8\xa5\x83\xd6+z\x94\xb1\x9f\x80\xady\xedP\xa2\xcaMkl\x90\x90Xc\x13U\xe2\xdfEcBs05E\x02]|\xe7:\xe4lp=b\xa3\xb8\xe0{b\x06\x84dg\x92}>\xd6Of:\xb5\xa0\xf5\xdd/\xe3<\xaaC\xbe\xea\xe8\xd2\xd1?R7\x1c\xd8$\x82\xa5|\xfa\x88\xfe\xf6\xd7-\x8dD3[r\xe8=\x8e\xd8\x94\xe9v\x15\xfdk/\xcb\xd9\xb3\xe0\xb7\xbc~\xac\xa0@\x8f\x93\x10\xf9\xc6\x90\xc8\xd1\xaa\x91\x19\x0d\x03\xb2E\xcf*\x1b&\xd0\xa9(\x89[\xa4R\x840\x15\xb1<n%\xdd\x16\x83\xaa\xd3V\xa6\x8a	\xc6TI\x1a\x84\xf1d\x85s\x0c!\x13f\x9c\x87\x05\xfc\xf2.\xf1H#}A\xd8 \x8fH\xcd\x98\x10\xaae\x15U\xb49\x8b\x8c\xe4\xd9\xa8>\xb1o\xd0iHI.\xa4\xeaQ\x86\xab\xaa\xee\xd1\x91\xa0\xec\x8c\xab{\x92\xd3\xc8I\x8e1GuU~\x19\xec>h\x91\xd8FcZ\x0d\xd6\xeb\xd3G\xf4\xff\xd7-/\x12\xe79\x8d\xf1\x01\x8b\x86\xfa\x1a\xb19\xbf(\x98\x05p\xb2\xfe\xdc\x01A\xcd\xa2%\xe0wx\xaajY?\xa6\xf0BB\x8e-\xf6\xa0%\x14x?_\xaee_4%\xf9E\xd8\xfb\x9fi\x85u\xe9\x8a\xc6\xf0)\xff\xbb)\x94f%C\xa5\xf3\x15\x93\xbb_t\x0b(\xc8,i\xff\xae\xe9\xe2>\x18:\xf4l\xc4\x10\x19c\x11L\x07\xc5\x80\xcd\xf1\x91\xc34\xaa4\xd5\xec\xc1\xa2\x8e\x86\x9b,d)\"\x9a\x15\xfd\x84x\x89\xea>\xeb\\\xcf\x17\x05X[\xb1\xa2\x06L'az\xcf\xa9-\xf9\xc0\xac\xb0\x0c)\xe1\xe1\xdb&h\x0d\xd1Q(\x98\xd3(\x1e}\x8f\xb4\xef\x0ev\xbeGV\xd2\xb3)\xb5\x18\x96\xb0\x0c'\xc5\x0eD\x04-+*\xea\x02Gl\x9c\xa7\xff\x9b\xb3\x8bh\xbb\xfe\xe0T\xcf\xa9\x88\xaf\xc1\x11\x8c\xb2!\x0c\x82u\xb9}f\xbd\x1b\xb7(Z&\xdd\\\xa1\xad\xa6\xcb\xb1\xea-\xe8\xdd[\xb0\xeb7 \xbf\x16\x13\x9a\x9c\x07_\x0f\x0d\xaf\x04c\xc3\x98\x0e\xe3\"k\xe8]2G\xf1f7G\xc9jC[{\xf7A	\xb5\x86eNg\x0c\xb7\xe2Cl\x16{\xb0\xd27\xe8W4\x8f\xe6L\xb7\xe6lN\xb6\x13\x9a\xb7K\xe6\x94\x1f\xca\xcers\x93\xe2M\xa7\xf8\x8e\xec\xbd\xccT\xe3\xc6\x07!\xd1\x02\x0e\xab\xe8\xca\x12=z\xc8\xe5\xa3\xe0\xbf3\x8a\xfe\x1dG&\x08\\\xbd\x14U\xa1\x0e\xb52l\x8ag\x0f\x93P\xc8\xdf\xeb\xf9\x17\x92\x17\xd7\x8b\n\x10\xafu\x88\x12\xb7\xf7\x04=[\xd3(	\xf0dClu\x12O6\xc8Z\xec\x000\x1aF\xec\x93\x1c\xf8\xcdd\xd1\xd7\xac\x0ckBhC\x0c!(\xa3\x00\x9e\xd2\x15\x12~F\x06\x981\x9e\xd4qY4\xb46.\x0f\x9e\xfbPs\xdf\xdc\xd7\x83\x08\x91Os\xc9\xb0L\xb0\xc8@\x8e\xda\x8e{\xad\x91 \xe6\xc9\xa4\x15{i\xc5*\xad\x9dP+\x05 2iE^Zz\xb8\xa9\xd0\xaf\x01`o\x90\xda\xfb(iaQ\x1b\xd1\x1b\x86\xfc\x9dAh\xe7#\xa4\x07Ei\xde\x00\x93\xd4\xd6 \xb4\xf5\x11\xd2\x83\xa1l\x91o\x0cB\x1b\x1f!=\x14\xca\x96\xf7\xda \xb4\xf6\x11\xd2\x83jma\xa7\x06\xa1\xd4GH\x0b\x80Jla\xaf\x0cB+\x1f!=\xfc\xc9\x16\xb6\xa9\xe1^\x05\xd7\x83\x9f\x1c\xfam\x10\xf2k\xb7JH\x93\xf5\xcfy\xd1Q\xf6\xf3\xc1\x8e))\x82\xba\x9a\xc6\xa8\xfe\xdc\x12\x9c\xd3I\xde\x80\xa6\xa4H4\x99\xa6m5V5\xdd\xf7)\xebG\x92O\\\x02\x97\x19\xb0\x05\xe9\x18Dm\x16\xcd\x81\xd4\x07\x01\xcb6j\x05\xdc#\xb1Q\x1d{z\xa8\x1d\xf8\x808\xad\xb6.\x17t\x12\xd9,\x1fq[\x15\xd5=\xfa	\xc1\xda\xa9'\x7fI\xb7b\xf9z\xe0\x08\x8c2\x1f\x11\x02Z\xed\xe9'P:\x98h\x0f]\xb9f\xe9\xce\x16\x0d\xeb,R\xae\xf8\xdc\xc6\x8b\xf0o\x82\x1c\x8d\x00	\xbe\xbcn\xed7ID?\xfa*\xe5\xe0\xefQgs\xd3<\xa1o6\x19\xfd8\xdd\x1b\x07L0\xdb\xdb\x02\xe0\x894-i\xe8\xa6\xc1\x12\xe7\xf9\x82\x1e\xb0\n\x83\xe3F\x85\xf65\x80\xa5\x92tc|uLoi\x1d\xd2\xb6u\xeb\xd5R\x9e\x1b\xd2Q\x15\xe2\x16\x0d\xe5xn\xfd\xe4y\x1e\xed\xe4\x99\xef\xa4\x9b\n\x17\x1e\xa5Sy	\x82\xfc.\xb4\x12Zk\x9aNj\xc0\xaf\xd6\xc8\x13\xd9\x93\x9b\xda\xa4\xbbf\x19\xdd\xca\xf7\xe9\xa4\xc8\x0fi\xa5\x0e\xe3\xd2K\xd8\x12\x7f\xf1a\xba5S\xd0\xf5\xe8\xa6\xc8vk\xa7\xdc\x857%1\x89\x17\x8f\xf2\xe9\x1c\x8d\x00\x8d\xebh\x8c\xe9g\xdcr\xb2\x9f\x11\xcb)a\x82\xd9\xde\x16\x98\xa8\xa5\x06xHO\x87\x06\xb0\xf5\xf4Hrr$\xc1\xd6Q\x9a\xe1\xd0\x92_\xafEK\xf2CQ=\xe0\xb2\xc8\x87i\x90\x17@m!\x0b_c\xf4\xb8Oq\xbas\xf0B\xc8\xfa\xb4>\xca)\x94\xa7(\xa1\x04#\x1c	\xb0 _~M!\xfbU\x92\xe4\xa3\x9ar\xda\x1d\xf7\xc7mXS\x06\x98`\xf6\xcblI7\xf3\x17\xf4\x88\x7f]u\xfa\x9e=\x0dNd\xd1\xd5r\xb9\x1a\xe6\x9dl\xad\xd7H\x93\x1b\xe4\x90<\xc5)5C\xfc\x98sj\x04\xce\xab\xec\xc9\xf0%=u\x88`\x1a?\xa5\xe5A4\xe2\xe5\xadI\x00z\xf6\x04L:\xa3\"o\xf2\xd4\x8d\xad\xe1A\x19\x08\xf1i\x82\xba\xf8\x97\xb8\xd6{\x93	\x8b\xcb!\xc4\xdbq^f\xfcV\x81\xa6\xc4\x199\xd7\xa5\x88[\xb6\xe3\x1e\x863\xf2`\x8cF1\xf4Q\xc9\xe7\xb8\x8b\x0dx\x0d\xde\xb9Cm\xed'\x88H[\x93\xb4w\x8f\xc2ue\x08l0\xab\xdb\x19\xe8\x8c\xb3\xcf\xb0\x88;(\xb5\x7f\xebB\xee\xc9\xc2V\x8d\xd8N\xd1\xac\xf6|\xa6\x9b\xe5g\xbb\x0f:\xf1\xe4\xf0\xaba\xeb\x89\x02T\x8e\xc5\x1a\xac\x91*\x80\xad\xcebr\xe8\xeeM\xee\xfbB\x8c\x96\xd16\xf3\x95@K\xbf\x04\x07?P\xdfPg\xb1\x012>\x00\xdc\xc0\x10H(\xd7-[a\xfd\xf5\xda\xbb\xb2t9\xbb\xf1\x9cy^\x99\xbbix\xc0\x98\xce\xfc\xb6(\xaa\x9c<\x1dP\xe2\xa8\x8f\x858\xadMAf\xb4\xa1\xa4\x1dc\x01w/3\xef\xa4M\x13\x96:;\xf3\xee\x10\x1aq\x0c\xea\x9e\xb48%\x0b \"4Y\x0eii\xf3\x84\xd6\xb7FP\xe9\x91\xb6\x19\x11\xb1!\xda}\x14\xdc@Fj\\\x84_I'\x0c\x8ev\xd0\xe2\x8d2\xb4\x94my\xecm\xd8c_9nL\x80C+\xbe\xbe\xe4\xedA\xca0&{\x95K\xbb\xe8\xc8\xfd@,f\x94\x8b\x86\\\x12\xc2'r\xc2J\x11\"c\x97\xe6d\x17OP2\x99n\xd4\x1a\xe2\xb5y\xb5}T\x8c\xcdq\x9b\xa2\xb55\xee\x11\x1f\xb3!\xdc\xda\xf8\x04i\x80\x84\x08\xbc\xcct/\xddi\xe5\xdd\xf6\xdc\xea\xe4\xc6nv\x88\xa5w\xe6\xda\xcd\x8a\xa0@\x9bG\xb7'nS\x03\x11\x99\x06ih\xbe\x12\x8b#\xe4\xa6t\xa8:(\xd9\xe8\xf9\x7fj\x18	\xb5\xa4\x13\xc4=\"O\x11\xedW\xea\xdan\xd1+\x1dc\x1eF8\xf6\x1a\xb4\xb7\x93z\x1b\xc8\xd0\xc1\xf7R\xd3`\xf5J|C\xedJ\xec\xaa\x1c\xdcT3bwu\xcdz\xbb\xf2\xc1%U\xbf^I\xfbE\x9d\xfa	Y\xc7\x10cf$\xd3A\xf4_{5\x03\xc2\x97\x0cp\x9e:@s\x0fy\xb1CyM\xba\xea\xdb\x1e\x9d\xf1\x03\x11\x1d\x99\xf38G]\x8d\xf2\x9afR\xef\xa4\xeaY\xe0\x1c\x94\x0f\x9e\xb41\xe1\x8c\x02\x12\x13\x1c\xb9D%\xf2\x9c\xc9b^\xcc%$\x8d*K\x83	\x82\x96\xa6\x9c\x80\xd3\xd2\x01_,\x1b\x18$\xccd\x85\x8a\x99\x05\x84d\x87W9\xd1\x13\x15\"z\x06\x90Pg9\x06!W\x96B\xce\x95-\x88\x9a\xf6\xdb\xa4\xec\xcbW\xc9\xfb`D\x19Z\xd72\x0bpf\xaa\xd4\x9d\x00:i\xdc\xf8)\xe3&L\x18l\xc2\xd7\x9c6\xda\x8ao\xa8)\xbbT\xcd\x14\x8c\x9a\xa6\xca\x83\xa6{\xc2\x17U\x8d\x13\x0b\xc6\xaa\xc29\xa2\xfdU\xfe-\x1a\x9a\x88L\xfe\\y\xa2>\xce6\xd3\x11\xc1\xd2\xa2g{)\xca! \x11\x98\xa9q'B\x85L\xce4`\x91(\x805{\xa9\xccL]\xd6\xc97\x110\xc5\x14\n\xfbtr\xac\xc1\n\xce\xee~1y\x1e\xa5kU\xceM7\x10[\nC\x03\x0c\xbb\x90(\xc5b.H\xa3g\xef\"\x0c\x9c\x04\xfa\x1e\xe9k\xd2\xe8\xd9\xb3\xfc(\xfc\x00(\xb2\xaf\x1b\xea)\x96\xb8\xe9\xc8\x01u\xa4\xc1-\xee\x15\xadV{\x80\xb7\x00s-s\xe8\x84\xa3d\x8c%J?\xdc\xcd\x8b\x96SH\x99\xcb\x98^\xc4\xa1\x07\x1b\xcd)&\xce\xe2\x00\x98+\x1a\xd7y\xee\xd4[\x16_m\xf8\xe8\x8d\xf7\xfd\xa8w\"q\x82]S\xa1x\x03\xa9\xd6RP@:\x9d\xe5I\x1aE\x01U\x17\x89a\xc5\xd1R<8\x1fd\xa8\x8a\x87\x15u\xb9\xd9a1$\x07\xbdv\x0cO4\x02\x1cx\x1b\x89\x93\x90s\x8cA\xef\xc5_J&]\xa2\x16\xd7\xbb\xbe\xcc\x96C\x81FaF\xbdd\xb08G\xe8\xcfs\x81\xdbk\xf1\xdf\x07\x04\xeb\xfe\xa3\xeb'\xe2N\x02\xd3(\xb2\xcbIC[\x03\x10\xba\"\x8a?\xa3gs\x15G\x1c\xee\x97 \xf4\x12\x19\x004\x8b\xe3}\\!\x08\x97P\xa3\xef\x05^\xab\xe9\x8fR\xf31\xc8|\x80\xacKn\xbd&\x10\x1d\x03\x1d\xa82\xfet\xe6\xbc\xbc\x8e\xc3\xe6\xeaT[\x9c\x97\x1a\xc4\xcc.\x1b\xfd\x1e~\x9b\x90\xc9p\x8a\xcdl\xa0EVS\x07\xbe#*;j\xa2\xa1>reN\x12\xe0\x8e9\xdc\xc3\xe0X\x14\x13%J\x96\\v\x1f\xa1\x8fV\xae\x80Sq\xa5A\xf1\xce%\x02S	\xf7L\"u\xd7F\x91\x86\xac\xa1\xde\x080\x9b\n\xc8V\"NVZ'\nk\xdbw@\xc9\x1d\xa5L\xd6|7\xced\xd6\xc6p\x1c\xbc\xdd\xd0\x7f\x06\xe6\x18G\xef\x8f\x14\xec}7\xb1\xac\xd2}\x0d\xfb:y\xc7\x1a\x11u\xad\xa8jz\xd4\xde\x97m\xcf\xbd)\xa8\\\x1bpw\x91\xd1\x06\xd2\x17]nn\xab\xdc\\\x871:=\xad\x0csm\xcc\xda\x8c\xe5\xbbk;,\x9c\xf8\xab\xab0\xd4\xb7\xda\xb7IM\xebG\x1fmXQ\x05\xba\xec\x15\xf9+b\x00\x04\x91ui\xf2\xb16\xa4<\x01\x08\x87D9\xf4\x04\x15\xf2\x0be\x8a\x02\xf9[dL}\xa0:!\x0d\n\x81x\xab\xec\xd4\xa3\xaeo\x8bF0Mu\xa7\xea\xcf\x9c\xb5\xef\xea<\xff\xa0\x9a\xe7QP\xee+\xb96_\xf6\xf43h\xefP\x1a{&B)\xc4\xca\xf1\xd3\x84-/\xe1\xfe*\x91\xd6\xc6A	\xf0QS\x10!\xf8\xa8\xca$@!\x90\x04\x08\xc4\xc9\x14\n\xab\x00\x0bI4\x85B\x1a\xa8D\xb2\x9bBa\x1d\x10\xc3j3\x85\xc2&(\xc8)\x14\xb6\x01\n\xebI\x92\xdc\x05(l&Ir\x1f\xa20I\x92q\x14 \xb1\x9d$\xca8\x0e\x90\xd8M\x92e\x1cR\xcb\xfd$a\xc6!\xbd\x8c\xa3I\xe2\x8cC\x9a\x19G\xd3\x04\x1a\xd2\xcd8\x9e&\xd1\x90v\xc6\xc94\x91\x86\xf43^M\x93iHC\xe3t\x9aLC:\x1a\xa7\x93d\x9a\x84\x944^O\x92i\x12\xd2\xd2x3I\xa6I\xd0zn'\xc94	\xea\xe9n\x92L\x93\xa0\x9e\xee\xfc2\xe5\xc7\xf8\xfe\xef\x8fwEVW\x0b\xba\x14*\xcf\xe1!H\n-\\\x0f\xcb!P\x82\\\xc9H\xf5\x05(\x18\x89\x97+r\xb1W=\x00\xd6Z\xe1\xa0\xebfb\x99c\x18b\xd9M\x06\x07tm\xcb\xef\xee\x96\xcbO\xc5\xe5\xfe\xd3}\xf9\xa59Sv\xbb\xc5\x19\x97\xa7\xb2\xa8\xee\xbbeS\xdd\xdf}0Bm\x87 *Z\xa8\xe4Z\xa1N\x97\xc7\xb9\x0c\xe1O\x97\x94\x14w\xc6!0\xd3\xd9q-\xc21P\x16\x0c\x89\x9e_U=\x8e,*)(\xdeS>\xd1\xb3\xaf\xd2\x11b?\n\x0b\x97kWd~\x84\x05\xd5`\x15\x1eV\xd4\xfd\x08\xe9NG \xd5\x03)\xeb\x86\xf8\x99Zl\x13\x1d\xe5Lp\xdb\x07\x8a\xd8ot\xf8\xae\xc7m\x00\x9c]\xf2i\xc2/\xc8\xa5\xe9\xbf\x04\xea\x11\xa7F\xcd\xaf\x1diC\xf0\x1b\xa3\xe2\xa7\xa2\xbc\x84\xe8\xef\x8dZ\xf7g\xe50\xb1\x1b'\x89\x8d\x9a\xf7\xe7\x10tj\xd4\x9b\x96Pt!\xc9&\x1b\xa3\xd2\xf5\xe7\x10\xf4\xce\xa8rK.\xf5\x03	`\xacb\xa3\xd2t\xa3`QT\x81BV+\xa3\xce\x0c\xa5\xbe\xf6!\x9c\x8dQ\xf3\xfat\n\x15\xb13jM\x9f\xf2\xc3e\x00#\x8d\x8c\x9ag\xf5}\x08|e\xb6u\x8b\xbb`'Z\x1b\x95>\xd7\x97\x80bD\xbc\x9f\x0e\xe0\xf4\x06\x00?8\x036Q\xfa\"T\x02\xef\xd6\x06J[\xe3<P\xca6\xb1Q\xf2\xfa\xb1*k\x9c/p\x19j\xc0\xfd\xc6.M\xa0\x06\xd0xO7\xb8\xbc6cX\xa9C\x1cE%\xf6,=Em\x1c\x02\xa1\x1b6\x8b\xach\xb3\xa0\xf4y\xcf7e\xc9\x86\x9d\x00\x16\xef\xfb\x16\xd6\xa9%AM\xe2F\xc0@\xa3V`\xa4\x05\xb8%0\xf1\xea\xecs\x88\xc5\xdd\xd6\x96\xc9\xa9\xc4\xa1\xae\xc1-\x82Q\x0e]\x8bh\xceuE\xbaQ\xc3``>\xd4\xe5\xf5B\xc6\xfa\xfb&\xf2bR-\x0b\x15\xbaK\xbd\x85^\x9b\x00\"\xb7\x18\x06\xb7\xbf\xb6\xf2\xbeJ\x0f\xd6\xca!\x9d#\x1eE[;D\xd3\x87\xda!\xe2=|`\xad\xc7\xf7!\xe1\xd3\x1bLM\x94c\x1d\x1c-\xd2\x9d\x1b\xe5\x82\xdb\x10\xda6\xb1K\x1a\xae\x02u\x8bm\xbf\xb1\xb9\xcb\xf0\x85\xb4x\xdcx\xe8u\xa2\xdbe!\x9c4\xb5q\xe8\xaeZ\x08g\xb3\xb5e\xc7\xef\xd2\x0ea\xed\x1dr`\x0e2\xdc\x996j9\x1c\xa8l~\x10\xc2L\x1d\"a\xce9[K\nan\x1c\x82\xe1\x98<\x1e<\x84\xbbsh\n\xc7\x1d\xee\x9c\x0eZ\x13\x17*}:\xb68\x85<>0(:\xf2\x88\xc3\x04\xa6D\xc7\xe1\x91xc\"\x02S\xe2D\x1d\xab'X\x13\x1d\xf7\x843BG\xf1\xc5\xf0\x86o\xd0\xaa\xe8\xd8M\x91\xf5\xd7\x96\x84\xd0\xd6\x0e\xf94\xa4\xca\x8a\x80\xab\x14q\xf7~\xd0\xf4\x0bnh\xec\xc9\xe7\xa03M\xcd\xa4\x89\xc8_\xff\x0d \xa5;\x1b\xa9\x0f\x1b\x8amb\x97C\xe3\xaa\x03\xa5\xec76k\xdd\x19\xb7d\xdc/\xd1\xeb\xc3\xc2\x84\xc6m\x8b\x8e4\xe2_\x83W\xa2\xe3t=i\x16\x14\xfe\x11\xb7A\xc3\xb4wH\xe3D\xd7\xed' \x83\x91\xd1\x91\xa7\xe0\xa5\x0e\xd1P?*\x84\xb3qH\xa6\xc1\xd7\x8e\x8c[\x15\x1d\xa9\xa3\xb7?\x8e:':\xce\xa9nG\x04	\x86\xc4@\xa3\x82\x9c\x80\xbbq\xc8\x83\xb5\xe0\x04\xdc\x9dC.\xe4\xbf\xc5m\x93AS\xa2#eg\xf2\xd0\xd6\xa3V\x1e\xdc\x137\xee\xa8\x0d[;\xa4\xd4\x94\xd7\x8eM\xbf\xfc\x88\x11\xef\x83C\xef\xbb\x14\xd5(\x12X\x14\x1d\x91OW\xc70\xd3\x9d\x8dY\x7f\x1e\xc3\xda&6\xd6\xafW\xd2Qv\xc6p\xf7\x1b\x1b\xb7\xa8N\xf5\x18\x1eL\x7f\xf4JvYKH\xd5\x9d\xeb	~\x8cS<\xe3\xf3\x99\x8d[BS'B:\xe2\x11W\xe3\x98`mtL\xdc\xd2\xdb\xc5FT\x16\xec\x8d\x0bsLa\xc1\xec\xb8P\x83\xae\x7f\xb2\xdb\xdb\xf2\xe1\xcc\x8e\xcd6b\x87\x80\xd8`32{\x03\x0b\xa4#\xb6\x84\xde\x14\xbb8]\xcb2\xd0(`\x80\x9c\xa8\xc3uy\x1e\xdc\x9dCB\xb4K\x8f\xbb2:\x0e\xeb\xd2!\xa4\xd5\xca.\x08w=i\x8b\xee\xf3\xb8\xcd\xd1\x0b#OY\x89/xB\xcf\x8c\xa0\x8f\x0de\xde\x17#\xda\xd6<Y8%\xc1\xa1\xd5\xa8t\xe7\xc09\x15A\x07c\x9b8\xca!_\xc8\xa2n\xc8\xb8\xa51\xf8\xa3xYYwd\xdc\xd4\x18\x98p\xe1\xd0\xa8\x9dJ]biJ\\\x05\x8b\xdc\xb8\x04\x93\xe1\x92Tyx\xfdw\xef\x92N\x8b\xab\xbc\xbe\x8c\xdb\x18\xb3\xbc\xfa\xc2.\xa3\x0e\xe0\xa5.\xd1\\\xf0}E\xfaPq\x1b\x97P\xc4`:b`v\x01\xd4Q\x1b\xc3\xbaR\x1c\x8bC\xfd\xac\xdc\x96\xf4\x8f\x84L01\x06\xbf\xdd\xb9n\x1a\x1a\xaf\x9b\x85\x97\xf0\xc1\xca\x18\xd8'v\xab\xc1\xa8\xf2\x81\x99q#\x8fh<\xcc\x9c\x0c\\\xb0ob\x03j\xdc\xe5\xb1\xc4\xc5L\xab\x12\xc9\x1c\xa0\xc0\xfd\x9eXF\n3\x81\x9f\xf3\xdc_j\x04#\xf4P\xe0\xf1Z\x96\xe7\xba\xad\xc6m\x8f\x81G\xcar\xdc\xf6\xe88\x19\x95\xca\xa9\xc8pO\x02\xa8\xdb\xc4\x81\xda\x9f\xaf\x97c\x17\xd6\xde\xfd\xc6\x8f8\xa2\xbb\xe0\xf0\x18\xfc\x9eq\x95\x8f\x0e\xe6\xc2\x069PG<\x08a\x87\x1c\x98\xd7f\x82\x19r\xe0\x8dT\x13\xbc\x1d\x03\x93;I\xe0H\x8cUW\x18\xa5\x00\x891\xc7i\x93\x8eQ\x98d\xa4\x02\xf8#b\x00o\xc8\xa0p_\xd6G2\xc1N\xe9X\x8f-\xa9\xb2\xf3\x04\x03\xa5\xa3\xf5\xb8\xfb\xdcM\xb0L:\xd6\xa9(\xc5\xd9\x95\xb0Q\xd2\xd1\x8emAN\x19\xee\xc8\xf8\x0c\xcc,\xf0Z\x96\xdc\xef\x9f`\x87$j\xde\xd6\xcd\xb5\x99\xf3?d[\x0cl\x0e\xd7\x8e\xbc\x0c0\x8b\xbe\xbe\xbf/\x89\xb6\xcf-\x8e\x03-\xc4\x81{\x03\xf8 \xaf3`\xc6\xdaIK\xde5\xcd\xf7m3\xdc\x92~R B\xa4^q\xe1\xbc\xf8\xdeqp\"\x1db\xc7#\xf6\xa3\x04\x1e\x0e1\x84\x00\xa2]\xba)\xc1dt\xa5\x1bJ{+\x0e\xa1\x9a\x9e.\xe9\xbf\x1cP\xb4\\\xd1l\xae\"\x07\x84\xcb\xe6\x8c\xbf\x83\xdc\x1fW\xd1\x07M\xd8H\x91\x03\xc4\x14\xb0\x03\x08pjD\x0b3\x10sr\x81\x0bq\x87\x9c\x82\x14\xfd@Or\x14\xfb\xf9\x89#\x83\xa1\xc5\x85TW\xe3v\x1a|\xec\xea\xf2J\xcf\x90!*\xea\xe1\xa4\x8c\x0c\x7fP\xeeR\x89A\xd6\xb2U\xc5U\xcf\x10;&\x0e\xbfhw\x94\xc0\xd9&8\x1a\xc4\x02E\xd5\xb3\x84\x07\xb8Y\xc4\xf3V\xa9;\xb4\xd2\xb8U\xca\xbeM\xc4\x95c>R\x90\xb0p\x13q\x80\x82)\x8e8\x9b\x04\xcf\xe1}\xd4\xa3Y\xf5L#(VD\x11\xaf}A\xae\xf2\x80\x99\x07A\x92\x1b.\xa7\x8a(\n{\x9c\xc1\xc3<\x84\xd2\xde\x80q\x13\xb0\xe4i\xb0\x83YY4\x07\xd1\x98\x94\xd9\xa1\xb2\x1e #b\xc7A@\xd1{\xa6\xa2\xe6\x8b\x95\xd0\xa7\xb9\x86(\xef\xa7\x9bxh\x99\x17t5\x9dO/>\x1aG\xbfd\xac\x93\xda\xfdXo\x14I`\x11\x0fhA\x85\x18\xa1\xb5\xfeJ\x9cz1\x9aC)\xc9\x9a~\x94\x06\x16\x86U\xd1M\xa1\xb8\x16\xe7X\x0f\xdb\x92g\xaaA\xd0\xfc\xe2\x06\xf14\xa7v\x0e\xd28$\x16|,\xcdu\xb3\xa1\xf7\xe1[\xcdh\x94\x05\xfa	an\x95\xe6\x96\xd8\xe1f\x9b\x9f\x10\x0e\xe5\x81M{V\xd8\x18:2\xdb\x1c\xcbIV\xb7lj?D\xc59$\x9d\xc6\xbbU\x962)\xca\xf9\xc3G\xc3H\x89<\x83\x1d\x97\x94_f\xaa\xc29\x10F\xf4\xef\xda\x0cv\xba\xc2\x0fG\xdc.N\xc5\x13\xc9A\x01\x06\x8a\x00\xe6:\x13c)\x8ds\x8c\x1b\x86\xa5\x7f%\xf1>\xbe\x93]\xe7\xda\x0c\xa50\xbe\xc7Y\xd1\xc0\x19K\x8c\x17\xf1|\x96T^\xcf\xc1I\x18\xaf\xe8\x19j|6^\xb3\x17\x87\xe7\x02WW@$\x9f}\x14\x00\xc2\xff\x112\xcc\xaap{\x1e\xc5\x94\x88\x8e1\xa2K\x8bS\xb5\xb2\xb7\xc4\xeec\xac\x02\xce\xa1S\"Z\xdf5p\x88\xcb\n\xc7\x87\x94h\xfd\xe1\xdd+\xad\x92s\xdfu\xe8|\x81g\xc2\x1d\x89\x01\xbc\x9bQD\xd3\x0cO\xef\xaaj.\xa4\x0cW`\xea\xa9\xe6\xd8\x13+\xf4\x94 ;\xd9\xb8\x89%\x16M\x94\x1b\xbfjA\x96+\x15\xf8W\x16Mey{\xb3\x154\xec\xf0U<\x0eM\x16n\xf6	\xe7D\xf7\xe5\"\xbf/\x17iz\xa5\xbe\xf6\x03\xd8\xecI\xd7\x0e\x1e4\x92\xf5\x9f\x06\xd8M#XO*w\x1c\x06\xea\xbe\x84@\xc2\x9b\\Yq\xb85p\xc7\xa20\n\x91o\xecvI\x11\xc22\xa2\xe5j\xdd!\x82\xbb\xe1q\xb5	P\xdd\x04R\xf5xq#\x00J\xed\x85\xe8DU\xa5;4\xac\xc5\x99\xaf|\xcb\xc7\xf6\x06+8\xe1\xfd~\x98\xaa\x88\xee;\x8cDc\x97\x03\xcaF\x8d\x96\x89_\xab\x13\xd1\xaa\x94m\x87{`\x94\xe7r\x0f\x1c\x8fZ*e\xa7\xfe\xb2S^6\x7f\x99V\x11\x9c\xec\xf6\x91\x87\xfc0x\x1c\xdc\x93K\xf0\x14\x84\x9a\xd1\xbb_p\x8b\xabL\xcei^f\xf2\x8a>\xef\xfc\xd8\xbcQ\xe2\xc6;Xe-R1\x81\x00\xa3i\x8c\x88\xd1-\x8f\xc1~\xd4R\x85\x1a\xd9\x97eO\xbeOR\x0e@\xc9z=G\xc3?\xd1\x12\xde\x8f\xf3\xbd\x827\xd20\xaeQ\xdd:\x91\xc0z7\xad\x11n\x17\xf7t\x84 U\xff]_7s\xa1\xc7s\xf4\x0d\xd9\xd0\xcf\x87\x1f\x9c1\xff\xb4\xe3\xbf	\x1f\x14D\x16\xce\x89\xb1\x97\xc8\xe8?\xd4\xf5\x9a\xa3S[_\xbe\x03\x8e>\xccQ_\x7f'\xb8\x1a!\xfb&\xd6\xea7\xa1\xbf\nW\x1c\xe5\xe0\xbf\x17Oj\xd7m\xda\xfa\xbe\xc8\x0f\x7f\xf9?\x7f\xa3\xfc\xfd\x93\x1aJz\xf7\xc8\xf2\xefE\xd6\xd6]}\xea\x97\x92Oz\\\xa0\xff3\xd5\xc9\xaeo\x7f\xfc\x16$\xf7\xed\x1c\x91*W\x92)\x07d\xf3\xed\x1c\xfd/@\xfc'}\x0e&\xfa`\xbb'\x00:\xfc>\x9e\xe8\xc7\x06\xb4\xfc\x98\x0fS\x92\xe02\xeb\x8fJC\xea\x05C\xcf\xff\x0bn?\x13\xf6\xf8*\xe26\xab\xa3\x0f\xaa\xe6\xe4\x84\xafeO\xef\x95\xeb\xcf\xe4\x0b\xeaz\xfa4/\x8d\xb7\xbf\xd4-A\xf7\xc5\x03\xa9x\xcecm\xdcI'^I}\x85\x8cIE\xcf2\xe5\xe8Gt\xc2eG>x\xdc\xe6\xe1\xe9\xe7\x8f\x9ae\xd4\xcf\x08\x8b\xda\x1eW\xf4\xa3\x0e\xd0\x86\xa7\x95\xfa=-\xc8r\xa7\x8a\x85N>u\x13g\x9aD7\xf1y\xba\x11o<j\x94\xc4\xff\xcb\xe4\xc3\xdc\xbe*\x9c\xbf\xfa7\xc1\xdd~\x15\xc5w$\xc6\x87\x1d9\x87\xa7\x7f\xcb\xa5\xddc_\xc1L\x1d\xbe\x88\xc7\x90\xf8\xd7\xe1m$s\x89\xda\xd6U\x97&\xe7{\xfa\x91,h%\x85\xaf\xc5e*\x94\xc1c\xbc\xce\x0b4\xf5\xe6\x8dd!\xb6;a\x8cP\x13W\x1b\xa6\xd5\x8c\xdd\x90\xfe\x1f\xd01\x0b\xdeO\xf9M\x8f\xf7\xa4\x07\xc5\x84\xfb\x1fyG\xae+\xc49\xe4\xd7>*\xa4\x07\xb7\x96\xee$\xc2\x9a\x8fPW\xd5It\xe0\xd0i@p\x160	\xa7\xbb\x19\xa5\xbe\xb5\x90\x9b\xc0E\xcb\xcb\x97%\xbe\xfa\xdb\x96/\xaan\xceU\xad\x1d\xef\x00\x8eL\xae%p\xad\xa8=\xdc\x8a\xb5.\xc9\xb9q\xeb\xa7m\x02h\x07O\x0d\x1b\x14\xaf_m\x9e^G\xee\xbd(\x81\xb0\x83&G\xf8{0\xe0y\xe4<\xf4\xd5\x80\x90\x87\xe9\xc1f\xed\xdf\xcd\xd9\xac?\xa8\xfdN\xad\xabh.K\x9c\"\xc3N\xe3Ut\xadf\xec\x95\x83\xad\xca$M\xf4{\xcd\xe5\x1e\x16w\x07\xdd\xd0F<@\x02\xc6\\Y\xaeT\x8d9\xf3\x88\xb1}5!\xac_P\x14\xc7j	]:\xdf\xdb\xd5\x89\x1d\xd5\x897\x16\xa9\xd1\xd2\xe5-\xe6\xb4x\xf9^\xac\x94&\xd5\xaf\x8d-Lg\xe9bI\x91Rj\xda\xe2\x82\xdb/s\xed\x9b:T\x8ah)\xfd\x9b\x06\x91\xd3g\xee\xf5/Z>\xbc;\xa4\x7f\xd3 h\xd8(d\xd3?\x8d\xbc\x07\xd2v`\x8b\xc4\xb7\xf1%u\xd1\xd3\xe9P2\xf8 \x8a\x97\x9a\x0c=P\xd4[3{\xa2\xe2z\"\xaf\xab\x9e\x06\xf5\xd3\x13i=\xcc\x14\xc6:$\xaa\x03t`*\xa8L\x99A\x83E}\xb5\xed>\x91:\xc1\xef\xf6\xb9\xe2\xbaB\xf8\xac}\x1ao7Y\xea64\x81\x89%\xdf\xb9`\x7fl\x92,\xbdyb9\x11\x1f\x8c\xc3\x94\x89%\xa7\x08\x13K\xa0:B\xf6MU\xab\xdfT\xb3W\xe1~\xa5\x89%\x97\x9c5\xb1\xe42\x9c4\xb1\xe4\xa0\xc3\xef$K\xd3\xdd\x94\x05\xf2\x0fS\x92\x02\x13K^\xf0\xefbb\xa9wG\xcd\"\x82\xb5\xd2f\x13n\x13&\x12u\x0fC$\x8fOn\x06y\xb9&7\xab\xddz{L-V\x03l\xf9\xac\xca*I	\x8e\x94\xc9\x8e0\xbe>\x84\xd3i\x9f&\xc4\xd3\xd5\xfcf\xe8t\xc2i\x9a\xb3\x85\xaem\x1eE\x1f|\x04\xba\xb7\xe1\xdf`\x868G`\x86\x80\xea\x08\xd97\xb1V\xbfI2\xaf\xc2\xfdj\xeb[\xb4T\xcb\x0cq\x19N2C\x1ct\xf8}\\\xadwQd\x03N\xb09\xb7\x99!^\xf0\xef\xc9\x0cAw\xd4\xcc\x90H\xd3\xfa;$.\x9d\x89\x86\x19\x02\xd8q34\xc8\xcb%M\xb2\xd9\xc6\x10\xf90\x91-\x9fU\xc9\xb2M\x1aif\x88\xbb{>\xf8\x1c\xa7\xa7t\x7f\xb3\x15\xe2oS\xce\xd17\xc7|\xb5IN7;C\x13\xf1o\xb0B\x9c\"X!\xe0j\x84\xec\x9bX\xab\xdfT\xb3W\xe1~%+\xc4%gY!.\xc3IV\x88\x83\x0e\xbfwQ\x92&\xff\x0e+\xc4\x0b\xfe=Y!\xc7\xdc\x12\x92F\xe7h0o\x13\xa6FK\x1d7@\x83\xa8\\\x82\xc4\xfbU\x94`i\x80FY\xf2\x99\x93}\x9a\xe0d\xad\x9a\x1f\x98Y\xfa\x10\xd6\xc7\xe3v}tw\x92\x80\x17D\xe7\n\x9bd\x8e\xbeY\xc7x\xb5\x8eo\xb6?\x13\xf1o\xb0?\x9c\"\xd8\x1f\xe0j\x84\xec\x9b\xaaV\xbf\xa9f\xaf\xc2\xfdJ\xf6\x87K\xce\xb2?\\\x86\x93\xec\x0f\x07\x1d~\xafv\xdbh\xe5xR\xf9\xdd\xbd ^\xf0\xef\xc9\xfe@w\xd4\xbc \x91\xa6Y\x1bH\x84\xfen$\nk\xa3'\x8f\x1b\xa1A^.#\x94\xee\xf7IjY\x8e\x10[>\xab\x92F\xbb8\xd5\xbc \xba\x96\xe5\x85\xde\xe3S\x96{\xfa\x99\xdf\x06\xad\x8fY\x94\x939\xfa&9\xed7\xc7\xdb\x17\x84&\xe2\xdf`\x838E\xb0A\xc0\xd5\x08\xd97\xb1V\xbf\xa9f\xaf\xc2\xfdJ6\x88K\xce\xb2A\\\x86\x93l\x10\x07\x1d~\xc7\xa7\xcdj\xbb\xfd\xc1Z\xf4|w\x1b\xc4\x0b\xfe=\xd9 \xc7\xfa\xf8\xa9>\x8c.=\x9fj\xd3\xeePB\xe3Fg\x10\x90\xcb\xe8$x\xb7\xc6\xc3\xd4+\xc8\x8a\xcf\x80$\xe96\xdd\xa9\x1b\xddb\x8d\xdfkqb\xfa\xb9\xdd\xe2\xb0\x1fj1\xd8\xcf\xcd^\xcfD\xfc[,\x0e\xfb\x11\x16\x87\xfd\xbc\xd2\xe2Lc\xad~\x13\xfa\xabp\xbf\x96\xc5a?\xb6\xc5a?\xd3,\x0e\xfb\x19~\x0f\x11\x97_\xd9\xeba\xe5%\xbf/\x8b\xc3\xba\xa3\xe6\xf5@\x17=\x046\xb8\xa4\x05\xe0\x89\xc2\xd2\xe8\xc9\x13\x0c\x90\x94\x97\xcb\x00\xc5k\xfaQ\x0c\xd0([>\xab\x12\xed\xe8\x07\xcc\x10\x04\xc7\xb2\x97\xb5\xd57\xf3\xba\xeb\xf1R\xf4w\xbf\xc8=9\xf9\xf4\x98z\xf4C&\xca\xe3\x17\xcd\x93N\xf5p`\xae\x11\x8b\xebX\x14UEZ\x7f96\xac\xbe\xef\xac(-\xfb\xa2\x963lo\xfb\xeb\xa1l\x81\xdb5\xdaB\x00\xacY\xa3\xadY\xa3aW|\xa4\xa4a\xe7\\\x12e\xb2\x83\xe3\x04VIpj\xc0\xa8\x13\xdd\x00\x1f)H\xee\x91\xeb\xe5\xc0\x8e\xb8U\x8e\xba\xbd>\xbc\x1c\xe8:V\xac\x07\x1c\xbb\x82\xecT2\xc3\xcb\x81\x92\xf2M\x8f\x04\xba\xb0\xcc\xf7\x00\x07\x98\x891bP\xc3\xef\x91\xf2E	8\xe0\xd0j\x88D_\xd7\xe5\x11\xae/\x01\x92L\x9a\x10\xf0\x00IB;\xf6\x0eL\xa3$\xef\xf9\xe87\xc5\x7f\xab\x82G?!\xd9M\xdd\xcdh\x1e\xde\xbd\xe5\xcdf%\xe8Q\x8b+Q\x87\x10%\xcd\xc1\x98\xd5VZ\xf9F T\xf0\xa5\xa6\xd1\xa7\x98\x10\x1a\xa3\x00^\x8b\xfe\x88\xcd\xc4\xb2\xacg{\xcc\xc7pl:.q\x0c\xb7\xd1\xc3\x10!s]\x87\xf8\x1d\xa2q>\xcb\xe3\x96\x0d\x1cl\xd4\xa3g\xbd\x8fC\xb9\xa53\xb58\xfb\x89\x1f\x84F)9\x04\xb4d1T\xef\xa05\x9b\x90d(\xa4\x04\x19\xa3\xe0\x94\x8b\x132\xac5zq^:~\xa1\xf8u\x87	\xedu\x1a\xe4\xe7}\xd0\xa0\xcd\x88\x06\x05%5\xb58M\x83\x00L\x97\x95\x83\x92CX\x9a\x07'%$\x03L\xcdng\x06,k(\xaa7%O 'F\xb1\xa6\xdcu\xbf\x8c\xc1\x98\x87\x95\x95{:\xd4\xa0P\xb36\x06a\xd5#\x82\xae\x00'\xb8D\"\xf4\xf8\x9d\xa9\xb9C\xbc\"\x0f\xe4\x84;\x19\x1c\x11\xebqB\xa7jo\x8ek\x87\xae\xf0o/\xf7\x7f\xa0H\xdd\xf1\x02\x0bi9^j4\xa2\xaaa\xcc\x81\x9b\xd0\xd0\x10\xfai4\xf4\xdaG\x95\xf9\x9fN\xb2od\xd7oi\x04]x\x00\x14f	\x06\xc31L\x12&u\x0d{\x81@\x86\xe6z5\xfb\xb5\xc1\xce\x1e\x85}-\xb9\xf7\xa2\xe4\x90\x14\x9d\xf0\x8cHK\xcc*E\xbc\xb4\x9b\x8a\x08e\x9aJM\x84Iy\xa8\x89\x98\x88\x89\xd4D\xb4\x83\x87\x9a\xd8\xc9\x9cFL\xec\\z\x88\x89\x1d\x81\x89\xd4\xc4\x16\x84\x87\x1a[\xed\x9bHJ,,zI\xc1\xb2\xc1Dj\xb0J\x00\xe1\xb2\xca}\x13\xe0\x1f\xa9\xb3Y\xd3e\xd2\xce\xcd\xc8\x1b-\xe8\xc04\xb0\xa6\x92\xbc\xe9\x0e\"\x19\xae\xad\x10PyR\x0d\x15\xb3M>@uTg\xb6&\x08(=\x04jt\xc4\x05>k-G\xbb\xf8G\xcf\xa2\xce\x90\x8a\xa3\xdc\xb6\xe1,^\xf3FX9\xe2R\"k]My\x8aZ	\x1a\x84\xba\xccgj\x87\xd1\x13!\x14GK\xa3\n\xa7\xa7\x80B\x9b`L\x99 Q\xe5\x98V\xd4\xbe\x93E\xab\x8e#_9I\xb1\x0d\x9c\xa4\xd8\x82\x9d\xc2%\x81[&\xc1\xe6\xf3\xcbwV\xf4\xc4\xc0N9\x05a\xcc\xa2\xc5!t\xe7\x91s\xf7\xe9a0\xb1v\xff8\xadO\xabc:4\x83v\xcb\xc7iER\xbc\xd5\xfd\"mR\x0bc!\x8c\x04\xae,w\xaa\x90\xdcjO?\x83,\xd8\xcb)\"\xba\x13\x80\x8a\xeaL\xda\xa2\x1f\x80\x90z6\xdd9\x7fg\xaa\xb4\x80\xe1\x14\x86\xd1E\xe2<\xf2 .\xb1dM!\x95\xc4c\xce\x8f$'G\xf5\x91}Q\x8fc\x9a\xaf1\xdb\xeb\x14)\xe2d\x9d$-\xcfB\xf0\xaf\xa4mko\xf8\xd8\xe9D\xf6d\xef(\xe7t\xca1\x89\x82\x12\x0cm\xc9\x92\xf4\x14\x9d\x1c\xe7t\xbf\xc9\"\xb2\xe5\x19\x024>\xae6\xebh\x10:\x1c\xaeW\xbd,&e\xf1\x02\x9dpZ\xc4J\x8f<K\xa2b\xff\x84\x9a\xb9\x99r\x85\xcbkt\x15\xb7K\xa6/~7*\xa8f$+\xfc\xa0\xe6)W\xb5A\x8a\xd9w\xec{\xd5^\xd8\x05A\xe8'\xb8\xd9\xc9w1\x92\n\xa3\x1c6\xb9\xe5\xb6&q\xb3\x8e,\xd1\xbc\xdeK\xbf\xaa\x02\xc0h\xc9\xac\x7f\x90\xd6\xc9\x9b\xe7j,\xf5\x04U\xfc\xdak.\xf6\xec\xe7U6\x87	\xa6\x17\xfb\x0b\x07tm\x1a\xd2f\xe2\xfe\x0eZ\xb1\xb2@\xdf[\xb5\xb3\xd6\x12\xb9\x14\x86\xf7L\x0c\xdf\x19\x86)\x91*|gH6\x94 \x12:\xc3\xc9\x89&\x9f+Ex\xf8\xe1\x8a\xb50\xe8\n\x13\x13\xaf_e\x98]\xbc\xa8uT\xef:\xd3a\xc5d\xdb`^\xcbx\x8f\x13Q\x1f\xc6\xef\x1d\x93\x92\x0b\x1dX\x03A\x89\x19\xcd \xed\xdf\xd15u\x94\xe9\x1e\x1f;\xd0\x96\xa6(K\x1e\x877,\xfeC\xd5(\xd4\xb0\xcaOS\x18\xb0\x9e\xc4\x80\xd8\xba\xbfJ\xf0\xa6\x9d\x80Id\xcc\xad\x01\x81\xc4\xb4_\xc5a	\xaa\x19\xa2:o\xa3(:\xa7\xa0\x19\x9a+\x1a\xdc\x9c\xda\xea\x13^\xbd\x17%\x8ec\x9er4\x91,(\xae\x9a4\xed\xc3\xf5d\xecV-\x8bcE\x11\x05\xce\"6	\xbb:\xa0vK\xa9\xa8\x83 \xb1s\x1cK\x15\xa3\x8c\xd8}\x1bX3\xee\xc71VJ\x15\xe7\x89:P\xe2\x12P\x8f\x7f\xa5\x82\x84r]M\xa7X\x05@\x95\xc6\x81\x8dN\xe2\xfe7vC\x99C\x9c\xb6\xe5\xb13\x1c\x96\x87\xee\xce\xaf\xcd\xebgd\xc9\xd2,\xd9r3.J\x83\xa5`\xc04\x84j\x9d\x8c~\x19\xd5\xd3	\x0d\x0cZ\xaa\xee\xe7B\x92\x00\x84TO\x9b\xc2\xd8\xe0jK\xc8r\xa5\x1a\xac\xdbbw\xe48\xe4\xae\x88v\xd4\x8aw=\xce>\x93\xdc\xb2\x03\xaa\x9b\xa4\x03	i\x82<\xa0\xd3\x0f\xa3,U\x0d\x0d\xcb\xd1{\x03\xd0Z\x97\xf4\xab\xc6\xfb\xed\xc8y\xb9\xd06Y\x04G\x9er\xbfZ\x1f\xb6\xb9*\xf1T\xa6\"\x14	\xc6|L\x19 \xa1\xdc\x90\xa8\x0c\x03\x00d\x84>Bo66\x08\xa4>;\xa9\xb9\xec\xb7\xb8:\xd0\x8f\xe9\x12\x8eA\xc4\x1a\x03\x1c\xf7C\x07\xe4I}\x8e@\xe76@B\x04\xd4\x8a\xdc\xc0D\xa01\xdd\x8dh\x8d\xa6\xd6j\x9a\\%\x91\x82\xf5\xc1\xf8\x16M\x84k\xe81\xd9J>\xb4\xc6\xb0D\x15\xe2\x0cl\xdb\x04\xfe4\xc8\xb7r\xa9\xb1\x046\xd8#\x10\xcd.\x8f\xc0\xfa\xd8\x12\xab\x07>\xb6\x94\xd5\x05:\x83R\xb6\xc2E\x81z\xef\x13\xddnXt\xb3n	\xd4j\xe8\xdc`\xd0+\x16\x00a\xfdNf1\xc80[\xc1\xd1i\x98{\x82,\xcc\x0c9\x8d\xd4\x8b\xd4t\xc4\xcbP\x10H\xca\xf0\xdd\xd7\x07\xa7\\RO{\xa6\x1cg9?\xba\xf8\xfc\xf2\xe8\xf1\xf1Hg\x0b\xf6\xbcD\xe4\x0c\x93\x10\x99r\xcb\x94\xc3\x81dN0z|\\\xc0L\x85\xb11\xcc\xc6\xe4\xe5\x9c\xac\x86GR\xd6\x8fT\x85\x855\x9a3\xf2\x1d\xac\x8782\xe8\xecAM\xf7\xbb\x13*\x0f?!\xf6\xb5\xc1\x15\xad5u\x9b${?!\xfe\x9d\xe6\xe9\x02\x90>\x8fAI\xeeW\x9bt@\xcf]\x0b4\xde\n\x1bV@[\x82\x15\xae\xb7[T\xd6\xbcF\xb9\x11\xc6\x9a\xebH\x91x	\x8dx4\xef\xee<\x84*\xe5T\xf5\xa0\xdb\xefX\xb9\x1f\x95\x9eh/>\x99\x9d\x02\xa6\x98/(\xd0\xe6\x86\xf97\xc3?\x83\xdc-\xcd\x85\xc9\xb7[\xdf\xfd\x1e\xb8\x9f\x98Z\x13\x0fA\xd1\xca\xca\x9b\x14\xdbT\xd3\x98\xc1\x81\xf7:\\n\x0e\xacU\x03\x93\xa4\xb8\x86\x1cD\x07\x05\xf9\xf4\xdd[CU\xe5\x81\x86Pz\xbf\x8f$\xf4\xd7\xa7\xbb\x06H\x88\xc0h\x13x\xb5\xc4\x98V\x0f\xdf\x95Ea\xb7l\x1d\xaa\x1a\x82\xf1s@\x8bU\xba\x8e\xaa\xa7\xc3\x03\x1fL\xaa\x0bs\x80~\xf1j\x96\xd2\xf2\xf2\x86eh X\xec\xd1[\x1e\x12=\x0d?\xa6\xb9*\xe1\x91\x86\x97&\xcb\xbf\x94b\x80\x84r\xfd\x02\xf0\x1b-\xb3\xe5\x03\x0b,\x1e\xe1:\x9a>\x08\x14n{\xd9\xde\xe6\xba\x89h{*\xd7\x85\xe9\x9b\xbd\x88\xf7\x13 D\xdb\xb9\xf16\xbc9\x91\xe8w\x8d?\x14]\x01\xae\x044\x9e\x98\xf7\xcb\x1d8x(b\x08dW\xdf3H#}\xf1\x8d\xb28\\\xb8,\x96\xe4\xc0\x14\x88d\xd7\x12\xd3\x96~~pF\xca\x04\x0e%\x0e\x97\xfcb\xfa\xf9\xe0#\xd0\xbd\x0d\x1fL\xd7\xed\xd7\x1fs\xaa#d\xdf\xc4Z\xfd\xa6\x9a\xbd\n\xf7+\x1d\x11\xf2]\x7f\xcc\xf8w\x1f\x11\x12\x124LKx,q\x8f!\xfa\xa2\xef\x10\xf1\xc4\x03\x9aV\xc6\xb5\x92Zd\xa1\xbe9C?\xcb\xd8}\xc7\xee[\x88\xbd\x0f\x9d\xc1Z,\xa9\x93\x8d\x0b\xd1\xa9!xDN\x01\xa8\xf9\x12O\x18\xc8\xdb\xfc\x19\xa4XKWA\x85\xf9qD\xf7\x80qZ\x1e\xe9\xc3\xa8\xe3\x1b\xb3\n\x83\x0c\xc3\xe5\xba\x04vX\xe9\xe6\x1353\xe6\x1e\x06\xec\x0f&\x91\xb5\xf9\x9aD\x8e\xcd\xd7$\x8a\xec\xbd\x03u\xe3U\x9f\xe83v\xc1N\xd2=F\xf4l\xdbS\x9b`*\x9e\n5(\x94E\xf5yL\x9a\n\xa8\"S\xf7\xea\x08C`'\xa3$\xfa\x10%\x15\xd8\xb8\x17x\"6X\x9c\xcd\x10oO\xc95Y\xca	=\xa4\xe6\xad\xb6\xb9\x03'\x10\xb4\x1d7\x99x\xe3\x16\x9b\x03\xcf\x9c\xf2*P\x88\x9d\x0eS\x1e\x1d\xa2|w\xa4$\x99\x99\xb8\xa4\x86\xaa6\x13\xb33\xc9>\x1f\xeb\xa7\x11\xc1\x8d\x95\xa5W\xcf|r\xd0\x96\xa1^U\xa4\x9e\xa3b\xa6\xfc\xee\x97\xb9\x1fB\xf0\x1c\x04b\xb5u\\c\xaa\xac\xe4J\xbc%+\x9f\xbd\x17Q\xe5sg^CG\x89J;\xf10,$\xfa\xdf\xf2\xf2\x96\xe2\x94\xa5Q\x16\xfbf\x95\xa8\xa9iGp\x0b\xefs\xba=%\xc3\xd48X7\xfc$\x17\xf9%/\x86>\xcc\x0f\x17s\x82'\xc4\xe7;\xe0q3\x8bs\xc2\x97\xa2\xfcr@w\xffI\xca\x07\xd2\x17\x19F\xff Wr7G2a\x8e\xfe\xd4\x16\xb8\x9c\xa3\x0eW\xdd\xa2#mq2\x03HV\x8ewR|\xef\xab\xa9fL8\x91\x9ao\xe0\xc8\xb4\xf7v\\w\xe0\x0f\x03\x94\x18\x1a]\xc1\xc0\xb1\x8cBwF\xb2\x8f\xc40\xbf\x9ab\x98\xd8\xffc\xef\xebv\x1b\xc7\x91\x85\xef\xf3\x14\x06\x1a\x8d\xdd\xe0\x8b\x0d\xd9\x96\xfc\xd3\x03\x0c\xe6;\xbd\xf3\x04\xe7\xf2\xe0\\\xc8\x96\xd41\xd6\xb1\x0c\xdb\x99\x9f\x0d\xf2\xee\x07\x14\xab\xc8\"Y$E+\xe9\x9e\xec\x1a\xc6No\xa8b\xb1H\x15\xab\x8aT\xfd\xa4\x92\x07s\xa6\xb9\xc1\x95C\xb7]\xceH?8\xf3\xed-\x0b\xee\xb69ll\xf0\x99\x8c:=\xee\xcbm\xfd\xd8\xd5\xbb6t\x08V8\x88\xe0\xf8\x823\x83\x9d5\x0c\x1bF\xa9\x04`&\x1dL]\x99\xbb\x04\xab=r*\xd7\xe3\xeb\x94\xca\xcb\xde\xc4\xe5\xe26\x82\xd8{:O\x85\x873#\xf0	\xa0V\xfc\x0c\xca\xc2\xaeB\x9f8\xef\xf0E\xfb\xccp\xc9\xee\x91@\xe6\x96\xa2\xecf\xac\x0e\x82\xd3lNj\x9bR}\xcd\x0c\xad\x0c\x0e\x08}\xe6\xab\x07:'Ex\x9f`}e\xcc\x91\x90\x8b\x9aT7\x04>#\xde\x1f\xb2i\x90ui\x8f\xc4\xca\xf5\x11\xcd\x9a\xc1k\xcb6\x83\x15\x17\x18U\xfdAfDX\x88\x17R\x95\x90B\x8d\x94;$\xaf{\xc82\xb9&.\xab\x98\x04\xf7M3\xd3\x9f\x04\x8d\xd1>\xce\x8b\x08\xabo4#\x03\x9bC\x98\xb7?@!\x8a;\xb5\x99\xd7\xb0\x99=\xc9\xcdA\x1b\xdaG\x87\x80\xebfO\xe7\xb8\xe2\xdeX\x124_\xbdVW\xa4\x12\xd5\x17\xfc\xa0\x8c\x86\x80a\xcc[\xd7%|\x9c\xb6\xb9\x07,\x84\x9e\xa5%\xe6\xbd+\xd7\xac\x8b\"\xdb\xfe\xf7\xae\xa15\x96y\x8f\xe5y\x128g\x04\xde\x15#\x8b\xc5y\xbe.\x0d\"\xc0\xcdp\x8cU\xb4\x8c\x83&\xde1\xc1\xde\x04&R\xa7\x104\xa7\xfaz\x15\xc2\xe8\xfa\x12\x00\xec\"m\xdb\xa0&	\xef'\x10\x9cpa\n4B\xa3\x16\xbe\x04\x878t\xc1\x84\x0d\xeb\x1f7\x8c\xb9A	\x9b,\x8f\x7f\xd8\x03\x18\x91t\xe6\xa0\xe8\xcfp\xbbd\xbb]\xb2\xbd\xc5%\x1bl\x13s\xf7\"\xd9\xa3O\xdb\\\xfc\\\xc0\x1eIw\xd22\x7f\xe9\x8d\xfb\x97\xcf\xc3CM\x1a\xfeP\xc4\x9e-\x82'\x8f\x0c\n\x0dz\xa3;\x87\xa1}k\x8c\xac\xdcS\xf1\xec\xcc#\xf5\xe5\xde}\x06\xea\x89\x7f\x86\xf9\x88\xd8\xa7\xf1lE\x9a\xab8\x9e3}l\xd5\x85Xo\x92}\x81D\xd5T\xfc0\x85\x9a\x8bz4\xe9\x9c\xf4\xf1Z\xd55\xcaP\x17\x82k,\xaaJ\xb8\xf4dF\xc4\xcf\x98\x945\x0d\xa3\x1a\xd4*\xb0\x17\xf7\x88o\xe58\xdd`Fww;,\x1c\x81\xef\x0d\n!\x8a\xce\x1a\xfe?k=\xfd\xf7[\xdaa\xabs1\x84\x0b\xca\xd1\x0b-i\xfe\xb7\xbf\xfd\x14\xba\xbc\x83e\x92\x1az\xa9\xac\n\xcbT\x03(0\x14b`x:\xd3pV5\x19\xd3\x01\xc3Y\x9c\xfb\x9f\x8cCG\xb99\xb7\xfb\xe7\x0b\x89\xc9\x83@[I\xf4:\xb8$\xfaz\x16\xdck\xd2Vd\xd1oEb`\xb8\"\x1aN\x99m\xe1\x99\xa2\xf1N\xcc6\xfb\x98\x87\xe7Y/+\xc0\xa2c\x882\xffJH\xa4*\xff>\x8cW\x07G\x03\x9c\x16\xbe\x10R\xe9\xbe\x1f\x95\xfa\xedP\"\xd9U\n\x8e\xbf\xf0\x8f?\xb2}\xf2|.\xa8\x0f\xde\x1e\xe0\xa5\xf8&\xde{~\xba\xf0XC\xc6I\x8a\x04\x0f\x12\xff\xb3\xc7\xc92DHR\x1f\xd3=\xd3\xee\xe8\xd1,\x86\x94\x89\xaf\x8cK\x10s\xca\xc3\x17A\xd0\x91\xab\x05\x8d@\xf0\x1fY\x03\xa3\x9d\xf6\x10\x94\xcb\xed'?!\xd2\xbb\xaa>c\xd8_\x8d\xfcCQ\xf1\xcd\x8e\xa8rx\xc4\x07%\xa1`\xc1\xe9\x91\x1d\xc8\x0f\x89\x1fT6\xa7\xba\xac\xb6\xa7\xe7\xa7\x8dy\xf7\xb9t\x02\xcc\x85\x82\xcc\x02\x11\xb2\xbc\xc2\x17\xa5\x7f\xd3S\xcd\xab\xc3\x9a4\x18\xae\xf7\xa8\x08\xf7\x07\xa3!\xb9\xa04`\x1dv\xd8\x0b\x93\x16\xf5\xa8\x08v\xbf\xaa\xef\xf7=\xec	\n\x9a\x82\xf7\xa8H\x8e\xe2\x81/O\x9c\xd9\x08\x8f\xf8V\x8d\xcew\xee\x00\xf2{\x9cy\x08d\x0ft\xe6\xd6\x83\xf0C\xaf\xed2(\xbb!\xdc\x8b\xd9f\xae\x87\x14#\xd8V\x89\x83\x0c/t\x18\xf7z\"BP\xa2\x97\xa3\x17>\xdb\xc1\xb1\xfc\xb6;t\x97s\xc6\xe5\xda|aJ\x1a!eF\x99\xdd\x03\x92\x01x-\xbc\x81\xab\x04\xf68\xb9\xff\x86\x164GB\x9f	\xde\x92\x03\x9d\xef\x8b\xea\xe8\xe2+\x9b\x1d\xed\x91\x00l\xae9\xcf\x996T\xc9\xf9\xf6\x12\xe6\x99\xe6\xcce\xf5\x1c\x1a\xfd\xb7\xb6^1\x00\xbb\x99&\xa9q\xb8\x05\xae\x8a\x1f\x8c\xe9\x98\x0cJ\x04\xa7}B}\x0dt\xb3\xf7\x00\x1fSJ\xbb\xe3\x05\xc0\xe8|,\x0f\x16E\xeaY\xe9}\xc0\x98Cz\xec\x88\xf9\x15%\xce\x8a[\x84\x95q\x17xj\x8bL\x9b\xc9\xf1\xc3\"\x91\x95!\x90\x10\x02s\xf5\xcd0\xbdH\x10\x82\xc0#\xfe\x17\xf0\xe75@B\x08\x0c2\xc6\xdb\xfap\xa9O\xf0\x91\xb8c\xdar\xbf\xfbv\xf82\x92\x0flp}GOa\xf5\x87\xafc\xf9\x0d\xbegG\x05O\xc8\xe8\xe2\x08\xb1|\x9d\xba\x91\xb4\xbd*\xff\xd4\x06b<\x85\x80\xdd\xc3\xf6l\xea\x9eGDE}\x1a\x95\xdcs}@W\xf2\xa2 \xb6'\xb7E\x9b&,\x1d<\"\x1a\xf3opL\x81\xcf\xd8f=\x01\xb2\x11S\xbe5\x99BED\x8c\x1d\x84\x7f\x9e!5m\xc6\x98\x1cO\xf5o\xbb\xf6\xf9<*\xd9t\x0b\x80\xc8\x96\x1ef[\xa2\xe0\xc0\xa5\xe5$\xc6S[\x95\xfb\xb1\x15\xd7\xa7bO\xb5gwVd^\xf8\xee4	Qg\xc1\x0e\xc7\xf6\xa8\x08'\x90\x0b\x17Rd\x98\xbe\xec\x8e6\xe4\x92B\n\x1e\x12$\xfb\x9c\x140\xb7\x98\xe9\xae`h}b\x14\xa8Q\xa6Y\x9eY&\xb4\x1dI\xe9\x900i\xca\xaa6\xef\x008J\x1f\xd8~\x93\xdd\xc1\xea:Y\xf9#\x05Wp\x7f\xd0a\x0eN\xbd\xc8>k\xff\x0c\xf8\x83\xcc\xb2\xc8Lo}</\x83^(\x16\xc6GA\x91Z\xab\x00g\x80\xd1x\xb6\x82\x87<\xb3\x01\xbf1\x8a\x1e\x14\xab\xfb\xc4\xbe\xc5\x9aC\x91\x16/\x8a\xce\x02\\\x8c\x97`\xf1y\x84\xc3\xc2/\x1b\xe0\x91\xa7\x83BG\x0d,\xa1?\x96\x8c\x8b\xcd\xdcg\xbe\x85;\xa4\xc0*\x82\xc8\x82\xefw\xc7/(^\xc5\xc0\x9a\x88\x08P\xf89r\xb7fj\x1c\x9cz\x8d\x01\xb7\x8e&\xf33\x9cKE\xe5\x92c\xf7w]\x9e\xebq\xfb|Q\x04]\xd7\xf1|\xdd\x80\xedUt^\xd5GH\x98\xf1\xac\xf8\xacw\xa4\xb1\xa3\xbb\xe7EF\x1e\xd3\\^\xb0\xe8]\x82|[S\xa1\x94\"[\xa7\xaek\x17\x0f\xc9\x8a\xe7\xa4*Q\xb0\x9b\xb6\xfa\xd3\x88\xc6\x1d\xff\x89\xce\xf8\xa2\xdb\x1f\xca}3\xcf`[+\xd2\xa6\xe8y,1\x05\x1c\xb1	L\x8b\x06\x85F\xd3y\xbd\x14\xf0\x1f\xc6\x14\xcal\x9b\x07\xf4fP\xef\xaa\xcd\xdb\xadso\x83A\xd8\xb3\xe2\xce: \x1b,\x90\x08\x02\xd8\x1d\xfe\xef\xa6\xeaL\xaeF\xeb\x01\xd9\x0b\x9da\x10\xe2;j/\xd4.4ZS\xccCOG\xdbJ\xa4`\xddgF($\xe1\xda\xc0\xc0\xe2\xee\xab\xb7y\x87\xf87\x05\x11\xaaDN\xd4\\\xe0\xbfD\x11\xc5'\xcb\xa9*{U\x19\xaa]\xb8\xdan\xdf\xa9`\x12\xba\xa6\x98\xd8\x9f[Okn\xbf\xde\xce\xee)\xa5\xd7\xe9|\xec|\x01\xa3\x07V\x92d\xbe$#x\x9c\x89\xf0R\x1aq\x11\xb7B\x8a\xce\x06\x13o\xd0E\xe6\x0c*(\xc3?\xc6\xe5\xe9\xd4\xfe>z\xe1\x8d.0HLt\x85\xb1\xdf\x94\x1f\x12\xd8\x08\xc1\xaf\x9c10\x0c@\x01\\*+\x86=G\x86z-\xc6MS\x12h\xef\x1e[\xa4[\xa3\xf1\x94\xa3\xf0\x8b\xc1\xd9\xeb\xc0\xd1\x8e\x9f\x15=\xd4\xff\xc0\x85wg\xc9\xd1\x0f\xdf{\xc2\x8b\xef\xde\xe1\xbd\xfb\xda\xc3\xfb\x0e\x12O\xc3W\xcb?0U\xf2\xccQ\xa6\xc2\x1a\x84#\xbfk,s7\x0fi\xc7Q$L\xdbk\xd6\x15	\\\xcc\x81\n\xe2\x1eq\xad\xafw\xcc\x96\xe0\x85,\xcc\xbc{AhS\xc0\x05\x1e9\xf9\xf1}\xf5i\x8d?\x94MM\xa9\x8d\xc7rS:\xeb\x91x\x19\x89\xd6\x0c\x90\xe3\x93\x916\x98GF\xda`\x1e\x19i\x83	\xca&\x9a\xc1q\x7f\xfc\xc0-j\xed\x18\xba?\x91h\xd8\x9f\x1fc_Z\xef\xcd\xa6\xfa\x07\xaetX\x18\"\xdd\x1d#y\xd6\x1a&\xfe]\x85 \xacU\x88A(\xb9W\n\x07\"F\xa9\xc8$\x1ei\xea\xda!\xec\x8em\xe4\xbc\xa2\xcd\xf61|\x15\n\xf4^\xf8\xa5%<\xe2[5:m\xbf\xff\xc0\xab\x03-x\xc6\x97\xdde_\x9b\xebK\x8f\x9ef\xc8A\xdf\xb3\x17r\xb4}R\xa5\x0ba,\x93\xba\x88\xf7\xdf\xe5[ \xa1\xa7dz\x98\x90\xc9\x98 ~\xa2\xe2\xa6\xa2\x0fe\xea\x95\x19\x03\xc1W\x0ddBNoZ \xe1\xa7j\x98\xc8\xf5\xcc\xdb\xdc\xe1\xd8\xcbr|p\xdb\x9e\xf7Lc\x1bH\xce~y|~\xda\x1c\xca\x1dd?6Oc\xb3\xcc\xff=\xc38\xa8j,\xfa\x98J\xdaR\x0e\xa9l7\xfb\x88zj\x7f\x1f7\xfb\xe7]5\nN\x00rei\x08\x15\xb8d}\x02\x85i+\xd6\x07\xa3\xceX\x8d\x19\x06y)|\xa3\x17\xf6\xd8\xa9\xf6b\xee\xdd\x86\xee%h\xf8\x86#\xf73,<\xe2[\xf5>\xa0\xd2E\xec\xec)#\x89\xbcN\xe3\xf1.)\x03\xbc\xde\x95z\x0d\xc9\x97\x0f\x98\x82\x1b\x96\xe4\x9fENf1\xcdD>\xf6iN\\\x81=\x13\x89\xf4J\xec`p\xc4\xcf\xa3\xdd\xd37\x0f_\x90\xa3\x04&E7\x18L_\xe0\xd1\x00\x1d\xe5N\xa9\x96Lx(\x1e\x95k\x06\x95\xfc\x1d1\xfbrS\x0b)\xb0)+\xa8\xf9J\x8b\x07d\x93\xf5\x1a\xb8\xdb\x88\xff\xe6\x0b\x08\x00s\xb9\x02\x16C\xaf\xf0voS\x9ek\xc1\xe7\xdeh}8\xf9h\x8e2S\x8e\xd8N\xdfTXZ_\xd2q\x8a\x96Z\x80\xf7\n>\xed\x9ae\x8cm\x11\x10\xfc\xf0\x88\xeb\xf0J\x17\xd3\x18q\x1d\x1d\x11\xc2\xcd\x80\x13\xb9G\\\xab\xd8\"\xdd$\xd17\xa2\x94\x140\xdf	\xf5;\xf1\x1e-\xb9,\xa1\x1d\xf6\xf1\xee\xe9\xd8\x9e.\xe5\xe1\x82\xfc\xa2[|\xc1\x08\xa4\xd8\x8b\x85\xe3\x7f\x1eOu\xf3\xbf.&\xd9\xee\xc37\xcb\xc4Os.\x96\xd3Rx\xe0\xef\x1e\xe5\xb4\x8c\xfe\x165\x80%L\xcbv\xbb\xc8\xc1\n\x96\xb8\xa0\x92\x8c\xa2%RY\x868P\x19\xfd-Z\x00K\x98\x96i)~\x84\x16Q\x12F\x11\x12\xaa\x0fC\x8a\xbe\xe8\x9e\x16	\xba\xc9\xb7\xaeY=\xdd\xce\xcc\xf1\xbb*K\x84\x84\xee\xef\xdek\x01U\x9a\x1cBHk|-~\xc1\x8d\xfd\xcf\xfa\xcf\xe6T>\xd5\xe7\xce\xe5\xf1T\x9f\xcf\"^c|\xbe\x9cv\xc7\x1a\x12\xd9\x9dZ\xf9m\xc3\x10'\xfa,#\"E\x85\x890\x1a\xbd\n\xf1\xd4\x86`\xc1p}\xbd{\xbd\xfb\xa5\xdb\xcb?t\xfc\xf3\x0f\x1d\xbe}\x8b\xd1\xb3\xbeCS2_\xef~y\x83\xa1\xaf\x9c\xf8\x04\xe7:z\xf1T%Q6\x9ei>\xdaV%\xb3e\xafMh\xd7\x9d\xdd\x84\x93\xf1Z\xfc\xd2\x13\xda\xf5\xeb\x0f[Ny\x0e\x87\xdc\xaf;\x8c\xe8~-\xb1F\xd0\x0e\"\xad\x1d\xd4\xfd\xaa\xbe\xef\xe5~\x8d~\xd6f\xac\xad\xa0\xa0Y\xc7\x12\xda\xf1\xf1\x9d\xa4n\xab\xb2\xaf\xa6\xf1\xb0P\x7f7_ i` E\xa2a\xe4\x80]\xc9YE\xf0\x88k\xa5{p\x82\xd1\x8exE\xfd\x99\xdb\x81\xae\x91Dma\xb0\x15\x03\x17\xf5\x03\xcc\xd5\xac^g\xd5\xcc\xc3\xb6\xfe-=\xcd\xd7\x9bJ\xf8\xfeg\xf9*\xdb\xd4\xc9[\xbag\x7fx-}\xb6\xb4\xc4\x08[\x1a\xa8\x8a\xa0\x1dDZ;hfW\xf5}\xa7--W\xce\xd9\xd2r\x0d\xd3\xb7\xb4\xe7\xc44\x8dDz\x87\xbb\xa5\xf7\xc0\x97\xdc\xf5\xdc\xfd\xab;}\xc1n5\\\x96\x02\x8f\xcf\x81\xa7\xfe'80u\xec\xe9v\xff(\x9b,\xa4\xef\x8fZ\x88(\xcc9\x8a\xa6\x8d\x0d\x14|Ld\x15\xd8E\x95\x96Yd\xe7\xa0\x84\x92\xbc\xe2\xd9\x120qF\x01\xcb\x8d*\xfe+6n\x87l|\xbe\xb4\xc7\xbf\x8b\xf0\xe9\x07\x1d\xc1oT\xab\x9b\x16\xf7\xf7\x0c0\xf9\xa4`?\x8e>\xed=\xd02\x85\xaa\xa53\xee\xa5\xfd;%3Q\x0e\x8d\xf3\xa2\xaa\xbf\x05\x08\x18\xcd\x8a\xcf\xc6\x90nC\x91}\x0e!\x88<^\xda\xe8\xec\x86\xfb\x04\x8d\xf1\x91\xa7s\xfew\x9aM\xfbo4\x99\x8f:\x13\xdc\xf3dF\xd2\xa7\xab;\xeeaV(\xfbK\x0c\x07\xd2Fp\x84\x9e\x12\xb1\x8f!LJ\xea#\x85\xe5a\xf7\x04\xce\x1f\xec\xf1y\x86~\xad\xa3\xdd\xa1\xd9\x1dv\x17PY\xed\xbf\xae\xeez\xbe\xb6g{e\xc7kzQ\x95\x89\xd5\xc0q\xed\x18\x8dYU\xc54\xdf&\x1b\xd8u]4\xc5\xe6A\xa4\"\x9ao\xe7E\x82\x80J\xea\xefW\xd9\x8e\x81-1\x82\x81\x0dTE\xd0\x0e\"\xad\x1d\xb42W\xf5}'\x03[\xae\x9cc`\xcb5\xe4\x0cl\x97\xc5\xd2\xac49`\xf2+\xbfYi7+\xedf\xa5\xdd\xac\xb4\xfft+\x8d\x8a_\xfc\x94\x16R\xf1E\xbdY\x17\xb5G\x8d\xf9U\xfcb\xb6\xcd\x17\xb3\x87\xd1\xa7bY\xae\x8be\xc2\x19$\xa9\x7f\x82\x8a\x97\x18A\xc5\x03U\x11\xb4\x83\xa6\xd6\x0eZ\x99\xab\xfa\xbe\x93\x8a\x97+\xe7\xa8x\xb9\x861\x15\x0f<\x96\xa6\xe3\xe5\x88\xc9\xef\xfc\xa6\xe3o:\xfe\xa6\xe3o:\xfe\xa6\xe3\xb5\x8e\x17^&AY\x9bo6\xd3m\x93\xac\xe0\x8b\xcd6\xab\xea\x07\x91\xb1h\xbd\xd9\xa4\x7f\xf7\xee\xd9?A\xc1K\x8c\xa0\xe0\x81\xaa\x08\xdaA\xa4\xb5\x83fvU\xdfwR\xf0r\xe5\x1c\x05/\xd70\xa6\xe0\x05\x83\xa5iw9\\\xf2\x0b\xbfi\xf7\x9bv\xbfi\xf7\x9bv\xbfiw\xad\xdd\xd117\xa4\xe0\x9bf\x9d\xcf\xd2O\xf0MS\xe6y%\x1c\xdb\x9ae\x95e>~x:\x0f\xeb\x9f\xa0\xe0%E\xa0\xe0\x01k\x04\xed \xd2\xdaA3\xbb\xaa\xef;)x\xb9r\x8e\x82\x97k\x18S\xf0\xc0ci:^\x8e\x98\xfc\xceo:\xfe\xa6\xe3o:\xfe\xa6\xe3\xff\xc3u\xbc\xd0\xf1\xe5v\xdb\x9e*\x0c1c\xfd\xd8)\x94S\xbaL\xf9\xbc\x83\x8b-\x13\xf0X\x17\xe2g\x86\xf7\xbd\x8d\x8f\xb0\"\xbe\xcb\xcd\xa5B\x87\xd0\xcbP\xe5\xa7bAI\x13T'\xe0\x83\xf9T\x18\xd8J\x05\\\xbf\xde\xf1\x9d\xb9\xf0+\x0d\xc8\xc4\xc83\xe9\xc3\xec\x84X\xb8z\xafw\xa2\\A\xfb|\xae\xed\xd4\x81\xb4\xa0?\xfb\x02\xddJ\xaf\x04\x19!\x8b\x0b\xcd\xb7\xc2\x18\xb9Q)e\x93\xdd\xa5~2\x17R\xa5\xfb`\xbaj\x96\xa0.\x96\xca\xc9s\xbc;\x88\x1co*\x7f\xb1SB5\x00y\xee	\xd8\xf6C\xd8\x03\xc8]\x87P\x8ch\xe0\x95`N\xe4\x07\xda$\xf2\x93\x1a\x0d\xc7S\xfd\x1b\x8b\xdb\xa0\x03\\\x93^T\xda\x8c\xcc\x1a\xca\x8f7P\x17&#\x99\x1d\x84\x19\xc5\xe0$C2\x10j\x10\xcc\x06\xe6\x82\x08$]:\x0dg\xd6$\xf7\x0b\x8d\xfe\xd6]\xe5\xa4uR\x17\xff \x00i#t\xc8\xe9\xc2\xeeO\xed>\xb609M\xdc\x89\x89\x01a\x0f\xa1W\x19\xbet\xfc\xdbL\x05\x06\x8d$za\x911Q\xbc\xd3\xcc-\x1c?\x07@O\xc0\xa8\x13\xf8\xa0\xd5\x98Q_\x13E\xf8\\\xc7\xackL\xb8_-\x89<\x0b\xc4\xdb\xe23O\x17\x92G\xad\xf0\xe7Q+\xb2{\xe3%\xe3\x0bq^\x1d\xc6VCP\xb5\xca\x82hw\xbc.\xc0\x96\x10\xbb\xf6\x13\xbbv\x88\xa5a\xdc\xec\xb6R\x8c\x1cHy\xab\x03\x923\xd0\x1b\x98\xd8\xcex\x93\x18\x9bJ\x8d.\xb7\xd6\x10\x04\xe8\xbb4>\xe6d\xc3\xa9\xd6\xa3Q?\x00\xf9\xe1\xf5n\xf2X\x9f\xda\xf1\xf3aw15\x9b\x99\x82V)cdQ\xe6\x0b\x81NO\xe2\xe1\xb1\xeb\xb2\xba\x18$>NG/.Q\x99g\xc3\xd9\"Z\xed\xac\xdd\xe1\xb1>\xed:\xbd\xb0\xaf/\x97\xfa\xd4\xc5\xc0w\xf3Vy\x0d\xf5\xba\x1c\x9d\xd0|.,\x7f\xc6l\xe8\x19T{\xb2\x87}\xbd#\x85e<)\xabE\xc1\x1a%\x00\x8d$\x18\x82\xb8]U\x9b\xbaC\xd5\x7f=?\xb6\xbf\x9b\x8f\xb4Z\xd9\x1d \xb9\xe2\xe8\xc5J\xba\x88\x06\x83\xae\xd3Cr\xd6\xe3\xcb'V\xcd\xd7\xff/~v)\"UI\xda\xf0\xa2\xa5\x81+FE8\xc7\xee\xcd\xefG\x0f\xa3Q\x86\xc5\x8f=\x81j|\xaa\x08\x88\x9b\xb9\x0e\xe7\x9b\x92H\xd6ds*\x0f\xd5\xe8\xc5\x16\xfe2\x85\x83\x0d\xc7H4\xcc\xac\xe1\xa9!\xec\xc3\xec\xc4\xc4\x85fT\xdc\xdb\xafQY\x1d8\x84\xbb\xdb\xc99\x84\x16(&a\xf5\x1e|d\x92\xbd\xb1FVAU\xa5\xa0\x0f\xf7\xbb.5\xbaJ\xac\xaeS\xa6\xd3\xd3Bd\x04\xa7O\xb8\xb2\x99\x16\xdcJ\xcdLm\x9c\xbe\x9a\xfa\xa4\x02\x15\x14;\xe7\xa0\xe8\xea\x81\x96W\xa9#\x9c2\x16\xdc\xfe\x8b\xc5\x82F\"\xd4\xc2\xddR{\xf4[\x99\xd1\x97\x8e\x9c\xe3\xbe\xdc\xd6\x8f\xed\xbe\xaaO\x0f\xbd\xfa\xc1Z9\xbd\xd9\xa2\x1f}I\xf9\x82\x8b\xba;\x1c\x9f/\xd7\x13\xe5\xc73\x80\xbc/M\xbb}>\xa7pRJ\x8fI\x07[W\xfd\xa0\xe5\xeac\x1f\xaf>\xf8K\xf1cL\x8e\x89\x8d\xbe/\x8f\xe7\xael\x805y\xa2.\xbb\x83\x04nKK\x85*5\xedC\xfb3VaT\xc27\x81&\xb3sXX\xf1\x9c\xef\xa7\x058\xf7\xc5V.\xb6\xfcAQj\\\x19rZ#q\xe0\xf0l\x88A\xcbK\x7fR\xb8\xd2\x11\xeb\xbdF\xd0*\xa2\xda\xfd69?o\xc48=\xb51\xe2X.\x97!\x04d\x89\xfb\x8dj\xebi\x97U\"\xbd\x98\x11\xc3}\xaf\xaeX\xc9\x12\x12\xab\xbcIw\x15\\E(\x13\xf4\xf7\xc7\xdd\xa5\xfe\xef\xa7\xf6\x9f\xb5\x9b\n\x94\x18\xaa\xbf\x16\xe2\xc7[\x13.M>Bz\xf1\xa0~W*e\xba\xbb\x05>5S\xf1Kv\xa4jr\xf1\x13QM[\xf1\xf3\xdd\xc9?\x9d\x87\xf5\x07\xad\xd4+\x81H\x87\x11\xbe\xb3\x02\xd6\x08\xdaA\xa4\xb5\x83\xba_\xd5\xf7\xbd\xbe\xb3v\x14;\xdfY\x05\x05\xf5\x96\xfb\xce\xaa\xf8\x1b\x99H\x82\"\xd9\xa3O\xdb\x85\xf8\xb9\x80=*\xf3'\x16\xeb\xef\x06\x14\x03\xfd\xe5\x8b\xf5\x8b\\p\x97\x83:\x1c\x88\xff\xaf\xaee7\x17,\"\x0c\x7f`\xd1'\xf9g\x8f\xf2\xf2j\x1d\xd8\xf2\xf2\x8d\xf8)\x12\x98a}n\x96\xd5\\\xfc\xb0\x80\xbc\xa8\xc5p<\xed\x9e\xca\xd3\x9f\xbe\x0e\xcbL\xfc\x92\xc5\xc9:\x13?\xe1W\xd9\x88_\xb28\xe9\xd9?A\x9cH\x8c N\x80\xaa\x08\xdaA\xa4\xb5\x83fvU\xdfw\x12'b\xccu\xe6\x88\x13A\xc1\xbc\xe9%N$\xa8\xfew\xba\x16\xbf\xef N\xe4\xc0\x1fH\x9c\xe0v\xa4bE\xb5\xd1}\x8e\x8d\x13\xb6\x11\xe5\x8b\xd9\x1c\x17;z\xbd8\xb13\x9f\x89\x1f\x8a\x9d>d\xf9\xa4\xcal!~T\x0c\xa1\x0b\x99\xa7C\xb3\xa9\x16\xb3e\xb2\x18j\x9a\xaa\xceE\xa4R\x93o\xcb,K\xb7j\xfa\xf5O\xb1j:\x8c \x86\x00k\x04\xed \xd2\xdaA\xdd\xaf\xea\xfb^VMG\xb1#\x86\xe4\x1a\xf6\x12C\x12T\xff[\xaeV\x9b,s\x01\xdf\xdc\xaa\x91\x03\x7f$1\x04\xdb\xd1\x10C\xd8fH\x1ch\x9c\xb0\x8d\x96\x18\x02\xd8\xb8\x18\xd2\xeb\xc5Z?\x9bM\x01\xb9Y{\x92\xe5\x93*\xdbi\x99e\x19\x15C\x90m\xc2\x03_O\x8b\xbc\xc8=;\xcd/\x85\xeabQ/D8EU\xce\xaaY\x95,\x85z\xf6O\x90B\x12#H!\xa0*\x82v\x10i\xed\xa0\x99]\xd5\xf7\x9d\xa4\x90\\9G\n\xc95\xec%\x85$\xa8\xfew\xddL\xb7\xd3\xedw0\x86\xe4\xc0\x1fI\n\xc9\xddh\x08!h2\xc4\x8dl\x9bpm\x96\x04\x92\x90q\x01\xa4\x97\x8a\x13@\xdbr\x96\xcf\xd4EL\x9c$\x9f8\xd9\xe4\"\xe15\x15?\x18\n\xef\xe9\xb0\\o7E\x95,\x7fVeU-\x84\xb7\xf7\"\xdbdy\x9e,\x7fz\xf6O\x90?\x12#\xc8\x1f\xa0*\x82v\x10i\xed\xa0\x99]\xd5\xf7\x9d\xe4\x8f\\9G\xfe\xc85\xec%\x7f$\xa8\xfe7\x9f-\xd7\xb3\xe6;\xc8\x1f9\xf0G\x92?\xb0\x1d\x0d\x01\x84m\xc6v\x87\xc6	\xdb\x88\xd2\xc6\x84\x8d\x0b!\xbd^\x9c\x10*\x16\xebz^)!\xd4\x83,\x9fT\xc9\xb7\xab\xcd\xdc8\x8c\x85r\xca/\x16\xebj\x9b~\x12[n\xcb\xedV\xe4]\xcd\xf3\xd5j\xb3I\x96A=\xfb'\xc8 \x89\x11d\x10P\x15A;\x88\xb4v\xd0\xcc\xae\xea\xfbN2H\xae\x9c#\x83\xe4\x1a\xf6\x92A\x12T\xff;\xcf\x8af5\xff\x0e2H\x0e\xfc\x91d\x90\xd8\x8b\x86\x00\xea\x1a\x8cm.ZL\xd1\xd3\xb5\xa0\x80\x01a \xda\xe2BG/\x10't\xe6\xd5\xb2,WJ\xe8\x04I\xf1\x89\x9b\xf9bQ\xad-q\x13\xac\x1f\x91/\x16\xb3e\xfa\xa9+/\x17\xabe)$FV\x94\x8b2Y\xe2\xf4\xec\x9f q$F\x948\x92\xaa\x08\xdaA\xa4\xb5\x83fvU\xdfw\x928r\xe5\\\x89\xd3\xd1\xdfO\xe2t\xa0\xfa\xdf\xd9|>\x9b\x97\xdfC\xe2t\x03~,\x89\xd3mGK\xe8\xc86k\xb3w\x8d\xb6\xe8\x91\x8d(i\x94`\xe8\x9a{\x08 \xb5^\xac\x00Z\xe4UQ\x12\x01\x14%\xcb'Uf\xd5\xbc\xc9K\x14C\xe0-.\xc3\x97&pQ%\x9c\x08\xa0\x84\x16\xff|\xf2X\xef\x8f\xe3\xce\xff5\x02\xb3;\x88\xedd8Q\xd4\xb3\xf5l\x0e\x81;,\xf6\xceu\xcb\x8b\xf7\\\xef\xeb\xad\xff\xb1\xf0\xa1)Ou\xc9\x0e\xe9\xec\x8e~\xb4(o.\x1eFR\x14\x01B\xba$\x18uu@\"\xb7\xcb\xe5jj\x95\xc0\xd3~VX\xbe\xffS\xddlg+\x9d\x0f7\x02\x13|\xec\x9d\xf5\x04\xbc\xf0\x84T;T\xa3IYU\xe3\xf6\xf0\x10\x01/\x8f\x14\xda\xf7\x02\\\xden\x8af\xbe\xc9S\xdeN}:\xb5'/\x97\xca\xa7!\x1e\xa5\x10\x0c\x87n\xb7\xaa\xec.\xd7\x8f\xe7O\x89\xd3\xc3\x9d\xf2!\xcb\x9b8\x983\xfb>Tx\x98\x8e\xd2\x12\x04\x89s\xe5z\x8d\xe4\x05\xb9\xb2i\xd0E\xd7\xcf\x95\x1a&\xf8\xd83\xdf\x9e<i\x00\x078\x92,;\xc3\x91M\xbd\xae\x99\xef\xb4\xfew\x02\xc7P/O\xe2\xf3\x10W\x9a0\x0c_\xce6\xe5:\xe7\xe46\xf6\xe49\x13\x9fzx\x13\x1f\xb3\xdc\x89C:|\xd1\x8f\x16\x0f\xf3\x99\x14E\x80\xe2<:\x9b\xae\xb2\xf92*9\x17\xf3j\xb9\x8cHN\x0d\x13D\xe1\x9duO.\xb5\xc0\x03|J^\x80\xcb\xa7\x9b\xba\xaa7\xf5On\xe5P\xf2v\xa0\xf4\\\xac\xa8\xe1\x7f\xfdc\xf6\x95+\"\xe8\x83\xffu\xfe\xeb*\xff\x07\x81\xc7)y\xe0\x17_\xbf.\xf2\x9c\xc0\x87\xeeZ\x84\xc7\xdf\xd7\xdc\n\x17\xea\xe3\xea\xcc\xd6t\xed\xe1\xeb\x1c\xe8wU\x17;\xd6\xdb\xb6\x9b\xb3\xe2\xfe\xaf\x1d\xad\xf4\x7f\x03\x00PK\x07\x08\xd3\xce\xc4\xbf\x84C\x00\x00\xdf\xb1\x01\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x00	\x00bootstrap_alert.jsUT\x05\x00\x01\x80Cm8\xacU\xefo\xdb6\x10\xfd\xae\xbf\xe2\xd6\x1a!\x959T\xd2\xae\x18\x90B(<\xc7\x1d\x0cxN\x96\xb8\xfb\x92e\x03-\x9dlf2)\x90T\x82`\xc8\xff>\x9c~kM\x80\x01\xab>I\xbe\xe3\xbb\xf7\xf8\xee\xce\xd11\xc4\xdf\xe8	\xe0\x18~2\xc6;oeq\x0e2G\xeb\xc5\xbd\x83\x87\xf7\xe2\xbd\xf8\x81\xa2{\xef\x8b\xf3(\xda\xa1\xdf\xb6y\"1\x87\xe8^>H\x97XU\xf8\xe8mu\xccQ\xf6\x10\xfb\xff<\x8457\xc5\x93U\xbb\xbd\x87w\xa7gg'\xefN\xcf>\xc0\xe6Qy\x8fv\nK\x9d\x08JZ\xa9\x04\xb5\xc3\x14J\x9d\xa2\x85_\x96\x1b\xe0D\xd9\x11g\xe5\xf7\xe5\xb6b\xeb\x1f\xb7.\xea\x04D\xdb\xdcl\xa3\x83t\x1em\xb4Z\xce\x17\xeb\x9bE\xf8-\xe9\xc3q\x14\x04\xc1\xf7Y\xa9\x13\xaf\x8c\x06>	\xe1\xef\x00\x80\x95\x0e\xc1y\xab\x12\xcf>\x06\x01@\x14\xc1l\xb5\xb8\xde\xc0|5\xbb\xb9\x81\x8b\xc5\xe7\xe5z\xb9Y^\xae\xeb\xd8\x00r\xf0\xd0\xc1\x07i!U\xee\xa0\x9c\x83\x18\xd8m*\xbd<i~\x88\xdfT\x86\xbc\xb9cM\xe2\x8c>\x01 \x86\x9e\x11\xe65%\x80	\xbd\x0b\xa39Kr\x95\xfc\xc5\xa6-\xf0\x14\xfc^9\x91\xe4\xc6a\x18\x00<S\xe1\nK\xfc\xb6\xb8\xbeY^\xae\xa9t\xd5)\xac\x0fm\xaeg\xeb\x9bJ\xc3\x9f\x17_\xaeg\xf4\x021\x9c}8\xedS\nk\xbc\xf1O\x05\xd6\xd8c^--\">!\x02P1\x9fpz'\x1au\xc8a\x8e\x897\x16\xe2:KH\xef-g\xd5=xiw\xe8YH\x15\x01T\x06\xfc\xbb6\xbdE\x87\xd7\x00\xf6\x163\x16~\x9d\xd3\xa5\x1f\x1du\xef\xc2b\x91\xcb\x04y$\x8e\xf9\xa7\xf8\xed\xed\x1f\xbf\xbb\xbb\xe3I\x18M\x81\xb1\x90\x0c$\xaf\x0b\xc8\x8c\x05\x85?V\xa0\xd5%\xd6\x12&\x85\xb4\xa8=\x11\xe0-\xe4\x803\x86\x80\xa2\xb0\xf8\x80\xda_`&\xcb\xdc\xf3\xa1\xa4\xe6\xb8\xc8Q\xef\xfc\xbe\x176\x80\xed\xfds\x9e3Q\xb5\x05\x0b\x87<Z\x10o\xd5n\x87\x96\x93\x19\x13\xb1\xa0\x9a\xd4\x0f\xc6\xa1\xd8\xba\xf6\xe0\x90\x9cP\xae!uUS\xc4\x94\x87!X\xf4\xa5\xd5cl\x8b\x07\xf3\x80\xf3\\:\xc7\x99\xd2\xad/]/\xd6\xf1E\x8e\x07\xaa\xda\x0b\x89\"H\xd1\xcbd\x0f\x995\x07\xa8\x99N!S\x16\xa1*	~\x8f\x1a\x92\x1c\xa5\x86\xb2\x00\xf2\xbe1\xae\x95U\x9f\xe7a\xa7\xaf\xd6\x94\x0eD5\xf4\xf8\xf8Z\x84+\x8b\xc2X\xba\x18\xa9\x9d\xaa\xa6\xf8\xe8\xa8\xc3\xddK\xd7\xe8\xc9d\x8a,\x84O\xe3\xc2\xcd\x17\x800\x1a9\xdb\xbaM\x07\xb3\xd0)\x9b\x8e5\xb7\xed\x06 \xf0P\xe6\xd2\xe3(\x9d\xbf:X!\x9c7GGx\xbc\x99\xd6\xe1\x82\xb9Z}\xf9y\xb9\xfe\x8f\x1b\xa6Z1\x9d?Wy\xb9S\x9a\x9b\x82\xf8\xb4\xf6\xd4F\xd7\x1b\x02\xe9\x8e\xbb\xf4\x81\x83\xfd\x0c\x8f\x07\xb8\x8e\x90_\xd0\xcd/}q\xd67[\xd0(\xab\xc6\x97\x82\xe1\xcb\x89S\xe0\x14\x85\x184>\xd6\x0b\xa6\xae\x14\xb6\xb5\x08\x81\xb6\x8d\xc9\xa0\xd6\x00q\x0c\x8cFS\xefXX\xd1\xb8\xad\x03w\"\x91y\xce'\xfd\xaay\xee\x16\x1fi1yJ|E\xa6\xeb\xe2\xc4\xb1\xffjM\xac\x9e\xb8\xb9\xb6Q\x86\x98\x1b\xed\xbc-\x9b\x9dR\x91\x1d\xdb\xb4\xbe\x84\xf9\xe5\xfa\xf3j9\xdf\xbcb\xd0\xb8\xa6\xd0fnt\x96\xab\xc4\x8f\xd6h\xeb\xc1\x80]L\xf4\xff\xed\xdd\xd7\x8dr1\xdb\xccNfW\xcb\x97\xcaW\xb5yj\x92\x92\xdal\xf0\xa7\xd1\xcdS\xe5\xce\x89,\xd4\xf0o\xe4\xc5\xad\x1f\x06\xc13\xbf\xff\xb5D\xfb\x14~\xfcg\x00PK\x07\x08\xe5@\x80o\x8c\x03\x00\x00\xd3\x08\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x12\x00	\x00bootstrap_modal.jsUT\x05\x00\x01\x80Cm8\xa4Xms\xdb\xb8\x11\xfe\xae_\xb1\xf1i\x8e\xa4CC\xae\xa7\x9d\x9bq\xaaft\xb6\xaf\xa7\xa9c\xa7\x91r\x99\x1b7\xed@\xe4R\x84C\x01,\x00Y\xd1\xe4\xf4\xdf;K\x12|\x91(\xdf%\xe5\x87L\x0c,\x16\xcf\xee>\xbb\x8b\xd5\xe8\x14\xc6\xdf\xfa\x0d\xe0\x14\x16JYc5\xcf\xcfV*\xe6\x19{4\xf0t\xc1\xce\xd9\x9fi3\xb56\xbf\x1c\x8d\xecFX\x8b\x9a-\x85M\xd7\x0b\x16\xa9\xd5\xa8>6z\xe4O\xdcDZ\xe4\x96\xa5v\x95}W\xa81t\xba}\xd5W}t\xf8J\xe5[-\x96\xa9\x85\x8b\xf3?]\xc0\xbc\x84\x10\xc2TFl\x00\xa7$r+\"\x94\x06cX\xcb\x185\xd8\x14a\x92\xf3(E\xb7\x13\xc2/\xa8\x8dP\x12.\xd89\xf8$pRm\x9d\x04\xafH\xc5V\xada\xc5\xb7 \x95\x85\xb5A\xb0\xa90\x90\x88\x0c\x01?G\x98[\x10\x12\"\xb5\xca3\xc1e\x84\xb0\x116-\xee\xa9\xb4\x10\x12\xf8\xb5\xd2\xa1\x16\x96\x0b	\x1c\"\x95oA%mA\xe0\xb6\x02]\xb9t\xb3\xd90^\x80eJ/GY)fF\xb7\xd3\xab\x9b\xbb\xd9\xcd\xd9\x05;\xaf\x0e\xbc\x97\x19\x1a\x03\x1a\xff\xbb\x16\x1acXl\x81\xe7y&\"\xbe\xc8\x102\xbe\x01\xa5\x81/5b\x0cV\x11\xe0\x8d\x16V\xc8e\x08F%v\xc35\x92\x9aX\x18\xab\xc5bm;\xfer\xf0\x84\xe9\x08(	\\\xc2\xc9d\x06\xd3\xd9	\xfc8\x99Mg!)\xf90\x9d\xff|\xff~\x0e\x1f&\xef\xdeM\xee\xe6\xd3\x9b\x19\xdc\xbf\x83\xab\xfb\xbb\xeb\xe9|z\x7f7\x83\xfb\x9f`r\xf7+\xfcczw\x1d\x02\n\x9b\xa2\x06\xfc\x9ck\xb2@i\x10\xe4I\x8c\x0b\xb7\xcd\x10;\x10\x12U\x86\xd0\xe4\x18\x89DD\x90q\xb9\\\xf3%\xc2R=\xa1\x96B.!G\xbd\x12\x86\"j\x80\xcb\x98\xd4db%,\xb7\xc5R\xc3\x83J)\xfb\xbfh\x08\xa7\xa3\xc1`\xf0\"Y\xcb\x88\xf4\x83?\x0c\xe0\xcb`\x00pBT!oE\xf6\xe4\x15\x8cF\xf0hR!-\xbc\xfa\xcf\xab\xc1`\x00\xa3Sxs\x7f=\xb9\x85\xab\xdb\xc9l\x06\xd77?M\xef\n\xff\x0c\xe0(\x9c\xe2.\x80'\xae\xe1\x0d%\x10\x8c\xa1\xb97R\xd2\xa2\xb4!\xa8\x9c\x80\x18\x82\x01\x00\x05[Y\xb5\x06c\xb7\xdbl\x0d1\xc3\x15J\x0bc\x18:%A\xb1\x0d\xc0b\xccp\xc9-\xfa\xdeC\xcc-?\x8b\x85!\xdf\x8eO\x8a\x04>\xf9\xe8\x85\xe0E\x99\x88>\xb1j\x87\x15\x1b^\x08C\x96k\xf5y\xeb\x17\xd7\xa7\"\xc6\xb0@\x12\x90\xea\x1dYQX@BV\xd9m\x8e0.\xddF_\xa4\xa4\xb1z\x1dY\xa5/K9:\x00\x10\x82U\xcbe\x86\x97-\xb3\x9d\x99\xf4i\xb4k-\x8b{\x1e^\xd0\xbfL\x98Y\xaa6\x12^\x83gR\xb5\xf1\xe0\x12<\x02\xe3}\xf4\x9d\x8d;\xa7\x9b\x04\x8ei&\x97\xdb\x94\x93\x93Hou\x94\xbe\x10\x08\xfa\x90\xdd<\xa1\xb4~yK\xe0\x0c\xd9s1\xb3Z,\x97\xa8}lI\x88\x04\xfc\x0e\xd6\xdf~\x03d\xc2\\c\xc2\xd7\x99}\xab\x914c\xec\x07Ae`sv\xe8{\x0b\x15o\xbd\x80\xf18\xbe\xca\xb81\xbeW\x04\xe0L\xe5(\x0fp\xb8\x1b\xc6`\xf5\x1a\x9bM4\x11\xcf\x91E<\xcb\n(\xce5\x00\x0b\x1e}\x8a\xb5\xca\x9b\xbd\xf0\x88\x87JZZ\xcd\xa5\x11\x85\xff\xc60df\x9d\xe7J[\xd6Z\xfe\xfe\xfb\xc2\x915\xedX\xcaM\x85<\xe11\xb61\x97\xbey\xd1\x15\xcf\xb9&G\x07,C\xb9\xb4i\x17\x02\xec\xe9\xe6y\x8e2\x9e+?V\xd1\xba8N\xee\n`4\x8a\x95\xf4,\xac\xd4\x13B\xe10\x03\xb1ZA\xaeJ\xf0-\xab*z\xf4ho\xad\x030\n\xbc\x7f\x00\xbe\xf1\xc7\xb3@\x1f\xce?2\x95$\x06\xed\x07\x11\xdb\x94\xaaE\xa2t\x84\xa01\xc9\xd4\xe6\x0f\xc1iQ@tB\x0f\xed\xa8\xbc>\x0e\x82)\x89~_\xcc\x18\xcax/\xec{W;^\x17\xf4\x97^\x00\xbb\x00.\x9f\xb9i_\xbeq\xdb\xee -)]\xdbi\x89mO\"\xf1	Y^&I\x952\xed0\xec'n\xa5\x1d\xbaYKw|}\xd6\xbe\xf8\xd6\xb4\xed\x9c\x1bC\xc23\x83}I\xad\x91\x08\xfal^\x1f\xa6\xee\x91\xd2\xd3\xd1\xd5%\xc8\xf1<\x15\xe6x\x9ev\xa8D\x0e\xfc l:oHSW\x8c.\x15H\xb2(\xe9-\x81JQ\x91j\xbbNs|\xfbn\xfa\xcbd~\x03on\xe6?\xdf_\xcf\x8e\xf7\xc6\xaa5\xd649\x04T\xd7\xf3\xfeZ\x1e\x82\x15+Tk*\xf1\x06\xed\xbc\xfc\xc3ox\xe7\x8e\xf7T\x02\xca\xdd\xa3\x99\xe3\xac\xeb5\x9e\xd7\xad\x16`\x17\xc2_\xce\xcf+\x8eu\xfb\xc6Wdf\xa5.\xca\x90kgDeY08\x12\x02\x87bW7\xe7\x8e\x1f\x8bp\x95`\xe1\xcb!\xbaJk\xd1\xe4\xeb\xae\xda\xa4x*\xe2\xb8\xe9E\x87\x0d\xe5\xf0N'\xe3\x93\x0c\xfd\xf1{\x91\xe3R\xac\xb8\xc5*\xa0\xc7[\x0b=\x03\x8a&C\xcf\x00o0\xe8m\xbf\x8e\xf8\xd5C\x8994\x0eD	#V\x93\xfa\xd2\xbe\xc8\x93\x9a\n\x96\xcb\xc8B\xeb\xd0\xa9\xa3s\xbe\xf7\xd7X<A\x94\xf1\xfaIuV\xef{\xf0\xb26\xec%x'0\xfa\x9b\xe7\xbc\x0bp\xac\xb5\x0d\x06{\xaf\x8a}3\xe0\xc5\x18<C\x8f\xe1\xc8kLr\x84sR\xacx\xd4\xf9\xcf=\xe2ZE\xbal\xd4\xb5K\x82=e\xbf\xd7\xdd*\xc8\xddCG\xdaY\xe3\xf7\xa6\xfc\xec\x1d|>Y\x1aN5U\xc9\xad\xb9\xc6\xb1\x03\xcc\x0c\xba\xd7G\x0f7\xea\xcb\x1a\x0f\xee\x818Zn\x8f\x91\xa5\x9b\xf0\xfb\x8f\xa2o4\xd6\xc5\xafD\xf3cu\xc8\x05\xb1\xe5\x81\xae@;9\xf7\x1d\xd2\xf8\xcfY\xde\xf2\x1e\xfd\xbd;\xc8\xe7\xae\xf2\xba\x90\xf6z\xcc\x0fz\xf6`\x0cr\x9de\x07\x8a\xcb\xe6\xe7?W\x1e\x0e^\xd7\xfb\xe9\xfd	\xb7\x0b\xc5u\xec\x94\x00\x0c\xeb\xd7b\xc0\x94\xf4\xbdO\xb8]\xe7\x07\xf3M\x0d\xc2\x07\x84\xe60\x00\xb2M*\xa2\x14\xc6c\xb8\xf8\xa1~\xeev\x8a\xe3.\xd8\xf7j\x87fG\xa0$I?\x96J\xd9a\xef\xbc}\xff\xf7\xe9\xdd\x1f\x9b,]\xff\x1c\xb2D\xb2\xd5\xc1lY\x16\x11\x87\xab5f1\xe4Q\xda\xdb$\xa9\xcb\x0e\xc9\xaa\xa2\xd0u\xa7\x8a\x10h\x98\xa4\x0dZg\xf4\x87\xef\xb5\x8d\xa1\xaf\x1edI\x8e\xe1g\x8b2\xf6\xbf\xec\xc2\x16F\x16\x97\x8f-\x13\xb65\x05!\xd0@\xa9\x92J\x01E\xc2S\x8bG\x8c\xacG\xf1\xa8\x8c\xa9\xd0\x14\xde'\x04A\x0f\x9a\x10\xfc\n\xa9\xc4\x0d\xb8>(L3d\xd7\xa5\x90\xf4\x1c^K\xf3\xbf\\zAa\xf0Cys3z\xd6U\xa6\xd2V\x0c\x11\xa5\xac\x9b'\xbam\xb9\xc7\xf4bn\xee\x0ek\x97\xe5xGk!8~w\x16Iy\xbd\xb0\xaf\xf9\xaa\x99\xbea\xec\xc6\xef\xd6\x9b\xecz2\x9f\x9cM\xdeN{\xe8\xe4X\xd4\xc3\x88fT\xa5\x9c*\xda\x8b\x0b\"\xfd\xb0\xc0sA\xbf%\x94\xbf2\x94S~\xfbG\x86#\xd9\xd6C\xb2\x10R\x8dI\xe5\x11\xb2uh\xb9^\"\x15\x85\xa1_F\x98[\xab}\xaf\xbc\xa9\xd8\xf3\x02z\xbd\xfbt\xb0&e)DK^\x10\x10m\xe8\xbfLc\x9e\xf1\x08\xfd\x11;\xf5_\x8f\xbf{\xf8\xf7\xbf\xcc\xc7\x97\xc3`\x14\x82Gb\xa3\x11\x05<\xa7\xf6\x06\x02\x7fh\xa1pTtp\xba\xa4\xa7\x87Ii4=M\xbalo\xcb\x07]\xa2W\xed\n\xfa&\xa0\xeai_\x9d.<\xed\xd2\xb8E\xaa`0\xd8\xf9\x1b!c\xb5a\x8f\xff\\\xa3\xde\x06\xaf\xfe7\x00PK\x07\x08\xe4\xfaT\xa1Y\x07\x00\x00-\x16\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x14\x00	\x00bootstrap_popover.jsUT\x05\x00\x01\x80Cm8\xa4U\xefs\xdaF\x10\xfd\xae\xbf\xe2\x852\x91\xf0\xc8\xc2u\xfa	\x1bg\x08&\x0dS\x17\\\x83\x93f2\x99\xce!\x1d\xe8<\xe2\xeezZ\x8c\x99\x98\xff\xbds\xd2\xc9\x08\x87I\x93V\x1f\x98\x91v\xf7\xed\xdb\xb7?h\x1f\xa1\xfb\xdf\x1f\x0fG\x98)E9\x19\xa6\x8f\xb5\xd2\xea\x9e\x9b\xe8.\xc7\xfdit\x12\xfdb\xcd)\x91\xee\xb4\xdb\xb4\x16D\xdcD\x0bA\xe9j\x16\xc5j\xd9~\nl\xdf\xb1{\x96\xc7Fh\x8aRZf?9\xa0\xdc\xc6\xd7\xb2\xfd\xe8c\xc3\xfbJo\x8cX\xa4\x84\xd3\x93\x9fO1-i\x84\x18\xca8\xf2pd]\xaeD\xcce\xce\x13\xacd\xc2\x0d(\xe5\xe8i\x16\xa7\xbc\xb2\x84x\xcfM.\x94\xc4it\x82\xc0:4\x9c\xa9\xd1:\xb3\x10\x1b\xb5\xc2\x92m \x15a\x95sP*r\xccE\xc6\xc1\x1fb\xae	B\"VK\x9d	&c\x8e\xb5\xa0\xb4\xc8\xe3P,\x13|t\x18jFLH0\xc4Jo\xa0\xe6uG0r\xa4\x9d\xac\xeb\xf5:b\x05\xd9H\x99E;+\xdd\xf2\xf6\xd5\xb0?\x18M\x06\xc7\xa7\xd1\x89\x0b\xb8\x95\x19\xcfs\x18\xfe\xf7J\x18\x9e`\xb6\x01\xd3:\x131\x9be\x1c\x19[C\x19\xb0\x85\xe1<\x01)Kxm\x04	\xb9\x08\x91\xab9\xad\x99\xe1\x16&\x119\x191[\xd1\x9e^\x15=\x91\xef9(	&\xd1\xe8M0\x9c4\xf0\xa67\x19NB\x0b\xf2a8}7\xbe\x9d\xe2C\xef\xe6\xa67\x9a\x0e\x07\x13\x8co\xd0\x1f\x8f.\x87\xd3\xe1x4\xc1\xf8-z\xa3\x8f\xf8m8\xba\x0c\xc1\x05\xa5\xdc\x80?hc+P\x06\xc2*\xc9\x93B\xb6	\xe7{\x14\xe6\xaala\xaey,\xe6\"F\xc6\xe4b\xc5\x16\x1c\x0b;SR\xc8\x0547K\x91\xdb\x8e\xe6`2\xb10\x99X\nbT|\xda\xcd\x81\x03\x8d\xfe\xe7 \xe2\xa8\xedy\xde\x8b\xf9J\xc66\x03\x82f\x0b_<\x0fh\xd8a\xb1z\xc5\xd48C\xbb\x8d\xbb<\x15\x92p\xf6\xd7\x99\xe7yh\x1f\xe1z|=~?\xb8\xc1\xf5\xed\x9b\xaba\x1f\xfd\xab\xded\x82\xcb\xc1\xdb\xe1\xa8\x90\xca\xc3\xbf3+\xb2\x03\xf7\xcc\xe0\xba\\,t\xb1\xe3\x02\x9e\xf1%\x97\x14Bi\xcb.\x87%\x07\xa0\x98\xe2HHA\x81\xef6\xd2\x0f\xbf\xf2ny\xc0\xd6\x92\xb5lG\xe3\xe9\xa0\xf3\xc4y\xf0\xe7t0\xba\x9c\xe0\xcdx<\x9dLoz\xd7\xc7\xd3\xf1\xf8j:\xbc\x8e\xee\xf2\"\xc1\x0f,\xb7+\xc2\x15\x10i\xa3H\xd1Fst\xd1\x8c\xf8\x03q\x99\x04_\xb6!\x9a\xd1\\F\xa4TFBG}%s2\xab\x98T-\",\xa5\x07\xe2\x9d\xb5S\x01\xdb\x1c!rN}%\x89K\xea\xd4\x84\xaad)\xa5l\x92\xd0\xe8\x96\x1a\x91\xd0\x81\xd5\xa1|B\x90\xa0\x8cW\xc6\x05\xa7\xa9}\xdf\xf3\x88K\xf8\x9a\x8fK\x18\xb4<\xe7f\x13Ds!\x93\xc0\x8f\x9c\xfc\xc7\x05\xb0\xdf\xfaT\x04\x89\xfc\xdd\xf4\xf7\xab\xa0\xf8\xd6\xc2k\xf8\xf6v\xfa\xe8\xc0'\xfe@\xfegg\xf9\x06\\\xc5\xe2\x02G\xcf@\x9d\xe5 le\xdb#j\xf8R\xdd\xf3~\xc6\xf2<\xf0\xe7,\xe1 \xa51SDj\x89\x8c\xcf	\xe5\x15\x16\xd2/\x19mmx\x88\x94\xe5\xdf\x94\xdapZ\x19\xf9\\I<>\x1e\x10\xae\x06\xbb\xf8\x8e\x0e\xba:\\\x15\xb6+\xcd\xa7\xa65\xdd\x98\xd7\x8c\xaa\xb2\xb95\xa9\xcaw0v\x10y\xc4\x88L\xe0'\x8cX%\xae+\xd7>\x8f\x8f\x08\xec\xcc\xaa9T\xe4\xcc\xe8v\xe1W\x0c}\xbc\xdeY\xa2\x98eY\xd0\xe4\x9fN>\xb7\xd0\xc1\xce\xd0\xf2\xf6\xb5qH\xf5\xf2I\xe8\xc3\x93+\xe6\x08^\x14U\xd8\xf1\xdaM\xb4[v7\xd4\xcd\xa0^hD|\xa93FO\xa3\xb4=\xd0\x1b\x1b\xb9c\xb0m=?_W\xb7\xbf\x0eG\xdfy\xb8\xdc\xae\x17\xab\xac\x0f\\\xac\xb2\x01\x15\xf9\xfa\x84p\x16\xa7\xc1\xa1\xba\xed\xf1k\xda\xa2\x9e\xaa\xab\x8a\xb1}\xb7\xfd\xb2\x06\xeb\x10\xd9\x97\xdd\xc1\xab\xbb9=\xec\x1c\xb8.\x16\x1f\x8a\x16\xaa\xd9\x1d\x8f\xc9\xc7\xcb\x97\xee\xab\x8b+\x04\xb7\x90\xad\x83\xf0!\x02\x97\\\xf2uu\x84\n\xf5w\x07\xb6Uq\xb0X_g\xb6\x7f\x1fr\xe1\xb7\x8a*>\x95\xc9?\xbbc\xb3u\xd7y_\xcc\xfa]D\xb7~\xfa\xf6\xbc\x12>g\xab\x8c\xf2\xfd\x13\x8bg7\xb6\xf2\n\x9d\xd6:cq\xf1\x0f\xd1\x81_\xac\xbc_,\xa4\x1b\xd2\x0e\xfc\xf2\xbd\x9a\xa9\x0e\xfc\xf3D\xdc#\xb6\x97\xa3\xdbp\xb9\x1b\x17\xf5\x8f\xcc\x18\xb5n\\\x9c\xb7\x13q\x7fq\xc0\xfbXHY\xc4\xa4\xaf\x9e\xe1\x94\x07\xd3\x86\xa6\xaf\x0eF:Z\x8d\x8bs}q\xde\xd6U\x8e\xda\xaf\xa5k\xc7y\x1b\xac\x85L\xd4:\xba\xfbc\xc5\xcd\xa6u\xf6\xcf\x00PK\x07\x08\x17wy\xeb\x9b\x04\x00\x00:\x0b\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00bootstrap_tab.jsUT\x05\x00\x01\x80Cm8\xa4V\x7fo\xdb6\x10\xfd\xdf\x9f\xe2\xea\x1a\x91\x14(T\x16\x0c\x18\xe0\xc0+\xdc$\xdd\x8c\x05NW\xbb+\x8a,\x1bh\xe9$1\xa5I\x8d<\xd95\x86|\xf7\x81\xb2$\xcb\x8e\x83\xfd\xf2_\x12yw\xef\xee\xdd\xd3\x9d\xa3S\x18\xfd\xc7_\x0fNa\xa15Y2\xbc8#\xbe`\x8f\x16V\x17\xec\x9c}\xeb\xaer\xa2b\x18E\xb4\x16DhX&(/\x17,\xd6\xcb\xa8u\x8a\x1e\xf9\x8a\xdb\xd8\x88\x82XNK\xf9\x9a\xf8\xc2:\xdf\x0e\xca\xbf\xfa9\xdf+]l\x8c\xc8r\x82\x8b\xf3o.`\xbe\xc5\x0fa\xa2b\xd6\x83Sgr+bT\x16\x13(U\x82\x06(G\x18\x17<\xce\xb1\xb9	\xe1\x174Vh\x05\x17\xec\x1c|g\xd0\xaf\xaf\xfa\xc1\xa5\x0b\xb1\xd1%,\xf9\x06\x94&(-\x02\xe5\xc2B*$\x02~\x8d\xb1 \x10\nb\xbd,\xa4\xe0*FX\x0b\xca+\x9c:\x8a\xcb\x04>\xd71\xf4\x82\xb8P\xc0!\xd6\xc5\x06t\xda5\x04Nu\xd25\x9f\xeb\xf5\x9a\xf1*Y\xa6M\x16\xc9\xad\x99\x8dn'W7\xd3\xd9\xcd\xd9\x05;\xaf\x1d>*\x89\xd6\x82\xc1?Ja0\x81\xc5\x06xQH\x11\xf3\x85D\x90|\x0d\xda\x00\xcf\x0cb\x02\xa4]\xc2k#H\xa8,\x04\xabSZs\x83.L\",\x19\xb1(i\x8f\xaf&=a\xf7\x0c\xb4\x02\xae\xa0?\x9e\xc1d\xd6\x87\xb7\xe3\xd9d\x16\xba \x9f&\xf3\x1f\xef>\xce\xe1\xd3\xf8\xc3\x87\xf1t>\xb9\x99\xc1\xdd\x07\xb8\xba\x9b^O\xe6\x93\xbb\xe9\x0c\xee\xde\xc1x\xfa\x19~\x9aL\xafC@A9\x1a\xc0\xaf\x85q\x15h\x03\xc21\x89IE\xdb\x0cq/\x85To[h\x0b\x8cE*b\x90\\e%\xcf\x102\xbdB\xa3\x84\xca\xa0@\xb3\x14\xd6u\xd4\x02W\x89\x0b#\xc5R\x10\xa7\xeah\xa7\x83:(\xfb?*\x84\xd3\xa8\xd7\xeb\xbdJK\x15\xbb\xf0\xe0\x0f\x02\xf8\xb3\xd7\x03\xe8;\xa58\xb2b\xea_B\x14\xc1\xa3\xcd\x85\"\xb8\xfc\xfd\xb2\xd7\xebAt\n\xf3\xf1[\xb8\xba\x1d\xcffp}\xf3n2\xad\xc8\xe9\xc1\x0b\xb9T8\x00+n`\xce\x170\x82\x1d\"\xa0\xc4%*\x02\x87\x0c\x00\x95>Ys8\x82\x81_?\x07=\x80'\x17e\xce\x17\xac0\x9a4m\n\x84\xd16a\x80X+K\xa6\x8cI\x9b\xa1\xb3q\xa6!\xd8\\\xaf\x87\x1d\xb8\x06e\x9b\xcc\xc0\x81\xc1h\x0f\xb3\xbe\x06\x08aPJ\x97Au\x1bKm\xd1\x92\xef\x95r\xa84\xf9,1\xbaH\xf4Z\x9d-Q\x95\x81\x17t\xfc,Jty\xb4\xce\x9c\xc8\xf8^\xc2\x89\x9f\x117\x19\xd2\x9eyap%ti;G\x83\xadY\xe7\x04{\xf5\x8bH\xc1\x7f\xd5 \xec\xca\x81\x97Ps\x83\xa9\x17\x1c\xb3j\x1dNN\xdagf\xb0\x90<F?b\xa7\xfe\x9b\xd1\xeb\xfb\xdf~\xb5\x0f\xa7\x83 \n\xc1\xf3\x02\x88\"'\x8a\xa2R\xb2\xc0\xef\xea\x94\x9e\xba\xb9\xd5\xe0\x057\xa8\xc8\xf7\xa4\xf0\x02\x96s{%\xb9\xb5\xbe\xc7c\x12+\xf4\x02\x08\xc0 \x95F5\xae\x0d	.\xfbR\xb2T\xa8\xc4\xf7\xd8\xd6\x1c\xb8\x170\xc9-\xf9\xc1\xfd\xf9C\xe3\xe1z?`7\xab\n\xc6\xf5\xd9\x0b;l\x18\x94\x9c0\x99W<\x0e\x0f9~\n\x9a(\xdbl\xc9\x88,C\xe3c{\xeehF&\xec5\xa6\xbc\x94\xf4\xde\xa0\x03\xc2\xc4\x0f\x0e3\xaf{\xe5\xb2\xf1\x1b\x1a\xdb0U\xf4\xaa\nN\xe8?\xa7\xa6\x12Y\xf0\x82q\x95{+\x86\xc6/\x08\x8f\xea\xf9\xb0\x94\x1d\x15\x00\xeeK\x19BE\x92\xf2\xda\xf3\xf0oH\xaah\xaa;\xbc}\xa8\x1a\x1dBS\xcf\xf0\xc8w\x1c\xba\x0f\xd1m	4!\xc4\\\xca\x05\x8f\xbf\xec\xb2t#`Pwu\xb43\xad\xfb\xfd=\xd4\x1d\xdf\xfb>\xc8peE5\xa0Fm\xc8\xf6\xde\xfdNN`\xc0lY\x14\xda\x10\xdb\x99?\xb3\xd9\x06\xef\xc81\xe5\x89\xc3\xaa\x0d\xdbj\x14~\xa5\xce\xa8\x80&\xe5N@fp\xa9Wx \xeb\xaeA[\xd2\xde\xa4\x80c5\xbe\x18\xae\xb5\xa8\x87 \xe3I\xf2\xa2\x8d\x93\xec\xae\xf8n\xfa\xad\xff\xfd\xf9\x03\xd3ij\x91>\x89\x84r7\xd9\x0d\xa6R\xaf\xab/\xfa(s\xcf\x91\x85\xea\xb4\xe7	PZ<\x86\xb5_R\xcd4\xc0\xc1\xc8\xa8\x87F\x83Rk\xdc\xdb'\xad\x9a\x17\xc7 \xda\xa9,E\xeb\xe1\x05\xc7X\x028\x98U\xd0J\xc9I\xa3y\xf6\x83\xc3\x99\xb6#\x05\xde\x1c\xea\x81i\x85\xfe1\xe51TIX\xc9(\x80a\xeb\xe5\xde\xfd\xb6a\xb5\xa6\xf6ij\xb9}\xda\xae\xbbv\xd7\xbe\xbf\xfd\xf8\xc3d\xfaO\x96m\xb3m\x07,U\x8c\x0e\xd7\xad.\xaa\x87F\x1d\xdb!\\/@\x1e\xe7\xfe\xce\xf4\xf8\xaa\x1c\xf8\xeea\xd7\xc8\x10\xdcZk7\x9d{\xf1=\xe2\x8b\x96r\xa7\xcaW\xee8xf\x12\x82_;+\\\xbb\x9d\xbd\x8d\x1dt]\xdd\xe8\xd2i\x93\xf6h\x04\x9e\xdb@*\xf3\x82\n\xf8~{\xf1P\xf7\xed\xa9\xfd\x97\xd0T\xcf\xaev\xff\x0b`\xe4@:\x7f`\xae\xc7\xf3\xf1\xd9\xf8\xfd\xe4\x19\x97\x0d\x85G\xe8\x18\xf8\xdeB'\x1b/`Z\xf9^,E\xfc\xc5\xb1\\\x95u\xc6\x0b\xe1\x85\xe0\xddW/\xa4\xb3L\xe2\xa8O|\xd1\x7f\x08a\xff\xb0\x10R\xf6\x1f\xbc\xee,\xc7\x1d\xe3\xc8\xdc\xc2BE\xf5\xfaieY\xd3\xef\x10\xeb\xa5\xd7-<\xe8\xf5\x9e\xfc\xb5P\x89^\xb3\xc7\x9fK4\x9b\xe0\xf2\xaf\x01\x00PK\x07\x08\xc6\x04\x7f]A\x05\x00\x008\x0d\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x14\x00	\x00bootstrap_tooltip.jsUT\x05\x00\x01\x80Cm8\xbcYos\xdb6\xd2\x7f\xafO\xb1\xf1\xe3)I\x97\xa6\\?wo\x94(\x19\xd7M/\xba\xf3\xd9m\xad\\\xa6\xe3\xba\x1d\x98\x84$\xa4\x14\xc0\x03\x96\x965\x89\xbf\xfb\xcd\x82\x00	\xea\x8f\x93\xdc]O/\x12	X\xfc\xf0\xc3\xeebw\xb1\x1e\x1e\xc1\xf8\xdf\xff\x0c\xe0\x08\xee\x94B\x83\x9aU\xc7\xa8T\x89\xa2\xca\xde\x1b\xb8?\xcdN\xb2?\xd1\xf4\x02\xb1\x1a\x0d\x87\xb8\x12\x88\\gs\x81\x8b\xfa.\xcb\xd5r\xd8.\x1c\xbeg\xf7\xcc\xe4ZT\x98-pY\xfe\x9f\x032\xb4~\"M%4/\xe0n\x0d\xb8\xe0\xa0\xb4\x98\x0b\xc9Jx\xffc\xcd\xf5:CQ\x995M\xfe\x95\x19%\xe1{\xcd\x96\x9c\xd6\x05,\xbf\xf4C\xcb\xcfU\xb5\xd6b\xbe@8=\xf9\xe6\x14\xa6\x0d\xfd\x14&2\xcf\x06pD\"\x17\"\xe7\xd2\xf0\x02jYpm\xc9\x9dU,_p?\x93\xc2?\xb86BI8\xcdN &\x81\x037u\x90<'\x88\xb5\xaaa\xc9\xd6 \x15Bm8\xe0B\x18\x98\x89\x92\x03\x7f\xc8y\x85 $\xe4jY\x95\x82\xc9\x9c\xc3J\xe0\xc2\xee\xe3P\x88	\xfc\xec0\xd4\x1d2!\x81A\xae\xaa5\xa8Y(\x08\x0c\x1dig\x8e\xd5j\x951K6Sz>,\x1b13\xbc\x98\x9c\xbf\xbe\xbc~}|\x9a\x9d\xb8\x05oe\xc9\x8d\x01\xcd\xffY{3\xb0\xaa*E\xce\xeeJ\x0e%[\x81\xd2\xc0\xe6\x9a\xf3\x02P\x11\xe1\x95\x16(\xe4<\x05\xa3f\xb8b\xda\x9a\xa3\x10\x06\xb5\xb8\xab\xb1\xa7/OO\x98\x9e\x80\x92\xc0$\x1c\x9c]\xc3\xe4\xfa\x00\xbe=\xbb\x9e\\\xa7\x04\xf2n2}s\xf5v\n\xef\xce~\xfa\xe9\xecr:y}\x0dW?\xc1\xf9\xd5\xe5w\x93\xe9\xe4\xea\xf2\x1a\xae\xbe\x87\xb3\xcb\x9f\xe1o\x93\xcb\xefR\xe0\x02\x17\\\x03\x7f\xa84\x9d@i\x10\xa4I^X\xb5]s\xde\xa30S\x8d	M\xc5s1\x139\x94L\xcek6\xe70W\xf7\\K!\xe7Pq\xbd\x14\x86,j\x80\xc9\x82`J\xb1\x14\xc8\xd0\x0eu~\xe0@\xb3\xff\xcc\x11\xe1h8\x18\x0c\x9e\xcdj\x99\xd3\x06\x10\x1f&\xf0a0\x008 _!u\xe5x\xf0\x1c\x86Cxo\x16B\"<\xff\xed\xf9`0\x80\xe1\x11L\xaf\xae.\xa6\x93\x1f\xe0\x87\xb7\xdf^L\xce\xe1\xfc\xe2\xec\xfa\x1a\xbe{\xfd\xfd\xe4\xd2jj\x00\x9f&fw\x07\xb8g\x1a\xa6\xcd\xc5\x861t\\x\xc9\x97\\b\n\xaa\"r\x86\xa8\x01\x80u\xe1LH\x81q\xe4\xaeq\x94\xc2\x96\xf0\x00\xe0\x91\xd0\x1drVi\x85\n\xd7\x15\x87qsD\x80\\I\x83\xba\xceQ\xe9\x91\x97\xa3%)\x10\xfa(\xa0B\xebR\xd8G\xa89\x02\xbf\xe7\x12'\xd2\"\xd3'mF\xaej\x1c\xb81K\xdcQ\xa0\xff\xc2\xe1Cw\x00\x18\xc3\xa1?y\x12\n8%\xc0\xb8\xf99\xe7x\xd5\x8c\xc4^=\xa14\x97ty\n\x92\xd65\xf7\x04\xc4\x8cbD\x07\x96\xa1\x16\xf39\xd7\xf0l\x0c\xd1\x92\xc9\x9a\x95\x91\xd72}\xdc\x91\xc0o\xba\xb9l<\x86hA\xbe\x1b\xc1+\x88\x96\xaa6\x9cK\xe4:\x82\x11D3\x95\xd7&\xeac]\xd5\xf8\x05X%g\xf7\xdcb\xdd\x95\xb5\xee\xa0z\n\xcb\x94\x8c\x1d\xcf\xb4\x8flx\xc9\xc9\xb6)\x1c\x92\xf5\x1f\xd6\xcd\xd9-\xc3F4I>\x81yU\xe3\xe7\x81Z\xaa\x1b\xa0\x8f^\xed;\x01\xe0\x95\x9b\x05g\x93\xdf\x9c\x04y@\xc6\x1f\x90\xcb\"\xfe\xf0\xd8\xdf>\x85\x0f\xe0\x94?j-\x96\x82?\xe9\x08\xa2\x08\x1e\x93\x04F-\xb6\xdd{&\x1e\xa6\x02K\x1e7\xe7\xb5\xc4R\xe8\\(tu\xc7\xa2s\x83=\xb4\x0e\xb3\x99\xbci=\xfa6+\xf8\x8c\xd5%\x9a\xf6\xba\xa6\x1b:-\x18\xb28IB_t\x92Y\xc1K\xb6\x86\xaf\xbe\xb2\xb7B\xcd\xa0?N\x9e!\xeb\xe5\x1d\xd7=\xe7\xdc\x10\nf\x00\xccB\xadF}\x89v6\x85\x85(\xf8\xbe\xd9\xc7M\xe3i\x8e\xb5\x96^:\xd4\x9fu\xa4Pu\xbc\xa3G1\xcd\xf0rF\xc6\x8cy\x96\xd7Zs\x89S\xa6\xe7\x1c\x93@m}\xd3'\x8d\x92\xda\xe9\x9e\xb2\x9e\x11^\xeb\xdc\xf6L\xf0\xf1#\xec\x18\xce\xe8\xf8\x89gn\xe7i$n\xe1\xf2\x923=\x15K\xaejt\xbb5?\xfc}\xb0k\xec\xcd\xbeF\x86\x14\xaf\"!\xfd\x05\x0c\x17\xc0\x18\x0cG\x0f\xe5U\x11\x87v\"\xee[x\x0d`\xd2#\xe7\x14\x9f\xc2\xf6A-\xff\x9e\xf3\xda\x0b\xf7\xbfS~OI\x9f\xd6\x1f-\xf9\x02{\x91C\xf6\xedE#\x9d\xbdv\x98C\xd5\xf8_\xb6\x07!&\xbd\xdd\x9f2\x08\x89\xf4\x0cB\x16\n\xed\xd1\xbf\x0b\x87(*\x87G\xc2B\x1aQ\xf8\xfcG\x03\x952\xc1/\x96c\xcd\xcaw\xa2\xc0\xc5\xd6\xe8\x1bN5s0\\\x95,\xb7\x11&\x18\xc3j+\xe5-\x989W\x12\xb9\xc48\xb1\xa1&H\x93\xa1\xbb\x12S\x9f\xa3PTq\xd2\x0f\xa5\x86c\x0b\xe3\xf7\xd8\x91X\x99\x14K[\xb3\x85\xd0\x0dx\xc6\x8a\xe2\xbcd\xc6\xc4\xd1\x8c\x15<\xea6h\x13\x06t\x87\"*MP\xece\x91`~\x0c\x91\xd7z\x14$\x15\xd8\xb3 \xcbYYZ\x7fN-\x9d\x9b\x93\xdb\x8dH}sr\x1bf\x90}@\x1d\xd9\xc6\x9a0\x86\xa1\x90\xc3\x0c\xb9\xc1\xb8\xdd.PR\xcf\x07\x002\xcd\x97\xea\xde\xe7\xa4\xe6\x93\xe5\xc6\xc4\x1f\x00U5\x82\x93\x14J>C\xfb\xa5\x10\xa6*\xd9\xdaV\x02*\xff\x9d\x92\\\x0b\x0b\x90\xb1\xaa\xe2\xb2\x98\xaa\xd81y\xd5?\x10\x8c\xa0PyM\xea\xcc\xeeT\xb1\x0e8U*\xac\xa8~PF\xd0)\x1dN \x17x$\x85\xf4Fo\x99\x9a\xcd\x0c\xc7\xbe\x9f\x86^\xba%\xea\x9c\xb7\x156+\x81\xf9\x02:\xde\x9d\x99LUR\x85\x0bQr\xf3\xcd-\x8c\xba\x99\xbeG\xe5\xccp\x88\xee\x14\xa2ZF\xa1\xd1\x00\x90\xfc\xf8\x83\xd5e\xa5L\x86\xaa\x82\xaf\xed\xb7\x85e\xe1\xd5K#\xa4h7\xb9\xa2\xd3\xc0\x10N\xe1\xb8w\xea!\x9c\xfa\xdc\xd8|\xee4g\xbf\x07#\x0d\x13T\xd5\xa7ix\xe47\x7f \x11:\xd2\x97)\xa4w\xe87\xed\xd0\x16\xbd\x1e\x9d\xcf\xd1\x89}\xe5\xff1\\\x02\x9b=\xc5\xe4q\xff-\xa4\x1b\x87U\xff:\xf9\x00\xd5\xf9\xdc\xcei\x9b\xc2\xdd\xccc\x98\x0b\x84y3\xfd\xfbE\x97\x0db\xe4\x0f\x81\xdf\x0e\x87@M\x18\xfb\xbe\x94s(8r\x1b\xbe\xa0Ts\x91\x03+XEo\xf4\x99VK\xd7\x83q\x9b\xb8\x0c\xe9\x03\"\x7f@\xfbrip|:\x04\xaa\x8ab;\x9b\xe5\x0b\xa6\xcf0>I\xe8\x8d\x0c\x07/\x0eZ\x19\xb09 \x90i~\x94\\\xceq\x01\xc7\xf0\x0d\xb85/w\xadqb/\xc7\xf0\xff\xedlB\xfb\x0e\x7f\x8d_\x8dn~}q{\xf4\xe2\xe6\x97\xd5/\xefn\xbf~y\xf3\xeb\xcb\xdb\xa3\xc3d\x98\xf1\x07\x9e7\x9a\xe8\xe5\xcd6\xa1<\x9d=w\xe7\xa4\x14\x90\n\xfb \x86\xf9B\xdf\xf1\xa2\xf8\x93\xcd\x84,\xe2(s\xaf\xe5c!%\xd5\xd2M\x19\xda\xd8*\xb60	=\xe3\xc84\xf6\xd1ET\xa3[7\x13\xc25\x81;\xc8a\xd4\x93!\x0fn\xc2\x90\xbd/\xd08}\xef\xa8T3\xec?$.\x98\x7f\x1c\xba\xcdh\xcd\xf6\xd1\xf72\xb1\xde\xe8f\xdbM\x1a\x89w\x02\x17g>%\x07\xfb\xba\x9d\x9f\xaa\x9d\xa0'\xee\xf6U\xb3Y|\x98\x99\xba\xaa\x94\xc6\x0c5\x93M\xe2\xc8\xb8,\x12\xc7*\xb0\xd2c\n\x7f>9	\xd2	\x9d*S\x92\xef\x05Iw\xaai\xbbv\xef\x97\x9d-\xbfm\x06\xc9`#\x12\xec\xda\xb9\xad\x8b,?\xaa\x98:\x1bGIP\\\xec\xd6j\x17\xe1\xb6I8o\xf7/\xd1'|\xbduf\xff\x1aw\xa8TS\x1f\xf2\x8c!\xea8\xb2N\x19\xd9+\xd7D\x83n\x8a\x9eP\xc7\xbe\x87{\xec\x04\x930P\x84\n}rY\xdaM\x07\x1bF\x917\xf1Y8\xb5+\x10vE\xe7\xee\x03\xfb\x80\xb6qw\x03\x85\x05UI\x08\xe1\n\x94M\xa0^\xe3\xa0\xab*>l\x14T\x8f0\xeaWH\xae\x92\x89\x93$\x0dtc\xd3\xca\x86\xe4\xee\xb2'\x85\xa6\xa6\xd8+\xdc\xab\xda\x1f{.\xe1c\xd6n\x0d\xd1C\xda\xea\xbee\x95\xeew\x11\x82S0\xee\x95\xca\xfe\xd2\xf98\xf9\xb4\x9f8\xe1&\x87\xb8<\xa32\xb7\xb6_i\xfb\xf1\xa6\xa0>\xe4M\xd9\x0c~8\x19l\xd8\xb8=\x84\xbb\n(\xaaO;E\x18\xfe\xec\xf7\x8f\x1f\xe1p\xa3\x87\xc7\x97U\xc9\xb0\xff\x1a\xbbg\xa5(\x18\xeeQ*]\xa5g[\x96\xaa\x18\xf5(.U\xe8W\xae\xf8w\xcfQ\xaf\x9c\xdeR\x18\x83\xac\xcb\xb2?\xe9\xde)\xfd\xb9^\x8d\xd0t(w\xf3\xdb\xd5\xc2\x0c\x96\x16\xc2|\xf6\xda\x19+Mo1\xaa\xf9\xbc\xe4\xaf\x1b\xf0\xcf\xda\xfeY\x08\xb9\x0d\xb5\x1f\xc3\xf5y(a\x07\xc1\x94\xd2\x94\xcd\xb3\xa2h\x9a\x9b\xf4r\x8en\xc38\xf9\xb8\xd9c\xbfx\xfb\x97\xc9\xe5gw\xd7]_\x9d:t\x19\xeeh\xac\xbbf\x16x3\x87Q\x88\xb3|\x11\xef\xd2+]\xc4C:\x10=j\xac\x07v\xfe\x90\x02]&\x9a\xa0\xf1\xa6\x8f\xd2\xf6\xe6C\xb1\xce-\xfc\xdd\xb2\x03\xf6\x11\xab\xee\xde\xf3\x1c#\xcaA\xcd\xa8[g\x9d\x95 \x93\x9d\xf0)\xc4ns\xc9W\xbe\x8b\xef\xde\xb7n\xbb\xa4\xed\xf3\x12\xd6\xf6\xcemZ \xa0\x9bfQk\x8f\xf6\x0f	\xa1:\xb3\xf3\xeeO\x070\xf6\xbbnI\xf9\x9eh\xdb\x9dl\xdb\x02#\xef\xd4A\xffb\xd4\xbc\x9e\xac\x8bw\x1d]\xef\xc0)\xf8\x8b>\x82\xe8E!\xee!\xa7\xe4<>p\x94\x0e^\xee\x18<fZ\xab\xd5\xc1\xcb\x17\xc3B\xdc\xef\x14\xb0\xb5`+`\xffm\x18tmf\xdb\x07t\x83\x14\xc4\xa8\xcbl\x7f\xd9\x1e\xe4\x08N\x1a\x0d=\xc6+!\x0b\xb5\xca\xde\xffXs\xbdN\x9e\xffk\x00PK\x07\x08@(\xb2\xeew	\x00\x00\xf9\x1d\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\n\x00	\x00dj_mon.cssUT\x05\x00\x01\x80Cm8|\x91\xddn\xdb0\x0c\x85\xef\xfd\x14\x04\x82\xa1@19N\xb1\x01\xa9\x8c=\xcb Y\x8c\xc3T!5\x89\x8d\xdd\x0d}\xf7\xc1\x9aWt\xcb\x96\x0b\x13\x06\x7f>\x91\xe7l\xef\xbf@\xc6o\xcf\x94\x11\xee\xc2\xe9\xebYx\xebE\xb4hv\xe9\x0e\xee\xb7M\xe3%\xbc\xc0\x8f\x06 \xb9\x10\x88G\x0b\x8f]\x9a\xfb\xe6\xb5i\xdaAX\x1d1\xe6\xda0Q\xd0\xa3\x85\xc7\xfd[\x9d\xdd\xc5\xbb\x0c\xadW\xde\x14T%\x1eKm=\xbb<\x12[\xd8\xa7\x19>\xff\xfa\xfa\xf7O\xec\xd2\x0c\xbbn	+J\x9d\x8f\xb89\x89/\xa6\xfe\x82\x86\x8fp\x9d<V\xba\xe2\xac\xc6E\x1a\xd9\xc2\x80\xac\x98\xff\xc7h\x83S\xfc'\xa8V\xaeh\x11\x0fz\x93U'\x0e\xc2j\n}G\x0b\xfb\xee\xc3*U\xdd\x03\xc3\xad\x05\x07	\xd8\xfa(\xc3S\xed\nTRt/\x16jj\xd1g\x92\x1c\xcc\x94]\xb2\xe03\xba'\xb3$*\x7f\x13Nf\x90g\xd6b.\x84S\x9dORHI\xd8B\xc6\xe8\x94.\xb80T\x92\x85\xdd\xc3\xa2\xeb\x9be\x9f\xba\xdf\x96\xfd\xcdi\xbd\x0b\xe3zU\x14\xa7\x162\x8dG\xed\xdfy\xd8\xc1\xc3:|\x90|n\x97`\x88#1\xfey\x05q$\xc6\xbey\xfd9\x00PK\x07\x08\xff9v\x85:\x01\x00\x00u\x02\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00	\x00	\x00dj_mon.jsUT\x05\x00\x01\x80Cm8\xacWOk\x1bG\x14\xbf\xebS<\xab\xc2\xb3K\xe4\x95[\xe8\xc5\xce\x06J\x9aKH\x93\x83\xddS\x08f\xb4\xf3$\x8d\xbb;\xb3\x99\x99\x95c\x1cA\x02\x85\\\x9a\xa6-\xa4\x7f\xa1\xe4\xd2\x1e\xdb\\\x0b.\xfd2\xb1\x9b|\x8b23\xfbO+\xd9I\xa0\x0b\x96V\xbb\xef\xff\xfc~\xef=\x8fF1(\xbc_p\x85\xc0\x0e\x0f2)Fc)\x8d6\x8a\xe6\x07F\xca\xd4\xf0\xbcw\xb9\x10\x1d_.\x90\xcb\\\xceQ].\x94IF\xd3u\"Y\xa1\x0dMf\xd8\xeb\x0d\x82I!\x12\xc3\xa5\x08\xc2\x93^\x0f`\x10\x10z\x97QC\xb7\x8c\x9cNS\x8c\xfb\x86\x8e\xfb\xf7H\x18\x8d\xb9`\x01\xd13y$\xc8\x10j5\x0c\xe1\xa4\x07\x000\xa7\n\x92B)\x14f\x9f\x8e!\x06\x8c\x0cUS4\xbb\xf5kC\xc7\xd7\xa50(\x0c\xc40\x08\x06A#\x1fF\xd4\x18\x15\x90\x99\xc2		\xc3F\xc7\xc6\xf2\xb9J!niG\xf6a@\n\x95\x92p\xd7F\x0d0\x88\xa6hn\xee\xdd\xb9\x1d\x94\na\xa4\x8b$A\xad\x9b\x0c\xed\x9b\xd0\x07\x0b\xc0'\x10\xb4,z\xef\x9c\x91\x10\xe28\x06B\x0b\xc6\x0d\xa9r\xb3\xd7 B\x9a\xcc\x9c\x11x\xf8\x10\xee\xdek\x15\x81\x0fAa\"\x15k+x\x1f\xfey4\xc6\x89T\x08\x1bq\x0c\x85`8\xe1\x02Y\x08K/\x0f\x0c>\xb0\x85\xb1YD\xda(.\xa6|r\xbcl \xdc]o\x9eN\x0c\xaa\x0b\xac\xbbw\x97\x1bw\"-\xdb\x8b\xfa~Q~\xdb\xa30\x98\xe5)5\xe8\x0e\x8f|@\xe0\xcaR	me\x02R	\x91\xd0V\x89\xb0\xc3\x03\x85\xb9TF\x1f4o\xc2hf\xb24\xa8\x9d\xf0I\xb0\xb1\xe1N\x1a67\xddw\x94\xa2\x98\x9a\x19\\\x83\xed\xb0\x14\xf2\x10\x92\x85\xc9\x0b[\xa5\xcfJ\x0cG\n\x05C\x15T\xd6\x87N\xbf6\x8d\xa9\xc6\xf5\x06\xfaW\x19\x9fC\x92R\xadcBST\x06\x12\x14\x06\x152r\xad\xbf67\xccrs\\&v[\xc2M9\xd6$\x84+\xd0\xbf:b|~\xad_9m\x15\xc5%\xea\x83\xb6P\xed\xadJL\x1c\xaf&Re\xc4bv\x9cq\xb3D\xca*x\x8bqzH\x1f\x04\xedGP\xa8t\x07\x06\x81\x99q]Q\x88:b\x92p\xd8\x963\xc79\xee\x90\\jC\x86\xcdS\x18\x8d\xce\x9f\xbf<\x7f\xfa\xc7\xd9\xb3o\xdf<z|\xfe\xfd_g\xa7\xcf\xdaj6\xef}\xa7z\xa8\xa5\xa8TG\xa3\xf3\xaf\x7f;{\xf6\x83\xd7=\x7fq\xbaFk\x07N\x16mOV\xeb\xf5\xef\x8f_\x9d\xbex\xf3\xe8\xbb\x7f\x7f\xfe\xd2\xeb\xb6}%2\xcbS4\xb8Sg\xafP\xe75a\x1b\x1c\xe6T\xd1LC\x0c')\xce1\xdd\x81~I\xf5\xfe\xb0\xf2m5#\xfb!\x85\xc6}|`*\x1c\xb7\x99\xa3\xf3H\x1bj\n\x0d\x1b1|\xb4\xbd\xbdL^{yO\x91s\x031\xf4\x8f\xa8\x12\\L\xfbK\xc6\x16\x0ed+\xba\n'\n\xf5\xec\x93\xc4\xf09\xee\xd3q\x03\xf7\x92c\xbd\x95\xc4:\x04\xb3c\x01\xb5\xa6Slq\xa7C\x9d\xf7b\x86O\xa7\x13\x87\xa52;\xdc*=m\xcd9\x1e\x91\xb0\x8b\xdbF\xdc\x8d\x08?!\x18\xd7\x19\xd7:\xee;\xf6\xb8!\x91\xf29\x06$Iy\xf2E{Ht\x0e\xd1\xd9\x88\x9c\x96u\xc5\x19\x06a\xa40\x93s\\\xa9R\xd5\xe0\xcbk\x01\xa3\xd1\xd9/\xbf\xbe:}q\xf6\xe4\xef\xf3\xe7/\x83\xd7\xff\xfc\xf4\xe6\xc9W\xe7?\xfe\xe9\x7f\x9f}\xf3\xb4i\x18\xad>\xe6\x0e\xc4\x14J\xc0\x846-\xa1z_zY\x84\xe5\x08\x8c\x04\x9d\xdb\xbf-C\xc7\x1aR\x1eYN\xcd\x11.\x18\x8dF\xf1\xe9\x14U5\x1d\xbd17I\x15\xa6q9\xab\x9b\xf2d\xb2\xd0\xe8Z\xcd\x9a\x1aU\\.\xb5\xbcMk\xb2\xaeEm\xd8\xcd\xf7\xb7W}\xa5u/\xb7\x8br\xe2.\xe1\xea\x1d;\xed	$\xbe\xf77-\xc8\x02# \xe5c\x12\xd6\x15\x1eT`\x8ah\x9e\xa3`\xfb2\x18\x04d,\xd91	\xc3\xc8n\x15A'\xc7\x0e\xc6\\\xb2\xef\x80\xb1A@\"'\xbb\x1eY\xa5\xfd\xaa\xc5\x80\x9f\x1e\xd7e!\x8cv\xb3=\x84\x0b\xaa\xe6\xf8\x988\xc1\x8b\xe8\xf8\xfe\x03\xaa$\x9f7\xbb\x9e{\x00\x8bN\xc4\xae\xaf\xb8\x90\x83*\xda\xd6\xfaS\x07\xd9\x1a\xbd\xc5\xdb\xf7\xa1\xd5BTD\xd4h\xf6y\x86\xb20A\xd9\xd3\x9c\xd4\x10>\xde\xde\xde.\xa5\x16M\xa0\xa3\x11(L%e`f\x08%q\x0c\x1d\x035\x90Im@\x8a\x04\x81\x82\xc6D\n\x06G3\x9e\xa2\x13\xc59\n\xa3\x81*\xc5\xe7\x18\xf5\xfc\xbc/=\xda\x00\x14\xc4 \x8a4\xdd]S\x8dV\x97-+\xe2[|\xa3\\=\xaf\xfa@\x19\xb7\xfb\xec8i%\\\x8f\xa2\xb6\xfa\xda\x88\x00\xfe\x9f\xcea\xed,\x86\xf0aU[w\xf86\x99#.\x98<\x8an\xd8*\xed\xc9B%\x08\x9b\x9bn\xae\xcb\x89]\xec}\xf9\xecQ\xbb=\x90\xd4\x8b`\xbd\xc5Zxj\xaf\x19\x83\xc0#h\xd9\n\x96,\x94\xa7\xea\x85#\xca\x98\x93\xbc\xc5\xb5Aa\xa3\xf5xmw\xaf\xfa\xdf\x80\x0e\x92\xdc2\x9bS\xa51@\xd7\x1c\xaa\xdd\xben\x0c~\xad\xbeKP\xdc/\xb0@F\x86@\xb4\xa1\xca\x94\xb7v\xb4#\xf3?&\x94\xa7\xfeN\xa1Q\xdc\xdf2\xb4[\x83\xbb-rF\xad^g7\x174k\xc5wQVVj\xb8\x02\xa8N\xb8\xa5\xb2\x14\xa8\x94\xb4\xe7\xbf\x06!\xf6\xb4J9\x85\x94\x1d\xef\x19\xd7C\xe2\xb8]\xf0\xe8\xfa\xad;{7>m\xc2\x82\x0e\xb3+Py\x88.v{\x9dMcUz\xd1\xeb-\xc2\xff\x06\x00PK\x07\x08S\xe6\xdb\x9er\x05\x00\x00}\x0e\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\n\x00	\x00index.htmlUT\x05\x00\x01\x80Cm8\xc4\x1a\xed\x8e\xdb\xb8\xf1\xbf\x9f\x82\xa7\xa0\xe7\x168\xad6Mz=\xecJ\x02\xf6\x92; i\xaf\xb7\x97\xa4\x05\xeeO\x0dJ\xa4mz)R!)g\x0dA\xcf\xd1\x07\xea\x8b\x15\xfc\x90L\xc9\xb2\xd7^;\xa8~\xd8\x14g8\xdf\x1c\x0e)\xc6\xdf\xbc\xfd\xf5\xcd\xa7\xdf\xef\x7f\x02KU\xd0t\x12\xdb\xbfI\xbc\xc4\x10\x01\n\xd9\"\x99b6M'\x00\x00\x10S\xc2\x1e\xc0R\xe0y\x12\xa0\xd5\xac\xe0\xec*\x972\x00\x05F\x04&\x81\xcc\x05\xc6\xec;P\n\xbe\xc2\xb9\"\x9c\x05@`\x9a\x04Rm(\x96K\x8cU\x00\xd4\xa6\xc4I\xa0\xf0\xa3\x8a\xcc\xd8h\x97t\xc6\xb9\x92J\xc0\xf2\"\xd4-y\x99\x0bR* E\x9e\x04\xab\xcf\x15\x16\x9b\xab\x82\xb0\xab\x95\xecI\xb4\x82kh1\x834\x8el+\xdd%\xe0t\x7f\xde\xe0N\xbb\x99\xe2\x9c*R\x9eO\x07fg\xd3(y\xc9\xd7X\x9cM\xa7\xe0\x08\xd2gR)*\xa9`\xbe\xc4\xc7\x0d\x8f#\x1d\xa2\xe9d\x12g\x1cm\x9c\xa1u\x17\x16\xf6E?1\"k\x90S(e2ep\x9dA\x01\xec_8'\x8f\x18\x85\x8a\x97.\xb6\xf7\x8f\x08	cX\x0c\xd0\x86\xc4s\xce\x14$\xe3xC\xdc\xb2\xa24\xa4x\xaeFh\xb6O\xfcM\x18\x82\x18\xba\x19\xb1T\xaa\xbc\x89\xa2\x05Q\xcb*\xbb\xcay\x11\x89J\x0b\x15\x16\x98D\x08S\xb8\xc1h\xb6\xe2Y\xe0X\x04\x99\x80\x0c\x05\xe9[\x0b\x02\xefy\x16G0\x05a\xb8\x9f\xa3\x87;\x8a\x13G\x88\xac\xc7\x87\xfb63\xca	\xb2X\x1e\xd4\xaeU\xec\x05Z\xcd$V\x8a\xb0\x85\x9c)\\\x94\x14*\xbc\xd5B1\x90)\x16\x96\x82\x14PlL\xbb \x8c\x04\x00A\x05Cms\xccT\x12\xd4\xdf~\xae\xb8\xbaEX*\xc17\xb39$\xd4\xdaCZ\xc0\xcd\x1cR\x89\xbf\xb3/\x92b\\\xce\x8c\xd1\x1c\xf4/\x0eR\xc0\xc7\x19TZ\n\xd5\x0e|\xe9\x81D\xc5f\x8a\x14\xb8\x05\xbd~}}\xed\xc0\x02C4\x83:\xf8\x06$\x0d\x1b_\x12%\xaaV\x10\xcfo\xb35\x16\x92p\xe6\x90\xec\xdf\xab\xab\xeb\xabW\xb6\xd9\x8e09w\x14\xf9\xe5\xd5\xcb\xabk\xdbl\x02@P\x12\xb4fu9\xd8L\xcc \xfd\xe8zu8|}7\xeb\xb8 (\x99\xa2U\x98\xf3\x8a)\x19\xae	\xfe2M\x0f\xc5\xd28h\xa4{\xd0\xe5\xbd\xc6\x91\x9f\x07F\xa7)\xc81SX`\xd4\x13\xe6	T\xadK\x80Va\x81\xa5\x84\x0bl\x94	\x9e\x1c\xef\xcd\x83\xb8\xdc\xb6\x87\xf8\x14C42e\xbci)\xfbc\xb7l\xf5\x13G\x1e\xed\xb8\xa2-Y\x06\xd7:\xe5\x85\nfr@>\xa6\xa4\xc5\x82\xb9\"k<\xc2~;S!\xa5n\xde)\xbeXP\x9c\x04\nfAzG\xe9N,\xc5\x11%}R\xf1\xb0\xa3O\xdb\xce\xd81\xf2?\x1b\xc8\xf9\x1c>W\xb8\x1a\xe7\xf0\x9b\x81\x9c\xcf\xc1\x9ap\x8c\xc3\x9d\x81\\H\x07\xb9W\x07y>\x07X!\xa2FU\xd0\x80'\xe8\xc7QE\xb7\xc4\xfd\xa9\xa4`\xd6&\xeba\x08\x0e\xb0J\xc80p\xc1h\xc5\xa8\x04M\xa6\x90R3\xf9L\xc3\x9fp\x87\xe8\xf8\x04l\x80Y\x1a\xae\xfd\x1c2\xadd\x04u\xed\xe7\x901\x8et\xd2\xb8\xf6\xb3\xc9H\xa7f\xbbx\xead;3D\xb7\x0b\xaaC\xd1\x0b\xdb&\x99\xfe\x83\x83\xdf\xdc\xc8N\x00\xf9,\x01L\xb8\xb8\x8e\x1e\x7f\x03\xd8\xcf\xdeD\x13\xf8\x80s.\x90t\x8e\xd5];B\x0c_]\x15\xaf\xc5F\xab\x99\xc0%\x17\xcaW\xd3l.\xa6fs\xf1\x18.!C\x14gP\xc8N8/\xfab\x053\x8a\xdb\xfcg_\xcco(\x95 e\xeb\x1e\xbdt\xeb\xdcI\xfbc\xf5R\xbf}\xd7\xd4\xbc\xa2S\xbf.m^\x89#\xb5\x1c\x02\xde\xbd\x1d\xeb\xbd\x17\x84\x0b\xa26 \x96\x05\xa4]\xfa.*\xa5\xd7\xa8?\"\x9cS(0\xfaS\x1c\x19x:F\xe3\xce\x15/c\xb0\xbfC\xa9\xc0OBp1\x06\xbd\x17|!\xb0\x1c\x1b\xd9J\x82\x8c\xfd>T\x0c@\xf5$\xda\x1b\x81\xa1\xc2\xe8\x18T\x9b\xe1\xc70#\xdf\xa8q40z\xac\xb6u\xbf}\xea\xfa\xc5U\xd3\xf8\x14\xfa^\xd1\x1d(\xf5g\x15\x85\x19\xa6\xc0\xfc\x86\x84\xcd\xf94\xadk3w\x9a\xc6\x86^\x1c\xa9\x9e\x9f-	oUt\xc9\xd2e\xb7$\x88s\x8e\xba\xa8\xca(\xcf\x1f4\xcd\x12n(\x87HS\xd5\xf0\xd4\xd6dS\xb7\xe9\x9a\x02E\x14\xc5\xc9\xf4\xde\xa2MSP\xd7\x045\x0d\xd0\x19\x17\xec\x91\xa1\xae\xf1|\x8eM\x12\x9a\x95.x\x9afO\xf8\xd4\xf5\x16\xa5\x0b\xa1\xfd\x94\xdb*\xb8i\xf6\xe1l-@\xa1T3\xac\x03\xab\x9b\x88C\xa3\xd4\xf5\x16\xa9i\x9c\xf2\xa6 \xedT\xdf\x86\xa7\xd1\xde#*\xabB\x17\xffOZ\xe3\xc5\x12\xcaY\xe9\xe2\xb8i|7\xb7\xbd\xa0m\xb4s\xbc[j\xcc	E2-\xa0X\x10\x16f\\)^\xdc\\O{\xc1\x92A\xd1!~!H-o@]o\x19\xfe\xe1\xb6M_\xee\xd7\x1a\xb9\x87\xe2\x0d\x98\xb9\"R\xc7D\x8b\x19\xf5U\x18\xf7O+\x8e\x9d=\xa0\xae\xf5\xbe\x04\xaa\xa6\xd16\xc0\x8f%\x11X\x9a\xf78\x13\x91\x93b\x90M\x1c\x96\x0e!\x1f\x7f+\x87\xdf}\xa4\x14\xb9\x9d\xf1G\x0f\xe9A\x81\x96\xdd\xae\xcb\xbd	\xac\x9f\xbav\xfb9\xa8v`\xf1\x9c\x8b\x02\xc0<\xc7\xa5\n\xf3%\x14\x12\xab$\xf8\xe7\xa7\x9f\xc3\x1f\x02\xe3[\xce\x92\xc0\xdbg\xc9\xc8N\xacH`%6\xdd>SS		\xa3\x84a}\x98\xa5\x96\x1c%A\xc9\xa5>\xc8\xd1ad\x9d\x1e\xd8\xe8\xb8\xb9\xbe-!B\x84-n\xaeo\x11\x91%\x85\x9b\x1b7x\xa8\x15\x001ae\xa5\x00\x83\x05N\x82J\xcd\x7fh\x8f\x8c\x96\x04!\xcc\x02\xb0\x86\xb4\xc2I\xf0\xed\x8b\xc7?\xff\xf5\xe5\xab\xdb\xee@l/\x11X\xa9%f\x8a\xe4Dmf\x8a?`\xb6\x87$\xf95{\xa3\xde\xbd\xfe\xfeo\xbfg\xcb\xd5\xbb\xf7o\xee^\x7f\xb9~\xf9\xf3\xbb\x88=\xfc\xeb\xfb\xfb\xdf6\x1f\x1e\xdf?<|\xdc\x14\xe5\xea\x87\xbbD\xb3\x1d,\xb6\x03\x0d\x06[r\x9d-\xbd\xfd\xb8\xd5/\xe7EA\xbaS8Ye\xe6\xcdi\xf8\xc1\x9a|G\xbd8\xd2\xe6O'\x97r-\xc2\x14+|\x8co\x07\x1c\x018\xd1\xd9\x17\xf1\xed Df6\xfc\xf6Pju{\x9a\xceW\x8b\x92]\xa3\x9d\x126\x08\xb2\x05\x16\xa7\x05\xce\xdb}J\xb7\x91\xb3\xed\xd1O]G\xa3\x99d\x98\xc6\xfa\xe5\x85\xce@\x91_=\xc4\xd1\xa0\xbe\x88#S\x06\xfa\x1d\xfe\x19\xefH}\xbaS\x85_\xbe<\xb5,.\\\xa0~TP\x8dV\xae?\xc2\xfc\x81\xf2\xc5\x08\xa8\xbf\x1c\xdc\xc3J\xee+\xfev\x0b\xd7\xffO\x99\xa7\xa7\xdb\x13U^]\xbf(\x8d&M\x13\xcb\x12\xb21r_\xa0`\x84-\xa6\xa9\xc5\x8c#\x8d\xa8\x97\xd0vd]\xff\xfbI\"\xb2\xcas,\xe54\xd5\xa7\xba\x84-v\xa9\x8c\xaf\xa8z\xf5\xcf\xacO\xf6Uj}\xc7\xe8\xfa\xc3\x08s`\x99\xees\x01\xbe\x15\xce^}m\xb8F\xad\xf5#\x81eU<3W_lY\xb2\"\x1c\x9f]Zw\x0e\xf0=G\x9f]\xa5\x0c\xedd\x08_\xd0L.jO\xcb\xc3fV\x9f\x92\x86G\x0d5\x0c\xe4\xaf\x9f\x86\x87\x87\x11\x97\xcf\xc2\x86\xc3\xb3\x92p\xbf\x8c\xfeD\x8a\xd1\xbc{\x97\xab\xf1m\xbb>Y\xe4l\x0c\xf2	\x8a\x05\x1e\xdb|\xa7?\xe29\x17\xe3l\xe6\n\xef\xb2\xf9*\xbb\xf0\xbe\xdeGm\x1f4\x16\xd4\x86\xd0\x89k\xef\xd6\xa6\xae\x05.\xb8\xc23\x88\x90\xd8\xee\xad\xf6\xa4\xba\xa7\x16	\xbb\x85xr\x99P\xc6\xd8\xfb7\xcbu\xfd\"3V\x9f\xe9\xa8k\x9aS\x8f\x0f\xfa\x83\x0f\x1e!X\xefNS\xa0\xbfM\x98\xf3\x83\xba\x8ez\xe3\x0f\x08	u\x00<S\xc6\xde\xd8\x83\"\x9a0\x1bH\xe8\x8f\xde\x11\xf0+\xa7\x88\x91\x03\x8c\xd3\x92\x84\x17D\xe6P\x03,	\xf2\x13A\xff0\xdc\xa0\x84\xfa,k\xf0\xb18\xce*\xa5xWe\xe4\x94\xcb\xf6\xe8\x14\x11Y\x90np+\x9d\xc5\x9f\xa6\xff\xfdO\x1c\xd9v\x8f\xe7\xf2U\xef\xd0o\xf9\xaa\x075\x11=9(\xa3\xae\x7f\xa7\xa9qwZ\xd7.F\xbb\x00\xdc\xa9\xfbw	\xcc9W;_\xc4\xfd\xe0\x1f\xff\xce\x1b\xf4\x95n?]\xbe\xd1\x06\x19|\x83\x18\x08\xb1\xf3\xda\xbb\x85\xd1\x02'\x93.\x004d\x0d\x05@\xab\x99\xfd@9\xf3\xce\x95+AA\x02\x02\x0b\x08\xb6\x98x\x8d\xd9\x16l\xdf\x82\x89\x1ff\x93\xc9\xcef\xc0\x1d\xf7\x9c\xbe\x0eyf\x0d \xc5B\x01\xf3\x1b\xd65\xc5kL\x9b\xc6\xbd\xbb\x18!\x19\xc5\x01\x10\\\x1fX\x18@W;\xb5\xf1e\xd6\xbf\xc0\xbet5\x85\x89\xb6\xa1\xe1\xedx\x00\x05\x81\xa1I\x8cI`\x9c\x10\xa4\xb6\x1e6\x00{\x90\x91\x04\xfa\xcbv\x90~\xab\xbf\x90\xcb[W\xc1\x0e\xe3\xb2\xae\xb5g\x9b\xa6\xef\x0f\xcfn;{(\xe7\x95\xd3\xad\xe6\x17\xec\x19D\x0b\x0c\xcc\xef\xb6`\xef\x0e\x96\x9a\x06\xd8\x06pR\x1f&`\xd7\x06\xe0\x0e\x8a\xf5hS\xad\x9d:Z/-k\xac\xbdg\x1a\xa7\x8e\xa6\xd6\xf1\xd4\x1bw\xc8\x8c;w,\x8e7\xe4\xe1\xecvDf\xbbh^\xd3Y\x0d\xb4\x97\x18\x80\x9f\xd5\\8\xed\x95\xcbf\xb3#J\xbb\x8c\x0b\xa4o\x06\x0c*\xbd\x03\x9f{l!\xe0}\xa9\x07\xee\x8a\xc6\x9e\xaa\xa3\x9fQ\xafF.\x82xY\xf6\xf0Z8V\\\xa5o\xdf\x83_8;Q\x88\xde\xdd\x923\xf9\xdb\x8b8\xed\xb4\xd2[\x9ac-\xb1s\x83\xe7<I>\xea\xcb>\xc0\x18\xf88	\xbc\xdbA\x1dg q\xce\x19\x92\xcf\xf2\xc5/\xf0\x11\xb4\x9fS\x8e\x13\xc1\xbf\x86t\x9e\xf6\x9a\xb7\xa8\x18\xd09\xf9x\xde\xed=\xa7\xcb\xe8\xffA\xdf#5W\xa3\x8e\x93`{\x95\xea<\xdd\xcdl\xd4\x17\xdf\x8e\xb4\xfa\xf6\xa6\xd6\x91|\x07\xe7\x81\xddjv\xb8\x14\xba@\xf9\xe3\xb3\xea\x9a\xdb\xe4\x1fG:\xd3\xa5\x93I\x1c-UA\xd3\xff\x0d\x00PK\x07\x08Hjp\x9f\xac	\x00\x00\xe2+\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00	\x00jquery.min.jsUT\x05\x00\x01\x80Cm8\xc4\xfdy\x9b\xdb6\x9a/\x80\xfe\x7f>\x85\xc4\xce\xd0\x84\x85\xd2\xe2$s\xa6\xa9B\xe9:q\xdcIO\xb6i{z9\x92\x9c\x07$!\x8a*\x8a\x94%\x96\x97\x88\xea\xcf~\x9f\xdf\x0b\x80\x04%\x95\x93\x9e\xe7\x9c{\xff\xb0K\xc4\xbe\xbcx\xf1\xee\x18=\xed\xf76\xff\xf5\xa0\xf6\x1f{\xef&\xc3\xff=|\xd6\xdb\xbc\xc5\xd70.\xb7\xbd\xda~\x94\xfbt\x94g\xb1*\x0e\xaa\xf7t\xf4\xbf\x82\xd5C\x11WYY\x04\x92G\xech\xbfz\xf1\xc7@\xb2\xe3^U\x0f\xfb\xa2\xb7\x1af\x87\xbfeER\xbe\x0f$\x9b\xc9P\x0e\x8b2Q\xaf?\xee\x94\x10\xe2\x8f39L\xd4J>\xe4\xd5_3\xf5\xbe\xae\xe5p'\xf7\xaa\xa8t\x8d\xb0?9\xb5\xad>\xa0\xd5l\x15\xf4\xe3\xcd\\.\xd9\xf1\x9d\xdc\xf7\"\x11\x0f\xa32\xf9\xc8\x13\xb1\n\xbc[o \x07\xde\x9d\xc7\x86r\xb7SE\xf2\xba\x0c\"\xc6\x95H\x86\xf1\xe1\x10xIv\xd8\xe5\xf2\xa3\xc7\xa6\xc9p\xaf\xb6\xe5;\x15\xb0i\xb6\n0\x12\xaf(\x0b\xe5\xd55\xfd\xf6\xd81\xbe\xaf\xeb \xbe\x17\xf10\xde+Y\xa9or\xb5UE\x15x\xd9j/\xb7\xcac<\xbe\x1f\xd2\xcf\xaf\xca}\xa2\xf6\"\xbe\x1f\xbe\xcf\x92j\x8d\x1fk\x95\xa5\xebJ\x8c\x19\x8f\xccH\xbe^gy\x12\xc4\xf7\xd4_?\xce\xeb\xba\x1f\xdfw\x9bfq.\x02$\x96E\xd5\xac@]\xb7)/\xca\xf8\x01c`\xc3\xc4\xfc\xe2q>|\xbf\xcf*\x15\x04\xab\xe1\xe1a\xb7+\xf7\xd50*?\xfcP&*\x9fy\xb7\xfd\xa4\x8c\xab\x8f;\xd5[W\xdb\xfc\xce\x0b=\x8f\x0d\xbc[\xfa\xb8\xc5\xaa\xdda\x1a\xf90\xce\xcb\x83\n\xd84\x11q\xde\x1dS \xa9\x00\xcav&\x92`UW\xb4\xaa	o\xd7\x95Gf]\x9b\xe9\x9eh\xaf\x84:\x19h\xa0OgO+\x0d:\xd8\xcaX\x1cO\xd3\xd5P\xc9x\x1d\xc4\xbba\\\x16\xb1\xac\xd0k\xfe1\x98/y\xbc\x1b\x1e\x00{\xc1\x98G\x8cq\xdbD\xc0\x8e\xf1\xbcZg\x87\xa5\x90'6\xb5\xdd8]\x1cP\xe4\xad\x88\x9c\xa4}\xc0\x8e\x07U\xbd\xce\xb6\xaa|\xa8\x82\xf8\xc0\xc7m\xd5\xb7b5,\xca\xf7\x01s*d\x01;V\xfb\x8f\x16\xa6\x0b\xf5\xbe'\x87\xcf\xe3*{\xa7\xfe\xfeS\xb4Qq\x15x?d\xf1\xbe<\x94\xabj\xf8\xf7\x1f\xbe\xff\xf6\xf5\xeb\x9f=v\x8ae\x15\xaf\x83\x88\x1dONc\xebk\x8d\xa1NU\xed\xfe\xa2\xde>\xa8Cu\xbdb\x14H\x1e\xb3\xa3\x1c&\xb2\x92/\xb3\xbcR{\xdf\x0fb\xe1&\x041\xd7\x9f8a\x8cM\xb1\xb2\x89)\x81\xa4\x03W\xe2x\xe2)_\xf3L$\xc3\\\x15i\xb5\xe6\x1b~/\x92\xf9x\xc9s\xbe\xe5\x05/\xf9n\xba*\xf7A*&\xd3\xf46\x9b\xa6\x83\x01\x9d\xbcT\x081a\xc8Y\xf7\xb2\xa2'\xb1I\xef\xd4\xbeR\xfb\x03\x03\x9c\x95\xab\xdeZ\x08\xefP\xed\xb3\"\xf5|?P\xf3\xf5\xb0*\xbf/\xdf\xab\xfd\xd7\x120\xb6\x14n\xa5\xf9z\xc9\xa6\xb9\xb8\xa7\xde\xd3%\xce\xc6\xbd\x10\xc2{\xea\xb1{\x91OU~P\xbdl\x15\xe4}J\xf3}\xfc\xb8g\xc7\xad\xc8\x07^\xcf\x1b\xdc\xf3B\xa8\xf9vY\xd7j\xee=E\x025\xd1/\xd8q'\"\x9aA\x89q*v\xdc\x88rx\xd8\xe5Y\x15x=\x8f\x0e\xe1f>^\n!\xf2\xba6\xbf\xd0\xebq'\xd4|3\x9f,u\xfb\xd4\xdc\x8e\x1dK\xa1\xe6\xe5\x92\x97B\x88\xfexV\x88]\xb8\xa3\x9f\xbe\x1f\x14\xa2d\xd3h\xaf\xe4\xfd\xe9t:\xf5\x0b\xdf\xef\xef|\x7f5T\xfb}\xb9\x0f\xbc\x1f\xcb\x9e^\xa3\x03\xb6~\xb5/\xb7=o\xb0\x1d\xee\xd5.\x97\xb1\xc2`\xb8\xd7\xab\xca\x9e\xc7\x18/\xfa\xa6\xcdX\x14\xb3\"\x88Y\xb8\x0b\xca f\x8c\x9d\x9a\xe3\xe3@\x83\x044\xf0D\xe3A\xa5\xd7\x15h\xe2\xc0W\x9d\xfdN\x85\x1c\xee\xd5aW\x16\x07\xf52Syr\xc0\xdec\xcbi\x852\xacP\xca\xe8O\x02p\x9a\xa7\xf3l\xb9\x14\xc9<[\xb2\xe9\xfbu\x96\xab`\xd5\xae\xd0jxXg\xab*`|-\x84\x88|?X\x0b9\xdcf[\x05\xe8\xaa\xebx\x98\xaa\xea/\xa6\xbbo\x95L\xd4>\xf0\x0cJ\xbb\x01\x8cx\x8c\x96\x7f\xcd\x9a\xce\x15\xcbV\x81\x9agK\xdf\xc7\xff\xc3J\x1d\xaa`\xcd\xd8q5|(to\x99]\xe3lE\x83\xc9\x8a^\xc26\x02?	J\x8eMc	\x01j\x1f9u\xdd\x81\xb5\x8c\xf6\x14\x19K\xc0CfZ\x04\x9e\xbf\x17\x19;m\xc4\xa6\xae\xa9\x87\x0d;n\xfa\x82Z\xf7\xfdv\x10\x9b\x06G$\xf3\xcd\xd29\xd1\xd1/\xc0bz30\xc0avx\xbe\xdf\xcb\x8fA\xc4\x98AhQ\x8b\xb0\"\xae\xd81\xae\xeb\xe8\x85\x9e\xa9d\xb3$\x90\\\xb1\x10\xed\x0c\xbc\xb97\x08\xccaRBx%\xa1\x17o\x16i\xec\xbd\xf4\xb8\xa2\x9eN\xac9\x1f\xfd\x18\xc3D\x9d b\xa2\xadCK\x0c\x04\xa0\xb0\xb9\x11k\xdaW\xd4N4WKjJ7\x84AD\x0e\xd2\x8b>\x03\x80i\xf0J\xb8\xe2\xa9X\x0d\xe5F~x\xa5\xaa*+\xd2\xc3p\x95\xcb\xea\xa7\x1d\xca\x1e\xea\x1a\xb8\xbb\xdc\x07	z\x8aY<O\x96}\x0d\x1eA:O\x963\x19\xaa\xba\x0e\x80z\x18\x9b'K\x81\x02l\xaa0n\xf5\xa1RE\x12\xf4\xc7\x1c\x8b\xe0\xf4\xff\x7f\xd0?G\xd7+\x9e\xb2\xe3J\xac\x00^\x16\xb7\x1d\x80\xaeR\x91\xa2k\x9e\xceWK\xd1\x1f\x13\xb6[\x0b9_-y&\xc6|#\xd6\xb3\xb5\xc1q\xe1\x98\xdf\x0b	\x98}\xc5s\x82\xfciv\xbb\xf1\xfd\xe0\xbe\xae\xfb9\x9bf\x83\x01\xcb\xc5z\x9e-\x03\xea\x94q\xb3	y\x07\xa3\xf5\xef\xeb:\x9d\xe7\xcbY.\xa20p\x86\xd3\x80I\xcex.\x9c\xc1\xe7<e\x8cMM?\xbe\xdfO\xe7\xdeSo\xe9\xfbA\xa7\x98\xf7\xd4CA\x0bb\xb9\xb3\x10\xffp\xc9)\x93\x1aD\xb8\n\xcc\x10\xa3\xbe;\xc4XD<\"t65\xd0\xf8\xd2V\x8a\x99\xd9O\x11u\xf1\xb2A\x8e\xd1O\xb8\xd8\xc7<m\xaf\x06\xc2\x15z\xbd\xd4m:U\x83\x01[\x8b\x04\xa0\xb3\x11\xa37\x8b\xc1\xc8\x9eW\x8e\xc5\\\x8b\xf5\xf0\xf0\x10\x1d\xaa}0au\x8dA\xf0L\xc8\xf9zI\xff\xd5\xf5|\xc9\xb3\xf9f\xe6\x99\xd5\xf2Bo\xf7pX{\xcb f'\xf7H}\x05hl\xc0OD\x00k\xa2\xaf\xbc\x99\x1c\x96\xab\xd5AU\x7f\xc3gh\xbf\xbe%\x9a\x8b\xabN\xd1I\x88\xb9|\x81uH\xee\xc6\x84\x1ab\\&\x11\xd1l\x1es\xa6%\x9e\xb1\xb8\xae\x83\xe4F\xec\xe4\xfe\xa0^\xe6\xa5\xac\x02M\xe2H\xee\xedd\x92\x00\x02\x06\xd1\x87\xb9Z2V\xd7c\xc6c\x0cj+\xf7iVx\xb3dp\xadb\xecT\x08\x1fi\xdb\x0cF\x97\x1cx4-\x8fj4\xf8f\xe0\xed>x\xa7DD\x1f\xb1,\xb4\xaf\xc9\xed\xb8\xae\x13!\x8a\x87<g\xb8\xe1\x0f\xd5\xc7\\\xcd#\xba\xb3\xa2J\xefJ\xc2\x98mb\x9a\xb8\x9d'\xd4|\xb6\n\xe2\xb35H\x06\xbfw\xfe\x9cV\xd2.\x8c\xef\x07\xc9\xe0_\x9c^w\x05\x1fm\xc1]\xc3\x16\x05\xeb%i\x01\xa6\x0cd\xcb\x12t\x89X/\xc9\xdeyl\x1a\xad;4l\x04r5+\n\xb5\xff\xf6\xf5\x0f\xdf\x0b9,\x1f*\xfd\xdb\xf6\x11\x0dW\xd9\xfeP\x111\xeb\xf4T\xb4=\x05\x9a\x9b\xf9QnU]{\x1e\xeb\x1e\xaa)\x81bV\xec\x1e\x80\xbf\xb7\x81da\x845;\xc4\xfblWy\xbeo\x8e\xaf\xc4\x9di\x18\x8c\xc3W\x1f_\xcb\x14\x0d\xf6\x85\xf7P$j\x95\x15*\xf1\x80(\xd3\xbd\xda\x05\xd7\xcb\x06\xa6\x17\xc6\xa3\xad\x8bB\xb7\x86e\x92t;`4\xf1Z\xc5\xf7Q\xf9\xc1\xab\xeb6q/\x93\xac\xf4X\xc3\x8b}\x8dB\n@E\xc5\x95;\xfb\xdcAF\xbf\x7f\xfc\xb3\xc7\xc6\xfd\xd4ca\xd3\x0c\xb1\x9c\xafT\xae\xe2\xaa\xdc?\xcf\xf3\xf3&\xce\xf3u\xf5\xb9\xc3PD\xf7\x0eC1\x8d\\^s\xe2\xfbA4\x8cs%\xf7\xcf\xabj\x9fE\x0f\x95:\xf8\xfeER\x00\xb8\xd8\xaa}\xaa\xba\xc5\xce\x92\x885\x12Q\xb3\xff\xdd\xad\xd7\x90\xdd\xdc\xdd-l\xb9p\x16\xd2	\xd2;g\xb7\xa3\xef\xee\x91\xef\xb7\x89z\x8ff1\xf6\xab\xa4[\x17\xed\x1eh1h\xab\xcc\xde\xbd2)a\xdc\x02_]\xd3G\xa5>Tr\xaf$*\x9a\xd2\x7f\x95\xf9\x83j+\xd3\xa7\xae\xd9\x00i4D\xbd\xbe\x10\x92~\xd0*\xe2\x87\xf9fa\xd0\x80	\xe5\x9d\xc1P4\x8c\xcf\xa1	\x0b\xfc\x0e=Q\xa3\xf4\x8bj\xbe3\x83\xa1\xbf\xac\xe5&\x9bE\x0fVC\xf5a'\x8b\xa4\xbc\x96\xe9\xfdrx\x88\xb6Y\xf5\x8b\xac*\x19\xafU\xe2]k\xc2\xfb%^\xcb\"UN)\xf7\xc4l4\xfcd\xab\xe0\x1cx\xfa\xfd\xd5p-\x0f/d%\x03i\xeeQ\xa2\x14\x882\xfa\x05t	`b\xdd|D<\xc5\xe5\x97\x0e\xd5;\x00=\xb0m\xc6\x8e\x89\xcaU\xa5z\xeb\xe1Z\x16I\xae\xf8\xdad\x0bCA\xc5\xa0\xa02\xc2\xca\x89\x18s%\xb2y\xbc4\x97\xf14\xb9U\xd3d0\x00U\x896\x872I@\x08p\x94\x01EuZ\x13A\x82\x8b\x98~\x88\x86\xbc:\x9e\xb8N\x027\xd1N7\xd3\xd35\x08o\xd5@3\xee\xbcJF\xb9\xf2\xd8\xa3G\xb7\x82X\xc0c\x86\xd2vQ\xab\x1c\x96\xef\x0b\xb5\xb7\x02\x8bstl*\xb2P\xb6#\xf9\xef\x16\xa9\xfe\xd5rj5\xc4\x13\x00\x1b\xaan[{\xb9\x97)\x86\xa2e7g\xb8\x9ei\x86%2\x0b\xc6\xce\xaf\x82h\xb8+wAKf9\x0c\xd5kKqD\"2\x97c\x87v\x8a\x9a\xbb\xd4\xa2\xe2\x96\xa6\x97-\x1f\xd6\xefG\xc3X\xe69\xd2\xb8l:\x02\x10\xc5'6\xed\x00\xd6o4hr\x89hm\xab\x1bl\x19\xb5d\xa9%\x92\xae4\xd36\xd2\x81f=\x90\x9f4\x91\xe0NlER\x85 \xe2	\xef\xc7\xb8\xc0\xdc$f\xd9\xd0O\x8fw5\xcc\n\xcd\xff\x00\xb6\xee\xc4X\x8f\xbd]\xe9W\xed\xb8\xfa\xb2\xae\xfbV\xe8\xf7c\x99\xa8V\x04\x88\xaf\xce\xa0\x1dY\xe0\x7f\x06M\x03\xe36\xf5\xcfm\xaaS\xb6\xb0\xfbj\x08\xdf\x81\x97\xa8\x95\xda{ \x15\x07\xde\xdb\x07\xf5\xa0<\x9e\x8ah\x00B\xe4\xdes\x0e0&5]\x13E-\x84)Y\xd7}{\xbe\xc1\xae0\x9bKu;\x99)2\x1d)\x93\x1dP\xc0\x8e\x9d&|\xbfS\xc9\xf7\x83\x95\x91\xa2iT\x83\xad\x183\xbe\x061\xa2\x02\xc6N|\xec\xac%\xdd\xf0\x96\xcf\x8b\x80;\xf4\x8d\x0f\x80\xf10\x12\"\x1d\xb2\xc37\xdb]\xf5\xd1\x88\xaa\xe4<Z2\x06\xa6<+\x1e\x14`\x8a\xc8\x92\xaa\xfc\xf3\xab\x9f~\xf4\x0c0\xf4'\xa7\xcb\x15\xce\xad\xcc\x01\x045\xc0\x127\x94\xbbG\xf6\x14P\xd77\xde nD\x1d\xf7\xdc\xbb\xf9lrA\"\xe1\xe6JU\xd5\xa2x\xe5\x02y\xe2\x029df\x89@\xb7^\xb5\x7fP\xde\xac?\x0e\xe9k%\xf3\x03>'\xfa\x13\x14\xb17\xc3\xff!f\xfe\xe3\xc3V\xed\xb38H\xd8l\x90\x84\x1bK\x18\xcfV\x80\xb3\x83\xc2\x9c\x83\x84\x85\x89\x91\xb9\xa5\xecxZ\x11\xa64s=i\xeeXD\x16\xfa\x1djh\xddb\xadt.\x97\x90\xac\xc5<\x99J\x90\xe3$m\x1a-\x0e\x83\x11#\xf6)\x16c\x8e\xd9\x1aT\x1e\xdf&\xd3x0`\xd1\\\xce\xe3%q\xaf\xa6\xfd\xe8\x04H\x05\xe2k\xe4\xbc\xa8W\xc8wY*\xabr\xcfqG\xe6e,1\x04\xbe\x12v4\x81#\x82\xc7Q\x80d@\x0d\xb3\xc3_\x94L>j\x91c\xdc4i\x10\xe20)_\xc5\xfb2\xcf\x03/W\xab\xaa\x11Y\xca\x8e\x80\xf4\xcf|b\x11\xd9I\x0d\xf7h/`'\x1a\xa6j\xbbwo\x12HH\xd5pU\x0c\xb3\"#\x19/_\xb3\x13	\xa6\xb4\x96\x81\xa4R\x9f\x81\xb9\x14\xa37\xc1,\x9c\xbf\xf9\xc3\xed\xf2ip;_\xbc_\xfcm9\xb8c\xf37w\xcb\xa7\x9f\xd5\x7f\x08\x90r\xb3|\xca>c#p\x9c\x8bW#~\x0f\xc6\xf30\x18\xf1\\`}?\x1b\xf1\xad\x18\xbd\xb9\x0d\x16\xef\x07lqx\xba\x18\xcd\xee\x82Yx\xbb\x18-&wl\xf6\xd9\x88\x17b\xf4f\xbeX\xf2\xf0xZ\x1c\x96O?\x1b\xf1R\x8c\x16\x0b\xf4\xeb-\x16\x8bQ\xb4*\xf6\xd5\xb2~\x98\x8fo\xfe(oV\xcfo^.\x8f_\x9c\xd8(\xe5;1\xf2\xe6oP\xa8X\xec\x97O\xbd\x1a\x90W\x13\xc0\xd5\x80\xb0\xfaf\xb6H\x06\xc1,\\\x0c\x17\xc9S6C\x93\xea\x9b\xe5|\xb0\xb8Y\"\x87\xcdF)\x7f+F\xc1,|S\x875g(zx\xba\x98\xb3\xc1(\xe5{1\n\xde\xab\xe8>\xab\xd8\xbc\xb7\x18-1\xd9\xe1r\xc0F\xfc FA\xb9S{\x89\n\xc3\xa7F\x80\xc8fg\xc5*1\n\xb6\x87L\xb1^\x9b\xf6\x80\xb4\xf2\xd7,\xcfM\xe5Yo\xff.\xb4\xf9l6\xe2\xef\xc4\xe8&\x98\xcb\x9b_\x975f\xbcd\xa3,\xe5\xef\xc5\xe8\xcd\xcd\xf6p3\xe2\x1f\xaeni\x10\x0d4\x83\xf3\xdf\xbb\x9d=\xbd'\xfeQ$\xc3\x87\x83\xda?OUQ\xf1_\xf9s\xfe\x15\xffZh<3\xdc\xed\xcb\xaa\xc4u5\xac\xcaW$\x9e\xe0/.\xf3\xd6\xf2\xf0\xd3\xfb\xe2\xe7=\xa6[}\xe4\xdf\x08\xba;\x9c\xca\x10\x10\xf0\x97\x17\xc9\xa4\x0d\xe0\x7f\x12\xbae\xb7\xb3}\xb6\xe5\xdf^\x94\xcf\x8aD}\xf8i\xc5\xbf\x03\xa5\x05\xd8\x14\xaa\xad$\x8eqY\x1c\xaa\xfd\x038\x8bPq\x80m\xe8,C\xc2W\x1a\xb5Ap\x0e\xd1)\x0e\x97\xb4\xf7&\xf4\x0fHiq!;\"\x0d\xe2G\xd0\xc8\x02\x1f\x90\xa1J\x8e_\x06\x05\x88\x899ST\x1f\x82G\xdc\xf4\x1e\x11G\xbe\xdfO|_\xeb\xb6\xce\xda\x8a\xb9m\xcd\xa8\xbe\xf0i\x18\x81r\xff[]\x18\xc4*]\xc4\n\xfa\x1dLQ0f\xb8\x07n\x89\x191I\x16_\xddL(\xef\x8e\xf2\xf4\xf8o?\x9f\xa5\"\x1b\xaa\x0f*\x06k\x9b\x8a9N\x04\x97\x1c\x7fH\x0c\x91\xfa~\x90\xce'\xcb\xba\xee'\x8c.\x0d|1`\xf1^V\x1c*Y\xc4\x18\x8c\x9aA\xf7\x10&P\x03\xcc\x92.\xedX\xd7I\x18\xf3\x8d\xd8\xda~\xf8f\x06\xa4\xf6s.\xb3\xc2\xdcg	\x9b\x05R\xcc\xcfi=\xc8\xf1\xd9\x92c\xab\x87\xb2\xaa\xf6-Y\xd6\x1f\x83\xf8\x14\xf3\xfb\xab5\xc2`#\xd40z\xc8\xf2\xa4\xa15\xe7\x18\xf8\x92\xcf\xef\x97\x8cK\x11l\x8618\x0c\x10\xc83\x05\xfdY\xa1\x82\x0d\xd4\x81T\x9a\x85\xce\xefa\x0c\xf1\x01\x88\x99CK\x0cjf2\xc0\xa6p\xc9Nk\x11;4\xf6W\x1f\xbfK\x82t\xfelI7\xe1\xda\xf7\xd7\x0e}D\xab\xb8\x1efI_\x08*c\x9a\x04\x9dV$\x81d\xd3\x0e\x845\xb0\xb2>]\x01\"\x07j\xec\xd0\x90l/\xfe\xa4\xae\x93\xe1\x86\x98\xeeY\x90\xd4\xf5\x8a\xd9NB\xdb\x98=2A\xd2\xe4\x01\x90\x95K8K\x87\xbe\xd4w\x87dS\xd9\xf4m\xe4\xc4gP\xdcds\xdb\x95\xe19\xcd/w-\xe5\xbd\xb2\xf4&\n\xb3\x13\xb7\x95C\xcf\xe3z\x02\xa1Gjm\x8f7\xd2\xe0C\xf6\xabj\x8f\xb8\xa5\x1c{\xce\xf2\x9dxUR\xc3W\x8a\xbd\xd4\xd0\x84\xd2\xa0\xc7x\xaa\\|\xd1\xb4&\xb5\x80n\x86rC\xd3Z\xc0By;\xa6\xa4\xb9\xd3\xdb@.iY\xe7ry\xe2\xc0y\xaf*\x19\xdf;\x8d\xbaT\xec\xc5\xfa\xb3\xa9j\xd4\x0e\x92\xcd\xbe1\x8aS\xb0 \xa1\x057|\xf0d\xb8\xdb\xabw\xfa\xe4P3<\xe9\xa0)\xfb\xc1\x89\x82\xc4~{\xb3\xa4\xd9\x0d\xd1\xd9\xa6Aw\xd7f^\xcf#-E\x1cbG\x1f\xad\xe5\x0d\xbdA4\xf0\x02o\x10\x0f<\xe65[\x99\x9c8\xb4\xbf\x9d)7+\xa9\xb4\"\x05\x1drP\x1a'N\xb0\xe4\x14fG5\x8c\xb2\"!z'`\xfc9\xb1\xc7-\x0b\x86\xaa'\xae\xdev\xaaH1h`\x1f\xe8\xf7fB\x1bct\xcd\x16\xd2\xcd\x17\x97\x83	\xc8\x18H\x05\xdbV\x9a!RQ\xf56\x00<\xe4\xf2\x93En\xd0\x0e\xb5\xfaX\xa1\x06\x02\x82\x97f/Q\x97\xcb}Jx\xf1\xc0\xb8G\xf5=n@\xb1\xcd\x19n\xca\xac\x08<\x0e\xc9\x06\xdf\xca\xdd5\xc0<\xeb\x03\xa7h\xa7{h\n\x13\xb8\x99qK\xdd\x07d\x0d\x11;\xa1]U$\x8f\x0e\xbd\x01\xb0\xba\xbe\x00T\\\x0eL\x03x\xf8\x0d?\x94\xfb*\x9c/\x87\xf8\xcbA2\xc7\x8a>\xe9\xd7\x897$\xa4sS#\x8d+#\xd7\xa0/\xfb\xdb\x19\x0eN	\x91\xef\xd0\x1d\x11\x99\xd9,\x0f\xc9+\x8e'\xbe\x11\x13~\xdf&\x9bK\x8d\xe7\xa2?\x99\x9a[2#UA\x99+I\xe2\xe9\\d\x9d\x86&\xb6\xa1g\x8d\xb2(\xeb7\xda7\xdf\xefw\xd0`\x06\xd6.\x83\x06\x8cC\xc9\x0dmIF\xc7\x89\xdf\xdcl4\x8b0\xdd\xdc\xdeO7\x83\x01\x14\xa2\x81tz\xda,Y\x9f\x10	#N\xc2\xb0y	\xc9\x86@U\xcfc\xbao3!\xc4\xaae\xecr\xdf_A	\x7fv]\xaeX]\x07\xa9h\xf1\xc5\x8a16\x0b\xd2Y\x90\x8a\xfe\x84\xafE\xe2\xfbmf\xc2fI8_\xb2\xb0I?\xbbz\x93\xf0x\"\x01\x94\xb0\x9b\x12\xe4|\xcdW\x8c\x85+\x83\xdb)w\xd5\x88\x0f\xb2S\xb3\x7f\xc1\xb1(\xbf.\x8bU\x9e\xc5\xceq\x89`\xe4\xf0\x99\x10\x02rA9\xfcL\xa4\x8c\x13\xab\xa9\x99\x87&\xc3|\xae\x9a#\xaeN\xdc\xf0;a\x7f\xa2\x11\xc4\xdfdV\x85\x13\xbe.s\x8d\x18\xda^$;\xca\x99agPj0\x08-s\xd3\x1f_\xc5/\x86D\x83\xe2\xbf\x7fs\xe3T\xadki\x94\xf7.\xc7\x05\x1a\xd1\x90pf|\x0eOej\x83\xb3j\xaa\x80	D\x1f\xa6\xadN\x17wc\xd3\xc8\xf49I\x02\xfe\x96U\xeb \xe6P.\xe9cR\xed\xb34\x85E\x88\nbf\xbf\x02\x8ff\xe11h\xc9\x9a\x8f\xd3\x897\x88\xb2\x9d \x91\x16\xfd\xe7\xec\xf8\\\xa8\xe1\xd72\xcf#\x19\xdf\x1f\x02\xaf,b\xd5\xdb\xaam\xb9\xff\xe8\x19\x99\x1b5\xfa\xaa\x92\x15\xc4Z^\\nw\x10jz\x9f\x9e&I\xebd\x92|\x03\xd1\xe5\xf7\xd9\xa1R\x85\xda\xb3\xcb\xa4\xc0{\xf1\xd3\x0f_\xe3\x9a/\xaa\xefK\x99\xa8\xc4\xe3_\xf1\xfe\x84qy\xa5l^\xca\xc4\xe3v5\xfb\x13\xa3\xcd\xd6\x9d\x91 \x98\xfac\xc7\xce'fE\x03;`\x12Z\"\xec\xf1\xaf\xa8\x8b\xb6\x12Ju\xda\xd7\xf64\x11\xa1\x88\xfd\xc7c$$\x08\xbd\xad\xd54\xe9\xcb\xde\xb0\xd0	;\x9e\x1e\xe7\xb7}?\xf2\xfd?\x83\x8b>\xf1VA\xdb\x816\xb3\x98\x8aT\x00\x81$\xcd\xbe\xcd\xf7P\x8bn\xfb\x90\xfe\xb7\xc7\xb5\xae\x7f\xab\x05\x89\xe2T\xdd\xd8\xd8]\xa9 5\xb2\xf1}	\x01\xfd{*w\xe2\x8d(\xe5J\x95~v\xf8Q\xfe\x188\xfa?	\xf1Wvx	N\n}\x9f\x08E~\x8aF\xd2\x8c\x1c\xee\xdc\xef\xe6_\x9b;\x8d-\xeb\xda\"\xd4\x13\xef\xe0\x9eNS8j\xb2\xae\x9b\xb5\xea\xb7V\x10u\xdd\xb2e(\xe1\x98#\x1ax5\xbb\x89\x93\xe7^U\xbe\xdf\x7fa\x86\xc1='\xddcN\x8e[\xa1\xbd\xa4\xb8\x97\x1d~\xb6\x1f?\xad\xbc\xb6'\x03\x1c\xcd\xcd\xda\x9f\x90\x18%i\xad'Z\x82\x05\xd2\xac\xa8\xae\x9bA$\xec\xc4;\x92\xbc\xce\x12\x9c	\x01\x9b\xa9\x99\x1f\xe3\x13'\x9b\xa4N\x9dj\xbd/\xdf\x93\xb0\xe6\x1b\xe4\xd165R\xb1\xb6\xa4V\x88\\\x1a\x1b\xd4u?2\x1d\xf5p;M#\xa1\xd9\xef@\xeb\xa8\xe5\xf0\xcf\xaf~\xfa\x11\x88\x1b\x7f\xc1\xc5\x1c\x1a\x99\xb7\x9bf\x8a\x17F\x1e\xdd\xc8\x0cK\xee\xfd\x7f<\xd6|\xee\xb8\xb7t>\xdfr\xcfcve\x03L\xa2\xb1s\xf0L'\xde b\x8chcc\x8f\xf5]\xf1N\xe6Y\xd2\xc3xB\xca6\x13\xfe\xfb\x0f\xdf\xb7\xf3\x8d\xdd\xf9\xc6\x9d\xf9\xc6\xa6?=_\xda:\xbe\"d \x87/~\xfa\xe1g\xb4\xb5\x9f\x05+\x81\xf14	0O\xd5S}\xb9/\xb7\x06\xd0cN\x1a\xb9\xd1\x87m\xee1\x16\x06	\xd5\xf9\x94U\xe1\x8b\x9f~\xf0@\xc1\xcb\xc3\xc7\"\xb6rO\x9e\x0c\x81\xa3\xfe\xfe\xc3\xf70\xef0\xf0\x95\x82\xc9\x8eN\x01x\xb8~r\x8e\x85\xc0\xd7]W\xc7\xd2\x18\xf7\xb4X\x1e3$\x11\xf3\xfd\x8b\xf5\xc3r\xf5\xbcA\xdc\xc2\xea\x89\x17e\xe9\x90\x9a\x0cV\x86y\x19\xc9\xfc\x9bw2o\xd3#v\x8c|\xdf\x88a#\xd0D\x92X\xfbW\xa4ot\xf0\x17\x11\x01\xea\x9d\xcc-\xf8\x83\xf0\x0c\xb0a\xb1\xdc\xaa\x1c\xf6\x84W9\xae\x06>\xdeso{\xb8q\x00\xe6\x1d\xff\xc00L\xad\xe2\xba\xcef\xb4\n}+\xda6\xca]G\xec\x85cy.\x08;g\\\x1a\xcb\xbc\x15O\xc5\x98\xaf\x1b\xc1/\xcf\x04Y\xceiT\xd4@\xac\xa4\x03\xa3\x0d\xc82-\xd1_\xe9\x83\xaco2\xe2\x00\xc8\xb0)A\xff\xfd	\xd3\xe6k$\x9c\xc6\xd1\x9f\xa6\xb7\xebi\xb7p:\x18\\-~\xbd\x0b\xbd\xca\xe8a\xc5\xf1\xe77\xbb1\x15\xd2%O\xb9\xee\xcc\xadb\x01C\x9e8\x04r\xe1\x9ff\xd76\xcb\xb0\xc7\x9e\x17\xfe\xc9\xb4\xc7N\xe1\xa7\x0b\x06\x92\x04\x91v\x97\xef\xb9\xfb\x95\xe3\xeb\xc4\x1b\x91\xc0\xd9&\xe3\xbc\xc6X\xfb\xf9\xd2\x10Z8\xc6V\x7f\xd6\xdc\x1eS\xbbYzxdg\xe3 \x81\xa4s\x13\x9b\xdc\xbdJ\xd5\x87\x9dwv\xc3\xcc\xbe\xd1\xd3\x8a]>\x1c\x1f\x96\x16\x8eO<+.\x87\xdap\xfa\x18\xa6F\xbf\xdfZ\xcc\xf3\xad\xe5\xc5`\x9e7\x85)\x97a]b\x11\xcf\xe2\xdb\xf1\xec\x07Y\xad\x87[\xf9!\x18\xf3d\x10\xb30\x0e\xc7t\xbd4:\x07@	\x80+\xf2\xfd\x08\xa4\xb9\x10\x8d(36\x03\xbb\x99\x9c8\x8d\xd6\x1d\x96\x1dT\x0b\xccJ\x8c\x1duMl\x92I	\xb3\x8d\xac\x85\x15\xea\xac\x84\xcd\x9c\xaa\xdb\x15\x99\x91\xc9y2\x18\xc0\x14Pi#\xce\x9e\xd6\xdd\xc6sE\xb6\x83N\xfe`\xb0l\xb7$q \x0b&1\xd7\xd7M\xcc\x97\\Mc\xd1\xef\xc7S{3\xae\xc8\xb2\xcd64]\xdd\xa6\xd3\xd5`\xc0Hg\xab\xcf\xd6\x8aq\xd8d(\xdfO\x88\x01\xa7T\x17\xc7u\xb9\xe9\xce)\xe7k\xf4\xa9\xcd\x0em\x1f`0;\x92\xce\xba\x86ei\xd4\x98\xfel\xda\xa5\xf2\xfd`s7\xf6}If\xa7r\xbe\xb9\x01\x7f\xb9\x11B\x8c5P\x19\x19\x97\xb6\x9f\xbdg\xd6\x84\x91,\x17W\"\x0e\xe4<[\xf2\x8c'\x8c\xaf,\xfd\x16\xac\xe7\xd6\xfe\x11\x0c\xd8\xb4\xc1\x16)\xb6_\x9ajt\x82?U\xcd\xcc\x7f}a\x94\x0f\xa5N\xfa\x90%\xe1\x84\xef\xf6\xe5\x87\xceq\xeb^\xa2\xae\xbc\xd9\xd8\xa4\x83i\x8d\x85\xe4R$'\xab\xabr\xf0\xa1\x85\xc8\x88n\xd9\x958\x17s\xf0g\x0c\x96\x17\xb6\x82s\x01h\xfc\x17\xf3\x95\x19op!!a\xec4M\x87\x18\xb9\x90\xee\x9f\xba\xd6\xa9Xp$\x0f\x06v\xee\xe9\x89\xcb8V\x87Cg\x8a\xad|A\x83\x1d\xd9\xd1k\xa4\xc1s1\xe6\xdb\x16\xda\xa01m\xb6=i\xc9S\x8d\xebs\xecG\xc2\xd4PwBm\xe7<\x99\xe7K>!fz\x9a\x8a\xc9\xc9r6\xc4W\x93\x113n\x12\xdf\xef\xc8\x19V\x8c\xdf\x03\x96f\xc1F\xc4<\x16\xe7\x02D3!\x88\xb0\xf3<\x00i\xcecvb0f5\x17-N\x01\xcd\x811\xc7D0\xbf\xddN\xf3\xc1\x80\x01b\xf2%O\xf8f\xb625\xf0\x9ds\x9b\x01\xc6\x9fgz\xc4v\xf5f2\xbc\x9f\xd9\x0eX\xb8\x9d\xa1\xf0\x18\xb7S\xb8\xc6\x95\xec\xb0!v\x84D\xd1\xbd\x90\x95b\xa0U\xc06\xe3\x9e}\x90?\xc0\xa7\xa2-\x0e.^\xc8\xae\xf5\x95\xe1\xd2\xf6VgP\xd7\x87\xf6g\xd5\xfe\x94V)\x04\x13\xf5\xedNV\x19Y\xbc\xdc\x8e}\xff\xa1-5_\x1a 8F\xfb\xf2\xfdA\xed\xc3\x88D?\x9e\xc7\x8d^.\x8c\xe6\xcf\xc0\xa8\x8c\xbd\xd3\x89\x1f\x1e\"w2\xf6gOv\x04j\x98\x9cl\x14\xa4\xc8952\x112\x85\x86d\x08\xec\xe8\xe1a\xa7\xf6q.\x0f\x07-,B%!\x1dy\x18R\x03\x94\\\x15.3\x82\x83\x05S\\#\xb1}\x88x\xd3]\x0b\x12\xa4\xd6Z\xf9\xfe\xaa\x83\xa4|\xbf\x1ftR$\xc8\xb4\x95\x90\x90\x14\xd9\x03\xd1\x8a\xe6ZA8N\x03\x08\xb4\xa6'g\x98H3\xfb\"\x83\x96n\x94'nW\xf5x:1n\xc4\xbc\xdeWZ\xec\xd6\xfb\x91\xee\x91\x9e&\x99\x1b\x02\xbfG\xb8\x90\xa0\xa3\xf7\x17\x95~\xf3a\xd7\xd3\x02G\xcf\xe8\xdd\xe1\xe5\xe1Z\xa7D\xec\xf8\xdd\xdc\x9b\xeb3\x07\xba\x1f\x16\xf0\xcbs+\xe8\x13\xe3\xbf\n540\x16|d\xfc\xd7\xa1\x19\x1d\xc9\xd1\xcc\xefy\x93\xba\x14\xfd1o\xd2\x87\x06\x1c\xc4\xaf\xf6\x17s2\xb5\xa2\xd7mgx\x90+\xb9\xcf\x04\xcc;\x0cA\xec\xcd\xc0]\x06\xd0p\xcf\x17\x87\xc5\x87\xe7\xe3\xa5\xd6s7_\x9f\x8d\xe0z\x01\x19\x0f\xbf\x14\x9d\xcc\xbej\xf7\x16\x12\x0fmG\xf2;\xa5+F\x86\x12\xb0S\xd8\x91\x95\xf8~p\xd1\xecU\xf1\x0fla\x86\x89\xfam!K\xd3\x13k]\xb6\xd4)\x00>\x87\x15\\+|j\xbb\xd5\xc7|\x06+\x8b\xba\x86\xd9Ex<\x118\xc5\xb8u\xf5u\x0fKu~\xaf}\x98\xda\x9a\x86\xec\x83\x8d=I\x82\xa7\xadi]tnW\x97\x8ah\x9e,\xc9\x04\x08@\x1b\xa4X\xebFh2+\x82\x14rP\x97\xfa\xf3\xfd\xa0/\x87\x0fE\xf6\xf6A\xd5u\x7f\x07uv\x90B\xf6\x11k\n\"e'^:\xa3\xa1\x13\x07W\x06\x10(\xa2/\x87Z\xb2V\xd7\xf3\x88\x93\xdbB\x1f~\x0b}\xdc\x1d\xf7u\x0d\xa7\x851\xcf[\xe2	\x83\x9f\xc6\xbe\xbf\xbd\xcd\xa7[C\xca\xcd\xb7Ks\xe7\xa1u\xa2\xc1\xc1\xbc\x1c\xaar\xf7S\xf1\x12L\";*\xc8\x165\xcb\xb0\x81\x947&\xc6\x0b\xa2\xbd\x19dx\xfd\xf1l7L\xb2\x034\x9a\x01\x0bc1_\x86	\xa8 \xdd-\xa0V$\x8d\xeb\xcf\xae\x95@*`q\x05M+\x94\x02;q\x94IG/\x80\xf1\xe9\x0d\x90\xed$\nGY\xc17\xb3vz\xa1\xf2}X\x85B\xfa\x19\xdc\x0b\xc9K\xb7\x03{\x9b\x00\xa3A<\x0b\x1b\xa9\xeb}E\xad\xec\x9c\x9fm5-`cG\xd9R\x86\xd3\xd5m3>P\x85\xa0\xbb\xe1\xa9\"D\x0cf\xe8\xb8\xf1\xfd\xd5\xad\x00q\x94\xdf\xdc\xf0\xd5\xad\xd8\xfa\xfe\xf6\xe6\x06\xa7\x10('V\xc1\xea\xe6\xc6\x889-@\x18\x1e\xad;\xee\xb5ti\x08w\x85\"\xb2\x10jG\x81\x91F\xb7\xc94\xd2\xc3\x81\xe89\x86\xe9V#\xd11?&'\xae \x14j\x9beG\xec\xa0=Zz\xbd\xcc\xeev\x0b%B\x89\xe8j\xb9+\xda\x9d~|\xe2y\xe9\xea$I\xca\xc0\x83>\x04k\x04E\xcc\xf7\x1d8\xea6\x8c\xaaW\x9bMH\xa5F\x12\xed6\x17W\xe2\x11\x16\xc5\x1b8|\x14\xb1\x82\xd0\x82N\xd4<\xe2\xf1\x92\x858w:\xbd\xaf\x98\xef\x97T\xe3\xacK\x80\xa9\xdb\xa1\x03\xb8g\xda\xb4\xcbz\xd7F\xda\xcfN'[r\xa7\xf1O&\xa0\xaf\x82\xbaj\xda\x1a\xdb\xbe\x80\x85a\xa7\x89\xc6Nl\xf5\xa8h\x9d\xc7\x9f\xcaL\xba5\x9bJJx\xf0i\x00e\x0d\xf4\xb9W\x872\x7f\xa7\xc2\x88\xef\x15$Ha\xcc\x8b\xb2\xcaV\x1f\xc3\xe4\xc4\xd7\xe2\x98\x94\x85\n#\\\x1c|%\xb3\x1c\x98>I@\xbc\xa7{\x10\xb7	\xe5\x10\xbe\xbe\x9c\xbeU\xafP\x0fIH\xee\x11*\xa1\xa4\x8d\xb197I\xd5Z\xb9\xb2l\xad\xb9\xce\x86\xe8<\x90l\x88\x9e\x83\x88\x0dm\xb7\x0e=\x80m9q\x99\xbf\x97\x1f\x9dcb+\x1b4\x979jPj\xecJzwCwYG\xf6\xcc]Rl5\xb4\xdb\xd5\xdah&\xf0>\x84L'\xd0+6\x97\xdc3K\xeb-\xf5\xca\xcd#$a\xe2\xde\xb2]\xc0y\xcc=\xbd\xe0\xde\xf2\xc4\xafJ\x1f\x08c\n\xd0\x90<\x9dvL\x8cc6\xcb\xe6r\xe9\x9a\x8a\xa6\xc2\n\x7f\xce\xd5\xbf\xa96\xec\xb4$Q@&P\xdb\xec\xa0\xd8\xac\xf9\x19\xb0!\xb6\"\x80\xbf;\xed\x1a\xc7/\x8c\x99'C=L\x16&s\x05\xaf\xa3\n^X\xe8D\x08\x91\xcd\x12\xb2E\xe0\xf3t	\xde\x80F\x05\xa7/vb'\xd6\xb6~\xe2\xe6\xa7\xb3\xb6VMF\x0c\x84\x14\xeb\x96\xe9l\xa4\xd3k\x06\x13T\xb1\x86\xb7\x92\xd9\x04	=\x88X7MCM\xba!d\xbd1\x0e\xaa\xf3\xcdR\xa4\xf3\xcd\x92@\x0cNdv\xd0m*\x0e\xf6\xd4\x80Y3 \xdc}v\xef\x12\xef\xc4c\x8b\x9fHp\x1a\xdf\x1bp</\x8fE\xa2\xf2\xd1yy.q\xbb\x12\xd5\x9b\x81\xcf13\xc8N\xfc}\x17\xec\x1d\xe2\x7f\xeb\xc8\xb2l\"(\x13\x05\xab\xd1fS\x0d\xe6\xbf\x9b\xcc2\xc3*\xd9\x1c>fa\xc47f\xcf0\xcf\xe0\x1e\xde\x92\xad)\xaa\xeb\x97c\x13!\xc8\x8e\xfe\x85\x1eb~s\x93\xd6\xf5\xc6B\x0b\xf5\xb3\xe1\x91\xb1\xf5\x8c\xc4\x95J\\\xdb\xb56B(\xa5\x0d\xef\x10\" \x15	\xb4\xc9|#\x92[\x01\x92\xe4\x0cb\xa5\xddm\xc4\x85pN!\x14\xe4\x9b\x06\x12\x88\x07M\xee&\xec\xd8\x91aAp\xa5\xc5W\xb6\xe4Y\xebn\x16\x9b\xb9_\xf6T\xe4 \xa27\xf6@l!>\x0fon\xd2\xe9\xf5% 0\x86\xf4F\xfa\xfeyv2\x9b\xcb%\xb4\xe4\x16\x18\xee\xc1\xcb41\x19Z\xf2\xcf\xdc\x02\xbc\xa1F[\x8a\x95\x97|w\x19n\x82\\\xd7\xf8[q\xa1I\x9c\xee\x86\x07\xd7n\xda#\x1e\x11\xc2j\x8f{\x95\xc7\xf8\xceqn\xf3z\xbd\xdem\x9e\x15\xf7\xa3\xbb[r\xeb\xb8\xbb\x1d\x99\xbf\xb2\xb7\xde\xab\x95x2\x92Oz\xe4B(\x9eT\xe5.\x9c\xec>LWP\xe4\x85\xb0\x0b\x9e\x96;\x19g\xd5\xc7p\xf8\xe5\x97\xd3'w\xf2v$\xefn\xc9q\x89|\xc0\xc4\x13\xebV\xf6dt\xe7\xf1D\xec\x1eQ/<\xa5\x0b\xeb\xb1\\I\xce$\xd8n\xa3\xb6\xd0\xc7\x81.x\xc3\x81\x9f\xa6\xe9\xe5\x1ai\xfb#\x0f\xb4z\xda\xf1C\xb9(i\x1c\xa7\x18\xfcrv\x9f\xf6\xa4\x03\x96\x8e\xc41W\x12w\xeb\xdf\xd6Y\xa5\x0e;\x19\xabp\xe7x\x056\x8aE!\xc4\xe7\x9c\xfcZ\xc2\xfec\x0d\x1b\xb7\x17{P\x10\x86\xe3\x95\xdag2\x87!Z\xff\xd1j\xd8\xb6\xb6\x16mQ8\xaa\xca\x9dq\xbcU]\xf3y\x8f\n`\x86\xd8\xd6\x1f\xcb\xfd\x96\xdaO\xc2\xf3r\xc8\xf6\xc0,x#\xe9q\xbb\xbf\xa37\xe3\xe1\x97_6MScC\x93\xc9x|8\xbc$\x98\xe8\xf7m\x9eM\xe2\x04\x01?\x15af\xdc\xb8 \xe1*\xd0p\xeb\x91\xb66\x06a*\x81\xb9\xdc+g\xd8\xe1n\xd8\x80/T\xb7\x95\xc7U\x11\x03\xb4\xc2~\xffb\x17W\xe5~\xeb\xb1\xa1)A\x0b\xf9\xe5\xd79\x08\x9b\x8b\xa2\x85|\xe71m\xa0	\x13L\x18v\xb4\xfew\xe8\xe96,\xe4\xbb\xbb\xdb\x11\xfd\xf1 \xbc\xd9f\xd5W\x0fQ\x94\xabC\xd8\x1fsm\x1a\xe0$\xac\xca\xf8\xe1\x90\x15M\xca\x84k\x8f\xaeo\xb4c\x1a\xea\x14%\x8d\x86\xd8n|gE\x9e\x15\xea+\\6?*\x95\x1c\xbe\x97\x1f\xcb\x87*\xecO\xf8a\xbd\xcf\x8a\xfb\xbf\xed\xe5\x8er\xa9\xb9\xbd\xca3\x1c\xcd\x1f\xc8\xb1\xf8/\xf0jF#\xbb\xec\x83\xcauZ\x08e\xee\xaa	\xf4\"\xa2\xf6g<\x047.+D\x80\xc1\x16|\xfd\xea\xd5\xe4kJ\xf1x\xd6x\xe2\xf5\xc7\x1cNH4J\xeb\xeb\x99\x9d\xad\x92)\xcbS{\xfd\x99j\xe5\xaez\xd1$\xac\x9bLR\x81\xea\x95\xe8\xed\x08|\x8c&r\xcf\x8e\xd1\xb0\xb3D\xa2?9\xf5w\x17\xb2\x0bp\x0e\x1d\xa9\x03\x1d4eE\x10\x9dL\"\x8e\xf3,\xbe\xf7Z\x12\x8b\x1d\x9b9Q\x1dt\x03,\xd8\x9dV\xd3d\xdb\x04a\x83\x0b\xc8\xb1\x0e\xb5\x16\x9e\x01\x93\xd9\x19\xca\x05\xf8y\xdc\xba\xcf\xc2\xd9\x10N\x9a\xe4D)\x9csp\xa5\xa6Y]\x8f7\xbf\xd8E\x99\xc2\xc5\xe5.Z\xcb\x18\xdf\x88\xf8Q\xb78\xbe\xe9\x94\xde\x0dsi\x9c\x981D\xea\x8fv^l\xce\xb7\xbc\xf3\xd5\xd4j@\xa1\x0df\xd4\x80\x8c\xc9\xd9\x18I\x13\xf5B\xe3k\x8a\xd2\x10\xe8\x0e\xef\xec \x03iW\xf4\xb2\xe2\xa8\x8f\\81G-\x9c\xd8#\x16NNlKXdP\xf0RlA\x07\xeexY\xd7\xc1\xd9\xd5\xb7\xe5F\xdf?\xf5\x18/\x85\x91\xb1\xef\xe6\xdb\xa5+\xa9a<\x9a\x17\x03\xcf\x1c\\o)\xcaiw\xd8;,k*\xd6b'2\xa2^\xf9\xca\xa5\n\x9b8\x18\xe6\xda&1\x13\x7f\xcb\xf7\xfc\xc0+\xfe \xe2G\xee\x93\xc6Kr\xda\x7f\xa8\xeb`+&\xbcj\xfc\xe6\xc3\xf1T\x07\x10\x08\xc7S\x1d\x07 \xf4\xf8^x\xbb\xf2\x90\x81p\x0cet(\xf3\x87JMq)\x8f\xa7\xb8\x8c\xc3\xf1\x94\xc2\x1b\xd0\x1d\xadCM\xd1O\x8f\x1fD5\xf0\xc6\xd3w\xd9!\x8b\xb2\x1c\xf7\xf5:K\x12UL=^@\xffB\xb7\xbb7\xd8\x0f\xaa\x81\xf7\xe5\xeeC\xefP\xc2\x16\xe2\x0f\xe3\xf1x\xea\xf1\xb7\xc2\xbbM\xb2w=oP\x0clH\xa70\x02Z\x9a>\xb9\xa3\x9c\xa6\x01\xea\xa5[\xa4|\xa7\xf6\xab\xbc|o{|rw;J\xb2w\xe6\x7fo\xe0i\xbaC\xb7\xfe\xa4\x17\xab<7K \x9e\x8c\xf57\xaeW\xf3\xad+\xec\xefn\xab\x04\x94\n\xfd\xb7oh\x16P\x18\x17\xe7U\x13JI{-\xbd\x86\xbd\xf8a\xe0\xe9\xb5\x1a\xdb\x95\x1aO\x9b\xb5\x05\x9b\x9b\xc5fe\xf56\xdc\xe0\xc3\x1bl)\xba\x00\x7f\x18f\xc5A\xed\xab\xaf\xd4\xaa\xdc\xc3~\xfa\xc1\xb9\xfb\xd9\xe3\xe4Zr\x06\xfd]Z\xccR`\x98Q\x95<\xb2\xaa\x08G\xf6\xc4\xcc\xbdJ\xee\xaak\xabp\xff(\x0dS\xc1\xf7\xb9\x14\xf7\xf3\xf1\xb2\x13\x1e\x03\xcaDN\xa9\xd4\xeb\xd0\xec\xa1\xf0<~?\x9f\\\xa4b\x10\x1e\xd0\x9a\xb9\x92\xbe%h\xfa\x89\xe2m\x1cD\xe9\xfb\xd7;\x90 5p\xeb<T*y\x85&}?\xe8\x90\xa3\x1e\xcf\x1f[\xbb\xdc\x0c\x82\xb6Mxc\xafI\xd9\xb6\x17\"\xa5\xef\xba%\x9fa\xc7v\x9d\x95\xcf\x993x\xe7>\x15\xdaP\xed\xbb\xa2\n\x82\xcb\xc1\x069y\xb0\xb0\xba>:]\x86\xe3\x13s\x87\xc0'cD\xc1\x00\x055n\xcc\x7f\xed\x90~-\xcbm'x\xc1\xe5\x02tGo\xbf\xec\x99\xf0&z6z\x86\x1a3\x88qS\xc9\x9e6\xe1\xe9\xe3\xd6\x16m\xf6N\x13\x1dm\x06\x86$&\x14\xf2\xe2\x1a5\"v\x06P(>\x07\x91\xb3\x17M\x122\xf0\xae\x0c\x82\x10NN\x9d9stq\x06\xedf\xf8\xe5\xeeC\x83\x18\x00W\xe7\xe4Ow\x10}!>gMo\xf6D\xef\x07\x87N7o\x89\xa1h\x8f%\x87e\xb3\xf3\x99	5,\xd4\x87\xeaU\x16\xe5Y\x91:Yn\xa9\x0d$c\xea\xf0cY=O\x12\x1d\xd1/L\xcd`^\x97\xbb\xbe\x10_\xf2\xa4T\x87&\xf7e\xb9\x7f\x8d#\xf1\xbcH\xbe\x06\xee\n\xb3\xb6\xb4\x10\xe2\xcb\x13O\xcd\xc0-\xba\x813\xc5\x07\x95xMFU\xee\x84\xf7l\x8c\x8d\xde\x0c)\xefg[\xd4\xe9Z\x08\xf1l\\\xd7\xdd\x94\xc9\x97\x97\xcd\xdb\x04j\xd6\xe3\x0d\xf1~\x01*\xeab`{\x95K\xc4\xb2\xf3\xf8fxx\x88\xaa\xbd\x8c\xabC3\xcf\x9fL\x0b?\x96\xd5_\xf5F\x9f\x8d\xef\xe6K\xbe\x19\x9a\xe5\xfb\xae\x88\xf3\x87\xc4\x1c\xb6\xef\x8a\xaf\xca\xe4\xa3\xc6\x17\xe2\xa1\xad\xd3\x17b\xfb\x18\x96\xd0c\xd3\x07\x0d\xcd{\x93\x7f\x03\xa88\xe4\xaf\xb8vfwgg\xf6u\xb9sN\xac\xdeB4\xd5\x1c\xd5\xe4\x13G\xd5\xcd\x13\x13\xc6\x1f:tB\x82\x00O;\x91\x18\x1a\xc1\n}#\xbeq\xf5Y\xd1\xc9\xe8\xa1\x11&)\x98\x85\x8b\xe3\xf0\xe9\xe2T/\xe6\xc3\xa7\x8b%\xfb\x8c\xbcX\x83\xf9\xf3\x9b\xff\xb3d\xa3\xd4\x11\x1d\x93c\x19L\xea\x1f`W1\xe6&\xe0E\xe8icwo\x10\xac\xa0]\xdd\xbc}P\xfb\x8f\x032\xf5\xd9\xa3\xc06`\xad\x19\xd4h\xf1b\x94r\xcfc\xbc(\xe1E\x1e\x1e\xd56R	\xf8\x08\xad\x02\x0d\xbd8?dI\xf8\xe2\xd9\xff\xfe\xfa\xc5W\xff\xfe\xcd\xcd\xf3o\xfe\xfd\xc5\xcdd\x12\xafn\xfe\xf8\xef_\xfd\xc7\xcd\x17_|\xf1\xe5\x97\x9f\x7f\xf9\xc5x<\x1e{\x1c\xd2U\x05.\x84\xb4\x17\xd4`C\x18\x19\xfd\xbbe\x84\xc9& ^\xab\xb9\x9c7\xc1:\x96\xcb\xd0\xfd22\x92~_\xfa~\x1f\x82\xb1\x13O\xbaM\xc2\xae\x06Q\xd2 	\xe8\xaf\xc8&bWu\x02o\x18\"L4\xad\xf2{qij\xc2sgd|+r;\xbaP\xf2B\xe439\xdf`h\x9b\xa5\xefox)\xc8\x91\x9f\x02k\x1c<\x10\xacA\xbf\xa8\xeb\xfev^\xc0\x81\xb1\x84?\x07\x06</\x96C\x8c\x97\xf9\xfe\xbd\xef\xc3\x16\xcc\xda\xc0N\x8b\xba\x0et\xab\xa2\x10\x83\xc1jH{X\x88\x0d\xe3\xa8\x06\xeao^\x90\x97xn~\x0f\xb5\xd3=\x85\x9c,w\xcc\xf5}\x8f[\x1b\x91\xbav\xd2\xec\xca{L\xcd\xd0D\x1b\xe3\x03_<fa3\xc4n\x16\x8d\x1a&c\xa0qQ\x86\xab\xba6\x81B\x9a\x1f\xe4\x9f\x82(^He<1\x1e\x1c\xeb\xf9j\xd8\x98]\x061[\x8a\x84\xc6\x8aUY\xcfc\xab\x93\xea5\xc1N\xeegA&\x90\xc33a\xad\x8a2q\xd1\x0cca&\xd6Vj\x96\x9d\xacZ\xef\x0c\xc6\x8c\x02\xe1Qp0\xe24\x07\x1c2w\xe77\"sv\xfe^d3\x04#\x0b\xd7\x98A\x7f\x03\xa7N\xb3\x81P\xfa\xb1c\"\xe2\x19RC\xfcG\x0bal3\xdd\xc8~u\x1dP\xb8\x85d\x16\x89y\xb4\x0c\x83H\xb8sCt)7;\x12\x91c\x9a\xc0\xb4\xbf\x8f\"\x83\xb4F\x0bm\xe3\xab\x196:\x99Gs\xb5\xd4\xf2\xb0 \x9em)\x9a\x81c\xfd\xcd\xda\xf0^'2\xa0\x8a\x9b\xe82\x9d\x81\xf7\xb7\x01\xbe\x9b\xb2m\xa8\xd8\x8e\xe4\xa2\xae\xfb\x1b\xf0U\xdf\x15\x95\xda\xbf\x93\xf9\xcci\x8bV\x82\xb6\x91g0\x05\xb9\xde\x82\xadA\x8b+\x0d\xcel\xd8\xb4\xd9EJ\xb0f!\xcaR\xc3pJ\xf9\xe5\x1c\x0ft\xd54&(C\xc4cN\x0e:-^\xb8P?4V\xbc\xad\xdaMc\xc2y\xc7\xa8\xd7\xb1\xfd\xa0un\xac\xd9#\xa3\x84\x96gR3\x92Re		\xcel@\x88\xfeX\x0b{\x1bG\xb4\xe0x\x81\xcf\xcel\x10\xf8\xc6\xba\x84\x93~\x7fK+05\xeeE\xc6\xda\xbe\xf5\x0ce\xc7\xad0\xb3\xdf\xd0\xa9\xdb4\xa0\x8d\xb8(N\x00\x91\x0d\"\xd5\xed\x0f*\xc1\xaa\x1f<\xc6\x8e\xa9\xd8\x0ce\x13\xb4\x8a\xa0.\x13\xa9\x85\xb8\xfb\xdblzO\x11\xfdR@\x0c$\x0e|\xdd\x1aE\xa1\xcd\x1b\x9a+\xf4\xf1\xeb\x0e\x80\xdb8\x7fY\x91\x06_2\xc6\xf3`\xc3\xd7|\x8b\x90\xael\xfa\xc8xh\xdb\xcc\xaa\xf5\xb6\xa7\x16\xd7\xc9\x16\xd7\xd9\x1d\xa0\xf9\x93\x06\xaeYG\xe8\xe4\xa8Y\xeb7\x0d\xebW\x1bi\xc3\x1bz\xb0\x08L\xe6\x13\xc4.\x9d,g\xf02\xc5\x17|\x80\x15%\x0d\xbc\xbegQ\xcd\xcaZ\xdau}\x1e5\x96\xc1E\x10a\xd5\x91i]\xa9\xbe\xa5xM\xfb\xc0K\x15\xddE\xde@\xf1y2\x1f/\x97\x8coQ\xc1\xf7\xe1\xd3\xd7n\x15\x97\xc8\xc0\xbaH\xbem5\xd3\xa6,\x06\xa4]MiJh\x88\x85\xdb\x13\x92\x8d\x8b\xff\xc5\xec\x0d$\xd3\x90\xd94\xba\x18\xd8\xa1\x1dX\xc2xg\xadx\xcc\xf8e\x05-qi\xeb\x9c`\x1e\x0f\xdb\xc5\xb8U\xa4\x1aP\xb9\x9b\x10\x81\x05\x07\xabGp4;~z\xe7\xdaJ\xed\xfe\xe9\x83c\x08\xa8\xe3/\x08\xa2\xe3\x1ceXmID\x06\x13AT\xd7\xde\xea\x03\xc2W\xa3\x8c\xc7\xdb\x889\x11\x0f\x9c\x0fb\xc9\x06\x13\xd8\xa2\xfc\xf2P\\\xb4\x87\x83h\xbd\xebL\x9cL\xd8\x9f\xc2kL\xa3\xfeX\xc4\xba'\x1389\xb6\x1d*!g\xe3\xb0\xe9*\xe2\x88\xa08a7\x93)H\x9e&\x11a\\\xbb\xf1{\"\x13\xbf\x87\"vr\xdd\x1abpq\x8a'\xd4\x99m\xc7\xe8[\xb2cg\xde&PQ\xe2D'\x8a\x18\x99\xf1@Y\xd2\xdeL1\x9bu\xca\xf0\x95\xe3 \x0f\x0d\x97\xb1\xa2pl%\x92\xba\x9e/O'\x9e\xa8\xcb1a\x14f\xf1\x8d\xb9\xd5\na\xf8\x1e\x10!,b$\x88\xb1VA\x88\xee:ML\xd49\xa3\x0f\x07\xe3\xeb\x94a\x1c\x16\x1d\xda\xb3\xfc\x83\x87\x00\x176j\xaa[\x87\xb9\xdb;\xf0\x86\xfb\x87\xc2\xe3\nb\x15k\xa0j\x17\x8d0\x82j\xc7s\xe2\x8a\xc1\"\xc7*\x8e\xceC)\xd9\x80O\xda\x02P7\xac7\x07$\x86Yc\xc6.\xf0\xf9\xc5\xba\xd8\x9d\x12\xcf\xac\xaf\xb0l\xdd\x84\x08\xb6\x00WX5\x9e\xdc\xdc\x10\xd2>?Q\xb7\x89EuvE\xed\x95\xd0z\x80\x11\"\",\x11~\n#8\xf5\xb5S\x80lV\x18\xd6\x06\xfd\xf3-i\x17\xad=\x89Wv\xff\xb7N\xf4\xd5F\xf23O\x06v\x04\x19\xba\xfa0[\x0dW\x1f\x86\x87\x1d\x14 d\xc4'C\xc9[\xd8r{\xa2qtC&7\xeb\xedx\xd0F\\\xb2iLfn\xae\x82\x95\"<Z\xf7\xd3\x04{y\xe2\x94\xf6_\x9f\x9c\x9e\x01\"=\x1c>_^\xb5m\xc08\xecWo\x1b\xb0\xe3\xcd\xcd\x1avI\xae6X\x91O\xee\xe9\x13`\x11!\x86\x88\xec\xe0\x99\x8e\xf6[\xdb\xf4\x92 \xc3\xea\n\xc5\x04\x14m\x13\xbal#\xa4\x81dH\x01\xa5ER\xb9\x89\xd7\x9d\xde\xdc\xc0~-\xb7W\x91\x82\x89\x7f\xc6#\xc0:\x1d\x8a6ucS\xdd\xa2\xf7:\x91\xf9\xbe\x9b\x9a\xf1O\x98'\xa1\xf8z0\xe09\xf4:\xc1\x96M\xb7\xad\xf9Wb5\xf4\x14\xe4Ws\xc5\xa5\x18\xcd\x17\xc5\xa2Z\xec\x97:\xcc\x12\x05tz+F\x8b\xbd\x0e\x8c\x04\x9e9z\xa8\xaa\xb2\xa8I\x15\xc3>\x1be\xfcp\x99^k\xba\xa1\xd6\xaa\xc5\xda\xc6\xb8\xa4\xe2\x95\x18\xbd\x91\xc1,\xdc+\xc9fHx\xd0\xf5\xe5CU\x92\x92\xa1\xc6\xaf].?\xd6\xe4RW\x1b}F\x0d\x17\xfa}\x99\x1fj\n\x15W[%W\xadE(u^\x96\xbbz\xfb\x90W\xd9.Wu\xb9SE\x0d\x93\xd8\xb2\xc8?\xd6{\xf5\xf6\x01fQ\xf5!.w*1\xe3R	\x0d\xe8\x9dhI\xe73\x15(\x7f\xcf?\xf0\x8f\xd3\x0e\xda\x01\xe1vv\x98\xae\x93/D\xe2!,\xc6\x95{\xbb\xb9\xaf\x9fw[\xfb}\xf75*\xb9Xb\xb7w\x9d\xfc\xba\xc1#;\x14\x15\xf6|\xf7[C\xfa\xb9\xdb\x9a\xc6\x15\xa8\xf82\xfb\xa0\x91\xc4\xf4S\x83\x84\xce\xd1\x84L\x11\x91\xd1\xc3\xf6L\x82Q?\xc6x{\x01&\xe9I\xf25hwg\xec\xd6\x16\xc3\x04\xf1\x84D\xe1\"`v\x1b\xbb\xe6\n\xfe\x8d\xd8\xd1\x10cC\xdb|`\x0c\x83P\x9aG&v\x8d\xd5l\x93x\x08D\xbe\xef_\x0b\xc3\x145\xb4\xec\xce\x8d\x18\xe70\x02\x8d\x03\xd7Q\xa3\x08\x13\xf6\xa1\x1b&\x11'\xbf\xaf\xda^\x11\xe2\xd6\xbae\x89	sr\x84$\xdb\xacc*\x10\x19\xdf\xc9@\xa4|\x1a\xc1Z\x8cy\xd62\xa8\xeb\xdbl\xba\x1e\x0c\xd8?\xd3\x96G\xc0U:_\xd3\x83	\xc0-\xe9@4\x9fS\xb7\xaf\x15\xa8\xcf-\xcc\xa1\xcf\xeca\x8dh\xed\xea\xe68[\xc37\xff\xe3\xcdqz\xf8\x9f\xefO]\xe3R%\x121\x00\xee\xf6Xw\xb3\xb4\x99\xb1\xbbY\xd6\xc8\xf8\x98R\xf2<!\x163\xedl\x96\xef\xa7\xed\x1aa\xe7$;\xae\x05d\x04\x03'\x83\x16\xb7\x11\xee\x95\x1c\x9f\x86\x95\x83\xb1xc1l\xbd\xc1 \xbf\xb1\xa5\xd1T<\xcfhGt\xc5\xf4rW\xd6\xc6\xbc\xc9\xcd\xf2\xbc\xb3\x8d\xaa\xca4\xcd/6\xaau\xab\xb47\x1e`\xd6\xb8\x8a;\xf1S\xfe\xb5\xdd\x8b\xdb\xdds\xba\xed\xec\x9ea\x92\x9a\x01\x83\x1c\x8d\x1c\x01\xecU\x82\xc90wvSM\xb8J\xe3\xa2kz\x04\xc4\xe3\x86m\xf7W\xdf\xaaJl\xb4\x97k&\x92Y\x16\xf6\x11\xc2\xf7\xa0\xc7\xa5\x18_\xcf\xb3\x99g\xd1\x80\x17z\x0e\xd0y\xcb@\x99\x05\xb6\xfd\xb7\xe2f\x13\x9b\xd9.\x13\xebN\n7\xf0/-\x1f\xe7\xfd\xf2K\x93\xf5\xcb/\xde\xd9\n\xb0\xb3o\x13\xcf\xc9V\xd0\x10\xdc\x9f\xc0\xdb\xf6S\xad\"n\xbf\x07\x9ci\xa7w\x893	aH\x02\xa9K$u\xeejj0\xd5\x19\xdc\x13`\xda\xacOBz\x83k\"vw31\xf8\xb8	\x97	\xeb\xf7\x8e\x83y\x17uX9\xcb\x14[\xdf\xef\x9f\xdfE\xc0\xa4]\x9b\xc4O\xc1\x8fq\xe9N\x1bH!	\"~v&\xc7\x8ej\xb6\x16\xeeM\x003\x9aw2\x0f\x18\xdcG$7~\xc5\xb3\xb5\xf0<\x1b\xfd\xdcq\x9a\x9d\xad\x07\xc8hy:\xb8\xe0\x93\xf8e+w\xc1\x9a_\xb9\xc3\x1dGj\xb8G\x9f\xc0\x05\x89\x15\xfa\xfc\xb6,\xefM\x9c1\xf4\xb4\xac\xeb\xf3\xe4O\xc8\xc3\xfaq]\xf7I\xb0\xe0\xd1\xbb\x1ex\x80\xe3\xa0*=\xa95\xf7\xc8\xd4\x8b\x04D\x91\x06\\J\x10k\x10\xdd\xd9\nQ\x08:\xa3H\xaf\x0c!\xfdT\xff\xb1\xef{\xa9\xe9\xdcp\x92\xa9\xaa\x82\xb4\xe9\x19\x81>\x1a\xa1]2MD\x8a\x96\x1fT\xb3\x89\x17qdgI\x03^\x14@\"4\xfe\x9a8\x15\xc9\xe9\xd4\x95H\xd8\x85\n\x8f\xdar0<\x9e\xc7y3\x1em\x8e\x8c\xad3\x80~T\xd7\x10\xfc\xaa8[e*\x99\x99\xe0\xe6\xa1\x8e\x9d~\xb2\x91\xea\x1ei\xd7\x92&M8<\x95|\x87(\x96\xd6\xd5X\xc2\x1a\x0b\xef\xaf\x10\xba\xb2\xd1\xfcu\xd1\x1b\xe8\xee\xb1\x86\xe9\xad\x8d\x1c\xa4cV\xc4b3KCx\x9alf\xe9`\x12fW\xcf\xedQ\x07\x1eG\x03\xaa\xe9\xbc#\xfau\x0c\xc1f}\xd5\x18\x82]\x18\x1a\xda\x0c\x02\x13\x8c\x00\xc0\xdcWNL\xc3\xa6.\xc5O\xb6\xe0\x10\xb8E8L7\xd3}\xf9\xb0\x83\xf0\xfc\x18\x89U\xa0\x18\xd6R\x9b\x07o\xec\x0c\xa3\xe9Z\x8b7`\xb3\x8c\x0c\xe8'\xcc\x04}\xdfN\xd5\x96^\x05\xd9<]\xdavL\xe2\x1a\x9bR]\xbd\xe1\\QJ\xc4\xa6+\xf2e@\xd4\xc3\xc6\xb0\xf4\x92Dm\x03\xe4)\xc8e\x8c\xb3\x7f`0\x88\xee\x9a\xc7\x08\x93}\xeaH.\xce\xb6\\\xdc4!x{\xf1\xe9t\xe2\x00\xb8\x97E\x08\x10\x85Z/>\x90u\"l!\xf1\x17l\x10\xfe\x02\xc9\xe3\xef{z+\xa5?\xe6\xc6\n\x06\x8a@R\xcb\x92R\xef\x9c\xcf0\xea7\x1b\xef\x14\xe2\xeaV\x9b\x02\x90 \xdd\x1dl\xa1?\xd7\x7f\xfeC\xffyF\xd2S\xe5\xfb\x14]@s%/\x8bv\xb5%\x9b\xc7\xcb q\xb5\\]\x01{\xe7fl\xea\x11G`\xa21O3\x81~'\x04*\xd9\xe1\xef?|\xff\xa2D\xf8Q\xd2K\xc4\"\xee\"1\xf2\xe4\xc3\xec\xe8\x14\xcfc\xa8\xe0\x1e\xc8:1\x88\xd9\xecC\xf8^k\xdcH\xcb\xd5\x04\xb5&\x18\xed2@`\xfc\xcd\xea\x03\xaa\xd6\xbeoq\"\xa0\nQN\x05\x8c[\x11\xe98\xe1q\x17+\xa5S\xd95W\x8b\xb9\xe7\x0d\x92f7\x13\xdbbz\xd1\"p\x9d4\xed\xd1\xa8L\x95t\x9a\x8a\xee\xc29\x1e4\xa99f\xb3(LO\x8f\xf0~<\xba\xa0\xafu \x87+\x01\xbd\x1f{+h\x07wMk\xa3m\x1fTJ\x89\xfe\x84\xb8=[r(\xf4c\x87\xa1\xc3\xe5\xa3\xf8Z\x98\x1d\x00\xd1\x84\xab\x00\xfb\x83`\xea\xc0\xc6\xfcRI\xf4n\xa6\xc2\x98\xf1\xb5\x81*\x08\x84\x11:\x00B[f\xce\x01\xednx\x04\x02\x0c\x8f\x97\x877[\x05{\xf3\xd6V\x83]\x18&\xda\xe2\x17\xd6\xbc\xd8\x86Fz;\x13\x8d\xb8\x17\xcb\xe2I\xd5\x8bTO\x8b\xca\x13\xaf\x0d/\xd6oY\xf9\xd6\xec\xd3\xf7I\xb8I	\x14y\xdd\xf6\x87\x07\x15\x8cI\xa9\xa1O\xec\xd3\x17Sy\xd5\xaa\xd4\x08wM!\xd1\xeeo\x84\xd3O5\xcfo\x0d3\xd7\xf7\xe7\xfdjqI\x13\x84\xaa\xf7\xde\x00V\xd4\xb6I+\xdb\xdcN\x00\x9fK,\xc8\xe3\xdf\xdb<H\x04]aj\x9a\x144j\xc3\xd9\x87\xc7JFD\xd4\x85^%#\xba\xd2<n%( \x9de\xf2S\x91\x7f\xf48L\xbd\xbd\xd0\x03V{Y\xeea-\x0bB\xd1\x0b]g\x87\xad\xfc\xa0\xf1{\xe8m\xe5\x87\xef\xe9\xa7\xc7\x1d\x83\xc2\xd0\xc3\xc7+m]\xa8s\x8c\x99\x95\xce\xf9\xd9<a\xc4\xf7\xe5\xfb\xc3N\x16\xa1\xb7/\xdf\xbf\xda\xc9\xc2\xe3q\x89F\x8a\xd0\x8bK4Px\xfc\xe1\xa0\x10\x03\xc4{8\xa8\x1f\xe4\xce\xe3\x14\xfe\xcdZn:\xef\x81\xa2.E\xb0SIF\xf6z\xa1}\x05\xef\x1b\x93\xe0]\nS\x9ap\"FMx\x0d\xebf\x1a\xeb\xe2\xcf\x7f\xe8\xafg`\x19\xb3\xabHq}v\x02\x81\x00cD\xcd\xa0\x14\x8b\x14\x1b0 <8K[\xec\x86\x00\xce\xb0\xf69Cm3\x15\xd2\x11L\xc2\xb4\xc5[\xb6\xec9\xd22\x85\xcd\xf6\xdb\xa3j\xb6\xfd:\xe1\x13\x9fa7\x9c\xd0\xc0\xb3@\xd3\x06\x8c\x8d\xa1Ah\x89\xab\xc6\xa8/\xd6@\x07\x13\xbd\xf0pq\xf2\xeb\xba\xba\x8a\x0d\xe0\x111\x1b\x87\x91%\x02\x9b{ch{v\xd7mh\xa7\xc0?\x88\xb3I4\xd2j\xaeL\x0d\xf7\x02\xe9\x01\xaf\xf6\xc7\x8dM\x87\xea\xb7\xdc\x1f\xd1\xb8W\xe6\x1eC\x16\xab\xbdM\xc8\xba\x1c*\xac\xc9\xec\xec\xb2\x0b\xa3\xebg\x16+\x9a\xd0[T\xfd\xc9\xec\xe2ZC\xdc\xb1s\x00IZD\x9b,)<\xc1\xc5\x15v\xd6w\xabL\x8a\x81\x9d\xea:\xf8(\x8eP'\x83\xd2\xc8\xc8\xf0(.\xcb}\x02\"\xe5\xc4\xdf;L\xc1Pc\xa7G\xd7p\xfa\xc8\x82\xd8\xfe@\x94~\x9c\xc7\xcbYwy@\xcd\xb7\xa0\xc1\xdc\xdc\xab\xebd\x0f\xde\xb5\xce\xf0B\"\xbd^hMV\xdb\x85H\xce\x97\x86*\xa8v9T\xdb/\x9e\x18A\x80\x90k\x90\x856\xc4{\xfc\xcf\x8d\xdf\xe9\xdc\xbca\xc7=M\xb2\xc1\xed\xb4s\xab9\xcd\xc0\x99\xb21\xf5\xe9\xa6\xf3\xf3\xfb\xb0\xd5p\xe3\x99\xe3\xb3}\x8d\xb8\x07\x89\xb8s\xc2p\x16\xceN\xc3\x19b\xd3;Gw\xcaU\xf0\x03\xe0y\x80\xec\xc8F\xacc\xdc\xbd\":\x9er\xc3\xae\xd7R]7\xab\x81\x0c\x8f{\x87}\xec\xf1O.M\xdc]\x9a\xf8\x91\xa5\x89\x97\xfc\x0c\xe4\xccI9\x83\x80 \xe6\xcf\x9a\xe5\xb0\xe4\xe1,\x02\xaf\xc8:#'s\xc2\xbav\xd7_\xa7\x9d\x83v#x\x97]\xd3\xd6\xee\x89\xaa\xeb+`\xfaXU\xe1y\x83\xa8\xbb\x90\x8e\xe3\x15\x0d\xaaA\xf8\x0d_\xe1\xae\xcbe\xee\xf5\xd5\x89\x84K5Ma\x1a\xd6>B\xa6\xd1a\xe4\x14\xf0}\xf7\xab[\xb0YT\\\x12'H,Z\x82\xca\xb8v5\x03\x7f\x99}\xb0i\xc2SE\\\xe2\xf6\xf6\xdc\x1a\xc6\xfd\xcc\x01\x18M\x83\x19\x07\x1b\xbcx\xe7\x1c \x80HG\x08\xb2\xfc\xc4&u\xe8l+x\xb0\x80\x00\xf7\x94\xd0\x109Vx\xf0?\xea\xdf\xd9\x8cn\xce\xc5	\xd6T^+\x1dj\xdfoj\x1eb\xeb0\x9a\xd2r\x99\x11q\x99\x00[R\xc1\xfd\xaa\x95aVcf\xd4iz\x8fH[\xf5\x1c\x05\xe6o\x16\xc3\xa5~\xd9d1\x0c\x86\x03F/\xaa|e\x9e4Y\x1c\xd8\x1a\x16\xc6\xc1b\xb8x5`\xb3E4\xe2_\x8b\xd1\x9b{\xf5q\xc4_\xa0\xfe,\xdc\x96\x0f\x07U\x9b\xb0\xf2[U<\xb0\x9a|\xb7F\xfc\x1b]\xc0\xf8\xfb\xd0\x9f\x9a\xfe/\x1f\xaa(\x7f\xd8\xc3L\xf6%\xca,\xde?\xc5[&\xf65\x18\x0cB\x8f\xa7\xfd\xfel\xc4\xff\xd4\xaa\x81\xff\x979\xcd\x91xi\x039i`\x85yM`\xe37\x9d=F\xc4\xa3\xf9\xe7K\x81\xff|\x1f\xf1\x99td\xa1\xc0\xa3\xc7[\x16\x8b\x03\x83\xaa\xe3\xf3\xe5\x00	\x8b\xc5\xa1\xfe\x8cy-\xa2\x8fN\xfc[q\x85\xc3\xea\xc8\x86\x10/\xdcT\x08\xfaz\x14-K\xd2\x1d\x0c\x94\x0d\x08\xab\x02a\x89\x0e/\x15\xc4\xc3,A\x0b\xcc\xd0\xd4(\xf1\xcc\x96\xf8|Y\xd7\xf8_\x936A<7\xb4\xf2\xd2\xa9\x01\xb3\x98\xef\x9cA6\xe8\xc4\xbe'G\x17\xa6\xcc\x87\xb4\xa7\xf4X\xbf\x95\x95}\xc5=\xdaG\x05\xeb\xc0\xcf&=\xfa\xc8\x95|\xa7\xf0\xa8\xd3ijZ8\x8b\xffbD	x\xbe\x17\xbba\xde\x9dn_\x19\xd7\xeeS\x10\x07\xf4\x03\xe9\xcaP?w\xa3\xf6\n!\xfe\x03\x0f\xe6\xe3\x19\x11\xc8#\xd7\xad}\x0b\x834(1o\xe9!H\xd3N$\xe4\x7flRx*v\x06\xed\x94{X\x90 \xaa\x1b\x9ey\xa5\x1fx1\x8d\xa2\xbc1<\x15lLW\xf9\x86\x8ca\xcd\xab|\x1b2\x88Ed\x02\xdd\"\xcf(W\x7f\x88\xec\xdab\x1a\xbanunU\x8e\x00\xc5v\xa1\x8d%\x96\x02\xc5\xad%wx\x90\x8a\xfa\x844l\x87\xf8S&\xeeC6T\xb9\xda\xb6\x8a]\xa2\xf3t\xa2\x90Z\xccK\x9a\xb5\xef@%\x1a\xde\xbcQ\x10\xdd\x8b\xf1\xf4\xbe\x0dl\x03[\xbfc.\x9e\xeb3\x11\xc3*\x14\xb6?0SC8\x8aB\x049\x81Z\xab\xdd\xf2\x86\xf8Y\xee\xf1\xe2\xf7A\x9c\xc1\xc9|K\xd0\xc5\xb7\"Hg\x072'MeE\xfcJx\xa0\xb7\x18\xf0\x93\xd5\xf5\xf6\xf1\xbae\x8b\xf94\x03\xbf\xe5\xe5>KQ1\xa4A\x91\x08Kq\xb3\xa1a\xa2\x03\x0e\xea\x0dl\x1f\xfaH\xf9\xdb\x87,\xbe\x07C\xf2'\x84m\x02\xed	\x872\x15\x16\xe69\x84\xa1\x07\xf55\xe3{\xb1\x99oI\xb0\xd9\xdf\xb3\xa3\xfeB\xf8\xa8}3\xfe\xaf\xcb\x87\xa2\xd2\xf2\x90>\xae\xcb\xeaaW\xd7\xe6\x875AR\xbc\xe0\x99\x89wz\x19\x96|v\x99\x14ly\x06\xeb\xb9\xb0\x13a\xdc\xf7;\x9fpJ\xf5\x06[\x9e\xb1\xd3\x01-\xf8~@\x7fm\xaf%\xe3\xa5\x81\xbd\xbd\x05\xe5n\x82\xd0\x0b\xc3\x18Og{\x1b\x99\xe8lj\x83\x01\x1f\xf3\x92\x85{-*-\xe9\xd2B\xf7C\x1d\xb0\x17\x0b\xd2\x1f\x9f$\x91:'\x1b\xc67<Za\x92{\xbe\xa3\x8e\xb0P\xb8Od\xb6\xba+p\xa2\x9f8\xfa\xfd\xd4\xf7\xfb\xfd\xa0l\x9e\xca\xd4\x12^\x0b\xd60?\xf3.A{-\xc6\xd3\xf5m\xab\x9b\x06hg\x16\xb4\xa1\x83\xd6\xa0\xbd\x11\xf7\"\x03\x1c\xe5\"\x9b?\xd3\xfb\xbe\xd1\xb1$(\xb2H\xd9<\xa6\xa9\xe5}\x81\xe4\x9b\x01\xaa\xd3\xc4\xfac6\xb5\xef)\x9cv\x170\xbc\xb1/@\x04\xc9l\xd7\xc0\x0f\xc1\xee\xce\x85\xff\x0d\xdf\x8b\x92J\xd3a\xdb\x9bA\xf3\\\xe4\xb3\xceM\x83{f\xc8\xbcA~y\xfc\x0c\x18/\x16Cz\x12l\xb1\x18\xb2\x19\x0c\x03\x83\xc5bHW\x11\x89mH\x10W\x88\xf1\xb4\xb8\xb5\xbdL\x8b\xc1\x80\x1d\xc4\x1e\x16\xff\x81\xaa\xeb{!\xc4ah\x0f\x19]\x1f1=\xdc\x8fp\x98\xc8\xc2\x0fJ\xce\xeb:\xd7\xf7\xc9a\xd8\x1c(\xb0\xa2ds\x08b\xd8\xd2\x8b\xe5\xde\x84\xc1}\xfa\xd4\xf3\xfd6\x15e\x1b0,(@\x16os}\xff\x0c2on\xf8\xce\xec\x03\xdc\xc1\xf5/\x0b\xfc\x07\\\xb6fN\xf0\xba\xf3\xfdm_4k\x89\xa7\xe6\xfb\xbba\xa5\xe4>)\xdf\x17u\xdd\xfe\xb6\x0d\xe4\xe6\xbc\x020\x9d\xc8x\xd8q\x9e\x9aS\xc4\xac\x19	\xb6\x8b\x9d\xceL\xee\x83\x92\xf9~\xf0V\xd8\xd2\xfc->5.\xc6\xea\xe3$9v\xae\x92\xcf\xad?	\xf7t\xfb\xde\x120\x05\xc1e\xfcp\xa8\xca-\x8d\x80\xa4 /\x8c\xa8\xdeX\xf1\xb6\xc1\x07L\xc6\x89\x9bK\xa3=~\xcd\xe5\nL\x85\x18\\\x8d\xb8H\x0b\x89:\xdf\xffa\xee`\xc8\xc8?\xee\x14\xf8\xfc\x0cx\xef\x91S\xf9\x8dy\xd7}`a\xbe\xb9\xb2,\xb99u,\xc5\xfb\x1ehK\xfb\x00<!\x9d1\xbf\x99 \x92\x0b\xc4\x07N\xc9\xa1-\x89;\xb5\x05r\xbe\x16YcI\x9a\x19\x90'\xe1<E\x17\xb3\x83p\x16\x0d'\x9cL\xdf;\xa8k\xdd\xf8r4\x06	\x8e#\xcd,v\xfc\x90fq\x88\xb3\xb7\x1aRs\xc1\x1a\xae3\x9d\x04\xe8c\xb0Tb\xcd\xe3avx\xad\x17@`c\x86\xeaC\x9c?\x1c\xb2wJ\xdc\xf3\xb8=\x1c\"ko\x1b7\xfd\x97\xbd\x12N\xb1\xeb\x87>\xfb}G\x9c\x97\xc2Y\xcf\xd0c\xb7cbC\x06\xeb\xd0#\x8d__!6\xacqx\x996\xe1e7l3\xcf\x97\x06\xc5\xfa\xbe\xf31_/}\xffl\x9f	\xb8\xa8\x8c\x06\\\x02r\xc0\xae\xa1_O1\xac\x1e\x1f\xf2JDX&\xb9OUE4\xaa\xfe)p\x92D\xd2\xa7c1s\x15g	\x0b\x11\xb1\xb1\xb1\xfc\x8d\xe1H}N\x1c\xac	\xb1b2;\x0bx\xbe\xdf\xfc4\x94\x91j\x82\x9b\x9b-\xdf\x8b\xf9\\\xf1\x16\xf3\xd6\xf5\xda\xf8\xcf\xe0\x86\xd9\x0d\x8bR{\xff\x13\xd84\xef@(\xc6\x8ep=u\xd1w]\xaf\xf9V\x983p\x18\xac\xd9L\x85\x1d}d!\x1al;\xddN\xb7b\xebd2s\xb1\xce\xb7\xfc\xb0d\xbc\x10\xdbi\xe1\xfb\x05\x9e\xad\xe9>n\x07\xfcGW\xf0\xbch^\xe0\xce\xd4\xfb\xba.Lkz\x84u-\xd1\xd0\x89vR\x8c\xa7y\x83\xda}\xbf\x0f\xc8\x84\x19\x9dL\xe9=\xd0WU\xb9\xdb\xa9$`\x14\xabw+\xf6\xf3|\x89P6\x06\x92\xe9s\xb2\xe4oEc\xca\xbe\xe5\x16G1\xac9\x9b\xeb\xa2\xcb\xf6\xfa\xde6\xc8\x8b\x01\xe1\xbd5\xcb\xbf\xe5	\"\x13\x95\xbe\xbf\x9d\x97K\xe4t\\\xf5\xb6\xac[\xd4\xc4\xa5\x8c\xe9y(UT/\xf4;\xe1\x01\x9b6\xa7\x8c\xb6	\x132y?\xeb\x92\x98\x0e\xae\xa3\xdd\xf0\x17\xb3Ju\xdd\xfe\xb6\xc0\xd0]\xda\x064\x80\x93`\x00M,\xa7w\xa6a\xe6\x889\xc4\xce\x06\x8e+\xb1\xf4}E\xa7BW&\xa6\xd4\xf3}\xfa\x00g\n\xb3\x1d\x03\xe9\xc6\xad\xd5\xba,\x8f\xd99t\xf9~P\x08\x85%* \"\x9f\x97\xc6\xe1\xa9\xa1\xba\x0cT\xabD\xac9z\x0d\xaeeEN\xed\x96\xeb\xb4\x87\x10\xd6\xfb\x86mp\xae\x07\x18\xab\xd9\x96V\xd9\x87 \x06WE}2\xe3\xdf\xd0@\x01D\x0d\x8f\x00\x82	U\x9at\xafj\x9e6\x81\x0f\xcd\xfdj\x19\x14\x0e\x84/\xfa\x0e\x8e$0m\x90\x1f\xcf.\x8e\xbb\x019CL\xcd\x97\x97W\x12\xaf\xf8\xc34\x9d\x8f\xe1\x1c\x137#y\xadq\x8d}\x7f\xb3\x9f\x01\xb8^\x98\x85\xa8\xeb\xce\xa7k:\x06\x85j\x7fb\xb5\xd5\xf4J\x13I\xa1iW\xed+\xfc&8\xcc\xb1h\xcc}\n\xfb8\x1e\xf5\xd8\x058\xfd\xd4\x19a\xdb\xad\xb0\xb01\xdd\xf6\xa9\xe8\x19\x82\xd0ea\x1b\xb5ml\x1f0\xa21;\xee\xe0\x1d\xba\xc7\x12\x14\x98\xec\xd6\xe1\xe2\x14\xb1o\x07\x91\xcc\xef\x97\xbcrH/\xbe\x9bWKH\x03\xc0\xff\xe2'\xac\xd9\xb3\xf8~\xf6m\xb0\xe5\xe67\x0b\x8bav\x08*\xc6\xa8t\x83y\x0e-M\x85\xb0f\x84\x8d\x8e@\xf5\xe1\x96o\xb1l\xea\x10\xeeO\xect\xb2\x9a\xde;uV\x0e\xf3k\x8a&\xe6\xa9<\x05!S;\xf4\x8d\xa9\xfc)|\x85\xc9\x1d\xdf\nx\x1a\xf2x\x18?\xec\x81\x00\xcd\x06k\x12k\xda\"\xc0\xb7C\xd3c\xb7\xe1\xef\xb6[\x95d\xb2R\x8fb\xc4\xe3A4u\xe7\xfa\x95R\x04\x18s\xaej\xdf\xef;\xd4. \xa2\xf9\xf8e\xaf|\xbf\xfbmn\x886\x8d\xb1\x98l\xe6\xc5\xc1\xf8\xdb\x9a\xfb\xf3\xa7h#\x0e\xbc\x14Ap\x0e\xfc--nd5\xba\x02XN\xc3\xd91\x83\xe3\xf42\xf0\x94\xf1\xd2\xf8\xe56\x97p\xc9K\x83`\x83K\x0c\xcb\xb5\x97\x84\xb3(\x01\xc2\xf5\x9e2\xc4\x00\xa8\xec\x01\xf1\xfd\xeew\xe7\xc0\\A8\x90\x19\x1fB\x0f\xd2\xad\xafI;\xde\xc3O \xd6\x1e\x05\x14P	\x94!\xbd\xc3>6\xe1Qz2\xaf\xfeS}\xecEt	\x1f\xa0\\\x8fU\x0e]h/\xae\xf69\xb2:\xdb\xde#$\xf1\xf3Z\x1e\x10$\xb5\x92(`Z\xd6p\xd1#\n\x02\xc9\x1a\x15\xf7\xaal\xab^Ur\xbb\xeb\xbd\xcb\xd4{<(\x11\xaf\xbb!\xc1\xb3\x0fF\x03y\xe2\xf7\xea\xa3\xf9mf\x12\xaf!\xb0[\xcb\xfd\xd7e\xa2z\xf7\xea#\xfe\xe1\xf7Y\x13x\"\xbf\xc5\xb2$\xea\x93C\xea\xabqu\xb6\xdf\xd1\xd0\xb6g(\xa16!\x8c\x86\xa6\xf9fq\x11\x04\x93\x04k\xddqi\xdc\xd4\xd3\x7f\x0e\xbd8\xcfTQ\xfd\xdd\xfc\xfdGo\xb5/\xb7v\x85\xf5]\xf4w\xf3\xf7\x1f\xbd\x9dL\xd5\xdf\xe9\xff\x7f\xf4\x0e\xf1^\xa9\xe2\xef\xe6\xef?zUij\xfd\xc6\xf4\x1a\x9d4=u \x12\xa3\xb1\xe3\x99H\x86N\xdfSh\x06R\xf5w\xbb\x06\xc9\xd0\x0c\xb4y\x8c\x02\xca5{gvQg\xccWB\x9dG8$\x07\x18z\xe1\xd8\xb6\xdc49\x08\x10\xb4~x\xa0\xa7\xd4\xbeW\xab\xaa\xaeS\x98R\xbb	cv\xa3K\xe9a8\xa5\xdc\x8413\xad\xff\xa3i\xfd\x1f\x9d\xd6_\x97\xbbN\xe3\xf4}\xd6v[\xc6\xf9\x1e3\xc6\xfb\x10\xa0:\x00\xab\x8d\x85\xce\x12\xe9\x15\x07\xbb2\xb3d\xd8\xecK\x98Q\x0b\x04Y\x9a\xf6\x88\x1c\xd0Z\xfb\x93\xd9$\\\xfb\xcff\x9f\x87k\xff\x8b\xd9\xb3\xb0\xa1\xcd	\x90V\xd9\x07\x07H\xe9\xaes\xa30\x18\x9a\xb9'\xa7\x8dg2Y\xa6Z\xecdO\xca\\:w\xb3\x89\xd0\xba;\x90O\x9a\xfei\x1f\xd909\xe6\xc5T\xca\x9a\xc2\xf5K3S\xa9\xb5\x92\xb76x\xd3d\xca\x94\xc8\xe677\xc9\x92\xcb\xb9B\x18W\xb5\x9c\xdau\xa8\xeb\xc0\xfe\x84\xfdA\x83C\xea:f\xbc\x01#\xcb\xdeBb\xec\xfbm\x0d\xfb\xc3%\xca\xb9\x1c\x1a$b\xae\xca\xf6[\x0e\x0d\xfei\x16p=\xd4\xc7|f\x7f\x04\x92\xa7,\x94'n\xb0vx\x84\xbd\xcaG27z\xd8\x85\xaba\xf3\xa0\"\x02]\xcb$<Zf\x834\xdeD@\x86\xc7\x86n\x81\x84\xc83z\x0f\xef\xc4AR^\xcd-\x1f\xf0\xee]D\xf1\xa7\x1e\xe8-\xc2\xa6G\x07\xffh\x9dgCrbo@u\xe2\xef\xb0,\xdc\xda\"f'n\xe5\"g8\xecZq\xe7m\xe6\xb3\x1c\xe3\xb3\x7f\xe2\x87l\xfb\x90w\xe2E\x93^\xb7\xd5\xa87\xf2]\x87\xb9\xe61\xd7\xd2^\xc9\xb3\xc3+\xd3\x02\x99	@.\x95\x15x5\x0c'\x00\xce;\xd3dvF)\x07\x8a\xa3{\x1e\xb1\xd0\xe64Bs\xf36\x92\xc2\xd3\x0b\xd7\x19\x89\xcb\xfb\x91\x94\xf2t\xd9\x98\x1bW\x9c7\xdb\xc8uh\xf4\xe2\xea\xcb\n3w9\xb1%\xf2Z)\xdf\xbf\x9aL\xde\xc1p\xae\xeel\x8an\xc5yR\xc1\xf7;\x9fZ^\x8cb\x98\x01\x95\x10\x17\x9a\xc2>\x01\x82\xfb\x9e\x87)\xda\xe8\x0d]\xa9\x07jM)\xc21\xf6gf\xf6\xde\xdd\x14\xfb\xc4<\xf2\x8d\xf2B'\\.\xb7\x90\xc3\xe4\x8c\x95\x03\x0b\xa2Q\xcf_\x8d\x12\xab?AZ\xaal\x19\xd3\x88\xef_I\x0c\xd8\xec?\xc3?\x1b\x1c\x83\x9e\x85\xc4\xcb\xb0\x0d\x88a\x1c<2\x8e\x10\x0d5\x80\x90\xbd\xb2\xfd\x848\xa9(\xdf\x07\xba\x98\x83\x13!\xf5\xb6\xeb\xe8<]r\xec\xc2K\xbbC\xec\xf8\xd8\xbc\xff\x93\xb0\xaa\x14\x97\xab7\x85\x1a(\x90g08;O\xc0#\xe1\x9du\x02l\xf03*\xee\xcaH.	\xdf\xdf1\x96\xb3f\xed\xe3\x11\x1dz\x91\xc3\xf7\x06\xf4\x9a\x16\xa1@\xac\xa7\xc7s\x8d\xe6\xbe2\xb0O\x90\xe6\xe2?\xcdk\xf4\xe7}\xe2\xb9\xcb\xf3\xa5\x0d\xff\xcc\xaf\xcd\x92\x92?\xd1G\xf8\xe7\x93\xb5\xac9\xb6\x8a\xccP+5\xa1\xed\xf4x\xab\xd2\xb4\xc9\x84|\xcf\xadn\xba\xc4\xbb\\\x8a.\xde\x8e\xb8\x95>\x85\x91QZ\xb5\xaba\xb4\xd2\xb1yx]\x9cQ\x02\x882`0\xd0O\xd1\x86\xe8\x1f+*\xd7\xae&$v\xef\x0b\x11\x93\x04\x0b\xcc\xa8\xcc\x8a\x03Du\x8c\xe9\x93(T\xc3M\xe0\x99\x18\xd3\xda\xfe\x91\x18\xf2\xa6N\xf3\x02\xc4\xda\x98046-n8\\\xb2\xc6\xe8\xcc\xde\xe4\x8b\xf3+\xc9\x18(4r\x16\x9a\xad	\xdbkpN\x7fbU\xc6\xd0o\x99\x12\xc4r\x0f\x7f\xd1\xad\x82\xf8\xde\xc1a\xdd&x\xfcr\x1d\xedEOq\x11\x9a\xfe\xe2\xc6\xd6\xb6\xae\xbb\xc9\xd6\x14v\x16\x0f1\x9c0\x9a&\xbe\xdfOl\x17\xbf\xe8\x00\xb4\n\x8a7wx	\xf7\xf4\xa0\xae\x8fE6\xf5#{8NP6\x9f\xb7J\x87\x06ZH\x87\xeb\n?\xd5\x10\xec\x01ML\x9d\xb3.8V\xcc!o|\xbf/[\x19u+\xcd\xb5\xb7s`&\xe0\x9dW\xe4\x12B\xdd\xabT\xc1\xbf\xb6\x8dF}\x86\xe6\xb9gG\xeb\x9d\x99wu\xc2)_\x01(\x9d\x7f\x1d\xa0~\xd5\xbcv\xc7g\x89\xb5\xb1r\xac\xfbKcoS\xd7\x9dt\x13\xa5\xf7\x12\xea\xac\xb1\xb7\xee{\xf8\x8b}\xa8\xa8\xbb1\x1d\xc49\xb4u0\x86\xa6S\x1d<\x0e\x8d\x0e\x7f\xd9<\x1c*\xd3\x92\xd9v~\xd9\xb3\x81\xf7k\x1d^\xb6r\xbe\xc3W;\x9a\xf0\xcb\x8d\xb7\xcd\xa3\xbc\xddmK\xe8\xf6'\xa7\xcbai\x82Q\xe2!ZY=\xb2 \xd6\xef\xc9\xc8\xb9\xcc\xdeD\xcdac\xbe\xdf\x8fl\xd5\xc7\x8eU\xc4\xcd\xe0\xae\xf7q\x1d\xc4\x1bj\xf1\xb7A\xde\x9d\xf9\x05\xc8\x9f\x10\x11\xe7|\x80\xf6\x84>\x82\xb8\x9d\x19\x1b\xb0\x03SV\xd7\x9dq\xe9O\xa3-\x82\xfb\x97\x95(Z\xaf\x806\xa5\x81UK\x899\xe8\xff\xd3\xa8\xfb\xfay}\xe4,\x9auh\xb8\x9b\xab'\xa9{P\x0do\xd2\xa0~{wRz\xcb\xbah\xce\xc5\xb3F[\x17\xd7%\xc0D{F\xbb\xc0s\x01\xa3Q\xc3\xd25\xf0\x0by\xb5d\xc0M\xa7\xe9\xd9\xb5\x03s\xd7K\x0c\x91\x0c\x06Z+\x1c_\xda^\xc0^\xa3?~d\xd1nn\x12[\xf1\n\xbd\xde\xd4\xbd\x08\xf2U\x16\x9f2tr}\x9cZ\x05$;Z\xa5d'\\L\"\x12\x08Ab\x11i69\x83e\x82d\x86#\x0b2\xb0S\x9c\xde\xf7L\x9bMD\xe6\xc98/\xfa\xbe2\xf6\x88\x81\x121\xa2\xf2\x88\x88\x85&\x0d8\xa9\x0d\x1fh<\x9fQ\x10\x96R\x11\x0b\xcd/\xdd=\xa9\\\x81\xd2\xfa\x13\xa6\xc4\x9f[o\x97\xe6\xe1n\xf4;\x85\x93\xd1\x04\xda\x11\xa1\xce\xf76`\xd0\x888\x8e\xb4\xeb\xc7 X\x91\xa5\x81X[K\x96\xf5\x99QVg\xaa\x17\x9eu\x17x\x0b\x1b\x05\x17\x05\xdc\xb0eq\x8d\x1fu\x9bk\xd39(\xebr\xb5r+Pq\xb8\xe3\xfb\xfe9e\xee\xfb\xce!\xb5<\xaesn\xe1\x16x\xa6\xa0\xd0+\xa2Z!\xf1\xac\xa5\xd2\x06\x88S\xe6d\x85\x0e\x01g-f\xcb=o(\xb9\xce\xa2<\x12B\xady\x0b>u\xe1h\xb5\nRD\xf6\x82\xcb\xe3y#\xb0\x07\x07\x1f\xe6\x00\x8a]\x0d\x8f\x19\xd8\x98&V\xc2\x9c\x88?\xff\xbe\xbdq\xf1\x90l6\x07\x04\xf2\xd9\xee\\\xd9\x1b\x80.6\x0e\x8f~\x16\x17U\xce*\xacVM\x0dv\xe2y\xf6N]\nHh\x18V\x83\xc34\x008\xee\x99\xe5\x9ezs\xe7\x05\xa5Z\xb7\xa1+\xcd\xacV\xe7\xed\xd45\xcc`xt\xde\x96\x81\x89\xdf\x06Lz\xda\x99\x9e\xfb\x7f(\x1e\xa9\xd5\xd4i\xae\x04#W\x13b\xa2\x85sz`\x18\x89a\x97\x91@-\xb3+\xa6$\x17K\xfa\xd8\x96Z\x11\x8c4\xe1M\xe8\xb8\x99D\x13\x89\xae3\xd4\x86@C\x80;\xd3\x81=\xba\xe7mAQ\xad\xd14\xc5|\xb8v\xfd\xda\xd9\xf2\xb8y\xb2\xd7\x1aq\x9a\x97\xfe\x9aJ\xc6\x83D\x9d+9sy\xa8^S\x07\xde@\xb7\xc1 \xad\xfd\xb7\xa4	[\xf8X9\xae\x06\x13(S\xceYu\xbb\xcf\x88\xd7y\x1d\xd9\xd5u\x7fr\x9a\x1a\x84\x17\x9b\x80\x12Ic\xbd\xc6\"z\x0b\xdbf\x9b\xe6L\xf8\x86,\xbe\x87>\x8d\x93Q\xee\xd9\xda\xba%[\xb6\x16&\xdf-7\x0b\x03:i\xaew\xdaU\xd2`\xf7\xe8\xce\xee\x99\x8b\xbcgo\xf0\x1e\xc4~\xbd\xbd:d\xbf*h\n\xca<\xefi\xd1!\xf4\x0d\xf1}/\x89r\xfd\x83:\x00\x01\xa2\x7f=\xec\xf4_\x08\xbcz\x0dWm~=T\xbdvt\x8e\xed\xb0q\xab\xeca\xa4q\xd5k\x19?j\xd72\x80\xf8\xf1\xb0\xeb\x91\x83f\xcf\x9c_\xd8\x91w\xf5\x16\x9duA\x18%\x90	N*i\xc3\xed\x85\xa8\x03q\xe1\xa3\xd9\xbc\xf3\x83t76\xe7\x08\x91\xfbP\x92\x8e\x8e\x91<\x19\xc0\x05\xb2\xb1n\xceD\xdbB\x03\xf6\x92z\x86\xd9\xd3\xd7\x86*f\x0e;\xd9\xc8\xd51:s\x0e\xac&\x8a\xf1\x17\xbf\xb3F\xab%\x02\x1d\xdb\xcc\xd2yq\xec\x83\xb9\xdeHm\xd3\xde\x08:\xa2\x8f:\x8f\xe8C\xc7k#`}\x00\x02\xc0\xdck\xf7\xa2?\x99n\xc4f.\x97\x06d7t\x9c7\xe6aLv\xbc\x17j\xbe\x19\x1e\xb2_\x0f\xaaZ\x9a\xf7E/\x02\x94\xb2cZ\xd7\xbaR\xccmi\xb1v\xdd\xc0\xa3\x96\x1c\xd2=@\xf2\x8c\xe6\x9bWK\x9b\xf8)[+\x91\x8f8L\xf4\xccL\xee\xc6(\xbd\xb1\x85\xf5\xa0O\x98\x8f\xb8?9\xcf\xa4\xbd\xff\xff\xdb\xb2\\\x04m\x85\xc3\xe4\xf5E\xd9|\xc2'\xc0\x9d\xe6\xf9,18)F\x01\xfc\x13\xf4\x7f\xf37\x01[\x0e\x16\xac\xd6?\x18~.\xe6\xc8\x9a\xcf\xdf,\xe6\x8b\xe5\xf2\xe9bY\xcf\x9fx\xcb\xf9\x9b'\xde\xf2)~\xd5:\xe7\x89G\xe5\x970N\xab\xe7ozw\x83\x7f\xf2`1_,\x90\\\xcf\xef\x06\xff\\\xb2`qx\xca\x17\x07\xb8\x87\xc0(\xb5^\xec\xebE\xc1\x9e\xb2Q\xca\x13\xe1\x1d\xb2_)\xe6\xb27\x08:q\xca\x070/\xb7\x8e\x05\xde\xd0#\xc7o\x1d\x0bY\x9bY\xb6\xb2\xd7aU\xea\xa7\x9f\xf9\x1a\xaf\xd6\x9a\xd7qG\x8b\xc5(E\x00\xf5\xc5~Q\x8cR\x9e\x8b\xd1\xe2o\xa3\xe9|\xcc\xc7Km:h\xf7\x1b2\x0c\x00\xb19\xe3c\xe3\xfa\xb2m\x11\x03\xe2s*<\xca\xab\x84\"K\x17M\x8b\x93\xfcv-\x12lG\xfb\xcc\x17\x9cl\xad#\xa61\xb3\xfc\xa3\xb9\xd4\xe6tp\x10\xef\xe3\nH\x9b\xee\x15\xb5j\x0d\xa1\xf5\xe31x:\xa6?\xe6\xef\xc4V\x873\x80K\xe1{\xd8\x7f|\x10\xd14)\x8fR\xdb\xeac\x89\xe0\x0fL\x1f\x1f\xe8\xe8d\xec\xf8Ad\xf3\xcf\x97\xfc\xbd\xb6\xc7\xc8\xe0/B9p\x0b9\xc2\xe0\xf9s\x0b}\xa7\x93>\xc0\x19\x15xo\x00\xfdn\x02\xab:j3b\xcc\xc9\xc0\xab\x03\xbe_\x0e\xed\xcb\x00\xf3\xf7\x14\xe8v#>\x06\xf85x\x0f#2\xbc\x1eN\x0c\xc2q#\xce\x8b\xce\xe6\xc92\xdc\x06\xef\x1b\x9b\xce\xc4\x86Q\xb2}\xb3H\xb4\xb9N\xf5h	\xa7\xb2A\x9b	\xe7\x8c\x8f\x08\xaf\xcfW:\x8a\xd2\xb1\xbf\xf2}w\n\xed\x86\x08!\xfe\xe8\xfb\xfdw\x18;Y\x88\x0c\xbf3(\x15\xc3\x86P\xe22\xdd\xb6t\xa3\xbdm\n\x01\x0cS$\xee\xd8\xf9;\xc6\x13\x81\xc0|\xbb\xfd\xacA@\xfa\x9b\x17\xf0\x0c\xc0{q!\xfdB?&^x!V\xb3\xa3\xfa\xb0\xdb\x87\xef\x87\xbbr\x07\x17\nU\x85\x87`\xc5Na\xd3\x89\xce\xb0\x830|\x15F+\x84\xf0\xfe\xe9\xd5\xb5\xfd=\xc0\xd3\xe0\x89#\xc7\x98\xb9\x1f!\x0dr\xf3\xe9A\xea\x116\x9d\xdd\x8dg\xf7\xe2\x10lX\xf8\x80Cr\xb6?o\x85\x1d\xf5^\xbcuw\xe8\xedr\xb6\xb7y\xe1[<6\xb1o.\xd6\xbdH:\xbb\xf9v\x19\xdc\xf3=\x7fg\xe2_\xdd\x0b\xc0\xf6\xe9\xbe\xae\x83{\x84\xc5\xbf\xaf\xeb\xad\x89\xbc\xf0\xb6\xae#Z\xb8T\xeb\xf0\xeea1\xd8<\xd9N\xb6\xa3K\x0f0\xda\x7f`\x8a\x00\xde\x90Z\x8a\xdf\xb7Q\x19\x12\xf7xb1\x19x!xs\xdc\xcf\xab\xa56E\x98V\x83\x01\xc3\xa7\xef\x07\xf8c\xfc\xb1\xf1\xd3\x05\xa4\x89\xefo[\x19{\xc2\x91\x0fcA\xddy\xb0\xc1g\xfb\xb8\xe9\xa3]\\i\xf6\xb2\x85\x03=\xe79\x05\xaf\xbe\x0dr\xbe&\x94\xc4\xb7\xe6\x1d\xe9W@i\xaeS\xf1i\xeaf9T\x0e]\x9e\x0f\x14\x10\x00\x8e\xc9\xa8\xf7@\x8b\xbaf\xf6\xaa\x8b\xc4d\x1a\xddJ\x03\x02\xf4\xb84\xbd\xc6*\x84\x9cG7\x93%\xf8[c\xb0\x1f\x91\xc1\xbe\x8d\x02'O|kM\xa7\xc4U2tk\x990\xa3\x9du*\xbc2z\x8c\xc7*\x1a\x12\x8b*\xce\xa5s\xad\xa3\x8dUV$\x9d\x8a\x8e\x87=_\xb5\xa1\x1b\xfb\xb2E\xc66\xbe\xfeJ\x94C\x8a\xc8`'\xacnWS\x85\xbb}ms`w\x80@I\xa2\x1c\xe2}\xad\x1f\x80\x1f\xe6\xeb\xa5u\x1c\xc4\x15\x92\x02\xdf\xa5v]&\xe6\x9d\xef\xcc\xc4@\x0f\xacQ\xc3\xcd\x84A\xac\xb7Xx\xec\x88*\"H\x1bWC{\xe1m\xe8\xbaKDI\xd3\x82\xb9g\xaa\x19O\xe0\x8c\xbe\x89>#I5d\xa2\xa0\xe95\x84K\x8a\xe7\xb1\x06\x9f\x9f\xc8\x8f\xcd\x1a\xb9GW_\x82\xea\xb8\xa0\xcd\xae\x97\xa1W9\x9d\xb7K!Y\x0b\x13\xbc;\xb2\x0faGb\xd1\x9d\xbb\x01\x8e\xcf\x8fY\xfe\xe6N\xdb\xf1\xb7Bj\x0b\xc6\x83\x88y\x05]U<\x1f/q\x98\xf4\x05\x87/{\x19H\xd8\xd3\x19|C4\xea\x1a\x12\x8b\xd2t\x89\xd3\x1e\xac\x1e\xdb\x16kW\xb4\xa2\xdb\xee^\xd8ZX\xa8\\\xach\xc7@4\xac\xce\xb7-\xb7\xdb\x96\xb7\xdb&\xcc\xb6Yg\x9f)\x9eA\x86C!fB'\xa8\x1c\xee\xf6\xea\xa5\xed\x81\x1dW\xa2\x9b\x12\xac\xf8\x81'|\xcf\x15\xaf\xa8B\x7f\xc5R\x01\x8a\xa5AN+\xc24M\x1f\xa0\x94W\xcc:\xec\x04\x1bq\x98\x17K3-r\xdaA<\xf9L\xdc\x07\x1b\xbe\xe2\x05?\xc0P^\xbd\xc9\x10C;3\xe6d\xbbY*\xfa\xe3\x10\x15E\x7f\x12\xee0`\x83\\\x10\x9e\x07\xb2~\x0c\x05\xd1A\xf0\xb0E]\x07\x07\xb1g\xfc\x13\xe0\x05\x04\x9b\xb6\xc7\xc8@\x9by\x9a\xe0-v$5\xc1\x88,\xe2\x96\x06\x87Q\xd1\xe9[!-\xc28\xe0\xec\x12rw`\x07\xaa\x8d}\xf9\x9el\x0e\xbeA^\xe0\xbd\xfaXT\xf2\x83\xe6\xefx\xef\xa1\xd8\xab\xb8L\x8b\xecW\x95\xf4\x00\x85\xeap\x80\xae\xbb\xe7\x0d$;\x11\x05\x85+:U\x15y\xbe\xbb-7\xf1\\\x9d\xc0)x \x9d\xbc\"\x92&\xc0\xd3D\xfb*\xfdQ\xff\x99h;`s\x8et`\xb6\xaf\xc1d\x16U\x1b\xfd\xd3,H7\xdb\xe1_\xa4~\x91\x8aFt\xa5R\x93\xd9\x1c\xea{:\xcb\xd8{\x1c\xf5\xf6%\xaa\xa9\x9c\"\xc1y\xb1\x8a\xa9\x81\x80\xca\xa5a\x80 \x86\xfb\\\x8f\xfd\x8bv\\M\x98\x89Ss%Eb<\x8d\x81\xd5\x97\x84\xe5\xe3fMt\xec\x98\x80\x1av\xe2\xc0+xcn\x1b\x99\xe3A\x1c	=\x86s\xef\xbb\x17\x1e\xf7~|\xfe\xc37\x1e\xf7^?\xff\x93\xb7\xd4\x06\xbf\xe1\xf1\xbb\x17\xe1\xe8\x0f\xa0\xfd\xe1\x88\xfd0\x1e\xc7\xe3\x9b\xc5\xc3\xcb\x97/_.n\x88q`\x036\xe2_\x7f\xff\xfc\xd5\xabp\xb4\x18\xfeVA\xf4\x10\x8e\x16s\xc8I\x05X\x91\xa7\x9f\xaeAE\x16\xcb\x11\x7f\xfe\xfa\xf5_Pqq\xf8\x8d\x1a(0\x0b\x83\xc5\xab\x99\xb0\xbf\xd1\x08\x0b\x86Ogl\xf1y\x1d\xfca\xf6\x89\xfaOY\xcdj\xd4C\x9f\xaf\x9f\xff)\x1c\xbd\xb9\xda\xddSwR_\x7f\xfb\xdd\xf7/\xc2Q\x18Px\xe8\xa2Z\xd7\xb9<T5m9\xbb\x89\xb1\xe9\xe0\xc7\xc0J\x05`\xee\xeb2Ij\xb4:X\xdc,g\x8bd\xe0~<e\xb3\x02\x05M\n\x86\x92\x0c\xd8\x8c\xd1\xa0\x18\x9b\x8d\xf8\xcf?\xbdBg\xe8G\xbd\xad\xd3\xaa\xceM_\xba[\xdb\x03\xdc\xe9\x17A\xb0H\x9e2\xd4\x0bfb\xfe\x06\xa3\xfe\x8c\x8d\xf8\xcf\xaf\xbe\xf9\xef\x17?\xa1\x95k\x93k\xa6\xa6[\xc0\xf2\xcd\x98\xe56\x17\x96\xdb\\\x04\x0b\xb6|\xca\x06l\xf1\x0c\xed\x8fN\xbc\xb9Z\xc3\xa3\x8e8\xf7\x83\xdc\x85\xc7k\x11\x9d\xce\xa2>\x99\x18_$[\x0c\x8f\x88\x03\xd2\x11\x0c>\x12\xa7\x01\xe5<H:?\xee\xd4\xef)\x8fr\xd0Vs\xcb\x88\x84Go\xe0\x9d\x89\xdb:\x81n\xa3\xf6\xa4C\xe3\xe2\xfb}\xe3,\x19\x81\x9b\xc5w\x02\xeb\x82 :\x0f\xa0\xa6\xcf=\xdaZ\x11\xd3ki1\xbe\x9e\xaen\xd3\xe9j0\x00\x9a]\x0b9_-\xd9QS\xe5\xe4X\x07\xb9cV>\x1c\xcc[v\xcc\xf7\xd7\xee\x99\x9e\xb0)\xaa\x80\x8f]\xdb\xac\xebB\x84\x19l\xde'!\xb8\x8d\xe8\xa4|\xbfai\"\xa3\x1b\xe5\xde\xdd\xd5\xb9wc\xfb\x1a<G\xbc\xfb\xaa\x99\x06\xd0b\xe2\xae\x06;^,\x01\xad@K\x8a\x01Ki\"\xcc\x10v\xa9\x88\x1d\xdef\xaa\xedC?!\x15\x99\xa5a\x7fr\xd2B\xa2c\xa7m\xdd4=\x94A\xad$3\xb7\xe5\xd0\xfd\xc0j0l\xd9\xc5r\x9c\xb8\xe7\x85\xd7	\xd0\x95P\x83\x01O\xc5\x87\xe9%X\xb8\x8bp\x0d\x10\xa0\x7f\xe3\xa9x\xcfx\x1ax\xed8<\x1e\xf1\x95\xd5\x97p\xef\x9f\xff\xef\xbb\xee\xc2U\xa7\x7f\x18\x12\x17	a\xfa\xf3Q\xb4\xd7\x9fKY~\xf5\xf1\xbb\xe4,\xf4A\xdf\xecj\"\xce\x0b\x06\x92d\x16\xe6\x0c'g\xfc-d\x08\xf42	]\x0cn\xf7\x8fu~\xf8\xea\xe3\x05\xddkm\xae\xe0u(\xae\x146c\xb0gR\x03\xb3uwi`4\x81l\xbf\x1b\n\x06\xd7\x14E\x82A\x03 d\x89\xf0B\xc1\xe6J\xb5\xc4-\x14\xcc3\xd0u!\xe2c\xe1\xea\xf8\x9d\xb3\xb9F\xc8\xdbK\xffzQ=\x1d\n\xb7f\xc8\xd5\xf0\xa8o`\xb7K\xa3\xaf^\xb1\xa3\xd4\xc1\x9c\xf1\xfc\xab%N\x88EA(f\x1c\xe5UCc4KD\xe1\xb2\xa7\xc1ZD\xf3\xb4!XS\xbc#\x05+\xff7\xc1\xba\x0d\xe8l\x02=;)\xdd`\xe6\xa3\xf9\xa2Z\x14\xfa\x15\x88N\xb0g	7a6\x8b\xf1\xbc\x06\xad\xeb\x9a\x858\xc4\xe8\x92b?\x9a%\xeeON\xfc\xbb\x17W1\xfc\xc5\x94\xae\xad\xfc\xa3\x85\xbb8\xfbd\xeeq\xb7\x1f\x10\xc5`\xf2\x10\xb9\xb9Z#\x9a\x16\x05\xcfh\xe8\xe2\xf9x\xc98\xd2\x04\xfek\xa7\xfcf1\xa8\x17\x87\xa7\x98\xb1\xa7\xe5\x91\x91\x18\x0573F\xd7q0\x0b\x8b\xc0^\xfeOqw\x1aF\x14\x0d\x99\x07\n=\xdf\xf7\x9e\x15^]\xdb\xc42\x81\xed\x91\xf7\xac\x18L\xe0\xe3\x88\xf7\x1fM\x8c;0G\xbe\xef\x8d\x8b\x016\x19\xe3\xa3\xa4)\xfe\xa7\x083\x83@\x87\x97\x99\xb0\x9b1\x976\x02\xce\xcd\x98pi\x0f\xc5|\xbf3\xa5)&\x06\xacg\x81\\\x9e4\x01v\x19\x16\x02\xf0\x85\x83\x9f\xd2\x11\x11\x97;2\x85(\xaf\x1c\x1ar`\x9eB$\x83R\xc2M\xc3\"~\xb1\x14\x81\x9c\x7fA\xc3\xff\xf2*Gm\x97\xe2\x9f\x02\x16\x15(k\x00\xfb\x0b\x8a}\xdf\x1cIy\xb2\x04N3^g\xb4\x88\x81j\xf7\xb4\xacH\xde\x14\x18\xa9+\xa2\xebPl\xf4F81\xa9\xeb\xd1\x9b\xc5{\xb3\xd4\x94\xcf\xf0\xbf\xd8\xd2\x87#\xd2\x88\x8d\xa0T/F{\xbf@z\x8b\x93\xd8\x1f\xbfY\xb1iR\xd7g\x92\xad\xc6\xdc\xa3?i\xe8\x7f+\xc1\xfc\xf9\xa7W\xb6\xe31\x06f\xd3	P\x9d\x9c\xf3\x88\xe9\x08U\x04*\xb1\xdd.\xf8/Yw\xec\xfe\xb9\x17	0\xc8!<\xaa\x02\x8eZ\xc9\xd5\x83\xd681\x1a\x03\x01\xd9\x188\x99\xe7\x89\xa1H?\xfc\xce\xfa\xe3\x137Q\xac\xae\x97\xb5!\xaetQ\x1bR\xacS\xd6\x8dQ\xd6\x8d\xf3\xda\x8dU\xd6L\xb4I6\xad\xea\xbb\xf8J\xff\xfd\xbe\xcb\xac\x9d\xb8\xc2s\x8c\xd7\xcau\x8b\xade\xf7\xc9\x84V\x7f\xdf\xefo\x83\x18P -T\x9d\xf8Z\xc9\xa4\xa3E\xb7\x85G\xebE2\xca.\x82W\xc2\xac\xe9C\x15^3\xcf\xeb^X\xd8\x15\x0f!\x83\xf4\x06\xb5\xd3\x7f\x94\xb02v\xb4\xbe\xef\x81\xef\xf5\xa0\xf43\x0fx\xc5u\x1d\x99 hxaF&Yye\xc4\xbf\xafm\xaa\x8d\xc6\xf5\xb8\x0c\x00De\xd7\x81\xe9_\x19mcX\xe74\xba\xcar\xf5?n\x10\x95\xdd\xc6v\xf2px_\xee\x1f\x81\xd1\xdf\xb1\x9e\xb6\x01\xb7Q\xad\xff\x0e\xaf\xd9Y^o\xd1\xec\xa0~QM\x8fUoKc\xe8\xec\xfb\xd6\xf0\xd7\xe9'\xdb\xca\xf4\x7f\xbe\x14T\xdbmn\xaf\xba\x11\xea\xfe\xaf\x8c\x9a\x1au{\xd13\xfa\xd7\xbb\xe99\x8b\xe3\xfbva\x9a\x86\xbb\xebu\xe24\x9e+k3r\xc3\xe35\xcfL\xd5\xba\xb9\xab\x87\x92L*\xae\xb4\x84\xc7\x1a\x84\xec\xba@\x0e\xc9\xda\xd6\xbe\x85\x0f\xaf*U\xbd\xb4\xa8\x97D\x05\xe1U\xc19\xe66>\xf1\\\x9e\x15\xe8\xd8\xbb\xa1\x90\xa5go&'\x0e\n\xe2\x91\xe6\xfe\xed\x99n\xb0L\x92G:\xa4\x12\x93\x13\xcf\xcf;l\xa6\x17\xdd\x02\xa1\xdd\x8cO<}\xbc\xcc\x9d-ST\xeb\xc7l\xc1t\x11pe'\xae\xde\xfe\x8eRt\xc6\xe1\x9c{<\xbf\xe1\xcf\\\xd2p\xc5\x93f\xc0\\o\x86\xf9lH]\x98t\xc5\x14\x15\xd6\x9aCzV\x11d\xa9\xef\xa0#\n\xackG\xc8W\xd7E\x00\x1d\x86\xa6\x15,A\x8b\xbb\x1e4m\xd3\"\xd1\x17\x86\"@fC^k\x1b\x8d\xf4\xdcF\x03\xa2W\xd83\x08a\xd5\x1c\x8db\xbb?>Y\xaaS]!U\xdbp\xef\x8d\xba\x04\xf2z\xbd\x0c\xb9\x90\xd3\xc3\xfb\x0c\x8fe\xdd\xb3c,\x0f\xca\x83\xa4\xca\x0b\xe9'\xc1\x9e\x17j!D.\xf2\x0b\x19\x04\xde\x99k\x84\x10\x10\xa7\xb6c\xcbV\xc1\xbd@\xf4\x0cj\xc3\xa6\x8f\xa7\xe8\x91\x1a\xcfe\xb7mW\xea\xf9\x89v\x9b\x86\xa8\x11\x90\xdeaL\xa1\x10\xb9\xd2\x0b	9\x02\x86Bf\xb1\xc2>\x7f\xd1\x1fOW\x02\x14\x11O\xbbQL\xb1\xb0\x88\xe1?O\xf0T\xe2\xaa\xae\xfb\x1a\x0f\x12\x8d@\xea\x9f\xb1	=\x90:\xb7\xfa4\x9f\x9e\x8f\xb9\xbb\x10\xbeof@\xed\x88\xc1 cS\xf4!V'\xfb\x9e\x02\xe5\xdc4\x171\x06=\x9e\xc1\xf6e\x1cn\xfe\x8d\xbe|\x7f3\x8a)lg\x97\xcbq\x8ed+\xeb\xd6s>\x97l5\xcf\x15?\xce\xfd\x00Cx\x88\xdc\xd5m\xab\xae\xfbf)p%\xf8\xfec\x08\x9d\x0e\x9f\x11\xf3^k\x9fX\xc0@\xb6<`]\x9f\x0f\x92\xb2<\xc6\x06\x97/\xfe\\\xe1.,KO\x00\x9c\x88-1\x0b\xb3\xad}J f\xa1\xe6\x1f\xb4\xd0\x10\xd1\xa1\xcf\xbe\x03\xc9(\x84\xb9Q\xa3\xe0gx\xb6n1\xa4x\xc9\xc0\xf38\xa0\xe6\x19\xa0&\x9a\x7fa_\xaf\xef\xd9gc\xa0\xd3\xf1\xfa\xc2\x0b\xc1\xc9\x98\x81\x185^Hy\xc2\x9ba1S\xfd\xf5\x14\x9f\x0dNH\x81\x10t\xc6?\x857\xa3u2\x0cr\xb7H\xda\xf43S\xfd\xa6\xb17g\x8d\x01`t\xceg\x94c\xd4\\\xd6\xda\xeb\xc6\xa2\x14\xd6\x8e\xa7\xb6\xc3\xab\xeb\xa6\xfc\x98\xdb\x82\x83	\x15\x1dx7^\xd8\x9f\x84\xca\xf7\xe1}\xd6\x9f\x9c3\x10\xe7\xd8\xf5\x99\xc6\xae\xed%\xf68\x82\xa5w\x01\x84\xc3\xd3\xf0\xb7\xe2\x1a\x98C\xa9:\x08\xa2\x9b\xf1`\xc2N\x0d\xaa\xdcku!i#\x98id\xbe_\n'\xbeV\x9b:<\x94\x0f\xfbX\x0dF\xc1\xac\x0f\x1b'\xe8\x0e\x98\xfe\x1d,!>\x1f\x99\x12\xb0`h5\xc1\xdd\xe6F\xc1\x1b\xd7\xd4i\xd6T\x1a\\t\xd4r\xfc\x8bE\x009\xfd(\xe5o\x19\x9b\x9a\x82&d\xd9\xcf?\xbd\x12;\x92\x02\x9ck\xd5\xa5 \xab\x07\xc7\x1a\xca\x0d\xb7\xc3\xc7\xf6\xd1\xe2\xc8\xe5\x19#\xe7\xf9X\xfbByO\x9e\xa6x+\xf1\x13\xcd\xc5\xe7\xd1\x17\x86\xa4\x99\x00~D@\x9f\xf9\xb85\x8d0/+V\xecx>`LB\xbf\x07\x16\xc1\x94\xca1\xe6\x90W\x8d9\xce\xc7\xe3L#\xe1V\xad\xd8\x8a\xc6\xac\x80\xb9})\xab1jP\xad\xf49\xbeU\xf4\xf2\x98\x11\x1b\xe1h\x9b\x96Px\x8a\xef\xcb|{\xa8O'\xcc\xe1\x81\xbf\x9b^Y\x90r\x8bK\xc3\x92l?\x97\x87\x0cS\x9f=\x9c\xad\x82\xd1\x95F\xb0\xc2h\x9e)\xeb\x8d\xa1C\xed\xcb\xc7Z\xa9\xeb~\xf4X\x9e=4\x8fV\x9e\xddL\xc2\xc9\xf4\xb7JA\x08\xfd\x05\x15=\x85\xc1\xbf0hi\x00\x9c.+x/9\x9f\xed\xd0\x9c\xc4\x9bN\x11\x02m\xc88\x14$\xb0+1?\xbf\x7fy&\xdc\x98\xe1|#R\x82\x1c!Df\xdb\x7fGK\xdbQN\xdfL\xe8\xb3)b\xed\x976L5\xc2\x8c\x0d,\xa26N\xe3\xd3\x8d\xc8\x9ar\xabO\x94\x8b\xdb\xc7w\xe1ZjH1\x0bn&\xac\xae\xef\xdf\xdf&\x14\xb8\x084\xdd\xfc\x9e\xc8\x07\x04\xd5mF\x8dDNIv{@\x11\xc53\xcc\x07\xc9\x88\x91\x18\x9ab\x119\xa2\xbc\xebl\x8c	\xd7\xaf\xe1\xc9\xb4\x10\x9b\xd8]\x1d-\xb1\x99T\xab\xe4\xb6\xef\x0f\xddL\xa6\x08\n\xeb\x14\xb5Ha\xd2\xb5\x1cF\xa3\xb2y\xe2\xc0p\"x\xbe\xeb\x9d\x07E\x85w\x88\xf7\xd9\xae\xf2\x06\x14\xc6\xe1\x85\xac\x14\xc3}\xf9:\xdbB\x9b\xa0\xc4\xc5y\x99\x1a\xb5\xf7\xb7\xaf\x7f\xf8^x\xb7\xb2\x07q\xb9x\xe2\x0d\x92\x81\xf7dt\xe7!>CqP\xfb\xea+r7\x84\x9f\x95C]\xc1\xcc\xbe\x95n\x93\xaa\x80b\x92\x82d/\x92\xe1w/\xdce\x8ay\xe2\x8a\xd0\xe3\xdf\xd0F4\x17U\xfcIm\x04\xbct(\"*\x04\x92\x8dYg\xf7y3\xc0\xef\x99\xb2\xe3\xb2\x80&\xc1\x9c\x87 t\x93\xb3\xb9Z\x86\x91VpX\xdb\x95\xb3\x895\x84\x8e\xe9\\\xfeV\xe7\x97\x05t\xe7-rp\xe9;\xdf\x87qNg`\xd1\x89qe\xfcvh#\x02	:\xc8\xc4\x02\x0e~7\xc4L%d\x98\xaaHt#\x16\xac\xbe.\xb7\xba\x90\xc7\xe0}~\xcdf\x89\xec\x91\xcc\x81\xbb\x1b\xb7[\xfe\xfa\xf9\x9f\xae^7\x9f\xd2\x82L\x1d\x11\xfdS\xa3\x08J\xc4\xbce\xb5\x14L$@\x9c\x90\xaa\x10*\x9e\xee\xfa\x98K\x029l\x1a\x8b\xc4\x9e\x9d\xf8\xc4\xf89|C\xe3,\x9e\xfc\xe1\xc9\xdd\xedH\xdey\xdc\x95\x00\xb6\x0f\xca:\x89\x9d\xad\xba\xd8\xc7G\xcaY\xc56\xcc\xcc\xfe\x00A\xb7K\xd8\xd2\xeb\x19\xce\"9,\xc2\x956\xf83\xf8\x0e\xb4;\x1b\xe3\x0d\xf4\xfdGk\xa9\xf7\x1c\x8e\x12\x17\xbb\xbd\xe5\xd1'p\xc4/\xbf\x1c\xb2_\x7f\xcd\xf1\x8a\xe84\xea,\xcf\xaeG\x14\xbex\xf2\xfa\x9bW\xaf\xb1D\xbb;\xd2.\xf5\xa3\x8b^\xeb\xfa2-\xf0\x86\xa8\xd8\x88\xde\xfb`\xeb\x8e\x1d3n\xe3\xe8@f\xdcq\x13\xf4\xd3\x1a\x9d)\xf3\xec\xd6Z?'0\xf8\x8c\xd5o\xda\xf7\x03\xf0\xd5<.\xf0\x193\x1a\x17}\xe1\x90N\xab\x03\x16n\xa0]\xd8\x11\x81E\\\x05k\x00\x9cY\xefC\xa0\xaeCe\xc4\xf8J\xb7Jz\x15\x83\xcd\x88s\xf2\xfd\xb3:_[n\xe9\xd1V\x9b\x12\xd4\x1c\x9a\xc6}}68 F\xe2\xef\x10J\x8b\xf0\x13~\xb4m\xceu\xc2\xd2\x0e\xcc\xf7\xd7\x90T\xd0\xe9\xce\x84;&\xc2\xc2\x94\x89\x82\xfd\xac\xae\xfb\x99s\xb7:M\xda\xc62\x8d@\xa9N\x9b\x9b!\xfb\x04\x82\xb4IS\x97;NKeh\xcd\x0d^\xf1\xb6\xfa\x8f\xce\xfc\xc0\xe3?\xc2\x95\xf6]\xb7[\xcc\xe6^(\x9e\x8b.~\xd6\xe8\x91\x17\"\xaf\xeb\x04\xf6u\xce\x84\xf0\x1c\xfd\x9b\xc5\xe1\xe9|\xf0\xcf\xa5\xd5\xf1\xb0i>+D\xd1\x92\xf6O\xa0\xc6[,>\xf3=\x16\xaa\xeek:h\x9a\x17\x143\x15\x86y\xaa\xd38#\x8a\x1c\xeb\xf8\xb6\xaew\xecS+\xe1\xcd\xb3\x04\x17g1\xf0\x9e,\xf1\xde\xb6\xb32{v<\xad\x10\xd0%\xffx\xcc\xeb\xfa\xde\xa0\xee\xb3\xf9\xb5on\xcb\xe6\xa4\xb4L\x94\x02\x13%\xd9\x16\xe6\x11\xb0\x91\x98F&\xf2\xfbut\x7fv\xcf\xf3HHk\x16lq\x07\xf8\xfbm\xf9\xeb\x0f\x97\xa9\xefUt\x9fUW2\xb6\x87\xb3D\xc3\xdc`\x80\x89\x00q\x8c\xc0N\x8f\xa0\x1e\x83\x81\x14\xac\xd8\xb1\xacM\xe9\xf3\xb1zs\xc8i\xfb\xe2\xc9\x93e\xa8Q\x95ga\x8c\\@H\x90v6\x99\x16\xc9@\xb2p\xc4#\x93\xcd\xee/\x04\xac\xb1\xe0;\x03W\x1ac\x1a\x96rO<\xf9l\xf2di\xcc)-\x0e\x92\x8c\x99=Wu\xdd8\"hQ\xa5}\x94\xd2\xf7\xfb\xa3\xbe0\xd0\x16\x1b\xa4\xb5\x12fB\xd2\xd8	CFEq\x06\xec\xfc|\xbf\xfd\xdd\x1c\x0f\x98\x04Yq\\ou2\xf3L\xd9\xd1\x02\xc36\x88\x1f5\xbb~l\xf7\xaf\xad\xff\x19\xa9\x97d\xef,\xb6\xc7\xacz\n\xf8>\xc9\xde\xdd\x9d\xe7\xd8t\xcf\xbcn\xe7\xe0\x1a\x17\xff\x99HPWr\x02O\x9d]	r\x98Ks\xe9\xb6\xe2&\xe1)\xea\xe2\xf74\xe3\x880\xa7\xc6>\xbc\xb5\x1f\x1es\x8fp\xb5\xc7\xb8\x8b\xba\xaf\x91\xec\xe6\xc2\x8f\x1e\xc1\xd8g\xf7}?\xb6\xfb\xf4X\x05c\xd6a\xefk\xec\xce5\x16U{+\xccZ\xc7\x85\xce\xd8Z\x82\xc0\xc4\x0f\x95M\xb9Y\xfb3\x88X\x08#\xb0\xf0Z\x07\xd7y\xe0\xdf\xe8\xaf\xdf\x0f\x1ee^\xc1\x96N\xfe\x9d<b.\xdbh\x1a\x98\x9c\xb89F\xce\x84\xac\xa2)\x90\xb33}J]\xcbp\xcc\xce\x87o\xa9\xe0h\xd6\x06*\xc1-\x01\x1a\xc5\x83\x01\x19qV\x1f\x9d\x1e:\xae\x06`]WpwIE\xd4\x1c\xb2\xd9<Z\x86\x91e\xbfZA\x96>\xd5\xd6\x85`5\x10	$\xcfW\xec\xfaMQ\x98\x9cL\xa5\xebG%\x9739\xf0\x9ez\xa1\xfc-\xcd\x00\xfc.\xa0\x1a\xe0\xcaq`o\x8c\x0cV\\18\x8c@8j\x9e\xc3\xe5\x8e\x95\xaf5\xb4@\xe0\xe1\x15\x01\xb5\xd8\"\n\xc7\x87\xdd\xde5\x066Is/\xf4\xc8q\xf5\xc3no:@\x96\xf6S\x11\xaeW\n_\x91\x82\xa45\xd5\xe6\xed\xdb\x94\xd6\xd9\x8d\xb7A\xacD\x0bB\xa7@[\xc5|/F\xff]TY\xfe\xd9\x88\xff\x00\xb2m\x16\x02\xf6\x8a\xeaPC	AY\xf4\xeby\x9e\xb3\x11\xffQ\x8c\xf8\x88\xff$Fo\x86\xf37\xe1\x1f\x16\xf3\xc5\x90/\x9f~6\xe2?_\x17\xa3\xf1\xff\xb2\xd38\x93\xc6\xf1\xbf\x88#	\xbf\xf6\xaa@DB\xf3\xde\x1d\x9e.\xe4\x85yW\x19\xdd\"\xb0\xe3\xb4\x13\x11d\xd5\x8dR`\xc1\x13.\xc3\xe0Q]{\xf1K\xe7@\xf3\x9a4V\xb4\x13\xe6\xa2\xdc\x07F\xa6f0\x94\xfb\xb6~\xbb~A\x84'\xed\xd0Uk\xf0a\xbc\x1d\x15\x8d\x808\x99W\x95\x8c\xef\x03\x0f6\xb6Y\x91x\\2\xad\x0e\x9a\xb6\xddP\xd9\xb3\x9e\x8ei+\x0e\xd10bb'\xa0OE\xb7\\|7fhd-\xd2\xe9\xfa\xd6\x96&\xf0D2t(\xf6y`\xd0\xa8\xf3\x0cL\x19\xfcs\xd9QY\x04\xbb&\x7f#\xebs`\xd6E\x9d\x9bO\xd8euc\x8c`,\x8f,\x1eV@\x8a1\"X\xd8A\xc9\xdbx*/\x16\x10m\xf0\x08\x8a;g\x01O\xbc(]-\xa6EH\xbd\xb3%}mc\x90\xf4'\x8c\x93j\x8fK\xd6\xe8#\xff\x95\xfac\x86\xcd\xc1Lt\x13\xd95\x1dr\xbf/\xdb\xb0.\xb2\xb58\x9d\xfd\x97QD\xb3Y\x13\x96\xa2\x89xA*\x85&\x16\x03i\x1e\xec\x9a\xe9\xdd\xb4W\xe9\xdd8t\x17\xb41M\xb9\x1b\xb3\x13\x8f\xf3\xf2\xa0.\xf4\xd1\xad\x89%\xa2\xe0\x08\xd3\xc9\xb4\xf3P\x9d4\xe4\xccZXY\x1d\x85\xe3\xed n\xdfOq5ig\xa0D\x8c\xa7I\xeb\xaa\x96\x0c\x06\x0c\n\x11\x042\x97\xf3d\xc9\x1a\x9b\xcb\xa3\xc5f!\xd29\xc5/Oy\xae\xde\xa9<\\\x9f\xd84\x15\xa9K\xd7\xaf\x07\x03\x0b]1	|3\xd1\xac[#\xe8q\x8e(\xadeT\xd7\x9d\xe5\x0c\xc7&\xa2-\x82N\xb8\x87&\xb9U4\xd4\xa3Y\x86\xc4z\x89\xeb\x87Z\xb2Yfv\"ew7\x13\xda\x83\"9':\x83\x94c\xb9\xcc\xfcR{(\xba\x13\xc1\xf2\xf6\xd3\xba\xee\xa7\xe7\xb7\x1f\x84\xa7Q]\xa7\xcd5\x05\xb2f\xc2\xcc\xc9\x02	kv\x1a/\xc2j\xe4\x1d\xc4,\x8c\xa7\xd7\xa1;\xc6\xcb\xcb\xb4\xed\x06&\x01I\x1d\xb0t\xbd\xefzf\xf7}\xdf\xfcp\xd6\xde\x06\x0e&\xac\x1dX\xc0\n\xb50\xf7\x12\x9em\x8b\xed{\x86\xa6I\x8e\xd3\xcf\xa6\x17\xd9r\xb8!Nr\x06#\xc5\xd0\x80\xf5\x89\x9f\xbdJw!WsN\x10\xed5\x0b\xdd'K\xa4U}\x82\xe9\x9c\xcd\xe52\x94\x10\x89\xae\x86[\xb5O\x15\x0d	T\x1bH26\xbd\x8e\x1f^i\xb7\xb7\xba~\x15\x80\x10`\xb3$l\x16>A\xf8=Y$\xafT\xee\xb86t1\x8d\x8drDK\xa7\xbd\xe4\xdd\x90\x1e\xc7+\x16k\xd6\x08\xa7]|;\xb6\x08R|\x0b\x19\xc4%\xcc\"\xf3\xe8\xb7\xb9a\xaf\xa0\x9c\xdej\x98d\xc0\x14\xae\xa5:kj\xd0u\xfc\x98\x8d\xc6\xb5\xaa0.\xd7\xf7\xe9\xd5\xbe\x8aj\x1dH\xfe\x8c{\x8e\xe4\x9a\xba\xc3\xcd\xfb\xe9\x1ag&\n\x9e\xe9\xe7y\x9e\x7frZW:\xfa\xad*\x8f\xf4\xf4\xfb\xd6\xc2\xed\x8f\x16\xa3\xa1j~\xb3\xeay\xbfT\xfd\xa0?\x1e\xd9;\x93\x0bk\xd6v\xff\x10\xd4\x9b9\xa2F:\xdc\x0d\xed\xf3\xc9v\\I&;\xb5D\xd2\xd5J\x96\xd8\x06\xf4d\xf4J\xba\xc7\x0c\xc3\x81\xc0Z-\xd1n\x93\xf4\xc37\x0d\xfd\xde=\x8d\x8ej\x12v\xeem\x8f8\xd7 \xc8\x10\x95\xb5I\xedD\xa2\xde\xca\x9d\xb9\xe7A)\x7f\xdf\"\xfd\x00\xa1\xb1y+\xa8MZ\x8c@\xa2\x9b\xe6\xa6\xc4cw\xac\x8b\xf1\x11E\xa1\xff\x17\xd0\xeb\xcd\x91V,T<pn\x05\xd8\n\xff\xa8\xbbK\xe0D\xfe\x83\xed\xda\x08\x86\x10Qh\x0f\xab\xb5\xc7\x10\x88\xe2\x92\xffl\xa4\x006R\x8d}\x13\x8e{\xcc\"\x83\x86\x12=\xa3;4#\x03\xe3M)\xbc\xb0(\xab\xc0\x1b\xc8\x81\xc7Z\xbbhK\x1d\xe1\xa6\x98=r)\x91\xf5\x8cd\xb39~,\xc3\xf9\xf2\xec\xf6\x02\xbc2\x18\xfbv\xe2\x149;\xa0\x95\x7f\xf3\xb8\xb9\x12A\x008\x98\xe8\x8f\x88xz~w\xd9\xa7\xed\xcd\xd5\x9f0\xc6\xba\x17[\xe3Q\x9f\xc2\xe95E\xf3f\x11\xd55\x033\x0c'\xc2\xf581\xe4\xb1\xbe\xc9\xb5\xeb%\xd4\xc5\xd0\x1a\x9cu0\x18\xa0\xa7H\xdf\xa0\xb6u\x84\x83\xd7\xc7\xea\xea\xe5b\xf4\x0cW\\:\xcf[7\xec\xb8\xb9\xed[\xb26>\x19\x12\xfe\xaf\xc2\x93Q\xb4\xaf\xe5\xbe\xca\xe2\\\xd5\xf2\x90%\xaa\x96\x0fIV\xd6Q\x92\xd5\xb1,\xde\xc9C\x8d\x17G\xe8\xbf<;T5\xe2\x86g\xf9\xa1^ei,w\xd8\x0c\xfc|\xd8\xabzU\x96\x95\xda\xd7\xda\xd0\xb8^\xa7\xfb\xf2aWo\xe5\xfe\xbe\xde*d\x14\xf2]]>Tx\x0fx\xb7/S\xb8\xe0\xd6\x07EKX\x1f\x1e\xb6[\xb9\xffX#\x9cv\xfd.KT\xe9\xf1\xbf\x89Qo\xf3_\xb8w\x17\xc9@\xd0\xfb\xb8\xc9\xa0\xc6\x8d\xc2\xbcQ\xca\xffNr\xd4\xc1\x88\xffC\x8cn\x83Y_[N\xee\xeb\xb8\xcck\xb5\x8dTR\xaf\xf7u\xb6M\xcd\x13\xc4yV\xd0@d\xbd\x93{\xb9e\x01$\xf3\xe1r\xc0\xe6o\xee\x96O\xd9bt7\xcaR\xfe\x7f\xd0\x96\xc9\x18\xf1\xcf\xc4\xe8\xb6\x82`{\x94\xf1_\xc4\xe8\xb6\xf6\xff0[\xbc\x1fLG<\x92(8\x0b\xb5\xfe\xb2\xa6'\xb7\xd9(\xe3Q\xd4I\xd7\x92b3\x9cR\xafV[6vM@\xbc\xdb`\x16z\x83\xbf\x0e<6_,\x0e\xa3\xbb\xa5\xc7\xbd\xccc<J\xc4\xc8\x98\xa7\x1b'\xcd7bYCDh\xad\xd6\x87\xd4\xb3\x12\xa3\xc5(\xd8\xc8w\xb2V\xf1V2=\x04\xe4\xach\xa5\x9e\xde\xf6\xb1\x84\xf3\xaf_<\x7f\xfd|1\xaf\x177\x8b\x1b6\xe2Q*\x8ezd\xe1|\xc2\xbd[\x135k\xfb\x90W\xd9.W\xe2\x89\xfd\xf5\xe4\xce\xe3\xde\xedH\xe7\xdfyK\x9e\xabT\x15\x89\xae\xb5\xcaT\x9e\x1cT\xa5\xcb\xb4_K^\x01\x1et\xa1\n\xe6\xf8\xba\x84\xf9\xb9\xe4\xd5>\x9c?k\xf2\xf4j\x9b\"X\xf8;\xb7h\x12\xce??/z[\xedM\xf1\xfd\xdd\x95:q\x99_i\xbf)\x18\x979\x81\xa9n\xa2\xf9r\x1a\x00T\xe9\xd1o\xa5)F?\x96\xdc>\x15\x16\xce\xc7\x1c\xbc\xaf\xb7<\xf1h-\xfe;\x88\xd94J\xf1T:5&\xf4\xef\xac,x\x94\x0eiRH\xaapZ\xf0\xc3vJ\xbf\xf5\x81\xc2OZ6\xaa\xb1\xa6\xcf\xc4y\x96|]m\xf3Wj\x9f\xc9<\xfb\x15\xcf\x99Gi\xf3n\x99\xc0P\x93\xec\xdd-$\xa34)\xfa\xb1<\x8b2za\xdaop\xcfj(\xe3X\x1d\x0c\xdbz\xa5\x00\xd9\x0c\xcc\xb4\x10\x86\n\x99\xd8e\xe4\xb2\x100\xa3\x9e\x0d\x82\x0bb\xfd\x8c\x95\x88\x99\x91\xf9\xbeV\x1f*\\\xba \xbcO6\"Zs\x17\x99\xdb\x83\x9d\xf8\xfb\xbd\xdc\x9d\x13N\x86\x0f|\xd9&\xb9\xbc\xc2Y\xb0\xc1&\xca\"\x1b\x9a\xb6\x02\xe9<F\x14Q\xfcb'\xaa`+\x0f\xe0W\xe7\xc0\x86\xeam0f\xc38/\x0bE\x0e.\xb6XK	\x81\"\xee\x98#\x98\"\x08\x12\x0c\xa2\xe1B\x12\x8e|s\x89\xb9\xa4\xd0\x99\xea\xd6E\xf3\xec\xcc\xd3\xdf,\x80<5{\x816\x9bp+\xf8\xd0\x8b\xf9\x1d\xd4\xcc\xff\xd7\x96\x93Z\xbb\xb2\xa0\x8f7\xd0.0\xb5B\x92\x14C\xa7\x1d\xe8\xf9>\xbd\xf5\xb3\xb8\xdd.\x16FvR\x92\"D\"\xa73\x05\xd3dw\x16\x9f\x18D|	\x14\xd1\xcc\x9dE\xccB\xdd\xd5C\xd1\xed\xac\xa1\xbc\x9d0\xd0\x01\xbb\x98\xe3E\xa0s\x9c\x7f\xbc\x89h\xbb5J\x9f\xbfe\xd5\xda\x84\x12u\xc8P6DL`\xf0q\xb4\x95\x8f\xf5\x9e\x94\xdb\x1fd\x91\xedZ\x1a\x8e\xf7\xc7\x9d\xd3\xdb\x847oi\x0fJr\xad)\xf4<w{\xf5\xff\xa6\xab3\xb3\x1c#\n\xb2\xe6\x08\xd4\xb7\x0e\x11\xee\xce\xb2=\x8f\xd7\xd8~\xf6[\x8b0\xb9\\\x84\xf6p^\x1b\x91\xc1\x01\xcd:Z\xfcc\xec\x98V\xffk\x18\xe7J\x16m\x01h\xa9\x1c\x03C#\x1c\xabJ-7x\x94\xee\x966\x1e\xba\xe7\x84\xf3<\x9d\xb8\\u\x08\xec\xff\xdf/\x80k\xd2\xf5\x1b\x8bq&\xab\xc4'\xf7h\x02\x1e\x97\xfb\xf4a{u}V\x17+\xd8\xac\x11\xe2\x02]y\x0b\xbc\x15\xb8\x92\xc4z\x1a$\xd45Hj\xe3$l\xc4\xd6x\x03\xc5\x91=B\x96g\xf7\xaf\x1f\x9dG\xf0\xa2\xe0\x994\x14\xbc\x84\x1c$\xd7-+`\xdf\xc3\xec\x98\xa9 Z\xc5+\x0c.\x92w\xbf:VNIg\xff/\x1c\xfb\xba\xa2\xe4h\x1ah\xa9\xfe\\63\x83<\xf9\xd8JU\xf4\xc0\xdd\xe1D\x9f\x18\xb7\xb9H\"\xe7\"aQg|\x9d\xac\xee\x15A\xd7Zxn:,\x8d}z\x7f\x12J\x1e\x89\xc8|\xca\xb0y\xec\x03\x13=\xbf\xdbL\xd6\xca\xdc\x95F\xa6\x1d\xd1\x99\x07-\xe3t\xf3;(\x11\x13.\x03\x0b5\xa6\xb7\x0dM\x88^WZ\xdaX\xcb\x9a\xd6\xda(5X\xc2Y\xdcj\x96\x1b\xad\xfb\xdf\xb8g_;w4*.\xc3\xde\x8f\xa4\xc3_\xb7\xe4X\xaed\x92\x15\xe9\xdf\xd6Y\xa5_t\xac\xeb\xfe\xdfmI\xe8\xde\xa3t\x1e\xfc\x1f\xab\xb5\xab\xeb\xb9\xa6\x16\x19\xfc\x96;\xbee\xcbn\x88\xae\x7fp\xef\xf6\xb3\xc9\xdd\xed\xe8\xb3gw\x9e\xb6\xec \xce\xcf\x8a\x82c+	\xa6E\x88?\x05\xde\xf1'\xc0\x84;\xab!$\x0c\xd2\xc6\x8eR\xff\x14\xfb\xfe5\nO~\x92Z3\x8b\x8a[\xad\xb3\xb9\xbf\x81\xce\xfee\x8aN\xc3\x82\xb9K\x11/\x85hc\"\x1f\x9c!t\xe9\x12\x0e\xc9(\x9b^\n\xe4I\x8c\x01	\xb0y\x0c\xeb\x1c}\x9f\xdf\xed\xad\x1e\xce\xc5\x9a<6\x98\xb1A\x10\xd3\xf6\xae\xc7\xd1\x0b\x18\x8ff0\xb1\x1fF\xe6\xeaa\xe1*\x88\xdd\x95\xed\x9cE\x83\xc3fg\xea\xb6\x8b\x95\x9aI<\xef\xc4\xb8\xe7\xcc\x1c\x82u\"\xd0O\\\xcf\xe9\xdaQC\xbeA\x0b\x81	\xd4b)\n\xa7\xb8#p\xb1\xc1\xd9\x04\xc4\xe1\xfc^\x98(\xa5\xed\x89 \xbe\xf4k`\x10\xdfo\xee73\x0f\xc4\x99j\x04b\x1b\xf7|E\x89>4\x9bO\x91\xf1-\xc1\xd6R=\xc6\xd9\xdd\xdcW\x9de\xf9d[\xca:\xca\x99&u\x0c\x82\x8d\x03,\x8a\xc7\xb3\xd4\xc0T\x181\x9e\x9e\xf5j\xba4\xc8\x08N]\x1bz\xc8\xb6\xd9{\x87kk\x13\xe9\xc1\xc6\xacs^'HhI\xbfv\xad\x1c\xac6S\xe2\xb8\xda\xcb\x14\x1cT\x98\x9dB\xc8\x0f\xa3\x87,O^\x9aDs\x87\xf3{<\x95\xac\x86\xb6,__my2K\x05\xe2\xff\xb4W@\x98v>1\xb3\x94L\x93|\xdf\xa1cS\xeeU{\x13f\x0c\xe0\x90\x8b1\xdf\xba\xe3\xc4\xdb\xe47\x93i~\xbb\xa5\xc7q\x13c65\x8b2\xbdP9\x1e\x9c\x08\xedO<\xf4\x1c\xaf\x15\xf8\xed\xba\xde\xdeM|?\xbf-f\xf6\xaeX\x83\x92\xed\x8fY\xb8f\xa7{\xd3>FC\x1by\xef\x90w\x90\xd2F\xc3\xc3>\x9e\xad\x86r#?\x04\xf4&F\xe8\xfd\xe9\x9b\xd7\x1e\xd7Z\xf8\xb0?\xe1\x0f\xfb<\xa4b\\\x1e>\x161\x92 \xd9\xc2\xcd\x10Zc\xf4\x13\xf44\xba\xca7\xefd\x1e\x04\x11\xb1\xbb\xb0 \xed8g:\xb6\xa8\xdd\xd0\x11\xd1\x8a{\xa3\xa7\x9f\x8d\x9f\x8e\x80^]7\x04\xdfw\xbf\xbaw\xf1\xd9\xb1\xd7\xa2\xd7\xce\xfe\nw\xba\xd7O\xe3\x14Z\x18\xa2\x16\x83LDW\x18o\xa41\x9e\x19\xee\xdb2\xe4\xb6\x87\xba\x0e2\x88\xac\xadv\x14`r\xfd\xb0\xda\xc7\x97o\xbf\x9c<\xf3}<6\x1a\x03\xf2\xe3\xb5\xdc?\xaf\x821y\xe6\xdc\xd2\xa5\x19\xd9S\xdd\xb94[\x14\x01'\x95\xf6\xe4w\n\xe1\xe0}\xd9\x14\x8a\xddB\x88PH\x0f\x8bZ(?\xcc7Kn^4\xc5\xf5\xa7\xc4\x1a\"\xf5\xba\x0e\x94xl\xbaAC\xdb\x05\x92gx\xe9\x831\x9e\xd2\x10\xdcf\xc5z\xa6\xc2\x89\xbd\x0c\xda3\xa8x\x03\xbaa\n\x9dA[K\xdb\xbd\x10\x94\x1e5\x93\xf5\xba\x0c=\xfd\xcb\xb3L\x16\x92\xccO\x8f\xbb\xc4x\xd8p\x07:\xf59\xa8\xea\xd0\x12\xd7\x06\xbfC\x1a\xd2\xc1\xf5\xbf\xad\xb4hm\xd5\xf1\xbe\n\x9c\x11S\xf7\xe0\x9a\xdd\xbe\x10c\x18_\xd6\xaex|\x02!\xfbU\xbc\x02\xc1y\xfb\xc5\x8e\x88\xbe\xdc\xa0H\xb3\x88\x84\x8eO\xbf/~|\xd0D\xcdod-\x84=\xc8U\x04Q\xbf\x02\xb2\xf8@/\x1b\x10\x01\x89}<v\xd3\xbdG\xdb\xbb3\xc1\xb3.\x8d\xb1\xd2\x99\x96\xe3\x92\xf2u\xac\xb5p\xd8\xc4u\x00m\x0d\x91H\xe1\xdf\xc0\xabw\xeb\x0dZ\x7f\xd7\x81w\xa7\xb5T\xe8\x05\x18\x19\xa2\xa30*!\x9fG`R\xe7\x16-Jj\x99\x1e\x0e\xaa\xeb\xcb\x8c\xafq\x84\x149\xb0\xc8\xce\xd6\xd4u\xf7{\x02\"\xb43<v\x8c\xee\x03\xc9\xd7X\xae\x08\x8etpr\xce\x83\xb5\xc6\xea),$\xe6\xe9r:\x18\xa4LQ\xfc\x9c\xe8>@\n\xc7\x17\xd9\x83\x03\xddn\xa8	\x13`\xed7\x1b\x8a6n\x13\xa7D(b\x1e,@\xac\xc1s(\xd9\x8d!\xd0F\x84\xb5$\xc7\x1c\x86\xc4\x11\xde52X)2g\xdbX7\x8a\xae	$\xc5(;\x93=\x02\x05j,y)\x95ln\xb5{1\xe6\xf94\xc8\x85\x9c\xdf7\xec\xd8=\xd81\xd3o\xde:\x0c\xc2'{ l\x9c\xd3\xbc\x0d\xf7\xda2\x12yK\xe8\x10\xab\xfa\x8b\x86\x8d\x9c\xb1\\D\xe7\xa2\xd0\xdc\xc4\xf5\x81'\xf8#\xcc\x00\x96d+,W\x91\x7f\x8a\xab\xe0\x90'\xcf\xb7\xcb\xbav\xe4\xc4\xbc\x14\x05\x88\xb7\x9d8[?\xeb\x9b\xf5VD.\xd9\xc0\xf7S\x98\xfb\xc7\xb3hm\xe8T\xe2'\x83\x1d\x0b\xff\x1b\xa4l7\x8d\xef\xda\xabQ\x14\x08\x07\x95\x0f\x8a\xf93k\xb2R\xde\xdc\xb0\x9d\xd8\xb5F\xb5g\xe4#	\xc9\xf5\xe9?\x88\xcf\xecJ\xf1Jl\x85\x10\x1eI\xf2q\xb3\x1cf;\x87Z\xf1}\xf7\xcb\x19z\x88\x01\xa0\xa2\xd1\x01\xd8\xaaN	\xa3S\xcbDe\x10\x17,G\x10U\xe1\xe6&c\xae\x08\x0f^\x06\x1e\x0d\x0fa\xd3\xfb\xf8v\xda1\x95}\x9f\xd2\x1f\xb9\xe7\x91\xc7N\xfdO\xb0\x8f\xbeo\xb8\xc7\x9caR\x1d)\xcd\x05\xac\xfc\xddB\x00\xdd\xeb\xee\x820\x9e\x0bw\x96\x1c\xee\x02\xbb\xc7\x86\xb5c\xfc\xad\x19?\xf9G\xed\xc5\xdb\xb9M\xb8\x99,\xf9\xde\xf7\xf7N\xdd\xeeW\xa7\xa5=c\x8c\xec\x9f\x1e\xce\xb6\xd5\xc2\x88\xc6Z\x08\xc5@\x07\xd1\x9c\xa7\xe0A\xd8\xc8\xc9\xec\xcc\x17W\x9b\xf9=\x90\x99_T\x049V\xd0D\x07.pX\xda\x08	\xb3\x0da\xf9 g\xe1\xa6\xb1\xa4\xd9\xf0\x9cPV\x02\xe3\xa9K\xfe\xa7\xdf\x84lQ\x86i\xa7o\xe3\xca\x00\xa7\xcc\xcd\xfc~\xa9\xcf\xfeZ\xd0o\xd8\x1avh\xe25\xb7\xc4#\xb0q\x7f}\xd6\xa2\xfef\xcc\x84\x98\x0f\xd6\xce\xda\xcd\xd6\x8f-\xe4\x1aT/\xcd\xf3\x98\xad\x826('P\xbc>\x1d\xef\xc4j\x98\xee\xd5.X?\xc2\xdf\xdbA!\xe4\xd7\xc6\x18D\x1a\x97\xee\x0d\x9f\xdf\x0f&x\xdb\xc2\xdc\x96\xef\x18;%\x9d\x83\xbcv\\<6\x06=C\x08\xe6\xa0h\xc3\x05\x83\x03\x13+M\xc9s\xd5<(c\x9e\xd6\xe3\xa9se\xe2\xc1\xaaJ}\xa3\x1f\x8co\xd0-\xd9 O\x83L\xc8\xf9\xba\x91\xeb\x11\x0d\x00\xe3\xb6\xe6\x04\xeaE\xc7\x18\xe6m\xe2\xb9\x10\xa5A\xbf\xb1\xc8\x9cw\x98\xcd=\x15\x89\x04\xaa|\xf8\x81\x80\x1a\xa7\x81\x1eZI\xdc\xa6\x97\x15\xbd&Y\xcd7\xcb\xe6\x9dp\xc3\"g|\x03\x06\xc1y\xd5\x0fI<2o\xa9\xb1\xa9\xfd\x85\xdb\xc7\xfc\x1c\xaa\\mMX\xabt\xa6\x97\xa0\xe7\x0e.\xcc\xce}l|\xff\")h\xca3n\xda\xc0\\\x10\xb6\xddD\xfc\xdb\x89\x91\xccwk\xb9\x08\xe6o\x18\xa2\x0f@\xfd\xfbV\x8c\xca\x9d\x8c\xb3\xea\xa3\xd0\xc9\xd0\xfa\xee\xc5(\x98?\xbf\xf9?\xcb\xfa\xcd\xf6\x80\x18\x02\xd1A\x8c\xde\xcc\x177\x83%\x82\x15/\x92\xa7\x8b!C\xa0\xe0\xcf\xd0D%Fon\xba\xe9\xc1\xac\xbf\xfb\xc0\xe6o\x16\xc9\xe2\xb0\xd4\xa5\x1e`OMM0A\x7f\x87\x8bD-\x11\xac9z'Fo\xb6r\x9ff\xc5\x88G\xef\xc5qgl\xfcCOF\x872\x7f\xa8\x94\xc7\xdfe\x87,\xca\xf2\xac\xfa\x18\xda\x10o\x88\xf0\xb6\xcb\xe5\xc7\xd0\x8b\xf22\xbe\xf7N<\xfa \xe6\xde\xebr\xe7q\xef/Y\xba\xae<\xee}UVU\xb9\xf5\xb8\xf7\xbdZU\xde\x92G\x1fy\xf4+\x8f\x9ek3\xea\xf8\xd0\xf1V\x88\x7fS\xc2\xd8\x89r\x84\xc8\x14\xd0w\x92\xd2\xde\xf0\xfc\xe1\n\x8d\xe2\x03\x9a\x19\x1e_\xa8+\xef\xe0r\xed\x10\x94\x87\x03=\xc4\x14\x1e\xcd6\x84\xc7\xb4\x13\xda\xca\xf8\xf77\xf6\x83\x11\x14	\x9e)\xdc\xda\xd2 t\x8b\xe7\xcd\xbc\x89\x17\xc6\x96\xb0\xc53\xdb\x1fs54\x85\x11\xf7\">\x1c~|\xd8F\x08X\xb4\xca\xf2\xfc'\xd3'4BeQ\xfdMa\xd5\xf0\x95g\x85\xfa\xb6\xf92\x0d \xa3\xdc\xef\xd6\xb2 \xcb\xf4\xf7YR\xbe\xa7_\xbf\x92\x13>\xfd*\xcb-\xac\xd4\xd1\x11\x9e\xc4>\x84Go\x95\x97\xb2\xf2\xc2\xf6\x94\xc7\x87\xc3K\xa4\xcd<\xfb\xcb\x0b=ZD\xfd\x81W\xbe?v\"\xa7\xd9\xf0\xff\xb83\xfa\x1d\xdb\xc8>I\x8cZ\x12W\x07\x1a\xef\xf7\xcd\xdc\x8d\x10\x07\xf4!\xa1\xa0\xad\xca	\x13\xc4\x0c<\xb1.\xc3\xef\x91e\xf6a\x9e-\xa7\xb1\xfe\xa6\xf1\xcf\xb3e]\xd3\xd3\x9ad$DC\xb8\xf7}/U\x95\x97\x15\xbd{\xe26\xef\x89\xd9\x80%6W\x8c\xf5[W\xf8^j\xf7g\x83\xb3\xb8\xb6\xd6\x9f	_\x8b\x96\xe8\xa36\xa2\x07}Y\x93\xadV\x90\x88\x01=\xe40\x98\xb0\xa7\x83t\xfel9\xd8\xc9\xfdA\xafO\xd0\x82\x18d9\xcdmh\x06	DR\xd7\xd4\xbe\xc9\xf1\xfd\xec\xf0\xa3\xfc\x11M\x1b7\xa3nn\x9f\x1a\xd4p1\xcf\x10\x10\x13&5\xbb\x0f\x86f\xbd\xaf\xeb~\xe0\x1d\xcc\x84\x19\xbd\x01q\x0f\xbf\xc3@B\\J\xd3\x85\x97\x19\xa6(\x12#\x1e\xce\xe1?I`p\xb6\x8d\x8d`b\x1a\x9f\xefH\xea\xeeC\xbc\xe4\x9d}\x88\x97\xa0\xeb	\xcc\x1b\xa8\xa1g\xd5\x0c|1\xc3\x88\xda\x9d\x01\xa7\xaeDjwf\xdc\x0c\xd5l\x081\xaeQ\xe3\x95J\xc7\ng\xf6\xf0\xbe\xa36v\x18<\xb0\xed\x8a\xaf\xe8ZZ\xd1M\xc0\x12\x04\xbf6`4_-y\xfbSD\xf3\xd5r\x8a \x05$\xe0\x92\xcc\xad\xe6\x14C\x0b\x16F\x94\xe65\xe3\x87\xfd\xd7\xaf^\xe9\xb9\xc3\xe3J\x1bo\xfc5S\xef}\xbf\xf3\x89\xb9}]nw\x0f\x95J^\xa1A\\*\xbf\xba\x08\xcdb\x0dn\xb9S\xd33\xd8\xa4V\"\xb5\xe7\xde\xcdg\x93\xf3\xf8\xb3<H.b\xc69\x9d\x83\x96Q\"\xb9\x18\x83y\x90\x85\xa0\x18!-RU\xfdl\x9e\xae&\x8f\xff \x82:_\x08\xcf\x00\x9eq\xc0\n.\xba2?\x0c\xeb\xc1I\xaf\x12\x8b\x16\xdbF\x8c1\xee\x90\xca\xbb\xec\x83\xca\x7f\xa0k\xc4\xf7!L{g\x1dh}?\xaa\xac{#\x9d\xb5\xf5\xf0}\x96 \xfa\xb9\xfeK\x8f\x8d\xaa\xb3\xb4\xf6\xd9[x\xde_\xf1K{\xd8\x830k\xd6\xfd\xf9\xa3\xeb\x8e8\xe5\xdd\xd2\xdd\xefyD&\x8afgV\xf6a#\x03\xc0\xf3\x08^\x07\xc1J(\xc6\xed4VH\x89)^\xdb\n\x0f\xd1\xcb\xe1\xfe\xa1\x80u\x9c\x19M\xf7\xdb\x94\x82\x06\xe32\xfdllT\x16\xa2l\xfc\x85\nOx\xb8\x18^e\xbf*\\.j\xeb\x85+\xbe\x12\xa9^m\xdc\xa9\x03 \n[!~\xb4\x9b\xa4\xd5\x97\xac\xccU%\x1f\xaa\xd2\x0bWx\x15\xfb\xa3\x88~\xad\xeb\xe897\xc2\xdb\xb9\xb7V\xe6\x02\xa7\xdd\xf0\x96\x17\xe2\xab\x06aGKq~e\xda\xe8\x1c\x8d\x8b\xa3\x1c\x96\xab\xd5AU\x7fCcp\xdb\x9cE_\x199)\xee\xa5\xf7r\x87\xaf\xf7m'\x0d!\xd0\x94\x83>\xb2\x1bt\xd2qn\x8c\x0e\x16\xd6f\x11-H\x18\x99\xd7\x9b\xed\x9dg\xae\xd0\xba\x0eZ\x1cg\x13/\xc6\xef4\xfcV7\x1cD\xe7P3\xeb~\x1a\xd5vh\xc0\xc8|2\x92=\xcf\x9c\xbbC\x1b\x14\x0e?\x9b\xb0\xd1d<\x1ex^\x18\x11\xd1\xe0y\xd7\xa6G@l\x91\x06\x01\x9a\xdb'\x11\xf3\x19.\x0e\xb5\xcf\xe2 b3\x8f\x08\xcc\xc0\xce\xcb\x1bDO\xa9\x17\x86\x0ex*(\xdc\xba\x1eZ]\xc7\xcd/\xcf\x9b\xc6C\x90\x0e\x82\x9c2\xa2;\xad\xc9\xae\xf6\xd96H[<\xb5\x83\x16\x96\x84\xc7\x1e;\xc6\x17\x04\xb0\xf5ab\xf69\x00\xdb\x95\x81\x82\x93\xedPD;\xbd\xaa)\x9bu\x9aW,L\x07\x14\x11\x8d6\xafk\xabcwr\xaf\xf2\x0cR\x06\x8dj\x88\xce\xec\xee\xea\xb6\xcd\xf8\xc4\xce6`wl\xc8\xd8\xac\x00\xd9uc\xa9Y\xa7w\x0b\x8c3\xba\xa6<\xdd\xc3\xcd\x1e]x\xac\xd9s\xa7\xe3\x13\xe4\x96Fr\xb9\xdb\xfb~\xd7}\x92\x84\xd8n\xc2P\x93\xd4\xe2\x82w\x13\x9d\x93Cq|\xf5I\xd2\xc4\xa1=\xd2@\x14x\xce\x1c\x7f:\xd2H\xbbX\xdfR\xfb?QUto\x86\x0c\xa0\xd6c7\x8bP\xd7\x96\xb8\xf1L\x8a\xd9\xf1\xa2,\x14\x84\xd8\xdda\x13W\x90+q\xc5]\xed\xac\xa4\x9e 4\xd3\xcc\"\x99\xa3^/@\xe6N&\xd0\xd2\xe3g\xa4_\xa0\xf1h\xc2W\xc4\xe6v\x9b\xe7r\x00\xcc\xa3\x19\xc8v\x8b[i\xb0\xa5\xf5\xdc'\xd0c\xe7\xfd\xd8\x10$\xceJ\x1cO\xd6\xa9k\x9a\xdc~A\xba\xfb\x15\xda\xfe0O\x96\xe8A\x91\x0e_\xcd\x93\x1bDRW\xf3qC.\xacZ\xd6\xeek1\xfa\xb7gc0j/\x04\x1e\xa5Y~6\xe2\xd17b\xb4\xd8\xcf\xe8\xb9\xca\xe8\xa5\x18\xfda\x08\xd7\xd4\xe8O\xe0\xc3\xf0\xf6L8\xef-\xaa\xe5\xd3`\xfe\x06oZ\xc2\xcay?\xfbl\xb4My\xf4-\x8a\xcc\xc2\xb8\xcc\xcb=l\xbb\x15\xfdWe\xdb\xf6\xc7M^\xc62\xaf\xd5Vfy\xad\xd7\xb6\xde\x96x\x02F\xd3\x9c\xb5\x0d6\\\xef\xf1\xdcn}Pr\x1f\xaf\xebJ\xe5\x14\xc8V\x9br?\xec\xf3\xfa\xbdR\xf7\x8c\x18\xc4\xeft\xaf2*\x1f\xaaZ\xeev\xf8\xb7\xb89T\xe5^\xa6\xaa\x1e\x0e\x167\xc43\xe1e\xa6z\x95\xe5\xaa\xde\xabC\xfd>K\xf0\xday\x88\x99\xfdY7\xf0\xa7o^\xd7\xdf~\xf3\xfc\x05C\xda\x7f\x8a\xd1\x9b\xc5h1\x1a\xf1\xe8{1Z\xccF<\xfaA\x8cn\xb5\xe8c\x11\xcd\xdf\xdc.\xe9I\x9eY\xffv1\xd2\xa9w\xec\x96\x92\xd9\xd36i\x94f<\xfaQ\xb7\x7f\x16\x8f\x97\xb8\xe8\x9f\xc4\x88\xac\xcd\xa3\x9f\xc19\xcf\xfc%\xfbE\xcc\xdf\xf8\xcb\xa7#\x1e\xfd\x17\xaa!\xea\xcb`1D\xe4\x97\x10\xf1\xf61&\xac\xfch\xf6\x87p\xf9\x14)!\xc5\xebc3\xbc\xa8\x13\xfd\x05\xba\xabb\x88\x97\x91y\xf4\n\x84g\xf4\x9a\xfe\xffo\x1e\xfd\x95G\x7f\x13s\xef\xe9\xc8[\x0e\xe6\xdeSoI\xc6\x1f\xd1\x7f\x0b\x1d\x8c\xc7\xd0\xdf\xd1\xdf\x19\xd2.\xa2WH\x18\x8d\xff7\x95\x84_y\xf4\xdf\xc2|\x9d\xa2\xbf\x8a\xe8\xbfL\x18\x9a\xff\xee\x92\x82\x90 /\xbbF\xc2\x18\xda\xb5+\xf7\xd2\x95\xd1\xf7\xa3\xbf\xd8{8\xfa\x8b\x110\x9d=V\x0d\x8c\xddw\x94M\xb6<\x92\x8c\xc7\x84l\xe2S\xe2\xd1\x06TPwb\xdc\x04\xfb\xd7\x91\x05\xe1\xb3b\xe5\x84\xf4\xaa\x95N\x1d\xc3\x1f\x1d\xcd\xac\x05\xe9|\xa7\xf0J\xe9\x98\x02\xc4l\x16\x98G\xe7Y\xe8\x1c\\m\xa3\xef\x19\xd2\x93\x9c\x03\x82\x18\x0f0o\xe4\x87W\xaa\xaa\xe0\xfd4\xac\x10M\x1c\xa4\x87\xcc\x89!\xfb\xf9\xa7W\xafab\x85\x1e3\xd2\xa1M\xad\xde\x19*fI\xda\x89p\xed(\x97\xa1\xcb\xf4\xe8;\x8c9\"\x1e\xe4\xea\xe2\xd5vz\xb3f\xb8W\x87]Y\x1cH\x1f\x80xP\x87\xbf\xa8C\x99\xbfSI\x00\x9aP\x0e\x93\xb2P\xed\xbd%\xa9\xd2	:]t\x11\xa4\xb3U\xe0i\xf3\xef\xc6\xa4\xa4\x8d-\x12\xfd@\x17,9\xe2\x04)\x0bc\x18\xb3A\xd4D\xe82\xe1s\x04(\x96\xd0\xcf4\xb4\x1c&\x07\xc2\xc1\xd8\x9b\xb7Cn(\x18\xbbj(9l\nZ\x13H\xa7.%]i\xe0\x13Fc\x94\xa5\x8cds\xe6zlur\x8c\x95\x0b3\xd7\xc6c\x0d!Z\x9c\xefk0\xb4\x8f\x07\xc0\xe5\x19M\x19g\x8a\xba\x8e\x8cKUc\xc9\n!#\xab\xeb\xe8['\x1d\xfb\x0b;\xa2\xae\xad\x9b\x13\xb0\xd2\xd8\x94\x0caA\xd0\xac\xa5y+\\?\xda\x02\xe8\xd4S\x89\x19\xcdl\x07\xb8\xbb\"\xaa:b\xd8aD\xa3\xe7\xef\xc0a\x85m\xc0\x87\xe8\x1b\xee\x01\xbb\xe3\x99)\x16^)\x1a_/\n\xae-\xb0\xaaOl\xbeG\x00_\xc9}\xd5\xd3\xbf\xca\x1d\xfd\xf8\xda\xc0*}\xd0\xe3z\xf4\xeb\xd5\x03I\xcf\xf4oh\xb5\xff\x95w\xd3\x1b\xd0i\x1fC\xef<&?'\x16\x9f{\xbb\xf2Pu\x19\x83\x98\x1dW\xf3\xd8m\x8b\x180<F\xee\x1ev\xd2\x8a\xa6\x14\x80\x16\x01w\xa1\xe6l6\xa1c \x12\x93I\x88\xd4\x073\xe1\x07=\xabP\xb5'7=\x9d)\x88SU\xbd\xa2k$\xbc\xb6Y\xbd\x95\x91G@(\xde\x08\xe0O<U\xd5\x9f_\xfd\xf4\xa3['z\xac\xd6\xe6Pb?\xb9AA\x0f]i\x05;F\xb3\xe83\xb2\xa5uq\x14\x0b\x83HH.E\x17u1Ne\xdb\xe9\xcb\xa6]\xca\x0f	aE\xff\xcd\xb3\xc3\xf7\xb8\xf0\xc3\xe8;\xc3\xe8\xfc\x15\xb1\xc7\x1a\xdb\x991w\x0cj\x8c\xa1>\xa4qd\xd5\x90g\xb1\xc4\xf0F\x1fn\xde\xbf\x7f\x7f\xb3*\xf7\xdb\x9b\x87}\xae\x8a\xb8LT2\xc5\x8b\xfc{\xbcD\xfe\xdf\xaf_\xde\xfc\x07\xec\x1fJ\xc0\x0e\xe4\xf8\x90(\x1aS\x9c1\x97q\xacv\xd5!<~\xd8\xe6g\xedns\xde\x03Y1\xfa\xb0\xcd=m5J\xafG\x8c\xf0\xd3\xd3oU\xe8\x84].\xb3\xc2\xe3X\xc3n\x1bH1\x8d\xc0K\xcal\x0d\xf7\x9eza\xf47\xc7\xd9\x94zG?#\xdd\x0fu1\xd2\x0dR##\x188j\x1c\xfd\x92<\x9d\xcc\x80m\xe2\xdf\x7f\xf8\xde\x8e\xc8&\x01\x97{\xd4\xc7;\xb5\x07]\x1b\x1e\xbd\xa74\x16/\x94\xc3WD;r\x1a\x7f\x0f\xbdyX\x16\xfd\x89\x0e!Y%\x06\x0f\x10d\xd2\xb1\x0e6\xf9\xef?|\x7f\xe2\xab\\V?\x91\xff\xd0!<\x9ax\x02h\x06\xdb\xdb\x1f\xc3\xb8|#?\xfc\xbcW\x86\x8b\x8c\xfe\x11D\xaf\x18\x81\xc2\xeb\xbd,\x0e`|(\xf1\xb5NtA\x0e\x87\xce|\xd1[\xf71\xcf\xf9\x96h\x81C_\x88g\x88\xd9\xfb\x0c\x01\xc9`p\xbaG\xf0\xce\xf2\xa1\n\xde2h\x97a\x0c\x06\x0e\x95\xbf\x1b\xee\x95L>\xbe\xaad\xa5\x84\xbc\x1b\xcf\xbe\x08\xc7t}\x96|\xcf\x1f\xf8{\x11\xf3\x0f\"\x9f\xc52H\xf8;\x9e\xb30\xe2\x1f\xf9\xafd\xc9{'\x9e\x8d\xc7\xbe/o?\x1f\x8f\xeb\x1a\x86\xbd\x9f\x8f\xbf\xa0\xee\x93a\xb6\xfa\xa1L\xb2U\xa6t\x90\xd2\x8f\xe2\x1d\x0e\xd2_\xcc\xb2\x7fK\xbe\x88\x81\xf7\xbd<T7\xb6\xa0\xc7\xd8\x8at\xcf6a~\xbf\x14\x1f\xd1\xd3\xaf\xd7k\x7fS\xc9\x94*\xa9J\xa6(\xfc\xab}\xba\x14\xe3x/\x10\x99ck\xda\xf2x\xd9<\xce\n\xa2m/\xe2(H\xf8\x07\xc6\xdf\x0b\xcf`\x17]\xc6Pq\xcf\xd9\xf1\xbd\x80\xf7\xfbA\xed\xe9\xb1R\x8f?\x88\xe7\xe6\xd1\xb9\x07\xf1\x1e\xe3\xea\xbf\xafk\x89\x8eL\x01y\x0b\x15\xad\x14cvz7<T\xb2z8\x08\xc9\xedO\xc0\x9a\xf0\xbcA\x10\xd7\xf5{\xc6\xcb\xd9\x1a$\x05(\x08\xd8\xe3\x06\x8a\xcf\xf7\xfc=\x7f\xb7d!26*\xael\xfa;\xfe\x9e?,Y\xd3\xd2\xd7\xb0F\xa00\xb6\x11G\x10\x0d\xb0\xebi\x8a%\x01\xd8x\x83\xa0\x9cy\xe6\x1e\xf0B\x8f\xee\x06\x8f\xa1\x99\x84\x97\xb3}\x88\xa62h\xa4\x9b\x8e\xdf\xf1\xf7K\x86\xa6\x82\xb3\xb6\xec%\xe3Q\xed%\xe377+\xf3|\x05\xf8E\xad\x80\xeb\xd4xU\x95;\xf2P\xb6\xe4\xe8\x19)\x07LHr\xc8\x18\xe6\xd1&\xbam\x83\x1a\x1fv\xc1\xf1\xc4u4v\x1b\xcb\x04\xb1\xfaR\x01\xf5B\xd2\x89\xceX\xd7\x88ew\xa8d\x11\xa3\xa3\x15\x9b\xad\x02\x05\xa1\x12\x8d\x8a\x8c\xd0^\xa8\x95\xda\xefA\xa1\x91\x12\xe2k\x99\xe7\x91\x8c\xef\x0f\x81W\x16\xb1\xeam\xd5\xb6\xdc\x7f\xf4\xb0\x90\x89\xb3\xb4\x18\x18\xbf\xe79\xc8\xfe-\xfe+x\xc9w\xf4\x80\xffA\x8c\xf1\x88?\x7f'\x8e\xed\xb1	\xc7\x90\xdf\xfcE\xbd}P\x87\xea\xdb\xf3\xf7|\x8c\x16\xa9\x7f0\x02a!\xbb\x14\xfeT\x8a-nN\xfcW\xd7\x92\xe7ph\x8f\\\x0b)\xba\xa4\x9e\xe7y\xf7\xf48\xd2\xfd\xe6\xb6\xc2;\xc6\xcff\x85	\xefpq\xe0.\x14\xc41\xa0\x98*\xd1)\xed\x97\xecX\x82-\xd6\x1e\n\xb1\x88\xfe\xa4\xb9\x92\x82\xb1r\x1e_\x1a\xc6\x8bx\xfely\x8aE9?\x9b\xd4\xd2\x8e\x1fr\x89\xc8>\x86\xc7\xcbwj\xbf\xcf\x12\xf5C\xb6%\x97\xa7\xce\x80\x0ePo\x0c\xb7&K\xb4\x8e\xd1 FN\\F\xc0\x84n\x05)d]{\x94\xee\xc1\x8ab7\xa4\xdf\x81d\xfc}0vB\xa3S\x03\xa7)\xde\xd4,\xb7\xd9A\x05\xef\xe8,\xe9\x13\"\xde\x11\xe5\xce\xdf\xe975\xc4\xbb\xe1Jf9\x7f7\xb4\xcc\x80\xc8\x10\x90\xa3s\xf8\x1c2\x87\x16\xce\xea\xdbi9o\x9f1\x88\x15\"(\x1c$\xdb\x80\xc2\x9a\xe3\x7f\x8e\xc7y\x97\xc6@B\xc8\xb9mp\xc9\xdf\xc1\xad\x14\xc4V\xd455\xe5\xc9\xf0a\x9f\x8b \x90x\x18\xefa\x9f\xb3A\xc7\x9e\xf5%\xef|\xfe''\xda`\xe0\x8dF\x88\xd0:\xb4\xa4\xd2A\xacpF\xb7A\x9bT\xd7p\xa1\xe9\xee\x99!\x14\xa3\x9fP7\xde\x97\x87\xc3\x8br+\xb3\xc2y\xee\xdfr\xa94\xaen\xed\xf3J\xfd\xa0\xbf\xaf\xeb=\xd9\xf8\xd0\xb0|\x7fO\x8f\xb6E\x7f\xa5h\xa8\xc1~\xfe\xf9\xb2\xae\x83\xbd\xb1\x02ZW\xd5.\xf4f\xff1\x0e\xbf\xf8\xe2s\x08\x9e\x82\xe8\xaf\xba\x04\xd5\xbeR\x84\xd99B\xb2\xe9\x90.\x8da\xac\x9en\xc7\x91@'	\xcb\x19\xe9O\x9et\xf8H\xc6\xa3\xff\x13D\xafx\xc2c\xfe\x8e\xb5'\xc4\x04c\x9aL+\xe8^\xc8\x0e\x195a\xdc\xa7\xff\x0c\xab\xf2\xbfw\xbbF\x89\x93\x0c\xd7\xf2`\x1f\x97\xeeG\x7f6\x01!\xa8(![\x8bI\x07\x03\x08\xef|\xff\x11|*\xf7F\xc5\xd6w[dG;y\xbd\x1b\x03\x11D&\xc4\x05}\xb3\x99\xe7{\xa17\xf3\xd8\xc0\xce\xd2\x98&\xd0\x17\xe3\xf7\x82\xca\xa1a\x98\x82\xc7k\x18\xb0\xf4\x8d\x05\xcb\x07\x01\xf3\xaa\xf7\x01\xe3\x1fu\xb1\x96Y\xf9\x99{\x9fM~\x11\xde\xe0\x03\x9bR\x96\xf88\x08>\xd2\xabC\x0f\xfb|\xf6\xe8(<\xaa\x13z`\x88\xcc\xc2\xfb\xbe;#|9\x04l\x1f\xcf\xcbAT\xed\xa41\xdf\x7f7<\xc7\xb5\x81g\x1a\xb8\x01d{\xbc\xd3\n`\xa4\xa5E|?\xb8\x17\xf7\xe60\xf1\x0bj\xe3z\xeb\xdf\xad\x1a\x12\xe5\xe6UV\xc4\xca\xbb\xacI|\x88\xa6B\x1em\xe4\xc7\xb2P7\x14\xf7\xd4kK3\xc6\xaf\x15\x7fN\x14\xb7g\x00\x1c\x13\x81#\x03V\xc8\xd0\xe2\xf3n\xcer\xf6h\xce \xe86\x82\x18\x88O\xbd\x99\xc7\x11\\\xf6o\x03o\xda{+\xc6\xc3\xf1\xc4\xc3\xd6\x84m3\x90oi\xd5\xe9\x030Y2\x84\xe7\xbb\xda\x1f\xd8\x95\xe9=\xf0&{\xfe\xa0#\x06'\xc6\x8d\x06<\xa8\xefw>\xb5^V\xf1w<\x81J\xa1?\xa9k}\x07\xb1\xe3;\x83\xc2-\xea\xeeONv\x04G\x83\xaf\xc3	'D\x1dNZq\xcd\xe4\xc4\xde\xcd\x1f\x96AB\xbd\xef\x04\x0e\xf0k\xe7\x00\xf7w\xec}p3\xe1\xde\x8fe\xaf\xa1\xaa=c\xc4\xd5\xa1\x80'W\x08*\x8c\xb9!\x80\x92!\xb1E\xd8\nHR\xcb\x87\x8a\xec\xf2\xde\x8a\x83\xaa,\x89\xdd\xdc\x0e\xed\x84<S\x18\xeccS\x93i\xef\xb1\x83\x98\xf0\xdd\xf0\x00\xe1^\xce\xdf\xdb\x10\xb5\xbf\xd2\xcd\x82\xdb\x84\x86\xfe\xab1\xad\xd3\x0f\xea\xff\xda\x18\x80\xbd;q\x92\x8d97c\xab6\x9f/\xb9{W\x81\x149s\xc3\x86\xda,\x00Q\x9f\xcc\xed\xabaK\xa1\xf9\xc3\xff\xfe\xcbw \xff\xca\x02\xd2K\xc9\x06\x9e\xf0\x06Wr\"v\x9a\xd2-o$u.\x13\xdb\xc1\xab\xc04\xadl\x05\xb6\xd86~\x971\x83\xfe\x19\x1c\xa2\x0ew\x85\xb0\x03F\xfe![1\x03;\x9a\xf8[\x90\xa6h\x97^\x12\xbb\xc0\xdd\xa7y\xf4\x03\xe8+\x05\xc4J\x16\xfd\x82\xc8j\xb0\x8f\x8e\xb9j\xa8\x81\xc4\x04\xd2\xf1\xdd\xbb\xf3k\xee\x0d\xbc3\x81\x82\xa6s\xc31w\xd1D\x08S\x84J\xa6\xe1\xd1\xaa\x00\xe2\xb8A\x96q\"F\xc1B\xb0\xc5,\xf0\xeb\xcfX\xbd\x98-f\xa3\xcc\x88 \x0dy\x0b\xc6q\x17z\xb1\xa1E5G\xbc\xb3\xa4i\xbb\x8d\x0dQ\xd7X\x97\x0d\xbc_\xbcA\x1c\x0f\x06z\x98\x1d\xbe1 \xe1\x04q\xa5;\xaf]\xb1\xceS=\xe6Z\x8c\x08\x1d\xb4\xaa\x11\xdf\x1f\xbdq\xf8\xf1\xc5\xe8\xc3\x02\xd2\x82\x05\x89\x0b\x16\x8e\xbc\xc0\x04*\x8e:\xf8\x15\xbb\x1au\x10\x8c\x10\x82\x06\xb3\xc3\xf3\x84C\xfaE\xb8\x1c\xf0a\x1cJ\"\xe0_V\xd7\xca\xf7\xdb$\xb4\xc1L\xd4@\x98\xf3G\xc3\xce\xca\x9c\xc1m7\x93\xcd\xce\x12\x00\xd3\xdd\x14\xae\x8d\x18\xf9FP\xef\xfc^\xe8a\xf3\\x\x9fM\xbc\xc1z\xe0}\xf6\xcc\x9b\x9e\x8dx#6\x0d\x90\xc4	\xcf\x11\"\x024\x99\x80GY\x00\xb3\x8f{q\xdf-\x81\"\x98\x8b\x10\x026J\x9b\x81\x08\xa0\xfe\xb0^2\xed\xbdl\x06H\x07k\x0dr\x86\x06&6\xb6\xfe=\x87\xd5\xa5s~a(;\x97K\xd0\x852\x7f/?\x1e\\LCe3\x9e\xfa~G\xe2\x961\xdfGV\x90\xc2\x12\xf9\x84\xc1\xb5\xd2\x8e\xb9\x11\x84\x11\xdcxNW\xec\x98\x12\x7f\x07D\x1b\xac\x07^\xef\xbd<\xf4\x8a\xb2\xea\x01l\xc1\xaa\xdb\xc3\x84VO\xfc\x0c\x00h\xfb=S\xc4\xca\xdaZ\xa05\x07\xc1\\4\xe1Q\x170b\xa2V\x04\xc4{\x1d)\xd1#\xe9\x88\xa9s-\xfd\xc3M\x9b\xe3\xb9R$\xd3\x9b\xd3`\xdd\x96\x1c\x9d\xc9\x82 \xac\xe9\x99	8\x18\x96\x1d;\x9eh-\xa7!OW\xcf\xa6i\xa1=\x97\xe0^\x1a\xa2\x0b\x98\xd3~\xf5'xk\xc2\xa1\xbe)\x0f'W\xebO\xf0\x8e\x06u\x8c\x92MW\xcd\x9dv\xbd+HE\xdc6[EiL\xd76\xa8\xac\xeb\x86\xca\xc8\xf5`\xc3^\xd7\x17v8f\xce\xc7C'.\xc5\n2\xdf\xe4R\xfbe\xc6\xd5\\\xa0\xc2\xa3{\x14\x13\xd2Y_\xaf!I\x83\x0c\x02^\x02\xf4[\x9c\xe5\xa1\xf2a\x0f\x0e\xfaa\x0f\xda\xbb,\xa0\x0b\x13\xc9\xb0,\xe8\n\x07\x83\xa6\xe25\xd4\x9e\xce\xa91\xcf\xea\xc4\x08\xa3\xee\\\xf5u=Bm\x95\xd4\x96\x8c0G\xd4-\xc4\xd8\xa7{\x01c\xcb\xcfB\x0d\xf8~\xd7\xf0>!o\x1e\x1e\xd7u\x1a<\x1b\x8fy#nb\xa7\xf3gq\x12\xae\\O\x81\x0b\xa6\x97\x1d\xc9\x8cC\xcf;\x18\xe3\x0d\xa1F\x13\x1d+!\x87\xcf\xe9\xca\xfa\xbb\xbeDgN={3J\xdc\x8cq\xca\xe2t.\x97\xba\x058[\xc6+1\xe6q\xda\xdeT$\x83\x1e~X\xef?\xd5\xa8\xa1\xd1\xe8\"6bj\xdf\x8f\xd7\x01\xab\xeb8\x0b\xd8)\x8c\xd7\x1d\x90o\xae\xd6\xc68\x87\x1f\xd1_\xd8\xefK\x1e\x97\xfb\x03~\xf8\xbe\xf7>\xab\xd6_\xefU\xa2\x8a*\x93\xf9\x01\xd6\x9e\xf2\xc4N\xc1\xe5\xe8\xc0w\xb6\x96>h\xcb\xf7\xcf\x8fD3\x02\x0d\x07\xfd\xd8=\nu\xddV\xc7\x08\xcc\xd1\xb8\x0e\xdb\xa4\xcf\xc0\xf5\xb4\x161\xd6&`\xf0}\x9a\xc6\xc3\x87\x83\xda\x83&\x99\xad\x87\xe5N\x15AL'\x96\xc7\x04\xa7\xb1\x06x\xde\x16\xe3\xf1\xd0*\xe9Y\xf8\x89*t\xb9ROZ\x9e\xcd\xb0\x8bd	\xef&\xae\xe7\x9b\xa5p\x12\xe6\x9b\xe54n\xe4(\xbe\xbf\x1e\x9e\x8b]\xae\xa5\x05m\x15\xc6\xbbk\xe4\xfb}5\xf7\xfe~ch~\x95\xdc@n\xe8\xc1Z\xf5j\xba\xf0\xfe\xfe\xc3\xf7\xdfV\xd5\xced8A\x12h\xf0\x8a\xad/Y\x88\x0d\x87Q\xbf%~\xef\xd9\xf1\x84B\xa4$uY\xc4\x98n\x9aZ\x87\x9bCXV\xbb7\xd2z\xa4m \xba\xe3[^\x10m\x0dN\x04\xe3\xac\xeb\xb5s\xac\x85\x10_0\xf2\x8d\xe3\x99\xef\x07\xeb\xab\x08dX\x94\xe5\x8e\xc78\xdd\x9as\x8eS\xf2p\x81\xfe\x9b\xb9\xad\xf5\x85\xf8\x02KjY\x17\x90\xa2\xc7\x8dX\x1b\xf9\x0e\xcf\xc5zxU\x82\x170#_\x14\xebF\xbb\xfc\xf7\x1f\xbe\xe7\x85\xef\x17\xe7\xd8\xd6\xf7\x83\xed\xf0\xc36\x17\x85^\xcd-9=;\x15!^6\xab'\xd9\x91^\\\xb9o\xc6\xe0d\x96\xecx/<\xef\xd4\xdf\xc0\xa6\xb59\xb6\xdd-\x9fm\x84\xee`\xf6l<\x0e\xbf\x18\x7f\x11n\xe0\xde\xf2\xec\xd9\xe7\xa0h\xc4\xb3\xf1\x17\xf0A\xd1\xbd\xed\xd8Q\x01\xb7\xddL\xf8\x8e\x9d\xb6\xbe\x9f\x06\xd8\x83-\xdc{\x00I\x04\xfd\x97\xeb?K\x02\x16\x06\x99\x18\x0c\xe2\x15\xadr\x10\xa7u\x1d\xc4)$\xae\x10\xa9\x0d\x1f4\x9a\x8b\x15c\x9c\xd6^$\x8c_\xdd\xabGQ\xe59\x8e\xdc\xa0\xf1\xf8\x9e\xc79\x8f\xb7\xb0\x0e\x99\x85U\x99\xa6\xb9\xaa\x0f\xeb\xf2}\xbd\xce\x12\x05\xe3\x95\xb8@\xde|\xb0\xb8Y\n6\x0b\xe6\x8bd@\x06$,\x98\xcb\x9b_\xffm\xf9\x94\xecf\xe2\x92\xc7;1w,&\xb5Y\x93v\x83\xd0\xbf\x1b'\x08c\xe7\xa4\xf3\xcc\x87\xc9\\\xf2\xb9\xb1\xb5\xb4\xf6e\xb0\xeel>\xac?\x85\xa9d\xf2\xcc\x97\xceD\x0b\xc6\xf2\xcf[.y\xfc\xb6\x1b\xaa\x1ess\xa8\x17\xc7\xb0\x9a\x93-\xb6\xd4\xda\x9b1\xeb\x04!.\xb2\xad\xacT\x10\xe3\xf2^\x97\xef=\xfe9\xe3\xban\xe3\x1e\x94\x8a1_\xbb\xae\xca\xd3\xf4v=M\x07\x03f\x82\x01\xa5K\\\xd9\xc6P\x172\xfd\x8e\xc9\x19l\x88\x7f\xc1y\x0e\x12\xee\x95y\xd2\xd8\x9d\xe9\xb7|\xb5\xe5\xd9\xb5\x8a0C\xe4\xfaae\x0f\x08\x1f~\x1f\x89c\xb7\xd6T&\x8b8\xb0+d\xe8\x9c\xfc\x86\xa139\x00\\\x1f\x12\x8f\x1f\x82\xa4qmb\xacu\xa4\xb53>6S\xc6\x92\x9a\x01\xe3\x99\x99\xb3\xb17OB{u\xdd\xce\x92\x9d\x95\x12\x8f\xac\x0ctv\x0d\xef\x8f\x85?q\x00\xed\xc5\xee\xfe\x9e]EEwW\x0dQ\xc8/w\x15\xfb\xfd\x1b[{\xb9	\\\xf5\xdb=||\xa7\xafgpue\x89M\xbfM\xaf\x9do\x0bT\xa6\xcb\x86$G\xa1\x13\xffE\x1fs\x84\xb0-\x86\xfa7\xb7I\xd7\x0e\x86e\x96\xc1'Ge	\x17;o\xda\xe1@a\x15\xdfeI\x99\xf6\x867]]7\xb7\nM\xa8\xa6\xbaNf\x9f\x88^\x93\xccdh-U\xb2C\xe0\x85\xc6\xf1\x8a\xd9\xa05\xf3h\xa6Oe\xa8\xb7q\x19\xb0\x13\x0b/\x0e\xae\x1e\x8a\xbb\xc9\x9dUY\xc9D\xbd.\xcf\x80\xc7q\xb3r\x1f\x06h\xc7@;\xdd\xe0\x1b>fC\x8c$0Q\xf1\x1a\x10k\xdc\xaa\"\xed\x8eEHZ\x8f\xedJ\x8f6\xa5\x97B\xcc\x83\x17\xc2\x1ep: 6X\x0d\x7fA\xb8Z\x13\x0c\xc6\xc6\x12\xb4n\\'\xae\xa0N\xbc\x88o\x87\xb0C\xbe\x7fu\x11m\xa0\x1cK)h\xf5\xde4\xb2CO\x8c\xdbD\xa6\x0e\xd6H4\x03\xe1B\x0c\xb8\xeb9\x931\x9e\xf5\x85\x80\xbf\x00\xc4LB\xc2\x11\xd9P\x0b\xd2\x12\x0bA\xc7\xc9)]2\xdf\xf7\xb4\xed*\x08\xdb{v\xcc\xc5\xbd\x11\xf1P+\x8d\x13!>\xda\xces\xa6\xc7P\xd7\x01\x9a\x16\xe4n{\"\xf1\xa8\x11w\x1d\xd7\x02Ux+d[\xb3YpmV\x18+\x9e\xb0\xe3\xba\x86XC6\x10>V2\xb2\x0e\xa3\xdf\xc8CV\xa4\xbe\x7f\x960O\xe1\xc4>T\x94[\xd7\xde\xe1=\xc4J\xc0s\xe4\xecD\xf0\xe9\xfb\x89\xf1\x8c\x02\xac\xc0\x01%\xb1x)j4mm\x84\x1fFv\x82x\xd8\xc0^\xae\xfa\x99\x03sO\xc2\x8a(\"\x12v\x95\x97\xef\xc5\x1cU\x0c\xfe\xb4\x89\xfcJ\xda\xdf\xaf%\xfe\x03\x0b\x16\xdb\xd8\xaa\xdd;D\x9b\x857W\x8c.a\x9c\x9e\x1a\xd4\x0d\xcf\xe2\x96\x07\xd1U\xbe\x82!\xf9\x8fJ%\x87\xef\xe5GX\xd5\xd6\xf1\x83\x11]\xda+\xc4i\x7f\xe6\x0c\xcb\xf4/\xba&\xe9\xa1SB[\xeb3vjW\xa0oUtN1\x9b'\xac\xd3&kaI\xb2\x0d\xc58^\x0dW\xfa\x8d\x10\x1e\xf1\x0c\x06\x94\x80,\x1e\x83\xf4\x83{4\x9b\x05o\x9b\x8b\x08Ms\x8bP\x06\x19\x9c\xd1h{M\xca,\xe9\"\xa4p\xcc\xf8\xdbY\xf0Hm\xfe\x16U	\x14f\xa6\xbc\xfeb|3\x7f\xbb\x0c\x18\x0b7\x10Z1\x16\x06[\x11\xe3\xd5\x1d\x15\x07k\x04M\xd8\x0c\xe3\x07p^\xdbYP\n\xc7\xbdbK\xaf\"\xee\xc4Vk\x0d\xbb\x8eu3\xcf\x0b\xe1\x1c\xc28${\xf8Ef\xa8\x04	zf\x19\x0f\xca\xba\x9e\xb0\xc1\x0e\x9d\xe8\xdf#\xd3\xd7\xd3\x82\x9f\x95-\x06;\xc6\xf8\x96\xd4\x9aA)\x82\xadQQ\xde\x08\x8f\x1e]fO\xcbA\xc18\xea\x1f\xaar\x1b\x10\x8a\xc1\xa4\xda\x845\x94\xb7\xf6\x96\xea\x8fO6j\xfda\xa7Tb\x04\xb7Vd\xfe\x0d\x82\xbc\xb5\x92qsp\xda\xfbC5G\x88\xcf\xfbx\xd5Vv\x10d+\x9fr\x11\xabs\xff\x98\xb8O:30\x85\xf0l ?Te\xc7\xca\x0d\xa3\xb2\xa16\xceT\xabd\xc3k\xcd;t\x98s`o\xa7a\xa8\xebW\x1f<>o_Hn\xc7\xd0t\xe2\xdc\x05kk\x7fk\xdf\x9a\x8f\x97S\xeb\xe2\x0d+5\xb2y\xc2#:j\x88\x81\x06	;\x19\xbfw\xd1\x9fp\xf0pP\xbb\xec\x0f\xe4\xdf\xd8\x02\"\x9b&\xe0\xfb\x7fy(\xe8^\x81\x0d\x1d.	\x13\x9e\x10G\xa9\xd5\xe0\xa7\x0c~`\xbe\x8f\xff\xa9\x13\xa0\xbf\xc6\x1e\x1a\xeeVDn\xda\x80\xfa7\xe0\x045D\xa50\xee\x03/\xd8K\xe7\x91\x90\x03]\xb8\xdb\x94[\x94\xbal\x9e^\x9aF77S\x06\x0f52\xb3\x15\x82n8\\4\x96\x80\xa0<\xbb\x9d\xa0F\x82d\x864\x8a\\\x83\x1f\xc3\x83|\xa7\x88\xdf\x82jB\xf4\xc7\xbcy|)\xe2\x13\xc6\xa6\x01\xde\x15\xec\xc33o5L\xc0\xab?\x98\xc3 Yc\\\x89\xad9\x1e\xf2,Q/\xca\xf7E\xd8r\x03\x13\xc6)\xf9\xbfwaKL\xda\xc4\xd7t\xd0)\xc3\x9cyd\x81\xdc\xf8\xaeh\xfd\xaduK'J\xff\xe9\xa1r2\x08%X\xfa\x84\x9aj\xf3L\x83\xbf\xfd\x18\x84\x81V\xf7\xb4\x98\x0b\x0e\x0f\xe7SfW\xe1CG\xef:\xa3$Z\xb3\x02\xc7\xa2i\xd6=e\xb0\xef3\x06\xe4\x906\xc6\xbe\x1f\xd5u\x87F\xc46I\x9e<\xecI\xa8\x1dJ\xae/\xcdP\x17\x8d\x8c\"\xac\xd5r\xc0\x81\xf24M\x86\xb6\x06\x9c\x13>\xc0\x0fh6\xb6\xb6\xf2Nf\xe3\x90<k\x13\xc3\xf6'\xc0\x99\xea\xd3<\x0f3\xe7\xf7\xbc-E\xcf<\xd8\xf4&0\x0d\xceFb\xa1\x0d'\xa4\xae\x9bO\xd1\x1f3\x9b\x87\xf3=M\x86e\x0e\xb1l\x83\x94\xda\x9f\x8e\xc0\xe6\xdc4\x18\x95\x18\x897s\xa3\"6\xe1#u\xd3\xb33\x185\xc9,\xb4\x88\xa6=\xd0T\xefdQLr\xb2\xab|\xc4\x8d*\xbbfP\xa6\x10^w\x00\xd9r%\x0f:\xfb\xf50.\x0f\x81|J?\x7f\xfe\x8e\x8d\x9e\x0d\x86_\x9eN\\\xa3\x97\x10.\x1a\x1d\xcbL\x02\x1c\x0ccX\xee\x90t\x80\xa5\x9e5\x8c\x17&\x1c\xf1n_\xeeD\xcc\xa3a\xb9\xcf\xf0\xca \xfe\xc0\xf6L\x03\xe5\xea\x03\nT%\xb6Y\x1c\x1fvp\x04j\xbb\xe8\xb6><Tj\xe7\xfbn\x87\x94\xd4.#u\xcc\x0d\x05\xa2\x89#\xc6\x03\x0d\x0d\x95\xda\xcd\x9b\x01-\xeb\xbaImv\x9f\x99%\xe5\xf1\x83\xb3zM\xdcPj\xdci\xa2!G\xfaM\xae\xbe>\xeb\xfa,\xc1\xa9d\x10o\xf7r\xeb\xb6K\xb4?\x02\xdc\xb6\x04\x9b3/\x14i\xee\x15\xedv/]\x02!bl\xd6\xc7)\x13Bx\xf2\xa1*\xbd\xd98\x8cB\x89Y\xe1N\x0e\xcf\x11\x87\xfd\xee\xad[\xe7\xb6\x1en\x1a\xb5\x837\x1b\x06\xa3\x9f\x86\xa1\xebe\xf5aj\xa8/\xb9'K\x00\x11\xbf\xad\xeb\x18\xa4\n\xa5\xab\x027\xa4\xdd\x01\xd1\x96m\xc0\xa1<4\xa9\x95\x82\xa1!\x8a<\x14Y%\x12\xb3p\xf88\xa3m\xda\x05li\x9c\xb59\x8c\x1d\x10\xa1$\xbe\xa6\x05\x13\xcd\xea\xf2u{K\xb4g\x13GS_\x97:D\n\xf7V\x1f\x08W\x0f\x94^f\xa3\xefW\x16\xbc\xe1\xe4\xa7f\x9f\xae\x84\xdb\x07\xf3ea[\x0d\xf9\xbe\xff\x9b\xf5T\x81\xe0\xb0|\x0dO\x1b{\xa7\x9b\x90=\x88\xf7\x14\x97\x90\x1e\x960\xc1\xf8\xae\xa8\xd4\x1e:\xb9tXe\xf1=O\x87\x99IA\x03]AX\x13>\xdct\xdf.J3\xddfu\xf53\x02\xcd\xb8qT]\xd8\xa5\x10\xd7-\x85x\x0e\x95\xbcS\x19M\xe36\x06\xe2\x8a4\x15f\xa8B\xf3\x1b0c\x02\xc4vr\xd0\x17\x80W3Au\xddI4|\xd2l\x12\x1a\xc8!2\x99q\xe7\x88ZF\xfd\\f\xc4\x8e\x9f\x9c\xdc\xefZ\x9f\x7fe\x01\x00,\xc2P]W\xa6>\xc6NU\xca\xa5;\x8d}%\xeel\xee\x1c,\x13m\xb2\x1dX\xd6\x81y#\xdbTw\"k\xae\xb7\x81=b\xfa\x90\xb2c\xf7D\xaa\"\xb9z\x1a'\xe64\x12\x1a\x86\xde\xe7\x1a\xaf\xdc\xccw	[\xf3\x86\x84\xbcV\x96]m \x82uV\x1f\xf6D)\xf4\xbb\x18?\xde\x11\xbc\xe0\xf3\x1c~\xf3\xb0\xdeg\xc5\xfd\xdf\xf6rG<\xe7\xa1\x89\xc2J\x81\xe7\xfe\xeeq\xef\x1f\x17.\xfck\x13\x04\xc3\xb3\xedzpwm\xbb\x81\x8d\x01\xa6\x88}\x82\x08e\xcd\xe8g@\x03\xca\xe8w]g\x04L-\xa1|u\x96\x16&\xd6`05`Ed,\xe7\xd0\xf0\xeb\x16\x9c\"\"\xe6;\x14\xfe\xba\xe59)w\x9a\x88\xcc!,\x10P\xb5%.\x106V\xdfykfMi\xfb\x93S\xbb\xfbB|W\xac\xb2\"\xab>\xce\x1aL\xacBD\xcb\xb8\xe9\xc2\x85\x95\x14\x00\x13\xc7\xa3\xb6\x81\x168VF\xe01\xff\x0dPXZ\xa6\\V\x8a\xc7|\xcc'\xbcm\x8e\xf1.\xf8\x11\x82\x1c\x98\x13[$\xce\xa0\xd8S\xdb3\xeb\x82\xa2\xb9\xf1\xc8\x95\xa4!Gq\x1d\xf1#0\xe0\x05\xba\xe3Q\xcb\x16\xc5\xf65\xac\xf8\xd620\xd3x0`\x92X-\xde\x97@\xb8\xf8)\x04\x08\xe0\xc8\xb2\x0f\xb1y\xbb\xd5\xd4iH\x86r\x07\xe4b1n8\xf9\xfc\x8c\x7fdGrEi\x90t\\2\x1e\x97t\xf1\x9f\xb8\xa6J\xc3\xe3!/\xdf\x87\xff>\x1e\xf3\x95<T!4\xe6\x96\x0c	\xbf\x18\x8f\x0djh\xd8\x81fzDO\x9a\x08%\xe6\xd22e`cP\x94\xef\xd9\xa9m\xc8\xad\xa5K[\xa1\xb2\xfb5\x97.=3\xbb\x96%\x10\xff\xe8\xfd@\xd2\xd5\x1c\xea\x12\xb6\x9a\xce3\xe4\x1c1R\xf1\xceDu3\xc2\xe1\xf9\x92\xc7;v\x11.\xb9a/\xb5\x02\x88\xc4]-\xa9\x16-\xc5'&\x1dq\xa2Q\xb7\xf2\x03L\xe018fF\xc7\xfe\xa5\xb0\x04\x16\xa6;}\x19\xe2\xcaD\xb7k\xc0\xa8)\xd2F\xcf\x80\xe6!\xa2\x11\x9d\xeck\x0fV\x07\xf7\x8e\xc7\xef\xc5\xe8ME\x1e\xe7\xb9\xaa\x93z\xad\xd5i\x1f\xa0t\x9b\x85Q\x99|\xac\xe1m\x85\xd4)<\x0e\xbf*\x1f\n(\xbb\xbe\xce3UT\x7f\x81/	\xac\x18\xce\xf57\xb3\xf8\x9d\xb8\x14,C\x11\x8a\xf0\x19W\xdb	\xac\xc2Y\xb1\xe3	\xc6\x01IWc\x14\xf36\xd4}2;B\x18\x92\x0c\xabr\xc7\x11s%\x84\xc5\xe4\xaa:\x85\x94>\xd6ic\xed\xd3\x02z\x1e\x13\xe1k\x11\x7fD\xe0\x9d\x0c&1\xd4\xef\xebr\x87\xc7Z\x9d\x8f1\xdf4\xb9P\xef\xb5\xd9\xfak\xcc\xa1\xc9\xdd\xc9T\xfdC\xc7qp\xad\x16\xa2\xf2\xc3\x0fe\xa2`y\x01k\x992\xcfM\x07\xcd\x07)\xa0Q\xfb\xef\xbf\xa7\xb6\x1d@\xfb\xc5\xb70p/w\x83\xfb\x9b\x8c\x17B\xcfz\x90\xdfl\x0c\xea\xa1\xe9o\xf5\xf4\x8b\xd3)\xbc\xd8\x86\xd6\xde\xc8\xc6\xb4\xf8\x99\xacex*$\x19\xfa\xd1Je\"r\xa3\x1c\xf1\x8d\xc0\xeb\xb9\x8f\x059\n\xbbAX\xf8}\xd3\xb6\x9e\xb1\xfd\xc2\x04\x8c?K ;\x0f\xa4\x82\x15\xef\x0b\xb1\xd6\x7f\xb4qH\xbb0\xab\xec\x83J\xec\xb3\xf5\x08\xa1mC\xe3Q`\x1edz\xe6}\xc0\xe4_\x1b\xe7\x8d\xb6j\xb2[\xd3~b\xa4\x1c\xe7\x06\xba\xd2\xfbAw>\xed'\x15k\xc7\x99\x94\xea\xf0cY=O\x92\xaf(|FW\x1a\x8d\xdc&\xebe\xb9\x7f\x8d\x13\xf7\xbcH\xbeVy~\x80\x88\xe2\xbd\x8d\xad\xd9\xaa6u\xef\x0e\xe3\x94\x0c#j\xfau\xb9\xa3\xd0\x1c\x0c\x10\x9b_-\x82\xc15e@\x9f\xc1\xcd\xd7\x8e\\o\xbak\xb0sx\x88\xaa\xbd\x8c\xabC3\xc0\x9f\x0cE\xf2cY\xfdUG\x18!\x89\x80I\x85\xec\xd6\x04\x1e\xf1\xfe/\x0es#\x12\x1c\xfe\xee\x1e\xdb\xa7\xf9\xbd\xba\xeef\xe0&\xcfb\x8f\xdd\x0f\xc4\xda\xcc\xccl\x91\xfdD\xf3\xd3\x7f	\x94\xf4d\x1a\xcc\xed\x9cd\xben\x0f2\xe3\xf9\x95B\xe8\xad)\x85\x8fF\xaaL\x07\xf3^\x1f\xcc\x1c\xf22\xbc5\xa7G\xec\x9cP\x02\xfc\xf3X\x89\x16\xe9\x01\x1e5\x8f\x12^yl#\xc2\x9d\xab\x1b\x84E\x8fF/D\xbd\xc0R\x80Y\x8co_\x85\xd1*\xb9\xb8\xab\x85\x07M\xd9*\x83pf\x90\x02\x8br\xc0]\xd2\x84\x89k:\x02\xb20=\xb5/0\xc7\xef\xf0\xf6+O\xce\xef\x04\x8a\xf8h\xa6|lk^};\xb9\xdd\xcb6\xd8\xce\xd9V\x9a\xd3\xf6]\x11\xe7\x0f\x89\x89C\xf4]\xf1U\xd3.\xf4R\x9d\x83\xd1\xc4\xd4iMC\x10\xd3c\xcc\xe3O\x15C\xaf\xba\x9c\x9d me\xa4\xb72>\x9dx\xb3\xda\x8f\x88+\x9b~-\xe4z\xa0\x9c[\xe8m\x03\x01\xb5\xd0\xd8\x82<3\x91?`\x86\x83Cl\x96&\x80\x8a\xa8i\x99\x1c=y\xd6&`pP\xe0\x08\xc4B\x14m\x04\xd1\xbaNZH'\x0e\xde>\xe0\xad\xc50|\xbe\xe6\xd9\x92\xdd\xddL\xf8=\xecs\xb4\xe3%/\xa6\x9bY\x90\x8bv\x80P\xfa\x08\xb8\x9d\xedxAA\x89W\x15\xa9\x87\x9cu\xd4\xb8\xa9p\x93\xa0\xa9\x1a3~!W\xa5\x10\xe4\xc4+@\xdc\x93\x92\xf9uU\xee\x1a\xd9\xd5=\xbe\x04\xa5\xdd\xa4\xf8\x7f\xb0E\x11\xf4\xea\x94\xc1'	\xffW\xd5\x8d\x8e\xc4\x06\xbd\x8f\xf7\x00\xce\x00DJ4\x8b\x86\xf4a\xbb\xba\x87\xf8\x03\x0bv\xcf\xec\x89\xb4\"d;\xcfvK\xe9h\xf6\xcd\xe9\xb1\x07\x81\x8eH\xfb.!\xc2\x85G\x86\xed%\x00\xd6h6h\x94\xe2\xcd\xde%\"\xfe`\x8c\xed\x11d\xbd\xc1\xf8\xb3.\xfd\x12FM\x95i\x8c\x89\xdf\xb8\xcb\xf98@\xd3\xeco~\x17T\xc3\x05\xa6\xdc]9\x01\x18\x18\xf7\xba\xd7\x8d90\x86\xec\xf8t\x9d\xe6\xfe\xd1\x95\xdc\xc3\xa3\xa7\xe2Pof\xc0\x86\x88;qw\xf5\xdc-\xf8D0\x94v\x17\xcc\x92\xe9\xda0\x96\x06\xae1t\x87\x84\x88\xca\xac|\xfb\xe2\x00\xb3Z\xe5\xce!u\x8e(\x93\x0d\x16\xd2\xcd\x9a\xd9\x90-l\xcbS\x1c[B-\xf4\x1c*\xcf\xe3\xcd\xbd\xa1\xd3\x0d\xed\xd8\x0d\xac\xd5 \x8c\xd1?\x8c\xf9s\xcc\xa6\x17\x9a\x14\xf5\x9b/\x91r\xd76\xf6\xa3y5!\x15N<\xd6\xf5,\x86\x98`=[\xcf\xe3ex\x8d~]7\x04\xfd9e?WK\x18\x10\xdaTZ\xdc\xb9Z\x86r\xae\x96\xd3\xf5\xcc^~\xaf\xcb \x99\x91\xb8\xa2]\x93\x80\x85)Ofi\xe8\xa4\xbf\x06\x9f\xca\xa8\xb6Ha\x9c\xa2.b\x05k\"\xd3]f\x13\x93\xd7\xca\xd98\xc1fhdq\xd7\xd7\xd4\xd3$\xbd7\x90\\	X\xc0\x97y\x8e\x8fTxz_\xbd\x81\xd4\x8b\xedQ\\~o\xe0.\xba\xfb\xa0\x9f\x13{L\xceL\xe067\xb6\xa0\x85\xa4\xb81\x0c\xf4\x98y\xcb'^\x06\xcc8\x84\xeb\xae\xca\x87\xea\xbc++_\xb3\x08\xc5B\x1a\xb0\xd7#}A\x16'g\xe6d{\xa19\x7f\x8f\xf6\xda	\x0d\xf3\xdb\xd0\x14s\xf3\xb8\xa3\xb1\xd2\xb1\x8ap\xfdT<t\xe0\xc7L\xc8\x06 \xc0+\x9c[\xf3\xcd\x93f\x1a\xd7\x98\xa5\x0d$X\x80#DY\xc2_\n\xf6\xb69\x9d?\x07\xfe\xc7nO\xc6T\x10\xe3\xc9\xe6\xc9\xf2Nds\xd5`\xe6\xcc\xe9\xb3!\xd3\xa4\x85V\x8e\xa2\xdc|\xa6\xf84ov\xac\xe9\x98\x1c\x8d\x99\x10\xae#z#\xa0\xdd\xdd\xfb\x86\xccq\x83>\xe6l\x96\x87\xf7'\xdc\xd1T\x0fkv\xc2\xae|\x02\x98\xe5P\xbf\xdc-\xe4\xf03\xb1\xb2ou$j\x95\x15\nW\xb4\x01\x08\x98\xebP\xdaPn\x13\xf7\xb7\xa9n\x93\x02O;\xf0y|\xee\xc8\x18\xdb\xed\x85\xc4!x\x9f\x15I\xf9\x9eM\xff\xbf\x03\x00PK\x07\x08\xf21,\xa0\x90\x88\x00\x00wr\x01\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x00\x00!(\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0b\x00	\x00mustache.jsUT\x05\x00\x01\x80Cm8\xb4;]w\xdb\xb8r\xef\xfa\x15c\xde{-)\xa2)\xe7l\xfbP+\xca\x9e=\xe9\xdes\xd3\x93t\xb7\x9b\xb4}\x90}w!\x12\x92`S K\x80\xb6UG\xfd\xed=\x03\x0c>HI\xb1\xb3\xdb\xea\xc1\x16	`f0_\x98\x0fh\xfa\xeal\x00\xaf`\xdb*\xcd\xf2\x0d\xcfn\x15\\\xc0\x87j-\xf2\x8b\x92+\x05OOnh\xbf\x07\xcd\xb7u\xc94W\xf0 \xf4\x06\xfe\x85\xdd\xb3Oy#j\x8d 6Z\xd7W\xd3\xe9Z\xe8M\xbb\xcc\xf2j;\xbde\xb2\x9cF\x90\x07\xf0j:\xb8g\x0d|\xa4w0\x87\x91\xde\xd5\xbcZ\xc1\xb6*\xda\x92\xc3\xd9|\x0eI+\x0b\xbe\x12\x92\x17	\x9c\x9f\xd3H\xc6\x1f\xeb\xaa\xd1j\x0c_\xbe\xc0\xd3~6\x18\x8cV\xad\xcc\xb5\xa8$\x8c\xfc\xd8\xd3`\x00@O\x99d[\xc4\x90D\x14$\xb3h\xfc\x9e7\n\x97\xcf!\xb9\xcc\xfe1\xbb\xbc(\xf8}g\x82fk\x05sX$OOI\n\xc9~\x9f\xdc\xc4\xc35k\x14\"0\xff\xe3\x81\xbc\xda\xd6\xa2\xc4!\xfa\x16\x0f6\\\x16\xbc\x819\xd8/\x9du%g\xcd;bLx\x98\xe1\xa6\xa6S\xf8\xbc\x11\n\x84\x82\x0do8\xac\xaa\x06\x96,\xbf{`M\xa1\x0c\x1e\xa6\xc5R\x94B\xef\xacp.\xb3\x7f\xc8\x1e\xb3\x08\xba\xae~\xdd\xe8m	s\x08\x8cs\x02M\xe1^\xf0\x87\x14\xb7\xa2\x05+U\n\x8a\xcbb\x0cO\x03\x00\x00\x14Y\xc3U[jO\xf6\xc9\x95cC-\x80Xy\xd1\"(\x98\xa3`\x1d\xe2\xc4A\x0638\xb2\xc0\xc7\xc8\x0b\x80=\xf0Rq?\xa1\xe1\xbam$\xe1\xa7\x19\x03\x00\xd4\x00K\xd9\xaf\xba\xfa\xa4\x1b!\xd70\x87\x9f\x96\xb7<\xd7Y\xddT\xbaB\xc5\xca\xdc\xd8\xccM\x16\xea\x87\xa6a;\x98\x83\xf9\x9f\xd1\xb3\x1f_U\xcd\x8f,\xdf\xf8\xf1\x00\x8aF\xfcL\xdd\x88-\xcc\xc1\xe2\x8eQ6b\xeb\x89\x8b\xc0#G\x1cz\xb7\x7fz\x84\xb9'l6\xe8q L	b\xab\x96\xb7\xe3>\x83<\x1b\xb2\x9c\x95\xa5\x9db\x98\xbe\xa8\x0cS\xec~o\x12b!\xfe\xdb;*\xa3\xad\x19*\xe9\xd9\xe1\xa0\xc7\x8e\xe6T\xcb\xdb\x14\x10\x13*a\n*\xafj~H\x13\xad\xf4$\x1d.\x89\xc9\x89\x05\xff\xed8\xd1\"F(c\x01s\xb8L\xa1\xe4\x12\xe6P-o\xb3\x92\xcb\xb5\xde\xcc@\xc0\x1b|;\x83\xc9D\x04Z\xc1\xd3d\xc94t\xa5\xb8p!nR\x10\xe6+\xd1	\xb0?\xc2>U\xb3\x9c\xff\x82F;\xfd\xfb\xb5z\xf5\xe7\xa9\x11\xbf\x17\x97P\xff\xb9\x11\x9a\x9bY#e\xd4\xc5a'\xe5&\x00\x99\xe6J\xbb\x19\x1d\x01Y\x9d\"\xe9\xe0\x83\x03@J\x18T\x83V\xf7%\xa1\xc8B\xe6 \xdb\xb2\x84\xef!I\xe0\n\x0c(\xdau\xc0zL\x1c\x8e\x88\x0f|\xa5S\xf3\xed\x17\xb1\xde\xe8\xc8\xd8;\xbbL\xae\x1f\x7f\xb8L\xc6\x81\x0c\xb7\x96x4\x99:~zP8r\xad&\x7f\xa6\x91\x8e2\x18\xf7\xf7\xfeG(*\xae\xe4P\xc3\x96\xe9|\x03\xb2\x92\x17\xcb\x86\xb3;\xb4}\xc3B:\x97\xaeU\nz\xc3\xe4\x9d\x82\xdb\x7fky\xb3\xcb\x8eQ\xb1\xb8VH\xe5\xcd	Z\xfc\xb0\xa7h\xf0\xc79Nt\x00y\x0d\xc7\xf5\xac\xe1u\x89|slJ!I\xbao\x0d\xbb\xcdk\xa2\xa6\xa3\x1f\\\xe5\xac\xe6\x1fY\x0ds\xa2#9O\xae 9g\xdbz\x96\xa4fE\xf2\xc6\xbc)\xb5\x7f\xf1\xd6\xbcX\xfb\x17\xc3dx\x05\xc3\xf3\xffj+=\x1b\xd2\x9ca\x82\xaf\xfe\xf4\xdd?\xcd\x86\xde\xebzm\xb3h\xff\xf6\xf9\xe3\x07\xb7\x13\xc2N<8\xb1\xcb\xe9\xf9\xe8\xfb\xb3\xeb\x87\xc9l\xfce\xf1\xe6m2\xbc\x99\xae\xd3\x98\xa1Am\x08\x8e\xdf\xdeB\xdd\xe0\xf9\xaf\x88\x07\xc1H\xa6\xaf^\xe1\xabW\xf0CQ(\xd0\x1b\x0e\xbf\xc1\x04\x92\xdf\x12\x98\xc0o\xee\xac\x8a^\xa5\xf1x)dw\x8c\xc9\"\x1e_\x892\x1e\x87\xba\xa9j\xdeh\xc1\x15\xe8\xca [\x8b{.\x817M\xd5X2\xc8\xe7\" Vj\xdeX\x9a\xb6\\)\xb6\xe6\xb8\xaan\xaa{Qp\xd8V\x0d\x87V\xf1U[B\xc1\x97\xedz\x8dZ#\xe4\xaaj\xb6\x0c\xa3\x1b\xa3\xbb\xaf\xa6\xb1C1\xf3F<\xf5\xf1X\n\xb8\x85\x14\x90P\xc7<\xfc\x8ez\x8a\xff\xbe|\x81\xe4\x8d\x9b\xfc6!\xabE\xc5\xc1u\x18\xe3\xb8\xc1L\xd5\xa5\xd0\xa3\xe4Z&\xe3\xd4k\xab\xd2\xacA\xa3\xf8\xc8\xf4&\xdb\xb2\xc7\x11.\x83\x0b\xf8.\x85\xcbh\x9a9\xe7i\x92\x90f\x92\"\xe7k)\x84	|\x17\xcd\xcf+\xa9\xf9#\x02\xb6SU)\x8c\x87d\x8dN\x11\x98\x8b%\x90\xd0\x1cE}\xca\xc9\x13\xa0g\x1c}\x0es\x100\xa1\xddL\xe0\xb5\xb3{Z\xbe\x107\x18\x90\xe6\xe6\xd8D\x8a\xd0M\xc2\xdb\xb7\x80\xae2\xc1\x99\xc9\x18&\xd1l\xd2B\xcbM\xf4\xdeV\x1a\x11;g4d\xa0Y\xa0\xeeU$\x1f\xf7\xca\xa9\xc7\x1c\x16ft\x02\xc9\x15j+\xaeN\x1d\xde\xec\xb6\x12\x92\x04\x04I\x92\x86u7\xd1\x10q\xce\xd9\xcf\xa1\x9d|\xa8\xaa;\x05mm\xf4\xf2\x9e\x95-\x87j\x15\xe9r\xa4\xef\x18G\xc7\xea/d4\x8f\xa8\x8a\xe7cl\x7f\x17=\x1f\xd1\xe0\xb2\xaa\xee\xdaz\x84\x90S\x94G~\x97B\xc1W\xac-\xf5\x7f -N\x891\x1a\xc1IF$I\x16\xc5\x8d\xb43\xb3va\xfe\x92\xf4\xe1\x02^w%\x83\xea\x83@P\xcf\xf1\xbf\xd3\xf1\xcc\xf9R\x9cP2\xa5\xdf\xcb\x82?\xd2$\xa7\xb8\x08.\xcc\xd2\xacYs\xed\xa6,\xfc\xa2\x9bHS\x0d3\xbd\xb8R\x13\x8e\xc4\x04\xa6p\x9bBY\xe5\xac\xfc\x84o-\xf0\x87\x0d\n|\x14ik\x98\xe1\xd7[\xfb\xb8$\xaa\xbd\xde\xba\xf1\xc5\xc5\x85p\x84\x00\xdc\xa2\x81\xb8\x99\x04\xfe\x16\x03 Gs@\x15C\xa2o\x0b\xbb\xc1\xdb\xc9\xe4&\x80\xb4\xf2\xf0sm,\x11\x83\x010\xe7\xb1\xc3\xea%\xd0\xddOV\xb7j\xe3\xc0\xf8\xcd\xf8\xa91\x8e\xf3s\xa0$\x82\xa6[E\xb0\xde\xd5d\x87$\x11\xe151\xa6\xc7\x88\"\xda\x94\x9dL\xdaq@.\x85v\x96\x0e\x0c8V\x91q\x08\x05\xcc{`\x1b\xc6\x82\xd0\xce\x16\xf2\xb6i\xb8\xd4\x0eQ\xe6\xa3\"\xa2\x9e\x089\x91\x0392\xcd\x7f\x1b\x8e\x05\xe9/\xc2\xd7H%o\xc6\xb3\x98Z\xe4\x99\xc3AR\xe9[Jl^\x9d\xb5dI\xf7n`\xdf9\xe2m\xba\xf7\x89\x9b\x93\xa7k\xb0.lNA\xc8{\xdeh\xdeI\x18\x97\xedje\xf2\xdc\x84R\x0eo\x1b0\x87#\x0e\xc0\xb9,\xdcJ\x1f\x9e\x89\xff\xfe\xdaT[\xc3lU\xf3\xfc\xca\xe3\x04eiS\xb0e;\"\x17P\xdaP\xc9\x9c\xc3\x92)^@e\\V\x80e\x16\xab\x9e\xe3\xbb\xe3\xbb\x0c>o\x98\x06a\x02H\x8e\x99tY\xc2\x92\x13X^\x80\xf0S\x030\x17\x95\xf2G\xa1\xd0\xde\x15\xacX\xa90\x85h\x8c\xdaH\xe0\xdbZ\xef\xa0\x14\x8a4\xe3\x88\xc0\xf0\x8cv\x12\x9c[\x00\xf8jD\xe9\x9f\x95\xee\x185\xde|s\xaa\x80\x93/\xa38\x1b\x1c\xdf's/\x9fQdcQ\x82-V}\xe8\x01\x0ce_#\xf2eN\xefI\xc9bt\xc6\xf3X\x8b6\x93\xc7\xb3\x17Q\xe2\x17VuD\xde\xb8\x13\xfb\x1f\xb7\x1f\xb2\xfd@\xc3I\n\xbe\xc6\x89\x03\xec_\xc5\xe9\xf6\x1faEm6\x99\xa2\xf7\xbe'\x0e\xa1hj\xf1\x8b\xab\xfd\x04\x86\xba\xa0!@\xf6\x16i\x95.\xaa\xb4\x18 \x81[\x87\xfb\x8c\x1c\x08e\xb1A\x07\xd2\x0e\x0d\xa6\x8c\x96$\x07{\xef\xc9\xf74\x0b\xc9\xf1\x10\xa9v\xdea\x94\xf13\x96\xc6T\x14.Da\x81\xdbW\xf4\xca\xc4\xcb\x16\xa4]\xa4\xaa\xb6\xc9\x8d\x81\x06\xe7\x8b\xa9\x9d6A\xe4+\x9b\xee!t\x1b\x92\x03k\xd6\xed\x96K\xadRk\xba\xce\x1dlx\x88p\xe1\x17\x9eWk)\xfe\x1b\xfdB\x8d\x10\x95\x05&d^\xb6\x057\xb3WUYV\x0fB\xaeM\xcaF\xbb\x01\xb80\xf1\x1an\x1c>o\xb8\x89&\\\xd8d\x06bDX\x94\xe3\nV\xe8\xb6F\x85Pu\xc9v\xe8A\xa4\x03\x16}L\xe6\xe0\xd2\x035\x0e\xe8L	\x12??H`\xe8\x08\x10]UsiX\x95\x97\x95\xe2v\xce\xf3)\x0ff\x19*\x83\x7f\xb6\xe7\x00\xed\xb9\xf3\xa1d\xc6;EW\xa65\x85P7\xff\xc2\xa6\x1f8\xff\x13\xef\xc4}\xbai;\xc2\xd4\x15\x94\xd5\xdaP\xb6\xac\x8a\x9dc\xd4\x9aK\xde0\xf4\xdcA\xa2\x95s\xcf=\x8a\xf2J\xaa\xaa\xe4\x01\xb7I\xf3_\x86\xbbn\xb8\xe2\xcd=\x87\x07_\x97\xb0\xc2\xc0p\x1a\xd5\x8bi\xa8\xf4\x867\x0fBy\x0c\xd1\x07\xcfr&$T\xb2\xdc\x01\x83\xa7'\xcd\xd6\xfb}` \xee/Bi\\v\xf4|\x18\xf4\x9a:qd\xce\xa4|\xce\xda\xe8\x11\xe6\xfe\x9b\xabt\x87\xe8s\x1d\x0d\x1b\xa9\xe0\x9c\xb8\\\x1d\x92+T\x92\xcf\x0c\x8b\xa28oqy\x13\xe5]\xa86\xd1\x18\xfe\xe9:.\x8f2\xaf\n\xf4p\x0bZ;D\xb7GNa\x8e\xfec\x98\xe2	X\xb5\xban5\x0d\xd0\xd4\xe4Z\xba\x04\x13\xe6\xf0z\x96\x98\x99w\x9c\xd7\xa0\x1b\x96\xdf\xa1:\x90y\xa3@@\xb6\xdbe\xbcX7;x\xa2\xc2\x04\xc0\xf0Z\x06_\x94`)\x02 \xa6\x93\xca?sX\xdc\xa4\xfe`\x16\xb2\x10\xf8\xb6Z\xc5:`B\xc5\x82C\xd5\x0d\xdd\x90\x08B\x06\xb0a\xca\xf2\x87Nr\x13\x80\x08T\x1a\xac\xbd{e8\x06\xe3{\x0fDV\xf2\x13\x92\xe5\xc0\xccz@\xb0~eI\xca7\xac9\x0e\xcb\xc5\xa2XI\xa9\x15`\xd4\x19\x96\xb0\xdcT\x16V.02\xdb\xb2^\x02\x8b\xa1Gw\x87$\xach\x1f\x0fLu\xf7\"\xb4q+\xde*\xac\xee\x1b\x84*\xf3:\x81\xa5\x9e\xda\xef\xcc\xd9\xf0(\x9c\x1axp\x13\x07\xcf\xcf\xe1\xcc\xf3\x01\x1fH\xb73\x034,\xf1)\n!\xb3\xda\x18\x8f\xa3A\x166w\xcb\xb9\x9bf\x0e\xf0\x14^\xfbC\xd1\x15h\x0f\n\x88\x10\xab\x88\x9bM\x87X_\xden\xf8@\x80\xae\xf2\x16XacO\x97\xa6\xa1\xf2\xb5u\xc14\xff`Rv\xc9\x1f\xf5O\xd6\x0e\xed\xc3;\xb2\xbcXs\xb9\xfel\xed:\xb0\xd2\xdaE\xd8=\x19>V\x07\xdd\x18%\xb1X2\x9d\xfa\xddG\xf8\x82\xdd\xc7\x83\x0e\xffi\xcb\xef\xef\x90\x0e\xc5\x9fm{\xa7#\xf0>\x95\xa8~6\x12$\x8c\x00\xc3\xc4\x15\x12\xf1\x13\xb1&\xcc\xb0n\x82\xdaG\xb6\x9b\x86\xdf\xd4\"\x19\xc2\xa4\xb3e\x98\xc00\xb9\x89\x01\x0e\xaf%\xea\x1a-\x1e\xc3Sw,\x0e\x01)\x98\xa2\xa9\xe9\x89\xbaAJ\xe3j\xdcC\xb3\xef>\x1e\xf8\"\x80\xf1\xa1v\xa0\x0b\xa6\xcc\xe9\x08\xe3\x0e\xd3\xa6P\xaa\xe8	\x9b\xe4\xd1\xaf\x87D\xe1(\x80\xde4\xd5\x03\x95\x06%\x7f\x80\x1f1\xa4\x18%\x0e\xbfY\x85\x19\x92\xac4f4&%I\xc6\x875Dg\xa0\x18\xcf\x8c\x0f\x0c%Vx+\xeb'\x84|e\xe0\x87\x1d\x85\xf4l\x1f\x88\xff#\xfa\xe1z\xb9\xa8\x13\xe6\xfb\xa4\xa7[4\xcf\xc5\xbbX\xc8\xeb\xb8\xa6\xae\xfc|\xe0\xfa\xd59\x87\x89\xec\xef\xd5\x82\xf7\x94\xac\x9e\xd6\x86 \xcaHkH\xf3\xb1\xe1\xe2\xf3\x9a\xd8\xfd\x98\x83\xfc%0O\xeaUP;D\xfb\xaf\xc8\xd9yW\xc8\x14\x17\x9c\xcd\xe1\x12\xce\xcf;c\x8bc\x13\xb1\xfcfZ\xefD\xa7U\xda3\x0f\xfe\xcb\x17K\xc9\xd9\xdc\xa3|^\x8d\x87n\x93\xb8\xb4\xe8\xa9\x819\xc7$\xbf\xe7\x8d\x81\xc8\x8b\xe17\xabu\xe4\xcb\xfb\xfb\xa7\x0c\xf5\xa5:L\x8a\xd3\xcd\x8b\xfa\xe3\xfb\xde\x9b\xfdx4\x9eE\x8e\x84\xbe\xa1o#\x16g\xce\x9eb^\x05\x83J\xe2\xf0\xe8H\xc9\xc68\xba\xd4\x19G\x8a\x91\xfax\xe6\xca\x9fG\xce\xca\xdf\x0b\xb9\x03\xf4\x90g=\x9b9\xa2\xd1x\x1d\xe0\xe7\x92\x89\xaf\xabs\x80\xf8m\x9e$\xf0\x88\xeaO\xc7\xcf\x18\xdaT\x92\xf4O\x81\x83\x10\xf4\xa8\xdb\xc7=\xfch:V\xc5\xff\xf3.\xa2\xfe\xdb\x0b7\xf4\xfbvD\xed\x8b\xd7)\xe4\xa1\xa4\xf0\xb5\x86\x8c;T\x9ei\xbd\xa3\x82\xfb\xa9\xb6\xba-\xb0`>q\xd9\x0b\xad\x1f\x9b:\x17\xbd\x8b-@\xc0\xc4\xbfw\xb8<\xfb\xf2\xa8\x11\x93\xa9v\xa9t3\x12\xdd`1p\x18\xe6\xc8\x0e\xda\xe8\x90\x9a.\xc8\xbc\xd90@\xec\xc6W\x84\xb7;\x1cEX.\xcd\n\x13|\x98\x89\x06\xe8}\n\x80z\x10\xd8\xd0\x1e\xe5\xf1\xder\xa68$g\xc9\x15\xc6\xecy\xb5\xc5\xba\x86_\x01 &\x93\x008\xdca\xc0\xdeD[\x96\xb3\xd35y\x0bwNp7L\xae\xb9\xd9\xca4T\x13\xb0\xa9\xb4\xce\xe0\xe9i\xfe\xe6/\xf0\x97\xb7\xf3\xbd\x0b\xaa\x8f!\xa6]\xe2\x019\xc7\xcc\xf7p\xdb\x1d\xea(\xde}\x96@lNO\xa7\xbe(C\x81\xd9\x8b\x18\xd0\x8dY\x9fe\xc5\x9f,&\xdb\x16$\x7f\xfb\"<\xd1I\xfd,\xbf\xff\x1e#q\xce\xfc\x9b\xb1\xf5\xe2\x88g\xb1N-V.\xbf\x0dU\x1cW<\xabIO\x16Gm\xbc\xf6=k\x04[\x96\xfc\x84\x82\xecO)\xc8t\x8a\xa9vi\xa2\xd8v\xbd\xf18-\x8a\xf3gP\xf4v\x12\xe5m\xd6\xd0\x8en\xd2\x1f5_\xd9!5M\x0cvN.\xfd\xc8\x16_\x8e\x90\xce\x85\x80\xc1\x9f\x92\xd6\xd3\xa2\xa4\"\xaf%d\xc1\x1f\x7fZ\x8d\x1c\x0fS\x10!<\xb0\x91\x95\xbb\\w\xf1:v\x1e\xa7\xf2\x81!\xfa\x1fs\xea\x91\xf7\x8a\"\xa8J[\xd1\x14TM-w/\x0e\xa4\x0e\xf6A\x95\x9d\x03\x07\x8c\xd7AD\xa7\xb9\xef\xf6\xe1\xd4\xaf\xbb\x0b\xf7\xd6\xe5\x80G\x197\x9d\xc2G&l\xb5\xce\xb8\xed\xbcj\xa565\x90k\x89\xf5\x1e\xbb\xd8\xf5^(\xcd\x8a\xfb\xa3\xbe\xfc\xf0?#|O\xf3\x1d\xf7\xb1\xa3\x9e\x82\x1cw\xfa,`P\xf5\x14o29\xca\x11<\x1bQNA\xf7\x0f\xba\xcb\xf8q\"\x99\xc7\x07M\x18vka\xde9iN\x07q\xa7\xcf\xbf\x17\x9c<x\x19\xc8O3o\x92\xeb\xeb\xe4\xea\x85Z\xef\x034\\\x84\xfb\x8e$w\xd0%&\xe8M\x07:6`\xd7\x12o\xc7\xe4\xaci\x04^\x9b\xa1\xce@\xf6,$\xd9\x81\xe4jE\x18/\x1a\xc2(\xa88I\xb0\x0cA,~B\xbdk465\xbcw\x1b\x9e\xdf\x19\xf5\x8a\xca\x8aG\xcaw\xd9W\x95\xe5\x84\xab\x89\xd6\x1c\\\xab\xcb{\x1a\xf8\xb2\xbd\x1d(\xc63>22\xe58\x13\x88E\xe8\x8blq#9JW\x0eR\xc7@\xf7	\xbfD\xa7\x8d\xf5M/O2\xff/\xdc\x17\x91?\x9d\xc2\xbb\x923\x89\x97b\x98\xdc\xc5\xb25\x15Vf\x0c\x10og\xb9\xea/6\xa2L\xf2\xc9\xb4\x91=\x97\x85\x83D\xbd\x0e\xe7\xfdL\xa3\xaaj50,~\x8b\x12\xa1\\\xdb\xab]]\xf5\x1a\x0c\xbaL\x1f\x1c\xe6\x98\xc9\xb5\xecf\x97\xbeH\x9e\\\xcb=\xe4\xe6n\xe4\x08\xf3\x0c\xe2\xf5\x93\xe9.]\x01\xb9\xf0+\xc3\x89\xfd\x0c\xf6\xc9\x80J\x16\x83\xae\xc1E]\x8c(\xe3If\xd1{\x8c\x964\xc7\x904*\x0c\x9b.\x0f\xde\xb6(8]E\x8a.1N	\xd45\x96K\x92\xd9\xb5\xc4K\x7fI\x12\xb7\xfd\xdd\xd1b\x94#hL\xd4\x07\xa6~\x10\x9c\x1d\xfcJ\x80F\xb2\xb2\xea$\x08\xd1\xeb\x11\x92\xe7u\x98\x8c\"\x82]7B\xd2\xfd\x12W\x15\xea\x14\xd8\xccx\x0f\xc8\x91{\x148\xe1\xb0\x11\xfa\xefx\x0ba\xb9\x8bYK\xbf\x0d\x88\xde`G\xc9u\xc7\x80A\xc3[\x85\xb1TH!]U\xff%\xbd\xd4#\xb7\xae~%\x94\xa7{P\x98\x82\xb3\xc6T\xa3\x13\xf3\x8b\x00W\x0f\xa5\x0c\xd2f\x99i\xc8;\xd3NI\x80\x9e\x92Y_%N\xb5\xbe\xc2\xc4\x15\x9e\xbb\xe8\x0f\xfeJ\xd4\x8e\x90\x8e\x14\x88\xdfNC\xcdo \x98\xac\xe4n[\xb5*p\xe6\xa1a5\xf5\x99\x0f\xdb\x8b\xaa\x82\x07\x0e9\x93PT\x0e\x90\xeb\x14C^\xf1&7wz\x14\xd7m\x0d\xaa\xdar\x1f\xe3){\x17t\xc3dQr\xe3\x15\x8c-)\x07\x85K\x13j\x98\xab!\xf6\x8e\x15\x7f\xe4y\xab\xd1\xbe\x05]\xf6 c\xf5\xa4\x8ez?\x98\xf0*\xe6x\x1d\x15\xc1;-@\x8a\xac\\\xaf\x01\xc1\xdc\x98\xf3\x88n\x1d\xa1M\xe6w\xcey\x9b\xfe\x19}\x0fD\xc8\x1ev\x7f\x99\x87$\x1b\x95\x14\xd2n!\xc9=\x06\xe5\x8f]\x8dG\x14\xbbw\x9e\x19n\xc51$\xcf\xbe\x12E\x929\x05\xeb\x99\x82\xfd5\x8c\xb1N~A\xea[xx\xc6\xf7\xa0\xf6\xfc\x9a\xd3\xaff\xa8_\xea\xaf\x03\xa3G\xa7N\x98\x83t\x1cJ\xef\x8am\xf8\xf5\x8d\xefkup\xf4\xed\xfb\x9d\x05\xfa\x0dW\x1d\x84\xd4\xd5Q#o\xcd\x19\xe3\xe1\xd8}D^\x82L6z\x93\xc1{	\xac(D\xd4Lw\x1c\x06\x96\xe7\xbc\xc6n\xfbr\x17\x1a\xfa\xc6\x1e\xe9\x0eEsp\x1d\xe2e7!,;\x0e[\xf1\xfdF8z\xb5\xe5\xaef\n\x0dw\xd7\x15\xa4\xfb	V\xb5\xeao\xb8\xf3q\xfc\xcb\xe0'\xd7\x9aL\x81\xbd\x8c\xcf\xf4\xcb\x07w\x93\xcbP]\x1ci\xf7#\xfe\x95h\x94\x06-\xb6\x1c[\xa1B\xa1\x99(^\x1cQ\x8f\xe7\x1c\xa9\xe3\xfe\xf1f\xfet\x8a\x07\x02\xb0\xe3\xcc\x08\xfd\\\xa4\x15\x8f\xa8\x07\x0e\x1bv\x8f1&\xcf\x0eNK;\xeb\xcc\xdd\x1as\xeaJuw\xab\xb5\x0b\xc7\xc1\x9b0\x0c\xd0\x1f\x83\xf9\xd7\x8e\x08o\xf7\x83A\xc7\xa7\xf4\xa1t\x82*\xf2;\xcf\x80\xed\xda\xd2\xdf\xc4zsQ\xf2{^\x06\x86\x9bP\xcb\xfa\xa3o\xb0\xb1\xe7L	}a\xac+\xbd{\xff\xce!GS2x\xbf\x82]\xd5\x82\xe4\xe8A*\xbcTc\xd4\xba\x1f\xf09\xb1\x8f\x14\xa7\xcb%\x11\x14\xe2F\xf4\x06\xd8\xb2\xba\xe7\xe3\xd4\xc0\xc6\x1f,:\x15\xc3\xf4\x95\x81\xe25\xc3C\x0d\x94\xe6\xb5=\x93\xf4\x86K\x93\x1e\x1b\xdeX\x14\xb4&\xdc\xac9\x12\x04P#\xf4\xd4/\xff\x9c~\x90\xe0\x08\xa2\x9f>\xee\x9f^\xe4\n\xf7\xe3\xd1\xc7Vi\x96o\xf8x6\xf8\xdf\x01\x00PK\x07\x08d\xb7V3D\x11\x00\x00U:\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\xd3\xce\xc4\xbf\x84C\x00\x00\xdf\xb1\x01\x00\x0d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x00\x00\x00\x00bootstrap.cssUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\xe5@\x80o\x8c\x03\x00\x00\xd3\x08\x00\x00\x12\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\xc8C\x00\x00bootstrap_alert.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\xe4\xfaT\xa1Y\x07\x00\x00-\x16\x00\x00\x12\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x9dG\x00\x00bootstrap_modal.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\x17wy\xeb\x9b\x04\x00\x00:\x0b\x00\x00\x14\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81?O\x00\x00bootstrap_popover.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\xc6\x04\x7f]A\x05\x00\x008\x0d\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81%T\x00\x00bootstrap_tab.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(@(\xb2\xeew	\x00\x00\xf9\x1d\x00\x00\x14\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\xadY\x00\x00bootstrap_tooltip.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\xff9v\x85:\x01\x00\x00u\x02\x00\x00\n\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81oc\x00\x00dj_mon.cssUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(S\xe6\xdb\x9er\x05\x00\x00}\x0e\x00\x00	\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\xead\x00\x00dj_mon.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(Hjp\x9f\xac	\x00\x00\xe2+\x00\x00\n\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x9cj\x00\x00index.htmlUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(\xf21,\xa0\x90\x88\x00\x00wr\x01\x00\x0d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x89t\x00\x00jquery.min.jsUT\x05\x00\x01\x80Cm8PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x00\x00!(d\xb7V3D\x11\x00\x00U:\x00\x00\x0b\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81]\xfd\x00\x00mustache.jsUT\x05\x00\x01\x80Cm8PK\x05\x06\x00\x00\x00\x00\x0b\x00\x0b\x00\xfb\x02\x00\x00\xe3\x0e\x01\x00\x00\x00"
 	fs.Register(data)
 }
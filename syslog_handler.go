@@ -146,6 +146,8 @@ func message_printf(facility int,
 type syslogHandler struct {
 	to      []*net.UDPAddr
 	message string
+
+	handlerLogger
 }
 
 // <property name="facility">
@@ -261,6 +263,15 @@ func (self *syslogHandler) Perform() error {
 	return errors.New(buf.String())
 }
 
+// Render returns the message and the addresses which it would be sent to.
+func (self *syslogHandler) Render() (map[string]interface{}, error) {
+	to := make([]string, 0, len(self.to))
+	for _, addr := range self.to {
+		to = append(to, addr.String())
+	}
+	return map[string]interface{}{"to": to, "message": self.message}, nil
+}
+
 func (self *syslogHandler) send(to *net.UDPAddr) error {
 	c, e := net.DialUDP("udp", nil, to)
 	if nil != e {
@@ -268,7 +279,7 @@ func (self *syslogHandler) send(to *net.UDPAddr) error {
 	}
 	defer c.Close()
 
-	fmt.Println(c.RemoteAddr(), self.message)
+	self.log().Debug("send syslog", "to", c.RemoteAddr().String(), "message", self.message)
 	_, e = c.Write([]byte(self.message))
 	return e
 }
@@ -276,4 +287,21 @@ func (self *syslogHandler) send(to *net.UDPAddr) error {
 func init() {
 	Handlers["syslog"] = newSyslogHandler
 	Handlers["syslog_command"] = newSyslogHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "syslog",
+		Description: "send the message to the syslog servers by udp",
+		Aliases:     []string{"syslog_command"},
+		Params: []HandlerParam{{Name: "content", Type: "string", Required: true, Template: true,
+			Description: "the content of the message"},
+			{Name: "to_address", Type: "strings", Required: true,
+				Description: "the addresses of the syslog servers, they are separated by the comma"},
+			{Name: "facility", Type: "string", Allowed: sortedKeys(string_2_facility),
+				Description: "the facility, it is '-syslog.facility' if missing"},
+			{Name: "severity", Type: "string", Allowed: sortedKeys(string_2_severity),
+				Description: "the severity, it is '-syslog.severity' if missing"},
+			{Name: "timestamp", Type: "time", Description: "the time of the message, it is now if missing"},
+			{Name: "hostname", Type: "string", Description: "the hostname in the message"},
+			{Name: "tag", Type: "string", Description: "the tag in the message, it is '-syslog.tag' if missing"},
+			param_arguments},
+		TemplateArgs: default_template_args})
 }
@@ -0,0 +1,240 @@
+package delayed_job
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validator is implemented by the typed payload which checks itself after it
+// is decoded.
+type Validator interface {
+	Validate() error
+}
+
+// Register registers a handler which receives the payload as a struct, the
+// stored json is decoded into T with the following tags of the fields:
+//
+//	json:"name"            the name of the field in the payload
+//	alias:"name1,name2"    the other names of the field, such as 'user_name'
+//	default:"value"        the value if the field is missing
+//	required:"true"        the field must be present
+//	description:"text"     the description of the field in '/handlers'
+//
+// a time.Duration field accepts "5s" as well as the nanoseconds, and T is
+// validated by Validate() if it implements Validator. The metadata of the
+// handler is derived from the tags, RegisterHandlerInfo can replace it.
+func Register[T any](name string, perform func(ctx map[string]interface{}, payload T) error) {
+	var zero T
+	RegisterHandlerInfo(typedHandlerInfo(name, zero))
+	Handlers[name] = func(ctx, options map[string]interface{}) (Handler, error) {
+		handler := &typedHandler[T]{ctx: ctx, perform: perform}
+		if e := decodePayload(options, &handler.payload); nil != e {
+			return nil, e
+		}
+		return handler, nil
+	}
+}
+
+type typedHandler[T any] struct {
+	ctx     map[string]interface{}
+	payload T
+	perform func(ctx map[string]interface{}, payload T) error
+}
+
+func (self *typedHandler[T]) Perform() error {
+	return self.perform(self.ctx, self.payload)
+}
+
+func (self *typedHandler[T]) Render() (map[string]interface{}, error) {
+	return map[string]interface{}{"payload": self.payload}, nil
+}
+
+// EnqueueTyped creates a job of the registered type with the payload, options
+// are the attributes of the job such as "priority", "queue", "run_at" and
+// "handler_id".
+func EnqueueTyped[T any](client *Client, name string, payload T, options map[string]interface{}) error {
+	handler, e := payloadToMap(name, payload)
+	if nil != e {
+		return e
+	}
+
+	job := map[string]interface{}{}
+	for k, v := range options {
+		if "handler_id" == k {
+			handler[k] = v
+			continue
+		}
+		job[k] = v
+	}
+	job["handler"] = handler
+	return client.Enqueue(job)
+}
+
+func payloadToMap(name string, payload interface{}) (map[string]interface{}, error) {
+	bs, e := json.Marshal(payload)
+	if nil != e {
+		return nil, errors.New("encode payload failed, " + e.Error())
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	var args map[string]interface{}
+	if e = decoder.Decode(&args); nil != e {
+		return nil, errors.New("payload isn't a struct or a map, " + e.Error())
+	}
+	if nil == args {
+		args = map[string]interface{}{}
+	}
+	args["type"] = name
+	return args, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodePayload decodes the options into the struct which value points to, see
+// Register for the supported tags.
+func decodePayload(options map[string]interface{}, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	for reflect.Ptr == rv.Kind() {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if reflect.Struct != rv.Kind() {
+		return errors.New("payload '" + rv.Type().String() + "' isn't a struct.")
+	}
+
+	args := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		args[k] = v
+	}
+
+	var defaults []int
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if 0 != len(field.PkgPath) {
+			continue
+		}
+		name := fieldName(field)
+		if "-" == name {
+			continue
+		}
+
+		v, ok := args[name]
+		if !ok {
+			for _, alias := range strings.Split(field.Tag.Get("alias"), ",") {
+				if alias = strings.TrimSpace(alias); 0 == len(alias) {
+					continue
+				}
+				if v, ok = args[alias]; ok {
+					args[name] = v
+					break
+				}
+			}
+		}
+
+		if !ok || nil == v {
+			if _, has_default := field.Tag.Lookup("default"); has_default {
+				defaults = append(defaults, i)
+			} else if "true" == field.Tag.Get("required") {
+				return errors.New("'" + name + "' is required.")
+			}
+			continue
+		}
+
+		if s, is_string := v.(string); is_string && durationType == field.Type {
+			d, e := time.ParseDuration(s)
+			if nil != e {
+				return errors.New("'" + name + "' is invalid, " + e.Error())
+			}
+			args[name] = int64(d)
+		}
+	}
+
+	bs, e := json.Marshal(args)
+	if nil != e {
+		return errors.New("encode payload failed, " + e.Error())
+	}
+	if e = json.Unmarshal(bs, rv.Addr().Interface()); nil != e {
+		return errors.New("decode payload failed, " + e.Error())
+	}
+
+	for _, i := range defaults {
+		field := rt.Field(i)
+		if e = setFieldString(rv.Field(i), field.Tag.Get("default")); nil != e {
+			return errors.New("default value of '" + fieldName(field) + "' is invalid, " + e.Error())
+		}
+	}
+
+	if validator, ok := rv.Addr().Interface().(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	name := field.Tag.Get("json")
+	if idx := strings.IndexByte(name, ','); idx >= 0 {
+		name = name[:idx]
+	}
+	if 0 == len(name) {
+		return field.Name
+	}
+	return name
+}
+
+func setFieldString(field reflect.Value, s string) error {
+	if durationType == field.Type() {
+		d, e := time.ParseDuration(s)
+		if nil != e {
+			return e
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, e := strconv.ParseBool(s)
+		if nil != e {
+			return e
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, e := strconv.ParseInt(s, 10, field.Type().Bits())
+		if nil != e {
+			return e
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, e := strconv.ParseUint(s, 10, field.Type().Bits())
+		if nil != e {
+			return e
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, e := strconv.ParseFloat(s, field.Type().Bits())
+		if nil != e {
+			return e
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if reflect.String != field.Type().Elem().Kind() {
+			return errors.New("'" + field.Type().String() + "' is unsupported")
+		}
+		ss := strings.Split(s, ",")
+		field.Set(reflect.ValueOf(ss).Convert(field.Type()))
+	default:
+		return errors.New("'" + field.Type().String() + "' is unsupported")
+	}
+	return nil
+}
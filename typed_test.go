@@ -0,0 +1,106 @@
+package delayed_job
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type typedTestPayload struct {
+	User     string        `json:"user" alias:"user_name,userName" required:"true"`
+	Port     int           `json:"port" default:"25"`
+	Timeout  time.Duration `json:"timeout" default:"10s"`
+	Tags     []string      `json:"tags" default:"a,b"`
+	Disabled bool          `json:"disabled"`
+}
+
+func (self *typedTestPayload) Validate() error {
+	if "invalid" == self.User {
+		return errors.New("'user' is invalid.")
+	}
+	return nil
+}
+
+func TestDecodePayload(t *testing.T) {
+	var payload typedTestPayload
+	e := decodePayload(map[string]interface{}{"type": "typed_test", "userName": "u1", "timeout": "3s"}, &payload)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if "u1" != payload.User {
+		t.Error("excepted user is 'u1', actual is", payload.User)
+	}
+	if 25 != payload.Port {
+		t.Error("excepted port is 25, actual is", payload.Port)
+	}
+	if 3*time.Second != payload.Timeout {
+		t.Error("excepted timeout is 3s, actual is", payload.Timeout)
+	}
+	if 2 != len(payload.Tags) || "a" != payload.Tags[0] || "b" != payload.Tags[1] {
+		t.Error("excepted tags is [a b], actual is", payload.Tags)
+	}
+
+	payload = typedTestPayload{}
+	e = decodePayload(map[string]interface{}{"user": "u2", "port": float64(587), "timeout": float64(time.Minute)}, &payload)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if "u2" != payload.User || 587 != payload.Port || time.Minute != payload.Timeout {
+		t.Error("excepted is {u2 587 1m}, actual is", payload)
+	}
+
+	for _, test := range []struct {
+		options  map[string]interface{}
+		excepted string
+	}{{options: map[string]interface{}{}, excepted: "'user' is required."},
+		{options: map[string]interface{}{"user": "invalid"}, excepted: "'user' is invalid."},
+		{options: map[string]interface{}{"user": "u", "timeout": "abc"}, excepted: "'timeout' is invalid, time: invalid duration \"abc\""}} {
+		e = decodePayload(test.options, &typedTestPayload{})
+		if nil == e {
+			t.Error("excepted error is", test.excepted, ", actual is nil")
+		} else if test.excepted != e.Error() {
+			t.Error("excepted error is", test.excepted, ", actual is", e)
+		}
+	}
+}
+
+func TestRegisterTyped(t *testing.T) {
+	var performed *typedTestPayload
+	Register("typed_test", func(ctx map[string]interface{}, payload *typedTestPayload) error {
+		performed = payload
+		return nil
+	})
+	defer delete(Handlers, "typed_test")
+
+	args, e := payloadToMap("typed_test", &typedTestPayload{User: "u3", Port: 26, Timeout: time.Second})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if "typed_test" != args["type"] {
+		t.Error("excepted type is 'typed_test', actual is", args["type"])
+	}
+
+	handler, e := newHandler(map[string]interface{}{}, args)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if e = handler.Perform(); nil != e {
+		t.Error(e)
+		return
+	}
+	if nil == performed {
+		t.Error("excepted handler is performed, actual is not")
+		return
+	}
+	if "u3" != performed.User || 26 != performed.Port || time.Second != performed.Timeout {
+		t.Error("excepted is {u3 26 1s}, actual is", *performed)
+	}
+
+	if _, e = newHandler(map[string]interface{}{}, map[string]interface{}{"type": "typed_test"}); nil == e {
+		t.Error("excepted error is not nil, actual is nil")
+	}
+}
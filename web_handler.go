@@ -2,6 +2,7 @@ package delayed_job
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
@@ -10,7 +11,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -53,6 +54,10 @@ type webHandler struct {
 	phoneNumbers       []string
 	supportBatch       bool
 	isWebSMS           bool
+
+	result map[string]interface{}
+
+	handlerLogger
 }
 
 func newWebHandler(ctx, params map[string]interface{}) (Handler, error) {
@@ -217,7 +222,7 @@ func newWebHandler(ctx, params map[string]interface{}) (Handler, error) {
 			k := strings.TrimSpace(kvs[0])
 			v := strings.TrimSpace(kvs[1])
 			if k == "" || v == "" {
-				fmt.Println("请检一下，是不是换行了")
+				defaultLogger().Warn("请检一下，是不是换行了", "header", line)
 				continue
 			}
 
@@ -276,18 +281,18 @@ func newWebHandler(ctx, params map[string]interface{}) (Handler, error) {
 	}, nil
 }
 
-func (self *webHandler) logRequest(body interface{}, response ...[]byte) {
-	log.Println("method=", self.method)
-	log.Println("url=", self.urlStr)
-	log.Println("headers=", self.headers)
-	log.Println("password=", self.password)
-	log.Println("contentType=", self.contentType)
-	log.Println("body=", body)
-	log.Println("user=", self.user)
-	log.Println("phoneNumbers=", self.phoneNumbers)
-	log.Println("supportBatch=", self.supportBatch)
+func (self *webHandler) logRequest(level slog.Level, body interface{}, response ...[]byte) {
+	attrs := []interface{}{"method", self.method,
+		"url", self.urlStr,
+		"headers", self.headers,
+		"password", self.password,
+		"content_type", self.contentType,
+		"body", body,
+		"user", self.user,
+		"phone_numbers", self.phoneNumbers,
+		"support_batch", self.supportBatch}
 	if len(response) > 0 {
-		log.Println("response=", string(response[0]))
+		attrs = append(attrs, "response", string(response[0]))
 
 		responseBytes := response[0]
 		if bytes.HasPrefix(responseBytes, []byte("info=")) {
@@ -296,9 +301,10 @@ func (self *webHandler) logRequest(body interface{}, response ...[]byte) {
 		dst := make([]byte, len(responseBytes))
 		n, err := base64.StdEncoding.Decode(dst, responseBytes)
 		if err == nil {
-			log.Println("response decoded=", string(dst[:n]))
+			attrs = append(attrs, "response_decoded", string(dst[:n]))
 		}
 	}
+	self.log().Log(context.Background(), level, "web request", attrs...)
 }
 
 func (self *webHandler) UpdatePayloadObject(options map[string]interface{}) {
@@ -312,56 +318,81 @@ func (self *webHandler) UpdatePayloadObject(options map[string]interface{}) {
 	}
 }
 
-func (self *webHandler) Perform() error {
-	if !self.isWebSMS {
-		var body interface{}
+func (self *webHandler) Result() interface{} {
+	if nil == self.result {
+		return nil
+	}
+	return self.result
+}
+
+// webRequest is a request of the job, phone is set if the web sms is sent to
+// the phone numbers one by one.
+type webRequest struct {
+	phone string
+	body  interface{}
+}
+
+// requests generates the bodies of the requests.
+func (self *webHandler) requests() ([]webRequest, error) {
+	genRequest := func(phone string) (webRequest, error) {
+		request := webRequest{phone: phone}
 		if self.method != "GET" && self.method != "HEAD" {
 			if self.body != nil {
 				value, err := genBody("body", self.body, self.args)
 				if err != nil {
-					return err
+					return request, err
 				}
-				body = value
+				request.body = value
 			}
 		}
+		return request, nil
+	}
 
-		return self.perform(body)
+	if !self.isWebSMS {
+		request, err := genRequest("")
+		if err != nil {
+			return nil, err
+		}
+		return []webRequest{request}, nil
 	} else if self.supportBatch {
-		var body interface{}
-		if self.method != "GET" && self.method != "HEAD" {
-			if self.body != nil {
-				self.args["phone_numbers"] = self.phoneNumbers
-				self.args["phoneNumbers"] = self.phoneNumbers
-				value, err := genBody("body", self.body, self.args)
-				if err != nil {
-					return err
-				}
-				body = value
-			}
+		self.args["phone_numbers"] = self.phoneNumbers
+		self.args["phoneNumbers"] = self.phoneNumbers
+		request, err := genRequest("")
+		if err != nil {
+			return nil, err
 		}
+		return []webRequest{request}, nil
+	}
 
-		return self.perform(body)
+	requests := make([]webRequest, 0, len(self.phoneNumbers))
+	for _, phone := range self.phoneNumbers {
+		self.args["phone"] = phone
+		request, err := genRequest(phone)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
 	}
+	return requests, nil
+}
+
+func (self *webHandler) Perform() error {
 	self.failedPhoneNumbers = self.phoneNumbers
+	requests, err := self.requests()
+	if err != nil {
+		return err
+	}
+	if !self.isWebSMS || self.supportBatch {
+		return self.perform(requests[0].body)
+	}
 
 	var failed []string
 
 	var lastErr error
-	for _, phone := range self.phoneNumbers {
-		var body interface{}
-		if self.method != "GET" && self.method != "HEAD" {
-			if self.body != nil {
-				self.args["phone"] = phone
-				value, err := genBody("body", self.body, self.args)
-				if err != nil {
-					return err
-				}
-				body = value
-			}
-		}
-		err := self.perform(body)
+	for _, request := range requests {
+		err := self.perform(request.body)
 		if err != nil {
-			failed = append(failed, phone)
+			failed = append(failed, request.phone)
 			lastErr = err
 		}
 	}
@@ -369,7 +400,64 @@ func (self *webHandler) Perform() error {
 	return lastErr
 }
 
+// Render returns the requests which would be sent, the password and the
+// sensitive headers are redacted.
+func (self *webHandler) Render() (map[string]interface{}, error) {
+	requests, err := self.requests()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]interface{}, 0, len(requests))
+	for _, request := range requests {
+		req, _, err := self.newRequest(request.body)
+		if err != nil {
+			return nil, err
+		}
+
+		var body string
+		if nil != req.Body {
+			bs, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			body = string(bs)
+		}
+
+		headers := map[string]string{}
+		for k := range req.Header {
+			if isSensitive(k) {
+				headers[k] = redacted
+			} else {
+				headers[k] = req.Header.Get(k)
+			}
+		}
+
+		result := map[string]interface{}{"method": req.Method,
+			"url":     req.URL.Redacted(),
+			"headers": headers,
+			"body":    body}
+		if "" != request.phone {
+			result["phone"] = request.phone
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"requests": results}, nil
+}
+
 func (self *webHandler) perform(body interface{}) error {
+	e := self.send(body)
+	if self.isWebSMS {
+		observeDelivery("web_sms", e)
+	} else {
+		observeDelivery("http", e)
+	}
+	return e
+}
+
+// newRequest creates the http request of the body, it returns the body after
+// it is encoded.
+func (self *webHandler) newRequest(body interface{}) (*http.Request, interface{}, error) {
 	var reader io.Reader
 	if self.method != "GET" && self.method != "HEAD" {
 		if body != nil {
@@ -388,7 +476,7 @@ func (self *webHandler) perform(body interface{}) error {
 				buffer := bytes.NewBuffer(make([]byte, 0, 1024))
 				e := json.NewEncoder(buffer).Encode(body)
 				if nil != e {
-					return e
+					return nil, nil, e
 				}
 				reader = buffer
 			}
@@ -397,7 +485,7 @@ func (self *webHandler) perform(body interface{}) error {
 
 	req, e := http.NewRequest(self.method, self.urlStr, reader)
 	if e != nil {
-		return e
+		return nil, nil, e
 	}
 	if "" != self.user {
 		req.URL.User = url.UserPassword(self.user, self.password)
@@ -410,11 +498,19 @@ func (self *webHandler) perform(body interface{}) error {
 			req.Header.Set(k, fmt.Sprint(v))
 		}
 	}
+	return req, body, nil
+}
+
+func (self *webHandler) send(body interface{}) error {
+	req, body, e := self.newRequest(body)
+	if e != nil {
+		return e
+	}
 
-	log.Println("execute web:", self.method, self.urlStr)
+	self.log().Debug("execute web", "method", self.method, "url", self.urlStr)
 	resp, e := http.DefaultClient.Do(req)
 	if nil != e {
-		self.logRequest(body)
+		self.logRequest(slog.LevelWarn, body)
 		return e
 	}
 
@@ -443,7 +539,7 @@ func (self *webHandler) perform(body interface{}) error {
 	}
 
 	if !ok {
-		self.logRequest(body)
+		self.logRequest(slog.LevelWarn, body)
 
 		respBody, err := ioutil.ReadAll(resp.Body)
 		if 0 == len(respBody) {
@@ -451,34 +547,36 @@ func (self *webHandler) perform(body interface{}) error {
 		}
 		return fmt.Errorf("%v: %v", resp.StatusCode, string(respBody))
 	}
+	self.result = map[string]interface{}{"status_code": resp.StatusCode}
 	if "" == self.responseContent {
 		respBody, _ := ioutil.ReadAll(resp.Body)
-		log.Printf("response is %s", respBody)
-		self.logRequest(body)
+		self.logRequest(slog.LevelDebug, body, respBody)
+		self.result["body"] = truncateResultText(string(respBody))
 		return nil
 	}
 
 	if resp.ContentLength < 1024*1024 {
 		respBody, err := ioutil.ReadAll(resp.Body)
 		if 0 == len(respBody) {
-			self.logRequest(body)
+			self.logRequest(slog.LevelWarn, body)
 			return fmt.Errorf("failed to read body - %s", err)
 		}
 
 		if bytes.Contains(respBody, []byte(self.responseContent)) {
+			self.result["body"] = truncateResultText(string(respBody))
 			return nil
 		}
-		self.logRequest(body, respBody)
+		self.logRequest(slog.LevelWarn, body, respBody)
 		return errors.New("'" + self.responseContent + "' isn't exists in the response body:\r\n" + string(respBody))
 	}
 
 	matched, e := IsContains(resp.Body, self.responseContent)
 	if nil != e {
-		self.logRequest(body)
+		self.logRequest(slog.LevelWarn, body)
 		return errors.New("failed to read body - " + e.Error())
 	}
 	if !matched {
-		self.logRequest(body)
+		self.logRequest(slog.LevelWarn, body)
 		return errors.New("'" + self.responseContent + "' isn't exists in the response body.")
 	}
 	return nil
@@ -527,6 +625,37 @@ func init() {
 	Handlers["http_action"] = newWebHandler
 	Handlers["http_command"] = newWebHandler
 	Handlers["itsm_command"] = newWebHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "web",
+		Description: "send the http request, or the short message by the web sms api",
+		Aliases:     []string{"websms", "websms_command", "web_action", "web_command", "http", "http_action", "http_command", "itsm_command"},
+		Params: []HandlerParam{{Name: "method", Type: "string",
+			Allowed:     []string{"GET", "PUT", "POST", "DELETE", "TRACE", "HEAD", "OPTIONS", "CONNECT", "PATCH"},
+			Description: "the http method, it is required unless it is in the websms_type"},
+			{Name: "url", Type: "string", Template: true,
+				Description: "the url of the request, it is required unless it is in the websms_type"},
+			{Name: "body", Type: "any", Template: true,
+				Description: "the body of the request which is rendered with the payload, the 'body.xxx' or 'body[xxx]' fields are the form values if it is missing"},
+			{Name: "contentType", Type: "string", Description: "the content type of the body"},
+			{Name: "headers", Type: "string", Template: true, Aliases: []string{"header"},
+				Description: "the headers, one 'key: value' per line, the 'head.xxx' fields are the headers too"},
+			{Name: "attributes", Type: "any", Description: "the other 'head.xxx' fields, an object or its json text"},
+			{Name: "username", Type: "string", Aliases: []string{"user_name", "userName"}, Description: "the user of the basic auth"},
+			{Name: "password", Type: "string", Aliases: []string{"user_password", "userPassword"}, Secret: true,
+				Description: "the password of the basic auth"},
+			{Name: "response_code", Type: "int", Aliases: []string{"responseCode"},
+				Description: "the expected status code of the response"},
+			{Name: "response_content", Type: "string", Aliases: []string{"responseContent"},
+				Description: "the expected content of the response"},
+			{Name: "websms_type", Type: "string",
+				Description: "the name of the web sms api, the phone numbers are required if it is set"},
+			{Name: "phone_numbers", Type: "strings", Aliases: []string{"phoneNumbers"},
+				Description: "the phone numbers of the web sms"},
+			param_arguments},
+		TemplateArgs: []HandlerParam{template_arg_arguments, template_arg_self, template_arg_content,
+			{Name: "triggered_at", Type: "time", Description: "the time when the handler is created"},
+			{Name: "phone_numbers", Type: "strings", Description: "the phone numbers if the web sms supports the batch"},
+			{Name: "phone", Type: "string", Description: "the phone number if the web sms is sent one by one"}}})
 }
 
 func parseInterval(s string, defValue time.Duration) time.Duration {
@@ -733,7 +862,7 @@ func genBody(prefix string, body, args interface{}) (interface{}, error) {
 			m[key] = a
 		}
 	default:
-		log.Printf("参数不正确，类型为 %T\r\n", body)
+		defaultLogger().Warn("参数不正确", "type", fmt.Sprintf("%T", body))
 	}
 	return body, nil
 }
@@ -0,0 +1,406 @@
+package delayed_job
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	webhook_urls         = flag.String("webhook.urls", "", "the callback urls which are notified with the events of all jobs, separated by comma")
+	webhook_queue_urls   = flag.String("webhook.queue_urls", "", "the callback urls of the queues, such as 'q1=http://a/cb,q2=http://b/cb'")
+	webhook_events       = flag.String("webhook.events", "succeeded,retried,failed", "the events which are sent to the callback urls, separated by comma")
+	webhook_secret       = flag.String("webhook.secret", "", "the secret of the signature of the callbacks")
+	webhook_queue        = flag.String("webhook.queue", "", "the queue of the callbacks, it is the queue of the job if empty")
+	webhook_max_attempts = flag.Int("webhook.max_attempts", 10, "the max attempts of the callbacks")
+	webhook_timeout      = flag.Duration("webhook.timeout", 10*time.Second, "the timeout of the callbacks")
+)
+
+const (
+	webhook_type = "webhook"
+
+	webhook_signature_header = "X-Delayed-Job-Signature"
+	webhook_event_header     = "X-Delayed-Job-Event"
+	webhook_delivery_header  = "X-Delayed-Job-Delivery"
+)
+
+// the events which are sent to the callback urls.
+var webhook_event_names = []string{JobSucceeded, JobRetried, JobFailed}
+
+// webhookTarget is a callback url of the job, secret is the encrypted key of
+// the signature, the 'webhook.secret' is used if it is empty.
+type webhookTarget struct {
+	url    string
+	secret string
+	events []string
+}
+
+func (self *webhookTarget) accept(event string) bool {
+	return stringInSlice(self.events, event)
+}
+
+func checkWebhookURL(s string) error {
+	u, e := url.Parse(s)
+	if nil != e {
+		return errors.New("'" + s + "' is an invalid url, " + e.Error())
+	}
+	if ("http" != u.Scheme && "https" != u.Scheme) || 0 == len(u.Host) {
+		return errors.New("'" + u.Redacted() + "' isn't a http or https url")
+	}
+	return nil
+}
+
+// parseWebhook parses the 'webhook' attribute of the job, it is an url, an
+// array of urls or an object with 'url', 'events' and 'secret' (or
+// 'encrypted_secret' which is saved by encryptWebhook).
+func parseWebhook(o interface{}, events []string) ([]webhookTarget, error) {
+	switch value := o.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		var targets []webhookTarget
+		for _, u := range splitNames(value) {
+			if e := checkWebhookURL(u); nil != e {
+				return nil, e
+			}
+			targets = append(targets, webhookTarget{url: u, events: events})
+		}
+		return targets, nil
+	case []interface{}:
+		var targets []webhookTarget
+		for idx, v := range value {
+			ts, e := parseWebhook(v, events)
+			if nil != e {
+				return nil, fmt.Errorf("'webhook[%d]' is invalid, %v", idx, e)
+			}
+			targets = append(targets, ts...)
+		}
+		return targets, nil
+	case map[string]interface{}:
+		target := webhookTarget{url: stringWithDefault(value, "url", ""),
+			secret: stringWithDefault(value, "encrypted_secret", ""),
+			events: events}
+		if 0 == len(target.url) {
+			return nil, errors.New("'url' is required")
+		}
+		if e := checkWebhookURL(target.url); nil != e {
+			return nil, e
+		}
+		if secret := stringWithDefault(value, "secret", ""); 0 == len(target.secret) && 0 != len(secret) {
+			target.secret = Encrypt(secret)
+		}
+		if _, ok := value["events"]; ok {
+			target.events = stringsWithDefault(value, "events", ",", nil)
+			for _, event := range target.events {
+				if !stringInSlice(webhook_event_names, event) {
+					return nil, errors.New("event '" + event + "' is unsupported, it must be one of " + strings.Join(webhook_event_names, ", "))
+				}
+			}
+		}
+		return []webhookTarget{target}, nil
+	default:
+		return nil, fmt.Errorf("'webhook' is not an url or an object - %T", o)
+	}
+}
+
+// encryptWebhook validates the 'webhook' attribute of the job and encrypts
+// the secrets in it, the secret is saved as 'encrypted_secret', so that it
+// isn't encrypted again (such as the job is exported and imported).
+func encryptWebhook(o interface{}) (interface{}, error) {
+	if _, e := parseWebhook(o, nil); nil != e {
+		return nil, e
+	}
+	return encryptWebhookSecrets(o), nil
+}
+
+func encryptWebhookSecrets(o interface{}) interface{} {
+	switch value := o.(type) {
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, v := range value {
+			copied[i] = encryptWebhookSecrets(v)
+		}
+		return copied
+	case map[string]interface{}:
+		secret := stringWithDefault(value, "secret", "")
+		if 0 == len(secret) {
+			return value
+		}
+		copied := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			if "secret" != k {
+				copied[k] = v
+			}
+		}
+		if _, ok := copied["encrypted_secret"]; !ok {
+			copied["encrypted_secret"] = Encrypt(secret)
+		}
+		return copied
+	}
+	return o
+}
+
+// webhookTargets returns the callback urls of the job, they are the global
+// urls, the urls of its queue and its own urls, the duplicated urls are
+// removed.
+func (self *Job) webhookTargets() []webhookTarget {
+	events := splitNames(*webhook_events)
+
+	var targets []webhookTarget
+	for _, u := range splitNames(*webhook_urls) {
+		targets = append(targets, webhookTarget{url: u, events: events})
+	}
+	for _, s := range splitNames(*webhook_queue_urls) {
+		kv := strings.SplitN(s, "=", 2)
+		if 2 == len(kv) && kv[0] == self.queue && 0 != len(kv[1]) {
+			targets = append(targets, webhookTarget{url: kv[1], events: events})
+		}
+	}
+
+	if options, e := self.attributes(); nil == e {
+		own, e := parseWebhook(options["webhook"], events)
+		if nil != e {
+			self.logger().Warn("parse webhook failed", "error", e)
+		}
+		targets = append(targets, own...)
+	}
+
+	seen := map[string]int{}
+	results := targets[:0]
+	for _, target := range targets {
+		if idx, ok := seen[target.url]; ok {
+			// the later one is more specific, such as the one of the job.
+			results[idx] = target
+			continue
+		}
+		seen[target.url] = len(results)
+		results = append(results, target)
+	}
+	return results
+}
+
+// webhookPayload is the body of the callback.
+type webhookPayload struct {
+	Event       string      `json:"event"`
+	DeliveryID  string      `json:"delivery_id"`
+	At          time.Time   `json:"at"`
+	ID          int64       `json:"id"`
+	HandlerID   string      `json:"handler_id"`
+	Type        string      `json:"type"`
+	Name        string      `json:"name,omitempty"`
+	Queue       string      `json:"queue"`
+	Priority    int         `json:"priority"`
+	Attempts    int         `json:"attempts"`
+	MaxAttempts int         `json:"max_attempts"`
+	RunAt       time.Time   `json:"run_at"`
+	NextRunAt   *time.Time  `json:"next_run_at,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Result      interface{} `json:"result,omitempty"`
+}
+
+// webhookJobs creates the jobs which send the event of the job to its
+// callback urls, the callbacks are delivered by the queue, so that they are
+// retried if the callback url is unavailable. The job of the callback itself
+// doesn't have the callbacks.
+func (self *Job) webhookJobs(event string, next_run_at time.Time, e error) ([]*Job, error) {
+	info := self.info()
+	if webhook_type == info.Type {
+		return nil, nil
+	}
+	targets := self.webhookTargets()
+	if 0 == len(targets) {
+		return nil, nil
+	}
+
+	payload := webhookPayload{Event: event,
+		At:          time.Now(),
+		ID:          info.ID,
+		HandlerID:   info.HandlerID,
+		Type:        info.Type,
+		Name:        info.Name,
+		Queue:       info.Queue,
+		Priority:    info.Priority,
+		Attempts:    info.Attempts,
+		MaxAttempts: info.MaxAttempts,
+		RunAt:       info.RunAt}
+	if !next_run_at.IsZero() {
+		payload.NextRunAt = &next_run_at
+	}
+	if nil != e {
+		payload.Error = redactString(e.Error())
+	}
+	if JobSucceeded == event {
+		payload.Result = self.result()
+	}
+
+	queue := *webhook_queue
+	if 0 == len(queue) {
+		queue = self.queue
+	}
+
+	var jobs []*Job
+	for _, target := range targets {
+		if !target.accept(event) {
+			continue
+		}
+
+		payload.DeliveryID = generate_id()
+		bs, e := json.Marshal(&payload)
+		if nil != e {
+			return nil, errors.New("marshal webhook payload failed, " + e.Error())
+		}
+		handler := map[string]interface{}{"type": webhook_type,
+			"handler_id": "webhook_" + payload.DeliveryID,
+			"url":        target.url,
+			"event":      event,
+			"body":       string(bs)}
+		if 0 != len(target.secret) {
+			handler["secret"] = target.secret
+		}
+		job, e := newJob(self.backend, self.priority, 0, "", *webhook_max_attempts, queue, time.Time{}, handler, false)
+		if nil != e {
+			return nil, e
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// webhookCallbacks returns the callbacks of the event, they are created with
+// the state change of the job in a transaction. A failure of building them is
+// logged only since the job itself has been done.
+func (self *worker) webhookCallbacks(job *Job, event string, next_run_at time.Time, e error) []*Job {
+	jobs, err := job.webhookJobs(event, next_run_at, e)
+	if nil != err {
+		self.job_warn(job, "create webhook failed", "error", err)
+		return nil
+	}
+	return jobs
+}
+
+// signWebhook returns the signature of the body, it is the hex of the
+// HMAC-SHA256 with the secret, prefixed by 'sha256='.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookHandler struct {
+	url    string
+	event  string
+	body   string
+	secret string
+
+	handlerLogger
+}
+
+func newWebhookHandler(ctx, params map[string]interface{}) (Handler, error) {
+	if nil == params {
+		return nil, errors.New("params is nil")
+	}
+	handler := &webhookHandler{url: stringWithDefault(params, "url", ""),
+		event:  stringWithDefault(params, "event", ""),
+		body:   stringWithDefault(params, "body", ""),
+		secret: Decrypt(stringWithDefault(params, "secret", *webhook_secret))}
+	if 0 == len(handler.url) {
+		return nil, errors.New("'url' is required")
+	}
+	if 0 == len(handler.body) {
+		return nil, errors.New("'body' is required")
+	}
+	return handler, nil
+}
+
+func (self *webhookHandler) newRequest(ctx context.Context) (*http.Request, error) {
+	req, e := http.NewRequestWithContext(ctx, "POST", self.url, strings.NewReader(self.body))
+	if nil != e {
+		return nil, e
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if 0 != len(self.event) {
+		req.Header.Set(webhook_event_header, self.event)
+	}
+	var payload struct {
+		DeliveryID string `json:"delivery_id"`
+	}
+	if e = json.Unmarshal([]byte(self.body), &payload); nil == e && 0 != len(payload.DeliveryID) {
+		req.Header.Set(webhook_delivery_header, payload.DeliveryID)
+	}
+	if 0 != len(self.secret) {
+		req.Header.Set(webhook_signature_header, signWebhook(self.secret, []byte(self.body)))
+	}
+	return req, nil
+}
+
+func (self *webhookHandler) Perform() error {
+	e := self.send()
+	observeDelivery(webhook_type, e)
+	return e
+}
+
+func (self *webhookHandler) send() error {
+	ctx, cancel := context.WithTimeout(context.Background(), *webhook_timeout)
+	defer cancel()
+
+	req, e := self.newRequest(ctx)
+	if nil != e {
+		return e
+	}
+
+	self.log().Debug("send webhook", "url", req.URL.Redacted(), "event", self.event)
+	resp, e := http.DefaultClient.Do(req)
+	if nil != e {
+		return e
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	bs, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.New("callback '" + req.URL.Redacted() + "' failed, " + strconv.Itoa(resp.StatusCode) + " " + string(bytes.TrimSpace(bs)))
+}
+
+// Render returns the request of the callback, the signature is computed but
+// the secret isn't returned.
+func (self *webhookHandler) Render() (map[string]interface{}, error) {
+	req, e := self.newRequest(context.Background())
+	if nil != e {
+		return nil, e
+	}
+	headers := map[string]string{}
+	for k := range req.Header {
+		headers[k] = req.Header.Get(k)
+	}
+	return map[string]interface{}{"method": req.Method,
+		"url":     req.URL.Redacted(),
+		"headers": headers,
+		"body":    json.RawMessage(self.body)}, nil
+}
+
+func init() {
+	Handlers[webhook_type] = newWebhookHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: webhook_type,
+		Description: "post the signed event of a job to the callback url, it is created by the worker for the 'webhook' of the job",
+		Params: []HandlerParam{{Name: "url", Type: "string", Required: true, Description: "the callback url"},
+			{Name: "body", Type: "string", Required: true, Description: "the json of the event"},
+			{Name: "event", Type: "string", Description: "the event, one of succeeded, retried and failed"},
+			{Name: "secret", Type: "string", Secret: true,
+				Description: "the encrypted key of the signature in '" + webhook_signature_header + "', it is '-webhook.secret' if missing"}}})
+}
@@ -0,0 +1,209 @@
+package delayed_job
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWebhook(t *testing.T) {
+	events := []string{JobFailed}
+	for idx, test := range []struct {
+		value    interface{}
+		urls     string
+		events   string
+		is_error bool
+	}{{value: nil},
+		{value: "http://a/cb,http://b/cb", urls: "http://a/cb,http://b/cb", events: "failed,failed"},
+		{value: []interface{}{"http://a/cb", map[string]interface{}{"url": "http://b/cb", "events": "succeeded,failed", "secret": "s"}},
+			urls: "http://a/cb,http://b/cb", events: "failed,succeeded|failed"},
+		{value: map[string]interface{}{"events": "failed"}, is_error: true},
+		{value: "ftp://a/cb", is_error: true},
+		{value: map[string]interface{}{"url": "http://a/cb", "events": "done"}, is_error: true},
+		{value: 12, is_error: true}} {
+		targets, e := parseWebhook(test.value, events)
+		if test.is_error {
+			if nil == e {
+				t.Errorf("[%d] excepted error, actual is %v", idx, targets)
+			}
+			continue
+		}
+		if nil != e {
+			t.Errorf("[%d] %v", idx, e)
+			continue
+		}
+
+		var urls, all_events []string
+		for _, target := range targets {
+			urls = append(urls, target.url)
+			all_events = append(all_events, strings.Join(target.events, "|"))
+		}
+		if test.urls != strings.Join(urls, ",") || test.events != strings.Join(all_events, ",") {
+			t.Errorf("[%d] excepted is %v %v, actual is %v %v", idx, test.urls, test.events, urls, all_events)
+		}
+	}
+}
+
+func TestWebhookJobs(t *testing.T) {
+	restoreFlags(t, "webhook.urls", "webhook.queue_urls", "webhook.events", "webhook.queue")
+	flag.Set("webhook.urls", "http://global/cb")
+	flag.Set("webhook.queue_urls", "q1=http://q1/cb,q2=http://q2/cb")
+	flag.Set("webhook.events", "retried,failed")
+	flag.Set("webhook.queue", "callbacks")
+
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+	job, e := createJobFromMap(backend, map[string]interface{}{"queue": "q1",
+		"webhook": map[string]interface{}{"url": "http://job/cb", "events": "succeeded,failed", "secret": "abc"},
+		"handler": map[string]interface{}{"type": "test", "handler_id": "wh_1"}})
+	if nil != e {
+		t.Fatal(e)
+	}
+
+	jobs, e := job.webhookJobs(JobFailed, time.Time{}, errors.New("postgres://u:123@db/x"))
+	if nil != e {
+		t.Fatal(e)
+	}
+	var urls []string
+	for _, webhook := range jobs {
+		attributes, e := webhook.attributes()
+		if nil != e {
+			t.Fatal(e)
+		}
+		urls = append(urls, stringWithDefault(attributes, "url", ""))
+		if "callbacks" != webhook.queue {
+			t.Error("excepted queue is callbacks, actual is", webhook.queue)
+		}
+
+		var payload webhookPayload
+		if e = json.Unmarshal([]byte(stringWithDefault(attributes, "body", "")), &payload); nil != e {
+			t.Fatal(e)
+		}
+		if JobFailed != payload.Event || "wh_1" != payload.HandlerID || "q1" != payload.Queue || !strings.Contains(payload.Error, "xxxxx") || strings.Contains(payload.Error, "123") {
+			t.Error("excepted the payload of the job, actual is", payload)
+		}
+		if secret := stringWithDefault(attributes, "secret", ""); ("http://job/cb" == urls[len(urls)-1]) != ("abc" == secret) {
+			t.Error("excepted secret of the job is abc, actual is", secret)
+		}
+	}
+	if "http://global/cb,http://q1/cb,http://job/cb" != strings.Join(urls, ",") {
+		t.Error("excepted urls are global, queue and job, actual is", urls)
+	}
+
+	if jobs, e = job.webhookJobs(JobSucceeded, time.Time{}, nil); nil != e {
+		t.Fatal(e)
+	} else if 1 != len(jobs) {
+		t.Error("excepted only the job accepts succeeded, actual is", len(jobs))
+	}
+
+	if 0 == len(jobs) {
+		return
+	}
+	if callbacks, e := jobs[0].webhookJobs(JobFailed, time.Time{}, errors.New("a")); nil != e || 0 != len(callbacks) {
+		t.Error("excepted no callbacks of the callback, actual is", callbacks, e)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	restoreFlags(t, "webhook.secret")
+	flag.Set("webhook.secret", "global_secret")
+
+	var signature, event string
+	var body []byte
+	code := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Delayed-Job-Signature")
+		event = r.Header.Get("X-Delayed-Job-Event")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	payload := `{"event": "failed", "delivery_id": "d1"}`
+	handler, e := newHandler(nil, map[string]interface{}{"type": "webhook", "url": srv.URL, "event": "failed", "body": payload})
+	if nil != e {
+		t.Fatal(e)
+	}
+	if e = handler.Perform(); nil != e {
+		t.Fatal(e)
+	}
+	if payload != string(body) || "failed" != event || signWebhook("global_secret", []byte(payload)) != signature {
+		t.Error("excepted the signed payload is posted, actual is", string(body), event, signature)
+	}
+
+	output, e := handler.(Renderer).Render()
+	if nil != e {
+		t.Fatal(e)
+	}
+	if headers := output["headers"].(map[string]string); "d1" != headers["X-Delayed-Job-Delivery"] || signature != headers["X-Delayed-Job-Signature"] {
+		t.Error("excepted headers are rendered, actual is", headers)
+	}
+
+	code = http.StatusServiceUnavailable
+	if e = handler.Perform(); nil == e || !strings.Contains(e.Error(), "503") {
+		t.Error("excepted error is 503, actual is", e)
+	}
+
+	if _, e = newHandler(nil, map[string]interface{}{"type": "webhook", "body": payload}); nil == e {
+		t.Error("excepted error if url is missing")
+	}
+}
+
+func TestEncryptWebhook(t *testing.T) {
+	old_encrypt, old_decrypt := Encrypt, Decrypt
+	Encrypt = func(s string) string {
+		return "enc:" + s
+	}
+	Decrypt = func(s string) string {
+		return strings.TrimPrefix(s, "enc:")
+	}
+	defer func() {
+		Encrypt, Decrypt = old_encrypt, old_decrypt
+	}()
+
+	backend := &dbBackend{ctx: map[string]interface{}{}}
+	job, e := createJobFromMap(backend, map[string]interface{}{
+		"webhook": map[string]interface{}{"url": "http://job/cb", "secret": "abc"},
+		"handler": map[string]interface{}{"type": "test"}})
+	if nil != e {
+		t.Fatal(e)
+	}
+	webhook, _ := job.handler_attributes["webhook"].(map[string]interface{})
+	if _, ok := webhook["secret"]; ok || "enc:abc" != webhook["encrypted_secret"] || strings.Contains(job.handler, `"abc"`) {
+		t.Error("excepted the secret is encrypted, actual is", job.handler)
+	}
+	if again, _ := encryptWebhook(webhook); "enc:abc" != again.(map[string]interface{})["encrypted_secret"] {
+		t.Error("excepted the secret isn't encrypted again, actual is", again)
+	}
+
+	jobs, e := job.webhookJobs(JobFailed, time.Time{}, errors.New("a"))
+	if nil != e || 1 != len(jobs) {
+		t.Fatal("excepted is one callback, actual is", jobs, e)
+	}
+	attributes, e := jobs[0].attributes()
+	if nil != e {
+		t.Fatal(e)
+	}
+	if "enc:abc" != attributes["secret"] {
+		t.Error("excepted the secret of the callback is encrypted, actual is", attributes["secret"])
+	}
+	handler, e := newHandler(nil, attributes)
+	if nil != e {
+		t.Fatal(e)
+	}
+	if "abc" != handler.(*webhookHandler).secret {
+		t.Error("excepted the secret is decrypted, actual is", handler.(*webhookHandler).secret)
+	}
+
+	_, e = createJobFromMap(backend, map[string]interface{}{
+		"webhook": map[string]interface{}{"url": "cb"},
+		"handler": map[string]interface{}{"type": "test"}})
+	if pe, ok := e.(*payloadError); !ok || 1 != len(pe.Fields) || "webhook" != pe.Fields[0].Field {
+		t.Error("excepted the field error of webhook, actual is", e)
+	}
+}
@@ -1,6 +1,7 @@
 package delayed_job
 
 import (
+	"encoding/json"
 	"errors"
 	"strings"
 	"sync"
@@ -119,8 +120,33 @@ func (self *weixinHandler) Perform() error {
 	return nil
 }
 
+// Render returns the message which would be sent to the weixin api.
+func (self *weixinHandler) Render() (map[string]interface{}, error) {
+	bs, e := json.Marshal(&self.msg)
+	if nil != e {
+		return nil, e
+	}
+	return map[string]interface{}{"corp_id": self.corp_id,
+		"message": json.RawMessage(bs)}, nil
+}
+
 func init() {
 	Handlers["weixin"] = newWeixinHandler
 	Handlers["weixin_action"] = newWeixinHandler
 	Handlers["weixin_command"] = newWeixinHandler
+
+	RegisterHandlerInfo(HandlerInfo{Type: "weixin",
+		Description: "send the text message by the weixin work api",
+		Aliases:     []string{"weixin_action", "weixin_command"},
+		Params: []HandlerParam{{Name: "content", Type: "string", Required: true, Template: true,
+			Description: "the content of the message"},
+			{Name: "agent_id", Type: "int", Required: true, Description: "the id of the application"},
+			{Name: "corp_id", Type: "string", Description: "the id of the corporation"},
+			{Name: "corp_secret", Type: "string", Secret: true, Description: "the secret of the application"},
+			{Name: "target_type", Type: "string",
+				Description: "the type of the targets, 'department', 'party' or 'tag', the targets are the users otherwise"},
+			{Name: "targets", Type: "strings", Aliases: []string{"userList", "departmentList", "tagList"},
+				Description: "the ids of the targets, they are separated by the comma"},
+			param_arguments},
+		TemplateArgs: default_template_args})
 }
@@ -2,12 +2,14 @@ package delayed_job
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"expvar"
 	"flag"
 	"io"
 	"log"
+	"log/slog"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -31,6 +33,8 @@ var (
 	default_queues              = flag.String("queues", "", "the queue name of worker")
 	default_exit_on_complete    = flag.Bool("exit_on_complete", false, "exit worker while jobs complete")
 	default_destroy_failed_jobs = flag.Bool("destroy_failed_jobs", false, "the failed jobs are destroyed after too many attempts")
+	default_expire_interval     = flag.Duration("expire_interval", 1*time.Minute, "the interval of checking the expired jobs")
+	default_prune_interval      = flag.Duration("prune_interval", 10*time.Minute, "the interval of removing the expired results and idempotency keys")
 )
 
 var work_error = expvar.NewString("worker")
@@ -56,37 +60,68 @@ type worker struct {
 	queues       []string
 	read_ahead   int
 
+	// Jobs waiting past run_at gain one priority point every priority_aging_rate,
+	// but never beyond priority_aging_floor, so low-priority jobs are not starved.
+	priority_aging_rate  time.Duration
+	priority_aging_floor int
+
 	// By default failed jobs are destroyed after too many attempts. If you want to keep them around
 	// (perhaps to inspect the reason for the failure), set this to false.
 	destroy_failed_jobs bool
 	exit_on_complete    bool
 
+	// the expired jobs are checked every expire_interval, next_expire is the
+	// time of the next check.
+	expire_interval time.Duration
+	next_expire     time.Time
+
+	// the expired results and idempotency keys are removed every
+	// prune_interval.
+	prune_interval time.Duration
+	next_prune     time.Time
+
 	name string
 
 	shutdown chan int
 	wait     sync.WaitGroup
 
+	// the options which are changed by the reload of config, they are applied
+	// before the next reservation.
+	reload_lock    sync.Mutex
+	reload_options map[string]interface{}
+	reload_signal  chan struct{}
+
 	closes []io.Closer
 }
 
 func newWorker(options map[string]interface{}) (*worker, error) {
+	opts := DefaultOptions()
+	merged := opts.workerOptions()
+	for k, v := range options {
+		merged[k] = v
+	}
+	return newWorkerWithOptions(opts, merged)
+}
+
+func newWorkerWithOptions(opts *Options, options map[string]interface{}) (*worker, error) {
 	ctx := map[string]interface{}{}
-	backend, e := newBackend(*db_drv, *db_url, ctx)
+	backend, e := opts.newBackend(ctx)
 	if nil != e {
 		return nil, e
 	}
 
-	redis_client, e := newRedis(*redisAddress, *redisPassword)
+	redis_client, e := newRedis(opts.RedisAddress, opts.RedisPassword)
 	if nil != e {
+		backend.Close()
 		return nil, e
 	}
 
 	ctx["redis"] = redis_client
-	ctx["backend"] = backend
 
 	w := &worker{ctx: ctx,
-		backend:  backend,
-		shutdown: make(chan int)}
+		backend:       backend,
+		shutdown:      make(chan int),
+		reload_signal: make(chan struct{}, 1)}
 	w.initialize(options)
 
 	w.closes = append(w.closes, redis_client)
@@ -95,10 +130,12 @@ func newWorker(options map[string]interface{}) (*worker, error) {
 }
 
 func (w *worker) RunForever() {
+	w.before_fork()
 	w.serve(false)
 }
 
 func (w *worker) start() {
+	w.before_fork()
 	w.wait.Add(1)
 	go w.serve(true)
 }
@@ -119,27 +156,129 @@ func (self *worker) innerClose() {
 	}
 }
 
+// initialize applies the options to the worker, the option which is missing
+// keeps the current value, so the options should be filled by
+// Options.workerOptions which is derived from DefaultOptions.
 func (self *worker) initialize(options map[string]interface{}) {
-	self.min_priority = intWithDefault(options, "min_priority", *default_min_priority)
-	self.max_priority = intWithDefault(options, "max_priority", *default_max_priority)
-	self.max_attempts = intWithDefault(options, "max_attempts", *default_max_attempts)
-	self.max_run_time = durationWithDefault(options, "max_run_time", *default_max_run_time)
-	self.sleep_delay = durationWithDefault(options, "sleep_delay", *default_sleep_delay)
-	self.read_ahead = intWithDefault(options, "read_ahead", *default_read_ahead)
-	if 0 == len(*default_queues) {
-		self.queues = stringsWithDefault(options, "queues", ",", nil)
-	} else {
-		self.queues = stringsWithDefault(options, "queues", ",", strings.Split(*default_queues, ","))
-	}
-
-	self.exit_on_complete = boolWithDefault(options, "exit_on_complete", *default_exit_on_complete)
-	self.destroy_failed_jobs = boolWithDefault(options, "destroy_failed_jobs", *default_destroy_failed_jobs)
+	self.min_priority = intWithDefault(options, "min_priority", self.min_priority)
+	self.max_priority = intWithDefault(options, "max_priority", self.max_priority)
+	self.max_attempts = intWithDefault(options, "max_attempts", self.max_attempts)
+	self.max_run_time = durationWithDefault(options, "max_run_time", self.max_run_time)
+	self.sleep_delay = durationWithDefault(options, "sleep_delay", self.sleep_delay)
+	self.read_ahead = intWithDefault(options, "read_ahead", self.read_ahead)
+	self.priority_aging_rate = durationWithDefault(options, "priority_aging_rate", self.priority_aging_rate)
+	self.priority_aging_floor = intWithDefault(options, "priority_aging_floor", self.priority_aging_floor)
+	self.syncPriorityAging()
+	self.queues = stringsWithDefault(options, "queues", ",", self.queues)
+
+	self.exit_on_complete = boolWithDefault(options, "exit_on_complete", self.exit_on_complete)
+	self.destroy_failed_jobs = boolWithDefault(options, "destroy_failed_jobs", self.destroy_failed_jobs)
+	self.expire_interval = durationWithDefault(options, "expire_interval", self.expire_interval)
+	self.prune_interval = durationWithDefault(options, "prune_interval", self.prune_interval)
 
 	// Every worker has a unique name which by default is the pid of the process. There are some
 	// advantages to overriding this with something which survives worker restarts:  Workers can
 	// safely resume working on tasks which are locked by themselves. The worker will assume that
 	// it crashed before.
-	self.name = *name_prefix + "_pid:" + strconv.FormatInt(int64(os.Getpid()), 10)
+	self.name = stringWithDefault(options, "name", defaultWorkerName(stringWithDefault(options, "name_prefix", "")))
+}
+
+func defaultWorkerName(prefix string) string {
+	return prefix + "_pid:" + strconv.FormatInt(int64(os.Getpid()), 10)
+}
+
+// reloadFlags applies the changed flags of the worker options and the redis
+// connection, the worker options take effect before the next reservation.
+func (self *worker) reloadFlags(changed map[string]bool) []string {
+	var applied []string
+	options := map[string]interface{}{}
+	for k, v := range DefaultOptions().workerOptions() {
+		if changed[k] {
+			options[k] = v
+			applied = append(applied, k)
+		}
+	}
+	if 0 != len(options) {
+		self.reload_lock.Lock()
+		if nil == self.reload_options {
+			self.reload_options = map[string]interface{}{}
+		}
+		for k, v := range options {
+			self.reload_options[k] = v
+		}
+		self.reload_lock.Unlock()
+
+		select {
+		case self.reload_signal <- struct{}{}:
+		default:
+		}
+	}
+
+	if changed["result_ttl"] {
+		self.backend.result_ttl = *result_ttl
+		applied = append(applied, "result_ttl")
+	}
+
+	if changed["redis.address"] || changed["redis.password"] {
+		if client, ok := self.ctx["redis"].(*redis_gateway); ok && nil != client {
+			client.reset(*redisAddress, *redisPassword)
+			applied = append(applied, "redis.address", "redis.password")
+		}
+	}
+	return applied
+}
+
+func (self *worker) applyReloadOptions() {
+	self.reload_lock.Lock()
+	options := self.reload_options
+	self.reload_options = nil
+	self.reload_lock.Unlock()
+
+	for k := range options {
+		switch k {
+		case "min_priority":
+			self.min_priority = intWithDefault(options, k, self.min_priority)
+		case "max_priority":
+			self.max_priority = intWithDefault(options, k, self.max_priority)
+		case "max_attempts":
+			self.max_attempts = intWithDefault(options, k, self.max_attempts)
+		case "max_run_time":
+			self.max_run_time = durationWithDefault(options, k, self.max_run_time)
+		case "sleep_delay":
+			self.sleep_delay = durationWithDefault(options, k, self.sleep_delay)
+		case "read_ahead":
+			self.read_ahead = intWithDefault(options, k, self.read_ahead)
+		case "priority_aging_rate":
+			self.priority_aging_rate = durationWithDefault(options, k, self.priority_aging_rate)
+		case "priority_aging_floor":
+			self.priority_aging_floor = intWithDefault(options, k, self.priority_aging_floor)
+		case "queues":
+			self.queues = stringsWithDefault(options, k, ",", nil)
+		case "exit_on_complete":
+			self.exit_on_complete = boolWithDefault(options, k, self.exit_on_complete)
+		case "destroy_failed_jobs":
+			self.destroy_failed_jobs = boolWithDefault(options, k, self.destroy_failed_jobs)
+		case "expire_interval":
+			self.expire_interval = durationWithDefault(options, k, self.expire_interval)
+			self.next_expire = time.Time{}
+		case "prune_interval":
+			self.prune_interval = durationWithDefault(options, k, self.prune_interval)
+			self.next_prune = time.Time{}
+		}
+	}
+	if 0 != len(options) {
+		self.syncPriorityAging()
+		self.say("worker options are reloaded")
+	}
+}
+
+// syncPriorityAging copies the priority aging of the worker to its backend,
+// so that the listing of the console shows the order of the reservation.
+func (self *worker) syncPriorityAging() {
+	if nil != self.backend {
+		self.backend.priority_aging_rate = self.priority_aging_rate
+		self.backend.priority_aging_floor = self.priority_aging_floor
+	}
 }
 
 // func (self *worker) reset() {
@@ -151,32 +290,16 @@ func (self *worker) initialize(options map[string]interface{}) {
 // 	self.destroy_failed_jobs = true
 // }
 
+// before_fork fires the before_fork event in the goroutine which starts the
+// worker.
 func (self *worker) before_fork() {
-	// unless @files_to_reopen
-	//   @files_to_reopen = []
-	//   ObjectSpace.each_object(File) do |file|
-	//     @files_to_reopen << file unless file.closed?
-	//   }
-	// }
-
-	//backend.before_fork
+	self.backend.lifecycle.fire(EventBeforeFork, &JobInfo{}, nil)
 }
 
+// after_fork fires the after_fork event in the goroutine of the worker before
+// it reserves the first job.
 func (self *worker) after_fork() {
-	// // Re-open file handles
-	// @files_to_reopen.each do |file|
-	//   begin
-	//     file.reopen file.path, "a+"
-	//     file.sync = true
-	//   rescue ::Exception
-	//   }
-	// }
-
-	//backend.after_fork()
-}
-
-func (self *worker) lifecycle() {
-	//@lifecycle ||= Delayed::Lifecycle.new
+	self.backend.lifecycle.fire(EventAfterFork, &JobInfo{}, nil)
 }
 
 func (self *worker) serve(in_goroutine bool) {
@@ -184,6 +307,7 @@ func (self *worker) serve(in_goroutine bool) {
 		defer self.wait.Done()
 	}
 
+	self.after_fork()
 	self.say("Starting job worker")
 
 	//self.before_execute()
@@ -191,12 +315,27 @@ func (self *worker) serve(in_goroutine bool) {
 
 	is_running := true
 	for is_running {
+		self.applyReloadOptions()
+
+		if now := time.Now(); !now.Before(self.next_expire) {
+			self.next_expire = now.Add(self.expire_interval)
+			if e := self.expire_jobs(); nil != e {
+				self.log().Error("expire jobs failed", "error", e)
+				work_error.Set(e.Error())
+			}
+		}
+
+		if now := time.Now(); !now.Before(self.next_prune) {
+			self.next_prune = now.Add(self.prune_interval)
+			self.prune()
+		}
+
 		for is_running {
 			now := time.Now()
 
 			success, failure, e := self.work_off(10)
 			if nil != e {
-				log.Println(e)
+				self.log().Error("work off failed", "error", e)
 				work_error.Set(e.Error())
 				break
 			}
@@ -216,17 +355,41 @@ func (self *worker) serve(in_goroutine bool) {
 		select {
 		case <-self.shutdown:
 			is_running = false
-		case <-time.After(self.sleep_delay):
+		case <-self.reload_signal:
+		case <-time.After(self.next_delay()):
 		}
 	}
 }
 
+// Sleep until the earliest upcoming run_at, but no longer than sleep_delay.
+func (self *worker) next_delay() time.Duration {
+	next_run_at, e := self.backend.nextRunAt(self)
+	if nil != e {
+		self.log().Error("read next run_at failed", "error", e)
+		return self.sleep_delay
+	}
+	if next_run_at.IsZero() {
+		return self.sleep_delay
+	}
+
+	delay := next_run_at.Sub(self.backend.db_time_now())
+	if delay < 0 {
+		return 0
+	}
+	if delay > self.sleep_delay {
+		return self.sleep_delay
+	}
+	return delay
+}
+
 // Do num jobs and return stats on success/failure.
 // Exit early if interrupted.
 func (self *worker) work_off(num int) (int, int, error) {
 	success, failure := 0, 0
 
 	for i := 0; i < num; i++ {
+		self.applyReloadOptions()
+
 		ok, e := self.reserve_and_run_one_job()
 		if nil != e {
 			if jobs_is_empty == e {
@@ -261,12 +424,24 @@ func (self *worker) reserve_and_run_one_job() (bool, error) {
 }
 
 func (self *worker) run(job *Job) (bool, error) {
+	if job.isExpired(self.backend.db_time_now()) {
+		return false, self.expired(job)
+	}
+
 	self.job_say(job, "RUNNING")
 	now := time.Now()
-	e := job.invokeJob()
+	info := job.info()
+	if !job.run_at.IsZero() {
+		metric_queue_lag.observe(math.Max(0, self.backend.db_time_now().Sub(job.run_at).Seconds()), info.Queue)
+	}
+	publishJobEvent(JobStarted, info, nil)
+	self.backend.lifecycle.fire(EventBeforePerform, info, nil)
+	e := job.invokeJobWith(self.backend.lifecycle, info)
+	metric_job_duration.observe(time.Now().Sub(now).Seconds(), info.Queue, info.Type)
 	if nil != e {
+		self.backend.lifecycle.fire(EventAfterFailure, info, e)
 		if isDeserializationError(e) {
-			self.job_say(job, "FAILED (", job.attempts, " prior attempts) with ", e)
+			self.job_warn(job, "FAILED", "error", e)
 			e = self.failed(job, e)
 		} else {
 			e = self.handle_failed_job(job, e)
@@ -274,43 +449,148 @@ func (self *worker) run(job *Job) (bool, error) {
 		return false, e // work failed
 	}
 
+	self.save_result(job, "completed", "")
+	metric_jobs_succeeded.inc(info.Queue, info.Type)
+	publishJobEvent(JobSucceeded, info, nil)
+	self.backend.lifecycle.fire(EventAfterSuccess, info, nil)
+	callbacks := self.webhookCallbacks(job, JobSucceeded, time.Time{}, nil)
+
 	if next_time, need := job.needReschedule(); need {
-		e = job.rescheduleIt(next_time, "")
+		e = job.rescheduleIt(next_time, "", callbacks...)
 		return true, e
 	}
 
-	e = job.destroyIt()
-	self.job_say(job, "COMPLETED after ", time.Now().Sub(now))
+	e = job.destroyIt(callbacks...)
+	self.job_say(job, "COMPLETED", "duration", time.Now().Sub(now))
 	return true, e // did work
 }
 
 func (self *worker) failed(job *Job, e error) error {
+	self.save_result(job, "failed", e.Error())
+	info := job.info()
+	metric_jobs_failed.inc(info.Queue, info.Type)
+	publishJobEvent(JobFailed, info, e)
+	self.backend.lifecycle.fire(EventPermanentFailure, info, e)
+	callbacks := self.webhookCallbacks(job, JobFailed, time.Time{}, e)
 	if self.destroy_failed_jobs {
-		self.job_say(job, "REMOVED permanently because of attempts = ", job.attempts, "and max_attempts = ", self.get_max_attempts(job), " consecutive failures")
-		return job.destroyIt()
+		self.job_warn(job, "REMOVED permanently because of consecutive failures", "max_attempts", self.get_max_attempts(job))
+		return job.destroyIt(callbacks...)
 	} else {
-		self.job_say(job, "STOPPED permanently because of attempts = ", job.attempts, "and max_attempts = ", self.get_max_attempts(job), " consecutive failures")
-		return job.failIt(e.Error())
+		self.job_warn(job, "STOPPED permanently because of consecutive failures", "max_attempts", self.get_max_attempts(job))
+		return job.failIt(e.Error(), callbacks...)
+	}
+}
+
+// Mark the jobs which are past their deadline as expired.
+func (self *worker) expire_jobs() error {
+	jobs, e := self.backend.expiredJobs(self)
+	if nil != e {
+		return e
+	}
+
+	for _, job := range jobs {
+		if e := self.expired(job); nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+// An expired job is not retried anymore, it is failed (or destroyed) and the
+// fallback job in 'on_expired' is enqueued if it is present.
+func (self *worker) expired(job *Job) error {
+	msg := "[expired] the job is expired at " + job.expires_at.Format(time.RFC3339)
+	if "" != job.last_error {
+		msg = msg + ", last error is " + job.last_error
+	}
+	if len(msg) > 2000 {
+		msg = msg[:1900] + "\r\n===========================\r\n**error message is overflow."
+	}
+
+	callbacks := self.webhookCallbacks(job, JobFailed, time.Time{}, errors.New(msg))
+	ok, e := self.backend.expire(self, job, msg, callbacks...)
+	if nil != e || !ok {
+		return e
+	}
+	self.job_say(job, "EXPIRED", "expires_at", job.expires_at)
+	self.save_result(job, "expired", msg)
+	info := job.info()
+	metric_jobs_expired.inc(info.Queue, info.Type)
+	publishJobEvent(JobFailed, info, errors.New(msg))
+	self.backend.lifecycle.fire(EventPermanentFailure, info, errors.New(msg))
+
+	fallback, e := job.fallbackJob()
+	if nil != e {
+		self.job_warn(job, "create fallback job failed", "error", e)
+	} else if nil != fallback {
+		if e = self.backend.create(fallback); nil != e {
+			self.job_warn(job, "enqueue fallback job failed", "error", e)
+		} else {
+			self.job_say(job, "fallback job is enqueued")
+		}
+	}
+
+	if self.destroy_failed_jobs {
+		return job.destroyIt()
+	}
+	return nil
+}
+
+// prune removes the expired results and idempotency keys.
+func (self *worker) prune() {
+	if self.backend.result_ttl > 0 {
+		if e := self.backend.pruneResults(self.backend.db_time_now().Add(-self.backend.result_ttl)); nil != e {
+			self.log().Error("prune results failed", "error", e)
+		}
+	}
+
+	if *idempotency_ttl > 0 {
+		if e := self.backend.pruneIdempotencyKeys(self.backend.db_time_now()); nil != e {
+			self.log().Error("prune idempotency keys failed", "error", e)
+		}
+	}
+}
+
+// Keep the result of the finished job, so that it can be fetched after the job
+// is destroyed. It is kept only if the handler has a result or the job has
+// 'keep_result'.
+func (self *worker) save_result(job *Job, status, last_error string) {
+	if self.backend.result_ttl <= 0 {
+		return
+	}
+	result := job.result()
+	if nil == result && !job.keepResult() {
+		return
 	}
+	if e := self.backend.saveResult(job, status, result, last_error); nil != e {
+		self.job_warn(job, "save result failed", "error", e)
+	}
+}
+
+// job_say logs the message with the fields of the job, args are the key-value
+// pairs of the message (such as "error", e).
+func (self *worker) job_say(job *Job, msg string, args ...interface{}) {
+	self.job_log(slog.LevelInfo, job, msg, args...)
 }
 
-func (self *worker) job_say(job *Job, text ...interface{}) {
-	args := make([]interface{}, 0, 3+len(text))
+func (self *worker) job_warn(job *Job, msg string, args ...interface{}) {
+	self.job_log(slog.LevelWarn, job, msg, args...)
+}
+
+func (self *worker) job_log(level slog.Level, job *Job, msg string, args ...interface{}) {
+	logger := job.logger().With("worker", self.name)
 	if dump_job {
-		txt, _ := json.Marshal(job.handler_attributes)
-		args = append(args, "Job ", job.name(), string(txt))
-	} else {
-		args = append(args, "Job ", job.name(), " (id=", job.id, ") ")
+		logger = logger.With("handler", job.handler_attributes)
 	}
-	args = append(args, text...)
-	self.say(args...)
+	logger.Log(context.Background(), level, msg, args...)
 }
 
 func (self *worker) say(text ...interface{}) {
-	args := make([]interface{}, 0, 3+len(text))
-	args = append(args, "[Worker(", self.name, ")] ")
-	args = append(args, text...)
-	log.Println(args...)
+	self.log().Info(sprint(text...))
+}
+
+func (self *worker) log() *slog.Logger {
+	return self.backend.log().With("worker", self.name)
 }
 
 func (self *worker) get_max_attempts(job *Job) int {
@@ -322,7 +602,7 @@ func (self *worker) get_max_attempts(job *Job) int {
 }
 
 func (self *worker) handle_failed_job(job *Job, e error) error {
-	self.job_say(job, "FAILED (", job.attempts, " attempts and", self.get_max_attempts(job), " max_attempts) with ", e)
+	self.job_warn(job, "FAILED", "max_attempts", self.get_max_attempts(job), "error", e)
 	return self.reschedule(job, time.Time{}, e)
 }
 
@@ -334,7 +614,14 @@ func (self *worker) reschedule(job *Job, next_time time.Time, e error) error {
 		if next_time.IsZero() {
 			next_time = job.reschedule_at()
 		}
-		return job.rescheduleIt(next_time, e.Error())
+		if job.isExpired(next_time) {
+			job.last_error = e.Error()
+			return self.expired(job)
+		}
+		info := job.info()
+		metric_jobs_retried.inc(info.Queue, info.Type)
+		publishJobEvent(JobRetried, info, e)
+		return job.rescheduleIt(next_time, e.Error(), self.webhookCallbacks(job, JobRetried, next_time, e)...)
 	} else {
 		return self.failed(job, e)
 	}
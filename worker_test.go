@@ -407,3 +407,91 @@ func TestRunWithMaxErrorAndRescheduleIt(t *testing.T) {
 
 	})
 }
+
+func TestExpiredJobIsNotRun(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		job, e := createJobFromMap(backend, map[string]interface{}{
+			"priority":   1,
+			"queue":      "aa",
+			"expires_at": backend.db_time_now().Add(-1 * time.Minute),
+			"on_expired": map[string]interface{}{"type": "test", "handler_id": "fallback"},
+			"handler":    map[string]interface{}{"type": "test", "handler_id": "expired"}})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if e = backend.create(job); nil != e {
+			t.Error(e)
+			return
+		}
+
+		w := &worker{backend: backend, min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute}
+		reserved, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil != reserved {
+			t.Error("excepted expired job is not reserved, actual is", reserved.handler_id)
+			return
+		}
+
+		if e = w.expire_jobs(); nil != e {
+			t.Error(e)
+			return
+		}
+
+		row := backend.db.QueryRow("SELECT failed_at, last_error FROM " + *table_name + " WHERE handler_id = 'expired'")
+		var failed_at NullTime
+		var last_error sql.NullString
+		if e = row.Scan(&failed_at, &last_error); nil != e {
+			t.Error(e)
+			return
+		}
+		if !failed_at.Valid {
+			t.Error("excepted failed_at is valid, actual is invalid")
+		}
+		if !strings.Contains(last_error.String, "[expired]") {
+			t.Error("excepted last_error contains '[expired]', actual is", last_error.String)
+		}
+
+		fallback, e := backend.reserve(w)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if nil == fallback {
+			t.Error("excepted fallback job is enqueued, actual is nil")
+			return
+		}
+		if "fallback" != fallback.handler_id {
+			t.Error("excepted fallback job is reserved, actual is", fallback.handler_id)
+		}
+
+		select {
+		case <-test_chan:
+			t.Error("unexcepted recv")
+		default:
+		}
+	})
+}
+
+func TestSleepUntilNextRunAt(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		w := &worker{backend: backend, min_priority: -1, max_priority: -1, name: "aa_pid:123", max_run_time: 1 * time.Minute, sleep_delay: 10 * time.Second}
+		if delay := w.next_delay(); w.sleep_delay != delay {
+			t.Error("excepted delay is sleep_delay without jobs, actual is", delay)
+		}
+
+		e := backend.enqueue(1, 0, "", 0, "aa", backend.db_time_now().Add(3*time.Second), map[string]interface{}{"type": "test"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		delay := w.next_delay()
+		if delay > 3*time.Second || delay < 2*time.Second {
+			t.Error("excepted delay is about 3s, actual is", delay)
+		}
+	})
+}